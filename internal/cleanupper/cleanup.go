@@ -31,3 +31,23 @@ func (c *Cleanupper) Execute(timeout time.Duration) error {
 
 	return cleanupErrors
 }
+
+// Background runs fn in a goroutine until the returned shutdown closes the stop channel, the shutdown waits for fn
+// to return
+func Background(fn func(stop <-chan struct{})) Shutdown {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(stop)
+	}()
+	return func(ctx context.Context) error {
+		close(stop)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
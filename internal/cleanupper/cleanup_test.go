@@ -0,0 +1,51 @@
+package cleanupper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/cleanupper"
+)
+
+func TestBackgroundShutdownShouldStopAndWaitForTheWorker(t *testing.T) {
+	started := make(chan struct{})
+	stopped := false
+	shutdown := cleanupper.Background(func(stop <-chan struct{}) {
+		close(started)
+		<-stop
+		// The shutdown must wait for the worker to finish its work after being stopped
+		time.Sleep(10 * time.Millisecond)
+		stopped = true
+	})
+	<-started
+
+	require.NoError(t, shutdown(context.Background()))
+	assert.True(t, stopped)
+}
+
+func TestBackgroundShutdownShouldReturnWhenTheContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	shutdown := cleanupper.Background(func(stop <-chan struct{}) {
+		<-stop
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, shutdown(ctx), context.DeadlineExceeded)
+}
+
+func TestBackgroundShutdownShouldSucceedIfTheWorkerReturnedEarly(t *testing.T) {
+	done := make(chan struct{})
+	shutdown := cleanupper.Background(func(stop <-chan struct{}) {
+		close(done)
+	})
+	<-done
+
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,167 @@
+// Package parquet writes flat tables of optional columns as Apache Parquet files using parquet-go. Rows are buffered
+// and written as a row group once enough rows are collected, so files of any size can be streamed with bounded
+// memory.
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// DefaultRowGroupSize is the amount of rows in a row group
+const DefaultRowGroupSize = 50000
+
+var ErrValueType = errors.New("parquet: value does not match column type")
+
+// Type is the type of the values of a column
+type Type int
+
+const (
+	Boolean Type = iota
+	Int64
+	Double
+	String
+	// JSON is a string containing a JSON document
+	JSON
+	// Timestamp is stored as microseconds since the Unix epoch in UTC
+	Timestamp
+)
+
+// Column is an optional column of a table
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Writer writes rows to a Parquet file
+type Writer struct {
+	w            io.Writer
+	columns      []Column
+	RowGroupSize int
+
+	pw   *writer.CSVWriter
+	rows int
+	err  error
+}
+
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	return &Writer{
+		w:            w,
+		columns:      columns,
+		RowGroupSize: DefaultRowGroupSize,
+	}
+}
+
+// start creates the underlying writer, which immediately writes the file header. It is postponed until the first
+// row or the end of the file so nothing is written for a file that is never used.
+func (w *Writer) start() error {
+	if w.err != nil || w.pw != nil {
+		return w.err
+	}
+	metadata := make([]string, len(w.columns))
+	for ix, column := range w.columns {
+		metadata[ix] = fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", column.Name, columnType(column.Type))
+	}
+	w.pw, w.err = writer.NewCSVWriterFromWriter(metadata, w.w, 1)
+	return w.err
+}
+
+func columnType(t Type) string {
+	switch t {
+	case Boolean:
+		return "type=BOOLEAN"
+	case Int64:
+		return "type=INT64"
+	case Double:
+		return "type=DOUBLE"
+	case JSON:
+		return "type=BYTE_ARRAY, convertedtype=JSON"
+	case Timestamp:
+		return "type=INT64, convertedtype=TIMESTAMP_MICROS, isadjustedtoutc=true"
+	}
+	return "type=BYTE_ARRAY, convertedtype=UTF8"
+}
+
+// Write adds a row with a value for every column. A value is nil or a bool, int64, float64, string or time.Time
+// depending on the column type.
+func (w *Writer) Write(row []any) error {
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.columns))
+	}
+	record := make([]any, len(row))
+	for ix, value := range row {
+		v, err := columnValue(w.columns[ix], value)
+		if err != nil {
+			return err
+		}
+		record[ix] = v
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.pw.Write(record); err != nil {
+		w.err = err
+		return err
+	}
+	w.rows++
+	if w.rows >= w.RowGroupSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// columnValue converts a value to the value parquet-go stores for the column type
+func columnValue(column Column, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var ok bool
+	switch column.Type {
+	case Boolean:
+		_, ok = value.(bool)
+	case Int64:
+		_, ok = value.(int64)
+	case Double:
+		_, ok = value.(float64)
+	case String, JSON:
+		_, ok = value.(string)
+	case Timestamp:
+		var ts time.Time
+		if ts, ok = value.(time.Time); ok {
+			value = ts.UnixMicro()
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: column %s got %T", ErrValueType, column.Name, value)
+	}
+	return value, nil
+}
+
+// Flush writes the buffered rows as a row group
+func (w *Writer) Flush() error {
+	if w.err != nil || w.pw == nil || w.rows == 0 {
+		return w.err
+	}
+	if err := w.pw.Flush(true); err != nil {
+		w.err = err
+		return err
+	}
+	w.rows = 0
+	return nil
+}
+
+// Close writes the remaining rows and the file footer, it does not close the underlying writer
+func (w *Writer) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if err := w.pw.WriteStop(); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package parquet_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	parquetformat "github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"sensorbucket.nl/sensorbucket/internal/parquet"
+)
+
+func TestWriterShouldWriteReadableParquetFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := parquet.NewWriter(&buf, []parquet.Column{
+		{Name: "id", Type: parquet.Int64},
+		{Name: "value", Type: parquet.Double},
+		{Name: "device_code", Type: parquet.String},
+		{Name: "timestamp", Type: parquet.Timestamp},
+		{Name: "valid", Type: parquet.Boolean},
+		{Name: "properties", Type: parquet.JSON},
+	})
+	w.RowGroupSize = 2
+	ts := time.Date(2024, 10, 7, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, w.Write([]any{int64(1), 1.5, "a", ts, true, `{"a":1}`}))
+	require.NoError(t, w.Write([]any{int64(2), nil, "bb", ts.Add(time.Hour), false, nil}))
+	require.NoError(t, w.Write([]any{int64(3), 3.0, nil, nil, true, nil}))
+	assert.ErrorIs(t, w.Write([]any{"4", nil, nil, nil, nil, nil}), parquet.ErrValueType)
+	require.NoError(t, w.Close())
+
+	file, err := buffer.NewBufferFile(buf.Bytes())
+	require.NoError(t, err)
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	require.NoError(t, err)
+	defer pr.ReadStop()
+
+	assert.Equal(t, int64(3), pr.GetNumRows())
+	assert.Len(t, pr.Footer.RowGroups, 2)
+	schema := pr.Footer.Schema
+	require.Len(t, schema, 7)
+	assert.Equal(t, "device_code", pr.SchemaHandler.GetExName(3), "column names are kept as they are")
+	assert.Equal(t, parquetformat.FieldRepetitionType_OPTIONAL, schema[2].GetRepetitionType())
+	assert.Equal(t, parquetformat.ConvertedType_UTF8, schema[3].GetConvertedType())
+	assert.Equal(t, parquetformat.ConvertedType_TIMESTAMP_MICROS, schema[4].GetConvertedType())
+	assert.Equal(t, parquetformat.ConvertedType_JSON, schema[6].GetConvertedType())
+
+	column := func(ix int64) []any {
+		values, _, _, err := pr.ReadColumnByIndex(ix, pr.GetNumRows())
+		require.NoError(t, err)
+		return values
+	}
+	assert.Equal(t, []any{int64(1), int64(2), int64(3)}, column(0))
+	assert.Equal(t, []any{1.5, nil, 3.0}, column(1))
+	assert.Equal(t, []any{"a", "bb", nil}, column(2))
+	assert.Equal(t, []any{ts.UnixMicro(), ts.Add(time.Hour).UnixMicro(), nil}, column(3))
+	assert.Equal(t, []any{true, false, true}, column(4))
+	assert.Equal(t, []any{`{"a":1}`, nil, nil}, column(5))
+}
+
+func TestWriterShouldWriteNothingUntilUsed(t *testing.T) {
+	var buf bytes.Buffer
+	w := parquet.NewWriter(&buf, []parquet.Column{{Name: "id", Type: parquet.Int64}})
+	assert.Zero(t, buf.Len())
+	assert.ErrorIs(t, w.Write([]any{"1"}), parquet.ErrValueType)
+	assert.Zero(t, buf.Len())
+
+	require.NoError(t, w.Close())
+	file, err := buffer.NewBufferFile(buf.Bytes())
+	require.NoError(t, err)
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	require.NoError(t, err)
+	assert.Zero(t, pr.GetNumRows())
+}
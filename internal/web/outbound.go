@@ -0,0 +1,75 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrOutboundURLInvalid is returned for outbound URLs that are not absolute http(s) URLs
+	ErrOutboundURLInvalid = errors.New("outbound URL must be an absolute http(s) URL")
+	// ErrNonPublicAddress is returned for outbound requests to an address that is not publicly routable, as tenants
+	// could otherwise reach services in the internal network
+	ErrNonPublicAddress = errors.New("outbound address is not public")
+)
+
+// IsPublicAddr reports whether the address is not a private, loopback, link-local, multicast or unspecified address
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsPrivate() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified()
+}
+
+// ValidateOutboundURL checks that the URL is an absolute http(s) URL whose host is not a local name or a non public
+// address. Host names can still resolve to a non public address, which is refused when connecting with
+// NewOutboundClient.
+func ValidateOutboundURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrOutboundURLInvalid
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrNonPublicAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !IsPublicAddr(addr) {
+		return ErrNonPublicAddress
+	}
+	return nil
+}
+
+// NewOutboundClient creates an HTTP client for requests to tenant supplied URLs. It refuses to connect to non public
+// addresses, also when a host name resolves to one or a redirect points to one.
+func NewOutboundClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !IsPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrNonPublicAddress, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect to the target on our behalf, bypassing the check on the dialed address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
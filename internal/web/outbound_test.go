@@ -0,0 +1,49 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+func TestValidateOutboundURL(t *testing.T) {
+	testCases := []struct {
+		url string
+		err error
+	}{
+		{url: "https://example.com/hook"},
+		{url: "http://93.184.216.34:8080/hook"},
+		{url: "ftp://example.com", err: web.ErrOutboundURLInvalid},
+		{url: "/hook", err: web.ErrOutboundURLInvalid},
+		{url: "http://localhost:3000", err: web.ErrNonPublicAddress},
+		{url: "http://api.localhost.", err: web.ErrNonPublicAddress},
+		{url: "http://127.0.0.1", err: web.ErrNonPublicAddress},
+		{url: "http://10.1.2.3", err: web.ErrNonPublicAddress},
+		{url: "http://192.168.1.1", err: web.ErrNonPublicAddress},
+		{url: "http://169.254.169.254/latest/meta-data", err: web.ErrNonPublicAddress},
+		{url: "http://0.0.0.0", err: web.ErrNonPublicAddress},
+		{url: "http://[::1]:8080", err: web.ErrNonPublicAddress},
+		{url: "http://[fd00::1]", err: web.ErrNonPublicAddress},
+		{url: "http://[::ffff:127.0.0.1]", err: web.ErrNonPublicAddress},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.url, func(t *testing.T) {
+			assert.ErrorIs(t, web.ValidateOutboundURL(tC.url), tC.err)
+		})
+	}
+}
+
+func TestOutboundClientShouldNotConnectToLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := web.NewOutboundClient(time.Second).Get(server.URL)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, web.ErrNonPublicAddress)
+}
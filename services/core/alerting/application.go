@@ -0,0 +1,385 @@
+package alerting
+
+//go:generate moq -pkg alerting_test -out mock_test.go . Store Channel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/cleanupper"
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+const (
+	// EvaluationQueueSize is the amount of committed measurement batches waiting for evaluation. When the queue
+	// is full the evaluator catches up on the datastreams of a batch from the stored measurements instead, such
+	// that evaluating rules never delays storing measurements.
+	EvaluationQueueSize = 100
+	// CatchUpBatchSize is the amount of stored measurements of a datastream evaluated at once when catching up
+	CatchUpBatchSize = 1000
+)
+
+type Store interface {
+	// CreateRule stores the rule if its datastream or sensor group belongs to the tenant of the rule
+	CreateRule(ctx context.Context, rule *Rule) error
+	ListRules(ctx context.Context, tenantID int64, r pagination.Request) (*pagination.Page[Rule], error)
+	GetRule(ctx context.Context, id, tenantID int64) (*Rule, error)
+	DeleteRule(ctx context.Context, id, tenantID int64) error
+	ListAlerts(ctx context.Context, filter AlertFilter, r pagination.Request) (*pagination.Page[Alert], error)
+	// GetAlert returns nil if the rule has no alert for the datastream yet
+	GetAlert(ctx context.Context, ruleID int64, datastreamID uuid.UUID) (*Alert, error)
+	SaveAlert(ctx context.Context, alert *Alert) error
+	// ListRuleTargets returns the rules that apply to any of the datastreams, once for every datastream
+	ListRuleTargets(ctx context.Context, datastreamIDs []uuid.UUID) ([]RuleTarget, error)
+	// ListNoDataTargets returns the no data rules of all tenants once for every datastream they apply to,
+	// together with the timestamp of the latest measurement of the datastream
+	ListNoDataTargets(ctx context.Context) ([]RuleTarget, error)
+	// ListMeasurementsSince returns at most limit measurements of the datastream from the given timestamp
+	// onwards in chronological order
+	ListMeasurementsSince(ctx context.Context, datastreamID uuid.UUID, since time.Time, limit int) ([]measurements.Measurement, error)
+}
+
+// Channel delivers the events of alerts to a notification target
+type Channel interface {
+	Send(ctx context.Context, target string, event Event) error
+}
+
+// RuleTarget is a datastream a rule applies to
+type RuleTarget struct {
+	Rule         Rule
+	DatastreamID uuid.UUID
+	LastSeen     *time.Time
+}
+
+// Event is sent to the notification targets of a rule when one of its alerts changes state
+type Event struct {
+	RuleID   int64    `json:"rule_id"`
+	RuleName string   `json:"rule_name"`
+	RuleType RuleType `json:"rule_type"`
+	Alert    Alert    `json:"alert"`
+}
+
+func (event Event) Summary() string {
+	return fmt.Sprintf("Alert '%s' is %s for datastream %s", event.RuleName, event.Alert.State, event.Alert.DatastreamID)
+}
+
+type AlertFilter struct {
+	TenantID int64        `url:"-"`
+	RuleID   []int64      `url:"rule_id"`
+	State    []AlertState `url:"state"`
+}
+
+type Service struct {
+	store    Store
+	channels map[ChannelType]Channel
+	queue    chan []measurements.Measurement
+
+	missedLock sync.Mutex
+	// missed holds the earliest timestamp of every datastream with measurements that did not fit in the queue
+	missed map[uuid.UUID]time.Time
+}
+
+func New(store Store) *Service {
+	return &Service{
+		store:    store,
+		channels: map[ChannelType]Channel{},
+		queue:    make(chan []measurements.Measurement, EvaluationQueueSize),
+		missed:   map[uuid.UUID]time.Time{},
+	}
+}
+
+// WithChannel sets the channel notifications of the given type are sent with. Notifications for a channel
+// type without channel are skipped.
+func (s *Service) WithChannel(channelType ChannelType, channel Channel) *Service {
+	s.channels[channelType] = channel
+	return s
+}
+
+func (s *Service) CreateRule(ctx context.Context, opts CreateRuleOpts) (*Rule, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts.TenantID = tenantID
+	rule, err := NewRule(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *Service) ListRules(ctx context.Context, r pagination.Request) (*pagination.Page[Rule], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.ListRules(ctx, tenantID, r)
+}
+
+func (s *Service) GetRule(ctx context.Context, id int64) (*Rule, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.GetRule(ctx, id, tenantID)
+}
+
+func (s *Service) DeleteRule(ctx context.Context, id int64) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.store.DeleteRule(ctx, id, tenantID)
+}
+
+func (s *Service) ListAlerts(ctx context.Context, filter AlertFilter, r pagination.Request) (*pagination.Page[Alert], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter.TenantID = tenantID
+	return s.store.ListAlerts(ctx, filter, r)
+}
+
+// MeasurementsCommitted queues the measurements for evaluation by the started evaluator
+func (s *Service) MeasurementsCommitted(batch []measurements.Measurement) {
+	select {
+	case s.queue <- batch:
+	default:
+		s.markMissed(batch)
+		log.Printf("Alert evaluation queue is full, %d measurements will be evaluated from storage\n", len(batch))
+	}
+}
+
+// markMissed remembers the earliest measurement of every datastream in the batch, such that the next catch up
+// evaluates the stored measurements of those datastreams
+func (s *Service) markMissed(batch []measurements.Measurement) {
+	s.missedLock.Lock()
+	defer s.missedLock.Unlock()
+	for _, m := range batch {
+		if since, ok := s.missed[m.DatastreamID]; !ok || m.MeasurementTimestamp.Before(since) {
+			s.missed[m.DatastreamID] = m.MeasurementTimestamp
+		}
+	}
+}
+
+// withoutMissed leaves out the measurements of datastreams that are caught up on later, as evaluating their newer
+// measurements first would skip the missed ones
+func (s *Service) withoutMissed(batch []measurements.Measurement) []measurements.Measurement {
+	s.missedLock.Lock()
+	defer s.missedLock.Unlock()
+	if len(s.missed) == 0 {
+		return batch
+	}
+	return lo.Filter(batch, func(m measurements.Measurement, _ int) bool {
+		_, ok := s.missed[m.DatastreamID]
+		return !ok
+	})
+}
+
+// CatchUp evaluates the stored measurements of the datastreams of which measurements did not fit in the
+// evaluation queue. A datastream that fails is caught up on again at the next call.
+func (s *Service) CatchUp(ctx context.Context, now time.Time) error {
+	s.missedLock.Lock()
+	missed := s.missed
+	s.missed = map[uuid.UUID]time.Time{}
+	s.missedLock.Unlock()
+
+	var errs []error
+	for datastreamID, since := range missed {
+		if err := s.catchUpDatastream(ctx, datastreamID, since, now); err != nil {
+			s.markMissed([]measurements.Measurement{{DatastreamID: datastreamID, MeasurementTimestamp: since}})
+			errs = append(errs, fmt.Errorf("catching up on datastream %s: %w", datastreamID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) catchUpDatastream(ctx context.Context, datastreamID uuid.UUID, since, now time.Time) error {
+	for {
+		list, err := s.store.ListMeasurementsSince(ctx, datastreamID, since, CatchUpBatchSize)
+		if err != nil {
+			return fmt.Errorf("listing measurements: %w", err)
+		}
+		if err := s.EvaluateMeasurements(ctx, list, now); err != nil {
+			return err
+		}
+		if len(list) < CatchUpBatchSize {
+			return nil
+		}
+		// Timestamps are stored with microsecond precision
+		since = list[len(list)-1].MeasurementTimestamp.Add(time.Microsecond)
+	}
+}
+
+// StartEvaluator evaluates the rules for queued measurements as they are committed. At every interval it
+// catches up on measurements that did not fit in the queue and evaluates the no data rules.
+func (s *Service) StartEvaluator(interval time.Duration) cleanupper.Shutdown {
+	return cleanupper.Background(func(stop <-chan struct{}) {
+		log.Println("Alert evaluator started")
+		defer log.Println("Alert evaluator stopped!")
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case batch := <-s.queue:
+				if err := s.EvaluateMeasurements(context.Background(), s.withoutMissed(batch), time.Now()); err != nil {
+					log.Printf("Evaluating alert rules for measurements failed: %s\n", err.Error())
+				}
+			case now := <-t.C:
+				if err := s.CatchUp(context.Background(), now); err != nil {
+					log.Printf("Catching up on alert rules for measurements failed: %s\n", err.Error())
+				}
+				if err := s.EvaluateNoData(context.Background(), now); err != nil {
+					log.Printf("Evaluating no data alert rules failed: %s\n", err.Error())
+				}
+			}
+		}
+	})
+}
+
+// EvaluateMeasurements evaluates the rules of the datastreams of the measurements and notifies about
+// alerts that changed state. A measurement resolves a firing no data alert of its datastream.
+func (s *Service) EvaluateMeasurements(ctx context.Context, batch []measurements.Measurement, now time.Time) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	byDatastream := lo.GroupBy(batch, func(m measurements.Measurement) uuid.UUID { return m.DatastreamID })
+	targets, err := s.store.ListRuleTargets(ctx, lo.Keys(byDatastream))
+	if err != nil {
+		return fmt.Errorf("listing alert rule targets: %w", err)
+	}
+
+	var errs []error
+	for _, target := range targets {
+		list := slices.Clone(byDatastream[target.DatastreamID])
+		slices.SortFunc(list, func(a, b measurements.Measurement) int {
+			return a.MeasurementTimestamp.Compare(b.MeasurementTimestamp)
+		})
+		if err := s.evaluateTarget(ctx, target, func(rule Rule, alert *Alert) []Alert {
+			changes := []Alert{}
+			for _, m := range list {
+				// Rules only apply to the datastreams of their own tenant
+				if int64(m.OrganisationID) != rule.TenantID {
+					continue
+				}
+				var changed bool
+				if rule.Type == RuleTypeNoData {
+					changed = alert.observe(m.MeasurementValue, m.MeasurementTimestamp) &&
+						rule.evaluateNoData(alert, m.MeasurementTimestamp, now)
+				} else {
+					changed = rule.evaluate(alert, m.MeasurementValue, m.MeasurementTimestamp)
+				}
+				if changed {
+					changes = append(changes, *alert)
+				}
+			}
+			return changes
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EvaluateNoData evaluates the no data rules of all tenants. A datastream without measurements counts as
+// last seen when the rule was created.
+func (s *Service) EvaluateNoData(ctx context.Context, now time.Time) error {
+	targets, err := s.store.ListNoDataTargets(ctx)
+	if err != nil {
+		return fmt.Errorf("listing no data alert rule targets: %w", err)
+	}
+
+	var errs []error
+	for _, target := range targets {
+		lastSeen := target.Rule.CreatedAt
+		if target.LastSeen != nil {
+			lastSeen = *target.LastSeen
+		}
+		if err := s.evaluateTarget(ctx, target, func(rule Rule, alert *Alert) []Alert {
+			if rule.evaluateNoData(alert, lastSeen, now) {
+				return []Alert{*alert}
+			}
+			return nil
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// evaluateTarget applies the evaluation to the alert of the target, stores the alert and notifies about
+// every state change
+func (s *Service) evaluateTarget(ctx context.Context, target RuleTarget, evaluate func(Rule, *Alert) []Alert) error {
+	alert, err := s.store.GetAlert(ctx, target.Rule.ID, target.DatastreamID)
+	if err != nil {
+		return fmt.Errorf("getting alert of rule %d: %w", target.Rule.ID, err)
+	}
+	if alert == nil {
+		alert = lo.ToPtr(newAlert(target.Rule, target.DatastreamID))
+	}
+	previous := *alert
+	changes := evaluate(target.Rule, alert)
+	if *alert == previous {
+		return nil
+	}
+	if err := s.store.SaveAlert(ctx, alert); err != nil {
+		return fmt.Errorf("saving alert of rule %d: %w", target.Rule.ID, err)
+	}
+	for _, change := range changes {
+		s.notify(ctx, target.Rule, change)
+	}
+	return nil
+}
+
+// notify sends the event to every notification target of the rule. Failed notifications are not retried,
+// since the alert state is already stored.
+func (s *Service) notify(ctx context.Context, rule Rule, alert Alert) {
+	event := Event{
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		RuleType: rule.Type,
+		Alert:    alert,
+	}
+	for _, notification := range rule.Notifications {
+		channel, ok := s.channels[notification.Channel]
+		if !ok {
+			log.Printf("No %s channel configured, skipping notification for alert rule %d\n", notification.Channel, rule.ID)
+			continue
+		}
+		if err := channel.Send(ctx, notification.Target, event); err != nil {
+			log.Printf("Sending %s notification for alert rule %d failed: %s\n", notification.Channel, rule.ID, err.Error())
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package alerting_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// newAlertStore returns a store mock with the target that keeps the alert in memory
+func newAlertStore(target alerting.RuleTarget) *StoreMock {
+	var saved *alerting.Alert
+	return &StoreMock{
+		ListRuleTargetsFunc: func(ctx context.Context, datastreamIDs []uuid.UUID) ([]alerting.RuleTarget, error) {
+			return []alerting.RuleTarget{target}, nil
+		},
+		ListNoDataTargetsFunc: func(ctx context.Context) ([]alerting.RuleTarget, error) {
+			return []alerting.RuleTarget{target}, nil
+		},
+		GetAlertFunc: func(ctx context.Context, ruleID int64, datastreamID uuid.UUID) (*alerting.Alert, error) {
+			if saved == nil {
+				return nil, nil
+			}
+			alert := *saved
+			return &alert, nil
+		},
+		SaveAlertFunc: func(ctx context.Context, alert *alerting.Alert) error {
+			saved = alert
+			return nil
+		},
+	}
+}
+
+func newWebhookChannel() *ChannelMock {
+	return &ChannelMock{
+		SendFunc: func(ctx context.Context, target string, event alerting.Event) error {
+			return nil
+		},
+	}
+}
+
+func sentStates(channel *ChannelMock) []alerting.AlertState {
+	states := []alerting.AlertState{}
+	for _, call := range channel.SendCalls() {
+		states = append(states, call.Event.Alert.State)
+	}
+	return states
+}
+
+func TestThresholdRuleShouldFireAndResolveWithHysteresis(t *testing.T) {
+	datastreamID := uuid.New()
+	rule := alerting.Rule{
+		ID: 1, TenantID: authtest.DefaultTenantID, Name: "high water", Type: alerting.RuleTypeThreshold,
+		DatastreamID: &datastreamID, Operator: alerting.OperatorAbove, Threshold: 10, Hysteresis: 2,
+		Notifications: []alerting.Notification{{Channel: alerting.ChannelWebhook, Target: "https://example.com/hook"}},
+	}
+	store := newAlertStore(alerting.RuleTarget{Rule: rule, DatastreamID: datastreamID})
+	channel := newWebhookChannel()
+	svc := alerting.New(store).WithChannel(alerting.ChannelWebhook, channel)
+
+	start := time.Now()
+	for ix, value := range []float64{9, 11, 9, 8, 12} {
+		require.NoError(t, svc.EvaluateMeasurements(context.Background(), []measurements.Measurement{{
+			OrganisationID:       int(authtest.DefaultTenantID),
+			DatastreamID:         datastreamID,
+			MeasurementTimestamp: start.Add(time.Duration(ix) * time.Minute),
+			MeasurementValue:     value,
+		}}, time.Now()))
+	}
+
+	assert.Equal(t, []alerting.AlertState{alerting.AlertFiring, alerting.AlertResolved, alerting.AlertFiring}, sentStates(channel))
+	assert.Equal(t, "https://example.com/hook", channel.SendCalls()[0].Target)
+	assert.Equal(t, ptr(11.0), channel.SendCalls()[0].Event.Alert.Value)
+	assert.Equal(t, ptr(8.0), channel.SendCalls()[1].Event.Alert.Value)
+
+	// Measurements of other tenants do not affect the rule
+	require.NoError(t, svc.EvaluateMeasurements(context.Background(), []measurements.Measurement{{
+		OrganisationID:       int(authtest.DefaultTenantID) + 1,
+		DatastreamID:         datastreamID,
+		MeasurementTimestamp: start.Add(time.Hour),
+		MeasurementValue:     0,
+	}}, time.Now()))
+	assert.Len(t, channel.SendCalls(), 3)
+}
+
+func TestRateOfChangeRuleShouldCompareChangePerMinute(t *testing.T) {
+	datastreamID := uuid.New()
+	rule := alerting.Rule{
+		ID: 1, TenantID: authtest.DefaultTenantID, Name: "sudden drop", Type: alerting.RuleTypeRateOfChange,
+		DatastreamID: &datastreamID, Operator: alerting.OperatorBelow, Threshold: -1,
+		Notifications: []alerting.Notification{{Channel: alerting.ChannelWebhook, Target: "https://example.com/hook"}},
+	}
+	store := newAlertStore(alerting.RuleTarget{Rule: rule, DatastreamID: datastreamID})
+	channel := newWebhookChannel()
+	svc := alerting.New(store).WithChannel(alerting.ChannelWebhook, channel)
+
+	start := time.Now()
+	measurement := func(minutes int, value float64) measurements.Measurement {
+		return measurements.Measurement{
+			OrganisationID:       int(authtest.DefaultTenantID),
+			DatastreamID:         datastreamID,
+			MeasurementTimestamp: start.Add(time.Duration(minutes) * time.Minute),
+			MeasurementValue:     value,
+		}
+	}
+	// Measurements are evaluated in order of their timestamp
+	require.NoError(t, svc.EvaluateMeasurements(context.Background(), []measurements.Measurement{
+		measurement(4, 4), measurement(0, 10), measurement(2, 9),
+	}, time.Now()))
+
+	require.Len(t, channel.SendCalls(), 1)
+	event := channel.SendCalls()[0].Event
+	assert.Equal(t, alerting.AlertFiring, event.Alert.State)
+	assert.Equal(t, ptr(-2.5), event.Alert.Value)
+	assert.Equal(t, start.Add(4*time.Minute), *event.Alert.FiredAt)
+	require.Len(t, store.SaveAlertCalls(), 1)
+}
+
+func TestNoDataRuleShouldFireOnScheduleAndResolveOnIngestion(t *testing.T) {
+	datastreamID := uuid.New()
+	now := time.Now()
+	rule := alerting.Rule{
+		ID: 1, TenantID: authtest.DefaultTenantID, Name: "silent", Type: alerting.RuleTypeNoData,
+		DatastreamID: &datastreamID, NoDataMinutes: 15, CreatedAt: now.Add(-24 * time.Hour),
+		Notifications: []alerting.Notification{
+			{Channel: alerting.ChannelWebhook, Target: "https://example.com/hook"},
+			{Channel: alerting.ChannelEmail, Target: "operator@example.com"},
+		},
+	}
+	store := newAlertStore(alerting.RuleTarget{Rule: rule, DatastreamID: datastreamID, LastSeen: ptr(now.Add(-10 * time.Minute))})
+	channel := newWebhookChannel()
+	svc := alerting.New(store).WithChannel(alerting.ChannelWebhook, channel)
+
+	require.NoError(t, svc.EvaluateNoData(context.Background(), now))
+	assert.Empty(t, channel.SendCalls())
+	assert.Empty(t, store.SaveAlertCalls(), "unchanged alerts should not be stored")
+
+	// Without email channel only the webhook is notified
+	require.NoError(t, svc.EvaluateNoData(context.Background(), now.Add(10*time.Minute)))
+	assert.Equal(t, []alerting.AlertState{alerting.AlertFiring}, sentStates(channel))
+
+	require.NoError(t, svc.EvaluateMeasurements(context.Background(), []measurements.Measurement{{
+		OrganisationID:       int(authtest.DefaultTenantID),
+		DatastreamID:         datastreamID,
+		MeasurementTimestamp: now.Add(11 * time.Minute),
+		MeasurementValue:     1,
+	}}, now.Add(11*time.Minute)))
+	assert.Equal(t, []alerting.AlertState{alerting.AlertFiring, alerting.AlertResolved}, sentStates(channel))
+}
+
+func TestCreateRuleShouldValidate(t *testing.T) {
+	datastreamID := uuid.New()
+	valid := alerting.CreateRuleOpts{
+		Name: "high water", Type: alerting.RuleTypeThreshold, DatastreamID: &datastreamID,
+		Operator: alerting.OperatorAbove, Threshold: 10,
+		Notifications: []alerting.Notification{{Channel: alerting.ChannelEmail, Target: "operator@example.com"}},
+	}
+	testCases := []struct {
+		desc   string
+		modify func(opts *alerting.CreateRuleOpts)
+		err    error
+	}{
+		{desc: "without name", modify: func(opts *alerting.CreateRuleOpts) { opts.Name = "" }, err: alerting.ErrRuleNameRequired},
+		{desc: "without target", modify: func(opts *alerting.CreateRuleOpts) { opts.DatastreamID = nil }, err: alerting.ErrRuleTargetInvalid},
+		{desc: "with both targets", modify: func(opts *alerting.CreateRuleOpts) { opts.SensorGroupID = ptr(int64(1)) }, err: alerting.ErrRuleTargetInvalid},
+		{desc: "unknown type", modify: func(opts *alerting.CreateRuleOpts) { opts.Type = "spike" }, err: alerting.ErrRuleTypeInvalid},
+		{desc: "without operator", modify: func(opts *alerting.CreateRuleOpts) { opts.Operator = "" }, err: alerting.ErrRuleOperatorInvalid},
+		{desc: "negative hysteresis", modify: func(opts *alerting.CreateRuleOpts) { opts.Hysteresis = -1 }, err: alerting.ErrRuleHysteresisInvalid},
+		{desc: "no data without minutes", modify: func(opts *alerting.CreateRuleOpts) { opts.Type = alerting.RuleTypeNoData }, err: alerting.ErrRuleNoDataInvalid},
+		{
+			desc: "invalid email", err: alerting.ErrNotificationInvalid,
+			modify: func(opts *alerting.CreateRuleOpts) {
+				opts.Notifications = []alerting.Notification{{Channel: alerting.ChannelEmail, Target: "operator"}}
+			},
+		},
+		{
+			desc: "invalid webhook", err: alerting.ErrNotificationInvalid,
+			modify: func(opts *alerting.CreateRuleOpts) {
+				opts.Notifications = []alerting.Notification{{Channel: alerting.ChannelWebhook, Target: "ftp://example.com"}}
+			},
+		},
+		{
+			desc: "private webhook", err: alerting.ErrNotificationInvalid,
+			modify: func(opts *alerting.CreateRuleOpts) {
+				opts.Notifications = []alerting.Notification{{Channel: alerting.ChannelWebhook, Target: "http://169.254.169.254/latest"}}
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := &StoreMock{}
+			opts := valid
+			tC.modify(&opts)
+			_, err := alerting.New(store).CreateRule(authtest.GodContext(), opts)
+			assert.ErrorIs(t, err, tC.err)
+			assert.Empty(t, store.CreateRuleCalls())
+		})
+	}
+
+	store := &StoreMock{
+		CreateRuleFunc: func(ctx context.Context, rule *alerting.Rule) error {
+			rule.ID = 5
+			return nil
+		},
+	}
+	rule, err := alerting.New(store).CreateRule(authtest.GodContext(), valid)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), rule.ID)
+	assert.Equal(t, authtest.DefaultTenantID, rule.TenantID)
+}
+
+func TestEvaluatorShouldCatchUpOnMeasurementsThatDidNotFitInTheQueue(t *testing.T) {
+	datastreamID := uuid.New()
+	rule := alerting.Rule{
+		ID: 1, TenantID: authtest.DefaultTenantID, Name: "high water", Type: alerting.RuleTypeThreshold,
+		DatastreamID: &datastreamID, Operator: alerting.OperatorAbove, Threshold: 10,
+		Notifications: []alerting.Notification{{Channel: alerting.ChannelWebhook, Target: "https://example.com/hook"}},
+	}
+	start := time.Now().Truncate(time.Minute)
+	measurement := func(minutes int, value float64) measurements.Measurement {
+		return measurements.Measurement{
+			OrganisationID:       int(authtest.DefaultTenantID),
+			DatastreamID:         datastreamID,
+			MeasurementTimestamp: start.Add(time.Duration(minutes) * time.Minute),
+			MeasurementValue:     value,
+		}
+	}
+	stored := []measurements.Measurement{measurement(0, 11), measurement(1, 9)}
+	store := newAlertStore(alerting.RuleTarget{Rule: rule, DatastreamID: datastreamID})
+	store.ListMeasurementsSinceFunc = func(ctx context.Context, id uuid.UUID, since time.Time, limit int) ([]measurements.Measurement, error) {
+		return lo.Filter(stored, func(m measurements.Measurement, _ int) bool {
+			return m.DatastreamID == id && !m.MeasurementTimestamp.Before(since)
+		}), nil
+	}
+	channel := newWebhookChannel()
+	svc := alerting.New(store).WithChannel(alerting.ChannelWebhook, channel)
+
+	for ix := 0; ix < alerting.EvaluationQueueSize; ix++ {
+		svc.MeasurementsCommitted([]measurements.Measurement{})
+	}
+	svc.MeasurementsCommitted([]measurements.Measurement{stored[1], stored[0]})
+	assert.Empty(t, store.ListRuleTargetsCalls(), "measurements are not evaluated before catching up")
+
+	require.NoError(t, svc.CatchUp(context.Background(), time.Now()))
+	require.Len(t, store.ListMeasurementsSinceCalls(), 1)
+	assert.Equal(t, datastreamID, store.ListMeasurementsSinceCalls()[0].DatastreamID)
+	assert.Equal(t, start, store.ListMeasurementsSinceCalls()[0].Since)
+	assert.Equal(t, []alerting.AlertState{alerting.AlertFiring, alerting.AlertResolved}, sentStates(channel))
+
+	// A datastream is only caught up on once
+	require.NoError(t, svc.CatchUp(context.Background(), time.Now()))
+	assert.Len(t, store.ListMeasurementsSinceCalls(), 1)
+}
+
+func TestAsyncChannelShouldSendInBackground(t *testing.T) {
+	release := make(chan struct{})
+	channel := &ChannelMock{
+		SendFunc: func(ctx context.Context, target string, event alerting.Event) error {
+			<-release
+			return nil
+		},
+	}
+	async := alerting.NewAsyncChannel(channel, time.Second)
+	shutdown := async.Start(1)
+
+	require.NoError(t, async.Send(context.Background(), "https://example.com/hook", alerting.Event{RuleID: 1}))
+	require.NoError(t, async.Send(context.Background(), "https://example.com/hook", alerting.Event{RuleID: 2}))
+	close(release)
+	assert.Eventually(t, func() bool { return len(channel.SendCalls()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), channel.SendCalls()[1].Event.RuleID)
+	require.NoError(t, shutdown(context.Background()))
+}
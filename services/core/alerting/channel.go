@@ -0,0 +1,77 @@
+package alerting
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/cleanupper"
+)
+
+// NotificationQueueSize is the amount of notifications waiting to be sent by an async channel
+const NotificationQueueSize = 1000
+
+var _ Channel = (*AsyncChannel)(nil)
+
+type queuedNotification struct {
+	target string
+	event  Event
+}
+
+// AsyncChannel sends notifications with the wrapped channel in the background, such that a slow notification
+// target does not hold up evaluating rules
+type AsyncChannel struct {
+	channel Channel
+	timeout time.Duration
+	queue   chan queuedNotification
+}
+
+// NewAsyncChannel wraps the channel, every notification is given the timeout to be sent
+func NewAsyncChannel(channel Channel, timeout time.Duration) *AsyncChannel {
+	return &AsyncChannel{
+		channel: channel,
+		timeout: timeout,
+		queue:   make(chan queuedNotification, NotificationQueueSize),
+	}
+}
+
+// Send queues the notification, it only waits when the queue is full
+func (c *AsyncChannel) Send(ctx context.Context, target string, event Event) error {
+	select {
+	case c.queue <- queuedNotification{target: target, event: event}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Start sends the queued notifications with the given amount of workers
+func (c *AsyncChannel) Start(workers int) cleanupper.Shutdown {
+	return cleanupper.Background(func(stop <-chan struct{}) {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					case notification := <-c.queue:
+						c.send(notification)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func (c *AsyncChannel) send(notification queuedNotification) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := c.channel.Send(ctx, notification.target, notification.event); err != nil {
+		log.Printf("Sending notification for alert rule %d failed: %s\n", notification.event.RuleID, err.Error())
+	}
+}
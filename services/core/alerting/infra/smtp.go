@@ -0,0 +1,110 @@
+package alertinginfra
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
+)
+
+// SMTPTimeout limits connecting to and conversing with the mail server for a single email
+const SMTPTimeout = 30 * time.Second
+
+var _ alerting.Channel = (*SMTPChannel)(nil)
+
+// SMTPChannel sends alert events as plain text email
+type SMTPChannel struct {
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPChannel(host, username, password, from string) *SMTPChannel {
+	return &SMTPChannel{
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (c *SMTPChannel) Send(ctx context.Context, target string, event alerting.Event) error {
+	var body bytes.Buffer
+	body.WriteString(fmt.Sprintf("From: %s\nTo: %s\nSubject: [SensorBucket] %s\n", c.from, target, event.Summary()))
+	body.WriteString("MIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n")
+	body.WriteString(event.Summary() + "\n\n")
+	body.WriteString(fmt.Sprintf("Rule: %s (%d, %s)\n", event.RuleName, event.RuleID, event.RuleType))
+	body.WriteString(fmt.Sprintf("Datastream: %s\n", event.Alert.DatastreamID))
+	if event.Alert.Value != nil {
+		body.WriteString(fmt.Sprintf("Value: %g\n", *event.Alert.Value))
+	}
+	if event.Alert.FiredAt != nil {
+		body.WriteString(fmt.Sprintf("Fired at: %s\n", event.Alert.FiredAt.UTC().Format("2006-01-02 15:04:05 MST")))
+	}
+	if event.Alert.ResolvedAt != nil {
+		body.WriteString(fmt.Sprintf("Resolved at: %s\n", event.Alert.ResolvedAt.UTC().Format("2006-01-02 15:04:05 MST")))
+	}
+
+	if err := c.sendMail(ctx, target, body.Bytes()); err != nil {
+		return fmt.Errorf("sending alert email: %w", err)
+	}
+	return nil
+}
+
+// sendMail is smtp.SendMail with a timeout for connecting to and conversing with the mail server
+func (c *SMTPChannel) sendMail(ctx context.Context, to string, msg []byte) error {
+	dialer := net.Dialer{Timeout: SMTPTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(SMTPTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(c.host)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if err := client.Auth(smtp.CRAMMD5Auth(c.username, c.password)); err != nil {
+		return err
+	}
+	if err := client.Mail(c.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,324 @@
+package alertinginfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+var pq = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+var _ alerting.Store = (*StorePSQL)(nil)
+
+type StorePSQL struct {
+	databasePool *pgxpool.Pool
+}
+
+func NewStorePSQL(pool *pgxpool.Pool) *StorePSQL {
+	return &StorePSQL{databasePool: pool}
+}
+
+// ruleColumns are the columns selected for a rule, in the order of ruleScanTargets
+var ruleColumns = []string{
+	"r.id", "r.tenant_id", "r.name", "r.type", "r.datastream_id", "r.sensor_group_id", "r.observed_property",
+	"r.operator", "r.threshold", "r.hysteresis", "r.no_data_minutes", "r.notifications", "r.created_at",
+}
+
+func ruleScanTargets(rule *alerting.Rule) []any {
+	return []any{
+		&rule.ID, &rule.TenantID, &rule.Name, &rule.Type, &rule.DatastreamID, &rule.SensorGroupID, &rule.ObservedProperty,
+		&rule.Operator, &rule.Threshold, &rule.Hysteresis, &rule.NoDataMinutes, &rule.Notifications, &rule.CreatedAt,
+	}
+}
+
+// CreateRule only inserts the rule if its datastream or sensor group belongs to the tenant of the rule
+func (s *StorePSQL) CreateRule(ctx context.Context, rule *alerting.Rule) error {
+	err := s.databasePool.QueryRow(ctx, `
+		INSERT INTO alert_rules (
+			tenant_id, name, type, datastream_id, sensor_group_id, observed_property,
+			operator, threshold, hysteresis, no_data_minutes, notifications, created_at
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		WHERE EXISTS (SELECT 1 FROM datastreams WHERE id = $4 AND tenant_id = $1)
+		   OR EXISTS (SELECT 1 FROM sensor_groups WHERE id = $5 AND tenant_id = $1)
+		RETURNING id`,
+		rule.TenantID, rule.Name, rule.Type, rule.DatastreamID, rule.SensorGroupID, rule.ObservedProperty,
+		rule.Operator, rule.Threshold, rule.Hysteresis, rule.NoDataMinutes, rule.Notifications, rule.CreatedAt,
+	).Scan(&rule.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return alerting.ErrRuleTargetNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error inserting alert rule: %w", err)
+	}
+	return nil
+}
+
+type rulePageQuery struct {
+	ID int64 `pagination:"r.id,ASC"`
+}
+
+func (s *StorePSQL) ListRules(ctx context.Context, tenantID int64, r pagination.Request) (*pagination.Page[alerting.Rule], error) {
+	q := pq.Select(ruleColumns...).From("alert_rules r").Where(sq.Eq{"r.tenant_id": tenantID})
+
+	cursor, err := pagination.GetCursor[rulePageQuery](r)
+	if err != nil {
+		return nil, fmt.Errorf("list alert rules, error getting pagination cursor: %w", err)
+	}
+	q, err = pagination.Apply(q, cursor)
+	if err != nil {
+		return nil, err
+	}
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting alert rules from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]alerting.Rule, 0, cursor.Limit)
+	for rows.Next() {
+		var rule alerting.Rule
+		if err := rows.Scan(append(ruleScanTargets(&rule), &cursor.Columns.ID)...); err != nil {
+			return nil, err
+		}
+		list = append(list, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page := pagination.CreatePageT(list, cursor)
+	return &page, nil
+}
+
+func (s *StorePSQL) GetRule(ctx context.Context, id, tenantID int64) (*alerting.Rule, error) {
+	query, params, err := pq.Select(ruleColumns...).From("alert_rules r").
+		Where(sq.Eq{"r.id": id, "r.tenant_id": tenantID}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rule alerting.Rule
+	err = s.databasePool.QueryRow(ctx, query, params...).Scan(ruleScanTargets(&rule)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, alerting.ErrRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error selecting alert rule from db: %w", err)
+	}
+	return &rule, nil
+}
+
+func (s *StorePSQL) DeleteRule(ctx context.Context, id, tenantID int64) error {
+	res, err := s.databasePool.Exec(ctx, `DELETE FROM alert_rules WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("error deleting alert rule: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return alerting.ErrRuleNotFound
+	}
+	return nil
+}
+
+// alertColumns are the columns selected for an alert, in the order of alertScanTargets
+var alertColumns = []string{
+	"rule_id", "datastream_id", "tenant_id", "state", "value", "fired_at", "resolved_at", "last_value", "last_timestamp",
+}
+
+func alertScanTargets(alert *alerting.Alert) []any {
+	return []any{
+		&alert.RuleID, &alert.DatastreamID, &alert.TenantID, &alert.State, &alert.Value,
+		&alert.FiredAt, &alert.ResolvedAt, &alert.LastValue, &alert.LastTimestamp,
+	}
+}
+
+type alertPageQuery struct {
+	RuleID       int64     `pagination:"rule_id,ASC"`
+	DatastreamID uuid.UUID `pagination:"datastream_id,ASC"`
+}
+
+// ListAlerts only returns alerts that fired at least once
+func (s *StorePSQL) ListAlerts(ctx context.Context, filter alerting.AlertFilter, r pagination.Request) (*pagination.Page[alerting.Alert], error) {
+	q := pq.Select(alertColumns...).From("alerts").
+		Where(sq.Eq{"tenant_id": filter.TenantID}).Where(sq.NotEq{"fired_at": nil})
+	if len(filter.RuleID) > 0 {
+		q = q.Where(sq.Eq{"rule_id": filter.RuleID})
+	}
+	if len(filter.State) > 0 {
+		q = q.Where(sq.Eq{"state": filter.State})
+	}
+
+	cursor, err := pagination.GetCursor[alertPageQuery](r)
+	if err != nil {
+		return nil, fmt.Errorf("list alerts, error getting pagination cursor: %w", err)
+	}
+	q, err = pagination.Apply(q, cursor)
+	if err != nil {
+		return nil, err
+	}
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting alerts from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]alerting.Alert, 0, cursor.Limit)
+	for rows.Next() {
+		var alert alerting.Alert
+		if err := rows.Scan(append(alertScanTargets(&alert), &cursor.Columns.RuleID, &cursor.Columns.DatastreamID)...); err != nil {
+			return nil, err
+		}
+		list = append(list, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page := pagination.CreatePageT(list, cursor)
+	return &page, nil
+}
+
+func (s *StorePSQL) GetAlert(ctx context.Context, ruleID int64, datastreamID uuid.UUID) (*alerting.Alert, error) {
+	query, params, err := pq.Select(alertColumns...).From("alerts").
+		Where(sq.Eq{"rule_id": ruleID, "datastream_id": datastreamID}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var alert alerting.Alert
+	err = s.databasePool.QueryRow(ctx, query, params...).Scan(alertScanTargets(&alert)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error selecting alert from db: %w", err)
+	}
+	return &alert, nil
+}
+
+func (s *StorePSQL) SaveAlert(ctx context.Context, alert *alerting.Alert) error {
+	_, err := s.databasePool.Exec(ctx, `
+		INSERT INTO alerts (
+			rule_id, datastream_id, tenant_id, state, value, fired_at, resolved_at, last_value, last_timestamp, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (rule_id, datastream_id) DO UPDATE SET
+			state = EXCLUDED.state, value = EXCLUDED.value, fired_at = EXCLUDED.fired_at,
+			resolved_at = EXCLUDED.resolved_at, last_value = EXCLUDED.last_value,
+			last_timestamp = EXCLUDED.last_timestamp, updated_at = EXCLUDED.updated_at`,
+		alert.RuleID, alert.DatastreamID, alert.TenantID, alert.State, alert.Value,
+		alert.FiredAt, alert.ResolvedAt, alert.LastValue, alert.LastTimestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving alert: %w", err)
+	}
+	return nil
+}
+
+// ruleTargetsFrom matches rules by their datastream, or by a sensor group containing the sensor of the
+// datastream together with the optional observed property
+const ruleTargetsFrom = `
+	alert_rules r
+	JOIN datastreams ds ON ds.tenant_id = r.tenant_id AND (
+		ds.id = r.datastream_id OR (
+			r.sensor_group_id IS NOT NULL
+			AND (r.observed_property = '' OR r.observed_property = ds.observed_property)
+			AND EXISTS (
+				SELECT 1 FROM sensor_groups_sensors sgs
+				WHERE sgs.sensor_group_id = r.sensor_group_id AND sgs.sensor_id = ds.sensor_id
+			)
+		)
+	)`
+
+func (s *StorePSQL) ListRuleTargets(ctx context.Context, datastreamIDs []uuid.UUID) ([]alerting.RuleTarget, error) {
+	rows, err := s.databasePool.Query(ctx, fmt.Sprintf(`
+		SELECT %s, ds.id FROM %s
+		WHERE ds.id = ANY($1)`,
+		strings.Join(ruleColumns, ", "), ruleTargetsFrom,
+	), datastreamIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting alert rule targets from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []alerting.RuleTarget{}
+	for rows.Next() {
+		var target alerting.RuleTarget
+		if err := rows.Scan(append(ruleScanTargets(&target.Rule), &target.DatastreamID)...); err != nil {
+			return nil, err
+		}
+		list = append(list, target)
+	}
+	return list, rows.Err()
+}
+
+func (s *StorePSQL) ListNoDataTargets(ctx context.Context) ([]alerting.RuleTarget, error) {
+	rows, err := s.databasePool.Query(ctx, fmt.Sprintf(`
+		SELECT %s, ds.id, last.ts FROM %s
+		LEFT JOIN LATERAL (
+			SELECT measurement_timestamp AS ts FROM measurements
+			WHERE datastream_id = ds.id ORDER BY measurement_timestamp DESC LIMIT 1
+		) last ON true
+		WHERE r.type = $1`,
+		strings.Join(ruleColumns, ", "), ruleTargetsFrom,
+	), alerting.RuleTypeNoData)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting no data alert rule targets from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []alerting.RuleTarget{}
+	for rows.Next() {
+		var target alerting.RuleTarget
+		if err := rows.Scan(append(ruleScanTargets(&target.Rule), &target.DatastreamID, &target.LastSeen)...); err != nil {
+			return nil, err
+		}
+		list = append(list, target)
+	}
+	return list, rows.Err()
+}
+
+// ListMeasurementsSince returns at most limit measurements of the datastream from the given timestamp onwards in
+// chronological order
+func (s *StorePSQL) ListMeasurementsSince(
+	ctx context.Context,
+	datastreamID uuid.UUID,
+	since time.Time,
+	limit int,
+) ([]measurements.Measurement, error) {
+	rows, err := s.databasePool.Query(ctx, `
+		SELECT organisation_id, datastream_id, measurement_timestamp, measurement_value FROM measurements
+		WHERE datastream_id = $1 AND measurement_timestamp >= $2
+		ORDER BY measurement_timestamp ASC
+		LIMIT $3`,
+		datastreamID, since, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting measurements for alert evaluation from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []measurements.Measurement{}
+	for rows.Next() {
+		var m measurements.Measurement
+		if err := rows.Scan(&m.OrganisationID, &m.DatastreamID, &m.MeasurementTimestamp, &m.MeasurementValue); err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,47 @@
+package alertinginfra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
+)
+
+var _ alerting.Channel = (*WebhookChannel)(nil)
+
+// WebhookChannel posts alert events as JSON to the target URL
+type WebhookChannel struct {
+	httpClient *http.Client
+}
+
+func NewWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{
+		httpClient: web.NewOutboundClient(10 * time.Second),
+	}
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, target string, event alerting.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting alert webhook: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("posting alert webhook: unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
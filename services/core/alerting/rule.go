@@ -0,0 +1,269 @@
+package alerting
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+var (
+	ErrRuleNotFound          = web.NewError(http.StatusNotFound, "Alert rule not found", "ERR_ALERT_RULE_NOT_FOUND")
+	ErrRuleTargetNotFound    = web.NewError(http.StatusNotFound, "The datastream or sensor group of the alert rule was not found", "ERR_ALERT_RULE_TARGET_NOT_FOUND")
+	ErrRuleNameRequired      = web.NewError(http.StatusBadRequest, "Alert rule requires a name", "ERR_ALERT_RULE_NAME_REQUIRED")
+	ErrRuleTargetInvalid     = web.NewError(http.StatusBadRequest, "Alert rule requires either a datastream or a sensor group", "ERR_ALERT_RULE_TARGET_INVALID")
+	ErrRuleTypeInvalid       = web.NewError(http.StatusBadRequest, "Alert rule type must be one of threshold, rate_of_change or no_data", "ERR_ALERT_RULE_TYPE_INVALID")
+	ErrRuleOperatorInvalid   = web.NewError(http.StatusBadRequest, "Alert rule operator must be above or below", "ERR_ALERT_RULE_OPERATOR_INVALID")
+	ErrRuleHysteresisInvalid = web.NewError(http.StatusBadRequest, "Alert rule hysteresis can not be negative", "ERR_ALERT_RULE_HYSTERESIS_INVALID")
+	ErrRuleNoDataInvalid     = web.NewError(http.StatusBadRequest, "No data alert rule requires no_data_minutes of at least 1", "ERR_ALERT_RULE_NO_DATA_INVALID")
+	ErrNotificationInvalid   = web.NewError(http.StatusBadRequest, "Notification requires an email address for the email channel or an http(s) URL of a public host for the webhook channel", "ERR_ALERT_NOTIFICATION_INVALID")
+)
+
+type RuleType string
+
+const (
+	// RuleTypeThreshold fires when a measurement value passes the threshold
+	RuleTypeThreshold RuleType = "threshold"
+	// RuleTypeRateOfChange fires when the change per minute between consecutive measurements passes the threshold
+	RuleTypeRateOfChange RuleType = "rate_of_change"
+	// RuleTypeNoData fires when a datastream has not reported for the configured amount of minutes
+	RuleTypeNoData RuleType = "no_data"
+)
+
+type Operator string
+
+const (
+	OperatorAbove Operator = "above"
+	OperatorBelow Operator = "below"
+)
+
+type AlertState string
+
+const (
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+type ChannelType string
+
+const (
+	ChannelEmail   ChannelType = "email"
+	ChannelWebhook ChannelType = "webhook"
+)
+
+// Notification sends the state changes of the alerts of a rule to the target, which is an email address for
+// the email channel or a URL for the webhook channel
+type Notification struct {
+	Channel ChannelType `json:"channel"`
+	Target  string      `json:"target"`
+}
+
+func (n Notification) validate() error {
+	switch n.Channel {
+	case ChannelEmail:
+		if _, err := mail.ParseAddress(n.Target); err != nil {
+			return ErrNotificationInvalid
+		}
+	case ChannelWebhook:
+		if err := web.ValidateOutboundURL(n.Target); err != nil {
+			return fmt.Errorf("%w: %w", ErrNotificationInvalid, err)
+		}
+	default:
+		return ErrNotificationInvalid
+	}
+	return nil
+}
+
+// Rule watches a datastream or the datastreams of all sensors in a sensor group
+type Rule struct {
+	ID            int64      `json:"id"`
+	TenantID      int64      `json:"tenant_id"`
+	Name          string     `json:"name"`
+	Type          RuleType   `json:"type"`
+	DatastreamID  *uuid.UUID `json:"datastream_id"`
+	SensorGroupID *int64     `json:"sensor_group_id"`
+	// ObservedProperty limits a sensor group rule to the datastreams with this observed property
+	ObservedProperty string   `json:"observed_property"`
+	Operator         Operator `json:"operator"`
+	// Threshold is the measurement value for threshold rules and the change per minute for rate of change rules
+	Threshold float64 `json:"threshold"`
+	// Hysteresis is how far the value must return past the threshold before a firing alert resolves,
+	// which prevents an alert from flapping while the value hovers around the threshold
+	Hysteresis    float64        `json:"hysteresis"`
+	NoDataMinutes int            `json:"no_data_minutes"`
+	Notifications []Notification `json:"notifications"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+type CreateRuleOpts struct {
+	TenantID         int64          `json:"-"`
+	Name             string         `json:"name"`
+	Type             RuleType       `json:"type"`
+	DatastreamID     *uuid.UUID     `json:"datastream_id"`
+	SensorGroupID    *int64         `json:"sensor_group_id"`
+	ObservedProperty string         `json:"observed_property"`
+	Operator         Operator       `json:"operator"`
+	Threshold        float64        `json:"threshold"`
+	Hysteresis       float64        `json:"hysteresis"`
+	NoDataMinutes    int            `json:"no_data_minutes"`
+	Notifications    []Notification `json:"notifications"`
+}
+
+func NewRule(opts CreateRuleOpts) (*Rule, error) {
+	if opts.Name == "" {
+		return nil, ErrRuleNameRequired
+	}
+	if (opts.DatastreamID == nil) == (opts.SensorGroupID == nil) {
+		return nil, ErrRuleTargetInvalid
+	}
+	switch opts.Type {
+	case RuleTypeThreshold, RuleTypeRateOfChange:
+		if opts.Operator != OperatorAbove && opts.Operator != OperatorBelow {
+			return nil, ErrRuleOperatorInvalid
+		}
+		if opts.Hysteresis < 0 {
+			return nil, ErrRuleHysteresisInvalid
+		}
+		opts.NoDataMinutes = 0
+	case RuleTypeNoData:
+		if opts.NoDataMinutes < 1 {
+			return nil, ErrRuleNoDataInvalid
+		}
+		opts.Operator, opts.Threshold, opts.Hysteresis = "", 0, 0
+	default:
+		return nil, ErrRuleTypeInvalid
+	}
+	if opts.Notifications == nil {
+		opts.Notifications = []Notification{}
+	}
+	for _, n := range opts.Notifications {
+		if err := n.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DatastreamID != nil {
+		opts.ObservedProperty = ""
+	}
+
+	return &Rule{
+		TenantID:         opts.TenantID,
+		Name:             opts.Name,
+		Type:             opts.Type,
+		DatastreamID:     opts.DatastreamID,
+		SensorGroupID:    opts.SensorGroupID,
+		ObservedProperty: opts.ObservedProperty,
+		Operator:         opts.Operator,
+		Threshold:        opts.Threshold,
+		Hysteresis:       opts.Hysteresis,
+		NoDataMinutes:    opts.NoDataMinutes,
+		Notifications:    opts.Notifications,
+		CreatedAt:        time.Now(),
+	}, nil
+}
+
+// Alert is the state of a rule for one of its datastreams
+type Alert struct {
+	RuleID       int64      `json:"rule_id"`
+	DatastreamID uuid.UUID  `json:"datastream_id"`
+	TenantID     int64      `json:"tenant_id"`
+	State        AlertState `json:"state"`
+	// Value is the measurement value or rate of change that last fired or resolved the alert
+	Value      *float64   `json:"value"`
+	FiredAt    *time.Time `json:"fired_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	// LastValue and LastTimestamp are of the latest measurement evaluated by the rule
+	LastValue     *float64   `json:"last_value"`
+	LastTimestamp *time.Time `json:"last_timestamp"`
+}
+
+func newAlert(rule Rule, datastreamID uuid.UUID) Alert {
+	return Alert{
+		RuleID:       rule.ID,
+		DatastreamID: datastreamID,
+		TenantID:     rule.TenantID,
+		State:        AlertResolved,
+	}
+}
+
+func (alert *Alert) fire(value *float64, at time.Time) {
+	alert.State = AlertFiring
+	alert.Value = value
+	alert.FiredAt = &at
+	alert.ResolvedAt = nil
+}
+
+func (alert *Alert) resolve(value *float64, at time.Time) {
+	alert.State = AlertResolved
+	alert.Value = value
+	alert.ResolvedAt = &at
+}
+
+// observe records the measurement as the latest evaluated measurement, measurements that are not newer than
+// the latest evaluated measurement are ignored
+func (alert *Alert) observe(value float64, timestamp time.Time) bool {
+	if alert.LastTimestamp != nil && !timestamp.After(*alert.LastTimestamp) {
+		return false
+	}
+	alert.LastValue, alert.LastTimestamp = &value, &timestamp
+	return true
+}
+
+func (rule *Rule) exceeds(v float64) bool {
+	if rule.Operator == OperatorBelow {
+		return v < rule.Threshold
+	}
+	return v > rule.Threshold
+}
+
+func (rule *Rule) recovered(v float64) bool {
+	if rule.Operator == OperatorBelow {
+		return v >= rule.Threshold+rule.Hysteresis
+	}
+	return v <= rule.Threshold-rule.Hysteresis
+}
+
+// evaluate applies a measurement to the alert of a threshold or rate of change rule and reports whether
+// the alert changed state
+func (rule *Rule) evaluate(alert *Alert, value float64, timestamp time.Time) bool {
+	previousValue, previousTimestamp := alert.LastValue, alert.LastTimestamp
+	if !alert.observe(value, timestamp) {
+		return false
+	}
+
+	subject := value
+	if rule.Type == RuleTypeRateOfChange {
+		if previousValue == nil {
+			return false
+		}
+		subject = (value - *previousValue) / timestamp.Sub(*previousTimestamp).Minutes()
+	}
+
+	switch {
+	case alert.State != AlertFiring && rule.exceeds(subject):
+		alert.fire(&subject, timestamp)
+	case alert.State == AlertFiring && rule.recovered(subject):
+		alert.resolve(&subject, timestamp)
+	default:
+		return false
+	}
+	return true
+}
+
+// evaluateNoData fires the alert of a no data rule when the datastream was last seen longer than the
+// configured minutes ago and resolves it once the datastream reports again
+func (rule *Rule) evaluateNoData(alert *Alert, lastSeen, now time.Time) bool {
+	silent := now.Sub(lastSeen) >= time.Duration(rule.NoDataMinutes)*time.Minute
+	switch {
+	case alert.State != AlertFiring && silent:
+		alert.fire(nil, now)
+	case alert.State == AlertFiring && !silent:
+		alert.resolve(nil, lastSeen)
+	default:
+		return false
+	}
+	return true
+}
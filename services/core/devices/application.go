@@ -1,11 +1,12 @@
 package devices
 
-//go:generate moq -pkg devices_test -out mock_test.go . DeviceStore SensorGroupStore
+//go:generate moq -pkg devices_test -out mock_test.go . DeviceStore SensorGroupStore DeviceTemplateStore
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"sensorbucket.nl/sensorbucket/internal/pagination"
 	"sensorbucket.nl/sensorbucket/pkg/auth"
@@ -23,10 +24,19 @@ type DeviceStore interface {
 	ListSensors(context.Context, pagination.Request) (*pagination.Page[Sensor], error)
 	Find(ctx context.Context, id int64) (*Device, error)
 	Save(ctx context.Context, dev *Device) error
+	// CreateDevices creates new devices with their sensors in a single transaction
+	CreateDevices(ctx context.Context, devs []*Device) error
 	AddSensor(ctx context.Context, dev *Device, sensor *Sensor) error
 	UpdateSensor(ctx context.Context, id int64, opts UpdateSensorOpts) error
 	Delete(ctx context.Context, dev *Device) error
 	GetSensor(ctx context.Context, id int64) (*Sensor, error)
+	// AddLocations adds the locations to the history of their devices, a location equal to the preceding
+	// location of the device is skipped
+	AddLocations(ctx context.Context, locations []DeviceLocation) error
+	// ListLocations returns the locations of the device in the time range in chronological order
+	ListLocations(ctx context.Context, deviceID int64, filter DeviceLocationFilter) ([]DeviceLocation, error)
+	// GetLocationAt returns the latest location of the device at or before the given time
+	GetLocationAt(ctx context.Context, deviceID int64, at time.Time) (*DeviceLocation, error)
 }
 
 type SensorGroupStore interface {
@@ -36,20 +46,30 @@ type SensorGroupStore interface {
 	Get(id int64, tenantID int64) (*SensorGroup, error)
 }
 
+type DeviceTemplateStore interface {
+	Save(ctx context.Context, template *DeviceTemplate) error
+	Delete(ctx context.Context, id int64) error
+	List(ctx context.Context, p pagination.Request) (*pagination.Page[DeviceTemplate], error)
+	Get(ctx context.Context, id int64) (*DeviceTemplate, error)
+}
+
 type Service struct {
 	store                    DeviceStore
 	sensorGroupStore         SensorGroupStore
+	templateStore            DeviceTemplateStore
 	featureOfInterestService *featuresofinterest.Service
 }
 
 func New(
 	store DeviceStore,
 	sensorGroupStore SensorGroupStore,
+	templateStore DeviceTemplateStore,
 	featureOfInterestService *featuresofinterest.Service,
 ) *Service {
 	return &Service{
 		store:                    store,
 		sensorGroupStore:         sensorGroupStore,
+		templateStore:            templateStore,
 		featureOfInterestService: featureOfInterestService,
 	}
 }
@@ -60,6 +80,7 @@ type DeviceFilter struct {
 	ID         []int64
 	Code       []string
 	Sensor     []int64
+	Template   []int64
 	Properties json.RawMessage `json:"properties"`
 	OwnerID    int64
 }
@@ -114,12 +135,31 @@ func (s *Service) CreateDevice(ctx context.Context, dto NewDeviceOpts) (*Device,
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkCodeAvailable(ctx, dev.Code); err != nil {
+		return nil, err
+	}
 	if err := s.store.Save(ctx, dev); err != nil {
 		return nil, err
 	}
+	if err := s.recordLocations(ctx, createdLocations([]*Device{dev})); err != nil {
+		return nil, err
+	}
 	return dev, nil
 }
 
+// checkCodeAvailable returns ErrDuplicateDeviceCode if the tenant already has a device with the code. The store
+// enforces unique codes as well, this reports the common case before any changes are made.
+func (s *Service) checkCodeAvailable(ctx context.Context, code string) error {
+	page, err := s.store.List(ctx, DeviceFilter{Code: []string{code}}, pagination.Request{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("could not check device code: %w", err)
+	}
+	if len(page.Data) > 0 {
+		return ErrDuplicateDeviceCode
+	}
+	return nil
+}
+
 func (s *Service) GetDevice(ctx context.Context, id int64) (*Device, error) {
 	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
 		return nil, err
@@ -231,6 +271,11 @@ func (s *Service) UpdateDevice(ctx context.Context, dev *Device, opt UpdateDevic
 	if err := s.store.Save(ctx, dev); err != nil {
 		return err
 	}
+	if opt.Latitude != nil || opt.Longitude != nil || opt.Altitude != nil {
+		if location, ok := dev.LocationAt(time.Now(), LocationSourceAPI); ok {
+			return s.recordLocations(ctx, []DeviceLocation{location})
+		}
+	}
 
 	return nil
 }
@@ -446,3 +491,193 @@ func (s *Service) UpdateSensorGroup(
 
 	return nil
 }
+
+func (s *Service) CreateDeviceTemplate(ctx context.Context, opts NewDeviceTemplateOpts) (*DeviceTemplate, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_DEVICES}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := NewDeviceTemplate(tenantID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.templateStore.Save(ctx, template); err != nil {
+		return nil, fmt.Errorf("could not store device template: %w", err)
+	}
+	return template, nil
+}
+
+func (s *Service) ListDeviceTemplates(
+	ctx context.Context,
+	p pagination.Request,
+) (*pagination.Page[DeviceTemplate], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
+		return nil, err
+	}
+
+	return s.templateStore.List(ctx, p)
+}
+
+func (s *Service) GetDeviceTemplate(ctx context.Context, id int64) (*DeviceTemplate, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
+		return nil, err
+	}
+
+	return s.templateStore.Get(ctx, id)
+}
+
+// DeleteDeviceTemplate deletes the template, devices created from it keep their sensors
+func (s *Service) DeleteDeviceTemplate(ctx context.Context, template *DeviceTemplate) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_DEVICES}); err != nil {
+		return err
+	}
+
+	return s.templateStore.Delete(ctx, template.ID)
+}
+
+// CreateDeviceFromTemplate creates a device with the sensors and default properties of the template
+func (s *Service) CreateDeviceFromTemplate(
+	ctx context.Context,
+	template *DeviceTemplate,
+	opts NewDeviceOpts,
+) (*Device, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_DEVICES}); err != nil {
+		return nil, err
+	}
+
+	dev, err := template.NewDevice(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCodeAvailable(ctx, dev.Code); err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateDevices(ctx, []*Device{dev}); err != nil {
+		return nil, err
+	}
+	if err := s.recordLocations(ctx, createdLocations([]*Device{dev})); err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+type UpdateDeviceTemplateOpts struct {
+	Name        *string         `json:"name"`
+	Description *string         `json:"description"`
+	Properties  json.RawMessage `json:"properties"`
+	// Sensors replace the sensors of the template if not nil
+	Sensors []TemplateSensor `json:"sensors"`
+	// RemoveSensors removes the sensors that are no longer in the template from the devices when the update is
+	// propagated, otherwise these sensors are kept
+	RemoveSensors bool `json:"remove_sensors"`
+}
+
+// DeviceTemplateUpdate is the updated template with the changes to the devices created from it
+type DeviceTemplateUpdate struct {
+	Template *DeviceTemplate `json:"template"`
+	// Devices lists the devices that change if the template is propagated, or that changed if it was propagated
+	Devices    []TemplateDeviceChange `json:"devices"`
+	Propagated bool                   `json:"propagated"`
+}
+
+// PreviewDeviceTemplateUpdate returns the template as it would be updated and the changes to the devices created
+// from it if the update is propagated, without storing anything
+func (s *Service) PreviewDeviceTemplateUpdate(
+	ctx context.Context,
+	template *DeviceTemplate,
+	opts UpdateDeviceTemplateOpts,
+) (*DeviceTemplateUpdate, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
+		return nil, err
+	}
+
+	update, _, err := s.planDeviceTemplateUpdate(ctx, template, opts)
+	return update, err
+}
+
+// UpdateDeviceTemplate updates the template. If propagate is set, the sensors and default properties of the template
+// are also applied to every device created from it. Devices the template can not be applied to are skipped and reported.
+func (s *Service) UpdateDeviceTemplate(
+	ctx context.Context,
+	template *DeviceTemplate,
+	opts UpdateDeviceTemplateOpts,
+	propagate bool,
+) (*DeviceTemplateUpdate, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_DEVICES}); err != nil {
+		return nil, err
+	}
+
+	update, devs, err := s.planDeviceTemplateUpdate(ctx, template, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.templateStore.Save(ctx, update.Template); err != nil {
+		return nil, fmt.Errorf("update device template, could not save: %w", err)
+	}
+	*template = *update.Template
+	if !propagate {
+		return update, nil
+	}
+
+	for ix, dev := range devs {
+		if dev == nil {
+			continue
+		}
+		if err := s.store.Save(ctx, dev); err != nil {
+			update.Devices[ix].Error = err.Error()
+		}
+	}
+	update.Propagated = true
+	return update, nil
+}
+
+// planDeviceTemplateUpdate applies the update to a copy of the template and to every device created from it. The
+// returned devices are in the order of the changes and nil for devices the template can not be applied to.
+func (s *Service) planDeviceTemplateUpdate(
+	ctx context.Context,
+	template *DeviceTemplate,
+	opts UpdateDeviceTemplateOpts,
+) (*DeviceTemplateUpdate, []*Device, error) {
+	updated := *template
+	if opts.Name != nil {
+		if err := updated.SetName(*opts.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.Description != nil {
+		updated.Description = *opts.Description
+	}
+	if err := updated.SetProperties(opts.Properties); err != nil {
+		return nil, nil, err
+	}
+	if opts.Sensors != nil {
+		if err := updated.SetSensors(opts.Sensors); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	existing, err := s.listAllDevices(ctx, DeviceFilter{Template: []int64{template.ID}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list devices of template: %w", err)
+	}
+	update := &DeviceTemplateUpdate{Template: &updated, Devices: []TemplateDeviceChange{}}
+	devs := []*Device{}
+	for ix := range existing {
+		dev := &existing[ix]
+		change, err := updated.ApplyTo(dev, template, opts.RemoveSensors)
+		if err != nil {
+			change.Error = err.Error()
+			dev = nil
+		}
+		if change.IsEmpty() {
+			continue
+		}
+		update.Devices = append(update.Devices, change)
+		devs = append(devs, dev)
+	}
+	return update, devs, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"sensorbucket.nl/sensorbucket/internal/pagination"
 	"sensorbucket.nl/sensorbucket/pkg/authtest"
 	"sensorbucket.nl/sensorbucket/services/core/devices"
 )
@@ -39,12 +40,17 @@ func TestServiceDeviceUpdates(t *testing.T) {
 		LocationDescription: "location_description_a",
 	}
 	var newDevice devices.Device
-	store := &DeviceStoreMock{SaveFunc: func(ctx context.Context, dev *devices.Device) error {
-		newDevice = *dev
-		return nil
-	}}
+	store := &DeviceStoreMock{
+		SaveFunc: func(ctx context.Context, dev *devices.Device) error {
+			newDevice = *dev
+			return nil
+		},
+		AddLocationsFunc: func(ctx context.Context, locations []devices.DeviceLocation) error {
+			return nil
+		},
+	}
 
-	svc := devices.New(store, nil, nil)
+	svc := devices.New(store, nil, nil, nil)
 
 	err := svc.UpdateDevice(authtest.GodContext(), &originalDevice, updateDTO)
 	assert.NoError(t, err)
@@ -55,6 +61,16 @@ func TestServiceDeviceUpdates(t *testing.T) {
 	assert.EqualValues(t, newDevice.State, *updateDTO.State)
 	assert.EqualValues(t, newDevice.LocationDescription, *updateDTO.LocationDescription)
 	assert.EqualValues(t, newDevice.Properties, updateDTO.Properties)
+	require.Len(t, store.AddLocationsCalls(), 1, "an updated location is added to the location history")
+	location := store.AddLocationsCalls()[0].Locations[0]
+	assert.Equal(t, devices.LocationSourceAPI, location.Source)
+	assert.Equal(t, 30.0, location.Latitude)
+	assert.Equal(t, 40.0, location.Longitude)
+	assert.Equal(t, ptr(50.0), location.Altitude)
+
+	err = svc.UpdateDevice(authtest.GodContext(), &originalDevice, devices.UpdateDeviceOpts{Description: ptr("c")})
+	assert.NoError(t, err)
+	assert.Len(t, store.AddLocationsCalls(), 1, "an update without location does not add to the location history")
 }
 
 func TestServiceCreateDevice(t *testing.T) {
@@ -69,11 +85,19 @@ func TestServiceCreateDevice(t *testing.T) {
 		LocationDescription: "location_description_a",
 	}
 	var storedDev *devices.Device
-	store := &DeviceStoreMock{SaveFunc: func(ctx context.Context, dev *devices.Device) error {
-		storedDev = dev
-		return nil
-	}}
-	svc := devices.New(store, nil, nil)
+	store := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, p pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{}}, nil
+		},
+		SaveFunc: func(ctx context.Context, dev *devices.Device) error {
+			storedDev = dev
+			return nil
+		},
+		AddLocationsFunc: func(ctx context.Context, locations []devices.DeviceLocation) error {
+			return nil
+		},
+	}
+	svc := devices.New(store, nil, nil, nil)
 
 	_, err := svc.CreateDevice(authtest.GodContext(), newDTO)
 	assert.NoError(t, err)
@@ -87,6 +111,23 @@ func TestServiceCreateDevice(t *testing.T) {
 	assert.EqualValues(t, newDTO.LocationDescription, storedDev.LocationDescription)
 	assert.EqualValues(t, newDTO.Properties, storedDev.Properties)
 	assert.Len(t, storedDev.Sensors, 0)
+	require.Len(t, store.AddLocationsCalls(), 1, "the initial location starts the location history")
+	assert.Equal(t, storedDev.CreatedAt, store.AddLocationsCalls()[0].Locations[0].Timestamp)
+}
+
+func TestServiceCreateDeviceShouldRejectDuplicateCode(t *testing.T) {
+	store := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, p pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{{ID: 1, Code: filter.Code[0]}}}, nil
+		},
+	}
+	svc := devices.New(store, nil, nil, nil)
+
+	_, err := svc.CreateDevice(authtest.GodContext(), devices.NewDeviceOpts{Code: "1234"})
+	assert.ErrorIs(t, err, devices.ErrDuplicateDeviceCode)
+	require.Len(t, store.ListCalls(), 1)
+	assert.Equal(t, []string{"1234"}, store.ListCalls()[0].DeviceFilter.Code)
+	assert.Empty(t, store.SaveCalls())
 }
 
 func TestServiceShouldAddSensor(t *testing.T) {
@@ -113,7 +154,7 @@ func TestServiceShouldAddSensor(t *testing.T) {
 			return nil
 		},
 	}
-	svc := devices.New(store, nil, nil)
+	svc := devices.New(store, nil, nil, nil)
 
 	// Act
 	err := svc.AddSensor(authtest.GodContext(), &dev, sensorDTO)
@@ -161,7 +202,7 @@ func TestServiceShouldAddSensorToSensorGroup(t *testing.T) {
 			return nil
 		},
 	}
-	svc := devices.New(deviceStore, sensorGroupStore, nil)
+	svc := devices.New(deviceStore, sensorGroupStore, nil, nil)
 
 	// Act
 	err := svc.AddSensorToSensorGroup(authtest.GodContext(), sensorGroupID, sensorID)
@@ -202,7 +243,7 @@ func TestServiceShouldDeleteSensorFromSensorGroup(t *testing.T) {
 			return nil
 		},
 	}
-	svc := devices.New(deviceStore, sensorGroupStore, nil)
+	svc := devices.New(deviceStore, sensorGroupStore, nil, nil)
 
 	// Act
 	err := svc.DeleteSensorFromSensorGroup(authtest.GodContext(), sensorGroupID, sensorID)
@@ -236,7 +277,7 @@ func TestServiceShouldDeleteSensorGroup(t *testing.T) {
 			return nil
 		},
 	}
-	svc := devices.New(deviceStore, sensorGroupStore, nil)
+	svc := devices.New(deviceStore, sensorGroupStore, nil, nil)
 
 	// Act
 	err := svc.DeleteSensorGroup(authtest.GodContext(), sensorGroup)
@@ -266,7 +307,7 @@ func TestServiceShouldUpdateSensorGroup(t *testing.T) {
 			return nil
 		},
 	}
-	svc := devices.New(deviceStore, sensorGroupStore, nil)
+	svc := devices.New(deviceStore, sensorGroupStore, nil, nil)
 	dto := devices.UpdateSensorGroupOpts{
 		Name: &updatedName,
 	}
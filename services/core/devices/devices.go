@@ -21,6 +21,11 @@ var (
 		"code invalid, it must be a-z A-Z 0-9 and not start with '-' or '_'",
 		"INVALID_CODE",
 	)
+	ErrDuplicateDeviceCode = web.NewError(
+		http.StatusConflict,
+		"device with that code already exists",
+		"DEVICE_DUPLICATE_CODE",
+	)
 	ErrDeviceNotFound = web.NewError(
 		http.StatusNotFound,
 		"device not found",
@@ -78,7 +83,9 @@ type Device struct {
 	Altitude            *float64        `json:"altitude"`
 	State               DeviceState     `json:"state"`
 	LocationDescription string          `json:"location_description" db:"location_description"`
-	CreatedAt           time.Time       `json:"created_at" db:"created_at"`
+	// TemplateID is the device template the device was created from
+	TemplateID *int64    `json:"template_id" db:"template_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 }
 
 type Sensor struct {
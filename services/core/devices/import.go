@@ -0,0 +1,321 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/featuresofinterest"
+)
+
+// MaxImportDevices limits the amount of devices in a single import
+const MaxImportDevices = 1000
+
+var (
+	ErrImportModeInvalid = web.NewError(http.StatusBadRequest, "Import mode is invalid, use one of: transactional, best_effort", "ERR_IMPORT_MODE_INVALID")
+	ErrImportSizeInvalid = web.NewError(http.StatusBadRequest, fmt.Sprintf("Import requires between 1 and %d devices", MaxImportDevices), "ERR_IMPORT_SIZE_INVALID")
+	ErrImportInvalid     = web.NewError(http.StatusBadRequest, "Import file is invalid", "ERR_IMPORT_INVALID")
+)
+
+type ImportMode string
+
+const (
+	// ImportTransactional creates all devices or none if any of them is invalid
+	ImportTransactional ImportMode = "transactional"
+	// ImportBestEffort creates every valid device and reports the invalid devices
+	ImportBestEffort ImportMode = "best_effort"
+)
+
+func ParseImportMode(str string) (ImportMode, error) {
+	switch mode := ImportMode(str); mode {
+	case "":
+		return ImportTransactional, nil
+	case ImportTransactional, ImportBestEffort:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrImportModeInvalid, str)
+}
+
+// ImportDevice is a device with its sensors as imported and exported
+type ImportDevice struct {
+	NewDeviceOpts
+	Sensors []NewSensorDTO `json:"sensors"`
+	// Row is the position of the device in the import used to report errors, for CSV it is the line of the first
+	// record of the device
+	Row int `json:"-"`
+}
+
+// NewImportDevice converts the device such that it can be imported again
+func NewImportDevice(dev Device) ImportDevice {
+	imp := ImportDevice{
+		NewDeviceOpts: NewDeviceOpts{
+			Code:                dev.Code,
+			Description:         dev.Description,
+			Properties:          dev.Properties,
+			Longitude:           dev.Longitude,
+			Latitude:            dev.Latitude,
+			Altitude:            dev.Altitude,
+			LocationDescription: dev.LocationDescription,
+			State:               dev.State,
+		},
+		Sensors: make([]NewSensorDTO, 0, len(dev.Sensors)),
+	}
+	for _, sensor := range dev.Sensors {
+		dto := NewSensorDTO{
+			Code:        sensor.Code,
+			Brand:       sensor.Brand,
+			Description: sensor.Description,
+			ExternalID:  sensor.ExternalID,
+			Properties:  sensor.Properties,
+			ArchiveTime: sensor.ArchiveTime,
+			IsFallback:  sensor.IsFallback,
+		}
+		if sensor.FeatureOfInterest != nil {
+			dto.FeatureOfInterestID = sensor.FeatureOfInterest.ID
+		}
+		imp.Sensors = append(imp.Sensors, dto)
+	}
+	return imp
+}
+
+type ImportOptions struct {
+	// DryRun validates every device without creating any
+	DryRun bool
+	Mode   ImportMode
+}
+
+// ImportError is a validation or storage error of an imported device or one of its sensors
+type ImportError struct {
+	// Sensor is the code of the sensor the error belongs to, empty for errors of the device itself
+	Sensor  string `json:"sensor,omitempty"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+func newImportError(sensor string, err error) ImportError {
+	ie := ImportError{Sensor: sensor, Message: err.Error()}
+	var apiError *web.APIError
+	if errors.As(err, &apiError) {
+		ie.Code = apiError.Code
+	}
+	return ie
+}
+
+type ImportRowResult struct {
+	Row  int    `json:"row"`
+	Code string `json:"code"`
+	// DeviceID is set once the device is created
+	DeviceID int64         `json:"device_id,omitempty"`
+	Errors   []ImportError `json:"errors"`
+}
+
+type ImportResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Mode    ImportMode        `json:"mode"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportDevices creates devices with their sensors in bulk. Every device is validated first, the result reports
+// the errors per device. A transactional import creates nothing if any device is invalid, a best effort import
+// creates the valid devices.
+func (s *Service) ImportDevices(ctx context.Context, imports []ImportDevice, opts ImportOptions) (*ImportResult, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_DEVICES}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Mode == "" {
+		opts.Mode = ImportTransactional
+	}
+	if opts.Mode != ImportTransactional && opts.Mode != ImportBestEffort {
+		return nil, fmt.Errorf("%w: %s", ErrImportModeInvalid, opts.Mode)
+	}
+	if len(imports) == 0 || len(imports) > MaxImportDevices {
+		return nil, ErrImportSizeInvalid
+	}
+
+	devs, result, err := s.validateImport(ctx, tenantID, imports)
+	if err != nil {
+		return nil, err
+	}
+	result.DryRun = opts.DryRun
+	result.Mode = opts.Mode
+	if opts.DryRun || (opts.Mode == ImportTransactional && result.Failed > 0) {
+		return result, nil
+	}
+
+	if opts.Mode == ImportTransactional {
+		if err := s.store.CreateDevices(ctx, devs); err != nil {
+			return nil, fmt.Errorf("could not import devices: %w", err)
+		}
+		for ix, dev := range devs {
+			result.Rows[ix].DeviceID = dev.ID
+		}
+		result.Created = len(devs)
+		if err := s.recordLocations(ctx, createdLocations(devs)); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	created := []*Device{}
+	for ix, dev := range devs {
+		if dev == nil {
+			continue
+		}
+		if err := s.store.CreateDevices(ctx, []*Device{dev}); err != nil {
+			result.Rows[ix].Errors = append(result.Rows[ix].Errors, newImportError("", err))
+			result.Failed++
+			continue
+		}
+		result.Rows[ix].DeviceID = dev.ID
+		result.Created++
+		created = append(created, dev)
+	}
+	if err := s.recordLocations(ctx, createdLocations(created)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// validateImport creates the devices of the import without storing them. Invalid devices are nil and have their
+// errors reported in the result.
+func (s *Service) validateImport(
+	ctx context.Context,
+	tenantID int64,
+	imports []ImportDevice,
+) ([]*Device, *ImportResult, error) {
+	codes := make([]string, len(imports))
+	for ix, imp := range imports {
+		codes[ix] = imp.Code
+	}
+	existing, err := s.listAllDevices(ctx, DeviceFilter{Code: codes})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list existing devices: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, dev := range existing {
+		seen[dev.Code] = true
+	}
+	features := map[int64]*featuresofinterest.FeatureOfInterest{}
+
+	devs := make([]*Device, len(imports))
+	result := &ImportResult{Total: len(imports), Rows: make([]ImportRowResult, len(imports))}
+	for ix, imp := range imports {
+		row := &result.Rows[ix]
+		row.Row = imp.Row
+		if row.Row == 0 {
+			row.Row = ix + 1
+		}
+		row.Code = imp.Code
+		row.Errors = []ImportError{}
+
+		if seen[imp.Code] {
+			row.Errors = append(row.Errors, newImportError("", ErrDuplicateDeviceCode))
+		}
+		seen[imp.Code] = true
+		dev, err := NewDevice(tenantID, imp.NewDeviceOpts)
+		if err != nil {
+			row.Errors = append(row.Errors, newImportError("", err))
+			// Sensors can still be validated on a placeholder to report all errors at once
+			dev = &Device{TenantID: tenantID}
+		}
+		for _, dto := range imp.Sensors {
+			opts, err := s.newSensorOpts(ctx, dto, features)
+			if err == nil {
+				_, err = dev.AddSensor(opts)
+			}
+			if err != nil {
+				row.Errors = append(row.Errors, newImportError(dto.Code, err))
+			}
+		}
+
+		if len(row.Errors) > 0 {
+			result.Failed++
+			continue
+		}
+		devs[ix] = dev
+	}
+	return devs, result, nil
+}
+
+// newSensorOpts resolves the feature of interest of the sensor, features are cached by ID
+func (s *Service) newSensorOpts(
+	ctx context.Context,
+	dto NewSensorDTO,
+	features map[int64]*featuresofinterest.FeatureOfInterest,
+) (NewSensorOpts, error) {
+	opts := NewSensorOpts{
+		Code:        dto.Code,
+		Brand:       dto.Brand,
+		Description: dto.Description,
+		ExternalID:  dto.ExternalID,
+		Properties:  dto.Properties,
+		ArchiveTime: dto.ArchiveTime,
+		IsFallback:  dto.IsFallback,
+	}
+	if dto.FeatureOfInterestID <= 0 {
+		return opts, nil
+	}
+	feature, ok := features[dto.FeatureOfInterestID]
+	if !ok {
+		var err error
+		feature, err = s.featureOfInterestService.GetFeatureOfInterest(ctx, dto.FeatureOfInterestID)
+		if err != nil {
+			return opts, err
+		}
+		features[dto.FeatureOfInterestID] = feature
+	}
+	opts.FeatureOfInterest = feature
+	return opts, nil
+}
+
+// ExportDevices returns all devices matching the filter in the format accepted by ImportDevices
+func (s *Service) ExportDevices(ctx context.Context, filter DeviceFilter) ([]ImportDevice, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
+		return nil, err
+	}
+
+	devs, err := s.listAllDevices(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]ImportDevice, len(devs))
+	for ix, dev := range devs {
+		exports[ix] = NewImportDevice(dev)
+	}
+	return exports, nil
+}
+
+// listAllDevices walks every page of devices matching the filter
+func (s *Service) listAllDevices(ctx context.Context, filter DeviceFilter) ([]Device, error) {
+	list := s.store.List
+	if filter.HasBoundingBox() {
+		list = s.store.ListInBoundingBox
+	} else if filter.HasRange() {
+		list = s.store.ListInRange
+	}
+
+	devs := []Device{}
+	p := pagination.Request{Limit: pagination.MAX_LIMIT}
+	for {
+		page, err := list(ctx, filter, p)
+		if err != nil {
+			return nil, err
+		}
+		devs = append(devs, page.Data...)
+		if page.Cursor == "" {
+			return devs, nil
+		}
+		p.Cursor = page.Cursor
+	}
+}
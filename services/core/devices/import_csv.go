@@ -0,0 +1,235 @@
+package devices
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ImportCSVColumns are the columns of a device import or export in CSV. Every record holds a single sensor, records
+// with the same device code belong to the same device of which the fields are taken from its first record. A
+// record without sensor code holds a device without sensors.
+var ImportCSVColumns = []string{
+	"device_code", "device_description", "latitude", "longitude", "altitude", "location_description",
+	"device_properties", "device_state", "sensor_code", "sensor_brand", "sensor_description", "sensor_external_id",
+	"sensor_feature_of_interest_id", "sensor_archive_time", "sensor_is_fallback", "sensor_properties",
+}
+
+// ParseImportCSV reads devices from CSV with a header of ImportCSVColumns, columns may be in any order and
+// missing columns are left empty
+func ParseImportCSV(r io.Reader) ([]ImportDevice, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: missing header", ErrImportInvalid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrImportInvalid, err)
+	}
+	columns := map[string]int{}
+	for ix, name := range header {
+		name = strings.TrimSpace(name)
+		if !isImportCSVColumn(name) {
+			return nil, fmt.Errorf("%w: unknown column %s", ErrImportInvalid, name)
+		}
+		columns[name] = ix
+	}
+	if _, ok := columns["device_code"]; !ok {
+		return nil, fmt.Errorf("%w: missing column device_code", ErrImportInvalid)
+	}
+
+	imports := []ImportDevice{}
+	byCode := map[string]int{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return imports, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrImportInvalid, err)
+		}
+		line, _ := cr.FieldPos(0)
+		rec := importCSVRecord{columns: columns, record: record}
+
+		code := rec.get("device_code")
+		ix, ok := byCode[code]
+		if !ok {
+			dev, err := rec.device()
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %s", ErrImportInvalid, line, err)
+			}
+			dev.Row = line
+			imports = append(imports, dev)
+			ix = len(imports) - 1
+			byCode[code] = ix
+		}
+		if rec.get("sensor_code") == "" {
+			continue
+		}
+		sensor, err := rec.sensor()
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", ErrImportInvalid, line, err)
+		}
+		imports[ix].Sensors = append(imports[ix].Sensors, sensor)
+	}
+}
+
+func isImportCSVColumn(name string) bool {
+	for _, column := range ImportCSVColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+type importCSVRecord struct {
+	columns map[string]int
+	record  []string
+}
+
+func (rec importCSVRecord) get(column string) string {
+	ix, ok := rec.columns[column]
+	if !ok || ix >= len(rec.record) {
+		return ""
+	}
+	return strings.TrimSpace(rec.record[ix])
+}
+
+func (rec importCSVRecord) float(column string) (*float64, error) {
+	str := rec.get(column)
+	if str == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", column)
+	}
+	return &value, nil
+}
+
+func (rec importCSVRecord) json(column string) (json.RawMessage, error) {
+	str := rec.get(column)
+	if str == "" {
+		return nil, nil
+	}
+	if !json.Valid([]byte(str)) {
+		return nil, fmt.Errorf("%s must be JSON", column)
+	}
+	return json.RawMessage(str), nil
+}
+
+func (rec importCSVRecord) device() (ImportDevice, error) {
+	dev := ImportDevice{
+		NewDeviceOpts: NewDeviceOpts{
+			Code:                rec.get("device_code"),
+			Description:         rec.get("device_description"),
+			LocationDescription: rec.get("location_description"),
+		},
+		Sensors: []NewSensorDTO{},
+	}
+	var err error
+	if dev.Latitude, err = rec.float("latitude"); err != nil {
+		return dev, err
+	}
+	if dev.Longitude, err = rec.float("longitude"); err != nil {
+		return dev, err
+	}
+	if dev.Altitude, err = rec.float("altitude"); err != nil {
+		return dev, err
+	}
+	if dev.Properties, err = rec.json("device_properties"); err != nil {
+		return dev, err
+	}
+	if str := rec.get("device_state"); str != "" {
+		state, err := strconv.ParseUint(str, 10, 8)
+		if err != nil {
+			return dev, errors.New("device_state must be a state number")
+		}
+		dev.State = DeviceState(state)
+	}
+	return dev, nil
+}
+
+func (rec importCSVRecord) sensor() (NewSensorDTO, error) {
+	sensor := NewSensorDTO{
+		Code:        rec.get("sensor_code"),
+		Brand:       rec.get("sensor_brand"),
+		Description: rec.get("sensor_description"),
+		ExternalID:  rec.get("sensor_external_id"),
+	}
+	var err error
+	if sensor.Properties, err = rec.json("sensor_properties"); err != nil {
+		return sensor, err
+	}
+	if str := rec.get("sensor_feature_of_interest_id"); str != "" {
+		if sensor.FeatureOfInterestID, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return sensor, errors.New("sensor_feature_of_interest_id must be an integer")
+		}
+	}
+	if str := rec.get("sensor_archive_time"); str != "" {
+		archiveTime, err := strconv.Atoi(str)
+		if err != nil {
+			return sensor, errors.New("sensor_archive_time must be an integer")
+		}
+		sensor.ArchiveTime = &archiveTime
+	}
+	if str := rec.get("sensor_is_fallback"); str != "" {
+		if sensor.IsFallback, err = strconv.ParseBool(str); err != nil {
+			return sensor, errors.New("sensor_is_fallback must be true or false")
+		}
+	}
+	return sensor, nil
+}
+
+// WriteImportCSV writes the devices with a record per sensor in the format read by ParseImportCSV
+func WriteImportCSV(w io.Writer, devs []ImportDevice) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ImportCSVColumns); err != nil {
+		return err
+	}
+	for _, dev := range devs {
+		deviceRecord := []string{
+			dev.Code, dev.Description, formatCSVFloat(dev.Latitude), formatCSVFloat(dev.Longitude),
+			formatCSVFloat(dev.Altitude), dev.LocationDescription, string(dev.Properties),
+			strconv.Itoa(int(dev.State)),
+		}
+		if len(dev.Sensors) == 0 {
+			if err := cw.Write(append(deviceRecord, make([]string, len(ImportCSVColumns)-len(deviceRecord))...)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, sensor := range dev.Sensors {
+			record := append([]string{}, deviceRecord...)
+			featureOfInterestID, archiveTime := "", ""
+			if sensor.FeatureOfInterestID > 0 {
+				featureOfInterestID = strconv.FormatInt(sensor.FeatureOfInterestID, 10)
+			}
+			if sensor.ArchiveTime != nil {
+				archiveTime = strconv.Itoa(*sensor.ArchiveTime)
+			}
+			record = append(record,
+				sensor.Code, sensor.Brand, sensor.Description, sensor.ExternalID, featureOfInterestID, archiveTime,
+				strconv.FormatBool(sensor.IsFallback), string(sensor.Properties),
+			)
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCSVFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
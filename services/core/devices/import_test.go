@@ -0,0 +1,166 @@
+package devices_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+func newImportStore(existing ...devices.Device) *DeviceStoreMock {
+	return &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, p pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: existing}, nil
+		},
+		CreateDevicesFunc: func(ctx context.Context, devs []*devices.Device) error {
+			for _, dev := range devs {
+				dev.ID = int64(len(dev.Code))
+			}
+			return nil
+		},
+	}
+}
+
+func importDevices() []devices.ImportDevice {
+	return []devices.ImportDevice{
+		{
+			NewDeviceOpts: devices.NewDeviceOpts{Code: "node-1"},
+			Sensors:       []devices.NewSensorDTO{{Code: "temp", ExternalID: "1"}, {Code: "hum", ExternalID: "2"}},
+		},
+		{
+			NewDeviceOpts: devices.NewDeviceOpts{Code: "-invalid"},
+			Sensors:       []devices.NewSensorDTO{{Code: "temp", ExternalID: "1"}, {Code: "temp", ExternalID: "2"}},
+		},
+		{NewDeviceOpts: devices.NewDeviceOpts{Code: "existing"}},
+		{NewDeviceOpts: devices.NewDeviceOpts{Code: "node-1"}},
+	}
+}
+
+func TestImportDevicesShouldReportErrorsPerDevice(t *testing.T) {
+	store := newImportStore(devices.Device{ID: 5, Code: "existing"})
+	svc := devices.New(store, nil, nil, nil)
+
+	result, err := svc.ImportDevices(authtest.GodContext(), importDevices(), devices.ImportOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, store.CreateDevicesCalls())
+	assert.True(t, result.DryRun)
+	assert.Equal(t, devices.ImportTransactional, result.Mode)
+	assert.Equal(t, 4, result.Total)
+	assert.Equal(t, 3, result.Failed)
+	assert.Equal(t, 0, result.Created)
+
+	assert.Equal(t, 1, result.Rows[0].Row)
+	assert.Empty(t, result.Rows[0].Errors)
+	assert.Equal(t, []devices.ImportError{
+		{Message: devices.ErrDeviceInvalidCode.Message, Code: devices.ErrDeviceInvalidCode.Code},
+		{Sensor: "temp", Message: devices.ErrDuplicateSensorCode.Message, Code: devices.ErrDuplicateSensorCode.Code},
+	}, result.Rows[1].Errors)
+	require.Len(t, result.Rows[2].Errors, 1)
+	assert.Equal(t, devices.ErrDuplicateDeviceCode.Code, result.Rows[2].Errors[0].Code)
+	require.Len(t, result.Rows[3].Errors, 1, "codes must be unique within the import")
+	assert.Equal(t, devices.ErrDuplicateDeviceCode.Code, result.Rows[3].Errors[0].Code)
+
+	// A transactional import with invalid devices creates nothing
+	result, err = svc.ImportDevices(authtest.GodContext(), importDevices(), devices.ImportOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, store.CreateDevicesCalls())
+	assert.Equal(t, 0, result.Created)
+	assert.Zero(t, result.Rows[0].DeviceID)
+}
+
+func TestImportDevicesShouldApplyTransactionalOrBestEffort(t *testing.T) {
+	store := newImportStore()
+	svc := devices.New(store, nil, nil, nil)
+	imports := importDevices()[:1]
+	imports = append(imports, devices.ImportDevice{NewDeviceOpts: devices.NewDeviceOpts{Code: "node-22"}})
+
+	result, err := svc.ImportDevices(authtest.GodContext(), imports, devices.ImportOptions{Mode: devices.ImportTransactional})
+	require.NoError(t, err)
+	require.Len(t, store.CreateDevicesCalls(), 1, "a transactional import stores all devices at once")
+	created := store.CreateDevicesCalls()[0].Devs
+	require.Len(t, created, 2)
+	assert.Equal(t, authtest.DefaultTenantID, created[0].TenantID)
+	assert.Len(t, created[0].Sensors, 2)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, int64(6), result.Rows[0].DeviceID)
+	assert.Equal(t, int64(7), result.Rows[1].DeviceID)
+
+	// Best effort stores every valid device on its own and reports the failures
+	store = newImportStore(devices.Device{ID: 5, Code: "existing"})
+	store.CreateDevicesFunc = func(ctx context.Context, devs []*devices.Device) error {
+		if devs[0].Code == "node-22" {
+			return errors.New("connection lost")
+		}
+		devs[0].ID = 1
+		return nil
+	}
+	svc = devices.New(store, nil, nil, nil)
+	imports = append(importDevices(), imports[1])
+
+	result, err = svc.ImportDevices(authtest.GodContext(), imports, devices.ImportOptions{Mode: devices.ImportBestEffort})
+	require.NoError(t, err)
+	assert.Len(t, store.CreateDevicesCalls(), 2)
+	assert.Equal(t, 5, result.Total)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 4, result.Failed)
+	assert.Equal(t, int64(1), result.Rows[0].DeviceID)
+	assert.Equal(t, []devices.ImportError{{Message: "connection lost"}}, result.Rows[4].Errors)
+
+	_, err = svc.ImportDevices(authtest.GodContext(), nil, devices.ImportOptions{})
+	assert.ErrorIs(t, err, devices.ErrImportSizeInvalid)
+	_, err = svc.ImportDevices(authtest.GodContext(), imports, devices.ImportOptions{Mode: "all"})
+	assert.ErrorIs(t, err, devices.ErrImportModeInvalid)
+}
+
+func TestImportCSVShouldRoundTrip(t *testing.T) {
+	exports := []devices.ImportDevice{
+		devices.NewImportDevice(devices.Device{
+			Code:        "node-1",
+			Description: "a, \"quoted\" description",
+			Properties:  json.RawMessage(`{"eui":"0011"}`),
+			Latitude:    ptr(51.5),
+			Longitude:   ptr(3.6),
+			Altitude:    ptr(0.0),
+			State:       devices.DeviceEnabled,
+			Sensors: []devices.Sensor{
+				{Code: "temp", ExternalID: "1", ArchiveTime: ptr(30), Properties: json.RawMessage(`{}`), IsFallback: true},
+				{Code: "hum", ExternalID: "2", Brand: "acme", Properties: json.RawMessage(`{}`)},
+			},
+		}),
+		devices.NewImportDevice(devices.Device{Code: "node-2", Properties: json.RawMessage(`{}`)}),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, devices.WriteImportCSV(&buf, exports))
+	assert.Equal(t, 4, strings.Count(buf.String(), "\n"), "header, a record per sensor and the device without sensors")
+
+	imports, err := devices.ParseImportCSV(&buf)
+	require.NoError(t, err)
+	require.Len(t, imports, 2)
+	assert.Equal(t, 2, imports[0].Row)
+	assert.Equal(t, 4, imports[1].Row)
+	imports[0].Row, imports[1].Row = 0, 0
+	assert.Equal(t, exports, imports)
+
+	// Columns may be omitted or reordered, invalid values are reported with their line
+	imports, err = devices.ParseImportCSV(strings.NewReader("sensor_code,device_code\ntemp,node-1\nhum,node-1\n"))
+	require.NoError(t, err)
+	require.Len(t, imports, 1)
+	assert.Equal(t, "node-1", imports[0].Code)
+	assert.Len(t, imports[0].Sensors, 2)
+
+	_, err = devices.ParseImportCSV(strings.NewReader("device_code,latitude\nnode-1,north\n"))
+	assert.ErrorIs(t, err, devices.ErrImportInvalid)
+	assert.ErrorContains(t, err, "line 2")
+	_, err = devices.ParseImportCSV(strings.NewReader("device_code,colour\nnode-1,red\n"))
+	assert.ErrorIs(t, err, devices.ErrImportInvalid)
+}
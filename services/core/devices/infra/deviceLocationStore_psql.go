@@ -0,0 +1,143 @@
+package deviceinfra
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// insertLocationQuery inserts a location unless the preceding location of the device is at the same position. A
+// device reporting twice at the same time keeps the last reported position.
+const insertLocationQuery = `
+	INSERT INTO device_locations (device_id, tenant_id, timestamp, latitude, longitude, altitude, source)
+	SELECT $1::BIGINT, $2::BIGINT, $3::TIMESTAMPTZ, $4::FLOAT8, $5::FLOAT8, $6::FLOAT8, $7::TEXT
+	WHERE NOT EXISTS (
+		SELECT 1 FROM (
+			SELECT latitude, longitude, altitude FROM device_locations
+			WHERE device_id = $1 AND timestamp <= $3
+			ORDER BY timestamp DESC LIMIT 1
+		) preceding
+		WHERE preceding.latitude = $4 AND preceding.longitude = $5 AND preceding.altitude IS NOT DISTINCT FROM $6
+	)
+	ON CONFLICT (device_id, timestamp) DO UPDATE SET
+		latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, altitude = EXCLUDED.altitude,
+		source = EXCLUDED.source
+`
+
+func (s *PSQLStore) AddLocations(ctx context.Context, locations []devices.DeviceLocation) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, location := range chronological(locations) {
+		if _, err := tx.ExecContext(ctx, insertLocationQuery,
+			location.DeviceID, location.TenantID, location.Timestamp, location.Latitude, location.Longitude,
+			location.Altitude, location.Source,
+		); err != nil {
+			if rb := tx.Rollback(); rb != nil {
+				err = fmt.Errorf("rollback failed with %w while handling error: %w", rb, err)
+			}
+			return fmt.Errorf("inserting device location: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordMeasurementLocations adds the locations reported by the stored measurements to the history of their devices.
+// It is a measurementsinfra.CommitHook, such that the locations are recorded if and only if the measurements are
+// stored.
+func (s *PSQLStore) RecordMeasurementLocations(ctx context.Context, tx pgx.Tx, stored []measurements.Measurement) error {
+	for _, location := range chronological(measurements.ReportedLocations(stored)) {
+		if _, err := tx.Exec(ctx, insertLocationQuery,
+			location.DeviceID, location.TenantID, location.Timestamp, location.Latitude, location.Longitude,
+			location.Altitude, location.Source,
+		); err != nil {
+			return fmt.Errorf("inserting device location: %w", err)
+		}
+	}
+	return nil
+}
+
+// chronological returns the locations sorted by timestamp. Inserting in chronological order compares every location
+// with the one reported before it.
+func chronological(locations []devices.DeviceLocation) []devices.DeviceLocation {
+	locations = slices.Clone(locations)
+	slices.SortStableFunc(locations, func(a, b devices.DeviceLocation) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return locations
+}
+
+func deviceLocationQuery(ctx context.Context, deviceID int64) sq.SelectBuilder {
+	q := pq.Select(
+		"device_id", "tenant_id", "timestamp", "latitude", "longitude", "altitude", "source",
+	).From("device_locations").Where(sq.Eq{"device_id": deviceID})
+	return auth.ProtectedQuery(ctx, "tenant_id", q)
+}
+
+func scanDeviceLocation(row sq.RowScanner) (devices.DeviceLocation, error) {
+	var location devices.DeviceLocation
+	err := row.Scan(
+		&location.DeviceID, &location.TenantID, &location.Timestamp, &location.Latitude, &location.Longitude,
+		&location.Altitude, &location.Source,
+	)
+	return location, err
+}
+
+func (s *PSQLStore) ListLocations(
+	ctx context.Context,
+	deviceID int64,
+	filter devices.DeviceLocationFilter,
+) ([]devices.DeviceLocation, error) {
+	q := deviceLocationQuery(ctx, deviceID).OrderBy("timestamp ASC")
+	if !filter.Start.IsZero() {
+		q = q.Where(sq.GtOrEq{"timestamp": filter.Start})
+	}
+	if !filter.End.IsZero() {
+		q = q.Where(sq.Lt{"timestamp": filter.End})
+	}
+	if filter.Limit > 0 {
+		q = q.Limit(uint64(filter.Limit))
+	}
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing device locations: %w", err)
+	}
+	defer rows.Close()
+
+	locations := []devices.DeviceLocation{}
+	for rows.Next() {
+		location, err := scanDeviceLocation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning device location: %w", err)
+		}
+		locations = append(locations, location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (s *PSQLStore) GetLocationAt(ctx context.Context, deviceID int64, at time.Time) (*devices.DeviceLocation, error) {
+	q := deviceLocationQuery(ctx, deviceID).Where(sq.LtOrEq{"timestamp": at}).OrderBy("timestamp DESC").Limit(1)
+	location, err := scanDeviceLocation(q.RunWith(s.db).QueryRowContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, devices.ErrDeviceLocationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("in GetLocationAt: %w", err)
+	}
+	return &location, nil
+}
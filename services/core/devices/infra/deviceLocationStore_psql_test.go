@@ -0,0 +1,58 @@
+package deviceinfra_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	deviceinfra "sensorbucket.nl/sensorbucket/services/core/devices/infra"
+)
+
+func TestDeviceLocationStoreShouldKeepLocationHistory(t *testing.T) {
+	ctx := authtest.GodContext()
+	db := createPostgresServer(t)
+	store := deviceinfra.NewPSQLStore(db)
+
+	dev, err := devices.NewDevice(authtest.DefaultTenantID, devices.NewDeviceOpts{Code: "buoy"})
+	require.NoError(t, err)
+	require.NoError(t, store.CreateDevices(ctx, []*devices.Device{dev}))
+
+	start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	location := func(minute int, lat, lng float64) devices.DeviceLocation {
+		return devices.DeviceLocation{
+			DeviceID: dev.ID, TenantID: dev.TenantID, Timestamp: start.Add(time.Duration(minute) * time.Minute),
+			Latitude: lat, Longitude: lng, Source: devices.LocationSourcePipeline,
+		}
+	}
+	require.NoError(t, store.AddLocations(ctx, []devices.DeviceLocation{
+		location(20, 51.6, 3.7),
+		location(0, 51.5, 3.6),
+		location(10, 51.5, 3.6),
+		location(30, 51.7, 3.8),
+	}))
+
+	track, err := store.ListLocations(ctx, dev.ID, devices.DeviceLocationFilter{})
+	require.NoError(t, err)
+	require.Len(t, track, 3, "a location equal to the preceding location is skipped")
+	assert.Equal(t, 51.5, track[0].Latitude)
+	assert.Equal(t, 51.6, track[1].Latitude)
+	assert.Equal(t, 51.7, track[2].Latitude)
+
+	track, err = store.ListLocations(ctx, dev.ID, devices.DeviceLocationFilter{
+		Start: start.Add(5 * time.Minute), End: start.Add(30 * time.Minute), Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, track, 1)
+	assert.Equal(t, 51.6, track[0].Latitude)
+
+	at, err := store.GetLocationAt(ctx, dev.ID, start.Add(25*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 51.6, at.Latitude)
+	assert.Equal(t, devices.LocationSourcePipeline, at.Source)
+	_, err = store.GetLocationAt(ctx, dev.ID, start.Add(-time.Minute))
+	assert.ErrorIs(t, err, devices.ErrDeviceLocationNotFound)
+}
@@ -0,0 +1,138 @@
+package deviceinfra
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+var _ devices.DeviceTemplateStore = (*PSQLDeviceTemplateStore)(nil)
+
+// PSQLDeviceTemplateStore stores the sensors of a template as a JSON array, they only become sensors once a
+// device is created from the template
+type PSQLDeviceTemplateStore struct {
+	db *sqlx.DB
+}
+
+func NewPSQLDeviceTemplateStore(db *sqlx.DB) *PSQLDeviceTemplateStore {
+	return &PSQLDeviceTemplateStore{db}
+}
+
+type DeviceTemplatePaginationQuery struct {
+	CreatedAt time.Time `pagination:"template.created_at,ASC"`
+	ID        int64     `pagination:"template.id,ASC"`
+}
+
+func deviceTemplateQuery() sq.SelectBuilder {
+	return pq.Select(
+		"template.id", "template.tenant_id", "template.name", "template.description", "template.properties",
+		"template.sensors", "template.created_at",
+	).From("device_templates template")
+}
+
+func scanDeviceTemplate(row sq.RowScanner, extra ...any) (devices.DeviceTemplate, error) {
+	var template devices.DeviceTemplate
+	var sensors []byte
+	err := row.Scan(append([]any{
+		&template.ID, &template.TenantID, &template.Name, &template.Description, &template.Properties,
+		&sensors, &template.CreatedAt,
+	}, extra...)...)
+	if err != nil {
+		return template, err
+	}
+	if err := json.Unmarshal(sensors, &template.Sensors); err != nil {
+		return template, fmt.Errorf("decoding device template sensors: %w", err)
+	}
+	return template, nil
+}
+
+func (s *PSQLDeviceTemplateStore) Save(ctx context.Context, template *devices.DeviceTemplate) error {
+	sensors, err := json.Marshal(template.Sensors)
+	if err != nil {
+		return err
+	}
+	if template.ID == 0 {
+		return s.db.GetContext(ctx, &template.ID, `
+			INSERT INTO device_templates (tenant_id, name, description, properties, sensors, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+		`, template.TenantID, template.Name, template.Description, template.Properties, sensors, template.CreatedAt)
+	}
+
+	q := pq.Update("device_templates").SetMap(map[string]any{
+		"name":        template.Name,
+		"description": template.Description,
+		"properties":  template.Properties,
+		"sensors":     sensors,
+	}).Where(sq.Eq{"id": template.ID})
+	q = auth.ProtectedQuery(ctx, "tenant_id", q)
+	if _, err := q.RunWith(s.db).ExecContext(ctx); err != nil {
+		return fmt.Errorf("updating device template: %w", err)
+	}
+	return nil
+}
+
+func (s *PSQLDeviceTemplateStore) Delete(ctx context.Context, id int64) error {
+	q := pq.Delete("device_templates").Where(sq.Eq{"id": id})
+	q = auth.ProtectedQuery(ctx, "tenant_id", q)
+	if _, err := q.RunWith(s.db).ExecContext(ctx); err != nil {
+		return fmt.Errorf("deleting device template: %w", err)
+	}
+	return nil
+}
+
+func (s *PSQLDeviceTemplateStore) List(
+	ctx context.Context,
+	p pagination.Request,
+) (*pagination.Page[devices.DeviceTemplate], error) {
+	cursor, err := pagination.GetCursor[DeviceTemplatePaginationQuery](p)
+	if err != nil {
+		return nil, fmt.Errorf("list device templates, error getting pagination cursor: %w", err)
+	}
+	q, err := pagination.Apply(deviceTemplateQuery(), cursor)
+	if err != nil {
+		return nil, err
+	}
+	q = auth.ProtectedQuery(ctx, "template.tenant_id", q)
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []devices.DeviceTemplate{}
+	for rows.Next() {
+		template, err := scanDeviceTemplate(rows, &cursor.Columns.CreatedAt, &cursor.Columns.ID)
+		if err != nil {
+			return nil, fmt.Errorf("scanning device template: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page := pagination.CreatePageT(templates, cursor)
+	return &page, nil
+}
+
+func (s *PSQLDeviceTemplateStore) Get(ctx context.Context, id int64) (*devices.DeviceTemplate, error) {
+	q := auth.ProtectedQuery(ctx, "template.tenant_id", deviceTemplateQuery().Where(sq.Eq{"template.id": id}))
+	template, err := scanDeviceTemplate(q.RunWith(s.db).QueryRowContext(ctx))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, devices.ErrDeviceTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("in Get device template: %w", err)
+	}
+	return &template, nil
+}
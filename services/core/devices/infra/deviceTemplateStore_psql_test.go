@@ -0,0 +1,59 @@
+package deviceinfra_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	deviceinfra "sensorbucket.nl/sensorbucket/services/core/devices/infra"
+)
+
+func TestDeviceTemplateStoreShouldSaveTemplatesAndLinkDevices(t *testing.T) {
+	ctx := authtest.GodContext()
+	db := createPostgresServer(t)
+	store := deviceinfra.NewPSQLDeviceTemplateStore(db)
+	deviceStore := deviceinfra.NewPSQLStore(db)
+
+	template, err := devices.NewDeviceTemplate(authtest.DefaultTenantID, devices.NewDeviceTemplateOpts{
+		Name:       "LoRa node",
+		Properties: json.RawMessage(`{"network":"ttn"}`),
+		Sensors:    []devices.TemplateSensor{{Code: "temp", ExternalID: "1", ArchiveTime: ptr(30)}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, template))
+	assert.NotZero(t, template.ID)
+
+	require.NoError(t, template.SetName("LoRa node v2"))
+	require.NoError(t, store.Save(ctx, template))
+	dbTemplate, err := store.Get(ctx, template.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "LoRa node v2", dbTemplate.Name)
+	assert.JSONEq(t, `{"network":"ttn"}`, string(dbTemplate.Properties))
+	assert.Equal(t, template.Sensors, dbTemplate.Sensors)
+
+	page, err := store.List(ctx, pagination.Request{})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 1)
+
+	// Devices created from the template can be listed by template and are unlinked once it is deleted
+	dev, err := template.NewDevice(devices.NewDeviceOpts{Code: "node-1"})
+	require.NoError(t, err)
+	require.NoError(t, deviceStore.CreateDevices(ctx, []*devices.Device{dev}))
+	devs, err := deviceStore.List(ctx, devices.DeviceFilter{Template: []int64{template.ID}}, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, devs.Data, 1)
+	assert.Equal(t, template.ID, *devs.Data[0].TemplateID)
+
+	require.NoError(t, store.Delete(ctx, template.ID))
+	_, err = store.Get(ctx, template.ID)
+	assert.ErrorIs(t, err, devices.ErrDeviceTemplateNotFound)
+	dbDev, err := deviceStore.Find(ctx, dev.ID)
+	require.NoError(t, err)
+	assert.Nil(t, dbDev.TemplateID)
+	assert.Len(t, dbDev.Sensors, 1)
+}
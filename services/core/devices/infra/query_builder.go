@@ -39,6 +39,7 @@ func newDeviceQueryBuilder() deviceQueryBuilder {
 		"device.altitude",
 		"device.state",
 		"device.created_at",
+		"device.template_id",
 	).From("devices device")
 
 	return deviceQueryBuilder{query: q}
@@ -112,6 +113,9 @@ func (b deviceQueryBuilder) Query(
 	if len(b.filters.Code) > 0 {
 		q = q.Where(sq.Eq{"device.code": b.filters.Code})
 	}
+	if len(b.filters.Template) > 0 {
+		q = q.Where(sq.Eq{"device.template_id": b.filters.Template})
+	}
 
 	// Authorize
 	q = auth.ProtectedQuery(ctx, "device.tenant_id", q)
@@ -138,6 +142,7 @@ func (b deviceQueryBuilder) Query(
 				&model.Altitude,
 				&model.State,
 				&model.CreatedAt,
+				&model.TemplateID,
 				&b.cursor.Columns.CreatedAt,
 				&b.cursor.Columns.ID,
 			)
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 
 	"sensorbucket.nl/sensorbucket/internal/pagination"
@@ -169,19 +170,59 @@ func (s *PSQLStore) GetSensor(ctx context.Context, id int64) (*devices.Sensor, e
 }
 
 func (s *PSQLStore) createDevice(_ context.Context, dev *devices.Device) error {
-	if err := s.db.Get(&dev.ID,
+	return insertDevice(s.db, dev)
+}
+
+func insertDevice(db DB, dev *devices.Device) error {
+	if err := db.Get(&dev.ID,
 		`
 			INSERT INTO "devices" (
 				"code", "description", "tenant_id", "properties", "location",
-				"altitude", "location_description", "state", "created_at"
+				"altitude", "location_description", "state", "created_at", "template_id"
 			)
-			VALUES ($1, $2, $3, $4, ST_POINT($5, $6), $7, $8, $9, $10)
+			VALUES ($1, $2, $3, $4, ST_POINT($5, $6), $7, $8, $9, $10, $11)
 			RETURNING id
 		`,
 		dev.Code, dev.Description, dev.TenantID, dev.Properties,
 		dev.Longitude, dev.Latitude, dev.Altitude, dev.LocationDescription,
-		dev.State, dev.CreatedAt,
+		dev.State, dev.CreatedAt, dev.TemplateID,
 	); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "devices_tenant_code_idx" {
+			return devices.ErrDuplicateDeviceCode
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *PSQLStore) CreateDevices(_ context.Context, devs []*devices.Device) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, dev := range devs {
+		if err := insertDevice(tx, dev); err != nil {
+			if rb := tx.Rollback(); rb != nil {
+				err = fmt.Errorf("rollback failed with %w while handling error: %w", rb, err)
+			}
+			return err
+		}
+		sensors := make([]*devices.Sensor, len(dev.Sensors))
+		for ix := range dev.Sensors {
+			dev.Sensors[ix].DeviceID = dev.ID
+			sensors[ix] = &dev.Sensors[ix]
+		}
+		if err := createSensors(tx, sensors); err != nil {
+			if rb := tx.Rollback(); rb != nil {
+				err = fmt.Errorf("rollback failed with %w while handling error: %w", rb, err)
+			}
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 	return nil
@@ -294,12 +335,12 @@ func find(ctx context.Context, db DB, id int64) (*devices.Device, error) {
 	err := auth.ProtectedQuery(ctx, "tenant_id", pq.Select(
 		"id", "code", "description", "tenant_id", "properties", "location_description",
 		`ST_X("location"::geometry) AS longitude`, `ST_Y("location"::geometry) AS latitude`,
-		"altitude", "state",
+		"altitude", "state", "template_id",
 	).From("devices").Where(sq.Eq{"id": id})).RunWith(db).Scan(
 		&dev.ID, &dev.Code,
 		&dev.Description, &dev.TenantID, &dev.Properties, &dev.LocationDescription,
 		&dev.Longitude, &dev.Latitude,
-		&dev.Altitude, &dev.State,
+		&dev.Altitude, &dev.State, &dev.TemplateID,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
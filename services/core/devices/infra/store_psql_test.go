@@ -28,6 +28,13 @@ func ptr[T any](v T) *T {
 }
 
 func createPostgresServer(t *testing.T) *sqlx.DB {
+	db := startPostgresServer(t)
+	require.NoError(t, migrations.MigratePostgres(db.DB))
+	return db
+}
+
+// startPostgresServer starts a database without migrating it
+func startPostgresServer(t *testing.T) *sqlx.DB {
 	ctx := context.Background()
 	req := testcontainers.ContainerRequest{
 		Image: "docker.io/timescale/timescaledb-ha:pg15-oss",
@@ -62,12 +69,40 @@ func createPostgresServer(t *testing.T) *sqlx.DB {
 		host, containerPort.Port(),
 	))
 	db.MustExec("CREATE EXTENSION postgis;")
-	err = migrations.MigratePostgres(db.DB)
-	require.NoError(t, err)
 
 	return db
 }
 
+func TestUniqueDeviceCodeMigrationShouldRenameDuplicateCodes(t *testing.T) {
+	db := startPostgresServer(t)
+	require.NoError(t, migrations.MigratePostgresTo(db.DB, 20250415090000))
+
+	var ids []int64
+	for _, device := range []struct {
+		tenantID int64
+		code     string
+	}{{1, "node"}, {1, "node"}, {1, "node"}, {2, "node"}, {1, "other"}} {
+		var id int64
+		require.NoError(t, db.QueryRow(
+			"INSERT INTO devices (code, tenant_id) VALUES ($1, $2) RETURNING id", device.code, device.tenantID,
+		).Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, migrations.MigratePostgres(db.DB))
+
+	codes := []string{}
+	for _, id := range ids {
+		var code string
+		require.NoError(t, db.QueryRow("SELECT code FROM devices WHERE id = $1", id).Scan(&code))
+		codes = append(codes, code)
+	}
+	assert.Equal(t, []string{
+		"node", fmt.Sprintf("node-%d", ids[1]), fmt.Sprintf("node-%d", ids[2]), "node", "other",
+	}, codes, "the first device of a code in a tenant keeps its code")
+	_, err := db.Exec("INSERT INTO devices (code, tenant_id) VALUES ('node', 1)")
+	assert.Error(t, err)
+}
+
 func TestShouldCreateAndFetchDevice(t *testing.T) {
 	ctx := authtest.GodContext()
 
@@ -315,3 +350,46 @@ func TestDeviceStoreShouldFilterOnSensorIDs(t *testing.T) {
 	responseDeviceIDS := lo.Map(page.Data, func(d devices.Device, ix int) int64 { return d.ID })
 	assert.ElementsMatch(t, []int64{devs[0].ID, devs[1].ID}, responseDeviceIDS)
 }
+
+func TestShouldCreateDevicesWithSensorsInTransaction(t *testing.T) {
+	ctx := authtest.GodContext()
+	db := createPostgresServer(t)
+	store := deviceinfra.NewPSQLStore(db)
+	newDevice := func(code string, sensors ...string) *devices.Device {
+		dev, err := devices.NewDevice(authtest.DefaultTenantID, devices.NewDeviceOpts{Code: code})
+		require.NoError(t, err)
+		for ix, sensor := range sensors {
+			_, err := dev.AddSensor(devices.NewSensorOpts{Code: sensor, ExternalID: fmt.Sprint(ix)})
+			require.NoError(t, err)
+		}
+		return dev
+	}
+
+	devs := []*devices.Device{newDevice("node-1", "temp", "hum"), newDevice("node-2")}
+	require.NoError(t, store.CreateDevices(ctx, devs))
+	for _, dev := range devs {
+		dbDev, err := store.Find(ctx, dev.ID)
+		require.NoError(t, err)
+		assert.Equal(t, dev.Code, dbDev.Code)
+		assert.ElementsMatch(t,
+			lo.Map(dev.Sensors, func(s devices.Sensor, _ int) int64 { return s.ID }),
+			lo.Map(dbDev.Sensors, func(s devices.Sensor, _ int) int64 { return s.ID }),
+		)
+	}
+
+	// A failing device rolls back the devices created before it
+	invalid := newDevice("node-4")
+	invalid.Properties = json.RawMessage("not json")
+	err := store.CreateDevices(ctx, []*devices.Device{newDevice("node-3", "temp"), invalid})
+	require.Error(t, err)
+	page, err := store.List(ctx, devices.DeviceFilter{Code: []string{"node-3"}}, pagination.Request{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Data)
+
+	// Codes are unique within a tenant
+	err = store.CreateDevices(ctx, []*devices.Device{newDevice("node-1")})
+	assert.ErrorIs(t, err, devices.ErrDuplicateDeviceCode)
+	other, err := devices.NewDevice(authtest.DefaultTenantID+1, devices.NewDeviceOpts{Code: "node-1"})
+	require.NoError(t, err)
+	assert.NoError(t, store.CreateDevices(ctx, []*devices.Device{other}))
+}
@@ -0,0 +1,203 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+// MaxDeviceLocations is the maximum amount of locations returned for the track of a device
+const MaxDeviceLocations = 10000
+
+var (
+	ErrDeviceLocationNotFound = web.NewError(http.StatusNotFound, "device has no known location at that time", "DEVICE_LOCATION_NOT_FOUND")
+	ErrLocationFilterInvalid  = web.NewError(http.StatusBadRequest, "location filter invalid", "DEVICE_LOCATION_FILTER_INVALID")
+)
+
+// LocationSource is where a location of a device was reported
+type LocationSource string
+
+const (
+	LocationSourceAPI      LocationSource = "api"
+	LocationSourcePipeline LocationSource = "pipeline"
+)
+
+// DeviceLocation is the location of a device from its timestamp until the timestamp of the next location
+type DeviceLocation struct {
+	DeviceID  int64          `json:"device_id"`
+	TenantID  int64          `json:"tenant_id"`
+	Timestamp time.Time      `json:"timestamp"`
+	Latitude  float64        `json:"latitude"`
+	Longitude float64        `json:"longitude"`
+	Altitude  *float64       `json:"altitude"`
+	Source    LocationSource `json:"source"`
+}
+
+func (l DeviceLocation) Validate() error {
+	if l.Latitude < -90 || l.Latitude > 90 || l.Longitude < -180 || l.Longitude > 180 {
+		return ErrInvalidCoordinates
+	}
+	return nil
+}
+
+// LocationAt returns the current location of the device as reported at the given time, false if the device has no
+// location
+func (d *Device) LocationAt(at time.Time, source LocationSource) (DeviceLocation, bool) {
+	if d.Latitude == nil || d.Longitude == nil {
+		return DeviceLocation{}, false
+	}
+	return DeviceLocation{
+		DeviceID:  d.ID,
+		TenantID:  d.TenantID,
+		Timestamp: at,
+		Latitude:  *d.Latitude,
+		Longitude: *d.Longitude,
+		Altitude:  d.Altitude,
+		Source:    source,
+	}, true
+}
+
+// DeviceLocationFilter selects the locations of a device in a time range, a zero start or end leaves the range open
+type DeviceLocationFilter struct {
+	Start time.Time `url:"start"`
+	End   time.Time `url:"end"`
+	Limit int       `url:"limit"`
+}
+
+func (f *DeviceLocationFilter) validate() error {
+	if !f.Start.IsZero() && !f.End.IsZero() && !f.Start.Before(f.End) {
+		return fmt.Errorf("%w: start must be before end", ErrLocationFilterInvalid)
+	}
+	if f.Limit < 0 || f.Limit > MaxDeviceLocations {
+		return fmt.Errorf("%w: limit must be between 0 and %d", ErrLocationFilterInvalid, MaxDeviceLocations)
+	}
+	if f.Limit == 0 {
+		f.Limit = MaxDeviceLocations
+	}
+	return nil
+}
+
+// DeviceLocationTrack is the track of a device in chronological order. If the track has more locations than the
+// limit, Next is the timestamp of the first location that was left out, such that the rest of the track is listed
+// with Next as start.
+type DeviceLocationTrack struct {
+	Locations []DeviceLocation
+	Next      *time.Time
+}
+
+// ListDeviceLocations returns the track of the device in chronological order
+func (s *Service) ListDeviceLocations(
+	ctx context.Context,
+	dev *Device,
+	filter DeviceLocationFilter,
+) (*DeviceLocationTrack, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
+		return nil, err
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	// The location after the limit tells whether the track continues
+	filter.Limit++
+	locations, err := s.store.ListLocations(ctx, dev.ID, filter)
+	if err != nil {
+		return nil, err
+	}
+	track := &DeviceLocationTrack{Locations: locations}
+	if len(locations) > limit {
+		track.Locations = locations[:limit]
+		track.Next = &locations[limit].Timestamp
+	}
+	return track, nil
+}
+
+// GetDeviceLocationAt returns the latest location of the device at or before the given time
+func (s *Service) GetDeviceLocationAt(ctx context.Context, dev *Device, at time.Time) (*DeviceLocation, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_DEVICES}); err != nil {
+		return nil, err
+	}
+	return s.store.GetLocationAt(ctx, dev.ID, at)
+}
+
+// recordLocations adds the locations to the history of their devices
+func (s *Service) recordLocations(ctx context.Context, locations []DeviceLocation) error {
+	if len(locations) == 0 {
+		return nil
+	}
+	if err := s.store.AddLocations(ctx, locations); err != nil {
+		return fmt.Errorf("recording device locations: %w", err)
+	}
+	return nil
+}
+
+// createdLocations returns the locations of the devices at the time they were created
+func createdLocations(devs []*Device) []DeviceLocation {
+	locations := []DeviceLocation{}
+	for _, dev := range devs {
+		if dev == nil {
+			continue
+		}
+		if location, ok := dev.LocationAt(dev.CreatedAt, LocationSourceAPI); ok {
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+// LocationTrack is the track of a device as a GeoJSON LineString feature, with the timestamp and altitude of every
+// position in its properties. A track of less than two locations has no geometry.
+func LocationTrack(dev *Device, locations []DeviceLocation) *geojson.Feature {
+	coords := make([]geom.Coord, len(locations))
+	timestamps := make([]time.Time, len(locations))
+	altitudes := make([]*float64, len(locations))
+	for ix, location := range locations {
+		coords[ix] = geom.Coord{location.Longitude, location.Latitude}
+		timestamps[ix] = location.Timestamp
+		altitudes[ix] = location.Altitude
+	}
+	feature := &geojson.Feature{
+		ID: strconv.FormatInt(dev.ID, 10),
+		Properties: map[string]any{
+			"device_id":   dev.ID,
+			"device_code": dev.Code,
+			"timestamps":  timestamps,
+			"altitudes":   altitudes,
+		},
+	}
+	if len(coords) > 1 {
+		feature.Geometry = geom.NewLineString(geom.XY).MustSetCoords(coords)
+	}
+	return feature
+}
+
+// LocationPoints are the locations of a device as a collection of GeoJSON Point features
+func LocationPoints(locations []DeviceLocation) *geojson.FeatureCollection {
+	features := make([]*geojson.Feature, len(locations))
+	for ix, location := range locations {
+		point := geom.NewPoint(geom.XY).MustSetCoords(geom.Coord{location.Longitude, location.Latitude})
+		if location.Altitude != nil {
+			point = geom.NewPoint(geom.XYZ).MustSetCoords(
+				geom.Coord{location.Longitude, location.Latitude, *location.Altitude},
+			)
+		}
+		features[ix] = &geojson.Feature{
+			Geometry: point,
+			Properties: map[string]any{
+				"device_id": location.DeviceID,
+				"timestamp": location.Timestamp,
+				"altitude":  location.Altitude,
+				"source":    location.Source,
+			},
+		}
+	}
+	return &geojson.FeatureCollection{Features: features}
+}
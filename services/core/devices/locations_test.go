@@ -0,0 +1,108 @@
+package devices_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+func TestServiceShouldValidateDeviceLocationFilter(t *testing.T) {
+	store := &DeviceStoreMock{
+		ListLocationsFunc: func(ctx context.Context, deviceID int64, filter devices.DeviceLocationFilter) ([]devices.DeviceLocation, error) {
+			return []devices.DeviceLocation{}, nil
+		},
+	}
+	svc := devices.New(store, nil, nil, nil)
+	dev := &devices.Device{ID: 4, TenantID: authtest.DefaultTenantID}
+	now := time.Now()
+
+	_, err := svc.ListDeviceLocations(authtest.GodContext(), dev, devices.DeviceLocationFilter{Start: now, End: now})
+	assert.ErrorIs(t, err, devices.ErrLocationFilterInvalid)
+	_, err = svc.ListDeviceLocations(authtest.GodContext(), dev, devices.DeviceLocationFilter{Limit: devices.MaxDeviceLocations + 1})
+	assert.ErrorIs(t, err, devices.ErrLocationFilterInvalid)
+
+	_, err = svc.ListDeviceLocations(authtest.GodContext(), dev, devices.DeviceLocationFilter{Start: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, store.ListLocationsCalls(), 1)
+	assert.Equal(t, int64(4), store.ListLocationsCalls()[0].DeviceID)
+	assert.Equal(t, devices.MaxDeviceLocations+1, store.ListLocationsCalls()[0].Filter.Limit,
+		"the limit defaults to the maximum, one more location tells whether the track continues")
+}
+
+func TestServiceShouldReportTheContinuationOfATruncatedTrack(t *testing.T) {
+	start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	var stored []devices.DeviceLocation
+	for minute := 0; minute < 3; minute++ {
+		stored = append(stored, devices.DeviceLocation{DeviceID: 4, Timestamp: start.Add(time.Duration(minute) * time.Minute)})
+	}
+	store := &DeviceStoreMock{
+		ListLocationsFunc: func(ctx context.Context, deviceID int64, filter devices.DeviceLocationFilter) ([]devices.DeviceLocation, error) {
+			return stored[:min(filter.Limit, len(stored))], nil
+		},
+	}
+	svc := devices.New(store, nil, nil, nil)
+	dev := &devices.Device{ID: 4, TenantID: authtest.DefaultTenantID}
+
+	track, err := svc.ListDeviceLocations(authtest.GodContext(), dev, devices.DeviceLocationFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, track.Locations, 2)
+	require.NotNil(t, track.Next)
+	assert.Equal(t, start.Add(2*time.Minute), *track.Next)
+
+	track, err = svc.ListDeviceLocations(authtest.GodContext(), dev, devices.DeviceLocationFilter{Limit: 3})
+	require.NoError(t, err)
+	assert.Len(t, track.Locations, 3)
+	assert.Nil(t, track.Next, "a complete track does not continue")
+}
+
+func TestDeviceLocationsShouldConvertToGeoJSON(t *testing.T) {
+	dev := &devices.Device{ID: 4, Code: "buoy"}
+	start := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	locations := []devices.DeviceLocation{
+		{DeviceID: 4, Timestamp: start, Latitude: 51.5, Longitude: 3.6, Source: devices.LocationSourceAPI},
+		{DeviceID: 4, Timestamp: start.Add(time.Hour), Latitude: 51.6, Longitude: 3.7, Altitude: ptr(2.0), Source: devices.LocationSourcePipeline},
+	}
+
+	track, err := json.Marshal(devices.LocationTrack(dev, locations))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "Feature",
+		"id": "4",
+		"geometry": {"type": "LineString", "coordinates": [[3.6, 51.5], [3.7, 51.6]]},
+		"properties": {
+			"device_id": 4,
+			"device_code": "buoy",
+			"timestamps": ["2025-04-01T12:00:00Z", "2025-04-01T13:00:00Z"],
+			"altitudes": [null, 2]
+		}
+	}`, string(track))
+
+	track, err = json.Marshal(devices.LocationTrack(dev, locations[:1]))
+	require.NoError(t, err)
+	assert.Contains(t, string(track), `"geometry":null`, "a single location is not a line")
+
+	points, err := json.Marshal(devices.LocationPoints(locations))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "FeatureCollection",
+		"features": [
+			{
+				"type": "Feature",
+				"geometry": {"type": "Point", "coordinates": [3.6, 51.5]},
+				"properties": {"device_id": 4, "timestamp": "2025-04-01T12:00:00Z", "altitude": null, "source": "api"}
+			},
+			{
+				"type": "Feature",
+				"geometry": {"type": "Point", "coordinates": [3.7, 51.6, 2]},
+				"properties": {"device_id": 4, "timestamp": "2025-04-01T13:00:00Z", "altitude": 2, "source": "pipeline"}
+			}
+		]
+	}`, string(points))
+}
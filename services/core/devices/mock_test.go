@@ -8,6 +8,7 @@ import (
 	"sensorbucket.nl/sensorbucket/internal/pagination"
 	"sensorbucket.nl/sensorbucket/services/core/devices"
 	"sync"
+	"time"
 )
 
 // Ensure, that DeviceStoreMock does implement devices.DeviceStore.
@@ -20,15 +21,24 @@ var _ devices.DeviceStore = &DeviceStoreMock{}
 //
 //		// make and configure a mocked devices.DeviceStore
 //		mockedDeviceStore := &DeviceStoreMock{
+//			AddLocationsFunc: func(ctx context.Context, locations []devices.DeviceLocation) error {
+//				panic("mock out the AddLocations method")
+//			},
 //			AddSensorFunc: func(ctx context.Context, dev *devices.Device, sensor *devices.Sensor) error {
 //				panic("mock out the AddSensor method")
 //			},
+//			CreateDevicesFunc: func(ctx context.Context, devs []*devices.Device) error {
+//				panic("mock out the CreateDevices method")
+//			},
 //			DeleteFunc: func(ctx context.Context, dev *devices.Device) error {
 //				panic("mock out the Delete method")
 //			},
 //			FindFunc: func(ctx context.Context, id int64) (*devices.Device, error) {
 //				panic("mock out the Find method")
 //			},
+//			GetLocationAtFunc: func(ctx context.Context, deviceID int64, at time.Time) (*devices.DeviceLocation, error) {
+//				panic("mock out the GetLocationAt method")
+//			},
 //			GetSensorFunc: func(ctx context.Context, id int64) (*devices.Sensor, error) {
 //				panic("mock out the GetSensor method")
 //			},
@@ -41,6 +51,9 @@ var _ devices.DeviceStore = &DeviceStoreMock{}
 //			ListInRangeFunc: func(contextMoqParam context.Context, deviceFilter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
 //				panic("mock out the ListInRange method")
 //			},
+//			ListLocationsFunc: func(ctx context.Context, deviceID int64, filter devices.DeviceLocationFilter) ([]devices.DeviceLocation, error) {
+//				panic("mock out the ListLocations method")
+//			},
 //			ListSensorsFunc: func(contextMoqParam context.Context, request pagination.Request) (*pagination.Page[devices.Sensor], error) {
 //				panic("mock out the ListSensors method")
 //			},
@@ -57,15 +70,24 @@ var _ devices.DeviceStore = &DeviceStoreMock{}
 //
 //	}
 type DeviceStoreMock struct {
+	// AddLocationsFunc mocks the AddLocations method.
+	AddLocationsFunc func(ctx context.Context, locations []devices.DeviceLocation) error
+
 	// AddSensorFunc mocks the AddSensor method.
 	AddSensorFunc func(ctx context.Context, dev *devices.Device, sensor *devices.Sensor) error
 
+	// CreateDevicesFunc mocks the CreateDevices method.
+	CreateDevicesFunc func(ctx context.Context, devs []*devices.Device) error
+
 	// DeleteFunc mocks the Delete method.
 	DeleteFunc func(ctx context.Context, dev *devices.Device) error
 
 	// FindFunc mocks the Find method.
 	FindFunc func(ctx context.Context, id int64) (*devices.Device, error)
 
+	// GetLocationAtFunc mocks the GetLocationAt method.
+	GetLocationAtFunc func(ctx context.Context, deviceID int64, at time.Time) (*devices.DeviceLocation, error)
+
 	// GetSensorFunc mocks the GetSensor method.
 	GetSensorFunc func(ctx context.Context, id int64) (*devices.Sensor, error)
 
@@ -78,6 +100,9 @@ type DeviceStoreMock struct {
 	// ListInRangeFunc mocks the ListInRange method.
 	ListInRangeFunc func(contextMoqParam context.Context, deviceFilter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error)
 
+	// ListLocationsFunc mocks the ListLocations method.
+	ListLocationsFunc func(ctx context.Context, deviceID int64, filter devices.DeviceLocationFilter) ([]devices.DeviceLocation, error)
+
 	// ListSensorsFunc mocks the ListSensors method.
 	ListSensorsFunc func(contextMoqParam context.Context, request pagination.Request) (*pagination.Page[devices.Sensor], error)
 
@@ -89,6 +114,13 @@ type DeviceStoreMock struct {
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// AddLocations holds details about calls to the AddLocations method.
+		AddLocations []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Locations is the locations argument value.
+			Locations []devices.DeviceLocation
+		}
 		// AddSensor holds details about calls to the AddSensor method.
 		AddSensor []struct {
 			// Ctx is the ctx argument value.
@@ -98,6 +130,13 @@ type DeviceStoreMock struct {
 			// Sensor is the sensor argument value.
 			Sensor *devices.Sensor
 		}
+		// CreateDevices holds details about calls to the CreateDevices method.
+		CreateDevices []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Devs is the devs argument value.
+			Devs []*devices.Device
+		}
 		// Delete holds details about calls to the Delete method.
 		Delete []struct {
 			// Ctx is the ctx argument value.
@@ -112,6 +151,15 @@ type DeviceStoreMock struct {
 			// ID is the id argument value.
 			ID int64
 		}
+		// GetLocationAt holds details about calls to the GetLocationAt method.
+		GetLocationAt []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DeviceID is the deviceID argument value.
+			DeviceID int64
+			// At is the at argument value.
+			At time.Time
+		}
 		// GetSensor holds details about calls to the GetSensor method.
 		GetSensor []struct {
 			// Ctx is the ctx argument value.
@@ -146,6 +194,15 @@ type DeviceStoreMock struct {
 			// Request is the request argument value.
 			Request pagination.Request
 		}
+		// ListLocations holds details about calls to the ListLocations method.
+		ListLocations []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DeviceID is the deviceID argument value.
+			DeviceID int64
+			// Filter is the filter argument value.
+			Filter devices.DeviceLocationFilter
+		}
 		// ListSensors holds details about calls to the ListSensors method.
 		ListSensors []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -170,18 +227,58 @@ type DeviceStoreMock struct {
 			Opts devices.UpdateSensorOpts
 		}
 	}
+	lockAddLocations      sync.RWMutex
 	lockAddSensor         sync.RWMutex
+	lockCreateDevices     sync.RWMutex
 	lockDelete            sync.RWMutex
 	lockFind              sync.RWMutex
+	lockGetLocationAt     sync.RWMutex
 	lockGetSensor         sync.RWMutex
 	lockList              sync.RWMutex
 	lockListInBoundingBox sync.RWMutex
 	lockListInRange       sync.RWMutex
+	lockListLocations     sync.RWMutex
 	lockListSensors       sync.RWMutex
 	lockSave              sync.RWMutex
 	lockUpdateSensor      sync.RWMutex
 }
 
+// AddLocations calls AddLocationsFunc.
+func (mock *DeviceStoreMock) AddLocations(ctx context.Context, locations []devices.DeviceLocation) error {
+	if mock.AddLocationsFunc == nil {
+		panic("DeviceStoreMock.AddLocationsFunc: method is nil but DeviceStore.AddLocations was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		Locations []devices.DeviceLocation
+	}{
+		Ctx:       ctx,
+		Locations: locations,
+	}
+	mock.lockAddLocations.Lock()
+	mock.calls.AddLocations = append(mock.calls.AddLocations, callInfo)
+	mock.lockAddLocations.Unlock()
+	return mock.AddLocationsFunc(ctx, locations)
+}
+
+// AddLocationsCalls gets all the calls that were made to AddLocations.
+// Check the length with:
+//
+//	len(mockedDeviceStore.AddLocationsCalls())
+func (mock *DeviceStoreMock) AddLocationsCalls() []struct {
+	Ctx       context.Context
+	Locations []devices.DeviceLocation
+} {
+	var calls []struct {
+		Ctx       context.Context
+		Locations []devices.DeviceLocation
+	}
+	mock.lockAddLocations.RLock()
+	calls = mock.calls.AddLocations
+	mock.lockAddLocations.RUnlock()
+	return calls
+}
+
 // AddSensor calls AddSensorFunc.
 func (mock *DeviceStoreMock) AddSensor(ctx context.Context, dev *devices.Device, sensor *devices.Sensor) error {
 	if mock.AddSensorFunc == nil {
@@ -222,6 +319,42 @@ func (mock *DeviceStoreMock) AddSensorCalls() []struct {
 	return calls
 }
 
+// CreateDevices calls CreateDevicesFunc.
+func (mock *DeviceStoreMock) CreateDevices(ctx context.Context, devs []*devices.Device) error {
+	if mock.CreateDevicesFunc == nil {
+		panic("DeviceStoreMock.CreateDevicesFunc: method is nil but DeviceStore.CreateDevices was just called")
+	}
+	callInfo := struct {
+		Ctx  context.Context
+		Devs []*devices.Device
+	}{
+		Ctx:  ctx,
+		Devs: devs,
+	}
+	mock.lockCreateDevices.Lock()
+	mock.calls.CreateDevices = append(mock.calls.CreateDevices, callInfo)
+	mock.lockCreateDevices.Unlock()
+	return mock.CreateDevicesFunc(ctx, devs)
+}
+
+// CreateDevicesCalls gets all the calls that were made to CreateDevices.
+// Check the length with:
+//
+//	len(mockedDeviceStore.CreateDevicesCalls())
+func (mock *DeviceStoreMock) CreateDevicesCalls() []struct {
+	Ctx  context.Context
+	Devs []*devices.Device
+} {
+	var calls []struct {
+		Ctx  context.Context
+		Devs []*devices.Device
+	}
+	mock.lockCreateDevices.RLock()
+	calls = mock.calls.CreateDevices
+	mock.lockCreateDevices.RUnlock()
+	return calls
+}
+
 // Delete calls DeleteFunc.
 func (mock *DeviceStoreMock) Delete(ctx context.Context, dev *devices.Device) error {
 	if mock.DeleteFunc == nil {
@@ -294,6 +427,46 @@ func (mock *DeviceStoreMock) FindCalls() []struct {
 	return calls
 }
 
+// GetLocationAt calls GetLocationAtFunc.
+func (mock *DeviceStoreMock) GetLocationAt(ctx context.Context, deviceID int64, at time.Time) (*devices.DeviceLocation, error) {
+	if mock.GetLocationAtFunc == nil {
+		panic("DeviceStoreMock.GetLocationAtFunc: method is nil but DeviceStore.GetLocationAt was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		DeviceID int64
+		At       time.Time
+	}{
+		Ctx:      ctx,
+		DeviceID: deviceID,
+		At:       at,
+	}
+	mock.lockGetLocationAt.Lock()
+	mock.calls.GetLocationAt = append(mock.calls.GetLocationAt, callInfo)
+	mock.lockGetLocationAt.Unlock()
+	return mock.GetLocationAtFunc(ctx, deviceID, at)
+}
+
+// GetLocationAtCalls gets all the calls that were made to GetLocationAt.
+// Check the length with:
+//
+//	len(mockedDeviceStore.GetLocationAtCalls())
+func (mock *DeviceStoreMock) GetLocationAtCalls() []struct {
+	Ctx      context.Context
+	DeviceID int64
+	At       time.Time
+} {
+	var calls []struct {
+		Ctx      context.Context
+		DeviceID int64
+		At       time.Time
+	}
+	mock.lockGetLocationAt.RLock()
+	calls = mock.calls.GetLocationAt
+	mock.lockGetLocationAt.RUnlock()
+	return calls
+}
+
 // GetSensor calls GetSensorFunc.
 func (mock *DeviceStoreMock) GetSensor(ctx context.Context, id int64) (*devices.Sensor, error) {
 	if mock.GetSensorFunc == nil {
@@ -450,6 +623,46 @@ func (mock *DeviceStoreMock) ListInRangeCalls() []struct {
 	return calls
 }
 
+// ListLocations calls ListLocationsFunc.
+func (mock *DeviceStoreMock) ListLocations(ctx context.Context, deviceID int64, filter devices.DeviceLocationFilter) ([]devices.DeviceLocation, error) {
+	if mock.ListLocationsFunc == nil {
+		panic("DeviceStoreMock.ListLocationsFunc: method is nil but DeviceStore.ListLocations was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		DeviceID int64
+		Filter   devices.DeviceLocationFilter
+	}{
+		Ctx:      ctx,
+		DeviceID: deviceID,
+		Filter:   filter,
+	}
+	mock.lockListLocations.Lock()
+	mock.calls.ListLocations = append(mock.calls.ListLocations, callInfo)
+	mock.lockListLocations.Unlock()
+	return mock.ListLocationsFunc(ctx, deviceID, filter)
+}
+
+// ListLocationsCalls gets all the calls that were made to ListLocations.
+// Check the length with:
+//
+//	len(mockedDeviceStore.ListLocationsCalls())
+func (mock *DeviceStoreMock) ListLocationsCalls() []struct {
+	Ctx      context.Context
+	DeviceID int64
+	Filter   devices.DeviceLocationFilter
+} {
+	var calls []struct {
+		Ctx      context.Context
+		DeviceID int64
+		Filter   devices.DeviceLocationFilter
+	}
+	mock.lockListLocations.RLock()
+	calls = mock.calls.ListLocations
+	mock.lockListLocations.RUnlock()
+	return calls
+}
+
 // ListSensors calls ListSensorsFunc.
 func (mock *DeviceStoreMock) ListSensors(contextMoqParam context.Context, request pagination.Request) (*pagination.Page[devices.Sensor], error) {
 	if mock.ListSensorsFunc == nil {
@@ -771,3 +984,225 @@ func (mock *SensorGroupStoreMock) SaveCalls() []struct {
 	mock.lockSave.RUnlock()
 	return calls
 }
+
+// Ensure, that DeviceTemplateStoreMock does implement devices.DeviceTemplateStore.
+// If this is not the case, regenerate this file with moq.
+var _ devices.DeviceTemplateStore = &DeviceTemplateStoreMock{}
+
+// DeviceTemplateStoreMock is a mock implementation of devices.DeviceTemplateStore.
+//
+//	func TestSomethingThatUsesDeviceTemplateStore(t *testing.T) {
+//
+//		// make and configure a mocked devices.DeviceTemplateStore
+//		mockedDeviceTemplateStore := &DeviceTemplateStoreMock{
+//			DeleteFunc: func(ctx context.Context, id int64) error {
+//				panic("mock out the Delete method")
+//			},
+//			GetFunc: func(ctx context.Context, id int64) (*devices.DeviceTemplate, error) {
+//				panic("mock out the Get method")
+//			},
+//			ListFunc: func(ctx context.Context, p pagination.Request) (*pagination.Page[devices.DeviceTemplate], error) {
+//				panic("mock out the List method")
+//			},
+//			SaveFunc: func(ctx context.Context, template *devices.DeviceTemplate) error {
+//				panic("mock out the Save method")
+//			},
+//		}
+//
+//		// use mockedDeviceTemplateStore in code that requires devices.DeviceTemplateStore
+//		// and then make assertions.
+//
+//	}
+type DeviceTemplateStoreMock struct {
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(ctx context.Context, id int64) error
+
+	// GetFunc mocks the Get method.
+	GetFunc func(ctx context.Context, id int64) (*devices.DeviceTemplate, error)
+
+	// ListFunc mocks the List method.
+	ListFunc func(ctx context.Context, p pagination.Request) (*pagination.Page[devices.DeviceTemplate], error)
+
+	// SaveFunc mocks the Save method.
+	SaveFunc func(ctx context.Context, template *devices.DeviceTemplate) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID int64
+		}
+		// Get holds details about calls to the Get method.
+		Get []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID int64
+		}
+		// List holds details about calls to the List method.
+		List []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// P is the p argument value.
+			P pagination.Request
+		}
+		// Save holds details about calls to the Save method.
+		Save []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Template is the template argument value.
+			Template *devices.DeviceTemplate
+		}
+	}
+	lockDelete sync.RWMutex
+	lockGet    sync.RWMutex
+	lockList   sync.RWMutex
+	lockSave   sync.RWMutex
+}
+
+// Delete calls DeleteFunc.
+func (mock *DeviceTemplateStoreMock) Delete(ctx context.Context, id int64) error {
+	if mock.DeleteFunc == nil {
+		panic("DeviceTemplateStoreMock.DeleteFunc: method is nil but DeviceTemplateStore.Delete was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		ID  int64
+	}{
+		Ctx: ctx,
+		ID:  id,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(ctx, id)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedDeviceTemplateStore.DeleteCalls())
+func (mock *DeviceTemplateStoreMock) DeleteCalls() []struct {
+	Ctx context.Context
+	ID  int64
+} {
+	var calls []struct {
+		Ctx context.Context
+		ID  int64
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// Get calls GetFunc.
+func (mock *DeviceTemplateStoreMock) Get(ctx context.Context, id int64) (*devices.DeviceTemplate, error) {
+	if mock.GetFunc == nil {
+		panic("DeviceTemplateStoreMock.GetFunc: method is nil but DeviceTemplateStore.Get was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		ID  int64
+	}{
+		Ctx: ctx,
+		ID:  id,
+	}
+	mock.lockGet.Lock()
+	mock.calls.Get = append(mock.calls.Get, callInfo)
+	mock.lockGet.Unlock()
+	return mock.GetFunc(ctx, id)
+}
+
+// GetCalls gets all the calls that were made to Get.
+// Check the length with:
+//
+//	len(mockedDeviceTemplateStore.GetCalls())
+func (mock *DeviceTemplateStoreMock) GetCalls() []struct {
+	Ctx context.Context
+	ID  int64
+} {
+	var calls []struct {
+		Ctx context.Context
+		ID  int64
+	}
+	mock.lockGet.RLock()
+	calls = mock.calls.Get
+	mock.lockGet.RUnlock()
+	return calls
+}
+
+// List calls ListFunc.
+func (mock *DeviceTemplateStoreMock) List(ctx context.Context, p pagination.Request) (*pagination.Page[devices.DeviceTemplate], error) {
+	if mock.ListFunc == nil {
+		panic("DeviceTemplateStoreMock.ListFunc: method is nil but DeviceTemplateStore.List was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		P   pagination.Request
+	}{
+		Ctx: ctx,
+		P:   p,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(ctx, p)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedDeviceTemplateStore.ListCalls())
+func (mock *DeviceTemplateStoreMock) ListCalls() []struct {
+	Ctx context.Context
+	P   pagination.Request
+} {
+	var calls []struct {
+		Ctx context.Context
+		P   pagination.Request
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
+
+// Save calls SaveFunc.
+func (mock *DeviceTemplateStoreMock) Save(ctx context.Context, template *devices.DeviceTemplate) error {
+	if mock.SaveFunc == nil {
+		panic("DeviceTemplateStoreMock.SaveFunc: method is nil but DeviceTemplateStore.Save was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Template *devices.DeviceTemplate
+	}{
+		Ctx:      ctx,
+		Template: template,
+	}
+	mock.lockSave.Lock()
+	mock.calls.Save = append(mock.calls.Save, callInfo)
+	mock.lockSave.Unlock()
+	return mock.SaveFunc(ctx, template)
+}
+
+// SaveCalls gets all the calls that were made to Save.
+// Check the length with:
+//
+//	len(mockedDeviceTemplateStore.SaveCalls())
+func (mock *DeviceTemplateStoreMock) SaveCalls() []struct {
+	Ctx      context.Context
+	Template *devices.DeviceTemplate
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Template *devices.DeviceTemplate
+	}
+	mock.lockSave.RLock()
+	calls = mock.calls.Save
+	mock.lockSave.RUnlock()
+	return calls
+}
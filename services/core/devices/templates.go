@@ -0,0 +1,373 @@
+package devices
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+var (
+	ErrDeviceTemplateNotFound          = web.NewError(http.StatusNotFound, "device template not found", "DEVICE_TEMPLATE_NOT_FOUND")
+	ErrDeviceTemplateNameInvalid       = web.NewError(http.StatusBadRequest, "device template name invalid", "DEVICE_TEMPLATE_INVALID_NAME")
+	ErrDeviceTemplatePropertiesInvalid = web.NewError(http.StatusBadRequest, "device template properties must be a JSON object", "DEVICE_TEMPLATE_INVALID_PROPERTIES")
+)
+
+// TemplateSensor is a sensor that every device created from the template has
+type TemplateSensor struct {
+	Code        string          `json:"code"`
+	Brand       string          `json:"brand"`
+	Description string          `json:"description"`
+	ExternalID  string          `json:"external_id"`
+	ArchiveTime *int            `json:"archive_time"`
+	IsFallback  bool            `json:"is_fallback"`
+	Properties  json.RawMessage `json:"properties"`
+}
+
+func (ts TemplateSensor) sensorOpts() NewSensorOpts {
+	return NewSensorOpts{
+		Code:        ts.Code,
+		Brand:       ts.Brand,
+		Description: ts.Description,
+		ExternalID:  ts.ExternalID,
+		ArchiveTime: ts.ArchiveTime,
+		IsFallback:  ts.IsFallback,
+		Properties:  ts.Properties,
+	}
+}
+
+// appliedTo returns the sensor with the fields of the template sensor, the identity of the sensor and its feature of
+// interest are kept
+func (ts TemplateSensor) appliedTo(sensor Sensor) Sensor {
+	sensor.Brand = ts.Brand
+	sensor.Description = ts.Description
+	sensor.ExternalID = ts.ExternalID
+	sensor.ArchiveTime = ts.ArchiveTime
+	sensor.IsFallback = ts.IsFallback
+	sensor.Properties = ts.Properties
+	return sensor
+}
+
+// DeviceTemplate describes a device model. Devices created from the template get its sensors and default
+// properties, changes to the sensors of the template can be propagated to these devices.
+type DeviceTemplate struct {
+	ID          int64            `json:"id"`
+	TenantID    int64            `json:"tenant_id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Properties  json.RawMessage  `json:"properties"`
+	Sensors     []TemplateSensor `json:"sensors"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+type NewDeviceTemplateOpts struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Properties  json.RawMessage  `json:"properties"`
+	Sensors     []TemplateSensor `json:"sensors"`
+}
+
+func NewDeviceTemplate(tenantID int64, opts NewDeviceTemplateOpts) (*DeviceTemplate, error) {
+	template := &DeviceTemplate{
+		TenantID:    tenantID,
+		Description: opts.Description,
+		Properties:  []byte("{}"),
+		Sensors:     []TemplateSensor{},
+		CreatedAt:   time.Now(),
+	}
+	if err := template.SetName(opts.Name); err != nil {
+		return nil, err
+	}
+	if err := template.SetProperties(opts.Properties); err != nil {
+		return nil, err
+	}
+	if err := template.SetSensors(opts.Sensors); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func (t *DeviceTemplate) SetName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrDeviceTemplateNameInvalid
+	}
+	t.Name = name
+	return nil
+}
+
+// SetProperties sets the default properties of devices created from the template, nil keeps the current properties
+func (t *DeviceTemplate) SetProperties(properties json.RawMessage) error {
+	if properties == nil {
+		return nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(properties, &object); err != nil || object == nil {
+		return ErrDeviceTemplatePropertiesInvalid
+	}
+	t.Properties = properties
+	return nil
+}
+
+// SetSensors replaces the sensors of the template, they must be valid as the sensors of a single device
+func (t *DeviceTemplate) SetSensors(sensors []TemplateSensor) error {
+	var dev Device
+	for ix := range sensors {
+		if sensors[ix].Properties == nil {
+			sensors[ix].Properties = []byte("{}")
+		}
+		if _, err := dev.AddSensor(sensors[ix].sensorOpts()); err != nil {
+			return fmt.Errorf("template sensor '%s': %w", sensors[ix].Code, err)
+		}
+	}
+	if sensors == nil {
+		sensors = []TemplateSensor{}
+	}
+	t.Sensors = sensors
+	return nil
+}
+
+// NewDevice creates a device with the sensors of the template. Properties of the device are merged into the default
+// properties of the template.
+func (t *DeviceTemplate) NewDevice(opts NewDeviceOpts) (*Device, error) {
+	properties, err := mergeProperties(t.Properties, opts.Properties)
+	if err != nil {
+		return nil, err
+	}
+	opts.Properties = properties
+	dev, err := NewDevice(t.TenantID, opts)
+	if err != nil {
+		return nil, err
+	}
+	dev.TemplateID = &t.ID
+	for _, ts := range t.Sensors {
+		if _, err := dev.AddSensor(ts.sensorOpts()); err != nil {
+			return nil, err
+		}
+	}
+	return dev, nil
+}
+
+// mergeProperties returns the defaults with the keys of the overrides replaced
+func mergeProperties(defaults, overrides json.RawMessage) (json.RawMessage, error) {
+	if len(overrides) == 0 {
+		return defaults, nil
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(defaults, &merged); err != nil || merged == nil {
+		merged = map[string]json.RawMessage{}
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(overrides, &object); err != nil || object == nil {
+		// Properties that are not an object can not be merged and replace the defaults
+		return overrides, nil
+	}
+	for key, value := range object {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// TemplateDeviceChange lists the changes to a device created from the template when the template is applied to it
+type TemplateDeviceChange struct {
+	DeviceID       int64    `json:"device_id"`
+	DeviceCode     string   `json:"device_code"`
+	AddedSensors   []string `json:"added_sensors"`
+	UpdatedSensors []string `json:"updated_sensors"`
+	// RemovedSensors are the sensors of the device that were removed from the template, they are only removed from
+	// the device if requested
+	RemovedSensors []string `json:"removed_sensors"`
+	// KeptSensors are the sensors of the device that were removed from the template but are kept on the device
+	KeptSensors []string `json:"kept_sensors"`
+	// UpdatedProperties are the device properties that follow a changed default property of the template
+	UpdatedProperties []string `json:"updated_properties"`
+	// Error is set if the template can not be applied to the device, for example if a template sensor has the
+	// external ID of a sensor that was added to the device by hand
+	Error string `json:"error,omitempty"`
+}
+
+// IsEmpty reports whether there is nothing to report for the device
+func (c TemplateDeviceChange) IsEmpty() bool {
+	return len(c.AddedSensors) == 0 && len(c.UpdatedSensors) == 0 && len(c.RemovedSensors) == 0 &&
+		len(c.KeptSensors) == 0 && len(c.UpdatedProperties) == 0 && c.Error == ""
+}
+
+// ApplyTo updates the sensors of the device with the same code as a template sensor and adds the template sensors
+// the device does not have. Sensors that are not in the template are kept, except for the sensors of the previous
+// template that are no longer in the template if removeSensors is set.
+// Device properties that still have the default value of the previous template follow the changed defaults, device
+// properties that were set by hand are kept. Without a previous template no sensors are removed and the
+// properties are not changed.
+// The device is only changed if the template can be applied as a whole.
+func (t *DeviceTemplate) ApplyTo(dev *Device, previous *DeviceTemplate, removeSensors bool) (TemplateDeviceChange, error) {
+	change := TemplateDeviceChange{
+		DeviceID:          dev.ID,
+		DeviceCode:        dev.Code,
+		AddedSensors:      []string{},
+		UpdatedSensors:    []string{},
+		RemovedSensors:    []string{},
+		KeptSensors:       []string{},
+		UpdatedProperties: []string{},
+	}
+	sensors := []Sensor{}
+	for _, sensor := range dev.Sensors {
+		if previous == nil || !previous.hasSensor(sensor.Code) || t.hasSensor(sensor.Code) {
+			sensors = append(sensors, sensor)
+			continue
+		}
+		if !removeSensors {
+			sensors = append(sensors, sensor)
+			change.KeptSensors = append(change.KeptSensors, sensor.Code)
+			continue
+		}
+		change.RemovedSensors = append(change.RemovedSensors, sensor.Code)
+	}
+	added := []TemplateSensor{}
+	for _, ts := range t.Sensors {
+		ix := indexOfSensorCode(sensors, ts.Code)
+		if ix == -1 {
+			added = append(added, ts)
+			continue
+		}
+		updated := ts.appliedTo(sensors[ix])
+		if !sensorEqual(sensors[ix], updated) {
+			sensors[ix] = updated
+			change.UpdatedSensors = append(change.UpdatedSensors, ts.Code)
+		}
+	}
+
+	properties := dev.Properties
+	if previous != nil {
+		var err error
+		properties, change.UpdatedProperties, err = followDefaultProperties(dev.Properties, previous.Properties, t.Properties)
+		if err != nil {
+			return change, err
+		}
+	}
+
+	// Adding the sensors to a device with the updated sensors validates the device as a whole
+	candidate := *dev
+	candidate.Sensors = []Sensor{}
+	for _, sensor := range sensors {
+		if _, err := candidate.AddSensor(sensorOpts(sensor)); err != nil {
+			return change, fmt.Errorf("sensor '%s': %w", sensor.Code, err)
+		}
+	}
+	candidate.Sensors = sensors
+	for _, ts := range added {
+		if _, err := candidate.AddSensor(ts.sensorOpts()); err != nil {
+			return change, fmt.Errorf("template sensor '%s': %w", ts.Code, err)
+		}
+		change.AddedSensors = append(change.AddedSensors, ts.Code)
+	}
+	dev.Sensors = candidate.Sensors
+	dev.Properties = properties
+	return change, nil
+}
+
+func (t *DeviceTemplate) hasSensor(code string) bool {
+	for _, ts := range t.Sensors {
+		if ts.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// followDefaultProperties changes the properties that have the previous default value to the current default value,
+// a property is removed if its default is removed. It returns the properties with the sorted keys that changed.
+// Properties that are not an object do not follow the defaults.
+func followDefaultProperties(properties, previous, current json.RawMessage) (json.RawMessage, []string, error) {
+	changed := []string{}
+	var object, previousDefaults, currentDefaults map[string]json.RawMessage
+	if err := json.Unmarshal(properties, &object); err != nil || object == nil {
+		return properties, changed, nil
+	}
+	if err := json.Unmarshal(previous, &previousDefaults); err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(current, &currentDefaults); err != nil {
+		return nil, nil, err
+	}
+
+	keys := map[string]struct{}{}
+	for key := range previousDefaults {
+		keys[key] = struct{}{}
+	}
+	for key := range currentDefaults {
+		keys[key] = struct{}{}
+	}
+	for key := range keys {
+		oldDefault, hadDefault := previousDefaults[key]
+		newDefault, hasDefault := currentDefaults[key]
+		if hadDefault && hasDefault && jsonEqual(oldDefault, newDefault) {
+			continue
+		}
+		value, isSet := object[key]
+		// A property set by hand differs from the previous default, or is set while there was no default
+		if isSet != hadDefault || (isSet && !jsonEqual(value, oldDefault)) {
+			continue
+		}
+		if hasDefault {
+			object[key] = newDefault
+		} else {
+			delete(object, key)
+		}
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		return properties, changed, nil
+	}
+	slices.Sort(changed)
+	merged, err := json.Marshal(object)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, changed, nil
+}
+
+func sensorOpts(sensor Sensor) NewSensorOpts {
+	return NewSensorOpts{
+		Code:              sensor.Code,
+		Brand:             sensor.Brand,
+		Description:       sensor.Description,
+		ExternalID:        sensor.ExternalID,
+		ArchiveTime:       sensor.ArchiveTime,
+		FeatureOfInterest: sensor.FeatureOfInterest,
+		Properties:        sensor.Properties,
+		IsFallback:        sensor.IsFallback,
+	}
+}
+
+func indexOfSensorCode(sensors []Sensor, code string) int {
+	for ix := range sensors {
+		if sensors[ix].Code == code {
+			return ix
+		}
+	}
+	return -1
+}
+
+func sensorEqual(a, b Sensor) bool {
+	archiveTimeEqual := (a.ArchiveTime == nil && b.ArchiveTime == nil) ||
+		(a.ArchiveTime != nil && b.ArchiveTime != nil && *a.ArchiveTime == *b.ArchiveTime)
+	return a.Brand == b.Brand && a.Description == b.Description && a.ExternalID == b.ExternalID &&
+		a.IsFallback == b.IsFallback && archiveTimeEqual && jsonEqual(a.Properties, b.Properties)
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
@@ -0,0 +1,205 @@
+package devices_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+func newTemplate(t *testing.T) *devices.DeviceTemplate {
+	template, err := devices.NewDeviceTemplate(authtest.DefaultTenantID, devices.NewDeviceTemplateOpts{
+		Name:       "LoRa node",
+		Properties: json.RawMessage(`{"network":"ttn","model":"v1"}`),
+		Sensors: []devices.TemplateSensor{
+			{Code: "temp", Brand: "acme", ExternalID: "1", ArchiveTime: ptr(30)},
+			{Code: "hum", Brand: "acme", ExternalID: "2"},
+		},
+	})
+	require.NoError(t, err)
+	template.ID = 3
+	return template
+}
+
+func TestDeviceTemplateShouldCreateDevicesWithItsSensors(t *testing.T) {
+	template := newTemplate(t)
+
+	dev, err := template.NewDevice(devices.NewDeviceOpts{
+		Code:       "node-1",
+		Properties: json.RawMessage(`{"model":"v2","owner":"harbour"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *dev.TemplateID)
+	assert.JSONEq(t, `{"network":"ttn","model":"v2","owner":"harbour"}`, string(dev.Properties))
+	require.Len(t, dev.Sensors, 2)
+	assert.Equal(t, "temp", dev.Sensors[0].Code)
+	assert.Equal(t, "acme", dev.Sensors[0].Brand)
+	assert.Equal(t, 30, *dev.Sensors[0].ArchiveTime)
+	assert.JSONEq(t, `{}`, string(dev.Sensors[1].Properties))
+
+	_, err = devices.NewDeviceTemplate(authtest.DefaultTenantID, devices.NewDeviceTemplateOpts{
+		Name:    "Duplicate",
+		Sensors: []devices.TemplateSensor{{Code: "temp", ExternalID: "1"}, {Code: "temp", ExternalID: "2"}},
+	})
+	assert.ErrorIs(t, err, devices.ErrDuplicateSensorCode)
+	_, err = devices.NewDeviceTemplate(authtest.DefaultTenantID, devices.NewDeviceTemplateOpts{Name: " "})
+	assert.ErrorIs(t, err, devices.ErrDeviceTemplateNameInvalid)
+	_, err = devices.NewDeviceTemplate(authtest.DefaultTenantID, devices.NewDeviceTemplateOpts{
+		Name: "Array", Properties: json.RawMessage(`[]`),
+	})
+	assert.ErrorIs(t, err, devices.ErrDeviceTemplatePropertiesInvalid)
+}
+
+func TestDeviceTemplateShouldApplyToDevice(t *testing.T) {
+	template := newTemplate(t)
+	dev, err := template.NewDevice(devices.NewDeviceOpts{Code: "node-1"})
+	require.NoError(t, err)
+	dev.ID = 10
+	for ix := range dev.Sensors {
+		dev.Sensors[ix].ID = int64(ix + 1)
+	}
+	_, err = dev.AddSensor(devices.NewSensorOpts{Code: "extra", ExternalID: "9"})
+	require.NoError(t, err)
+
+	change, err := template.ApplyTo(dev, nil, false)
+	require.NoError(t, err)
+	assert.True(t, change.IsEmpty(), "a device matching its template does not change")
+
+	require.NoError(t, template.SetSensors([]devices.TemplateSensor{
+		{Code: "temp", Brand: "acme", ExternalID: "1", ArchiveTime: ptr(60)},
+		{Code: "hum", Brand: "acme", ExternalID: "2"},
+		{Code: "battery", ExternalID: "3"},
+	}))
+	change, err = template.ApplyTo(dev, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, devices.TemplateDeviceChange{
+		DeviceID: 10, DeviceCode: "node-1", AddedSensors: []string{"battery"}, UpdatedSensors: []string{"temp"},
+		RemovedSensors: []string{}, KeptSensors: []string{}, UpdatedProperties: []string{},
+	}, change)
+	require.Len(t, dev.Sensors, 4, "sensors that are not in the template are kept")
+	assert.Equal(t, int64(1), dev.Sensors[0].ID)
+	assert.Equal(t, 60, *dev.Sensors[0].ArchiveTime)
+	assert.Equal(t, "extra", dev.Sensors[2].Code)
+	assert.Equal(t, "battery", dev.Sensors[3].Code)
+	assert.Equal(t, int64(10), dev.Sensors[3].DeviceID)
+
+	// A template sensor conflicting with a sensor of the device leaves the device untouched
+	require.NoError(t, template.SetSensors([]devices.TemplateSensor{{Code: "pressure", ExternalID: "9"}}))
+	_, err = template.ApplyTo(dev, nil, false)
+	assert.ErrorIs(t, err, devices.ErrDuplicateSensorExternalID)
+	assert.Len(t, dev.Sensors, 4)
+}
+
+func TestDeviceTemplateShouldRemoveSensorsAndFollowDefaultProperties(t *testing.T) {
+	previous := newTemplate(t)
+	newDevice := func() *devices.Device {
+		dev, err := previous.NewDevice(devices.NewDeviceOpts{
+			Code:       "node-1",
+			Properties: json.RawMessage(`{"model":"v2"}`),
+		})
+		require.NoError(t, err)
+		_, err = dev.AddSensor(devices.NewSensorOpts{Code: "extra", ExternalID: "9"})
+		require.NoError(t, err)
+		return dev
+	}
+	updated := *previous
+	require.NoError(t, updated.SetSensors([]devices.TemplateSensor{{Code: "temp", Brand: "acme", ExternalID: "1", ArchiveTime: ptr(30)}}))
+	require.NoError(t, updated.SetProperties(json.RawMessage(`{"network":"kpn","model":"v3","firmware":"1.0"}`)))
+
+	dev := newDevice()
+	change, err := updated.ApplyTo(dev, previous, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hum"}, change.KeptSensors)
+	assert.Empty(t, change.RemovedSensors)
+	assert.Equal(t, []string{"firmware", "network"}, change.UpdatedProperties, "properties set by hand are kept")
+	assert.Len(t, dev.Sensors, 3, "sensors are only removed if requested")
+	assert.JSONEq(t, `{"network":"kpn","model":"v2","firmware":"1.0"}`, string(dev.Properties))
+
+	dev = newDevice()
+	change, err = updated.ApplyTo(dev, previous, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hum"}, change.RemovedSensors)
+	assert.Empty(t, change.KeptSensors)
+	require.Len(t, dev.Sensors, 2, "sensors added by hand are never removed")
+	assert.Equal(t, "temp", dev.Sensors[0].Code)
+	assert.Equal(t, "extra", dev.Sensors[1].Code)
+
+	// A removed default is removed from the devices that still have the default value
+	require.NoError(t, updated.SetProperties(json.RawMessage(`{"model":"v1"}`)))
+	dev = newDevice()
+	dev.Properties = json.RawMessage(`{"network":"ttn","model":"v1"}`)
+	change, err = updated.ApplyTo(dev, previous, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network"}, change.UpdatedProperties)
+	assert.JSONEq(t, `{"model":"v1"}`, string(dev.Properties))
+}
+
+func TestServiceShouldPreviewAndPropagateDeviceTemplateUpdates(t *testing.T) {
+	template := newTemplate(t)
+	matching, err := template.NewDevice(devices.NewDeviceOpts{Code: "node-1"})
+	require.NoError(t, err)
+	conflicting, err := template.NewDevice(devices.NewDeviceOpts{Code: "node-2"})
+	require.NoError(t, err)
+	_, err = conflicting.AddSensor(devices.NewSensorOpts{Code: "extra", ExternalID: "3"})
+	require.NoError(t, err)
+
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, p pagination.Request) (*pagination.Page[devices.Device], error) {
+			assert.Equal(t, []int64{template.ID}, filter.Template)
+			return &pagination.Page[devices.Device]{Data: []devices.Device{*matching, *conflicting}}, nil
+		},
+		SaveFunc: func(ctx context.Context, dev *devices.Device) error {
+			return nil
+		},
+	}
+	templateStore := &DeviceTemplateStoreMock{
+		SaveFunc: func(ctx context.Context, template *devices.DeviceTemplate) error {
+			return nil
+		},
+	}
+	svc := devices.New(deviceStore, nil, templateStore, nil)
+	opts := devices.UpdateDeviceTemplateOpts{
+		Name: ptr("LoRa node v2"),
+		Sensors: []devices.TemplateSensor{
+			template.Sensors[0],
+			{Code: "battery", ExternalID: "3"},
+		},
+		RemoveSensors: true,
+	}
+
+	preview, err := svc.PreviewDeviceTemplateUpdate(authtest.GodContext(), template, opts)
+	require.NoError(t, err)
+	assert.Empty(t, templateStore.SaveCalls())
+	assert.Empty(t, deviceStore.SaveCalls())
+	assert.Equal(t, "LoRa node", template.Name, "a preview does not change the template")
+	assert.Equal(t, "LoRa node v2", preview.Template.Name)
+	assert.False(t, preview.Propagated)
+	require.Len(t, preview.Devices, 2)
+	assert.Equal(t, []string{"battery"}, preview.Devices[0].AddedSensors)
+	assert.Equal(t, []string{"hum"}, preview.Devices[0].RemovedSensors)
+	assert.Empty(t, preview.Devices[0].Error)
+	assert.NotEmpty(t, preview.Devices[1].Error)
+
+	update, err := svc.UpdateDeviceTemplate(authtest.GodContext(), template, opts, false)
+	require.NoError(t, err)
+	assert.Len(t, templateStore.SaveCalls(), 1)
+	assert.Empty(t, deviceStore.SaveCalls(), "without propagation only the template changes")
+	assert.Equal(t, "LoRa node v2", template.Name)
+	assert.False(t, update.Propagated)
+
+	// Sensors are only removed by the update that removes them from the template
+	update, err = svc.UpdateDeviceTemplate(authtest.GodContext(), newTemplate(t), opts, true)
+	require.NoError(t, err)
+	assert.True(t, update.Propagated)
+	require.Len(t, deviceStore.SaveCalls(), 1, "devices the template can not be applied to are skipped")
+	saved := deviceStore.SaveCalls()[0].Dev
+	assert.Equal(t, "node-1", saved.Code)
+	require.Len(t, saved.Sensors, 2)
+	assert.Equal(t, "battery", saved.Sensors[1].Code)
+}
@@ -23,6 +23,8 @@ import (
 	"sensorbucket.nl/sensorbucket/pkg/auth"
 	"sensorbucket.nl/sensorbucket/pkg/healthchecker"
 	"sensorbucket.nl/sensorbucket/pkg/mq"
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
+	alertinginfra "sensorbucket.nl/sensorbucket/services/core/alerting/infra"
 	"sensorbucket.nl/sensorbucket/services/core/devices"
 	deviceinfra "sensorbucket.nl/sensorbucket/services/core/devices/infra"
 	"sensorbucket.nl/sensorbucket/services/core/featuresofinterest"
@@ -32,7 +34,10 @@ import (
 	"sensorbucket.nl/sensorbucket/services/core/processing"
 	processinginfra "sensorbucket.nl/sensorbucket/services/core/processing/infra"
 	"sensorbucket.nl/sensorbucket/services/core/projects"
+	"sensorbucket.nl/sensorbucket/services/core/sensorthings"
 	coretransport "sensorbucket.nl/sensorbucket/services/core/transport"
+	"sensorbucket.nl/sensorbucket/services/core/webhooks"
+	webhooksinfra "sensorbucket.nl/sensorbucket/services/core/webhooks/infra"
 )
 
 var (
@@ -53,8 +58,21 @@ var (
 		"http://oathkeeper:4456/.well-known/jwks.json",
 	)
 	SYS_ARCHIVE_TIME            = env.Could("SYS_ARCHIVE_TIME", "30")
+	TENANTS_URL                 = env.Could("TENANTS_URL", "http://tenants:3002")
+	TENANT_ARCHIVE_TIME_TTL     = env.CouldInt("TENANT_ARCHIVE_TIME_TTL", 300)
 	MEASUREMENT_BATCH_SIZE      = env.CouldInt("MEASUREMENT_BATCH_SIZE", 1024)
 	MEASUREMENT_COMMIT_INTERVAL = env.CouldInt("MEASUREMENT_COMMIT_INTERVAL", 1000)
+	MEASUREMENT_CONFLICT_POLICY = env.Could("MEASUREMENT_CONFLICT_POLICY", "ignore")
+	ROLLUP_HOURLY_RETENTION     = env.CouldInt("ROLLUP_HOURLY_RETENTION", measurements.DefaultRollupRetention.HourlyDays)
+	ROLLUP_DAILY_RETENTION      = env.CouldInt("ROLLUP_DAILY_RETENTION", measurements.DefaultRollupRetention.DailyDays)
+	ALERT_EVALUATION_INTERVAL   = env.CouldInt("ALERT_EVALUATION_INTERVAL", 60)
+	ALERT_NOTIFICATION_WORKERS  = env.CouldInt("ALERT_NOTIFICATION_WORKERS", 4)
+	ALERT_SMTP_HOST             = env.Could("ALERT_SMTP_HOST", "")
+	ALERT_SMTP_USERNAME         = env.Could("ALERT_SMTP_USERNAME", "")
+	ALERT_SMTP_PASSWORD         = env.Could("ALERT_SMTP_PASSWORD", "")
+	ALERT_SMTP_FROM             = env.Could("ALERT_SMTP_FROM", "")
+	WEBHOOK_DELIVERY_INTERVAL   = env.CouldInt("WEBHOOK_DELIVERY_INTERVAL", 5)
+	WEBHOOK_DELIVERY_WORKERS    = env.CouldInt("WEBHOOK_DELIVERY_WORKERS", webhooks.DefaultDeliveryWorkers)
 )
 
 func main() {
@@ -104,13 +122,26 @@ func Run(cleanup cleanupper.Cleanupper) error {
 
 	devicestore := deviceinfra.NewPSQLStore(db)
 	sensorGroupStore := deviceinfra.NewPSQLSensorGroupStore(db)
-	deviceservice := devices.New(devicestore, sensorGroupStore, featureOfInterestService)
+	deviceTemplateStore := deviceinfra.NewPSQLDeviceTemplateStore(db)
+	deviceservice := devices.New(devicestore, sensorGroupStore, deviceTemplateStore, featureOfInterestService)
 
 	sysArchiveTime, err := strconv.Atoi(SYS_ARCHIVE_TIME)
 	if err != nil {
 		return fmt.Errorf("could not convert SYS_ARCHIVE_TIME to integer: %w", err)
 	}
-	measurementstore := measurementsinfra.NewPSQL(pool)
+	conflictPolicy, err := measurements.ParseConflictPolicy(MEASUREMENT_CONFLICT_POLICY)
+	if err != nil {
+		return fmt.Errorf("could not parse MEASUREMENT_CONFLICT_POLICY: %w", err)
+	}
+	webhookstore := webhooksinfra.NewStorePSQL(pool)
+	measurementstore := measurementsinfra.NewPSQL(pool).
+		WithConflictPolicy(conflictPolicy).
+		WithRollupRetention(measurements.RollupRetention{
+			HourlyDays: ROLLUP_HOURLY_RETENTION,
+			DailyDays:  ROLLUP_DAILY_RETENTION,
+		}).
+		WithCommitHook(webhookstore.CreateMeasurementDeliveries).
+		WithCommitHook(devicestore.RecordMeasurementLocations)
 	storageErrorPublisher := measurementsinfra.NewStorageErrorPublisher(
 		amqpConn,
 		AMQP_XCHG_PIPELINE_MESSAGES,
@@ -120,8 +151,29 @@ func Run(cleanup cleanupper.Cleanupper) error {
 		sysArchiveTime,
 		MEASUREMENT_BATCH_SIZE,
 		keyClient,
-	)
-	// cleanup.Add(measurementservice.StartMeasurementBatchStorer(time.Duration(MEASUREMENT_COMMIT_INTERVAL) * time.Millisecond))
+		devicestore,
+	).WithTenantArchiveTime(measurements.NewTenantArchiveTimeCache(
+		measurementsinfra.NewTenantArchiveTimeHTTP(TENANTS_URL),
+		time.Duration(TENANT_ARCHIVE_TIME_TTL)*time.Second,
+	))
+	cleanup.Add(measurementservice.StartMeasurementBatchStorer(time.Duration(MEASUREMENT_COMMIT_INTERVAL) * time.Millisecond))
+
+	alertWebhookChannel := alerting.NewAsyncChannel(alertinginfra.NewWebhookChannel(), time.Minute)
+	cleanup.Add(alertWebhookChannel.Start(ALERT_NOTIFICATION_WORKERS))
+	alertingservice := alerting.New(alertinginfra.NewStorePSQL(pool)).
+		WithChannel(alerting.ChannelWebhook, alertWebhookChannel)
+	if ALERT_SMTP_HOST != "" {
+		alertEmailChannel := alerting.NewAsyncChannel(alertinginfra.NewSMTPChannel(
+			ALERT_SMTP_HOST, ALERT_SMTP_USERNAME, ALERT_SMTP_PASSWORD, ALERT_SMTP_FROM,
+		), time.Minute)
+		cleanup.Add(alertEmailChannel.Start(ALERT_NOTIFICATION_WORKERS))
+		alertingservice.WithChannel(alerting.ChannelEmail, alertEmailChannel)
+	}
+	measurementservice.WithMeasurementListener(alertingservice)
+	cleanup.Add(alertingservice.StartEvaluator(time.Duration(ALERT_EVALUATION_INTERVAL) * time.Second))
+
+	webhooksservice := webhooks.New(webhookstore).WithDeliveryWorkers(WEBHOOK_DELIVERY_WORKERS)
+	cleanup.Add(webhooksservice.StartDeliverer(time.Duration(WEBHOOK_DELIVERY_INTERVAL) * time.Second))
 
 	processingstore := processinginfra.NewPSQLStore(db)
 	processingPipelinePublisher := processinginfra.NewPipelineMessagePublisher(
@@ -133,6 +185,8 @@ func Run(cleanup cleanupper.Cleanupper) error {
 	projectsStore := projects.NewPostgresStore(pool)
 	projectsService := projects.New(projectsStore)
 
+	sensorThingsService := sensorthings.NewService(sensorthings.NewStorePSQL(pool))
+
 	// Setup MQ Transports
 	go mq.StartQueueProcessor(
 		amqpConn,
@@ -151,15 +205,16 @@ func Run(cleanup cleanupper.Cleanupper) error {
 	go amqpConn.Start()
 
 	// Setup HTTP Transport
-	httpsrv := createHTTPServer(coretransport.New(
-		HTTP_BASE,
-		keyClient,
-		deviceservice,
-		measurementservice,
-		processingservice,
-		projectsService,
-		featureOfInterestService,
-	))
+	httpsrv := createHTTPServer(coretransport.New(HTTP_BASE, keyClient, coretransport.Services{
+		Devices:            deviceservice,
+		Measurements:       measurementservice,
+		Processing:         processingservice,
+		Projects:           projectsService,
+		FeaturesOfInterest: featureOfInterestService,
+		SensorThings:       sensorThingsService,
+		Alerting:           alertingservice,
+		Webhooks:           webhooksservice,
+	}))
 	go func() {
 		if err := httpsrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) && err != nil {
 			fmt.Printf("HTTP Server error: %v\n", err)
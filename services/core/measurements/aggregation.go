@@ -0,0 +1,316 @@
+package measurements
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+// MaxAggregateBuckets limits the amount of time buckets a single aggregation may return
+const MaxAggregateBuckets = 10000
+
+var (
+	ErrAggregateIntervalInvalid = web.NewError(http.StatusBadRequest, "Aggregation interval is invalid, use a duration such as 15m, 1h or 1d", "ERR_AGGREGATE_INTERVAL_INVALID")
+	ErrAggregateFunctionInvalid = web.NewError(http.StatusBadRequest, "Aggregation function is invalid", "ERR_AGGREGATE_FUNCTION_INVALID")
+	ErrAggregateFillInvalid     = web.NewError(http.StatusBadRequest, "Aggregation fill strategy is invalid", "ERR_AGGREGATE_FILL_INVALID")
+	ErrAggregateRangeInvalid    = web.NewError(http.StatusBadRequest, "Aggregation requires a start and end time where start is before end", "ERR_AGGREGATE_RANGE_INVALID")
+	ErrAggregateTooManyBuckets  = web.NewError(http.StatusBadRequest, fmt.Sprintf("Aggregation would result in more than %d buckets, increase the interval or decrease the time range", MaxAggregateBuckets), "ERR_AGGREGATE_TOO_MANY_BUCKETS")
+)
+
+type AggregateFunction string
+
+const (
+	AggregateAverage AggregateFunction = "avg"
+	AggregateMinimum AggregateFunction = "min"
+	AggregateMaximum AggregateFunction = "max"
+	AggregateSum     AggregateFunction = "sum"
+	AggregateCount   AggregateFunction = "count"
+	AggregateFirst   AggregateFunction = "first"
+	AggregateLast    AggregateFunction = "last"
+)
+
+var aggregateFunctions = []AggregateFunction{
+	AggregateAverage, AggregateMinimum, AggregateMaximum, AggregateSum, AggregateCount, AggregateFirst, AggregateLast,
+}
+
+// ParseAggregateFunctions converts a list of function names to AggregateFunctions. Each entry may
+// itself be a comma separated list, such that both `fn=avg&fn=max` and `fn=avg,max` are supported.
+func ParseAggregateFunctions(names []string) ([]AggregateFunction, error) {
+	functions := []AggregateFunction{}
+	for _, name := range names {
+		for _, part := range strings.Split(name, ",") {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if part == "" {
+				continue
+			}
+			fn, ok := lookupAggregateFunction(part)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrAggregateFunctionInvalid, part)
+			}
+			functions = append(functions, fn)
+		}
+	}
+	if len(functions) == 0 {
+		functions = append(functions, AggregateAverage)
+	}
+	return functions, nil
+}
+
+func lookupAggregateFunction(name string) (AggregateFunction, bool) {
+	for _, fn := range aggregateFunctions {
+		if string(fn) == name {
+			return fn, true
+		}
+	}
+	return "", false
+}
+
+// ParseInterval parses a bucket interval. Besides the units supported by time.ParseDuration
+// it also accepts days (d) and weeks (w), for example: 1d or 2w
+func ParseInterval(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return 0, ErrAggregateIntervalInvalid
+	}
+	var interval time.Duration
+	var err error
+	switch {
+	case strings.HasSuffix(str, "d"), strings.HasSuffix(str, "w"):
+		unit := 24 * time.Hour
+		if strings.HasSuffix(str, "w") {
+			unit *= 7
+		}
+		var n int
+		n, err = strconv.Atoi(str[:len(str)-1])
+		interval = time.Duration(n) * unit
+	default:
+		interval, err = time.ParseDuration(str)
+	}
+	if err != nil || interval < time.Second {
+		return 0, fmt.Errorf("%w: %s", ErrAggregateIntervalInvalid, str)
+	}
+	return interval, nil
+}
+
+// FillStrategy determines what happens with time buckets that have no measurements
+type FillStrategy string
+
+const (
+	// FillNone omits empty buckets from the result
+	FillNone FillStrategy = ""
+	// FillNull returns empty buckets with null values
+	FillNull FillStrategy = "null"
+	// FillPrevious returns empty buckets with the values of the previous non-empty bucket
+	FillPrevious FillStrategy = "previous"
+	// FillLinear interpolates empty buckets linearly between the surrounding non-empty buckets, empty buckets
+	// before the first or after the last non-empty bucket are null
+	FillLinear FillStrategy = "linear"
+	// FillValue returns empty buckets with the fill value of the aggregation options
+	FillValue FillStrategy = "value"
+)
+
+func ParseFillStrategy(str string) (FillStrategy, error) {
+	switch fill := FillStrategy(strings.ToLower(str)); fill {
+	case FillNone, FillNull, FillPrevious, FillLinear:
+		return fill, nil
+	case "none":
+		return FillNone, nil
+	}
+	return FillNone, fmt.Errorf("%w: %s", ErrAggregateFillInvalid, str)
+}
+
+// ParseFill parses a fill strategy like ParseFillStrategy, a number results in the FillValue strategy with
+// that number as fill value
+func ParseFill(str string) (FillStrategy, float64, error) {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return FillNone, 0, fmt.Errorf("%w: %s", ErrAggregateFillInvalid, str)
+		}
+		return FillValue, value, nil
+	}
+	fill, err := ParseFillStrategy(str)
+	return fill, 0, err
+}
+
+type AggregationOptions struct {
+	// Interval is the bucket size, if zero an interval is chosen based on the time range
+	Interval  time.Duration
+	Functions []AggregateFunction
+	Fill      FillStrategy
+	// FillValue is the value of empty buckets with the FillValue strategy
+	FillValue  float64
+	Resolution Resolution
+}
+
+// Aggregate holds the aggregated values of all measurements within a single time bucket
+type Aggregate struct {
+	Bucket time.Time                      `json:"bucket"`
+	Values map[AggregateFunction]*float64 `json:"values"`
+}
+
+// BucketStart returns the start of the bucket the given time falls in. Buckets are aligned
+// to the unix epoch, identical to the buckets created by the store.
+func BucketStart(t time.Time, interval time.Duration) time.Time {
+	ns := t.UnixNano()
+	bucket := ns / int64(interval)
+	if ns < 0 && ns%int64(interval) != 0 {
+		bucket--
+	}
+	return time.Unix(0, bucket*int64(interval)).UTC()
+}
+
+func (s *Service) AggregateDatastream(
+	ctx context.Context,
+	id uuid.UUID,
+	filter Filter,
+	opts AggregationOptions,
+) ([]Aggregate, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Start.IsZero() || filter.End.IsZero() || !filter.Start.Before(filter.End) {
+		return nil, ErrAggregateRangeInvalid
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if len(opts.Functions) == 0 {
+		opts.Functions = []AggregateFunction{AggregateAverage}
+	}
+	opts, err = resolveAggregation(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Interval < time.Second {
+		return nil, ErrAggregateIntervalInvalid
+	}
+	if filter.End.Sub(filter.Start)/opts.Interval > MaxAggregateBuckets {
+		return nil, ErrAggregateTooManyBuckets
+	}
+
+	// Ensures the datastream exists and belongs to this tenant
+	ds, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}})
+	if err != nil {
+		return nil, err
+	}
+	var converter *UnitConverter
+	if filter.Unit != "" {
+		c, err := NewUnitConverter(ds.UnitOfMeasurement, filter.Unit)
+		if err != nil {
+			return nil, err
+		}
+		// A sum of values with an offset, such as Cel, can not be converted without the count
+		if c.Offset != 0 && slices.Contains(opts.Functions, AggregateSum) {
+			return nil, fmt.Errorf("%w: sum of %s can not be converted to %s", ErrUnitIncompatible, ds.UnitOfMeasurement, filter.Unit)
+		}
+		converter = &c
+	}
+
+	filter.TenantID = []int64{tenantID}
+	filter.Datastream = []string{id.String()}
+	aggregates, err := s.store.AggregateMeasurements(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	if converter != nil {
+		convertAggregates(aggregates, *converter)
+	}
+
+	if opts.Fill == FillNone {
+		return aggregates, nil
+	}
+	return fillAggregates(aggregates, filter.Start, filter.End, opts), nil
+}
+
+// convertAggregates converts all aggregated values to another unit, except for the count
+func convertAggregates(aggregates []Aggregate, converter UnitConverter) {
+	for _, aggregate := range aggregates {
+		for fn, value := range aggregate.Values {
+			if fn == AggregateCount || value == nil {
+				continue
+			}
+			converted := converter.Convert(*value)
+			aggregate.Values[fn] = &converted
+		}
+	}
+}
+
+// fillAggregates inserts a bucket for every interval between start and end that is not
+// present in aggregates. Aggregates must be sorted by bucket ascending.
+func fillAggregates(aggregates []Aggregate, start, end time.Time, opts AggregationOptions) []Aggregate {
+	filled := make([]Aggregate, 0, int(end.Sub(start)/opts.Interval)+1)
+	empty := make([]bool, 0, cap(filled))
+	var previous *Aggregate
+	ix := 0
+	for bucket := BucketStart(start, opts.Interval); !bucket.After(end); bucket = bucket.Add(opts.Interval) {
+		if ix < len(aggregates) && aggregates[ix].Bucket.Equal(bucket) {
+			filled = append(filled, aggregates[ix])
+			empty = append(empty, false)
+			previous = &aggregates[ix]
+			ix++
+			continue
+		}
+
+		emptyBucket := Aggregate{
+			Bucket: bucket,
+			Values: make(map[AggregateFunction]*float64, len(opts.Functions)),
+		}
+		for _, fn := range opts.Functions {
+			var value *float64
+			switch {
+			case fn == AggregateCount:
+				value = new(float64)
+			case opts.Fill == FillPrevious && previous != nil:
+				value = previous.Values[fn]
+			case opts.Fill == FillValue:
+				value = &opts.FillValue
+			}
+			emptyBucket.Values[fn] = value
+		}
+		filled = append(filled, emptyBucket)
+		empty = append(empty, true)
+	}
+	if opts.Fill == FillLinear {
+		interpolateAggregates(filled, empty, opts.Functions)
+	}
+	return filled
+}
+
+// interpolateAggregates sets the values of the empty buckets between two non-empty buckets on the line
+// between the values of those buckets. Buckets are equally spaced, so the position follows from the index.
+func interpolateAggregates(filled []Aggregate, empty []bool, functions []AggregateFunction) {
+	previous := -1
+	for ix := range filled {
+		if empty[ix] {
+			continue
+		}
+		if previous >= 0 && ix-previous > 1 {
+			for _, fn := range functions {
+				from, to := filled[previous].Values[fn], filled[ix].Values[fn]
+				if fn == AggregateCount || from == nil || to == nil {
+					continue
+				}
+				for gap := previous + 1; gap < ix; gap++ {
+					value := *from + (*to-*from)*float64(gap-previous)/float64(ix-previous)
+					filled[gap].Values[fn] = &value
+				}
+			}
+		}
+		previous = ix
+	}
+}
@@ -0,0 +1,188 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestParseInterval(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected time.Duration
+		err      error
+	}{
+		{input: "15m", expected: 15 * time.Minute},
+		{input: "1h", expected: time.Hour},
+		{input: "1d", expected: 24 * time.Hour},
+		{input: "2w", expected: 14 * 24 * time.Hour},
+		{input: "", err: measurements.ErrAggregateIntervalInvalid},
+		{input: "abc", err: measurements.ErrAggregateIntervalInvalid},
+		{input: "100ms", err: measurements.ErrAggregateIntervalInvalid},
+		{input: "-1h", err: measurements.ErrAggregateIntervalInvalid},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			interval, err := measurements.ParseInterval(tC.input)
+			if tC.err != nil {
+				assert.ErrorIs(t, err, tC.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, interval)
+		})
+	}
+}
+
+func TestParseAggregateFunctions(t *testing.T) {
+	functions, err := measurements.ParseAggregateFunctions([]string{"avg,MIN", "count"})
+	require.NoError(t, err)
+	assert.Equal(t, []measurements.AggregateFunction{
+		measurements.AggregateAverage, measurements.AggregateMinimum, measurements.AggregateCount,
+	}, functions)
+
+	_, err = measurements.ParseAggregateFunctions([]string{"avg,median"})
+	assert.ErrorIs(t, err, measurements.ErrAggregateFunctionInvalid)
+}
+
+func TestAggregateDatastreamShouldScopeToTenantAndDatastream(t *testing.T) {
+	id := uuid.New()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: id}, nil
+		},
+		AggregateMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+			return []measurements.Aggregate{}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	_, err := svc.AggregateDatastream(authtest.GodContext(), id, measurements.Filter{
+		Start:    start,
+		End:      start.Add(time.Hour),
+		TenantID: []int64{999},
+	}, measurements.AggregationOptions{Interval: time.Minute})
+	require.NoError(t, err)
+
+	require.Len(t, store.calls.GetDatastream, 1)
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, store.calls.GetDatastream[0].Filter.TenantID)
+	require.Len(t, store.calls.AggregateMeasurements, 1)
+	call := store.calls.AggregateMeasurements[0]
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, call.Filter.TenantID)
+	assert.Equal(t, []string{id.String()}, call.Filter.Datastream)
+	assert.Equal(t, []measurements.AggregateFunction{measurements.AggregateAverage}, call.AggregationOptions.Functions)
+}
+
+func TestAggregateDatastreamShouldRejectInvalidRanges(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := measurements.New(&StoreMock{}, 0, 1, authtest.JWKS(), nil)
+
+	_, err := svc.AggregateDatastream(authtest.GodContext(), uuid.New(), measurements.Filter{
+		Start: start,
+	}, measurements.AggregationOptions{Interval: time.Minute})
+	assert.ErrorIs(t, err, measurements.ErrAggregateRangeInvalid)
+
+	_, err = svc.AggregateDatastream(authtest.GodContext(), uuid.New(), measurements.Filter{
+		Start: start,
+		End:   start.AddDate(1, 0, 0),
+	}, measurements.AggregationOptions{Interval: time.Minute})
+	assert.ErrorIs(t, err, measurements.ErrAggregateTooManyBuckets)
+}
+
+func TestAggregateDatastreamShouldFillGaps(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: id}, nil
+		},
+		AggregateMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+			return []measurements.Aggregate{
+				{Bucket: start, Values: map[measurements.AggregateFunction]*float64{
+					measurements.AggregateAverage: ptr(10.0),
+					measurements.AggregateCount:   ptr(2.0),
+				}},
+				{Bucket: start.Add(2 * time.Hour), Values: map[measurements.AggregateFunction]*float64{
+					measurements.AggregateAverage: ptr(20.0),
+					measurements.AggregateCount:   ptr(1.0),
+				}},
+			}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	functions := []measurements.AggregateFunction{measurements.AggregateAverage, measurements.AggregateCount}
+	filter := measurements.Filter{Start: start.Add(30 * time.Minute), End: start.Add(3 * time.Hour)}
+
+	testCases := []struct {
+		fill            measurements.FillStrategy
+		fillValue       float64
+		expectedBuckets int
+		expectedGapAvg  *float64
+		expectedLastAvg *float64
+	}{
+		{fill: measurements.FillNone, expectedBuckets: 2},
+		{fill: measurements.FillNull, expectedBuckets: 4, expectedGapAvg: nil},
+		{fill: measurements.FillPrevious, expectedBuckets: 4, expectedGapAvg: ptr(10.0), expectedLastAvg: ptr(20.0)},
+		{fill: measurements.FillLinear, expectedBuckets: 4, expectedGapAvg: ptr(15.0)},
+		{fill: measurements.FillValue, fillValue: -1, expectedBuckets: 4, expectedGapAvg: ptr(-1.0), expectedLastAvg: ptr(-1.0)},
+	}
+	for _, tC := range testCases {
+		t.Run(string(tC.fill), func(t *testing.T) {
+			aggregates, err := svc.AggregateDatastream(authtest.GodContext(), uuid.New(), filter, measurements.AggregationOptions{
+				Interval:  time.Hour,
+				Functions: functions,
+				Fill:      tC.fill,
+				FillValue: tC.fillValue,
+			})
+			require.NoError(t, err)
+			require.Len(t, aggregates, tC.expectedBuckets)
+			if tC.fill == measurements.FillNone {
+				return
+			}
+			for ix, aggregate := range aggregates {
+				assert.Equal(t, start.Add(time.Duration(ix)*time.Hour), aggregate.Bucket)
+			}
+			gap := aggregates[1]
+			assert.Equal(t, tC.expectedGapAvg, gap.Values[measurements.AggregateAverage])
+			assert.Equal(t, ptr(0.0), gap.Values[measurements.AggregateCount])
+			assert.Equal(t, tC.expectedLastAvg, aggregates[3].Values[measurements.AggregateAverage])
+		})
+	}
+}
+
+func TestParseFill(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expected      measurements.FillStrategy
+		expectedValue float64
+		err           error
+	}{
+		{input: "", expected: measurements.FillNone},
+		{input: "none", expected: measurements.FillNone},
+		{input: "Linear", expected: measurements.FillLinear},
+		{input: "previous", expected: measurements.FillPrevious},
+		{input: "0", expected: measurements.FillValue},
+		{input: "-2.5", expected: measurements.FillValue, expectedValue: -2.5},
+		{input: "value", err: measurements.ErrAggregateFillInvalid},
+		{input: "NaN", err: measurements.ErrAggregateFillInvalid},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			fill, value, err := measurements.ParseFill(tC.input)
+			if tC.err != nil {
+				assert.ErrorIs(t, err, tC.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, fill)
+			assert.Equal(t, tC.expectedValue, value)
+		})
+	}
+}
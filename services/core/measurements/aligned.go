@@ -0,0 +1,188 @@
+package measurements
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+// MaxAlignedColumns limits the amount of columns of a single aligned query
+const MaxAlignedColumns = 20
+
+var (
+	ErrAlignedColumnsInvalid = web.NewError(http.StatusBadRequest, fmt.Sprintf("Aligned query requires between 1 and %d columns", MaxAlignedColumns), "ERR_ALIGNED_COLUMNS_INVALID")
+	ErrAlignedColumnInvalid  = web.NewError(http.StatusBadRequest, "Aligned column is invalid, use <datastream id>[:<function>[:<fill>]]", "ERR_ALIGNED_COLUMN_INVALID")
+)
+
+// AlignedColumn is a datastream aggregated with a single function onto the common time axis
+type AlignedColumn struct {
+	Datastream uuid.UUID         `json:"datastream"`
+	Function   AggregateFunction `json:"function"`
+	// Fill determines the value in buckets without measurements, without fill strategy the value is null
+	Fill      FillStrategy `json:"fill"`
+	FillValue float64      `json:"fill_value"`
+}
+
+// Name identifies the column by its datastream and function, for example as CSV header
+func (c AlignedColumn) Name() string {
+	return c.Datastream.String() + ":" + string(c.Function)
+}
+
+// ParseAlignedColumn parses a column in the form <datastream id>[:<function>[:<fill>]]. The function defaults to
+// the average and the fill may be any strategy accepted by ParseFill.
+func ParseAlignedColumn(str string) (AlignedColumn, error) {
+	parts := strings.Split(strings.TrimSpace(str), ":")
+	if len(parts) > 3 {
+		return AlignedColumn{}, fmt.Errorf("%w: %s", ErrAlignedColumnInvalid, str)
+	}
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		return AlignedColumn{}, fmt.Errorf("%w: %s", ErrAlignedColumnInvalid, str)
+	}
+	column := AlignedColumn{Datastream: id, Function: AggregateAverage}
+	if len(parts) > 1 && parts[1] != "" {
+		fn, ok := lookupAggregateFunction(strings.ToLower(parts[1]))
+		if !ok {
+			return AlignedColumn{}, fmt.Errorf("%w: %s", ErrAggregateFunctionInvalid, parts[1])
+		}
+		column.Function = fn
+	}
+	if len(parts) > 2 {
+		column.Fill, column.FillValue, err = ParseFill(parts[2])
+		if err != nil {
+			return AlignedColumn{}, err
+		}
+	}
+	return column, nil
+}
+
+type AlignOptions struct {
+	// Interval is the bucket size, if zero an interval is chosen based on the time range
+	Interval   time.Duration
+	Columns    []AlignedColumn
+	Resolution Resolution
+}
+
+// AlignedRow holds the value of every column in a single time bucket
+type AlignedRow struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Values are in the order of the columns of the table
+	Values []*float64 `json:"values"`
+}
+
+// AlignedTable has a row for every time bucket in the time range and a column per aggregated datastream
+type AlignedTable struct {
+	Start           time.Time       `json:"start"`
+	End             time.Time       `json:"end"`
+	IntervalSeconds float64         `json:"interval_seconds"`
+	Columns         []AlignedColumn `json:"columns"`
+	Rows            []AlignedRow    `json:"rows"`
+}
+
+// AlignDatastreams aggregates several datastreams onto a common time axis. Only the time bounds of the filter are
+// used. Every datastream is aggregated once with the functions of its columns, after which every column is
+// filled with its own strategy.
+func (s *Service) AlignDatastreams(ctx context.Context, filter Filter, opts AlignOptions) (*AlignedTable, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Start.IsZero() || filter.End.IsZero() || !filter.Start.Before(filter.End) {
+		return nil, ErrAggregateRangeInvalid
+	}
+	if len(opts.Columns) == 0 || len(opts.Columns) > MaxAlignedColumns {
+		return nil, ErrAlignedColumnsInvalid
+	}
+	functions := map[uuid.UUID][]AggregateFunction{}
+	datastreams := []uuid.UUID{}
+	for _, column := range opts.Columns {
+		if _, ok := lookupAggregateFunction(string(column.Function)); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrAggregateFunctionInvalid, column.Function)
+		}
+		if _, ok := functions[column.Datastream]; !ok {
+			datastreams = append(datastreams, column.Datastream)
+		}
+		if !lo.Contains(functions[column.Datastream], column.Function) {
+			functions[column.Datastream] = append(functions[column.Datastream], column.Function)
+		}
+	}
+
+	// The interval only depends on the time range, so it is the same for every datastream
+	aggregation, err := resolveAggregation(filter, AggregationOptions{Interval: opts.Interval, Resolution: ResolutionRaw})
+	if err != nil {
+		return nil, err
+	}
+	interval := aggregation.Interval
+	if interval < time.Second {
+		return nil, ErrAggregateIntervalInvalid
+	}
+	if filter.End.Sub(filter.Start)/interval > MaxAggregateBuckets {
+		return nil, ErrAggregateTooManyBuckets
+	}
+
+	aggregates := make(map[uuid.UUID][]Aggregate, len(datastreams))
+	for _, id := range datastreams {
+		// Ensures the datastream exists and belongs to this tenant
+		if _, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}}); err != nil {
+			return nil, err
+		}
+		dsFilter := Filter{
+			Start:      filter.Start,
+			End:        filter.End,
+			TenantID:   []int64{tenantID},
+			Datastream: []string{id.String()},
+		}
+		dsOpts, err := resolveAggregation(dsFilter, AggregationOptions{
+			Interval: interval, Functions: functions[id], Resolution: opts.Resolution,
+		})
+		if err != nil {
+			return nil, err
+		}
+		aggregates[id], err = s.store.AggregateMeasurements(ctx, dsFilter, dsOpts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	table := &AlignedTable{
+		Start:           filter.Start,
+		End:             filter.End,
+		IntervalSeconds: interval.Seconds(),
+		Columns:         opts.Columns,
+		Rows:            []AlignedRow{},
+	}
+	for col, column := range opts.Columns {
+		fill := column.Fill
+		if fill == FillNone {
+			fill = FillNull
+		}
+		filled := fillAggregates(aggregates[column.Datastream], filter.Start, filter.End, AggregationOptions{
+			Interval:  interval,
+			Functions: []AggregateFunction{column.Function},
+			Fill:      fill,
+			FillValue: column.FillValue,
+		})
+		for ix, aggregate := range filled {
+			if col == 0 {
+				table.Rows = append(table.Rows, AlignedRow{
+					Timestamp: aggregate.Bucket,
+					Values:    make([]*float64, len(opts.Columns)),
+				})
+			}
+			table.Rows[ix].Values[col] = aggregate.Values[column.Function]
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,90 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestAlignDatastreamsShouldFillEveryColumnOnTheCommonAxis(t *testing.T) {
+	level, temperature := uuid.New(), uuid.New()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	aggregates := map[string][]measurements.Aggregate{
+		level.String(): {
+			{Bucket: start, Values: map[measurements.AggregateFunction]*float64{
+				measurements.AggregateAverage: ptr(1.0), measurements.AggregateMaximum: ptr(2.0),
+			}},
+			{Bucket: start.Add(3 * time.Hour), Values: map[measurements.AggregateFunction]*float64{
+				measurements.AggregateAverage: ptr(4.0), measurements.AggregateMaximum: ptr(5.0),
+			}},
+		},
+		temperature.String(): {
+			{Bucket: start.Add(time.Hour), Values: map[measurements.AggregateFunction]*float64{
+				measurements.AggregateAverage: ptr(20.0),
+			}},
+		},
+	}
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: id}, nil
+		},
+		AggregateMeasurementsFunc: func(ctx context.Context, filter measurements.Filter, opts measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+			return aggregates[filter.Datastream[0]], nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	columns := []measurements.AlignedColumn{
+		{Datastream: level, Function: measurements.AggregateAverage, Fill: measurements.FillLinear},
+		{Datastream: level, Function: measurements.AggregateMaximum},
+		{Datastream: temperature, Function: measurements.AggregateAverage, Fill: measurements.FillValue, FillValue: -1},
+	}
+	table, err := svc.AlignDatastreams(authtest.GodContext(),
+		measurements.Filter{Start: start, End: start.Add(3 * time.Hour), TenantID: []int64{999}},
+		measurements.AlignOptions{Interval: time.Hour, Columns: columns},
+	)
+	require.NoError(t, err)
+
+	// Every datastream is aggregated once with the functions of its columns
+	require.Len(t, store.AggregateMeasurementsCalls(), 2)
+	call := store.AggregateMeasurementsCalls()[0]
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, call.Filter.TenantID)
+	assert.Equal(t, []measurements.AggregateFunction{measurements.AggregateAverage, measurements.AggregateMaximum}, call.AggregationOptions.Functions)
+	require.Len(t, store.GetDatastreamCalls(), 2)
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, store.GetDatastreamCalls()[0].Filter.TenantID)
+
+	assert.Equal(t, 3600.0, table.IntervalSeconds)
+	assert.Equal(t, []measurements.AlignedRow{
+		{Timestamp: start, Values: []*float64{ptr(1.0), ptr(2.0), ptr(-1.0)}},
+		{Timestamp: start.Add(time.Hour), Values: []*float64{ptr(2.0), nil, ptr(20.0)}},
+		{Timestamp: start.Add(2 * time.Hour), Values: []*float64{ptr(3.0), nil, ptr(-1.0)}},
+		{Timestamp: start.Add(3 * time.Hour), Values: []*float64{ptr(4.0), ptr(5.0), ptr(-1.0)}},
+	}, table.Rows)
+}
+
+func TestParseAlignedColumn(t *testing.T) {
+	id := uuid.New()
+	column, err := measurements.ParseAlignedColumn(id.String())
+	require.NoError(t, err)
+	assert.Equal(t, measurements.AlignedColumn{Datastream: id, Function: measurements.AggregateAverage}, column)
+
+	column, err = measurements.ParseAlignedColumn(id.String() + ":max:0.5")
+	require.NoError(t, err)
+	assert.Equal(t, measurements.AlignedColumn{
+		Datastream: id, Function: measurements.AggregateMaximum, Fill: measurements.FillValue, FillValue: 0.5,
+	}, column)
+
+	_, err = measurements.ParseAlignedColumn("level:avg")
+	assert.ErrorIs(t, err, measurements.ErrAlignedColumnInvalid)
+	_, err = measurements.ParseAlignedColumn(id.String() + ":median")
+	assert.ErrorIs(t, err, measurements.ErrAggregateFunctionInvalid)
+	_, err = measurements.ParseAlignedColumn(id.String() + ":avg:spline")
+	assert.ErrorIs(t, err, measurements.ErrAggregateFillInvalid)
+}
@@ -1,9 +1,10 @@
 package measurements
 
-//go:generate moq -pkg measurements_test -out mock_test.go . Store
+//go:generate moq -pkg measurements_test -out mock_test.go . Store DeviceStore TenantArchiveTimeProvider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/samber/lo"
 
+	"sensorbucket.nl/sensorbucket/internal/cleanupper"
 	"sensorbucket.nl/sensorbucket/internal/pagination"
 	"sensorbucket.nl/sensorbucket/pkg/auth"
 	"sensorbucket.nl/sensorbucket/pkg/pipeline"
@@ -31,8 +33,42 @@ type Store interface {
 		tenantID, sensorID int64,
 		observedProperty, UnitOfMeasurement string,
 	) (*Datastream, error)
+	// StoreMeasurements stores the measurements and sets the ID of every measurement that was stored. Measurements
+	// skipped because of the conflict policy are left with a zero ID.
 	StoreMeasurements(context.Context, []Measurement) error
-	StoreMeasurement(context.Context, Measurement) error
+	AggregateMeasurements(context.Context, Filter, AggregationOptions) ([]Aggregate, error)
+	ExportMeasurements(context.Context, Filter, func(Measurement) error) error
+	ListLatestMeasurements(context.Context, DatastreamFilter, pagination.Request) (*pagination.Page[Measurement], error)
+	ListRecentSamples(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]Sample, error)
+	// ListSamplesAt returns for every pair of datastream and time the latest sample at or before that time, or nil if
+	// the datastream has none
+	ListSamplesAt(ctx context.Context, datastreamIDs []uuid.UUID, timestamps []time.Time) ([]*Sample, error)
+	SetDatastreamQualityRules(ctx context.Context, datastreamID uuid.UUID, rules QualityRules) error
+	SetDatastreamArchiveTime(ctx context.Context, datastreamID uuid.UUID, days *int) error
+	// ApplyCorrection deletes or overwrites the measurements selected by the correction and records it
+	// together with the original measurements. The recalculations of derived datastreams are applied in the same
+	// transaction. The correction id and original measurements are set on success. ErrCorrectionTooLarge is returned
+	// without changes if a correction selects more than MaxCorrectedMeasurements measurements.
+	ApplyCorrection(ctx context.Context, correction *Correction, recalculations []Recalculation) error
+	ListCorrections(ctx context.Context, datastreamID uuid.UUID, r pagination.Request) (*pagination.Page[Correction], error)
+	// GetRollupRetention returns the rollup retention of the tenant, or the default if the tenant has none
+	GetRollupRetention(ctx context.Context, tenantID int64) (*RollupRetention, error)
+	SetRollupRetention(ctx context.Context, tenantID int64, retention RollupRetention) error
+	// CreateDerivedDatastream creates the datastream together with its derivation
+	CreateDerivedDatastream(ctx context.Context, derived *DerivedDatastream) error
+	GetDerivedDatastream(ctx context.Context, id uuid.UUID, tenantID int64) (*DerivedDatastream, error)
+	// ListDerivedDatastreams returns the derived datastreams that have any of the given datastreams as source
+	ListDerivedDatastreams(ctx context.Context, sourceIDs []uuid.UUID) ([]DerivedDatastream, error)
+	// ListSensorGroupSensors returns the ids of the sensors in any of the sensor groups of the tenant
+	ListSensorGroupSensors(ctx context.Context, tenantID int64, groupIDs []int64) ([]int64, error)
+	ListReportingStats(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start, end time.Time) ([]ReportingStats, error)
+	ListDailyCounts(ctx context.Context, datastreamID uuid.UUID, start, end time.Time) ([]DailyCount, error)
+	ListGaps(ctx context.Context, datastreamID uuid.UUID, start, end time.Time, threshold time.Duration, limit int) ([]Gap, error)
+	// SummarizeValues returns the summaries of the datastreams with measurements in the time range. Rollups are
+	// selected by the start of their bucket, so the time range must be aligned to the rollup interval.
+	SummarizeValues(ctx context.Context, datastreamIDs []uuid.UUID, start, end time.Time, resolution Resolution) ([]ValueSummary, error)
+	// CountHistogram counts the measurements in the time range per histogram bucket, omitting empty buckets
+	CountHistogram(ctx context.Context, ranges []HistogramRange, start, end time.Time, resolution Resolution) ([]HistogramCount, error)
 }
 
 // Service is the measurement service which stores measurement data.
@@ -40,77 +76,34 @@ type Service struct {
 	store             Store
 	systemArchiveTime int
 	keyClient         auth.JWKSClient
-	// measurementBatchChan chan Measurement
-	// measurementBatch     []Measurement
+	batchSize         int
+	batcher           *measurementBatcher
+	deviceStore       DeviceStore
+	broker            *measurementBroker
+	tenantArchiveTime TenantArchiveTimeProvider
+	listeners         []MeasurementListener
 }
 
-func New(store Store, systemArchiveTime, batchSize int, keyClient auth.JWKSClient) *Service {
+func New(store Store, systemArchiveTime, batchSize int, keyClient auth.JWKSClient, deviceStore DeviceStore) *Service {
 	return &Service{
 		store:             store,
 		systemArchiveTime: systemArchiveTime,
 		keyClient:         keyClient,
-		// measurementBatch:     make([]Measurement, 0, batchSize),
-		// measurementBatchChan: make(chan Measurement, batchSize),
+		batchSize:         batchSize,
+		deviceStore:       deviceStore,
+		broker:            newMeasurementBroker(),
 	}
 }
 
-// func (s *Service) StartMeasurementBatchStorer(interval time.Duration) cleanupper.Shutdown {
-// 	stop := make(chan struct{})
-// 	done := make(chan struct{})
-// 	t := time.NewTicker(interval)
-//
-// 	go func() {
-// 		log.Println("Measurement service batch storer started")
-// 		defer log.Println("Measurement service batch storer stopped!")
-// 	outer:
-// 		for {
-// 			select {
-// 			case <-stop:
-// 				if err := s.CommitBatch(false); err != nil {
-// 					log.Printf("error committing batch: %s\n", err.Error())
-// 				}
-// 				break outer
-// 			case m := <-s.measurementBatchChan:
-// 				s.measurementBatch = append(s.measurementBatch, m)
-// 				if len(s.measurementBatch) == cap(s.measurementBatch) {
-// 					if err := s.CommitBatch(false); err != nil {
-// 						log.Printf("error committing batch: %s\n", err.Error())
-// 					}
-// 				}
-// 			case <-t.C:
-// 				if err := s.CommitBatch(false); err != nil {
-// 					log.Printf("error committing batch: %s\n", err.Error())
-// 				}
-// 			}
-// 		}
-// 		close(done)
-// 	}()
-//
-// 	return func(ctx context.Context) error {
-// 		close(stop)
-// 		<-done
-// 		return nil
-// 	}
-// }
-//
-// func (s *Service) CommitBatch(collect bool) error {
-// 	if len(s.measurementBatch) == 0 {
-// 		if !collect || len(s.measurementBatchChan) == 0 {
-// 			return nil
-// 		}
-// 		count := len(s.measurementBatchChan)
-// 		for range count {
-// 			s.measurementBatch = append(s.measurementBatch, <-s.measurementBatchChan)
-// 		}
-// 	}
-// 	log.Printf("Committing %d measurements\n", len(s.measurementBatch))
-// 	err := s.store.StoreMeasurements(context.Background(), s.measurementBatch)
-// 	if err != nil {
-// 		return fmt.Errorf("committing measurements failed: %w", err)
-// 	}
-// 	s.measurementBatch = s.measurementBatch[:0]
-// 	return nil
-// }
+// StartMeasurementBatchStorer starts collecting measurements from processed pipeline messages in batches.
+// A batch is committed when it reaches the batch size or when the interval has passed, whichever comes first.
+// ProcessPipelineMessage blocks until the batch containing its measurements is committed.
+// Without a started batch storer, every pipeline message is committed on its own.
+func (s *Service) StartMeasurementBatchStorer(interval time.Duration) cleanupper.Shutdown {
+	s.batcher = newMeasurementBatcher(s.store, s.batchSize)
+	go s.batcher.run(interval)
+	return s.batcher.shutdown
+}
 
 func (s *Service) ProcessPipelineMessage(pmsg pipeline.Message) error {
 	msg := PipelineMessage(pmsg)
@@ -125,25 +118,11 @@ func (s *Service) ProcessPipelineMessage(pmsg pipeline.Message) error {
 	}
 
 	dev := (*devices.Device)(msg.Device)
-	baseMeasurement := Measurement{
-		UplinkMessageID:           msg.TracingID,
-		OrganisationID:            int(msg.TenantID),
-		DeviceID:                  msg.Device.ID,
-		DeviceCode:                msg.Device.Code,
-		DeviceDescription:         msg.Device.Description,
-		DeviceLatitude:            msg.Device.Latitude,
-		DeviceLongitude:           msg.Device.Longitude,
-		DeviceAltitude:            msg.Device.Altitude,
-		DeviceLocationDescription: msg.Device.LocationDescription,
-		DeviceProperties:          msg.Device.Properties,
-		DeviceState:               msg.Device.State,
-		MeasurementLatitude:       msg.Device.Latitude,
-		MeasurementLongitude:      msg.Device.Longitude,
-		MeasurementAltitude:       msg.Device.Altitude,
-		CreatedAt:                 time.Now(),
-	}
+	now := time.Now()
 
 	var errs []error
+	batch := make([]Measurement, 0, len(msg.Measurements))
+	quality := newQualityEvaluator(s.store, now)
 	for _, m := range msg.Measurements {
 		sensor, err := dev.GetSensorByExternalIDOrFallback(m.SensorExternalID)
 		if err != nil {
@@ -154,65 +133,136 @@ func (s *Service) ProcessPipelineMessage(pmsg pipeline.Message) error {
 			m.ObservedProperty = m.SensorExternalID + "_" + m.ObservedProperty
 		}
 
-		archiveTimeDays, _ := lo.Coalesce(
-			sensor.ArchiveTime,
-			&s.systemArchiveTime,
-		) // msg.Organisation.ArchiveTime)
+		// Different notations of the same unit must end up in the same datastream
+		uom, err := CanonicalUnit(m.UnitOfMeasurement)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
 
 		ds, err := s.store.FindOrCreateDatastream(
 			ctx,
 			msg.TenantID,
 			sensor.ID,
 			m.ObservedProperty,
-			m.UnitOfMeasurement,
+			uom,
 		)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("cannog get sensor: %w", err))
 			continue
 		}
 
-		measurement := baseMeasurement
-		measurement.SensorID = sensor.ID
-		measurement.SensorCode = sensor.Code
-		measurement.SensorDescription = sensor.Description
-		measurement.SensorExternalID = sensor.ExternalID
-		measurement.SensorProperties = sensor.Properties
-		measurement.SensorBrand = sensor.Brand
-		measurement.SensorArchiveTime = sensor.ArchiveTime
-		measurement.SensorIsFallback = sensor.IsFallback
-		measurement.DatastreamID = ds.ID
-		measurement.DatastreamDescription = ds.Description
-		measurement.DatastreamObservedProperty = ds.ObservedProperty
-		measurement.DatastreamUnitOfMeasurement = ds.UnitOfMeasurement
+		measurement := newMeasurement(msg.TenantID, dev, sensor, ds, now)
+		measurement.UplinkMessageID = msg.TracingID
+		measurement.MeasurementSource = MeasurementSourcePipeline
 		measurement.MeasurementTimestamp = time.UnixMilli(m.Timestamp)
 		measurement.MeasurementValue = m.Value
 		measurement.MeasurementProperties = m.Properties
-		measurement.MeasurementExpiration = time.UnixMilli(msg.ReceivedAt).
-			Add(time.Duration(*archiveTimeDays) * 24 * time.Hour)
-
-		// Fetch FoI info
-		if sensor.FeatureOfInterest != nil {
-			measurement.FeatureOfInterestID = &sensor.FeatureOfInterest.ID
-			measurement.FeatureOfInterestName = &sensor.FeatureOfInterest.Name
-			measurement.FeatureOfInterestDescription = &sensor.FeatureOfInterest.Description
-			measurement.FeatureOfInterestEncodingType = &sensor.FeatureOfInterest.EncodingType
-			measurement.FeatureOfInterestFeature = sensor.FeatureOfInterest.Feature
-			measurement.FeatureOfInterestProperties = &sensor.FeatureOfInterest.Properties
+		measurement.MeasurementDiscriminator = discriminatorValue(m.Properties[DiscriminatorProperty])
+		measurement.MeasurementQuality, err = quality.evaluate(ctx, ds, Sample{
+			Timestamp: measurement.MeasurementTimestamp,
+			Value:     measurement.MeasurementValue,
+		})
+		if err != nil {
+			// Storing the measurement without its quality would mark suspect data as good, so requeue the message
+			return errors.Join(append(errs, fmt.Errorf("%w: %w", ErrMeasurementsNotCommitted, err))...)
+		}
+		retention, err := s.retention(ctx, msg.TenantID, sensor, ds)
+		if err != nil {
+			// Guessing the retention might delete the measurement before the tenant wants, so requeue the message
+			return errors.Join(append(errs, fmt.Errorf("%w: %w", ErrMeasurementsNotCommitted, err))...)
 		}
+		measurement.MeasurementExpiration = retention.Expiration(time.UnixMilli(msg.ReceivedAt))
+		measurement.OrganisationArchiveTime = lo.FromPtr(retention.TenantArchiveTime)
 
 		// Measurement location is either explicitly set or falls back to device location
 		if m.Latitude != nil && m.Longitude != nil {
 			measurement.MeasurementLatitude = m.Latitude
 			measurement.MeasurementLongitude = m.Longitude
 			measurement.MeasurementAltitude = m.Altitude
+			measurement.LocationReported = true
 		}
 
-		errs = append(errs, s.store.StoreMeasurement(ctx, measurement))
+		batch = append(batch, measurement)
+	}
+
+	if err := s.commitMeasurements(ctx, batch); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrMeasurementsNotCommitted, err))
 	}
 
 	return errors.Join(errs...)
 }
 
+// newMeasurement creates a measurement for the sensor of a device in the given datastream. The measured
+// values, expiration and provenance are left to the caller.
+func newMeasurement(tenantID int64, dev *devices.Device, sensor *devices.Sensor, ds *Datastream, now time.Time) Measurement {
+	measurement := Measurement{
+		OrganisationID:              int(tenantID),
+		DeviceID:                    dev.ID,
+		DeviceCode:                  dev.Code,
+		DeviceDescription:           dev.Description,
+		DeviceLatitude:              dev.Latitude,
+		DeviceLongitude:             dev.Longitude,
+		DeviceAltitude:              dev.Altitude,
+		DeviceLocationDescription:   dev.LocationDescription,
+		DeviceProperties:            dev.Properties,
+		DeviceState:                 dev.State,
+		SensorID:                    sensor.ID,
+		SensorCode:                  sensor.Code,
+		SensorDescription:           sensor.Description,
+		SensorExternalID:            sensor.ExternalID,
+		SensorProperties:            sensor.Properties,
+		SensorBrand:                 sensor.Brand,
+		SensorArchiveTime:           sensor.ArchiveTime,
+		SensorIsFallback:            sensor.IsFallback,
+		DatastreamID:                ds.ID,
+		DatastreamDescription:       ds.Description,
+		DatastreamObservedProperty:  ds.ObservedProperty,
+		DatastreamUnitOfMeasurement: ds.UnitOfMeasurement,
+		MeasurementLatitude:         dev.Latitude,
+		MeasurementLongitude:        dev.Longitude,
+		MeasurementAltitude:         dev.Altitude,
+		CreatedAt:                   now,
+	}
+
+	// Fetch FoI info
+	if sensor.FeatureOfInterest != nil {
+		measurement.FeatureOfInterestID = &sensor.FeatureOfInterest.ID
+		measurement.FeatureOfInterestName = &sensor.FeatureOfInterest.Name
+		measurement.FeatureOfInterestDescription = &sensor.FeatureOfInterest.Description
+		measurement.FeatureOfInterestEncodingType = &sensor.FeatureOfInterest.EncodingType
+		measurement.FeatureOfInterestFeature = sensor.FeatureOfInterest.Feature
+		measurement.FeatureOfInterestProperties = &sensor.FeatureOfInterest.Properties
+	}
+	return measurement
+}
+
+func (s *Service) commitMeasurements(ctx context.Context, batch []Measurement) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	batch = append(batch, s.deriveMeasurements(ctx, batch)...)
+	var err error
+	if s.batcher == nil {
+		err = s.store.StoreMeasurements(ctx, batch)
+	} else {
+		err = s.batcher.commit(batch)
+	}
+	if err != nil {
+		return err
+	}
+	// Replays that were ignored must not be published again
+	stored := lo.Filter(batch, func(m Measurement, _ int) bool { return m.ID != 0 })
+	if len(stored) == 0 {
+		return nil
+	}
+	s.broker.publish(stored)
+	for _, listener := range s.listeners {
+		listener.MeasurementsCommitted(stored)
+	}
+	return nil
+}
+
 // Filter contains query information for a list of measurements
 type Filter struct {
 	Start               time.Time `url:"start"`
@@ -223,6 +273,42 @@ type Filter struct {
 	TenantID            []int64   `url:"tenant_id"`
 	FeatureOfInterestID []int64   `url:"feature_of_interest_id"`
 	ObservedProperty    []string  `url:"observed_property"`
+	// Unit converts the measurement values to the given unit, this fails for datastreams with
+	// an incompatible unit of measurement
+	Unit string `url:"unit"`
+	// Quality selects measurements that are "good", "suspect" or have a specific quality flag
+	Quality []string `url:"quality"`
+	// BoundingBox selects measurements located in the box formatted as west,south,east,north in WGS84 degrees
+	BoundingBox string `url:"bbox"`
+	// Polygon selects measurements located in the polygon or multipolygon given as WKT in WGS84 degrees
+	Polygon string `url:"polygon"`
+	// WithinFeatureOfInterest selects measurements located in the geometry of any of the features of interest
+	WithinFeatureOfInterest []int64 `url:"within_feature_of_interest"`
+	// SensorGroup selects measurements of the sensors in any of the sensor groups
+	SensorGroup []int64 `url:"sensor_group"`
+	// Project selects measurements of the features of interest in any of the projects, limited to the
+	// observation types the project is interested in for that feature. A feature of interest without
+	// observation types includes every observed property.
+	Project []int64 `url:"project"`
+	// Properties selects measurements of which the properties contain the given JSON object
+	Properties json.RawMessage `url:"properties"`
+	// Property selects measurements with a property that compares to a value, formatted as <key><operator><value>
+	// with nested keys separated by dots, for example gateway_eui=0011 or rssi>=-90
+	Property []string `url:"property"`
+}
+
+// validate checks the filter values that can not be validated when decoding the filter
+func (f Filter) validate() error {
+	if _, err := ParseQualityFilter(f.Quality); err != nil {
+		return err
+	}
+	if err := f.validateSpatialFilter(); err != nil {
+		return err
+	}
+	if err := f.validatePropertyFilter(); err != nil {
+		return err
+	}
+	return nil
 }
 
 func (s *Service) QueryMeasurements(
@@ -238,18 +324,63 @@ func (s *Service) QueryMeasurements(
 		return nil, err
 	}
 	f.TenantID = []int64{tenantID}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	converter, err := newMeasurementConverter(f.Unit)
+	if err != nil {
+		return nil, err
+	}
 
 	page, err := s.store.Query(ctx, f, r)
 	if err != nil {
 		return nil, err
 	}
+	for ix := range page.Data {
+		if err := converter.convert(&page.Data[ix]); err != nil {
+			return nil, err
+		}
+	}
 	return page, nil
 }
 
+// ExportMeasurements calls fn for every measurement matching the filter, ordered by timestamp ascending.
+// Measurements are streamed from the store, so the full result is never held in memory.
+func (s *Service) ExportMeasurements(ctx context.Context, f Filter, fn func(Measurement) error) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return err
+	}
+	f.TenantID = []int64{tenantID}
+	if err := f.validate(); err != nil {
+		return err
+	}
+	converter, err := newMeasurementConverter(f.Unit)
+	if err != nil {
+		return err
+	}
+
+	return s.store.ExportMeasurements(ctx, f, func(m Measurement) error {
+		if err := converter.convert(&m); err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
 type DatastreamFilter struct {
 	Sensor           []int
+	Device           []int64
 	ObservedProperty []string
 	TenantID         []int64
+	// SensorGroup selects datastreams of the sensors in any of the sensor groups
+	SensorGroup []int64 `url:"sensor_group"`
+	// Project selects datastreams of sensors observing a feature of interest in any of the projects, with
+	// an observed property the project is interested in for that feature
+	Project []int64 `url:"project"`
 }
 
 func (s *Service) ListDatastreams(
@@ -269,6 +400,39 @@ func (s *Service) ListDatastreams(
 	return s.store.ListDatastreams(ctx, filter, r)
 }
 
+// ListLatestMeasurements returns the most recent measurement of every datastream matching the filter.
+// Datastreams without measurements are omitted. If a unit is given, the values are converted to that unit.
+func (s *Service) ListLatestMeasurements(
+	ctx context.Context,
+	filter DatastreamFilter,
+	unit string,
+	r pagination.Request,
+) (*pagination.Page[Measurement], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter.TenantID = []int64{tenantID}
+	converter, err := newMeasurementConverter(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.store.ListLatestMeasurements(ctx, filter, r)
+	if err != nil {
+		return nil, err
+	}
+	for ix := range page.Data {
+		if err := converter.convert(&page.Data[ix]); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
 func (s *Service) GetDatastream(ctx context.Context, id uuid.UUID) (*Datastream, error) {
 	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
 		return nil, err
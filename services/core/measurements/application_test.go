@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"sensorbucket.nl/sensorbucket/internal/pagination"
 	"sensorbucket.nl/sensorbucket/pkg/authtest"
 	"sensorbucket.nl/sensorbucket/pkg/pipeline"
 	"sensorbucket.nl/sensorbucket/services/core/devices"
@@ -135,9 +136,10 @@ func TestShouldErrorIfNoDeviceOrNoSensor(t *testing.T) {
 				FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
 					return &measurements.Datastream{}, nil
 				},
-				StoreMeasurementFunc: func(contextMoqParam context.Context, measurement measurements.Measurement) error { return nil },
+				ListDerivedDatastreamsFunc: noDerivedDatastreams,
+				StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error { return nil },
 			}
-			svc := measurements.New(store, 0, 1, authtest.JWKS())
+			svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
 
 			// Act
 			err = svc.ProcessPipelineMessage(msg)
@@ -191,9 +193,10 @@ func TestShouldCopyOverDefaultFields(t *testing.T) {
 		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
 			return &ds, nil
 		},
-		StoreMeasurementFunc: func(contextMoqParam context.Context, measurement measurements.Measurement) error { return nil },
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error { return nil },
 	}
-	svc := measurements.New(store, 0, 1, authtest.JWKS())
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
 
 	// Act
 	err = svc.ProcessPipelineMessage(msg)
@@ -201,8 +204,8 @@ func TestShouldCopyOverDefaultFields(t *testing.T) {
 	// assert.NoError(t, svc.CommitBatch(true))
 
 	// Assert
-	require.Len(t, store.calls.StoreMeasurement, 1, "StoreMeasurements should've been called")
-	measurement := store.calls.StoreMeasurement[0].Measurement
+	require.Len(t, store.calls.StoreMeasurements, 1, "StoreMeasurements should've been called")
+	measurement := store.calls.StoreMeasurements[0].MeasurementsMoqParam[0]
 	assert.Equal(t, msg.TracingID, measurement.UplinkMessageID)
 	// assert.Equal(t, OrganisationName, measurement.OrganisationName)
 	// assert.Equal(t, OrganisationAddress, measurement.OrganisationAddress)
@@ -327,9 +330,10 @@ func TestShouldChooseMeasurementLocationOverDeviceLocation(t *testing.T) {
 				FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
 					return &ds, nil
 				},
-				StoreMeasurementFunc: func(contextMoqParam context.Context, measurement measurements.Measurement) error { return nil },
+				ListDerivedDatastreamsFunc: noDerivedDatastreams,
+				StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error { return nil },
 			}
-			svc := measurements.New(store, 0, 1, authtest.JWKS())
+			svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
 
 			// Act
 			require.NoError(t,
@@ -338,8 +342,8 @@ func TestShouldChooseMeasurementLocationOverDeviceLocation(t *testing.T) {
 			// assert.NoError(t, svc.CommitBatch(true))
 
 			// Assert
-			require.Len(t, store.calls.StoreMeasurement, 1, "StoreMeasurements should've been called")
-			measurement := store.calls.StoreMeasurement[0].Measurement
+			require.Len(t, store.calls.StoreMeasurements, 1, "StoreMeasurements should've been called")
+			measurement := store.calls.StoreMeasurements[0].MeasurementsMoqParam[0]
 			assert.Equal(t, tC.ExpectedLatitude, measurement.MeasurementLatitude)
 			assert.Equal(t, tC.ExpectedLongitude, measurement.MeasurementLongitude)
 			assert.Equal(t, tC.ExpectedAltitude, measurement.MeasurementAltitude)
@@ -407,9 +411,10 @@ func TestShouldSetExpirationDate(t *testing.T) {
 			FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
 				return &ds, nil
 			},
-			StoreMeasurementFunc: func(contextMoqParam context.Context, measurement measurements.Measurement) error { return nil },
+			ListDerivedDatastreamsFunc: noDerivedDatastreams,
+			StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error { return nil },
 		}
-		svc := measurements.New(store, sysArchiveTime, 1, authtest.JWKS())
+		svc := measurements.New(store, sysArchiveTime, 1, authtest.JWKS(), nil)
 
 		// Act
 		err = svc.ProcessPipelineMessage(msg)
@@ -417,8 +422,8 @@ func TestShouldSetExpirationDate(t *testing.T) {
 		// assert.NoError(t, svc.CommitBatch(true))
 
 		// Assert
-		require.Len(t, store.calls.StoreMeasurement, 1, "StoreMeasurements should've been called")
-		measurement := store.calls.StoreMeasurement[0].Measurement
+		require.Len(t, store.calls.StoreMeasurements, 1, "StoreMeasurements should've been called")
+		measurement := store.calls.StoreMeasurements[0].MeasurementsMoqParam[0]
 		// Check if the difference in seconds is 0, otherwise there might be a subsecond difference
 		// due to parsing
 		assert.Equal(t,
@@ -428,3 +433,55 @@ func TestShouldSetExpirationDate(t *testing.T) {
 		)
 	}
 }
+
+func TestListLatestMeasurementsShouldScopeToTenant(t *testing.T) {
+	store := &StoreMock{
+		ListLatestMeasurementsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+			return &pagination.Page[measurements.Measurement]{}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	_, err := svc.ListLatestMeasurements(authtest.GodContext(), measurements.DatastreamFilter{
+		ObservedProperty: []string{"temperature"},
+		TenantID:         []int64{999},
+	}, "", pagination.Request{})
+	require.NoError(t, err)
+
+	require.Len(t, store.calls.ListLatestMeasurements, 1)
+	filter := store.calls.ListLatestMeasurements[0].DatastreamFilter
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, filter.TenantID)
+	assert.Equal(t, []string{"temperature"}, filter.ObservedProperty)
+}
+
+func TestShouldSetDiscriminatorFromMeasurementProperties(t *testing.T) {
+	store := newBatchTestStore(func([]measurements.Measurement) error { return nil })
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	msg := newStorableMessage(t)
+	for _, discriminator := range []any{nil, "channel-a", 1234567.0} {
+		properties := map[string]any{}
+		if discriminator != nil {
+			properties[measurements.DiscriminatorProperty] = discriminator
+		}
+		require.NoError(t, msg.NewMeasurement().SetValue(1, "obs", "1").SetSensor("sensor").SetMetadata(properties).Add())
+	}
+
+	require.NoError(t, svc.ProcessPipelineMessage(msg))
+
+	require.Len(t, store.calls.StoreMeasurements, 1)
+	stored := store.calls.StoreMeasurements[0].MeasurementsMoqParam
+	require.Len(t, stored, 3)
+	assert.Equal(t, "", stored[0].MeasurementDiscriminator)
+	assert.Equal(t, "channel-a", stored[1].MeasurementDiscriminator)
+	assert.Equal(t, "1234567", stored[2].MeasurementDiscriminator)
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, policy := range []string{"ignore", "overwrite", "keep"} {
+		parsed, err := measurements.ParseConflictPolicy(policy)
+		require.NoError(t, err)
+		assert.Equal(t, measurements.ConflictPolicy(policy), parsed)
+	}
+	_, err := measurements.ParseConflictPolicy("merge")
+	assert.ErrorIs(t, err, measurements.ErrConflictPolicyInvalid)
+}
@@ -0,0 +1,127 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrMeasurementsNotCommitted indicates the measurements of a pipeline message were not stored,
+	// processing the message again might succeed
+	ErrMeasurementsNotCommitted = errors.New("measurements were not committed")
+	ErrBatchStorerStopped       = errors.New("measurement batch storer is stopped")
+)
+
+type batchRequest struct {
+	measurements []Measurement
+	done         chan error
+}
+
+// measurementBatcher combines the measurements of concurrently processed pipeline messages
+// into a single store call. Each caller is informed whether its measurements were committed.
+type measurementBatcher struct {
+	store    Store
+	size     int
+	requests chan batchRequest
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newMeasurementBatcher(store Store, size int) *measurementBatcher {
+	return &measurementBatcher{
+		store:    store,
+		size:     max(size, 1),
+		requests: make(chan batchRequest),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// commit adds measurements to the current batch and blocks until the batch is committed
+func (b *measurementBatcher) commit(measurements []Measurement) error {
+	req := batchRequest{
+		measurements: measurements,
+		done:         make(chan error, 1),
+	}
+	select {
+	case b.requests <- req:
+	case <-b.stop:
+		return ErrBatchStorerStopped
+	}
+	return <-req.done
+}
+
+func (b *measurementBatcher) run(interval time.Duration) {
+	log.Println("Measurement service batch storer started")
+	defer log.Println("Measurement service batch storer stopped!")
+	defer close(b.done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	pending := []batchRequest{}
+	count := 0
+	flush := func() {
+		if len(pending) > 0 {
+			b.flush(pending, count)
+		}
+		pending = pending[:0]
+		count = 0
+	}
+
+	for {
+		select {
+		case <-b.stop:
+			flush()
+			return
+		case req := <-b.requests:
+			pending = append(pending, req)
+			count += len(req.measurements)
+			if count >= b.size {
+				flush()
+			}
+		case <-t.C:
+			flush()
+		}
+	}
+}
+
+// flush stores all pending measurements at once. If that fails, the requests are stored
+// one by one so that a single faulty pipeline message does not fail the others.
+func (b *measurementBatcher) flush(pending []batchRequest, count int) {
+	batch := make([]Measurement, 0, count)
+	for _, req := range pending {
+		batch = append(batch, req.measurements...)
+	}
+
+	err := b.store.StoreMeasurements(context.Background(), batch)
+	if err == nil || len(pending) == 1 {
+		offset := 0
+		for _, req := range pending {
+			if err == nil {
+				// Inform the caller which of its measurements were stored
+				copy(req.measurements, batch[offset:offset+len(req.measurements)])
+			}
+			offset += len(req.measurements)
+			req.done <- err
+		}
+		return
+	}
+
+	log.Printf("Committing batch of %d measurements failed, retrying per message: %s\n", count, err.Error())
+	for _, req := range pending {
+		req.done <- b.store.StoreMeasurements(context.Background(), req.measurements)
+	}
+}
+
+func (b *measurementBatcher) shutdown(ctx context.Context) error {
+	close(b.stop)
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package measurements_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/pkg/pipeline"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func newStorableMessage(t *testing.T, values ...float64) pipeline.Message {
+	msg := newPipelineMessage(uuid.NewString(), []string{})
+	msg.AccessToken = authtest.CreateToken()
+	msg.Device = &pipeline.Device{
+		ID:       1,
+		Code:     "device",
+		TenantID: authtest.DefaultTenantID,
+		Sensors: []devices.Sensor{
+			{ID: 1, Code: "sensor", ExternalID: "sensor", Properties: json.RawMessage("{}")},
+		},
+		Properties: json.RawMessage("{}"),
+	}
+	for _, value := range values {
+		require.NoError(t, msg.NewMeasurement().SetValue(value, "obs", "1").SetSensor("sensor").Add())
+	}
+	return msg
+}
+
+func newBatchTestStore(storeFunc func([]measurements.Measurement) error) *StoreMock {
+	return &StoreMock{
+		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: uuid.New()}, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return storeFunc(measurementsMoqParam)
+		},
+	}
+}
+
+// processConcurrently processes each message in its own goroutine and waits until all are processed
+func processConcurrently(svc *measurements.Service, msgs ...pipeline.Message) []error {
+	errs := make([]error, len(msgs))
+	var wg sync.WaitGroup
+	for ix, msg := range msgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[ix] = svc.ProcessPipelineMessage(msg)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestBatchStorerShouldCombineMessagesUpToBatchSize(t *testing.T) {
+	store := newBatchTestStore(func(list []measurements.Measurement) error {
+		return storeAll(context.Background(), list)
+	})
+	svc := measurements.New(store, 0, 4, authtest.JWKS(), nil)
+	var mu sync.Mutex
+	committed := 0
+	svc.WithMeasurementListener(listenerFunc(func(batch []measurements.Measurement) {
+		mu.Lock()
+		defer mu.Unlock()
+		committed += len(batch)
+	}))
+	shutdown := svc.StartMeasurementBatchStorer(time.Hour)
+	defer shutdown(context.Background()) //nolint:errcheck
+
+	errs := processConcurrently(svc,
+		newStorableMessage(t, 1, 2),
+		newStorableMessage(t, 3, 4),
+	)
+
+	assert.NoError(t, errors.Join(errs...))
+	require.Len(t, store.StoreMeasurementsCalls(), 1, "measurements should be stored in a single batch")
+	assert.Len(t, store.StoreMeasurementsCalls()[0].MeasurementsMoqParam, 4)
+	assert.Equal(t, 4, committed, "every message should learn its measurements were stored")
+}
+
+func TestBatchStorerShouldCommitOnInterval(t *testing.T) {
+	store := newBatchTestStore(func([]measurements.Measurement) error { return nil })
+	svc := measurements.New(store, 0, 1024, authtest.JWKS(), nil)
+	shutdown := svc.StartMeasurementBatchStorer(10 * time.Millisecond)
+	defer shutdown(context.Background()) //nolint:errcheck
+
+	err := svc.ProcessPipelineMessage(newStorableMessage(t, 1))
+
+	assert.NoError(t, err)
+	assert.Len(t, store.StoreMeasurementsCalls(), 1)
+}
+
+func TestBatchStorerShouldOnlyFailFaultyMessage(t *testing.T) {
+	store := newBatchTestStore(func(list []measurements.Measurement) error {
+		for _, m := range list {
+			if m.MeasurementValue == 13 {
+				return errors.New("database error")
+			}
+		}
+		return nil
+	})
+	svc := measurements.New(store, 0, 3, authtest.JWKS(), nil)
+	shutdown := svc.StartMeasurementBatchStorer(time.Hour)
+	defer shutdown(context.Background()) //nolint:errcheck
+
+	errs := processConcurrently(svc,
+		newStorableMessage(t, 1, 2),
+		newStorableMessage(t, 13),
+	)
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+			assert.ErrorIs(t, err, measurements.ErrMeasurementsNotCommitted)
+		}
+	}
+	assert.Equal(t, 1, failed, "only the faulty message should fail")
+	// One batch attempt and two retries
+	assert.Len(t, store.StoreMeasurementsCalls(), 3)
+}
+
+func TestBatchStorerShouldRejectMessagesAfterShutdown(t *testing.T) {
+	store := newBatchTestStore(func([]measurements.Measurement) error { return nil })
+	svc := measurements.New(store, 0, 1024, authtest.JWKS(), nil)
+	shutdown := svc.StartMeasurementBatchStorer(time.Hour)
+	require.NoError(t, shutdown(context.Background()))
+
+	err := svc.ProcessPipelineMessage(newStorableMessage(t, 1))
+
+	assert.ErrorIs(t, err, measurements.ErrMeasurementsNotCommitted)
+	assert.ErrorIs(t, err, measurements.ErrBatchStorerStopped)
+	assert.Empty(t, store.StoreMeasurementsCalls())
+}
@@ -0,0 +1,300 @@
+package measurements
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+const (
+	// DefaultCompletenessRange is the time range of a completeness report without start time
+	DefaultCompletenessRange = 7 * 24 * time.Hour
+	// MaxCompletenessRange limits the time range of a single completeness report
+	MaxCompletenessRange = 366 * 24 * time.Hour
+	// ReportingIntervalSamples is the amount of most recent measurements the reporting interval is learned from
+	ReportingIntervalSamples = 100
+	// GapFactor is the factor of the reporting interval after which a missing measurement counts as a gap
+	GapFactor = 1.5
+	// MaxGaps limits the amount of gaps returned for a single datastream
+	MaxGaps = 1000
+	// DefaultWorstDatastreams is the amount of datastreams in a completeness summary without limit
+	DefaultWorstDatastreams = 10
+	// MaxWorstDatastreams limits the amount of datastreams in a completeness summary
+	MaxWorstDatastreams = 100
+)
+
+var (
+	ErrCompletenessRangeInvalid    = web.NewError(http.StatusBadRequest, fmt.Sprintf("Completeness requires a start before the end and a range of at most %d days", int(MaxCompletenessRange.Hours()/24)), "ERR_COMPLETENESS_RANGE_INVALID")
+	ErrReportingIntervalUnknown    = web.NewError(http.StatusBadRequest, "Datastream has too few measurements to learn its reporting interval, provide the expected interval", "ERR_REPORTING_INTERVAL_UNKNOWN")
+	ErrCompletenessIntervalInvalid = web.NewError(http.StatusBadRequest, "Expected interval must be at least one second, for example 10m or 1h", "ERR_COMPLETENESS_INTERVAL_INVALID")
+)
+
+// ReportingStats describes how a datastream reported in a time range
+type ReportingStats struct {
+	DatastreamID     uuid.UUID
+	SensorID         int64
+	ObservedProperty string
+	// LastSeen is the timestamp of the most recent measurement, regardless of the time range
+	LastSeen *time.Time
+	// LearnedInterval is the median time between the most recent measurements up to the end of the range
+	LearnedInterval *time.Duration
+	// Received is the amount of measurements in the time range, counted from the hourly rollups for the whole hours
+	// in the range so it includes measurements of which the raw data expired
+	Received int
+}
+
+// DailyCount is the amount of measurements of a datastream on a day in UTC
+type DailyCount struct {
+	Day   time.Time
+	Count int
+	First time.Time
+	Last  time.Time
+}
+
+// Gap is a period in which a datastream did not report while it was expected to
+type Gap struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+func newGap(start, end time.Time) Gap {
+	return Gap{Start: start, End: end, DurationSeconds: int64(end.Sub(start).Seconds())}
+}
+
+type DailyCompleteness struct {
+	Day          time.Time `json:"day"`
+	Expected     int       `json:"expected"`
+	Received     int       `json:"received"`
+	Completeness float64   `json:"completeness"`
+}
+
+// Completeness compares the received measurements of a datastream with the expected reporting interval.
+// Completeness is a percentage, where receiving more measurements than expected counts as complete.
+type Completeness struct {
+	DatastreamID            uuid.UUID           `json:"datastream_id"`
+	Start                   time.Time           `json:"start"`
+	End                     time.Time           `json:"end"`
+	ExpectedIntervalSeconds float64             `json:"expected_interval_seconds"`
+	ExpectedIntervalLearned bool                `json:"expected_interval_learned"`
+	LastSeen                *time.Time          `json:"last_seen"`
+	Expected                int                 `json:"expected"`
+	Received                int                 `json:"received"`
+	Completeness            float64             `json:"completeness"`
+	Days                    []DailyCompleteness `json:"days"`
+	Gaps                    []Gap               `json:"gaps"`
+}
+
+// CompletenessSummary is the completeness of a datastream without the daily breakdown and gaps
+type CompletenessSummary struct {
+	DatastreamID            uuid.UUID  `json:"datastream_id"`
+	SensorID                int64      `json:"sensor_id"`
+	ObservedProperty        string     `json:"observed_property"`
+	ExpectedIntervalSeconds float64    `json:"expected_interval_seconds"`
+	LastSeen                *time.Time `json:"last_seen"`
+	Expected                int        `json:"expected"`
+	Received                int        `json:"received"`
+	Completeness            float64    `json:"completeness"`
+}
+
+type CompletenessOptions struct {
+	Start time.Time
+	End   time.Time
+	// ExpectedInterval is the interval the datastream should report at, if zero it is learned from the
+	// most recent measurements
+	ExpectedInterval time.Duration
+	// Limit is the amount of datastreams in a summary
+	Limit int
+}
+
+// resolveRange defaults the time range to the last week and limits the end to now, since measurements
+// can not be expected in the future
+func (opts *CompletenessOptions) resolveRange(now time.Time) error {
+	if opts.End.IsZero() || opts.End.After(now) {
+		opts.End = now
+	}
+	if opts.Start.IsZero() {
+		opts.Start = opts.End.Add(-DefaultCompletenessRange)
+	}
+	if !opts.Start.Before(opts.End) || opts.End.Sub(opts.Start) > MaxCompletenessRange {
+		return ErrCompletenessRangeInvalid
+	}
+	return nil
+}
+
+// expectedCount is the amount of measurements expected in the duration when reporting at the interval
+func expectedCount(d, interval time.Duration) int {
+	return int(math.Floor(float64(d) / float64(interval)))
+}
+
+func completeness(received, expected int) float64 {
+	if expected <= 0 || received >= expected {
+		return 100
+	}
+	return math.Round(float64(received)/float64(expected)*10000) / 100
+}
+
+// GetDatastreamCompleteness reports the completeness per day and the gaps of a datastream
+func (s *Service) GetDatastreamCompleteness(ctx context.Context, id uuid.UUID, opts CompletenessOptions) (*Completeness, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.resolveRange(time.Now()); err != nil {
+		return nil, err
+	}
+	if opts.ExpectedInterval != 0 && opts.ExpectedInterval < time.Second {
+		return nil, ErrCompletenessIntervalInvalid
+	}
+
+	stats, err := s.store.ListReportingStats(ctx, tenantID, []uuid.UUID{id}, opts.Start, opts.End)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return nil, ErrDatastreamNotFound
+	}
+
+	report := Completeness{
+		DatastreamID:            id,
+		Start:                   opts.Start,
+		End:                     opts.End,
+		ExpectedIntervalLearned: opts.ExpectedInterval == 0,
+		LastSeen:                stats[0].LastSeen,
+		Received:                stats[0].Received,
+	}
+	interval := opts.ExpectedInterval
+	if interval == 0 {
+		if stats[0].LearnedInterval == nil {
+			return nil, ErrReportingIntervalUnknown
+		}
+		interval = *stats[0].LearnedInterval
+	}
+	report.ExpectedIntervalSeconds = interval.Seconds()
+	report.Expected = expectedCount(opts.End.Sub(opts.Start), interval)
+	report.Completeness = completeness(report.Received, report.Expected)
+
+	counts, err := s.store.ListDailyCounts(ctx, id, opts.Start, opts.End)
+	if err != nil {
+		return nil, err
+	}
+	report.Days = dailyCompleteness(counts, opts.Start, opts.End, interval)
+
+	threshold := time.Duration(float64(interval) * GapFactor)
+	gaps, err := s.store.ListGaps(ctx, id, opts.Start, opts.End, threshold, MaxGaps)
+	if err != nil {
+		return nil, err
+	}
+	report.Gaps = edgeGaps(gaps, counts, opts.Start, opts.End, threshold)
+	return &report, nil
+}
+
+// dailyCompleteness returns the completeness of every day in the time range. The first and last day
+// only expect measurements for the part of the day within the time range.
+func dailyCompleteness(counts []DailyCount, start, end time.Time, interval time.Duration) []DailyCompleteness {
+	days := []DailyCompleteness{}
+	ix := 0
+	for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+		from, to := maxTime(day, start), minTime(day.Add(24*time.Hour), end)
+		d := DailyCompleteness{Day: day, Expected: expectedCount(to.Sub(from), interval)}
+		if ix < len(counts) && counts[ix].Day.Equal(day) {
+			d.Received = counts[ix].Count
+			ix++
+		}
+		d.Completeness = completeness(d.Received, d.Expected)
+		days = append(days, d)
+	}
+	return days
+}
+
+// edgeGaps adds the gaps between the start of the range and the first measurement and between the last
+// measurement and the end of the range to the gaps between measurements
+func edgeGaps(gaps []Gap, counts []DailyCount, start, end time.Time, threshold time.Duration) []Gap {
+	if len(counts) == 0 {
+		return []Gap{newGap(start, end)}
+	}
+	first, last := counts[0].First, counts[len(counts)-1].Last
+	if first.Sub(start) > threshold {
+		gaps = slices.Insert(gaps, 0, newGap(start, first))
+	}
+	if end.Sub(last) > threshold && len(gaps) < MaxGaps {
+		gaps = append(gaps, newGap(last, end))
+	}
+	return gaps
+}
+
+// ListWorstDatastreams returns the datastreams of the tenant with the lowest completeness, datastreams that
+// stopped reporting the longest ago come first. The reporting interval of every datastream is learned, so
+// datastreams with fewer than two measurements are not included.
+func (s *Service) ListWorstDatastreams(ctx context.Context, opts CompletenessOptions) ([]CompletenessSummary, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.resolveRange(time.Now()); err != nil {
+		return nil, err
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultWorstDatastreams
+	}
+	opts.Limit = min(opts.Limit, MaxWorstDatastreams)
+
+	stats, err := s.store.ListReportingStats(ctx, tenantID, nil, opts.Start, opts.End)
+	if err != nil {
+		return nil, err
+	}
+	summaries := []CompletenessSummary{}
+	for _, stat := range stats {
+		if stat.LearnedInterval == nil {
+			continue
+		}
+		expected := expectedCount(opts.End.Sub(opts.Start), *stat.LearnedInterval)
+		summaries = append(summaries, CompletenessSummary{
+			DatastreamID:            stat.DatastreamID,
+			SensorID:                stat.SensorID,
+			ObservedProperty:        stat.ObservedProperty,
+			ExpectedIntervalSeconds: stat.LearnedInterval.Seconds(),
+			LastSeen:                stat.LastSeen,
+			Expected:                expected,
+			Received:                stat.Received,
+			Completeness:            completeness(stat.Received, expected),
+		})
+	}
+	slices.SortStableFunc(summaries, func(a, b CompletenessSummary) int {
+		if c := cmp.Compare(a.Completeness, b.Completeness); c != 0 {
+			return c
+		}
+		return lo.FromPtr(a.LastSeen).Compare(lo.FromPtr(b.LastSeen))
+	})
+	return summaries[:min(len(summaries), opts.Limit)], nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
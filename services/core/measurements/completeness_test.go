@@ -0,0 +1,131 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestGetDatastreamCompletenessShouldReportDaysAndGaps(t *testing.T) {
+	id := uuid.New()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	store := &StoreMock{
+		ListReportingStatsFunc: func(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start, end time.Time) ([]measurements.ReportingStats, error) {
+			return []measurements.ReportingStats{{
+				DatastreamID:    id,
+				LastSeen:        ptr(end.Add(-19 * time.Hour)),
+				LearnedInterval: ptr(time.Hour),
+				Received:        28,
+			}}, nil
+		},
+		ListDailyCountsFunc: func(ctx context.Context, datastreamID uuid.UUID, start, end time.Time) ([]measurements.DailyCount, error) {
+			return []measurements.DailyCount{
+				{Day: start, Count: 22, First: start.Add(2 * time.Hour), Last: start.Add(23 * time.Hour)},
+				{Day: start.Add(24 * time.Hour), Count: 6, First: start.Add(24 * time.Hour), Last: start.Add(29 * time.Hour)},
+			}, nil
+		},
+		ListGapsFunc: func(ctx context.Context, datastreamID uuid.UUID, start, end time.Time, threshold time.Duration, limit int) ([]measurements.Gap, error) {
+			return []measurements.Gap{}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil)
+
+	report, err := svc.GetDatastreamCompleteness(authtest.GodContext(), id, measurements.CompletenessOptions{Start: start, End: end})
+	require.NoError(t, err)
+
+	assert.True(t, report.ExpectedIntervalLearned)
+	assert.Equal(t, 3600.0, report.ExpectedIntervalSeconds)
+	assert.Equal(t, 48, report.Expected)
+	assert.Equal(t, 28, report.Received)
+	assert.Equal(t, 58.33, report.Completeness)
+	assert.Equal(t, []measurements.DailyCompleteness{
+		{Day: start, Expected: 24, Received: 22, Completeness: 91.67},
+		{Day: start.Add(24 * time.Hour), Expected: 24, Received: 6, Completeness: 25},
+	}, report.Days)
+	assert.Equal(t, []measurements.Gap{
+		{Start: start, End: start.Add(2 * time.Hour), DurationSeconds: 7200},
+		{Start: start.Add(29 * time.Hour), End: end, DurationSeconds: 19 * 3600},
+	}, report.Gaps)
+
+	require.Len(t, store.ListGapsCalls(), 1)
+	assert.Equal(t, 90*time.Minute, store.ListGapsCalls()[0].Threshold)
+	require.Len(t, store.ListReportingStatsCalls(), 1)
+	assert.Equal(t, authtest.DefaultTenantID, store.ListReportingStatsCalls()[0].TenantID)
+}
+
+func TestGetDatastreamCompletenessShouldRequireInterval(t *testing.T) {
+	id := uuid.New()
+	store := &StoreMock{
+		ListReportingStatsFunc: func(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start, end time.Time) ([]measurements.ReportingStats, error) {
+			return []measurements.ReportingStats{{DatastreamID: id}}, nil
+		},
+		ListDailyCountsFunc: func(ctx context.Context, datastreamID uuid.UUID, start, end time.Time) ([]measurements.DailyCount, error) {
+			return nil, nil
+		},
+		ListGapsFunc: func(ctx context.Context, datastreamID uuid.UUID, start, end time.Time, threshold time.Duration, limit int) ([]measurements.Gap, error) {
+			return []measurements.Gap{}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil)
+
+	_, err := svc.GetDatastreamCompleteness(authtest.GodContext(), id, measurements.CompletenessOptions{})
+	assert.ErrorIs(t, err, measurements.ErrReportingIntervalUnknown)
+
+	// A datastream that never reported is one gap
+	report, err := svc.GetDatastreamCompleteness(authtest.GodContext(), id, measurements.CompletenessOptions{
+		ExpectedInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.False(t, report.ExpectedIntervalLearned)
+	assert.Equal(t, 0.0, report.Completeness)
+	assert.Equal(t, measurements.DefaultCompletenessRange, report.End.Sub(report.Start))
+	require.Len(t, report.Gaps, 1)
+	assert.Equal(t, report.Start, report.Gaps[0].Start)
+
+	_, err = svc.GetDatastreamCompleteness(authtest.GodContext(), id, measurements.CompletenessOptions{
+		ExpectedInterval: time.Millisecond,
+	})
+	assert.ErrorIs(t, err, measurements.ErrCompletenessIntervalInvalid)
+
+	_, err = svc.GetDatastreamCompleteness(authtest.GodContext(), id, measurements.CompletenessOptions{
+		Start: time.Now().Add(-400 * 24 * time.Hour),
+	})
+	assert.ErrorIs(t, err, measurements.ErrCompletenessRangeInvalid)
+}
+
+func TestListWorstDatastreamsShouldOrderByCompleteness(t *testing.T) {
+	now := time.Now()
+	healthy, intermittent, silent, silentLonger, unknown := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	store := &StoreMock{
+		ListReportingStatsFunc: func(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start, end time.Time) ([]measurements.ReportingStats, error) {
+			return []measurements.ReportingStats{
+				{DatastreamID: healthy, LastSeen: ptr(now), LearnedInterval: ptr(time.Hour), Received: 168},
+				{DatastreamID: silent, LastSeen: ptr(now.Add(-10 * 24 * time.Hour)), LearnedInterval: ptr(time.Hour)},
+				{DatastreamID: intermittent, LastSeen: ptr(now), LearnedInterval: ptr(time.Hour), Received: 84},
+				{DatastreamID: silentLonger, LastSeen: ptr(now.Add(-30 * 24 * time.Hour)), LearnedInterval: ptr(time.Hour)},
+				{DatastreamID: unknown, LastSeen: ptr(now)},
+			}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil)
+
+	summaries, err := svc.ListWorstDatastreams(authtest.GodContext(), measurements.CompletenessOptions{Limit: 3})
+	require.NoError(t, err)
+
+	require.Len(t, summaries, 3)
+	assert.Equal(t, silentLonger, summaries[0].DatastreamID)
+	assert.Equal(t, silent, summaries[1].DatastreamID)
+	assert.Equal(t, intermittent, summaries[2].DatastreamID)
+	assert.Equal(t, 168, summaries[2].Expected)
+	assert.Equal(t, 50.0, summaries[2].Completeness)
+	require.Len(t, store.ListReportingStatsCalls(), 1)
+	assert.Empty(t, store.ListReportingStatsCalls()[0].DatastreamIDs)
+}
@@ -0,0 +1,269 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+const (
+	// MaxCorrectionRange limits the time range of a single correction
+	MaxCorrectionRange = 31 * 24 * time.Hour
+	// MaxCorrectedMeasurements limits the amount of measurements a single correction may change, including the
+	// measurements of derived datastreams that are recalculated
+	MaxCorrectedMeasurements = 100000
+)
+
+var (
+	ErrCorrectionInvalid  = web.NewError(http.StatusBadRequest, "Measurement correction is invalid", "ERR_CORRECTION_INVALID")
+	ErrCorrectionTooLarge = web.NewError(http.StatusBadRequest, fmt.Sprintf("Correction would change more than %d measurements, decrease the time range", MaxCorrectedMeasurements), "ERR_CORRECTION_TOO_LARGE")
+)
+
+type CorrectionAction string
+
+const (
+	// CorrectionDelete removes the measurements in the range
+	CorrectionDelete CorrectionAction = "delete"
+	// CorrectionOverwrite changes the values of the measurements in the range
+	CorrectionOverwrite CorrectionAction = "overwrite"
+)
+
+// CorrectionRange selects the measurements of a datastream to correct, both start and end are inclusive.
+// A reason is required as it is recorded in the audit trail.
+type CorrectionRange struct {
+	Start  time.Time `json:"start" url:"start"`
+	End    time.Time `json:"end" url:"end"`
+	Reason string    `json:"reason" url:"reason"`
+}
+
+func (r CorrectionRange) Validate() error {
+	if r.Start.IsZero() || r.End.IsZero() {
+		return errors.New("start and end are required")
+	}
+	if r.End.Before(r.Start) {
+		return errors.New("end must not be before start")
+	}
+	if r.End.Sub(r.Start) > MaxCorrectionRange {
+		return fmt.Errorf("range must not exceed %d days", int(MaxCorrectionRange.Hours()/24))
+	}
+	if r.Reason == "" {
+		return errors.New("reason is required")
+	}
+	return nil
+}
+
+// OverwriteMeasurementsOpts overwrites the measurement values in a range. Either a fixed value is set,
+// or the values are recalculated as value * factor + offset, for example to correct a calibration error.
+type OverwriteMeasurementsOpts struct {
+	CorrectionRange
+	Value  *float64 `json:"value"`
+	Factor *float64 `json:"factor"`
+	Offset *float64 `json:"offset"`
+}
+
+func (opts OverwriteMeasurementsOpts) Validate() error {
+	if err := opts.CorrectionRange.Validate(); err != nil {
+		return err
+	}
+	if opts.Value == nil && opts.Factor == nil && opts.Offset == nil {
+		return errors.New("either value or factor and offset are required")
+	}
+	if opts.Value != nil && (opts.Factor != nil || opts.Offset != nil) {
+		return errors.New("value can not be combined with factor or offset")
+	}
+	for _, v := range []*float64{opts.Value, opts.Factor, opts.Offset} {
+		if v != nil && (math.IsNaN(*v) || math.IsInf(*v, 0)) {
+			return errors.New("value, factor and offset must be finite numbers")
+		}
+	}
+	return nil
+}
+
+// Correction is the audit record of measurements that were deleted or overwritten after ingestion.
+// Overwritten measurements refer to their correction through their correction id, replaying them with the
+// overwrite conflict policy does not revert the correction. Deleted measurements are not remembered, a replay
+// stores them again. The measurements of derived datastreams are recalculated from the corrected measurements
+// together with the correction.
+// PerformedBy is the user, or "tenant:<id>" if the correction was made with an API key of the tenant.
+type Correction struct {
+	ID           int64            `json:"id"`
+	DatastreamID uuid.UUID        `json:"datastream_id"`
+	Action       CorrectionAction `json:"action"`
+	Start        time.Time        `json:"start"`
+	End          time.Time        `json:"end"`
+	Reason       string           `json:"reason"`
+	Value        *float64         `json:"value,omitempty"`
+	Factor       *float64         `json:"factor,omitempty"`
+	Offset       *float64         `json:"offset,omitempty"`
+	PerformedBy  string           `json:"performed_by"`
+	PerformedAt  time.Time        `json:"performed_at"`
+	// Original holds the measurements as they were before the correction
+	Original []OriginalMeasurement `json:"original_measurements"`
+	TenantID int64                 `json:"-"`
+}
+
+type OriginalMeasurement struct {
+	ID        int64       `json:"measurement_id"`
+	Timestamp time.Time   `json:"measurement_timestamp"`
+	Value     float64     `json:"measurement_value"`
+	Quality   QualityFlag `json:"measurement_quality"`
+}
+
+// DeleteMeasurements deletes the measurements of a datastream within the range
+func (s *Service) DeleteMeasurements(ctx context.Context, datastreamID uuid.UUID, r CorrectionRange) (*Correction, error) {
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrectionInvalid, err)
+	}
+	correction, err := s.newCorrection(ctx, datastreamID, CorrectionDelete, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyCorrection(ctx, correction); err != nil {
+		return nil, err
+	}
+	return correction, nil
+}
+
+// OverwriteMeasurements overwrites the values of the measurements of a datastream within the range
+func (s *Service) OverwriteMeasurements(ctx context.Context, datastreamID uuid.UUID, opts OverwriteMeasurementsOpts) (*Correction, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrectionInvalid, err)
+	}
+	correction, err := s.newCorrection(ctx, datastreamID, CorrectionOverwrite, opts.CorrectionRange)
+	if err != nil {
+		return nil, err
+	}
+	correction.Value = opts.Value
+	correction.Factor = opts.Factor
+	correction.Offset = opts.Offset
+	if err := s.applyCorrection(ctx, correction); err != nil {
+		return nil, err
+	}
+	return correction, nil
+}
+
+func (s *Service) newCorrection(ctx context.Context, datastreamID uuid.UUID, action CorrectionAction, r CorrectionRange) (*Correction, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := s.store.GetDatastream(ctx, datastreamID, DatastreamFilter{TenantID: []int64{tenantID}})
+	if err != nil {
+		return nil, err
+	}
+	return &Correction{
+		DatastreamID: ds.ID,
+		Action:       action,
+		Start:        r.Start,
+		End:          r.End,
+		Reason:       r.Reason,
+		PerformedBy:  correctionActor(ctx, tenantID),
+		PerformedAt:  time.Now(),
+		TenantID:     tenantID,
+	}, nil
+}
+
+// correctionActor returns the user performing a correction. API keys do not belong to a user, in which case the
+// tenant of the key is the actor.
+func correctionActor(ctx context.Context, tenantID int64) string {
+	if user, err := auth.GetUser(ctx); err == nil {
+		return user
+	}
+	return fmt.Sprintf("tenant:%d", tenantID)
+}
+
+// Recalculation replaces the measurements of a derived datastream after a correction of one of its sources. Its
+// correction deletes the derived measurements in the range, which are replaced by the recalculated measurements.
+type Recalculation struct {
+	Correction   *Correction
+	Measurements []Measurement
+}
+
+// correct returns the measurement as it is after the correction, or false if the correction deletes it
+func (c *Correction) correct(m Measurement) (Measurement, bool) {
+	if m.DatastreamID != c.DatastreamID || m.MeasurementTimestamp.Before(c.Start) || m.MeasurementTimestamp.After(c.End) {
+		return m, true
+	}
+	if c.Action == CorrectionDelete {
+		return m, false
+	}
+	if c.Value != nil {
+		m.MeasurementValue = *c.Value
+		return m, true
+	}
+	m.MeasurementValue = m.MeasurementValue*lo.FromPtrOr(c.Factor, 1) + lo.FromPtr(c.Offset)
+	return m, true
+}
+
+// applyCorrection applies the correction and recalculates the measurements derived from the corrected datastream.
+// A derived measurement depends on source measurements up to the tolerance of its derivation before it, so the
+// derived range is extended by the tolerance. The derived measurements in that range are deleted through a correction
+// of their own, as the conflict policy might otherwise keep the stale values, and derived again from the source
+// measurements as they are after the correction. The store applies the correction and its recalculations at once, so
+// derived datastreams never keep values of measurements that were corrected.
+func (s *Service) applyCorrection(ctx context.Context, correction *Correction) error {
+	list, err := s.store.ListDerivedDatastreams(ctx, []uuid.UUID{correction.DatastreamID})
+	if err != nil {
+		return fmt.Errorf("could not get derived datastreams of the corrected datastream: %w", err)
+	}
+	recalculations := make([]Recalculation, 0, len(list))
+	for _, derived := range list {
+		r := BackfillRange{
+			Start: correction.Start,
+			End:   correction.End.Add(time.Duration(derived.Derivation.ToleranceSeconds) * time.Second),
+		}
+		recalculation := Recalculation{
+			Correction: &Correction{
+				DatastreamID: derived.ID,
+				Action:       CorrectionDelete,
+				Start:        r.Start,
+				End:          r.End,
+				Reason:       fmt.Sprintf("recalculated after correction of source datastream %s: %s", correction.DatastreamID, correction.Reason),
+				PerformedBy:  correction.PerformedBy,
+				PerformedAt:  correction.PerformedAt,
+				TenantID:     correction.TenantID,
+			},
+		}
+		err := s.deriveRange(ctx, correction.TenantID, derived, r, correction, func(m Measurement) error {
+			if len(recalculation.Measurements) == MaxCorrectedMeasurements {
+				return ErrCorrectionTooLarge
+			}
+			recalculation.Measurements = append(recalculation.Measurements, m)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not recalculate derived datastream %s: %w", derived.ID, err)
+		}
+		recalculations = append(recalculations, recalculation)
+	}
+	return s.store.ApplyCorrection(ctx, correction, recalculations)
+}
+
+// ListCorrections returns the corrections made to the measurements of a datastream, most recent first
+func (s *Service) ListCorrections(ctx context.Context, datastreamID uuid.UUID, r pagination.Request) (*pagination.Page[Correction], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := s.store.GetDatastream(ctx, datastreamID, DatastreamFilter{TenantID: []int64{tenantID}})
+	if err != nil {
+		return nil, err
+	}
+	return s.store.ListCorrections(ctx, ds.ID, r)
+}
@@ -0,0 +1,218 @@
+package measurements_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestDeleteMeasurementsShouldRecordCorrection(t *testing.T) {
+	ds := measurements.Datastream{ID: uuid.New()}
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &ds, nil
+		},
+		ApplyCorrectionFunc: func(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+			correction.ID = 5
+			return nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	correction, err := svc.DeleteMeasurements(authtest.GodContext(), ds.ID, measurements.CorrectionRange{
+		Start:  start,
+		End:    start.Add(time.Hour),
+		Reason: "sensor was out of the water",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, store.GetDatastreamCalls()[0].Filter.TenantID)
+	require.Len(t, store.ApplyCorrectionCalls(), 1)
+	assert.Equal(t, int64(5), correction.ID)
+	assert.Equal(t, measurements.CorrectionDelete, correction.Action)
+	assert.Equal(t, ds.ID, correction.DatastreamID)
+	assert.Equal(t, authtest.DefaultTenantID, correction.TenantID)
+	assert.Equal(t, authtest.DefaultSub, correction.PerformedBy)
+	assert.Equal(t, "sensor was out of the water", correction.Reason)
+	assert.False(t, correction.PerformedAt.IsZero())
+}
+
+func TestCorrectionWithAPIKeyShouldBePerformedByTenant(t *testing.T) {
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: id}, nil
+		},
+		ApplyCorrectionFunc: func(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+			return nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	ctx := auth.CreateAuthenticatedContextForTESTING(context.Background(), "", authtest.DefaultTenantID, auth.Permissions{auth.WRITE_MEASUREMENTS})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	correction, err := svc.DeleteMeasurements(ctx, uuid.New(), measurements.CorrectionRange{Start: start, End: start, Reason: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("tenant:%d", authtest.DefaultTenantID), correction.PerformedBy)
+}
+
+func TestCorrectionsShouldRecalculateDerivedMeasurements(t *testing.T) {
+	sourceID := uuid.New()
+	derived := measurements.DerivedDatastream{
+		Datastream: measurements.Datastream{ID: uuid.New(), SensorID: 11, TenantID: authtest.DefaultTenantID},
+		Derivation: measurements.Derivation{
+			Expression:       "level * 2",
+			Sources:          []measurements.DerivationSource{{Variable: "level", DatastreamID: sourceID}},
+			ToleranceSeconds: 60,
+		},
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newService := func() (*measurements.Service, *StoreMock) {
+		store := &StoreMock{
+			GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+				return &measurements.Datastream{ID: id}, nil
+			},
+			ApplyCorrectionFunc: func(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+				correction.ID = 7
+				return nil
+			},
+			ListDerivedDatastreamsFunc: func(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+				return []measurements.DerivedDatastream{derived}, nil
+			},
+			// The source measurements are exported as they are before the correction is stored
+			ExportMeasurementsFunc: func(ctx context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+				for ix, value := range []float64{5, 8} {
+					timestamp := start.Add(time.Duration(ix) * 30 * time.Minute)
+					err := fn(measurements.Measurement{DatastreamID: sourceID, MeasurementTimestamp: timestamp, MeasurementValue: value})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}
+		deviceStore := &DeviceStoreMock{
+			ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+				return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+			},
+		}
+		return measurements.New(store, 0, 1, authtest.JWKS(), deviceStore), store
+	}
+	r := measurements.CorrectionRange{Start: start, End: start.Add(time.Hour), Reason: "calibration"}
+
+	svc, store := newService()
+	_, err := svc.OverwriteMeasurements(authtest.GodContext(), sourceID, measurements.OverwriteMeasurementsOpts{
+		CorrectionRange: r,
+		Value:           ptr(3.0),
+	})
+	require.NoError(t, err)
+	require.Len(t, store.ApplyCorrectionCalls(), 1)
+	assert.Empty(t, store.StoreMeasurementsCalls(), "recalculated measurements are stored with the correction")
+	recalculations := store.ApplyCorrectionCalls()[0].Recalculations
+	require.Len(t, recalculations, 1)
+	recalculation := recalculations[0].Correction
+	assert.Equal(t, derived.ID, recalculation.DatastreamID)
+	assert.Equal(t, measurements.CorrectionDelete, recalculation.Action)
+	assert.Equal(t, start.Add(time.Hour+time.Minute), recalculation.End, "the range is extended by the tolerance")
+	assert.Contains(t, recalculation.Reason, "calibration")
+	stored := recalculations[0].Measurements
+	require.Len(t, stored, 2)
+	assert.Equal(t, derived.ID, stored[0].DatastreamID)
+	assert.Equal(t, 6.0, stored[0].MeasurementValue, "the overwritten values should be derived from")
+	assert.Equal(t, 6.0, stored[1].MeasurementValue, "the overwritten values should be derived from")
+
+	svc, store = newService()
+	_, err = svc.DeleteMeasurements(authtest.GodContext(), sourceID, r)
+	require.NoError(t, err)
+	require.Len(t, store.ApplyCorrectionCalls(), 1)
+	recalculations = store.ApplyCorrectionCalls()[0].Recalculations
+	require.Len(t, recalculations, 1)
+	assert.Empty(t, recalculations[0].Measurements, "deleted measurements should not be derived from")
+}
+
+func TestOverwriteMeasurementsShouldValidate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	valid := measurements.CorrectionRange{Start: start, End: start.Add(time.Hour), Reason: "calibration"}
+	testCases := []struct {
+		desc string
+		opts measurements.OverwriteMeasurementsOpts
+		ok   bool
+	}{
+		{desc: "value", opts: measurements.OverwriteMeasurementsOpts{CorrectionRange: valid, Value: ptr(1.0)}, ok: true},
+		{desc: "factor and offset", opts: measurements.OverwriteMeasurementsOpts{CorrectionRange: valid, Factor: ptr(1.1), Offset: ptr(-0.2)}, ok: true},
+		{desc: "nothing to overwrite", opts: measurements.OverwriteMeasurementsOpts{CorrectionRange: valid}},
+		{desc: "value and factor", opts: measurements.OverwriteMeasurementsOpts{CorrectionRange: valid, Value: ptr(1.0), Factor: ptr(2.0)}},
+		{
+			desc: "missing reason",
+			opts: measurements.OverwriteMeasurementsOpts{
+				CorrectionRange: measurements.CorrectionRange{Start: start, End: start.Add(time.Hour)},
+				Value:           ptr(1.0),
+			},
+		},
+		{
+			desc: "range too long",
+			opts: measurements.OverwriteMeasurementsOpts{
+				CorrectionRange: measurements.CorrectionRange{Start: start, End: start.Add(measurements.MaxCorrectionRange + time.Second), Reason: "calibration"},
+				Value:           ptr(1.0),
+			},
+		},
+		{
+			desc: "end before start",
+			opts: measurements.OverwriteMeasurementsOpts{
+				CorrectionRange: measurements.CorrectionRange{Start: start, End: start.Add(-time.Hour), Reason: "calibration"},
+				Value:           ptr(1.0),
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := &StoreMock{
+				GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+					return &measurements.Datastream{ID: id}, nil
+				},
+				ApplyCorrectionFunc: func(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+					return nil
+				},
+				ListDerivedDatastreamsFunc: noDerivedDatastreams,
+			}
+			svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+			correction, err := svc.OverwriteMeasurements(authtest.GodContext(), uuid.New(), tC.opts)
+
+			if !tC.ok {
+				assert.ErrorIs(t, err, measurements.ErrCorrectionInvalid)
+				assert.Empty(t, store.ApplyCorrectionCalls())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, measurements.CorrectionOverwrite, correction.Action)
+			assert.Equal(t, tC.opts.Value, correction.Value)
+			assert.Equal(t, tC.opts.Factor, correction.Factor)
+			assert.Equal(t, tC.opts.Offset, correction.Offset)
+		})
+	}
+}
+
+func TestCorrectionsShouldRequireWritePermission(t *testing.T) {
+	store := &StoreMock{}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	ctx := auth.CreateAuthenticatedContextForTESTING(context.Background(), "user", authtest.DefaultTenantID, auth.Permissions{auth.READ_MEASUREMENTS})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := svc.DeleteMeasurements(ctx, uuid.New(), measurements.CorrectionRange{Start: start, End: start, Reason: "x"})
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	assert.Empty(t, store.ApplyCorrectionCalls())
+}
@@ -13,14 +13,20 @@ var (
 	ErrDatastreamNotFound = web.NewError(http.StatusNotFound, "Requested datastream was not found", "ERR_DATASTREAM_NOT_FOUND")
 	ErrUoMInvalid         = web.NewError(http.StatusBadRequest, "Unit of Measure is invalid and does not conform to UCUM standards", "ERR_UOM_INVALID")
 	ErrInvalidSensorID    = web.NewError(http.StatusBadRequest, "Invalid sensorID", "ERR_SENSORID_INVALID")
+	ErrDatastreamExists   = web.NewError(http.StatusConflict, "Sensor already has a datastream for this observed property", "ERR_DATASTREAM_EXISTS")
 )
 
 type Datastream struct {
-	ID                uuid.UUID `json:"id"`
-	Description       string    `json:"description"`
-	SensorID          int64     `json:"sensor_id" db:"sensor_id"`
-	ObservedProperty  string    `json:"observed_property" db:"observed_property"`
-	UnitOfMeasurement string    `json:"unit_of_measurement" db:"unit_of_measurement"`
-	CreatedAt         time.Time `json:"created_at" db:"created_at"`
-	TenantID          int64     `json:"-"`
+	ID                uuid.UUID    `json:"id"`
+	Description       string       `json:"description"`
+	SensorID          int64        `json:"sensor_id" db:"sensor_id"`
+	ObservedProperty  string       `json:"observed_property" db:"observed_property"`
+	UnitOfMeasurement string       `json:"unit_of_measurement" db:"unit_of_measurement"`
+	CreatedAt         time.Time    `json:"created_at" db:"created_at"`
+	QualityRules      QualityRules `json:"quality_rules" db:"quality_rules"`
+	// ArchiveTime is the amount of days measurements are kept, if nil the tenant or system archive time applies
+	ArchiveTime *int  `json:"archive_time" db:"archive_time"`
+	TenantID    int64 `json:"-"`
+	// Stats is only included when listing datastreams with statistics
+	Stats *DatastreamStats `json:"stats,omitempty"`
 }
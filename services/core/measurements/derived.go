@@ -0,0 +1,625 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+var (
+	ErrDerivationInvalid  = web.NewError(http.StatusBadRequest, "Derived datastream is invalid", "ERR_DERIVATION_INVALID")
+	ErrDerivationNotFound = web.NewError(http.StatusNotFound, "Datastream is not a derived datastream", "ERR_DERIVATION_NOT_FOUND")
+	ErrBackfillInvalid    = web.NewError(http.StatusBadRequest, "Backfill range is invalid", "ERR_BACKFILL_INVALID")
+)
+
+// MaxDerivationToleranceSeconds limits how much older the measurement of a source may be than the derived measurement
+const MaxDerivationToleranceSeconds = 24 * 60 * 60
+
+// DerivationSource binds a variable in the expression of a derived datastream to a source datastream
+type DerivationSource struct {
+	Variable     string    `json:"variable"`
+	DatastreamID uuid.UUID `json:"datastream_id"`
+}
+
+// Derivation calculates the measurements of a derived datastream from the measurements of its sources.
+// A measurement is derived for every timestamp at which a source has a measurement, using the most recent
+// measurement of every other source at or before that timestamp. Those may be at most ToleranceSeconds older,
+// by default all sources must be measured at the same time, as is the case for values from a single uplink.
+//
+// Derived measurements are not used as source for other derived datastreams.
+type Derivation struct {
+	DatastreamID     uuid.UUID          `json:"datastream_id"`
+	Expression       string             `json:"expression"`
+	Sources          []DerivationSource `json:"sources"`
+	ToleranceSeconds int                `json:"tolerance_seconds"`
+	TenantID         int64              `json:"-"`
+}
+
+// DerivedDatastream is a regular datastream of which the measurements are derived from other datastreams
+type DerivedDatastream struct {
+	Datastream
+	Derivation Derivation `json:"derivation"`
+}
+
+var variableNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// expressionFunctions can be used in expressions next to the builtin functions such as abs, min, max and round
+var expressionFunctions = map[string]any{
+	"sqrt":  math.Sqrt,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log10": math.Log10,
+	"pow":   math.Pow,
+}
+
+func (d Derivation) compile() (*vm.Program, error) {
+	env := maps.Clone(expressionFunctions)
+	for _, src := range d.Sources {
+		env[src.Variable] = 0.0
+	}
+	return expr.Compile(d.Expression, expr.Env(env), expr.AsFloat64())
+}
+
+func (d Derivation) Validate() error {
+	if strings.TrimSpace(d.Expression) == "" {
+		return errors.New("expression is required")
+	}
+	if len(d.Sources) == 0 {
+		return errors.New("at least one source is required")
+	}
+	if d.ToleranceSeconds < 0 || d.ToleranceSeconds > MaxDerivationToleranceSeconds {
+		return fmt.Errorf("tolerance_seconds must be between 0 and %d", MaxDerivationToleranceSeconds)
+	}
+	variables := map[string]bool{}
+	for _, src := range d.Sources {
+		if !variableNamePattern.MatchString(src.Variable) {
+			return fmt.Errorf("variable %q must start with a letter and contain only letters, digits and underscores", src.Variable)
+		}
+		if _, ok := expressionFunctions[src.Variable]; ok {
+			return fmt.Errorf("variable %q is the name of a function", src.Variable)
+		}
+		if variables[src.Variable] {
+			return fmt.Errorf("variable %q is used more than once", src.Variable)
+		}
+		variables[src.Variable] = true
+		if src.DatastreamID == d.DatastreamID {
+			return errors.New("a derived datastream can not be its own source")
+		}
+	}
+	if _, err := d.compile(); err != nil {
+		return fmt.Errorf("expression: %w", err)
+	}
+	return nil
+}
+
+// CreateDerivedDatastreamOpts creates a derived datastream. The datastream belongs to a sensor like any other
+// datastream, if no sensor is given the sensor of the first source is used.
+type CreateDerivedDatastreamOpts struct {
+	SensorID          int64              `json:"sensor_id"`
+	Description       string             `json:"description"`
+	ObservedProperty  string             `json:"observed_property"`
+	UnitOfMeasurement string             `json:"unit_of_measurement"`
+	Expression        string             `json:"expression"`
+	Sources           []DerivationSource `json:"sources"`
+	ToleranceSeconds  int                `json:"tolerance_seconds"`
+}
+
+func (s *Service) CreateDerivedDatastream(ctx context.Context, opts CreateDerivedDatastreamOpts) (*DerivedDatastream, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ObservedProperty == "" {
+		return nil, fmt.Errorf("%w: observed_property is required", ErrDerivationInvalid)
+	}
+	uom, err := CanonicalUnit(opts.UnitOfMeasurement)
+	if err != nil {
+		return nil, err
+	}
+
+	derived := &DerivedDatastream{
+		Datastream: Datastream{
+			ID:                uuid.Must(uuid.NewV7()),
+			Description:       opts.Description,
+			SensorID:          opts.SensorID,
+			ObservedProperty:  opts.ObservedProperty,
+			UnitOfMeasurement: uom,
+			CreatedAt:         time.Now(),
+			TenantID:          tenantID,
+		},
+	}
+	derived.Derivation = Derivation{
+		DatastreamID:     derived.ID,
+		Expression:       opts.Expression,
+		Sources:          opts.Sources,
+		ToleranceSeconds: opts.ToleranceSeconds,
+		TenantID:         tenantID,
+	}
+	if err := derived.Derivation.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDerivationInvalid, err)
+	}
+	for _, src := range opts.Sources {
+		ds, err := s.store.GetDatastream(ctx, src.DatastreamID, DatastreamFilter{TenantID: []int64{tenantID}})
+		if errors.Is(err, ErrDatastreamNotFound) {
+			return nil, fmt.Errorf("%w: source datastream %s does not exist", ErrDerivationInvalid, src.DatastreamID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if derived.SensorID == 0 {
+			derived.SensorID = ds.SensorID
+		}
+	}
+	// The sensor of a source is known to belong to the tenant, a given sensor must be checked
+	if opts.SensorID != 0 {
+		dev, _, err := s.findSensorDevice(ctx, opts.SensorID)
+		if err != nil {
+			return nil, err
+		}
+		if dev.TenantID != tenantID {
+			return nil, devices.ErrSensorNotFound
+		}
+	}
+
+	if err := s.store.CreateDerivedDatastream(ctx, derived); err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
+
+// GetDerivation returns how the measurements of a derived datastream are derived
+func (s *Service) GetDerivation(ctx context.Context, datastreamID uuid.UUID) (*Derivation, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := s.store.GetDerivedDatastream(ctx, datastreamID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &derived.Derivation, nil
+}
+
+// BackfillRange selects the timestamps for which measurements are derived, both start and end are inclusive
+type BackfillRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (r BackfillRange) Validate() error {
+	if r.Start.IsZero() || r.End.IsZero() {
+		return errors.New("start and end are required")
+	}
+	if r.End.Before(r.Start) {
+		return errors.New("end must not be before start")
+	}
+	return nil
+}
+
+// Backfill is the result of deriving the measurements of a derived datastream for a range
+type Backfill struct {
+	BackfillRange
+	Measurements int `json:"measurements"`
+}
+
+// BackfillDerivedDatastream derives the measurements of a derived datastream from the stored source measurements
+// in the range. Derived measurements that already exist are handled by the conflict policy of the store.
+func (s *Service) BackfillDerivedDatastream(ctx context.Context, datastreamID uuid.UUID, r BackfillRange) (*Backfill, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBackfillInvalid, err)
+	}
+	derived, err := s.store.GetDerivedDatastream(ctx, datastreamID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return s.backfill(ctx, tenantID, *derived, r)
+}
+
+// backfill derives and stores the measurements of the derived datastream in the range
+func (s *Service) backfill(ctx context.Context, tenantID int64, derived DerivedDatastream, r BackfillRange) (*Backfill, error) {
+	batch := make([]Measurement, 0, MaxMeasurementsPerRequest)
+	backfill := &Backfill{BackfillRange: r}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.store.StoreMeasurements(ctx, batch); err != nil {
+			return fmt.Errorf("%w: %w", ErrMeasurementsNotCommitted, err)
+		}
+		backfill.Measurements += lo.CountBy(batch, func(m Measurement) bool { return m.ID != 0 })
+		batch = batch[:0]
+		return nil
+	}
+	err := s.deriveRange(ctx, tenantID, derived, r, nil, func(m Measurement) error {
+		batch = append(batch, m)
+		if len(batch) == cap(batch) {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return backfill, nil
+}
+
+// deriveRange derives the measurements of the derived datastream in the range from the stored source measurements and
+// passes them to emit in timestamp order. If a correction is given, the source measurements are derived from as they
+// are after the correction, which does not have to be stored yet.
+func (s *Service) deriveRange(
+	ctx context.Context, tenantID int64, derived DerivedDatastream, r BackfillRange, correction *Correction,
+	emit func(Measurement) error,
+) error {
+	ev, err := newDerivationEvaluator(derived)
+	if err != nil {
+		return err
+	}
+
+	d := newDeriver(ctx, s)
+	// Source measurements are streamed in timestamp order, a measurement is derived once all
+	// source measurements at a timestamp have been seen
+	latest := map[string]Sample{}
+	var trigger *Measurement
+	derive := func() error {
+		if trigger == nil || trigger.MeasurementTimestamp.Before(r.Start) {
+			return nil
+		}
+		m, ok, err := d.derive(ev, *trigger, latest)
+		if err != nil || !ok {
+			return err
+		}
+		return emit(m)
+	}
+	filter := Filter{
+		Start:      r.Start.Add(-ev.tolerance),
+		End:        r.End,
+		Datastream: lo.Map(derived.Derivation.Sources, func(src DerivationSource, _ int) string { return src.DatastreamID.String() }),
+		TenantID:   []int64{tenantID},
+	}
+	err = s.store.ExportMeasurements(ctx, filter, func(m Measurement) error {
+		if correction != nil {
+			var ok bool
+			if m, ok = correction.correct(m); !ok {
+				return nil
+			}
+		}
+		if trigger != nil && !m.MeasurementTimestamp.Equal(trigger.MeasurementTimestamp) {
+			if err := derive(); err != nil {
+				return err
+			}
+		}
+		for _, variable := range ev.variables[m.DatastreamID] {
+			latest[variable] = Sample{Timestamp: m.MeasurementTimestamp, Value: m.MeasurementValue}
+		}
+		trigger = &m
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return derive()
+}
+
+// deriveMeasurements derives the measurements of derived datastreams with a source in the batch. The values of other
+// sources are taken from the batch, or from the stored measurements if the batch has no value at the same time.
+// Failing to derive does not prevent storing the batch, derived datastreams that fail are logged and skipped and can
+// be backfilled later.
+func (s *Service) deriveMeasurements(ctx context.Context, batch []Measurement) []Measurement {
+	sourceIDs := lo.Uniq(lo.Map(batch, func(m Measurement, _ int) uuid.UUID { return m.DatastreamID }))
+	list, err := s.store.ListDerivedDatastreams(ctx, sourceIDs)
+	if err != nil {
+		log.Printf("Deriving measurements failed, could not get derived datastreams: %s\n", err.Error())
+		return nil
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	// Every derived datastream is derived at each timestamp at which one of its sources is in the batch
+	type derivation struct {
+		ev       *derivationEvaluator
+		triggers []Measurement
+		latest   []map[string]Sample
+	}
+	derivations := make([]derivation, 0, len(list))
+	lookups := newSampleLookups()
+	for _, dds := range list {
+		ev, err := newDerivationEvaluator(dds)
+		if err != nil {
+			log.Printf("Deriving measurements of datastream %s failed: %s\n", dds.ID, err.Error())
+			continue
+		}
+		der := derivation{ev: ev}
+		seen := map[int64]bool{}
+		for _, trigger := range batch {
+			timestamp := trigger.MeasurementTimestamp
+			if len(ev.variables[trigger.DatastreamID]) == 0 || seen[timestamp.UnixMicro()] {
+				continue
+			}
+			seen[timestamp.UnixMicro()] = true
+			latest := batchSourceValues(ev, batch, timestamp)
+			for _, src := range ev.Derivation.Sources {
+				if current, ok := latest[src.Variable]; !ok || !current.Timestamp.Equal(timestamp) {
+					lookups.add(src.DatastreamID, timestamp)
+				}
+			}
+			der.triggers = append(der.triggers, trigger)
+			der.latest = append(der.latest, latest)
+		}
+		derivations = append(derivations, der)
+	}
+	stored, err := lookups.list(ctx, s.store)
+	if err != nil {
+		log.Printf("Deriving measurements failed, could not get source values: %s\n", err.Error())
+		return nil
+	}
+
+	d := newDeriver(ctx, s)
+	derived := []Measurement{}
+	for _, der := range derivations {
+		results := make([]Measurement, 0, len(der.triggers))
+		for ix, trigger := range der.triggers {
+			latest := der.latest[ix]
+			for _, src := range der.ev.Derivation.Sources {
+				sample, ok := stored[sampleLookup{src.DatastreamID, trigger.MeasurementTimestamp.UnixMicro()}]
+				if current, found := latest[src.Variable]; ok && (!found || sample.Timestamp.After(current.Timestamp)) {
+					latest[src.Variable] = sample
+				}
+			}
+			m, ok, err := d.derive(der.ev, trigger, latest)
+			if err != nil {
+				log.Printf("Deriving measurements of datastream %s failed: %s\n", der.ev.ID, err.Error())
+				results = nil
+				break
+			}
+			if ok {
+				results = append(results, m)
+			}
+		}
+		derived = append(derived, results...)
+	}
+	return derived
+}
+
+// batchSourceValues finds the latest value of every variable at or before the timestamp in the batch
+func batchSourceValues(ev *derivationEvaluator, batch []Measurement, timestamp time.Time) map[string]Sample {
+	latest := map[string]Sample{}
+	for _, m := range batch {
+		if m.MeasurementTimestamp.After(timestamp) {
+			continue
+		}
+		for _, variable := range ev.variables[m.DatastreamID] {
+			if current, ok := latest[variable]; !ok || m.MeasurementTimestamp.After(current.Timestamp) {
+				latest[variable] = Sample{Timestamp: m.MeasurementTimestamp, Value: m.MeasurementValue}
+			}
+		}
+	}
+	return latest
+}
+
+// sampleLookup is the latest stored sample of a datastream at or before a timestamp in microseconds
+type sampleLookup struct {
+	datastreamID uuid.UUID
+	timestamp    int64
+}
+
+// sampleLookups collects the stored samples required to derive a batch, so they are fetched at once
+type sampleLookups struct {
+	seen          map[sampleLookup]bool
+	datastreamIDs []uuid.UUID
+	timestamps    []time.Time
+}
+
+func newSampleLookups() *sampleLookups {
+	return &sampleLookups{seen: map[sampleLookup]bool{}}
+}
+
+func (l *sampleLookups) add(datastreamID uuid.UUID, timestamp time.Time) {
+	key := sampleLookup{datastreamID, timestamp.UnixMicro()}
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	l.datastreamIDs = append(l.datastreamIDs, datastreamID)
+	l.timestamps = append(l.timestamps, timestamp)
+}
+
+func (l *sampleLookups) list(ctx context.Context, store Store) (map[sampleLookup]Sample, error) {
+	found := map[sampleLookup]Sample{}
+	if len(l.timestamps) == 0 {
+		return found, nil
+	}
+	samples, err := store.ListSamplesAt(ctx, l.datastreamIDs, l.timestamps)
+	if err != nil {
+		return nil, err
+	}
+	for ix, sample := range samples {
+		if sample != nil {
+			found[sampleLookup{l.datastreamIDs[ix], l.timestamps[ix].UnixMicro()}] = *sample
+		}
+	}
+	return found, nil
+}
+
+// derivationEvaluator evaluates the compiled expression of a derived datastream
+type derivationEvaluator struct {
+	DerivedDatastream
+	program   *vm.Program
+	tolerance time.Duration
+	// variables holds the variables of every source datastream
+	variables map[uuid.UUID][]string
+}
+
+func newDerivationEvaluator(derived DerivedDatastream) (*derivationEvaluator, error) {
+	program, err := derived.Derivation.compile()
+	if err != nil {
+		return nil, fmt.Errorf("could not compile expression of derived datastream %s: %w", derived.ID, err)
+	}
+	ev := &derivationEvaluator{
+		DerivedDatastream: derived,
+		program:           program,
+		tolerance:         time.Duration(derived.Derivation.ToleranceSeconds) * time.Second,
+		variables:         map[uuid.UUID][]string{},
+	}
+	for _, src := range derived.Derivation.Sources {
+		ev.variables[src.DatastreamID] = append(ev.variables[src.DatastreamID], src.Variable)
+	}
+	return ev, nil
+}
+
+// evaluate calculates the derived value at the timestamp from the latest value of every variable. It is not ok
+// if a variable has no value within the tolerance or if the result is not a finite number.
+func (ev *derivationEvaluator) evaluate(timestamp time.Time, latest map[string]Sample) (float64, bool, error) {
+	env := maps.Clone(expressionFunctions)
+	for _, src := range ev.Derivation.Sources {
+		sample, ok := latest[src.Variable]
+		if !ok || sample.Timestamp.After(timestamp) || timestamp.Sub(sample.Timestamp) > ev.tolerance {
+			return 0, false, nil
+		}
+		env[src.Variable] = sample.Value
+	}
+	out, err := expr.Run(ev.program, env)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not evaluate expression of derived datastream %s: %w", ev.ID, err)
+	}
+	var value float64
+	switch v := out.(type) {
+	case float64:
+		value = v
+	case int:
+		value = float64(v)
+	default:
+		return 0, false, fmt.Errorf("expression of derived datastream %s resulted in %T", ev.ID, out)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
+
+// deriver creates derived measurements, it caches the devices and retention of derived datastreams and their
+// quality history
+type deriver struct {
+	ctx       context.Context
+	svc       *Service
+	now       time.Time
+	quality   *qualityEvaluator
+	devices   map[int64]*devices.Device
+	retention map[uuid.UUID]Retention
+}
+
+func newDeriver(ctx context.Context, svc *Service) *deriver {
+	now := time.Now()
+	return &deriver{
+		ctx:       ctx,
+		svc:       svc,
+		now:       now,
+		quality:   newQualityEvaluator(svc.store, now),
+		devices:   map[int64]*devices.Device{},
+		retention: map[uuid.UUID]Retention{},
+	}
+}
+
+// derive creates the derived measurement at the timestamp of the trigger, which is the source measurement causing
+// the derivation. The derived measurement inherits the uplink message and location of its trigger. It expires
+// according to the retention of the derived datastream, counted from the moment it is derived.
+func (d *deriver) derive(ev *derivationEvaluator, trigger Measurement, latest map[string]Sample) (Measurement, bool, error) {
+	value, ok, err := ev.evaluate(trigger.MeasurementTimestamp, latest)
+	if err != nil || !ok {
+		return Measurement{}, false, err
+	}
+	dev, sensor, err := d.sensor(ev.SensorID)
+	if err != nil {
+		return Measurement{}, false, err
+	}
+
+	measurement := newMeasurement(ev.TenantID, dev, sensor, &ev.Datastream, d.now)
+	measurement.UplinkMessageID = trigger.UplinkMessageID
+	measurement.MeasurementSource = MeasurementSourceDerived
+	measurement.MeasurementSubmittedBy = trigger.MeasurementSubmittedBy
+	measurement.MeasurementTimestamp = trigger.MeasurementTimestamp
+	measurement.MeasurementValue = value
+	measurement.MeasurementLatitude = trigger.MeasurementLatitude
+	measurement.MeasurementLongitude = trigger.MeasurementLongitude
+	measurement.MeasurementAltitude = trigger.MeasurementAltitude
+	measurement.MeasurementQuality, err = d.quality.evaluate(d.ctx, &ev.Datastream, Sample{
+		Timestamp: measurement.MeasurementTimestamp,
+		Value:     measurement.MeasurementValue,
+	})
+	if err != nil {
+		return Measurement{}, false, err
+	}
+	retention, ok := d.retention[ev.ID]
+	if !ok {
+		if retention, err = d.svc.retention(d.ctx, ev.TenantID, sensor, &ev.Datastream); err != nil {
+			return Measurement{}, false, err
+		}
+		d.retention[ev.ID] = retention
+	}
+	measurement.MeasurementExpiration = retention.Expiration(d.now)
+	measurement.OrganisationArchiveTime = lo.FromPtr(retention.TenantArchiveTime)
+	return measurement, true, nil
+}
+
+func (d *deriver) sensor(id int64) (*devices.Device, *devices.Sensor, error) {
+	if dev, ok := d.devices[id]; ok {
+		sensor, _ := findSensor(dev, id)
+		return dev, sensor, nil
+	}
+	dev, sensor, err := d.svc.findSensorDevice(d.ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.devices[id] = dev
+	return dev, sensor, nil
+}
+
+// findSensorDevice returns the sensor with its device
+func (s *Service) findSensorDevice(ctx context.Context, sensorID int64) (*devices.Device, *devices.Sensor, error) {
+	page, err := s.deviceStore.List(ctx, devices.DeviceFilter{Sensor: []int64{sensorID}}, pagination.Request{Limit: 1})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(page.Data) == 0 {
+		return nil, nil, devices.ErrDeviceNotFound
+	}
+	dev := &page.Data[0]
+	sensor, ok := findSensor(dev, sensorID)
+	if !ok {
+		return nil, nil, devices.ErrSensorNotFound
+	}
+	return dev, sensor, nil
+}
@@ -0,0 +1,285 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func noDerivedDatastreams(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+	return nil, nil
+}
+
+// storeAll stores every measurement as the store would without conflicts, by giving it an ID
+func storeAll(ctx context.Context, list []measurements.Measurement) error {
+	for ix := range list {
+		list[ix].ID = ix + 1
+	}
+	return nil
+}
+
+func TestDerivationValidate(t *testing.T) {
+	source := uuid.New()
+	testCases := []struct {
+		desc       string
+		derivation measurements.Derivation
+		ok         bool
+	}{
+		{
+			desc: "expression over sources",
+			derivation: measurements.Derivation{
+				Expression: "height - distance",
+				Sources:    []measurements.DerivationSource{{Variable: "height", DatastreamID: source}, {Variable: "distance", DatastreamID: uuid.New()}},
+			},
+			ok: true,
+		},
+		{
+			desc: "expression with functions",
+			derivation: measurements.Derivation{
+				Expression: "243.04 * (ln(rh/100) + (17.625*t)/(243.04+t)) / (17.625 - ln(rh/100) - (17.625*t)/(243.04+t))",
+				Sources:    []measurements.DerivationSource{{Variable: "t", DatastreamID: source}, {Variable: "rh", DatastreamID: uuid.New()}},
+			},
+			ok: true,
+		},
+		{
+			desc: "unknown variable",
+			derivation: measurements.Derivation{
+				Expression: "height - distance",
+				Sources:    []measurements.DerivationSource{{Variable: "height", DatastreamID: source}},
+			},
+		},
+		{
+			desc: "result is not a number",
+			derivation: measurements.Derivation{
+				Expression: `"level"`,
+				Sources:    []measurements.DerivationSource{{Variable: "height", DatastreamID: source}},
+			},
+		},
+		{
+			desc: "variable is not an identifier",
+			derivation: measurements.Derivation{
+				Expression: "1",
+				Sources:    []measurements.DerivationSource{{Variable: "water-level", DatastreamID: source}},
+			},
+		},
+		{
+			desc: "variable used twice",
+			derivation: measurements.Derivation{
+				Expression: "a",
+				Sources:    []measurements.DerivationSource{{Variable: "a", DatastreamID: source}, {Variable: "a", DatastreamID: uuid.New()}},
+			},
+		},
+		{
+			desc:       "no sources",
+			derivation: measurements.Derivation{Expression: "1"},
+		},
+		{
+			desc: "own source",
+			derivation: measurements.Derivation{
+				DatastreamID: source,
+				Expression:   "a",
+				Sources:      []measurements.DerivationSource{{Variable: "a", DatastreamID: source}},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := tC.derivation.Validate()
+			if tC.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAddDatastreamMeasurementsShouldDeriveMeasurements(t *testing.T) {
+	distance := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "distance", UnitOfMeasurement: "m"}
+	heightID := uuid.New()
+	derived := measurements.DerivedDatastream{
+		Datastream: measurements.Datastream{
+			ID: uuid.New(), SensorID: 12, ObservedProperty: "water_level", UnitOfMeasurement: "m",
+			TenantID: authtest.DefaultTenantID, ArchiveTime: ptr(7),
+		},
+		Derivation: measurements.Derivation{
+			Expression:       "height - distance",
+			Sources:          []measurements.DerivationSource{{Variable: "distance", DatastreamID: distance.ID}, {Variable: "height", DatastreamID: heightID}},
+			ToleranceSeconds: 60,
+		},
+	}
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &distance, nil
+		},
+		ListDerivedDatastreamsFunc: func(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+			return []measurements.DerivedDatastream{derived}, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+		ListSamplesAtFunc: func(ctx context.Context, datastreamIDs []uuid.UUID, timestamps []time.Time) ([]*measurements.Sample, error) {
+			// The height is only known 30 seconds before the first distance
+			samples := make([]*measurements.Sample, len(datastreamIDs))
+			for ix, id := range datastreamIDs {
+				if id == heightID {
+					samples[ix] = &measurements.Sample{Timestamp: timestamp.Add(-30 * time.Second), Value: 5}
+				}
+			}
+			return samples, nil
+		},
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return nil
+		},
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore)
+
+	_, err := svc.AddDatastreamMeasurements(authtest.GodContext(), distance.ID, []measurements.NewMeasurement{
+		{Timestamp: timestamp, Value: 1.5},
+		{Timestamp: timestamp.Add(time.Hour), Value: 2},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, store.StoreMeasurementsCalls(), 1)
+	stored := store.StoreMeasurementsCalls()[0].MeasurementsMoqParam
+	require.Len(t, stored, 3, "only the first distance has a height within the tolerance")
+	m := stored[2]
+	assert.Equal(t, derived.ID, m.DatastreamID)
+	assert.Equal(t, "water_level", m.DatastreamObservedProperty)
+	assert.Equal(t, 3.5, m.MeasurementValue)
+	assert.Equal(t, timestamp, m.MeasurementTimestamp)
+	assert.Equal(t, measurements.MeasurementSourceDerived, m.MeasurementSource)
+	assert.Equal(t, stored[0].UplinkMessageID, m.UplinkMessageID)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), stored[0].MeasurementExpiration, time.Minute)
+	assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), m.MeasurementExpiration, time.Minute,
+		"derived measurements should expire by the archive time of the derived datastream")
+	assert.Equal(t, "level", m.SensorCode)
+
+	require.Len(t, store.ListSamplesAtCalls(), 1, "the source values of the batch should be fetched at once")
+	assert.ElementsMatch(t, []uuid.UUID{heightID, heightID}, store.ListSamplesAtCalls()[0].DatastreamIDs)
+}
+
+func TestAddDatastreamMeasurementsShouldStoreMeasurementsWhenDerivingFails(t *testing.T) {
+	distance := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "distance", UnitOfMeasurement: "m"}
+	derived := measurements.DerivedDatastream{
+		Datastream: measurements.Datastream{ID: uuid.New(), SensorID: 99, TenantID: authtest.DefaultTenantID},
+		Derivation: measurements.Derivation{
+			Expression: "distance * 2",
+			Sources:    []measurements.DerivationSource{{Variable: "distance", DatastreamID: distance.ID}},
+		},
+	}
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &distance, nil
+		},
+		ListDerivedDatastreamsFunc: func(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+			return []measurements.DerivedDatastream{derived}, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+		StoreMeasurementsFunc: storeAll,
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			// The sensor of the derived datastream no longer exists
+			if len(filter.Sensor) > 0 && filter.Sensor[0] == derived.SensorID {
+				return &pagination.Page[devices.Device]{}, nil
+			}
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore)
+
+	_, err := svc.AddDatastreamMeasurements(authtest.GodContext(), distance.ID, []measurements.NewMeasurement{
+		{Timestamp: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Value: 1.5},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, store.StoreMeasurementsCalls(), 1)
+	stored := store.StoreMeasurementsCalls()[0].MeasurementsMoqParam
+	require.Len(t, stored, 1, "the raw measurement is stored without the derived measurement")
+	assert.Equal(t, distance.ID, stored[0].DatastreamID)
+}
+
+func TestBackfillDerivedDatastreamShouldDeriveFromStoredMeasurements(t *testing.T) {
+	temperatureID, humidityID := uuid.New(), uuid.New()
+	derived := measurements.DerivedDatastream{
+		Datastream: measurements.Datastream{
+			ID: uuid.New(), SensorID: 11, ObservedProperty: "dew_point", UnitOfMeasurement: "Cel",
+			TenantID: authtest.DefaultTenantID,
+		},
+		Derivation: measurements.Derivation{
+			Expression: "t - (100 - rh) / 5",
+			Sources:    []measurements.DerivationSource{{Variable: "t", DatastreamID: temperatureID}, {Variable: "rh", DatastreamID: humidityID}},
+		},
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := func(id uuid.UUID, offset time.Duration, value float64) measurements.Measurement {
+		return measurements.Measurement{DatastreamID: id, MeasurementTimestamp: start.Add(offset), MeasurementValue: value}
+	}
+	store := &StoreMock{
+		GetDerivedDatastreamFunc: func(ctx context.Context, id uuid.UUID, tenantID int64) (*measurements.DerivedDatastream, error) {
+			return &derived, nil
+		},
+		ExportMeasurementsFunc: func(ctx context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+			for _, m := range []measurements.Measurement{
+				source(temperatureID, -time.Minute, 10),
+				source(humidityID, -time.Minute, 90),
+				source(temperatureID, 0, 20),
+				source(humidityID, 0, 50),
+				source(temperatureID, time.Minute, 21),
+				source(temperatureID, 2*time.Minute, 22),
+				source(humidityID, 2*time.Minute, 60),
+			} {
+				if err := fn(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		StoreMeasurementsFunc: storeAll,
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore)
+
+	backfill, err := svc.BackfillDerivedDatastream(authtest.GodContext(), derived.ID, measurements.BackfillRange{
+		Start: start,
+		End:   start.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, backfill.Measurements)
+
+	require.Len(t, store.ExportMeasurementsCalls(), 1)
+	filter := store.ExportMeasurementsCalls()[0].Filter
+	assert.ElementsMatch(t, []string{temperatureID.String(), humidityID.String()}, filter.Datastream)
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, filter.TenantID)
+
+	require.Len(t, store.StoreMeasurementsCalls(), 1)
+	stored := store.StoreMeasurementsCalls()[0].MeasurementsMoqParam
+	require.Len(t, stored, 2, "measurements before start or without humidity at the same time are not derived")
+	assert.Equal(t, start, stored[0].MeasurementTimestamp)
+	assert.Equal(t, 10.0, stored[0].MeasurementValue)
+	assert.Equal(t, start.Add(2*time.Minute), stored[1].MeasurementTimestamp)
+	assert.Equal(t, 14.0, stored[1].MeasurementValue)
+	assert.Equal(t, derived.ID, stored[1].DatastreamID)
+}
@@ -0,0 +1,5 @@
+package measurements
+
+// UnitAliases exposes the unit aliases so tests can compare them with the migration that canonicalises existing
+// datastreams
+var UnitAliases = unitAliases
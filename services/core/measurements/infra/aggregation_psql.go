@@ -0,0 +1,85 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+var aggregateExpressions = map[measurements.AggregateFunction]string{
+	measurements.AggregateAverage: "avg(measurement_value)",
+	measurements.AggregateMinimum: "min(measurement_value)",
+	measurements.AggregateMaximum: "max(measurement_value)",
+	measurements.AggregateSum:     "sum(measurement_value)",
+	measurements.AggregateCount:   "count(measurement_value)::float8",
+	measurements.AggregateFirst:   "first(measurement_value, measurement_timestamp)",
+	measurements.AggregateLast:    "last(measurement_value, measurement_timestamp)",
+}
+
+// AggregateMeasurements groups measurements matching the filter in buckets of the given interval.
+// Buckets are aligned to the unix epoch and sorted ascending, empty buckets are not returned.
+// With an hourly or daily resolution the buckets are calculated from the rollups instead of the measurements.
+func (s *MeasurementStorePSQL) AggregateMeasurements(ctx context.Context, filter measurements.Filter, opts measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+	timeColumn, expressions := "measurement_timestamp", aggregateExpressions
+	rollupTable, isRollup := rollupTables[opts.Resolution]
+	if isRollup {
+		timeColumn, expressions = "bucket", rollupAggregateExpressions
+	}
+
+	// The alias differs from the bucket column of rollups, which would take precedence in the group by
+	q := pq.Select().Column(
+		"time_bucket(?::interval, "+timeColumn+", TIMESTAMPTZ '1970-01-01 00:00:00+00') AS aggregate_bucket",
+		fmt.Sprintf("%d microseconds", opts.Interval.Microseconds()),
+	)
+	for _, fn := range opts.Functions {
+		expr, ok := expressions[fn]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", measurements.ErrAggregateFunctionInvalid, fn)
+		}
+		q = q.Column(expr)
+	}
+	if isRollup {
+		q = applyRollupFilter(q.From(rollupTable), filter)
+	} else {
+		q = applyMeasurementFilter(q.From("measurements"), filter)
+	}
+	q = q.GroupBy("aggregate_bucket").OrderBy("aggregate_bucket ASC")
+
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	params = append([]any{pgx.QueryExecModeSimpleProtocol}, params...)
+
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating measurements: %w", err)
+	}
+	defer rows.Close()
+
+	aggregates := []measurements.Aggregate{}
+	values := make([]*float64, len(opts.Functions))
+	dest := make([]any, len(opts.Functions)+1)
+	for ix := range values {
+		dest[ix+1] = &values[ix]
+	}
+	for rows.Next() {
+		var aggregate measurements.Aggregate
+		dest[0] = &aggregate.Bucket
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		aggregate.Values = make(map[measurements.AggregateFunction]*float64, len(opts.Functions))
+		for ix, fn := range opts.Functions {
+			aggregate.Values[fn] = values[ix]
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return aggregates, nil
+}
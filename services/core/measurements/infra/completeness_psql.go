@@ -0,0 +1,141 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// reportingStatsQuery uses the (datastream_id, measurement_timestamp DESC) index for every datastream to find
+// the last measurement and learn the interval from the most recent measurements. Measurements with identical
+// timestamps do not shorten the learned interval. The measurements in the whole hours of the time range, $5 up to
+// $6, are counted from the hourly rollups, only the partial hours at the edges are counted from the raw measurements.
+var reportingStatsQuery = fmt.Sprintf(`
+	SELECT ds.id, ds.sensor_id, ds.observed_property, last.ts, learned.seconds, received.count
+	FROM datastreams ds
+	LEFT JOIN LATERAL (
+		SELECT measurement_timestamp AS ts FROM measurements
+		WHERE datastream_id = ds.id ORDER BY measurement_timestamp DESC LIMIT 1
+	) last ON true
+	LEFT JOIN LATERAL (
+		SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY diff) AS seconds FROM (
+			SELECT EXTRACT(EPOCH FROM lag(ts) OVER (ORDER BY ts DESC) - ts) AS diff FROM (
+				SELECT measurement_timestamp AS ts FROM measurements
+				WHERE datastream_id = ds.id AND measurement_timestamp < $3
+				ORDER BY measurement_timestamp DESC LIMIT %d
+			) recent
+		) diffs WHERE diff > 0
+	) learned ON true
+	CROSS JOIN LATERAL (
+		SELECT (
+			SELECT COALESCE(sum(value_count), 0) FROM measurement_rollups_hourly
+			WHERE datastream_id = ds.id AND bucket >= $5 AND bucket < $6
+		) + (
+			SELECT count(*) FROM measurements
+			WHERE datastream_id = ds.id AND (
+				(measurement_timestamp >= $2 AND measurement_timestamp < $5) OR
+				(measurement_timestamp >= $6 AND measurement_timestamp < $3)
+			)
+		) AS count
+	) received
+	WHERE ds.tenant_id = $1 AND (cardinality($4::uuid[]) = 0 OR ds.id = ANY($4))
+	ORDER BY ds.id`,
+	measurements.ReportingIntervalSamples,
+)
+
+func (s *MeasurementStorePSQL) ListReportingStats(
+	ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start, end time.Time,
+) ([]measurements.ReportingStats, error) {
+	if datastreamIDs == nil {
+		datastreamIDs = []uuid.UUID{}
+	}
+	hoursStart, hoursEnd := start.Truncate(time.Hour), end.Truncate(time.Hour)
+	if hoursStart.Before(start) {
+		hoursStart = hoursStart.Add(time.Hour)
+	}
+	if !hoursStart.Before(hoursEnd) {
+		hoursStart, hoursEnd = end, end
+	}
+	rows, err := s.databasePool.Query(ctx, reportingStatsQuery, tenantID, start, end, datastreamIDs, hoursStart, hoursEnd)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting reporting stats from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []measurements.ReportingStats{}
+	for rows.Next() {
+		var stats measurements.ReportingStats
+		var seconds *float64
+		if err := rows.Scan(
+			&stats.DatastreamID, &stats.SensorID, &stats.ObservedProperty, &stats.LastSeen, &seconds, &stats.Received,
+		); err != nil {
+			return nil, err
+		}
+		if seconds != nil {
+			interval := time.Duration(*seconds * float64(time.Second))
+			stats.LearnedInterval = &interval
+		}
+		list = append(list, stats)
+	}
+	return list, rows.Err()
+}
+
+func (s *MeasurementStorePSQL) ListDailyCounts(ctx context.Context, datastreamID uuid.UUID, start, end time.Time) ([]measurements.DailyCount, error) {
+	rows, err := s.databasePool.Query(ctx, `
+		SELECT
+			date_trunc('day', measurement_timestamp AT TIME ZONE 'UTC') AS day, count(*),
+			min(measurement_timestamp), max(measurement_timestamp)
+		FROM measurements
+		WHERE datastream_id = $1 AND measurement_timestamp >= $2 AND measurement_timestamp < $3
+		GROUP BY day ORDER BY day`,
+		datastreamID, start, end,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting daily counts from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []measurements.DailyCount{}
+	for rows.Next() {
+		var count measurements.DailyCount
+		if err := rows.Scan(&count.Day, &count.Count, &count.First, &count.Last); err != nil {
+			return nil, err
+		}
+		count.Day = time.Date(count.Day.Year(), count.Day.Month(), count.Day.Day(), 0, 0, 0, 0, time.UTC)
+		list = append(list, count)
+	}
+	return list, rows.Err()
+}
+
+func (s *MeasurementStorePSQL) ListGaps(
+	ctx context.Context, datastreamID uuid.UUID, start, end time.Time, threshold time.Duration, limit int,
+) ([]measurements.Gap, error) {
+	rows, err := s.databasePool.Query(ctx, `
+		SELECT previous, ts FROM (
+			SELECT lag(measurement_timestamp) OVER (ORDER BY measurement_timestamp) AS previous, measurement_timestamp AS ts
+			FROM measurements
+			WHERE datastream_id = $1 AND measurement_timestamp >= $2 AND measurement_timestamp < $3
+		) consecutive
+		WHERE EXTRACT(EPOCH FROM ts - previous) > $4
+		ORDER BY previous LIMIT $5`,
+		datastreamID, start, end, threshold.Seconds(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting gaps from db: %w", err)
+	}
+	defer rows.Close()
+
+	gaps := []measurements.Gap{}
+	for rows.Next() {
+		var from, to time.Time
+		if err := rows.Scan(&from, &to); err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, measurements.Gap{Start: from, End: to, DurationSeconds: int64(to.Sub(from).Seconds())})
+	}
+	return gaps, rows.Err()
+}
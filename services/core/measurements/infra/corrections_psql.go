@@ -0,0 +1,254 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// ApplyCorrection deletes or overwrites the measurements in the range of the correction in a single transaction.
+// The affected measurements are locked and recorded first, only those are changed. Measurements that are
+// stored concurrently in the same range are therefore left untouched instead of changed without a record.
+// The corrections of the recalculations are applied and the recalculated measurements are stored in the same
+// transaction, which is retried like StoreMeasurements if it conflicts with measurements stored concurrently.
+func (s *MeasurementStorePSQL) ApplyCorrection(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+	return retryIdentityConflicts(func() error {
+		tx, err := s.databasePool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("apply correction, could not start transaction: %w", err)
+		}
+		defer tx.Rollback(ctx) //nolint:errcheck
+
+		// The rollups are locked before the measurements, in the same order as when storing measurements
+		datastreamIDs := []uuid.UUID{correction.DatastreamID}
+		for _, recalculation := range recalculations {
+			datastreamIDs = append(datastreamIDs, recalculation.Correction.DatastreamID)
+		}
+		if err := lockRollups(ctx, tx, datastreamIDs); err != nil {
+			return fmt.Errorf("apply correction: %w", err)
+		}
+		original, err := s.applyCorrection(ctx, tx, correction)
+		if err != nil {
+			return err
+		}
+		recalculatedOriginals := make([][]measurements.OriginalMeasurement, len(recalculations))
+		recalculated := []measurements.Measurement{}
+		for ix, recalculation := range recalculations {
+			recalculatedOriginals[ix], err = s.applyCorrection(ctx, tx, recalculation.Correction)
+			if err != nil {
+				return fmt.Errorf("recalculate derived datastream %s: %w", recalculation.Correction.DatastreamID, err)
+			}
+			recalculated = append(recalculated, recalculation.Measurements...)
+		}
+		stored := map[int64]int{}
+		if len(recalculated) > 0 {
+			if stored, err = s.storeMeasurements(ctx, tx, recalculated); err != nil {
+				return fmt.Errorf("apply correction, could not store recalculated measurements: %w", err)
+			}
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("apply correction, could not commit: %w", err)
+		}
+		correction.Original = original
+		ordinal := int64(1)
+		for ix, recalculation := range recalculations {
+			recalculation.Correction.Original = recalculatedOriginals[ix]
+			for jx := range recalculation.Measurements {
+				recalculation.Measurements[jx].ID = stored[ordinal]
+				ordinal++
+			}
+		}
+		return nil
+	})
+}
+
+// applyCorrection records the correction and changes the measurements it selects in the transaction, it returns the
+// measurements as they were before. The rollups of the datastream must be locked.
+func (s *MeasurementStorePSQL) applyCorrection(ctx context.Context, tx pgx.Tx, correction *measurements.Correction) ([]measurements.OriginalMeasurement, error) {
+	// One measurement more than allowed is locked to find out whether the correction is too large
+	rows, err := tx.Query(ctx, `
+		SELECT id, measurement_timestamp, measurement_value, measurement_quality FROM measurements
+		WHERE datastream_id = $1 AND measurement_timestamp >= $2 AND measurement_timestamp <= $3
+		ORDER BY measurement_timestamp, id
+		LIMIT $4
+		FOR UPDATE`,
+		correction.DatastreamID, correction.Start, correction.End, measurements.MaxCorrectedMeasurements+1,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("apply correction, could not select measurements: %w", err)
+	}
+	original := []measurements.OriginalMeasurement{}
+	ids := []int64{}
+	for rows.Next() {
+		var m measurements.OriginalMeasurement
+		if err := rows.Scan(&m.ID, &m.Timestamp, &m.Value, &m.Quality); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		original = append(original, m)
+		ids = append(ids, m.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("apply correction, could not select measurements: %w", err)
+	}
+	if len(original) > measurements.MaxCorrectedMeasurements {
+		return nil, measurements.ErrCorrectionTooLarge
+	}
+
+	datastreamIDs := make([]uuid.UUID, len(original))
+	timestamps := make([]time.Time, len(original))
+	for ix, m := range original {
+		datastreamIDs[ix], timestamps[ix] = correction.DatastreamID, m.Timestamp
+	}
+	rollups, err := s.snapshotRollups(ctx, tx, datastreamIDs, timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("apply correction: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO measurement_corrections (
+			tenant_id, datastream_id, action, range_start, range_end, reason,
+			value, factor, offset_value, performed_by, performed_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`,
+		correction.TenantID, correction.DatastreamID, correction.Action, correction.Start, correction.End,
+		correction.Reason, correction.Value, correction.Factor, correction.Offset, correction.PerformedBy,
+		correction.PerformedAt,
+	).Scan(&correction.ID)
+	if err != nil {
+		return nil, fmt.Errorf("apply correction, could not record correction: %w", err)
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"measurement_correction_originals"},
+		[]string{"correction_id", "measurement_id", "measurement_timestamp", "measurement_value", "measurement_quality"},
+		pgx.CopyFromSlice(len(original), func(ix int) ([]any, error) {
+			m := original[ix]
+			return []any{correction.ID, m.ID, m.Timestamp, m.Value, int(m.Quality)}, nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("apply correction, could not record original measurements: %w", err)
+	}
+
+	// The range is repeated so that only the relevant chunks are scanned
+	switch correction.Action {
+	case measurements.CorrectionDelete:
+		_, err = tx.Exec(ctx, `
+			DELETE FROM measurements
+			WHERE datastream_id = $1 AND measurement_timestamp >= $2 AND measurement_timestamp <= $3 AND id = ANY($4)`,
+			correction.DatastreamID, correction.Start, correction.End, ids,
+		)
+	case measurements.CorrectionOverwrite:
+		_, err = tx.Exec(ctx, `
+			UPDATE measurements SET
+				measurement_value = COALESCE($5, measurement_value * COALESCE($6, 1) + COALESCE($7, 0)),
+				measurement_correction_id = $8
+			WHERE datastream_id = $1 AND measurement_timestamp >= $2 AND measurement_timestamp <= $3 AND id = ANY($4)`,
+			correction.DatastreamID, correction.Start, correction.End, ids,
+			correction.Value, correction.Factor, correction.Offset, correction.ID,
+		)
+	default:
+		err = fmt.Errorf("unknown correction action: %s", correction.Action)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("apply correction: %w", err)
+	}
+	if err := s.refreshRollups(ctx, tx, rollups); err != nil {
+		return nil, fmt.Errorf("apply correction: %w", err)
+	}
+
+	return original, nil
+}
+
+type correctionPageQuery struct {
+	PerformedAt time.Time `pagination:"performed_at,DESC"`
+	ID          int64     `pagination:"id,DESC"`
+}
+
+func (s *MeasurementStorePSQL) ListCorrections(ctx context.Context, datastreamID uuid.UUID, r pagination.Request) (*pagination.Page[measurements.Correction], error) {
+	q := pq.Select(
+		"id", "tenant_id", "datastream_id", "action", "range_start", "range_end", "reason",
+		"value", "factor", "offset_value", "performed_by", "performed_at",
+	).From("measurement_corrections").Where("datastream_id = ?", datastreamID)
+
+	cursor, err := pagination.GetCursor[correctionPageQuery](r)
+	if err != nil {
+		return nil, fmt.Errorf("list corrections, error getting pagination cursor: %w", err)
+	}
+	q, err = pagination.Apply(q, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting corrections from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]measurements.Correction, 0, cursor.Limit)
+	for rows.Next() {
+		var c measurements.Correction
+		err := rows.Scan(
+			&c.ID, &c.TenantID, &c.DatastreamID, &c.Action, &c.Start, &c.End, &c.Reason,
+			&c.Value, &c.Factor, &c.Offset, &c.PerformedBy, &c.PerformedAt,
+			&cursor.Columns.PerformedAt,
+			&cursor.Columns.ID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.listCorrectionOriginals(ctx, list); err != nil {
+		return nil, err
+	}
+
+	page := pagination.CreatePageT(list, cursor)
+	return &page, nil
+}
+
+// listCorrectionOriginals sets the original measurements of the corrections
+func (s *MeasurementStorePSQL) listCorrectionOriginals(ctx context.Context, list []measurements.Correction) error {
+	byID := make(map[int64]*measurements.Correction, len(list))
+	ids := make([]int64, len(list))
+	for ix := range list {
+		list[ix].Original = []measurements.OriginalMeasurement{}
+		byID[list[ix].ID] = &list[ix]
+		ids[ix] = list[ix].ID
+	}
+	rows, err := s.databasePool.Query(ctx, `
+		SELECT correction_id, measurement_id, measurement_timestamp, measurement_value, measurement_quality
+		FROM measurement_correction_originals WHERE correction_id = ANY($1)
+		ORDER BY correction_id, measurement_timestamp, measurement_id`,
+		ids,
+	)
+	if err != nil {
+		return fmt.Errorf("error selecting original measurements of corrections from db: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var correctionID int64
+		var m measurements.OriginalMeasurement
+		if err := rows.Scan(&correctionID, &m.ID, &m.Timestamp, &m.Value, &m.Quality); err != nil {
+			return err
+		}
+		c := byID[correctionID]
+		c.Original = append(c.Original, m)
+	}
+	return rows.Err()
+}
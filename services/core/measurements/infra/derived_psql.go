@@ -0,0 +1,121 @@
+package measurementsinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// CreateDerivedDatastream creates the datastream with its derivation and sources in a single transaction
+func (s *MeasurementStorePSQL) CreateDerivedDatastream(ctx context.Context, derived *measurements.DerivedDatastream) error {
+	tx, err := s.databasePool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("create derived datastream, could not start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO datastreams (
+			id, description, sensor_id, observed_property, unit_of_measurement, created_at, tenant_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		derived.ID, derived.Description, derived.SensorID, derived.ObservedProperty,
+		derived.UnitOfMeasurement, derived.CreatedAt, derived.TenantID,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return measurements.ErrDatastreamExists
+	}
+	if err != nil {
+		return fmt.Errorf("create derived datastream, could not insert datastream: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO datastream_derivations (datastream_id, tenant_id, expression, tolerance_seconds)
+		VALUES ($1, $2, $3, $4)`,
+		derived.ID, derived.TenantID, derived.Derivation.Expression, derived.Derivation.ToleranceSeconds,
+	)
+	if err != nil {
+		return fmt.Errorf("create derived datastream, could not insert derivation: %w", err)
+	}
+	for _, src := range derived.Derivation.Sources {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO datastream_derivation_sources (datastream_id, variable, source_datastream_id)
+			VALUES ($1, $2, $3)`,
+			derived.ID, src.Variable, src.DatastreamID,
+		)
+		if err != nil {
+			return fmt.Errorf("create derived datastream, could not insert source: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("create derived datastream, could not commit: %w", err)
+	}
+	return nil
+}
+
+// derivedDatastreamQuery selects derived datastreams with their sources aggregated as json array
+var derivedDatastreamQuery = pq.Select(
+	"ds.id", "ds.description", "ds.sensor_id", "ds.observed_property", "ds.unit_of_measurement", "ds.created_at",
+	"ds.quality_rules", "ds.archive_time", "ds.tenant_id", "d.expression", "d.tolerance_seconds",
+	`(SELECT json_agg(json_build_object('variable', src.variable, 'datastream_id', src.source_datastream_id) ORDER BY src.variable)
+		FROM datastream_derivation_sources src WHERE src.datastream_id = d.datastream_id)`,
+).From("datastream_derivations d").Join("datastreams ds ON ds.id = d.datastream_id")
+
+func (s *MeasurementStorePSQL) queryDerivedDatastreams(ctx context.Context, q sq.SelectBuilder) ([]measurements.DerivedDatastream, error) {
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting derived datastreams from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []measurements.DerivedDatastream{}
+	for rows.Next() {
+		var d measurements.DerivedDatastream
+		err := rows.Scan(
+			&d.ID, &d.Description, &d.SensorID, &d.ObservedProperty, &d.UnitOfMeasurement, &d.CreatedAt,
+			&d.QualityRules, &d.ArchiveTime, &d.TenantID, &d.Derivation.Expression, &d.Derivation.ToleranceSeconds,
+			&d.Derivation.Sources,
+		)
+		if err != nil {
+			return nil, err
+		}
+		d.Derivation.DatastreamID = d.ID
+		d.Derivation.TenantID = d.TenantID
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+func (s *MeasurementStorePSQL) GetDerivedDatastream(ctx context.Context, id uuid.UUID, tenantID int64) (*measurements.DerivedDatastream, error) {
+	list, err := s.queryDerivedDatastreams(ctx, derivedDatastreamQuery.Where(sq.Eq{
+		"d.datastream_id": id,
+		"d.tenant_id":     tenantID,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, measurements.ErrDerivationNotFound
+	}
+	return &list[0], nil
+}
+
+func (s *MeasurementStorePSQL) ListDerivedDatastreams(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+	if len(sourceIDs) == 0 {
+		return nil, nil
+	}
+	return s.queryDerivedDatastreams(ctx, derivedDatastreamQuery.Where(
+		"d.datastream_id IN (SELECT datastream_id FROM datastream_derivation_sources WHERE source_datastream_id = ANY(?))",
+		sourceIDs,
+	))
+}
@@ -0,0 +1,66 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// exportFetchSize is the amount of rows fetched from the server-side cursor at once
+const exportFetchSize = 1000
+
+// ExportMeasurements streams all measurements matching the filter to fn, ordered by timestamp ascending.
+// A server-side cursor is used so that only exportFetchSize rows are held in memory at any time.
+func (s *MeasurementStorePSQL) ExportMeasurements(ctx context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+	q := pq.Select(measurementColumns...).From("measurements")
+	q = applyMeasurementFilter(q, filter)
+	q = q.OrderBy("measurement_timestamp ASC", "id ASC")
+	query, params, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.databasePool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("export measurements, could not start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	params = append([]any{pgx.QueryExecModeSimpleProtocol}, params...)
+	if _, err := tx.Exec(ctx, "DECLARE measurements_export NO SCROLL CURSOR FOR "+query, params...); err != nil {
+		return fmt.Errorf("export measurements, could not declare cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM measurements_export", exportFetchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return fmt.Errorf("export measurements, could not fetch from cursor: %w", err)
+		}
+		count := 0
+		for rows.Next() {
+			var m measurements.Measurement
+			if err := rows.Scan(measurementScanTargets(&m)...); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := fn(m); err != nil {
+				rows.Close()
+				return err
+			}
+			count++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if count < exportFetchSize {
+			break
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,74 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+type latestMeasurementPageQuery struct {
+	CreatedAt time.Time `pagination:"ds.created_at,ASC"`
+	ID        uuid.UUID `pagination:"ds.id,ASC"`
+}
+
+// ListLatestMeasurements returns the latest measurement for each datastream matching the filter.
+// For every datastream a single row is looked up using the (datastream_id, measurement_timestamp DESC) index,
+// which is cheap regardless of the amount of measurements in the datastream.
+func (s *MeasurementStorePSQL) ListLatestMeasurements(ctx context.Context, filter measurements.DatastreamFilter, r pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+	datastreams := applyDatastreamFilter(sq.Select("id", "created_at").From("datastreams"), filter)
+
+	q := pq.Select("m.*").
+		FromSelect(datastreams, "ds").
+		JoinClause(
+			"CROSS JOIN LATERAL (SELECT " + strings.Join(measurementColumns, ", ") +
+				" FROM measurements WHERE datastream_id = ds.id ORDER BY measurement_timestamp DESC LIMIT 1) m",
+		)
+
+	cursor, err := pagination.GetCursor[latestMeasurementPageQuery](r)
+	if err != nil {
+		return nil, fmt.Errorf("list latest measurements, error getting pagination cursor: %w", err)
+	}
+	q, err = pagination.Apply(q, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	params = append([]any{pgx.QueryExecModeSimpleProtocol}, params...)
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting latest measurements from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]measurements.Measurement, 0, cursor.Limit)
+	for rows.Next() {
+		var m measurements.Measurement
+		err = rows.Scan(append(
+			measurementScanTargets(&m),
+			&cursor.Columns.CreatedAt,
+			&cursor.Columns.ID,
+		)...)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := pagination.CreatePageT(list, cursor)
+	return &page, nil
+}
@@ -2,12 +2,15 @@ package measurementsinfra_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"embed"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/samber/lo"
@@ -27,6 +30,24 @@ import (
 var seedFS embed.FS
 
 func createPostgresServer(t *testing.T) *pgxpool.Pool {
+	ctx := context.Background()
+	pool := startPostgresServer(t)
+	dbconn := stdlib.OpenDBFromPool(pool)
+	err := migrations.MigratePostgres(dbconn)
+	dbconn.Close()
+	require.NoError(t, err, "failed to migrate database")
+
+	// Seed data
+	seedSQL, err := seedFS.ReadFile("seed_test.sql")
+	require.NoError(t, err, "failed to read seed_test.sql")
+	_, err = pool.Exec(ctx, string(seedSQL))
+	require.NoError(t, err)
+
+	return pool
+}
+
+// startPostgresServer starts a database without migrating it
+func startPostgresServer(t *testing.T) *pgxpool.Pool {
 	ctx := context.Background()
 	req := testcontainers.ContainerRequest{
 		Image: "docker.io/timescale/timescaledb-ha:pg15-oss",
@@ -63,17 +84,6 @@ func createPostgresServer(t *testing.T) *pgxpool.Pool {
 	require.NoError(t, err)
 	_, err = pool.Exec(ctx, "CREATE EXTENSION postgis;")
 	require.NoError(t, err)
-	dbconn := stdlib.OpenDBFromPool(pool)
-	err = migrations.MigratePostgres(dbconn)
-	dbconn.Close()
-	require.NoError(t, err, "failed to migrate database")
-
-	// Seed data
-	seedSQL, err := seedFS.ReadFile("seed_test.sql")
-	require.NoError(t, err, "failed to read seed_test.sql")
-	_, err = pool.Exec(ctx, string(seedSQL))
-	require.NoError(t, err)
-
 	return pool
 }
 
@@ -83,6 +93,22 @@ func timeParse(t *testing.T, s string) time.Time {
 	return tim
 }
 
+// newTestMeasurement returns a measurement of the default tenant for the given datastream, fields that a test
+// depends on are set by the test itself
+func newTestMeasurement(datastreamID uuid.UUID, timestamp time.Time, value float64) measurements.Measurement {
+	return measurements.Measurement{
+		UplinkMessageID:       uuid.NewString(),
+		OrganisationID:        int(authtest.DefaultTenantID),
+		DeviceID:              1,
+		SensorID:              1,
+		DatastreamID:          datastreamID,
+		MeasurementTimestamp:  timestamp,
+		MeasurementValue:      value,
+		MeasurementExpiration: time.Date(2023, 1, 8, 0, 0, 0, 0, time.UTC),
+		CreatedAt:             time.Now(),
+	}
+}
+
 func TestShouldQueryCorrectly(t *testing.T) {
 	db := createPostgresServer(t)
 	store := measurementsinfra.NewPSQL(db)
@@ -139,3 +165,814 @@ func TestDatastreamCreated(t *testing.T) {
 	assert.WithinDuration(t, ds.CreatedAt, ds2.CreatedAt, time.Second)
 	assert.Equal(t, ds.TenantID, ds2.TenantID)
 }
+
+func TestShouldSetDatastreamArchiveTime(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	ds, err := store.FindOrCreateDatastream(ctx, authtest.DefaultTenantID, 1, "none", "#")
+	require.NoError(t, err)
+	assert.Nil(t, ds.ArchiveTime)
+
+	days := 90
+	require.NoError(t, store.SetDatastreamArchiveTime(ctx, ds.ID, &days))
+	ds, err = store.GetDatastream(ctx, ds.ID, measurements.DatastreamFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, &days, ds.ArchiveTime)
+
+	require.NoError(t, store.SetDatastreamArchiveTime(ctx, ds.ID, nil))
+	ds, err = store.FindOrCreateDatastream(ctx, authtest.DefaultTenantID, 1, "none", "#")
+	require.NoError(t, err)
+	assert.Nil(t, ds.ArchiveTime)
+}
+
+func TestShouldAggregateInBuckets(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+
+	aggregates, err := store.AggregateMeasurements(context.Background(), measurements.Filter{
+		Start: timeParse(t, "2022-01-01T00:00:00Z"),
+		End:   timeParse(t, "2022-01-01T07:59:59Z"),
+	}, measurements.AggregationOptions{
+		Interval:  4 * time.Hour,
+		Functions: []measurements.AggregateFunction{measurements.AggregateCount, measurements.AggregateMinimum, measurements.AggregateMaximum},
+	})
+	require.NoError(t, err)
+	require.Len(t, aggregates, 2)
+	assert.Equal(t, timeParse(t, "2022-01-01T00:00:00Z"), aggregates[0].Bucket.UTC())
+	assert.Equal(t, 4.0, *aggregates[0].Values[measurements.AggregateCount])
+	assert.Equal(t, -111.0, *aggregates[0].Values[measurements.AggregateMinimum])
+	assert.Equal(t, -4.5, *aggregates[0].Values[measurements.AggregateMaximum])
+	assert.Equal(t, timeParse(t, "2022-01-01T04:00:00Z"), aggregates[1].Bucket.UTC())
+	assert.Equal(t, 893.12, *aggregates[1].Values[measurements.AggregateMaximum])
+}
+
+func TestShouldExportInTimestampOrder(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+
+	ids := []int{}
+	err := store.ExportMeasurements(context.Background(), measurements.Filter{
+		Start: timeParse(t, "2022-01-01T04:00:00Z"),
+		End:   timeParse(t, "2022-01-01T09:00:00Z"),
+	}, func(m measurements.Measurement) error {
+		ids = append(ids, m.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 6, 7, 8, 9, 10}, ids)
+}
+
+func TestShouldListLatestMeasurementPerDatastream(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+
+	// Measurement 6 in the seed data belongs to this datastream
+	ds := &measurements.Datastream{
+		ID:                uuid.MustParse("ec4d3e1f-be86-44c6-b6af-27143ac7b158"),
+		SensorID:          17,
+		ObservedProperty:  "latest",
+		UnitOfMeasurement: "#",
+		CreatedAt:         time.Now(),
+		TenantID:          authtest.DefaultTenantID,
+	}
+	require.NoError(t, store.CreateDatastream(context.Background(), ds))
+
+	page, err := store.ListLatestMeasurements(context.Background(), measurements.DatastreamFilter{
+		TenantID: []int64{authtest.DefaultTenantID},
+	}, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, 6, page.Data[0].ID)
+	assert.Equal(t, ds.ID, page.Data[0].DatastreamID)
+}
+
+func TestShouldStoreMeasurementsInBatch(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+
+	datastreamID := uuid.New()
+	base := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:00:00Z"), 0)
+	base.DeviceCode = "batch"
+	base.DeviceLatitude, base.DeviceLongitude = lo.ToPtr(51.5), lo.ToPtr(3.6)
+	base.MeasurementLatitude, base.MeasurementLongitude = lo.ToPtr(51.5), lo.ToPtr(3.6)
+	second := base
+	second.MeasurementTimestamp = timeParse(t, "2023-01-01T01:00:00Z")
+	second.MeasurementValue = 2
+	second.MeasurementProperties = map[string]any{"rssi": -80.0}
+
+	err := store.StoreMeasurements(context.Background(), []measurements.Measurement{base, second})
+	require.NoError(t, err)
+
+	page, err := store.Query(context.Background(), measurements.Filter{
+		Datastream: []string{datastreamID.String()},
+	}, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, 2.0, page.Data[0].MeasurementValue)
+	assert.InDelta(t, 51.5, *page.Data[0].MeasurementLatitude, 0.0001)
+	assert.InDelta(t, 3.6, *page.Data[0].MeasurementLongitude, 0.0001)
+}
+
+func TestShouldFilterMeasurementsOnQuality(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+
+	datastreamID := uuid.New()
+	good := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:00:00Z"), 0)
+	outOfRange := good
+	outOfRange.MeasurementTimestamp = timeParse(t, "2023-01-01T01:00:00Z")
+	outOfRange.MeasurementValue = 900
+	outOfRange.MeasurementQuality = measurements.QualityRange | measurements.QualityRateOfChange
+	flatline := good
+	flatline.MeasurementTimestamp = timeParse(t, "2023-01-01T02:00:00Z")
+	flatline.MeasurementQuality = measurements.QualityFlatline
+	require.NoError(t, store.StoreMeasurements(context.Background(), []measurements.Measurement{good, outOfRange, flatline}))
+
+	query := func(quality ...string) []measurements.Measurement {
+		page, err := store.Query(context.Background(), measurements.Filter{
+			Datastream: []string{datastreamID.String()},
+			Quality:    quality,
+		}, pagination.Request{})
+		require.NoError(t, err)
+		return page.Data
+	}
+	assert.Len(t, query(), 3)
+	assert.Len(t, query("good"), 1)
+	assert.Len(t, query("suspect"), 2)
+	if ms := query("range"); assert.Len(t, ms, 1) {
+		assert.Equal(t, measurements.QualityRange|measurements.QualityRateOfChange, ms[0].MeasurementQuality)
+	}
+	assert.Len(t, query("good", "flatline"), 2)
+
+	samples, err := store.ListRecentSamples(context.Background(), datastreamID, flatline.MeasurementTimestamp, 5)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 900.0, samples[0].Value, "samples should be ordered newest first")
+
+	at, err := store.ListSamplesAt(context.Background(),
+		[]uuid.UUID{datastreamID, datastreamID, uuid.New()},
+		[]time.Time{timeParse(t, "2023-01-01T01:30:00Z"), good.MeasurementTimestamp, flatline.MeasurementTimestamp},
+	)
+	require.NoError(t, err)
+	require.Len(t, at, 3)
+	assert.Equal(t, 900.0, at[0].Value)
+	assert.Equal(t, good.MeasurementTimestamp, at[1].Timestamp.UTC(), "a sample at the time itself should be included")
+	assert.Nil(t, at[2])
+}
+
+func TestShouldFilterMeasurementsOnProperties(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+
+	datastreamID := uuid.New()
+	list := []measurements.Measurement{}
+	for ix, properties := range []map[string]any{
+		{"gateway_eui": "0011", "rssi": -80, "meta": map[string]any{"channel": 3}},
+		{"gateway_eui": "0011", "rssi": -100},
+		{"gateway_eui": "0022", "rssi": "unknown"},
+		nil,
+	} {
+		m := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:00:00Z").Add(time.Duration(ix)*time.Hour), 0)
+		m.MeasurementProperties = properties
+		list = append(list, m)
+	}
+	require.NoError(t, store.StoreMeasurements(context.Background(), list))
+
+	query := func(properties string, conditions ...string) []measurements.Measurement {
+		filter := measurements.Filter{Datastream: []string{datastreamID.String()}, Property: conditions}
+		if properties != "" {
+			filter.Properties = json.RawMessage(properties)
+		}
+		page, err := store.Query(context.Background(), filter, pagination.Request{})
+		require.NoError(t, err)
+		return page.Data
+	}
+	assert.Len(t, query(`{"gateway_eui":"0011"}`), 2)
+	assert.Len(t, query(`{"meta":{"channel":3}}`), 1)
+	assert.Len(t, query("", "gateway_eui=0011"), 2)
+	assert.Len(t, query("", "meta.channel=3"), 1)
+	assert.Len(t, query("", "gateway_eui!=0011"), 2, "measurements without the property are not equal")
+	assert.Len(t, query("", "rssi>=-90"), 1, "non numeric properties are never ordered")
+	assert.Len(t, query(`{"gateway_eui":"0011"}`, "rssi<-90"), 1)
+}
+
+func TestStoreMeasurementsShouldCallCommitHooksInTransaction(t *testing.T) {
+	db := createPostgresServer(t)
+	var hooked []measurements.Measurement
+	hookErr := errors.New("hook failed")
+	fail := false
+	store := measurementsinfra.NewPSQL(db).WithCommitHook(func(ctx context.Context, tx pgx.Tx, stored []measurements.Measurement) error {
+		hooked = stored
+		if fail {
+			return hookErr
+		}
+		return nil
+	})
+	datastreamID := uuid.New()
+	first := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:00:00Z"), 1)
+	second := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:01:00Z"), 2)
+	list := []measurements.Measurement{first, second}
+	require.NoError(t, store.StoreMeasurements(context.Background(), list))
+	require.Len(t, hooked, 2)
+	assert.Equal(t, list[0].ID, hooked[0].ID)
+	assert.NotZero(t, hooked[1].ID)
+
+	// Ignored replays are not passed to the hooks
+	hooked = nil
+	require.NoError(t, store.StoreMeasurements(context.Background(), []measurements.Measurement{first}))
+	assert.Nil(t, hooked)
+
+	// A failing hook rolls back the measurements
+	fail = true
+	third := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:02:00Z"), 3)
+	assert.ErrorIs(t, store.StoreMeasurements(context.Background(), []measurements.Measurement{third}), hookErr)
+	page, err := store.Query(context.Background(), measurements.Filter{
+		Datastream: []string{datastreamID.String()},
+	}, pagination.Request{})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 2)
+}
+
+func TestStoreMeasurementsShouldApplyConflictPolicy(t *testing.T) {
+	db := createPostgresServer(t)
+
+	testCases := []struct {
+		policy   measurements.ConflictPolicy
+		expected []float64
+		stored   int
+	}{
+		{policy: measurements.ConflictIgnore, expected: []float64{2, 1}, stored: 0},
+		{policy: measurements.ConflictOverwrite, expected: []float64{2, 4}, stored: 1},
+		{policy: measurements.ConflictKeepBoth, expected: []float64{2, 1, 3, 4}, stored: 2},
+	}
+	for _, tC := range testCases {
+		t.Run(string(tC.policy), func(t *testing.T) {
+			store := measurementsinfra.NewPSQL(db).WithConflictPolicy(tC.policy)
+			datastreamID := uuid.New()
+			base := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:00:00Z"), 1)
+			otherChannel := base
+			otherChannel.MeasurementDiscriminator = "b"
+			otherChannel.MeasurementValue = 2
+			require.NoError(t, store.StoreMeasurements(context.Background(), []measurements.Measurement{base, otherChannel}))
+
+			// A replay of the first measurement, twice in the same batch
+			replay := base
+			replay.MeasurementValue = 3
+			secondReplay := base
+			secondReplay.MeasurementValue = 4
+			replays := []measurements.Measurement{replay, secondReplay}
+			require.NoError(t, store.StoreMeasurements(context.Background(), replays))
+			assert.Equal(t, tC.stored, lo.CountBy(replays, func(m measurements.Measurement) bool { return m.ID != 0 }))
+
+			page, err := store.Query(context.Background(), measurements.Filter{
+				Datastream: []string{datastreamID.String()},
+			}, pagination.Request{})
+			require.NoError(t, err)
+			values := lo.Map(page.Data, func(m measurements.Measurement, _ int) float64 { return m.MeasurementValue })
+			assert.ElementsMatch(t, tC.expected, values)
+		})
+	}
+}
+
+func TestApplyCorrectionShouldRecordOriginalMeasurements(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	datastreamID := uuid.New()
+	list := []measurements.Measurement{}
+	for ix := range 4 {
+		list = append(list, newTestMeasurement(
+			datastreamID, timeParse(t, "2023-01-01T00:00:00Z").Add(time.Duration(ix)*time.Hour), float64(ix+1),
+		))
+	}
+	require.NoError(t, store.StoreMeasurements(ctx, list))
+	query := func() []measurements.Measurement {
+		page, err := store.Query(ctx, measurements.Filter{Datastream: []string{datastreamID.String()}}, pagination.Request{})
+		require.NoError(t, err)
+		return page.Data
+	}
+
+	overwrite := &measurements.Correction{
+		DatastreamID: datastreamID,
+		TenantID:     authtest.DefaultTenantID,
+		Action:       measurements.CorrectionOverwrite,
+		Start:        timeParse(t, "2023-01-01T01:00:00Z"),
+		End:          timeParse(t, "2023-01-01T02:00:00Z"),
+		Reason:       "calibration offset",
+		Factor:       lo.ToPtr(2.0),
+		Offset:       lo.ToPtr(1.0),
+		PerformedBy:  authtest.DefaultSub,
+		PerformedAt:  time.Now(),
+	}
+	require.NoError(t, store.ApplyCorrection(ctx, overwrite, nil))
+	require.Len(t, overwrite.Original, 2)
+	assert.Equal(t, 2.0, overwrite.Original[0].Value)
+
+	stored := query()
+	values := lo.Map(stored, func(m measurements.Measurement, _ int) float64 { return m.MeasurementValue })
+	assert.Equal(t, []float64{4, 7, 5, 1}, values)
+	assert.Equal(t, &overwrite.ID, stored[1].MeasurementCorrectionID)
+	assert.Nil(t, stored[0].MeasurementCorrectionID)
+
+	replay := []measurements.Measurement{list[1], list[3]}
+	replay[1].MeasurementValue = 40
+	overwriting := measurementsinfra.NewPSQL(db).WithConflictPolicy(measurements.ConflictOverwrite)
+	require.NoError(t, overwriting.StoreMeasurements(ctx, replay))
+	assert.Zero(t, replay[0].ID, "a replay must not overwrite a corrected measurement")
+	assert.NotZero(t, replay[1].ID)
+	values = lo.Map(query(), func(m measurements.Measurement, _ int) float64 { return m.MeasurementValue })
+	assert.Equal(t, []float64{40, 7, 5, 1}, values)
+
+	remove := &measurements.Correction{
+		DatastreamID: datastreamID,
+		TenantID:     authtest.DefaultTenantID,
+		Action:       measurements.CorrectionDelete,
+		Start:        timeParse(t, "2023-01-01T00:00:00Z"),
+		End:          timeParse(t, "2023-01-01T01:00:00Z"),
+		Reason:       "sensor maintenance",
+		PerformedBy:  authtest.DefaultSub,
+		PerformedAt:  time.Now(),
+	}
+	require.NoError(t, store.ApplyCorrection(ctx, remove, nil))
+	assert.Len(t, remove.Original, 2)
+	assert.Len(t, query(), 2)
+
+	page, err := store.ListCorrections(ctx, datastreamID, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, remove.ID, page.Data[0].ID, "corrections should be listed most recent first")
+	assert.Equal(t, "calibration offset", page.Data[1].Reason)
+	require.Len(t, page.Data[1].Original, 2)
+	assert.Equal(t, overwrite.Original[1].ID, page.Data[1].Original[1].ID)
+	assert.Equal(t, 3.0, page.Data[1].Original[1].Value)
+}
+
+func TestApplyCorrectionShouldReplaceRecalculatedMeasurements(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	sourceID, derivedID := uuid.New(), uuid.New()
+	timestamp := timeParse(t, "2023-01-01T00:00:00Z")
+	require.NoError(t, store.StoreMeasurements(ctx, []measurements.Measurement{
+		newTestMeasurement(sourceID, timestamp, 1),
+		newTestMeasurement(derivedID, timestamp, 2),
+	}))
+
+	correction := &measurements.Correction{
+		DatastreamID: sourceID,
+		TenantID:     authtest.DefaultTenantID,
+		Action:       measurements.CorrectionOverwrite,
+		Start:        timestamp,
+		End:          timestamp,
+		Reason:       "calibration",
+		Value:        lo.ToPtr(3.0),
+		PerformedBy:  authtest.DefaultSub,
+		PerformedAt:  time.Now(),
+	}
+	recalculation := measurements.Recalculation{
+		Correction: &measurements.Correction{
+			DatastreamID: derivedID,
+			TenantID:     authtest.DefaultTenantID,
+			Action:       measurements.CorrectionDelete,
+			Start:        timestamp,
+			End:          timestamp,
+			Reason:       "recalculated",
+			PerformedBy:  authtest.DefaultSub,
+			PerformedAt:  correction.PerformedAt,
+		},
+		Measurements: []measurements.Measurement{newTestMeasurement(derivedID, timestamp, 6)},
+	}
+	require.NoError(t, store.ApplyCorrection(ctx, correction, []measurements.Recalculation{recalculation}))
+	require.Len(t, recalculation.Correction.Original, 1)
+	assert.Equal(t, 2.0, recalculation.Correction.Original[0].Value)
+	assert.NotZero(t, recalculation.Measurements[0].ID)
+
+	page, err := store.Query(ctx, measurements.Filter{Datastream: []string{derivedID.String()}}, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, 6.0, page.Data[0].MeasurementValue)
+
+	// Failing to store the recalculated measurements rolls back the correction
+	failing := measurementsinfra.NewPSQL(db).WithCommitHook(func(ctx context.Context, tx pgx.Tx, stored []measurements.Measurement) error {
+		return errors.New("hook failed")
+	})
+	overwrite := *correction
+	overwrite.Value = lo.ToPtr(4.0)
+	require.Error(t, failing.ApplyCorrection(ctx, &overwrite, []measurements.Recalculation{recalculation}))
+	page, err = store.Query(ctx, measurements.Filter{Datastream: []string{sourceID.String()}}, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, 3.0, page.Data[0].MeasurementValue)
+}
+
+func TestCorrectionOriginalsMigrationShouldKeepOriginalMeasurements(t *testing.T) {
+	pool := startPostgresServer(t)
+	ctx := context.Background()
+	dbconn := stdlib.OpenDBFromPool(pool)
+	defer dbconn.Close()
+	require.NoError(t, migrations.MigratePostgresTo(dbconn, 20250416090000))
+
+	datastreamID := uuid.New()
+	_, err := pool.Exec(ctx, `
+		INSERT INTO measurement_corrections (
+			tenant_id, datastream_id, action, range_start, range_end, reason, performed_by, original_measurements
+		) VALUES ($1, $2, 'delete', $3, $3, 'maintenance', 'user', $4)`,
+		authtest.DefaultTenantID, datastreamID, timeParse(t, "2023-01-01T00:00:00Z"),
+		`[{"measurement_id": 2, "measurement_timestamp": "2023-01-01T00:00:00Z", "measurement_value": 1.5, "measurement_quality": ["range", "flatline"]},
+		  {"measurement_id": 1, "measurement_timestamp": "2023-01-01T00:00:00Z", "measurement_value": 2, "measurement_quality": []}]`,
+	)
+	require.NoError(t, err)
+	require.NoError(t, migrations.MigratePostgres(dbconn))
+
+	page, err := measurementsinfra.NewPSQL(pool).ListCorrections(ctx, datastreamID, pagination.Request{})
+	require.NoError(t, err)
+	require.Len(t, page.Data, 1)
+	original := page.Data[0].Original
+	require.Len(t, original, 2)
+	assert.Equal(t, int64(1), original[0].ID)
+	assert.Equal(t, measurements.QualityGood, original[0].Quality)
+	assert.Equal(t, 1.5, original[1].Value)
+	assert.Equal(t, measurements.QualityRange|measurements.QualityFlatline, original[1].Quality)
+}
+
+func TestStoreMeasurementsShouldRetryIdentityConflictsWithConcurrentTransactions(t *testing.T) {
+	db := createPostgresServer(t)
+	ctx := context.Background()
+	datastreamID := uuid.New()
+	timestamp := timeParse(t, "2023-01-01T00:00:00Z")
+
+	// The first transaction holds on to its uncommitted measurement until released
+	hooked, release := make(chan struct{}), make(chan struct{})
+	first := measurementsinfra.NewPSQL(db).WithConflictPolicy(measurements.ConflictKeepBoth).
+		WithCommitHook(func(ctx context.Context, tx pgx.Tx, stored []measurements.Measurement) error {
+			close(hooked)
+			<-release
+			return nil
+		})
+	firstErr := make(chan error, 1)
+	go func() {
+		firstErr <- first.StoreMeasurements(ctx, []measurements.Measurement{newTestMeasurement(datastreamID, timestamp, 1)})
+	}()
+	<-hooked
+
+	// The second transaction numbers its measurement the same and waits on the identity index
+	second := measurementsinfra.NewPSQL(db).WithConflictPolicy(measurements.ConflictKeepBoth)
+	secondErr := make(chan error, 1)
+	list := []measurements.Measurement{newTestMeasurement(datastreamID, timestamp, 2)}
+	go func() {
+		secondErr <- second.StoreMeasurements(ctx, list)
+	}()
+	time.Sleep(500 * time.Millisecond)
+	close(release)
+
+	require.NoError(t, <-firstErr)
+	require.NoError(t, <-secondErr, "the conflict should be resolved by the conflict policy")
+	assert.NotZero(t, list[0].ID)
+	page, err := second.Query(ctx, measurements.Filter{Datastream: []string{datastreamID.String()}}, pagination.Request{})
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 2)
+}
+
+func TestRollupsShouldFollowMeasurements(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	ds := &measurements.Datastream{
+		ID:                uuid.New(),
+		UnitOfMeasurement: "Cel",
+		SensorID:          1,
+		ObservedProperty:  "temperature",
+		CreatedAt:         time.Now(),
+		TenantID:          authtest.DefaultTenantID,
+	}
+	require.NoError(t, store.CreateDatastream(ctx, ds))
+	list := []measurements.Measurement{}
+	for ix := range 6 {
+		list = append(list, newTestMeasurement(
+			ds.ID, timeParse(t, "2023-01-01T00:00:00Z").Add(time.Duration(ix)*30*time.Minute), float64(ix+1),
+		))
+	}
+	require.NoError(t, store.StoreMeasurements(ctx, list))
+
+	filter := measurements.Filter{
+		Start:      timeParse(t, "2023-01-01T00:00:00Z"),
+		End:        timeParse(t, "2023-01-01T23:59:59Z"),
+		Datastream: []string{ds.ID.String()},
+	}
+	aggregate := func(res measurements.Resolution, interval time.Duration) []measurements.Aggregate {
+		aggregates, err := store.AggregateMeasurements(ctx, filter, measurements.AggregationOptions{
+			Interval:   interval,
+			Resolution: res,
+			Functions:  []measurements.AggregateFunction{measurements.AggregateAverage, measurements.AggregateCount, measurements.AggregateMaximum},
+		})
+		require.NoError(t, err)
+		return aggregates
+	}
+	raw := aggregate(measurements.ResolutionRaw, time.Hour)
+	hourly := aggregate(measurements.ResolutionHourly, time.Hour)
+	require.Len(t, hourly, 3)
+	for ix := range raw {
+		assert.Equal(t, raw[ix].Bucket.UTC(), hourly[ix].Bucket.UTC())
+		assert.Equal(t, raw[ix].Values, hourly[ix].Values)
+	}
+	daily := aggregate(measurements.ResolutionDaily, 24*time.Hour)
+	require.Len(t, daily, 1)
+	assert.Equal(t, 6.0, *daily[0].Values[measurements.AggregateCount])
+	assert.Equal(t, 3.5, *daily[0].Values[measurements.AggregateAverage])
+
+	require.NoError(t, store.ApplyCorrection(ctx, &measurements.Correction{
+		DatastreamID: ds.ID,
+		TenantID:     authtest.DefaultTenantID,
+		Action:       measurements.CorrectionDelete,
+		Start:        timeParse(t, "2023-01-01T02:00:00Z"),
+		End:          timeParse(t, "2023-01-01T02:30:00Z"),
+		Reason:       "sensor maintenance",
+		PerformedBy:  authtest.DefaultSub,
+		PerformedAt:  time.Now(),
+	}, nil))
+	assert.Len(t, aggregate(measurements.ResolutionHourly, time.Hour), 2, "empty rollup buckets should be removed")
+	daily = aggregate(measurements.ResolutionDaily, 24*time.Hour)
+	require.Len(t, daily, 1)
+	assert.Equal(t, 4.0, *daily[0].Values[measurements.AggregateCount])
+	assert.Equal(t, 4.0, *daily[0].Values[measurements.AggregateMaximum])
+
+	// A late measurement for a period of which the raw measurements expired is added to the rollups
+	_, err := db.Exec(ctx, `DELETE FROM measurements WHERE datastream_id = $1`, ds.ID)
+	require.NoError(t, err)
+	late := []measurements.Measurement{newTestMeasurement(ds.ID, timeParse(t, "2023-01-01T00:45:00Z"), 0.5)}
+	require.NoError(t, store.StoreMeasurements(ctx, late))
+	hourly = aggregate(measurements.ResolutionHourly, time.Hour)
+	require.Len(t, hourly, 2)
+	assert.Equal(t, 3.0, *hourly[0].Values[measurements.AggregateCount])
+	assert.Equal(t, 3.5/3, *hourly[0].Values[measurements.AggregateAverage])
+	assert.Equal(t, 2.0, *hourly[0].Values[measurements.AggregateMaximum])
+	daily = aggregate(measurements.ResolutionDaily, 24*time.Hour)
+	require.Len(t, daily, 1)
+	assert.Equal(t, 5.0, *daily[0].Values[measurements.AggregateCount])
+	assert.Equal(t, 4.0, *daily[0].Values[measurements.AggregateMaximum])
+}
+
+func TestShouldCreateAndFindDerivedDatastreams(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	sources := []*measurements.Datastream{}
+	for _, obs := range []string{"height", "distance"} {
+		ds := &measurements.Datastream{
+			ID: uuid.New(), SensorID: 1, ObservedProperty: obs, UnitOfMeasurement: "m",
+			CreatedAt: time.Now(), TenantID: authtest.DefaultTenantID,
+		}
+		require.NoError(t, store.CreateDatastream(ctx, ds))
+		sources = append(sources, ds)
+	}
+	derived := &measurements.DerivedDatastream{
+		Datastream: measurements.Datastream{
+			ID: uuid.New(), SensorID: 1, ObservedProperty: "water_level", UnitOfMeasurement: "m",
+			CreatedAt: time.Now(), TenantID: authtest.DefaultTenantID,
+		},
+	}
+	derived.Derivation = measurements.Derivation{
+		DatastreamID:     derived.ID,
+		Expression:       "height - distance",
+		Sources:          []measurements.DerivationSource{{Variable: "distance", DatastreamID: sources[1].ID}, {Variable: "height", DatastreamID: sources[0].ID}},
+		ToleranceSeconds: 60,
+		TenantID:         authtest.DefaultTenantID,
+	}
+	require.NoError(t, store.CreateDerivedDatastream(ctx, derived))
+	assert.ErrorIs(t, store.CreateDerivedDatastream(ctx, derived), measurements.ErrDatastreamExists)
+
+	found, err := store.GetDerivedDatastream(ctx, derived.ID, authtest.DefaultTenantID)
+	require.NoError(t, err)
+	assert.Equal(t, derived.Derivation, found.Derivation)
+	assert.Equal(t, "water_level", found.ObservedProperty)
+	_, err = store.GetDerivedDatastream(ctx, sources[0].ID, authtest.DefaultTenantID)
+	assert.ErrorIs(t, err, measurements.ErrDerivationNotFound)
+
+	list, err := store.ListDerivedDatastreams(ctx, []uuid.UUID{sources[1].ID})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, derived.ID, list[0].ID)
+	list, err = store.ListDerivedDatastreams(ctx, []uuid.UUID{derived.ID})
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestShouldFilterMeasurementsByLocation(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	var featureID int64
+	err := db.QueryRow(ctx, `
+		INSERT INTO features_of_interest (name, encoding_type, feature, tenant_id)
+		VALUES ('harbour', 'application/geo+json', ST_GeomFromText('POLYGON((3.5 51.4, 3.6 51.4, 3.6 51.5, 3.5 51.5, 3.5 51.4))', 4326), $1)
+		RETURNING id`, authtest.DefaultTenantID,
+	).Scan(&featureID)
+	require.NoError(t, err)
+
+	datastreamID := uuid.New()
+	// A moving device, the last measurement has no location
+	locations := [][]float64{{3.55, 51.45}, {3.75, 51.45}, {4.5, 52}, nil}
+	list := []measurements.Measurement{}
+	for ix, loc := range locations {
+		m := newTestMeasurement(datastreamID, timeParse(t, "2023-01-01T00:00:00Z").Add(time.Duration(ix)*time.Hour), float64(ix))
+		if loc != nil {
+			m.MeasurementLongitude, m.MeasurementLatitude = &loc[0], &loc[1]
+		}
+		list = append(list, m)
+	}
+	require.NoError(t, store.StoreMeasurements(ctx, list))
+
+	query := func(filter measurements.Filter) []float64 {
+		filter.Datastream = []string{datastreamID.String()}
+		page, err := store.Query(ctx, filter, pagination.Request{})
+		require.NoError(t, err)
+		return lo.Map(page.Data, func(m measurements.Measurement, _ int) float64 { return m.MeasurementValue })
+	}
+	assert.Equal(t, []float64{1, 0}, query(measurements.Filter{BoundingBox: "3.5,51.4,3.8,51.5"}))
+	assert.Equal(t, []float64{2, 1}, query(measurements.Filter{Polygon: "POLYGON((3.7 51.4, 5 51.4, 5 52.5, 3.7 52.5, 3.7 51.4))"}))
+	assert.Equal(t, []float64{0}, query(measurements.Filter{WithinFeatureOfInterest: []int64{featureID}}))
+	assert.Empty(t, query(measurements.Filter{
+		WithinFeatureOfInterest: []int64{featureID},
+		TenantID:                []int64{authtest.DefaultTenantID + 1},
+	}))
+}
+
+func TestShouldFilterBySensorGroupAndProject(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+	tenantID := authtest.DefaultTenantID
+
+	var deviceID, sensorA, sensorB, featureID, groupID, projectID int64
+	require.NoError(t, db.QueryRow(ctx, `INSERT INTO devices (code, tenant_id) VALUES ('dev', $1) RETURNING id`, tenantID).Scan(&deviceID))
+	require.NoError(t, db.QueryRow(ctx, `
+		INSERT INTO features_of_interest (name, tenant_id) VALUES ('river', $1) RETURNING id`, tenantID,
+	).Scan(&featureID))
+	require.NoError(t, db.QueryRow(ctx, `
+		INSERT INTO sensors (code, external_id, device_id, feature_of_interest_id, tenant_id) VALUES ('a', 'a', $1, $2, $3) RETURNING id`,
+		deviceID, featureID, tenantID,
+	).Scan(&sensorA))
+	require.NoError(t, db.QueryRow(ctx, `
+		INSERT INTO sensors (code, external_id, device_id, tenant_id) VALUES ('b', 'b', $1, $2) RETURNING id`, deviceID, tenantID,
+	).Scan(&sensorB))
+	require.NoError(t, db.QueryRow(ctx, `INSERT INTO sensor_groups (name, tenant_id) VALUES ('group', $1) RETURNING id`, tenantID).Scan(&groupID))
+	_, err := db.Exec(ctx, `INSERT INTO sensor_groups_sensors (sensor_group_id, sensor_id) VALUES ($1, $2)`, groupID, sensorB)
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow(ctx, `INSERT INTO projects (name, tenant_id) VALUES ('project', $1) RETURNING id`, tenantID).Scan(&projectID))
+	_, err = db.Exec(ctx, `
+		INSERT INTO project_feature_of_interest (project_id, feature_of_interest_id, interested_observation_types)
+		VALUES ($1, $2, '{water_level}')`, projectID, featureID,
+	)
+	require.NoError(t, err)
+
+	// Sensor A observes the feature of interest of the project, sensor B is in the sensor group
+	waterLevel, err := store.FindOrCreateDatastream(ctx, tenantID, sensorA, "water_level", "m")
+	require.NoError(t, err)
+	temperature, err := store.FindOrCreateDatastream(ctx, tenantID, sensorA, "temperature", "Cel")
+	require.NoError(t, err)
+	pressure, err := store.FindOrCreateDatastream(ctx, tenantID, sensorB, "pressure", "Pa")
+	require.NoError(t, err)
+
+	list := []measurements.Measurement{}
+	for ix, ds := range []*measurements.Datastream{waterLevel, temperature, pressure} {
+		m := newTestMeasurement(ds.ID, timeParse(t, "2023-01-01T00:00:00Z"), float64(ix))
+		m.DeviceID, m.SensorID, m.DatastreamObservedProperty = deviceID, ds.SensorID, ds.ObservedProperty
+		if ds.SensorID == sensorA {
+			m.FeatureOfInterestID = &featureID
+		}
+		list = append(list, m)
+	}
+	require.NoError(t, store.StoreMeasurements(ctx, list))
+
+	query := func(filter measurements.Filter) []float64 {
+		page, err := store.Query(ctx, filter, pagination.Request{})
+		require.NoError(t, err)
+		return lo.Map(page.Data, func(m measurements.Measurement, _ int) float64 { return m.MeasurementValue })
+	}
+	assert.Equal(t, []float64{2}, query(measurements.Filter{SensorGroup: []int64{groupID}}))
+	assert.Equal(t, []float64{0}, query(measurements.Filter{Project: []int64{projectID}}))
+	assert.Empty(t, query(measurements.Filter{Project: []int64{projectID}, TenantID: []int64{tenantID + 1}}))
+
+	listDatastreams := func(filter measurements.DatastreamFilter) []uuid.UUID {
+		page, err := store.ListDatastreams(ctx, filter, pagination.Request{})
+		require.NoError(t, err)
+		return lo.Map(page.Data, func(ds measurements.Datastream, _ int) uuid.UUID { return ds.ID })
+	}
+	assert.Equal(t, []uuid.UUID{pressure.ID}, listDatastreams(measurements.DatastreamFilter{SensorGroup: []int64{groupID}}))
+	assert.Equal(t, []uuid.UUID{waterLevel.ID}, listDatastreams(measurements.DatastreamFilter{Project: []int64{projectID}}))
+	assert.Empty(t, listDatastreams(measurements.DatastreamFilter{SensorGroup: []int64{groupID}, TenantID: []int64{tenantID + 1}}))
+}
+
+func TestShouldReportDatastreamCompleteness(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	ds, err := store.FindOrCreateDatastream(ctx, authtest.DefaultTenantID, 1, "level", "m")
+	require.NoError(t, err)
+	start := timeParse(t, "2023-01-01T00:00:00Z")
+	// Hourly measurements with the hours 5 to 8 missing
+	list := []measurements.Measurement{}
+	for hour := 0; hour < 30; hour++ {
+		if hour >= 5 && hour < 9 {
+			continue
+		}
+		list = append(list, newTestMeasurement(ds.ID, start.Add(time.Duration(hour)*time.Hour), float64(hour)))
+	}
+	require.NoError(t, store.StoreMeasurements(ctx, list))
+	end := start.Add(48 * time.Hour)
+
+	stats, err := store.ListReportingStats(ctx, authtest.DefaultTenantID, []uuid.UUID{ds.ID}, start, end)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, 26, stats[0].Received)
+	assert.Equal(t, start.Add(29*time.Hour), stats[0].LastSeen.UTC())
+	require.NotNil(t, stats[0].LearnedInterval)
+	assert.Equal(t, time.Hour, *stats[0].LearnedInterval)
+
+	// Partial hours at the edges of the range are counted from the raw measurements
+	stats, err = store.ListReportingStats(ctx, authtest.DefaultTenantID, []uuid.UUID{ds.ID}, start.Add(-30*time.Minute), start.Add(150*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats[0].Received)
+
+	other, err := store.ListReportingStats(ctx, authtest.DefaultTenantID+1, nil, start, end)
+	require.NoError(t, err)
+	assert.Empty(t, other)
+
+	counts, err := store.ListDailyCounts(ctx, ds.ID, start, end)
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+	assert.Equal(t, start, counts[0].Day)
+	assert.Equal(t, 20, counts[0].Count)
+	assert.Equal(t, 6, counts[1].Count)
+	assert.Equal(t, start.Add(29*time.Hour), counts[1].Last.UTC())
+
+	gaps, err := store.ListGaps(ctx, ds.ID, start, end, 90*time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, gaps, 1)
+	assert.Equal(t, start.Add(4*time.Hour), gaps[0].Start.UTC())
+	assert.Equal(t, start.Add(9*time.Hour), gaps[0].End.UTC())
+
+	// Whole hours are counted from the rollups, which are kept after the raw measurements expired
+	_, err = db.Exec(ctx, `DELETE FROM measurements WHERE datastream_id = $1 AND measurement_timestamp < $2`, ds.ID, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	stats, err = store.ListReportingStats(ctx, authtest.DefaultTenantID, []uuid.UUID{ds.ID}, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, 26, stats[0].Received)
+}
+
+func TestShouldSummarizeValuesFromMeasurementsAndRollups(t *testing.T) {
+	db := createPostgresServer(t)
+	store := measurementsinfra.NewPSQL(db)
+	ctx := context.Background()
+
+	ds, err := store.FindOrCreateDatastream(ctx, authtest.DefaultTenantID, 1, "level", "m")
+	require.NoError(t, err)
+	start := timeParse(t, "2023-01-01T00:00:00Z")
+	list := []measurements.Measurement{}
+	for ix := range 6 {
+		list = append(list, newTestMeasurement(ds.ID, start.Add(time.Duration(ix)*30*time.Minute), float64(ix+1)))
+	}
+	require.NoError(t, store.StoreMeasurements(ctx, list))
+
+	for _, res := range []measurements.Resolution{measurements.ResolutionRaw, measurements.ResolutionHourly, measurements.ResolutionDaily} {
+		summaries, err := store.SummarizeValues(ctx, []uuid.UUID{ds.ID}, start, start.Add(24*time.Hour), res)
+		require.NoError(t, err)
+		require.Len(t, summaries, 1, res)
+		assert.Equal(t, int64(6), summaries[0].Count, res)
+		assert.Equal(t, 21.0, summaries[0].Sum, res)
+		require.NotNil(t, summaries[0].SumSquares, res)
+		assert.Equal(t, 91.0, *summaries[0].SumSquares, res)
+		assert.Equal(t, 1.0, summaries[0].Min, res)
+		assert.Equal(t, 6.0, summaries[0].Max, res)
+		assert.Equal(t, start, summaries[0].First.UTC(), res)
+		assert.Equal(t, start.Add(150*time.Minute), summaries[0].Last.UTC(), res)
+	}
+
+	ranges := []measurements.HistogramRange{{DatastreamID: ds.ID, Min: 1, Max: 6, Buckets: 5}}
+	counts, err := store.CountHistogram(ctx, ranges, start, start.Add(24*time.Hour), measurements.ResolutionRaw)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []measurements.HistogramCount{
+		{DatastreamID: ds.ID, Bucket: 0, Count: 1},
+		{DatastreamID: ds.ID, Bucket: 1, Count: 1},
+		{DatastreamID: ds.ID, Bucket: 2, Count: 1},
+		{DatastreamID: ds.ID, Bucket: 3, Count: 1},
+		{DatastreamID: ds.ID, Bucket: 4, Count: 2},
+	}, counts)
+
+	// Hourly rollups have the averages 1.5, 3.5 and 5.5
+	counts, err = store.CountHistogram(ctx, ranges, start, start.Add(24*time.Hour), measurements.ResolutionHourly)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []measurements.HistogramCount{
+		{DatastreamID: ds.ID, Bucket: 0, Count: 2},
+		{DatastreamID: ds.ID, Bucket: 2, Count: 2},
+		{DatastreamID: ds.ID, Bucket: 4, Count: 2},
+	}, counts)
+}
@@ -0,0 +1,85 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// ListRecentSamples returns the last samples of a datastream before the given time, ordered from newest to oldest
+func (s *MeasurementStorePSQL) ListRecentSamples(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+	query, params, err := pq.Select("measurement_timestamp", "measurement_value").
+		From("measurements").
+		Where("datastream_id = ?", datastreamID).
+		Where("measurement_timestamp < ?", before).
+		OrderBy("measurement_timestamp DESC").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting recent samples from db: %w", err)
+	}
+	defer rows.Close()
+
+	samples := make([]measurements.Sample, 0, limit)
+	for rows.Next() {
+		var sample measurements.Sample
+		if err := rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// ListSamplesAt looks up the latest sample of every pair of datastream and time in a single query
+func (s *MeasurementStorePSQL) ListSamplesAt(ctx context.Context, datastreamIDs []uuid.UUID, timestamps []time.Time) ([]*measurements.Sample, error) {
+	rows, err := s.databasePool.Query(ctx, `
+		SELECT s.measurement_timestamp, s.measurement_value
+		FROM unnest($1::uuid[], $2::timestamptz[]) WITH ORDINALITY AS l(datastream_id, at, ordinal)
+		LEFT JOIN LATERAL (
+			SELECT m.measurement_timestamp, m.measurement_value FROM measurements m
+			WHERE m.datastream_id = l.datastream_id AND m.measurement_timestamp <= l.at
+			ORDER BY m.measurement_timestamp DESC LIMIT 1
+		) s ON true
+		ORDER BY l.ordinal`,
+		datastreamIDs, timestamps,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting samples from db: %w", err)
+	}
+	defer rows.Close()
+
+	samples := make([]*measurements.Sample, 0, len(timestamps))
+	for rows.Next() {
+		var timestamp *time.Time
+		var value *float64
+		if err := rows.Scan(&timestamp, &value); err != nil {
+			return nil, err
+		}
+		if timestamp == nil || value == nil {
+			samples = append(samples, nil)
+			continue
+		}
+		samples = append(samples, &measurements.Sample{Timestamp: *timestamp, Value: *value})
+	}
+	return samples, rows.Err()
+}
+
+func (s *MeasurementStorePSQL) SetDatastreamQualityRules(ctx context.Context, datastreamID uuid.UUID, rules measurements.QualityRules) error {
+	_, err := s.databasePool.Exec(ctx,
+		`UPDATE datastreams SET quality_rules = $1 WHERE id = $2`,
+		rules, datastreamID,
+	)
+	if err != nil {
+		return fmt.Errorf("database error updating datastream quality rules: %w", err)
+	}
+	return nil
+}
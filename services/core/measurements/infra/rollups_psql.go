@@ -0,0 +1,312 @@
+package measurementsinfra
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// WithRollupRetention sets the rollup retention for tenants without a retention of their own
+func (s *MeasurementStorePSQL) WithRollupRetention(retention measurements.RollupRetention) *MeasurementStorePSQL {
+	s.rollupRetention = retention
+	return s
+}
+
+var rollupTables = map[measurements.Resolution]string{
+	measurements.ResolutionHourly: "measurement_rollups_hourly",
+	measurements.ResolutionDaily:  "measurement_rollups_daily",
+}
+
+var rollupAggregateExpressions = map[measurements.AggregateFunction]string{
+	measurements.AggregateAverage: "sum(value_sum) / nullif(sum(value_count), 0)",
+	measurements.AggregateMinimum: "min(value_min)",
+	measurements.AggregateMaximum: "max(value_max)",
+	measurements.AggregateSum:     "sum(value_sum)",
+	measurements.AggregateCount:   "sum(value_count)::float8",
+}
+
+// applyRollupFilter adds the where clauses for the given filter to a query on a rollup table. Rollups are
+// selected by the start of their bucket. Only the time range, datastream and tenant are supported.
+func applyRollupFilter(q sq.SelectBuilder, filter measurements.Filter) sq.SelectBuilder {
+	if !filter.Start.IsZero() {
+		q = q.Where("bucket >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		q = q.Where("bucket <= ?", filter.End)
+	}
+	if len(filter.Datastream) > 0 {
+		q = q.Where(sq.Eq{"datastream_id": filter.Datastream})
+	}
+	if len(filter.TenantID) > 0 {
+		q = q.Where(sq.Eq{"tenant_id": filter.TenantID})
+	}
+	return q
+}
+
+// rollupKey identifies a rollup bucket of a datastream
+type rollupKey struct {
+	datastreamID uuid.UUID
+	bucket       time.Time
+}
+
+// rollupBuckets collects the distinct buckets of the given interval that contain the given timestamps.
+// Buckets are aligned to the unix epoch like the time_bucket function.
+type rollupBuckets struct {
+	interval time.Duration
+	keys     []rollupKey
+}
+
+func newRollupBuckets(interval time.Duration, datastreamIDs []uuid.UUID, timestamps []time.Time) *rollupBuckets {
+	keys := make([]rollupKey, len(timestamps))
+	for ix, timestamp := range timestamps {
+		keys[ix] = rollupKey{datastreamIDs[ix], measurements.BucketStart(timestamp, interval)}
+	}
+	// Concurrent transactions change the rollups in the same order, so they wait on each other instead of deadlocking
+	slices.SortFunc(keys, func(a, b rollupKey) int {
+		if c := bytes.Compare(a.datastreamID[:], b.datastreamID[:]); c != 0 {
+			return c
+		}
+		return a.bucket.Compare(b.bucket)
+	})
+	return &rollupBuckets{
+		interval: interval,
+		keys:     slices.CompactFunc(keys, func(a, b rollupKey) bool { return a.datastreamID == b.datastreamID && a.bucket.Equal(b.bucket) }),
+	}
+}
+
+func (b *rollupBuckets) arrays() ([]uuid.UUID, []time.Time) {
+	ids := make([]uuid.UUID, len(b.keys))
+	buckets := make([]time.Time, len(b.keys))
+	for ix, key := range b.keys {
+		ids[ix], buckets[ix] = key.datastreamID, key.bucket
+	}
+	return ids, buckets
+}
+
+// rollupSources aggregate the source of every rollup bucket given as the arrays $1 and $2, numbered by ordinal.
+// Hourly rollups are calculated from the raw measurements and daily rollups from the hourly rollups. The sum of
+// squares of a day is only known if it is known for every hourly rollup of the day.
+var rollupSources = map[string]string{
+	"measurement_rollups_hourly": `
+SELECT
+	b.ordinal, min(m.measurement_value) AS value_min, max(m.measurement_value) AS value_max,
+	COALESCE(sum(m.measurement_value), 0) AS value_sum,
+	COALESCE(sum(m.measurement_value * m.measurement_value), 0) AS value_sum_squares,
+	count(m.measurement_value) AS value_count
+FROM unnest($1::uuid[], $2::timestamptz[]) WITH ORDINALITY AS b(datastream_id, bucket, ordinal)
+LEFT JOIN measurements m ON m.datastream_id = b.datastream_id
+	AND m.measurement_timestamp >= b.bucket AND m.measurement_timestamp < b.bucket + INTERVAL '1 hour'
+GROUP BY b.ordinal`,
+	"measurement_rollups_daily": `
+SELECT
+	b.ordinal, min(h.value_min) AS value_min, max(h.value_max) AS value_max,
+	COALESCE(sum(h.value_sum), 0) AS value_sum,
+	CASE WHEN count(h.value_sum_squares) = count(h.bucket) THEN COALESCE(sum(h.value_sum_squares), 0) END AS value_sum_squares,
+	COALESCE(sum(h.value_count), 0)::bigint AS value_count
+FROM unnest($1::uuid[], $2::timestamptz[]) WITH ORDINALITY AS b(datastream_id, bucket, ordinal)
+LEFT JOIN measurement_rollups_hourly h ON h.datastream_id = b.datastream_id
+	AND h.bucket >= b.bucket AND h.bucket < b.bucket + INTERVAL '1 day'
+GROUP BY b.ordinal`,
+}
+
+// mergeRollupsSQL merges the change of the sources into the rollups. The source aggregates before the change are
+// given as the arrays $3 to $5. A rollup of which the source is complete, as its count equals that of the source
+// before the change, is replaced by the source. Otherwise part of the source has expired, so the sum, sum of squares
+// and count are changed by the difference and the minimum and maximum can only be widened. The expiration is based
+// on the retention of the tenant, or the default given as $6. Rollups without measurements left are removed.
+const mergeRollupsSQL = `
+WITH after AS (%[1]s),
+before AS (
+	SELECT * FROM unnest($3::float8[], $4::float8[], $5::bigint[]) WITH ORDINALITY AS b(value_sum, value_sum_squares, value_count, ordinal)
+),
+merged AS (
+	SELECT
+		b.datastream_id, b.bucket, ds.tenant_id,
+		CASE WHEN r.bucket IS NULL OR r.value_count = before.value_count THEN after.value_min
+			ELSE LEAST(r.value_min, after.value_min) END AS value_min,
+		CASE WHEN r.bucket IS NULL OR r.value_count = before.value_count THEN after.value_max
+			ELSE GREATEST(r.value_max, after.value_max) END AS value_max,
+		CASE WHEN r.bucket IS NULL THEN after.value_sum
+			ELSE r.value_sum - before.value_sum + after.value_sum END AS value_sum,
+		CASE WHEN r.bucket IS NULL THEN after.value_sum_squares
+			ELSE r.value_sum_squares - before.value_sum_squares + after.value_sum_squares END AS value_sum_squares,
+		CASE WHEN r.bucket IS NULL THEN after.value_count
+			ELSE r.value_count - before.value_count + after.value_count END AS value_count,
+		(b.bucket + make_interval(days => COALESCE(rr.%[3]s, $6)))::date AS rollup_expiration
+	FROM unnest($1::uuid[], $2::timestamptz[]) WITH ORDINALITY AS b(datastream_id, bucket, ordinal)
+	JOIN after ON after.ordinal = b.ordinal
+	JOIN before ON before.ordinal = b.ordinal
+	JOIN datastreams ds ON ds.id = b.datastream_id
+	LEFT JOIN rollup_retention rr ON rr.tenant_id = ds.tenant_id
+	LEFT JOIN %[2]s r ON r.datastream_id = b.datastream_id AND r.bucket = b.bucket
+),
+removed AS (
+	DELETE FROM %[2]s r USING merged
+	WHERE r.datastream_id = merged.datastream_id AND r.bucket = merged.bucket AND merged.value_count <= 0
+)
+INSERT INTO %[2]s (
+	datastream_id, bucket, tenant_id, value_min, value_max, value_sum, value_sum_squares, value_count, rollup_expiration
+)
+SELECT
+	datastream_id, bucket, tenant_id, value_min, value_max, value_sum, value_sum_squares, value_count, rollup_expiration
+FROM merged WHERE value_count > 0
+ORDER BY datastream_id, bucket
+ON CONFLICT (datastream_id, bucket) DO UPDATE SET
+	value_min = EXCLUDED.value_min,
+	value_max = EXCLUDED.value_max,
+	value_sum = EXCLUDED.value_sum,
+	value_sum_squares = EXCLUDED.value_sum_squares,
+	value_count = EXCLUDED.value_count,
+	rollup_expiration = EXCLUDED.rollup_expiration;`
+
+// rollupLevel is a rollup table with the aggregates of the sources of the changed buckets before the change
+type rollupLevel struct {
+	table           string
+	retentionColumn string
+	days            int
+	buckets         *rollupBuckets
+	sums            []float64
+	sumSquares      []*float64
+	counts          []int64
+}
+
+// rollupRefresh changes the rollups along with the measurements they are calculated from
+type rollupRefresh struct {
+	levels []*rollupLevel
+}
+
+// lockRollups serialises the changes to the rollups of the datastreams. The locks are taken in a fixed order and held
+// until the end of the transaction, so the rollups do not change between taking the snapshot and merging.
+func lockRollups(ctx context.Context, tx pgx.Tx, datastreamIDs []uuid.UUID) error {
+	ids := slices.Clone(datastreamIDs)
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	ids = slices.Compact(ids)
+	if _, err := tx.Exec(ctx,
+		`SELECT pg_advisory_xact_lock(hashtextextended(id::text, 0)) FROM unnest($1::uuid[]) AS id`, ids,
+	); err != nil {
+		return fmt.Errorf("could not lock rollups: %w", err)
+	}
+	return nil
+}
+
+// snapshotRollups prepares the refresh of the hourly and daily rollups containing the given measurement timestamps.
+// It must be called in the transaction that changes the measurements, before they are changed.
+func (s *MeasurementStorePSQL) snapshotRollups(ctx context.Context, tx pgx.Tx, datastreamIDs []uuid.UUID, timestamps []time.Time) (*rollupRefresh, error) {
+	if len(timestamps) == 0 {
+		return &rollupRefresh{}, nil
+	}
+	if err := lockRollups(ctx, tx, datastreamIDs); err != nil {
+		return nil, err
+	}
+	refresh := &rollupRefresh{levels: []*rollupLevel{
+		{
+			table: "measurement_rollups_hourly", retentionColumn: "hourly_days", days: s.rollupRetention.HourlyDays,
+			buckets: newRollupBuckets(time.Hour, datastreamIDs, timestamps),
+		},
+		{
+			table: "measurement_rollups_daily", retentionColumn: "daily_days", days: s.rollupRetention.DailyDays,
+			buckets: newRollupBuckets(24*time.Hour, datastreamIDs, timestamps),
+		},
+	}}
+	for _, level := range refresh.levels {
+		ids, buckets := level.buckets.arrays()
+		rows, err := tx.Query(ctx,
+			`SELECT value_sum, value_sum_squares, value_count FROM (`+rollupSources[level.table]+`) s ORDER BY ordinal`,
+			ids, buckets,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not select sources of %s: %w", level.table, err)
+		}
+		for rows.Next() {
+			var sum float64
+			var sumSquares *float64
+			var count int64
+			if err := rows.Scan(&sum, &sumSquares, &count); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("could not scan source of %s: %w", level.table, err)
+			}
+			level.sums = append(level.sums, sum)
+			level.sumSquares = append(level.sumSquares, sumSquares)
+			level.counts = append(level.counts, count)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("could not select sources of %s: %w", level.table, err)
+		}
+	}
+	return refresh, nil
+}
+
+// refreshRollups merges the change of the measurements since the snapshot into the rollups. It must be called in the
+// transaction that changes the measurements, so that the rollups never diverge from the raw data.
+//
+// Rollups are not recalculated from the measurements that still exist, as those might have expired while the rollups
+// are retained longer. A measurement stored for a period of which the raw measurements are already cleaned up is
+// therefore added to the rollups of that period.
+func (s *MeasurementStorePSQL) refreshRollups(ctx context.Context, tx pgx.Tx, refresh *rollupRefresh) error {
+	for _, level := range refresh.levels {
+		ids, buckets := level.buckets.arrays()
+		_, err := tx.Exec(ctx,
+			fmt.Sprintf(mergeRollupsSQL, rollupSources[level.table], level.table, level.retentionColumn),
+			ids, buckets, level.sums, level.sumSquares, level.counts, level.days,
+		)
+		if err != nil {
+			return fmt.Errorf("refresh rollups, could not merge %s: %w", level.table, err)
+		}
+	}
+	return nil
+}
+
+func (s *MeasurementStorePSQL) GetRollupRetention(ctx context.Context, tenantID int64) (*measurements.RollupRetention, error) {
+	retention := s.rollupRetention
+	err := s.databasePool.QueryRow(ctx,
+		`SELECT hourly_days, daily_days FROM rollup_retention WHERE tenant_id = $1`, tenantID,
+	).Scan(&retention.HourlyDays, &retention.DailyDays)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("error selecting rollup retention: %w", err)
+	}
+	return &retention, nil
+}
+
+// SetRollupRetention stores the retention of the tenant and recalculates the expiration of its existing rollups
+func (s *MeasurementStorePSQL) SetRollupRetention(ctx context.Context, tenantID int64, retention measurements.RollupRetention) error {
+	tx, err := s.databasePool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("set rollup retention, could not start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO rollup_retention (tenant_id, hourly_days, daily_days) VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id) DO UPDATE SET hourly_days = EXCLUDED.hourly_days, daily_days = EXCLUDED.daily_days`,
+		tenantID, retention.HourlyDays, retention.DailyDays,
+	)
+	if err != nil {
+		return fmt.Errorf("set rollup retention: %w", err)
+	}
+	for table, days := range map[string]int{
+		"measurement_rollups_hourly": retention.HourlyDays,
+		"measurement_rollups_daily":  retention.DailyDays,
+	} {
+		_, err := tx.Exec(ctx,
+			`UPDATE `+table+` SET rollup_expiration = (bucket + make_interval(days => $2))::date WHERE tenant_id = $1`,
+			tenantID, days,
+		)
+		if err != nil {
+			return fmt.Errorf("set rollup retention, could not update %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("set rollup retention, could not commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package measurementsinfra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+const summarizeMeasurementsSQL = `
+	SELECT
+		datastream_id, count(*), sum(measurement_value), sum(measurement_value * measurement_value),
+		min(measurement_value), max(measurement_value), min(measurement_timestamp), max(measurement_timestamp)
+	FROM measurements
+	WHERE datastream_id = ANY($1) AND measurement_timestamp >= $2 AND measurement_timestamp < $3
+	GROUP BY datastream_id`
+
+// summarizeRollupsSQL combines the rollups in the time range. The first and last timestamp are looked up in the
+// first and last rollup bucket using the measurement index, falling back to the bucket start if the raw
+// measurements are cleaned up.
+const summarizeRollupsSQL = `
+	SELECT
+		s.datastream_id, s.count, s.sum, s.sum_squares, s.min, s.max,
+		COALESCE((
+			SELECT min(measurement_timestamp) FROM measurements WHERE datastream_id = s.datastream_id
+			AND measurement_timestamp >= s.first_bucket AND measurement_timestamp < s.first_bucket + make_interval(secs => $4)
+		), s.first_bucket),
+		COALESCE((
+			SELECT max(measurement_timestamp) FROM measurements WHERE datastream_id = s.datastream_id
+			AND measurement_timestamp >= s.last_bucket AND measurement_timestamp < s.last_bucket + make_interval(secs => $4)
+		), s.last_bucket)
+	FROM (
+		SELECT
+			datastream_id, sum(value_count)::bigint AS count, sum(value_sum) AS sum,
+			CASE WHEN count(value_sum_squares) = count(*) THEN sum(value_sum_squares) END AS sum_squares,
+			min(value_min) AS min, max(value_max) AS max, min(bucket) AS first_bucket, max(bucket) AS last_bucket
+		FROM %s
+		WHERE datastream_id = ANY($1) AND bucket >= $2 AND bucket < $3
+		GROUP BY datastream_id
+	) s`
+
+func (s *MeasurementStorePSQL) SummarizeValues(
+	ctx context.Context, datastreamIDs []uuid.UUID, start, end time.Time, resolution measurements.Resolution,
+) ([]measurements.ValueSummary, error) {
+	var rows pgx.Rows
+	var err error
+	if resolution == measurements.ResolutionRaw {
+		rows, err = s.databasePool.Query(ctx, summarizeMeasurementsSQL, datastreamIDs, start, end)
+	} else {
+		rows, err = s.databasePool.Query(ctx, fmt.Sprintf(summarizeRollupsSQL, rollupTables[resolution]),
+			datastreamIDs, start, end, resolution.Interval().Seconds(),
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error summarizing measurement values: %w", err)
+	}
+	defer rows.Close()
+
+	list := []measurements.ValueSummary{}
+	for rows.Next() {
+		var summary measurements.ValueSummary
+		if err := rows.Scan(
+			&summary.DatastreamID, &summary.Count, &summary.Sum, &summary.SumSquares, &summary.Min, &summary.Max,
+			&summary.First, &summary.Last,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, summary)
+	}
+	return list, rows.Err()
+}
+
+// countHistogramSQL places every value in its histogram bucket, width_bucket places the maximum value in an
+// extra bucket which is merged into the last bucket
+const countHistogramSQL = `
+	SELECT
+		m.datastream_id, LEAST(width_bucket(m.measurement_value, h.min, h.max, h.buckets), h.buckets) - 1 AS bucket,
+		count(*)
+	FROM unnest($1::uuid[], $2::float8[], $3::float8[], $4::int[]) AS h(datastream_id, min, max, buckets)
+	JOIN measurements m ON m.datastream_id = h.datastream_id
+		AND m.measurement_timestamp >= $5 AND m.measurement_timestamp < $6
+	GROUP BY m.datastream_id, bucket`
+
+// countRollupHistogramSQL places the measurements of every rollup bucket in the histogram bucket of their average
+const countRollupHistogramSQL = `
+	SELECT
+		r.datastream_id,
+		LEAST(GREATEST(width_bucket(r.value_sum / r.value_count, h.min, h.max, h.buckets), 1), h.buckets) - 1 AS bucket,
+		sum(r.value_count)::bigint
+	FROM unnest($1::uuid[], $2::float8[], $3::float8[], $4::int[]) AS h(datastream_id, min, max, buckets)
+	JOIN %s r ON r.datastream_id = h.datastream_id AND r.bucket >= $5 AND r.bucket < $6
+	GROUP BY r.datastream_id, bucket`
+
+func (s *MeasurementStorePSQL) CountHistogram(
+	ctx context.Context, ranges []measurements.HistogramRange, start, end time.Time, resolution measurements.Resolution,
+) ([]measurements.HistogramCount, error) {
+	ids := make([]uuid.UUID, len(ranges))
+	mins := make([]float64, len(ranges))
+	maxs := make([]float64, len(ranges))
+	buckets := make([]int, len(ranges))
+	for ix, r := range ranges {
+		ids[ix], mins[ix], maxs[ix], buckets[ix] = r.DatastreamID, r.Min, r.Max, r.Buckets
+	}
+	query := countHistogramSQL
+	if resolution != measurements.ResolutionRaw {
+		query = fmt.Sprintf(countRollupHistogramSQL, rollupTables[resolution])
+	}
+	rows, err := s.databasePool.Query(ctx, query, ids, mins, maxs, buckets, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("error counting measurement histogram: %w", err)
+	}
+	defer rows.Close()
+
+	list := []measurements.HistogramCount{}
+	for rows.Next() {
+		var count measurements.HistogramCount
+		if err := rows.Scan(&count.DatastreamID, &count.Bucket, &count.Count); err != nil {
+			return nil, err
+		}
+		list = append(list, count)
+	}
+	return list, rows.Err()
+}
@@ -5,11 +5,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"sensorbucket.nl/sensorbucket/internal/pagination"
@@ -23,15 +25,36 @@ var _ measurements.Store = (*MeasurementStorePSQL)(nil)
 
 // MeasurementStorePSQL Implements the measurementstore with a PostgreSQL database as backend
 type MeasurementStorePSQL struct {
-	databasePool *pgxpool.Pool
+	databasePool    *pgxpool.Pool
+	conflictPolicy  measurements.ConflictPolicy
+	rollupRetention measurements.RollupRetention
+	commitHooks     []CommitHook
 }
 
+// CommitHook is called with the stored measurements in the transaction that stores them, such that work for
+// those measurements is recorded if and only if they are stored. An error rolls back the transaction.
+type CommitHook func(ctx context.Context, tx pgx.Tx, stored []measurements.Measurement) error
+
 func NewPSQL(databasePool *pgxpool.Pool) *MeasurementStorePSQL {
 	return &MeasurementStorePSQL{
-		databasePool: databasePool,
+		databasePool:    databasePool,
+		conflictPolicy:  measurements.ConflictIgnore,
+		rollupRetention: measurements.DefaultRollupRetention,
 	}
 }
 
+// WithConflictPolicy sets how StoreMeasurements handles measurements that already exist
+func (s *MeasurementStorePSQL) WithConflictPolicy(policy measurements.ConflictPolicy) *MeasurementStorePSQL {
+	s.conflictPolicy = policy
+	return s
+}
+
+// WithCommitHook adds a hook that is called in the transaction of StoreMeasurements
+func (s *MeasurementStorePSQL) WithCommitHook(hook CommitHook) *MeasurementStorePSQL {
+	s.commitHooks = append(s.commitHooks, hook)
+	return s
+}
+
 // Query returns measurements from the database
 //
 //   - The query is based on the filters provided in the query.
@@ -45,80 +68,117 @@ type MeasurementQueryPage struct {
 	ID                   int64     `pagination:"id,DESC"`
 }
 
-func (s *MeasurementStorePSQL) Query(ctx context.Context, filter measurements.Filter, r pagination.Request) (*pagination.Page[measurements.Measurement], error) {
-	var err error
-	q := pq.Select(
-		"id",
-		"uplink_message_id",
-		"organisation_id",
-		"organisation_name",
-		"organisation_address",
-		"organisation_zipcode",
-		"organisation_city",
-		"organisation_chamber_of_commerce_id",
-		"organisation_headquarter_id",
-		"organisation_archive_time",
-		"organisation_state",
-		"device_id",
-		"device_code",
-		"device_description",
-		"ST_Y(device_location::geometry) as device_latitude",
-		"ST_X(device_location::geometry) as device_longitude",
-		"device_altitude",
-		"device_location_description",
-		"device_properties",
-		"device_state",
-		"sensor_id",
-		"sensor_code",
-		"sensor_description",
-		"sensor_external_id",
-		"sensor_properties",
-		"sensor_brand",
-		"datastream_id",
-		"datastream_description",
-		"datastream_observed_property",
-		"datastream_unit_of_measurement",
-		"measurement_timestamp",
-		"measurement_value",
-		"ST_Y(measurement_location::geometry) as measurement_latitude",
-		"ST_X(measurement_location::geometry) as measurement_longitude",
-		"measurement_altitude",
-		"measurement_expiration",
-		"feature_of_interest_id",
-		"feature_of_interest_name",
-		"feature_of_interest_description",
-		"feature_of_interest_encoding_type",
-		"ST_AsBinary(feature_of_interest_feature)",
-		"feature_of_interest_properties",
-		"created_at",
-	).
-		From("measurements")
+// measurementColumns are the columns selected for a measurement, in the order of measurementScanTargets
+var measurementColumns = []string{
+	"id",
+	"uplink_message_id",
+	"organisation_id",
+	"organisation_name",
+	"organisation_address",
+	"organisation_zipcode",
+	"organisation_city",
+	"organisation_chamber_of_commerce_id",
+	"organisation_headquarter_id",
+	"organisation_archive_time",
+	"organisation_state",
+	"device_id",
+	"device_code",
+	"device_description",
+	"ST_Y(device_location::geometry) as device_latitude",
+	"ST_X(device_location::geometry) as device_longitude",
+	"device_altitude",
+	"device_location_description",
+	"device_properties",
+	"device_state",
+	"sensor_id",
+	"sensor_code",
+	"sensor_description",
+	"sensor_external_id",
+	"sensor_properties",
+	"sensor_brand",
+	"datastream_id",
+	"datastream_description",
+	"datastream_observed_property",
+	"datastream_unit_of_measurement",
+	"measurement_timestamp",
+	"measurement_value",
+	"ST_Y(measurement_location::geometry) as measurement_latitude",
+	"ST_X(measurement_location::geometry) as measurement_longitude",
+	"measurement_altitude",
+	"measurement_expiration",
+	"measurement_quality",
+	"measurement_discriminator",
+	"measurement_source",
+	"measurement_submitted_by",
+	"measurement_correction_id",
+	"feature_of_interest_id",
+	"feature_of_interest_name",
+	"feature_of_interest_description",
+	"feature_of_interest_encoding_type",
+	"ST_AsBinary(feature_of_interest_feature)",
+	"feature_of_interest_properties",
+	"created_at",
+}
 
-	if !filter.Start.IsZero() {
-		q = q.Where("measurement_timestamp >= ?", filter.Start)
-	}
-	if !filter.End.IsZero() {
-		q = q.Where("measurement_timestamp <= ?", filter.End)
+// measurementScanTargets returns the scan destinations for measurementColumns
+func measurementScanTargets(m *measurements.Measurement) []any {
+	return []any{
+		&m.ID,
+		&m.UplinkMessageID,
+		&m.OrganisationID,
+		&m.OrganisationName,
+		&m.OrganisationAddress,
+		&m.OrganisationZipcode,
+		&m.OrganisationCity,
+		&m.OrganisationChamberOfCommerceID,
+		&m.OrganisationHeadquarterID,
+		&m.OrganisationArchiveTime,
+		&m.OrganisationState,
+		&m.DeviceID,
+		&m.DeviceCode,
+		&m.DeviceDescription,
+		&m.DeviceLatitude,
+		&m.DeviceLongitude,
+		&m.DeviceAltitude,
+		&m.DeviceLocationDescription,
+		&m.DeviceProperties,
+		&m.DeviceState,
+		&m.SensorID,
+		&m.SensorCode,
+		&m.SensorDescription,
+		&m.SensorExternalID,
+		&m.SensorProperties,
+		&m.SensorBrand,
+		&m.DatastreamID,
+		&m.DatastreamDescription,
+		&m.DatastreamObservedProperty,
+		&m.DatastreamUnitOfMeasurement,
+		&m.MeasurementTimestamp,
+		&m.MeasurementValue,
+		&m.MeasurementLatitude,
+		&m.MeasurementLongitude,
+		&m.MeasurementAltitude,
+		&m.MeasurementExpiration,
+		&m.MeasurementQuality,
+		&m.MeasurementDiscriminator,
+		&m.MeasurementSource,
+		&m.MeasurementSubmittedBy,
+		&m.MeasurementCorrectionID,
+		&m.FeatureOfInterestID,
+		&m.FeatureOfInterestName,
+		&m.FeatureOfInterestDescription,
+		&m.FeatureOfInterestEncodingType,
+		&m.FeatureOfInterestFeature,
+		&m.FeatureOfInterestProperties,
+		&m.CreatedAt,
 	}
+}
 
-	if len(filter.FeatureOfInterestID) > 0 {
-		q = q.Where(sq.Eq{"feature_of_interest_id": filter.FeatureOfInterestID})
-	}
-	if len(filter.ObservedProperty) > 0 {
-		q = q.Where(sq.Eq{"datastream_observed_property": filter.ObservedProperty})
-	}
-	if len(filter.SensorCodes) > 0 {
-		q = q.Where(sq.Eq{"sensor_code": filter.SensorCodes})
-	}
-	if len(filter.DeviceIDs) > 0 {
-		q = q.Where(sq.Eq{"device_id": filter.DeviceIDs})
-	}
-	if len(filter.Datastream) > 0 {
-		q = q.Where(sq.Eq{"datastream_id": filter.Datastream})
-	}
-	if len(filter.TenantID) > 0 {
-		q = q.Where(sq.Eq{"organisation_id": filter.TenantID})
-	}
+func (s *MeasurementStorePSQL) Query(ctx context.Context, filter measurements.Filter, r pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+	var err error
+	q := pq.Select(measurementColumns...).
+		From("measurements")
+	q = applyMeasurementFilter(q, filter)
 
 	// pagination
 	cursor, err := pagination.GetCursor[MeasurementQueryPage](r)
@@ -147,53 +207,11 @@ func (s *MeasurementStorePSQL) Query(ctx context.Context, filter measurements.Fi
 	list := make([]measurements.Measurement, 0, cursor.Limit)
 	for rows.Next() {
 		var m measurements.Measurement
-		err = rows.Scan(
-			&m.ID,
-			&m.UplinkMessageID,
-			&m.OrganisationID,
-			&m.OrganisationName,
-			&m.OrganisationAddress,
-			&m.OrganisationZipcode,
-			&m.OrganisationCity,
-			&m.OrganisationChamberOfCommerceID,
-			&m.OrganisationHeadquarterID,
-			&m.OrganisationArchiveTime,
-			&m.OrganisationState,
-			&m.DeviceID,
-			&m.DeviceCode,
-			&m.DeviceDescription,
-			&m.DeviceLatitude,
-			&m.DeviceLongitude,
-			&m.DeviceAltitude,
-			&m.DeviceLocationDescription,
-			&m.DeviceProperties,
-			&m.DeviceState,
-			&m.SensorID,
-			&m.SensorCode,
-			&m.SensorDescription,
-			&m.SensorExternalID,
-			&m.SensorProperties,
-			&m.SensorBrand,
-			&m.DatastreamID,
-			&m.DatastreamDescription,
-			&m.DatastreamObservedProperty,
-			&m.DatastreamUnitOfMeasurement,
-			&m.MeasurementTimestamp,
-			&m.MeasurementValue,
-			&m.MeasurementLatitude,
-			&m.MeasurementLongitude,
-			&m.MeasurementAltitude,
-			&m.MeasurementExpiration,
-			&m.FeatureOfInterestID,
-			&m.FeatureOfInterestName,
-			&m.FeatureOfInterestDescription,
-			&m.FeatureOfInterestEncodingType,
-			&m.FeatureOfInterestFeature,
-			&m.FeatureOfInterestProperties,
-			&m.CreatedAt,
+		err = rows.Scan(append(
+			measurementScanTargets(&m),
 			&cursor.Columns.MeasurementTimestamp,
 			&cursor.Columns.ID,
-		)
+		)...)
 		if err != nil {
 			return nil, err
 		}
@@ -204,11 +222,135 @@ func (s *MeasurementStorePSQL) Query(ctx context.Context, filter measurements.Fi
 	return &page, nil
 }
 
+// applyMeasurementFilter adds the where clauses for the given filter to a query on the measurements table
+func applyMeasurementFilter(q sq.SelectBuilder, filter measurements.Filter) sq.SelectBuilder {
+	if !filter.Start.IsZero() {
+		q = q.Where("measurement_timestamp >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		q = q.Where("measurement_timestamp <= ?", filter.End)
+	}
+
+	if len(filter.FeatureOfInterestID) > 0 {
+		q = q.Where(sq.Eq{"feature_of_interest_id": filter.FeatureOfInterestID})
+	}
+	if len(filter.ObservedProperty) > 0 {
+		q = q.Where(sq.Eq{"datastream_observed_property": filter.ObservedProperty})
+	}
+	if len(filter.SensorCodes) > 0 {
+		q = q.Where(sq.Eq{"sensor_code": filter.SensorCodes})
+	}
+	if len(filter.DeviceIDs) > 0 {
+		q = q.Where(sq.Eq{"device_id": filter.DeviceIDs})
+	}
+	if len(filter.Datastream) > 0 {
+		q = q.Where(sq.Eq{"datastream_id": filter.Datastream})
+	}
+	if len(filter.TenantID) > 0 {
+		q = q.Where(sq.Eq{"organisation_id": filter.TenantID})
+	}
+	if len(filter.SensorGroup) > 0 {
+		q = q.Where(sq.Expr("sensor_id IN (?)", sensorGroupSensors(filter.SensorGroup, filter.TenantID)))
+	}
+	if len(filter.Project) > 0 {
+		q = q.Where(sq.Expr("EXISTS (?)", projectFeatures(
+			filter.Project, filter.TenantID,
+			"measurements.feature_of_interest_id", "measurements.datastream_observed_property",
+		)))
+	}
+	q = applySpatialFilter(q, filter)
+	q = applyPropertyFilter(q, filter)
+	// The filter is validated by the service, an invalid filter matches nothing
+	if quality, err := measurements.ParseQualityFilter(filter.Quality); err != nil {
+		q = q.Where("false")
+	} else if !quality.IsEmpty() {
+		or := sq.Or{}
+		if quality.Good {
+			or = append(or, sq.Eq{"measurement_quality": 0})
+		}
+		if quality.Suspect {
+			or = append(or, sq.NotEq{"measurement_quality": 0})
+		}
+		if quality.Flags != 0 {
+			or = append(or, sq.Expr("measurement_quality & ? <> 0", int(quality.Flags)))
+		}
+		q = q.Where(or)
+	}
+	return q
+}
+
+// applyPropertyFilter adds the where clauses selecting measurements by their properties. Containment and equality
+// use the @> operator which can be served by a GIN index on measurement_properties, ordering comparisons can not.
+func applyPropertyFilter(q sq.SelectBuilder, filter measurements.Filter) sq.SelectBuilder {
+	if len(filter.Properties) > 0 {
+		q = q.Where("measurement_properties @> ?::jsonb", string(filter.Properties))
+	}
+	for _, str := range filter.Property {
+		condition, err := measurements.ParsePropertyCondition(str)
+		if err != nil {
+			q = q.Where("false")
+			continue
+		}
+		q = q.Where(propertyCondition(condition))
+	}
+	return q
+}
+
+func propertyCondition(condition measurements.PropertyCondition) sq.Sqlizer {
+	if condition.Operator.IsOrdering() {
+		// CASE guarantees that only numbers are cast
+		return sq.Expr(fmt.Sprintf(
+			"CASE WHEN jsonb_typeof(measurement_properties #> ?::text[]) = 'number' THEN (measurement_properties #>> ?::text[])::float8 END %s ?::float8",
+			condition.Operator,
+		), condition.Path, condition.Path, condition.Value)
+	}
+	documents, err := condition.ContainmentDocuments()
+	if err != nil {
+		return sq.Expr("false")
+	}
+	equal := sq.Or{}
+	for _, doc := range documents {
+		equal = append(equal, sq.Expr("measurement_properties @> ?::jsonb", doc))
+	}
+	if condition.Operator == measurements.PropertyNotEqual {
+		return sq.Expr("NOT COALESCE(?, false)", equal)
+	}
+	return equal
+}
+
+// applySpatialFilter adds the where clauses selecting measurements by location. Feature of interest geometries
+// may be stored without SRID, the measurement location is compared in the SRID of the feature.
+func applySpatialFilter(q sq.SelectBuilder, filter measurements.Filter) sq.SelectBuilder {
+	if filter.BoundingBox != "" {
+		if bbox, err := measurements.ParseBoundingBox(filter.BoundingBox); err != nil {
+			q = q.Where("false")
+		} else {
+			q = q.Where(
+				"measurement_location::geometry @ ST_MakeEnvelope(?, ?, ?, ?, 4326)",
+				bbox.West, bbox.South, bbox.East, bbox.North,
+			)
+		}
+	}
+	if filter.Polygon != "" {
+		q = q.Where("ST_Intersects(measurement_location::geometry, ST_GeomFromText(?, 4326))", filter.Polygon)
+	}
+	if len(filter.WithinFeatureOfInterest) > 0 {
+		features := sq.Select("1").From("features_of_interest foi").
+			Where(sq.Eq{"foi.id": filter.WithinFeatureOfInterest}).
+			Where("ST_Intersects(foi.feature, ST_SetSRID(measurement_location::geometry, ST_SRID(foi.feature)))")
+		if len(filter.TenantID) > 0 {
+			features = features.Where(sq.Eq{"foi.tenant_id": filter.TenantID})
+		}
+		q = q.Where(sq.Expr("EXISTS (?)", features))
+	}
+	return q
+}
+
 func (s *MeasurementStorePSQL) FindDatastream(ctx context.Context, tenantID, sensorID int64, obs string) (*measurements.Datastream, error) {
 	var ds measurements.Datastream
 	query, params, err := pq.Select(
 		"id", "description", "sensor_id", "observed_property", "unit_of_measurement",
-		"created_at", "tenant_id",
+		"created_at", "quality_rules", "archive_time", "tenant_id",
 	).From("datastreams").Where(sq.Eq{
 		"sensor_id":         sensorID,
 		"observed_property": obs,
@@ -220,7 +362,7 @@ func (s *MeasurementStorePSQL) FindDatastream(ctx context.Context, tenantID, sen
 	row := s.databasePool.QueryRow(ctx, query, params...)
 	err = row.Scan(
 		&ds.ID, &ds.Description, &ds.SensorID, &ds.ObservedProperty, &ds.UnitOfMeasurement, &ds.CreatedAt,
-		&ds.TenantID,
+		&ds.QualityRules, &ds.ArchiveTime, &ds.TenantID,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, measurements.ErrDatastreamNotFound
@@ -257,12 +399,49 @@ func applyDatastreamFilter(q sq.SelectBuilder, filter measurements.DatastreamFil
 	if len(filter.Sensor) > 0 {
 		q = q.Where(sq.Eq{"sensor_id": filter.Sensor})
 	}
+	if len(filter.Device) > 0 {
+		q = q.Where(sq.Expr("sensor_id IN (?)", sq.Select("id").From("sensors").Where(sq.Eq{"device_id": filter.Device})))
+	}
 	if len(filter.ObservedProperty) > 0 {
 		q = q.Where(sq.Eq{"observed_property": filter.ObservedProperty})
 	}
 	if len(filter.TenantID) > 0 {
 		q = q.Where(sq.Eq{"tenant_id": filter.TenantID})
 	}
+	if len(filter.SensorGroup) > 0 {
+		q = q.Where(sq.Expr("sensor_id IN (?)", sensorGroupSensors(filter.SensorGroup, filter.TenantID)))
+	}
+	if len(filter.Project) > 0 {
+		q = q.Where(sq.Expr("EXISTS (?)", projectFeatures(
+			filter.Project, filter.TenantID,
+			"(SELECT s.feature_of_interest_id FROM sensors s WHERE s.id = datastreams.sensor_id)", "datastreams.observed_property",
+		)))
+	}
+	return q
+}
+
+// sensorGroupSensors selects the sensors in the sensor groups, groups of other tenants are ignored
+func sensorGroupSensors(groups, tenantIDs []int64) sq.SelectBuilder {
+	q := sq.Select("sgs.sensor_id").From("sensor_groups_sensors sgs").
+		Join("sensor_groups sg ON sg.id = sgs.sensor_group_id").
+		Where(sq.Eq{"sg.id": groups})
+	if len(tenantIDs) > 0 {
+		q = q.Where(sq.Eq{"sg.tenant_id": tenantIDs})
+	}
+	return q
+}
+
+// projectFeatures selects the features of interest of the projects that match the given feature of interest
+// and observed property expressions. Projects of other tenants are ignored.
+func projectFeatures(projects, tenantIDs []int64, featureOfInterest, observedProperty string) sq.SelectBuilder {
+	q := sq.Select("1").From("project_feature_of_interest pf").
+		Join("projects p ON p.id = pf.project_id").
+		Where(sq.Eq{"pf.project_id": projects}).
+		Where("pf.feature_of_interest_id = " + featureOfInterest).
+		Where("(cardinality(pf.interested_observation_types) = 0 OR " + observedProperty + " = ANY(pf.interested_observation_types))")
+	if len(tenantIDs) > 0 {
+		q = q.Where(sq.Eq{"p.tenant_id": tenantIDs})
+	}
 	return q
 }
 
@@ -276,6 +455,7 @@ func (s *MeasurementStorePSQL) ListDatastreams(ctx context.Context, filter measu
 	ds := []measurements.Datastream{}
 	q := pq.Select(
 		"id", "description", "sensor_id", "observed_property", "unit_of_measurement", "created_at",
+		"quality_rules", "archive_time",
 	).From("datastreams")
 	q = applyDatastreamFilter(q, filter)
 
@@ -307,6 +487,8 @@ func (s *MeasurementStorePSQL) ListDatastreams(ctx context.Context, filter measu
 			&d.ObservedProperty,
 			&d.UnitOfMeasurement,
 			&d.CreatedAt,
+			&d.QualityRules,
+			&d.ArchiveTime,
 			&cursor.Columns.CreatedAt,
 			&cursor.Columns.ID,
 		)
@@ -325,6 +507,7 @@ func (s *MeasurementStorePSQL) GetDatastream(ctx context.Context, id uuid.UUID,
 	idB, _ := id.MarshalBinary()
 	q := pq.Select(
 		"id", "description", "sensor_id", "observed_property", "unit_of_measurement", "created_at",
+		"quality_rules", "archive_time",
 	).From("datastreams").Where(sq.Eq{"id": idB})
 	q = applyDatastreamFilter(q, filter)
 
@@ -334,8 +517,11 @@ func (s *MeasurementStorePSQL) GetDatastream(ctx context.Context, id uuid.UUID,
 	}
 	err = s.databasePool.QueryRow(ctx, query, params...).Scan(
 		&ds.ID, &ds.Description, &ds.SensorID, &ds.ObservedProperty, &ds.UnitOfMeasurement,
-		&ds.CreatedAt,
+		&ds.CreatedAt, &ds.QualityRules, &ds.ArchiveTime,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, measurements.ErrDatastreamNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -346,11 +532,12 @@ func (s *MeasurementStorePSQL) FindOrCreateDatastream(ctx context.Context, tenan
 	var ds measurements.Datastream
 	err := s.databasePool.QueryRow(ctx,
 		`SELECT 
-      id, description, sensor_id, observed_property, unit_of_measurement, created_at, tenant_id
+      id, description, sensor_id, observed_property, unit_of_measurement, created_at, quality_rules, archive_time, tenant_id
      FROM find_or_create_datastream($1, $2, $3, $4)`,
 		tenantID, sensorID, observedProperty, UnitOfMeasurement,
 	).Scan(
-		&ds.ID, &ds.Description, &ds.SensorID, &ds.ObservedProperty, &ds.UnitOfMeasurement, &ds.CreatedAt, &ds.TenantID,
+		&ds.ID, &ds.Description, &ds.SensorID, &ds.ObservedProperty, &ds.UnitOfMeasurement, &ds.CreatedAt,
+		&ds.QualityRules, &ds.ArchiveTime, &ds.TenantID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("could not query datastream: %w", err)
@@ -358,148 +545,509 @@ func (s *MeasurementStorePSQL) FindOrCreateDatastream(ctx context.Context, tenan
 	return &ds, nil
 }
 
-func (s *MeasurementStorePSQL) StoreMeasurement(ctx context.Context, measurement measurements.Measurement) error {
-	_, err := s.databasePool.Exec(ctx, `
-INSERT INTO measurements (
-			uplink_message_id,
-			organisation_id,
-			organisation_name,
-			organisation_address,
-			organisation_zipcode,
-			organisation_city,
-			organisation_chamber_of_commerce_id,
-			organisation_headquarter_id,
-			organisation_state,
-			organisation_archive_time,
-			device_id,
-			device_code,
-			device_description,
-			device_location,
-			device_altitude,
-			device_location_description,
-			device_state,
-			device_properties,
-			sensor_id,
-			sensor_code,
-			sensor_description,
-			sensor_external_id,
-			sensor_properties,
-			sensor_brand,
-			sensor_archive_time,
-			datastream_id,
-			datastream_description,
-			datastream_observed_property,
-			datastream_unit_of_measurement,
-			measurement_timestamp,
-			measurement_value,
-			measurement_location,
-			measurement_altitude,
-			measurement_expiration,
-      feature_of_interest_id,
-      feature_of_interest_name,
-      feature_of_interest_description,
-      feature_of_interest_encoding_type,
-      feature_of_interest_feature,
-      feature_of_interest_properties,
-			created_at
-) VALUES (
-  $1,
-  $2,
-  $3,
-  $4,
-  $5,
-  $6,
-  $7,
-  $8,
-  $9,
-  $10,
-  $11,
-  $12,
-  $13,
-  ST_SETSRID(ST_POINT($14,$15),4326),
-  $16,
-  $17,
-  $18,
-  $19,
-  $20,
-  $21,
-  $22,
-  $23,
-  $24,
-  $25,
-  $26,
-  $27,
-  $28,
-  $29,
-  $30,
-  $31,
-  $32,
-  ST_SETSRID(ST_POINT($33,$34),4326),
-  $35,
-  $36,
-  $37,
-  $38,
-  $39,
-  $40,
-  ST_GeomFromEWKB($41),
-  $42,
-  $43
-);
-
-`,
-		measurement.UplinkMessageID,
-		measurement.OrganisationID,
-		measurement.OrganisationName,
-		measurement.OrganisationAddress,
-		measurement.OrganisationZipcode,
-		measurement.OrganisationCity,
-		measurement.OrganisationChamberOfCommerceID,
-		measurement.OrganisationHeadquarterID,
-		measurement.OrganisationState,
-		measurement.OrganisationArchiveTime,
-		measurement.DeviceID,
-		measurement.DeviceCode,
-		measurement.DeviceDescription,
-		measurement.DeviceLongitude, measurement.DeviceLatitude,
-		measurement.DeviceAltitude,
-		measurement.DeviceLocationDescription,
-		measurement.DeviceState,
-		measurement.DeviceProperties,
-		measurement.SensorID,
-		measurement.SensorCode,
-		measurement.SensorDescription,
-		measurement.SensorExternalID,
-		measurement.SensorProperties,
-		measurement.SensorBrand,
-		measurement.SensorArchiveTime,
-		measurement.DatastreamID,
-		measurement.DatastreamDescription,
-		measurement.DatastreamObservedProperty,
-		measurement.DatastreamUnitOfMeasurement,
-		measurement.MeasurementTimestamp,
-		measurement.MeasurementValue,
-		measurement.MeasurementLongitude, measurement.MeasurementLatitude,
-		measurement.MeasurementAltitude,
-		measurement.MeasurementExpiration,
-		measurement.FeatureOfInterestID,
-		measurement.FeatureOfInterestName,
-		measurement.FeatureOfInterestDescription,
-		measurement.FeatureOfInterestEncodingType,
-		measurement.FeatureOfInterestFeature,
-		measurement.FeatureOfInterestProperties,
-		measurement.CreatedAt,
+func (s *MeasurementStorePSQL) SetDatastreamArchiveTime(ctx context.Context, datastreamID uuid.UUID, days *int) error {
+	_, err := s.databasePool.Exec(ctx,
+		`UPDATE datastreams SET archive_time = $1 WHERE id = $2`,
+		days, datastreamID,
 	)
 	if err != nil {
-		return err
+		return fmt.Errorf("database error updating datastream archive time: %w", err)
 	}
 	return nil
 }
 
-func (s *MeasurementStorePSQL) StoreMeasurements(ctx context.Context, measurements []measurements.Measurement) error {
-	for _, measurement := range measurements {
-		if err := s.StoreMeasurement(ctx, measurement); err != nil {
-			logger.Error("Could not store measurement", "error", err)
+// stagingColumns are the columns of the temporary table measurements are copied into
+// before being inserted in the measurements table. Locations are stored as separate
+// longitude/latitude columns as the geography type has no binary encoding in pgx.
+var stagingColumns = []string{
+	"uplink_message_id",
+	"organisation_id",
+	"organisation_name",
+	"organisation_address",
+	"organisation_zipcode",
+	"organisation_city",
+	"organisation_chamber_of_commerce_id",
+	"organisation_headquarter_id",
+	"organisation_state",
+	"organisation_archive_time",
+	"device_id",
+	"device_code",
+	"device_description",
+	"device_longitude",
+	"device_latitude",
+	"device_altitude",
+	"device_location_description",
+	"device_state",
+	"device_properties",
+	"sensor_id",
+	"sensor_code",
+	"sensor_description",
+	"sensor_external_id",
+	"sensor_properties",
+	"sensor_brand",
+	"sensor_archive_time",
+	"datastream_id",
+	"datastream_description",
+	"datastream_observed_property",
+	"datastream_unit_of_measurement",
+	"measurement_timestamp",
+	"measurement_value",
+	"measurement_longitude",
+	"measurement_latitude",
+	"measurement_altitude",
+	"measurement_properties",
+	"measurement_expiration",
+	"measurement_quality",
+	"measurement_discriminator",
+	"measurement_source",
+	"measurement_submitted_by",
+	"feature_of_interest_id",
+	"feature_of_interest_name",
+	"feature_of_interest_description",
+	"feature_of_interest_encoding_type",
+	"feature_of_interest_feature",
+	"feature_of_interest_properties",
+	"created_at",
+}
+
+const createStagingTableSQL = `
+CREATE TEMPORARY TABLE measurements_staging (
+	uplink_message_id TEXT,
+	organisation_id BIGINT,
+	organisation_name TEXT,
+	organisation_address TEXT,
+	organisation_zipcode TEXT,
+	organisation_city TEXT,
+	organisation_chamber_of_commerce_id TEXT,
+	organisation_headquarter_id TEXT,
+	organisation_state SMALLINT,
+	organisation_archive_time SMALLINT,
+	device_id BIGINT,
+	device_code TEXT,
+	device_description TEXT,
+	device_longitude FLOAT8,
+	device_latitude FLOAT8,
+	device_altitude FLOAT8,
+	device_location_description TEXT,
+	device_state SMALLINT,
+	device_properties JSONB,
+	sensor_id BIGINT,
+	sensor_code TEXT,
+	sensor_description TEXT,
+	sensor_external_id TEXT,
+	sensor_properties JSONB,
+	sensor_brand TEXT,
+	sensor_archive_time SMALLINT,
+	datastream_id UUID,
+	datastream_description TEXT,
+	datastream_observed_property TEXT,
+	datastream_unit_of_measurement TEXT,
+	measurement_timestamp TIMESTAMPTZ(0),
+	measurement_value FLOAT8,
+	measurement_longitude FLOAT8,
+	measurement_latitude FLOAT8,
+	measurement_altitude FLOAT8,
+	measurement_properties JSONB,
+	measurement_expiration DATE,
+	measurement_quality INTEGER,
+	measurement_discriminator TEXT,
+	measurement_source TEXT,
+	measurement_submitted_by TEXT,
+	feature_of_interest_id BIGINT,
+	feature_of_interest_name TEXT,
+	feature_of_interest_description TEXT,
+	feature_of_interest_encoding_type TEXT,
+	feature_of_interest_feature BYTEA,
+	feature_of_interest_properties JSONB,
+	created_at TIMESTAMPTZ,
+	ordinal BIGSERIAL
+) ON COMMIT DROP;`
+
+// insertFromStagingSQL inserts the staged measurements selected by the source formatted into it, conflicts with
+// stored measurements are resolved by the conflict clause formatted into it. The ordinal of every staged measurement
+// that was stored is returned together with its id.
+const insertFromStagingSQL = `
+WITH staged AS (%s), stored AS (
+INSERT INTO measurements (
+	uplink_message_id,
+	organisation_id,
+	organisation_name,
+	organisation_address,
+	organisation_zipcode,
+	organisation_city,
+	organisation_chamber_of_commerce_id,
+	organisation_headquarter_id,
+	organisation_state,
+	organisation_archive_time,
+	device_id,
+	device_code,
+	device_description,
+	device_location,
+	device_altitude,
+	device_location_description,
+	device_state,
+	device_properties,
+	sensor_id,
+	sensor_code,
+	sensor_description,
+	sensor_external_id,
+	sensor_properties,
+	sensor_brand,
+	sensor_archive_time,
+	datastream_id,
+	datastream_description,
+	datastream_observed_property,
+	datastream_unit_of_measurement,
+	measurement_timestamp,
+	measurement_value,
+	measurement_location,
+	measurement_altitude,
+	measurement_properties,
+	measurement_expiration,
+	measurement_quality,
+	measurement_discriminator,
+	measurement_source,
+	measurement_submitted_by,
+	feature_of_interest_id,
+	feature_of_interest_name,
+	feature_of_interest_description,
+	feature_of_interest_encoding_type,
+	feature_of_interest_feature,
+	feature_of_interest_properties,
+	created_at,
+	measurement_duplicate
+) SELECT
+	uplink_message_id::uuid,
+	organisation_id,
+	organisation_name,
+	organisation_address,
+	organisation_zipcode,
+	organisation_city,
+	organisation_chamber_of_commerce_id,
+	organisation_headquarter_id,
+	organisation_state,
+	organisation_archive_time,
+	device_id,
+	device_code,
+	device_description,
+	ST_SETSRID(ST_POINT(device_longitude, device_latitude), 4326),
+	device_altitude,
+	device_location_description,
+	device_state,
+	device_properties,
+	sensor_id,
+	sensor_code,
+	sensor_description,
+	sensor_external_id,
+	sensor_properties,
+	sensor_brand,
+	sensor_archive_time,
+	datastream_id,
+	datastream_description,
+	datastream_observed_property,
+	datastream_unit_of_measurement,
+	measurement_timestamp,
+	measurement_value,
+	ST_SETSRID(ST_POINT(measurement_longitude, measurement_latitude), 4326),
+	measurement_altitude,
+	COALESCE(measurement_properties, '{}'::jsonb),
+	measurement_expiration,
+	measurement_quality,
+	measurement_discriminator,
+	measurement_source,
+	measurement_submitted_by,
+	feature_of_interest_id,
+	feature_of_interest_name,
+	feature_of_interest_description,
+	feature_of_interest_encoding_type,
+	ST_GeomFromEWKB(feature_of_interest_feature),
+	feature_of_interest_properties,
+	created_at,
+	measurement_duplicate
+FROM staged
+%s
+RETURNING id, datastream_id, measurement_timestamp, measurement_discriminator, measurement_duplicate
+)
+SELECT staged.ordinal, stored.id FROM stored
+JOIN staged USING (datastream_id, measurement_timestamp, measurement_discriminator, measurement_duplicate);`
+
+func stagingRow(m measurements.Measurement) []any {
+	return []any{
+		m.UplinkMessageID,
+		m.OrganisationID,
+		m.OrganisationName,
+		m.OrganisationAddress,
+		m.OrganisationZipcode,
+		m.OrganisationCity,
+		m.OrganisationChamberOfCommerceID,
+		m.OrganisationHeadquarterID,
+		m.OrganisationState,
+		m.OrganisationArchiveTime,
+		m.DeviceID,
+		m.DeviceCode,
+		m.DeviceDescription,
+		m.DeviceLongitude,
+		m.DeviceLatitude,
+		m.DeviceAltitude,
+		m.DeviceLocationDescription,
+		m.DeviceState,
+		m.DeviceProperties,
+		m.SensorID,
+		m.SensorCode,
+		m.SensorDescription,
+		m.SensorExternalID,
+		m.SensorProperties,
+		m.SensorBrand,
+		m.SensorArchiveTime,
+		m.DatastreamID,
+		m.DatastreamDescription,
+		m.DatastreamObservedProperty,
+		m.DatastreamUnitOfMeasurement,
+		m.MeasurementTimestamp,
+		m.MeasurementValue,
+		m.MeasurementLongitude,
+		m.MeasurementLatitude,
+		m.MeasurementAltitude,
+		m.MeasurementProperties,
+		m.MeasurementExpiration,
+		int(m.MeasurementQuality),
+		m.MeasurementDiscriminator,
+		m.MeasurementSource,
+		m.MeasurementSubmittedBy,
+		m.FeatureOfInterestID,
+		m.FeatureOfInterestName,
+		m.FeatureOfInterestDescription,
+		m.FeatureOfInterestEncodingType,
+		m.FeatureOfInterestFeature,
+		m.FeatureOfInterestProperties,
+		m.CreatedAt,
+	}
+}
+
+// deleteConflictingDuplicatesSQL deletes the measurements stored next to a measurement that is overwritten by a
+// staged measurement, these only exist if both measurements were kept before
+const deleteConflictingDuplicatesSQL = `
+DELETE FROM measurements m USING measurements_staging staged
+WHERE m.datastream_id = staged.datastream_id
+	AND m.measurement_timestamp = staged.measurement_timestamp
+	AND m.measurement_discriminator = staged.measurement_discriminator
+	AND m.measurement_duplicate > 0
+	AND m.measurement_correction_id IS NULL;`
+
+// overwriteMeasurementSQL replaces every stored value of a measurement with the staged value, except its identity.
+// Corrected measurements are kept, otherwise replaying a message would revert the correction.
+const overwriteMeasurementSQL = `
+ON CONFLICT (datastream_id, measurement_timestamp, measurement_discriminator, measurement_duplicate) DO UPDATE SET
+	uplink_message_id = EXCLUDED.uplink_message_id,
+	organisation_id = EXCLUDED.organisation_id,
+	organisation_name = EXCLUDED.organisation_name,
+	organisation_address = EXCLUDED.organisation_address,
+	organisation_zipcode = EXCLUDED.organisation_zipcode,
+	organisation_city = EXCLUDED.organisation_city,
+	organisation_chamber_of_commerce_id = EXCLUDED.organisation_chamber_of_commerce_id,
+	organisation_headquarter_id = EXCLUDED.organisation_headquarter_id,
+	organisation_state = EXCLUDED.organisation_state,
+	organisation_archive_time = EXCLUDED.organisation_archive_time,
+	device_id = EXCLUDED.device_id,
+	device_code = EXCLUDED.device_code,
+	device_description = EXCLUDED.device_description,
+	device_location = EXCLUDED.device_location,
+	device_altitude = EXCLUDED.device_altitude,
+	device_location_description = EXCLUDED.device_location_description,
+	device_state = EXCLUDED.device_state,
+	device_properties = EXCLUDED.device_properties,
+	sensor_id = EXCLUDED.sensor_id,
+	sensor_code = EXCLUDED.sensor_code,
+	sensor_description = EXCLUDED.sensor_description,
+	sensor_external_id = EXCLUDED.sensor_external_id,
+	sensor_properties = EXCLUDED.sensor_properties,
+	sensor_brand = EXCLUDED.sensor_brand,
+	sensor_archive_time = EXCLUDED.sensor_archive_time,
+	datastream_description = EXCLUDED.datastream_description,
+	datastream_observed_property = EXCLUDED.datastream_observed_property,
+	datastream_unit_of_measurement = EXCLUDED.datastream_unit_of_measurement,
+	measurement_value = EXCLUDED.measurement_value,
+	measurement_location = EXCLUDED.measurement_location,
+	measurement_altitude = EXCLUDED.measurement_altitude,
+	measurement_properties = EXCLUDED.measurement_properties,
+	measurement_expiration = EXCLUDED.measurement_expiration,
+	measurement_quality = EXCLUDED.measurement_quality,
+	measurement_source = EXCLUDED.measurement_source,
+	measurement_submitted_by = EXCLUDED.measurement_submitted_by,
+	feature_of_interest_id = EXCLUDED.feature_of_interest_id,
+	feature_of_interest_name = EXCLUDED.feature_of_interest_name,
+	feature_of_interest_description = EXCLUDED.feature_of_interest_description,
+	feature_of_interest_encoding_type = EXCLUDED.feature_of_interest_encoding_type,
+	feature_of_interest_feature = EXCLUDED.feature_of_interest_feature,
+	feature_of_interest_properties = EXCLUDED.feature_of_interest_properties,
+	created_at = EXCLUDED.created_at
+WHERE measurements.measurement_correction_id IS NULL`
+
+// stagingSource returns the staged measurements to insert and the clause resolving conflicts for the given conflict
+// policy. A measurement is identified by its datastream, timestamp and discriminator, which the unique identity index
+// enforces. Unless both are kept, only one staged measurement is used per identity: the first when ignoring conflicts
+// and the last when overwriting. Keeping both numbers the measurements of an identity after those already stored,
+// a concurrent transaction storing the same identity fails on the index and must be retried.
+func stagingSource(policy measurements.ConflictPolicy) (string, string) {
+	const identity = "datastream_id, measurement_timestamp, measurement_discriminator"
+	switch policy {
+	case measurements.ConflictKeepBoth:
+		return `
+SELECT staged.*, COALESCE(stored.next, 0) + row_number() OVER (
+	PARTITION BY ` + identity + ` ORDER BY staged.ordinal
+) - 1 AS measurement_duplicate
+FROM measurements_staging staged
+LEFT JOIN LATERAL (
+	SELECT max(m.measurement_duplicate) + 1 AS next FROM measurements m
+	WHERE m.datastream_id = staged.datastream_id
+		AND m.measurement_timestamp = staged.measurement_timestamp
+		AND m.measurement_discriminator = staged.measurement_discriminator
+) stored ON true`, ""
+	case measurements.ConflictOverwrite:
+		return "SELECT DISTINCT ON (" + identity + ") *, 0 AS measurement_duplicate FROM measurements_staging ORDER BY " +
+			identity + ", ordinal DESC", overwriteMeasurementSQL
+	default:
+		return "SELECT DISTINCT ON (" + identity + ") *, 0 AS measurement_duplicate FROM measurements_staging ORDER BY " +
+			identity + ", ordinal ASC", "ON CONFLICT DO NOTHING"
+	}
+}
+
+// StoreMeasurements stores all measurements in a single transaction. The measurements are copied into
+// a temporary staging table using the COPY protocol and then inserted into the measurements table at once.
+// Either all measurements are stored or none are. Measurements that already exist are handled according
+// to the conflict policy of the store, the ID is set of every measurement that was stored. The rollups of the
+// stored measurements are refreshed in the same transaction.
+//
+// A transaction that conflicts with a concurrent transaction storing the same measurement identity is retried, so that
+// the conflict is resolved by the conflict policy. This happens most for derived measurements, which are derived at
+// the same timestamp from source measurements that are stored at the same time.
+func (s *MeasurementStorePSQL) StoreMeasurements(ctx context.Context, list []measurements.Measurement) error {
+	if len(list) == 0 {
+		return nil
+	}
+	for ix := range list {
+		list[ix].ID = 0
+	}
+	return retryIdentityConflicts(func() error {
+		tx, err := s.databasePool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("store measurements, could not start transaction: %w", err)
+		}
+		defer tx.Rollback(ctx) //nolint:errcheck
+
+		stored, err := s.storeMeasurements(ctx, tx, list)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("store measurements, could not commit: %w", err)
+		}
+		for ordinal, id := range stored {
+			list[ordinal-1].ID = id
+		}
+		return nil
+	})
+}
+
+// maxIdentityConflictAttempts is how often a transaction storing measurements is attempted when it conflicts with
+// concurrent transactions storing the same measurement identity
+const maxIdentityConflictAttempts = 3
+
+// retryIdentityConflicts attempts fn again if it failed on the unique measurement identity index. The index is only
+// violated by a concurrent transaction that stored the same identity, once that transaction committed its measurement
+// is visible and the conflict policy applies.
+func retryIdentityConflicts(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < maxIdentityConflictAttempts; attempt++ {
+		err = fn()
+		var pgErr *pgconn.PgError
+		// The indexes of hypertable chunks are named after the index of the hypertable
+		if !errors.As(err, &pgErr) || pgErr.Code != "23505" || !strings.HasSuffix(pgErr.ConstraintName, "measurements_identity_idx") {
+			return err
 		}
 	}
-	return nil
+	return err
+}
+
+// storeMeasurements stores the measurements in the transaction as described by StoreMeasurements, it can be called
+// once per transaction. The id of every stored measurement is returned by its ordinal, which is its index in the list
+// plus one.
+func (s *MeasurementStorePSQL) storeMeasurements(ctx context.Context, tx pgx.Tx, list []measurements.Measurement) (map[int64]int, error) {
+	if _, err := tx.Exec(ctx, createStagingTableSQL); err != nil {
+		return nil, fmt.Errorf("store measurements, could not create staging table: %w", err)
+	}
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"measurements_staging"}, stagingColumns,
+		pgx.CopyFromSlice(len(list), func(ix int) ([]any, error) {
+			return stagingRow(list[ix]), nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("store measurements, could not copy to staging table: %w", err)
+	}
+	datastreamIDs := make([]uuid.UUID, len(list))
+	timestamps := make([]time.Time, len(list))
+	for ix, m := range list {
+		datastreamIDs[ix], timestamps[ix] = m.DatastreamID, m.MeasurementTimestamp
+	}
+	rollups, err := s.snapshotRollups(ctx, tx, datastreamIDs, timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("store measurements: %w", err)
+	}
+	if s.conflictPolicy == measurements.ConflictOverwrite {
+		if _, err := tx.Exec(ctx, deleteConflictingDuplicatesSQL); err != nil {
+			return nil, fmt.Errorf("store measurements, could not delete conflicting measurements: %w", err)
+		}
+	}
+	source, conflict := stagingSource(s.conflictPolicy)
+	rows, err := tx.Query(ctx, fmt.Sprintf(insertFromStagingSQL, source, conflict))
+	if err != nil {
+		return nil, fmt.Errorf("store measurements, could not insert from staging table: %w", err)
+	}
+	stored := map[int64]int{}
+	for rows.Next() {
+		var ordinal int64
+		var id int
+		if err := rows.Scan(&ordinal, &id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("store measurements, could not scan stored measurement: %w", err)
+		}
+		stored[ordinal] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store measurements, could not insert from staging table: %w", err)
+	}
+	if err := s.refreshRollups(ctx, tx, rollups); err != nil {
+		return nil, fmt.Errorf("store measurements: %w", err)
+	}
+	if len(s.commitHooks) > 0 && len(stored) > 0 {
+		// Staged measurements are numbered from one in the order they were copied
+		hooked := make([]measurements.Measurement, 0, len(stored))
+		for ordinal := int64(1); ordinal <= int64(len(list)); ordinal++ {
+			if id, ok := stored[ordinal]; ok {
+				m := list[ordinal-1]
+				m.ID = id
+				hooked = append(hooked, m)
+			}
+		}
+		for _, hook := range s.commitHooks {
+			if err := hook(ctx, tx, hooked); err != nil {
+				return nil, fmt.Errorf("store measurements, commit hook failed: %w", err)
+			}
+		}
+	}
+	return stored, nil
+}
+
+func (s *MeasurementStorePSQL) ListSensorGroupSensors(ctx context.Context, tenantID int64, groupIDs []int64) ([]int64, error) {
+	rows, err := s.databasePool.Query(ctx, `
+		SELECT DISTINCT sgs.sensor_id FROM sensor_groups_sensors sgs
+		JOIN sensor_groups sg ON sg.id = sgs.sensor_group_id
+		WHERE sg.tenant_id = $1 AND sg.id = ANY($2)`,
+		tenantID, groupIDs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting sensor group sensors from db: %w", err)
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
 }
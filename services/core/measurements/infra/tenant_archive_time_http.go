@@ -0,0 +1,54 @@
+package measurementsinfra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+var _ measurements.TenantArchiveTimeProvider = (*TenantArchiveTimeHTTP)(nil)
+
+// TenantArchiveTimeHTTP fetches tenant archive times from the internal endpoint of the tenants service
+type TenantArchiveTimeHTTP struct {
+	url        string
+	httpClient http.Client
+}
+
+func NewTenantArchiveTimeHTTP(url string) *TenantArchiveTimeHTTP {
+	return &TenantArchiveTimeHTTP{
+		url:        url,
+		httpClient: http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *TenantArchiveTimeHTTP) GetTenantArchiveTime(ctx context.Context, tenantID int64) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/internal/tenants/%d/archive-time", c.url, tenantID), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tenant archive time: %w", err)
+	}
+	defer res.Body.Close()
+
+	// Measurements of unknown tenants fall back to the system archive time
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch tenant archive time: unexpected status %d", res.StatusCode)
+	}
+	var body web.APIResponse[struct {
+		ArchiveTimeDays *int `json:"archive_time_days"`
+	}]
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode tenant archive time: %w", err)
+	}
+	return body.Data.ArchiveTimeDays, nil
+}
@@ -0,0 +1,249 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+var ErrMeasurementInvalid = web.NewError(http.StatusBadRequest, "Measurement is invalid", "ERR_MEASUREMENT_INVALID")
+
+// MaxMeasurementsPerRequest limits the amount of measurements that can be added in a single request
+const MaxMeasurementsPerRequest = 10000
+
+// The source of a measurement records how it was ingested
+const (
+	MeasurementSourcePipeline = "pipeline"
+	MeasurementSourceAPI      = "api"
+	MeasurementSourceDerived  = "derived"
+)
+
+// DeviceStore finds the devices of measurements that are added through the API
+type DeviceStore interface {
+	List(context.Context, devices.DeviceFilter, pagination.Request) (*pagination.Page[devices.Device], error)
+}
+
+// NewMeasurement is a measurement that is added through the API instead of a pipeline,
+// such as a manual field reading or a lab result
+type NewMeasurement struct {
+	Timestamp  time.Time      `json:"timestamp"`
+	Value      float64        `json:"value"`
+	Latitude   *float64       `json:"latitude"`
+	Longitude  *float64       `json:"longitude"`
+	Altitude   *float64       `json:"altitude"`
+	Properties map[string]any `json:"properties"`
+}
+
+func (m NewMeasurement) Validate() error {
+	if m.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return errors.New("value must be a finite number")
+	}
+	if (m.Latitude == nil) != (m.Longitude == nil) {
+		return errors.New("latitude and longitude must be given together")
+	}
+	return nil
+}
+
+// NewSensorMeasurement is a measurement added through the API for the datastream of a sensor
+// identified by the device code, sensor code and observed property. The datastream is created
+// if it does not exist yet.
+type NewSensorMeasurement struct {
+	DeviceCode        string `json:"device_code"`
+	SensorCode        string `json:"sensor_code"`
+	ObservedProperty  string `json:"observed_property"`
+	UnitOfMeasurement string `json:"unit_of_measurement"`
+	NewMeasurement
+}
+
+// Submission describes measurements added through the API. Its ID is recorded as uplink message id
+// of every measurement, so that the measurements of a single request can be traced back.
+type Submission struct {
+	ID           uuid.UUID `json:"id"`
+	Measurements int       `json:"measurements"`
+}
+
+// AddDatastreamMeasurements adds measurements to an existing datastream. Either all measurements
+// are stored or none are.
+func (s *Service) AddDatastreamMeasurements(ctx context.Context, id uuid.UUID, list []NewMeasurement) (*Submission, error) {
+	tenantID, err := authorizeSubmission(ctx, len(list))
+	if err != nil {
+		return nil, err
+	}
+	for ix, m := range list {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: measurement %d: %w", ErrMeasurementInvalid, ix, err)
+		}
+	}
+
+	ds, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}})
+	if err != nil {
+		return nil, err
+	}
+	dev, sensor, err := s.findSensorDevice(ctx, ds.SensorID)
+	if err != nil {
+		return nil, err
+	}
+
+	submission := newSubmission(ctx, s.store)
+	retention, err := s.retention(ctx, tenantID, sensor, ds)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range list {
+		if err := submission.add(tenantID, dev, sensor, ds, m, retention); err != nil {
+			return nil, err
+		}
+	}
+	return submission.commit(s)
+}
+
+// AddMeasurements adds measurements to the datastreams of sensors identified by device code, sensor code and
+// observed property. Either all measurements are stored or none are.
+func (s *Service) AddMeasurements(ctx context.Context, list []NewSensorMeasurement) (*Submission, error) {
+	tenantID, err := authorizeSubmission(ctx, len(list))
+	if err != nil {
+		return nil, err
+	}
+	for ix, m := range list {
+		if m.DeviceCode == "" || m.SensorCode == "" || m.ObservedProperty == "" {
+			return nil, fmt.Errorf("%w: measurement %d: device_code, sensor_code and observed_property are required", ErrMeasurementInvalid, ix)
+		}
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: measurement %d: %w", ErrMeasurementInvalid, ix, err)
+		}
+	}
+
+	submission := newSubmission(ctx, s.store)
+	devicesByCode := map[string]*devices.Device{}
+	for ix, m := range list {
+		dev, ok := devicesByCode[m.DeviceCode]
+		if !ok {
+			page, err := s.deviceStore.List(ctx, devices.DeviceFilter{Code: []string{m.DeviceCode}}, pagination.Request{Limit: 1})
+			if err != nil {
+				return nil, err
+			}
+			if len(page.Data) == 0 {
+				return nil, fmt.Errorf("%w: measurement %d: device %s does not exist", ErrMeasurementInvalid, ix, m.DeviceCode)
+			}
+			dev = &page.Data[0]
+			devicesByCode[m.DeviceCode] = dev
+		}
+		sensor, err := dev.GetSensorByCode(m.SensorCode)
+		if err != nil {
+			return nil, fmt.Errorf("%w: measurement %d: device %s has no sensor %s", ErrMeasurementInvalid, ix, m.DeviceCode, m.SensorCode)
+		}
+		uom, err := CanonicalUnit(m.UnitOfMeasurement)
+		if err != nil {
+			return nil, fmt.Errorf("measurement %d: %w", ix, err)
+		}
+		ds, err := s.store.FindOrCreateDatastream(ctx, tenantID, sensor.ID, m.ObservedProperty, uom)
+		if err != nil {
+			return nil, err
+		}
+		retention, err := s.retention(ctx, tenantID, sensor, ds)
+		if err != nil {
+			return nil, err
+		}
+		if err := submission.add(tenantID, dev, sensor, ds, m.NewMeasurement, retention); err != nil {
+			return nil, err
+		}
+	}
+	return submission.commit(s)
+}
+
+func authorizeSubmission(ctx context.Context, count int) (int64, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return 0, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 || count > MaxMeasurementsPerRequest {
+		return 0, fmt.Errorf("%w: between 1 and %d measurements must be given", ErrMeasurementInvalid, MaxMeasurementsPerRequest)
+	}
+	return tenantID, nil
+}
+
+func findSensor(dev *devices.Device, id int64) (*devices.Sensor, bool) {
+	for ix := range dev.Sensors {
+		if dev.Sensors[ix].ID == id {
+			return &dev.Sensors[ix], true
+		}
+	}
+	return nil, false
+}
+
+// submission collects the measurements of a single API request
+type submission struct {
+	ctx         context.Context
+	id          uuid.UUID
+	submittedBy *string
+	now         time.Time
+	quality     *qualityEvaluator
+	batch       []Measurement
+}
+
+func newSubmission(ctx context.Context, store Store) *submission {
+	now := time.Now()
+	sub := &submission{
+		ctx:     ctx,
+		id:      uuid.New(),
+		now:     now,
+		quality: newQualityEvaluator(store, now),
+	}
+	if user, err := auth.GetUser(ctx); err == nil {
+		sub.submittedBy = &user
+	}
+	return sub
+}
+
+func (sub *submission) add(tenantID int64, dev *devices.Device, sensor *devices.Sensor, ds *Datastream, m NewMeasurement, retention Retention) error {
+	measurement := newMeasurement(tenantID, dev, sensor, ds, sub.now)
+	measurement.UplinkMessageID = sub.id.String()
+	measurement.MeasurementSource = MeasurementSourceAPI
+	measurement.MeasurementSubmittedBy = sub.submittedBy
+	measurement.MeasurementTimestamp = m.Timestamp
+	measurement.MeasurementValue = m.Value
+	measurement.MeasurementProperties = m.Properties
+	measurement.MeasurementDiscriminator = discriminatorValue(m.Properties[DiscriminatorProperty])
+	measurement.MeasurementExpiration = retention.Expiration(sub.now)
+	measurement.OrganisationArchiveTime = lo.FromPtr(retention.TenantArchiveTime)
+	if m.Latitude != nil && m.Longitude != nil {
+		measurement.MeasurementLatitude = m.Latitude
+		measurement.MeasurementLongitude = m.Longitude
+		measurement.MeasurementAltitude = m.Altitude
+	}
+
+	var err error
+	measurement.MeasurementQuality, err = sub.quality.evaluate(sub.ctx, ds, Sample{
+		Timestamp: measurement.MeasurementTimestamp,
+		Value:     measurement.MeasurementValue,
+	})
+	if err != nil {
+		return err
+	}
+	sub.batch = append(sub.batch, measurement)
+	return nil
+}
+
+func (sub *submission) commit(s *Service) (*Submission, error) {
+	if err := s.commitMeasurements(sub.ctx, sub.batch); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMeasurementsNotCommitted, err)
+	}
+	return &Submission{ID: sub.id, Measurements: len(sub.batch)}, nil
+}
@@ -0,0 +1,193 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func newIngestionDevice() devices.Device {
+	return devices.Device{
+		ID:        1,
+		Code:      "well-1",
+		TenantID:  authtest.DefaultTenantID,
+		Latitude:  ptr(51.5),
+		Longitude: ptr(3.6),
+		Sensors: []devices.Sensor{
+			{ID: 11, Code: "pressure", DeviceID: 1},
+			{ID: 12, Code: "level", DeviceID: 1},
+		},
+	}
+}
+
+func TestAddDatastreamMeasurementsShouldStoreWithProvenance(t *testing.T) {
+	ds := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "water_level", UnitOfMeasurement: "m"}
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &ds, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return nil
+		},
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore)
+
+	submission, err := svc.AddDatastreamMeasurements(authtest.GodContext(), ds.ID, []measurements.NewMeasurement{
+		{Timestamp: timestamp, Value: 1.25},
+		{Timestamp: timestamp.Add(time.Hour), Value: 1.5, Latitude: ptr(51.6), Longitude: ptr(3.7)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, submission.Measurements)
+
+	require.Len(t, store.GetDatastreamCalls(), 1)
+	assert.Equal(t, []int64{authtest.DefaultTenantID}, store.GetDatastreamCalls()[0].Filter.TenantID)
+	require.Len(t, deviceStore.ListCalls(), 1)
+	assert.Equal(t, []int64{ds.SensorID}, deviceStore.ListCalls()[0].DeviceFilter.Sensor)
+
+	require.Len(t, store.StoreMeasurementsCalls(), 1)
+	stored := store.StoreMeasurementsCalls()[0].MeasurementsMoqParam
+	require.Len(t, stored, 2)
+	for _, m := range stored {
+		assert.Equal(t, submission.ID.String(), m.UplinkMessageID)
+		assert.Equal(t, measurements.MeasurementSourceAPI, m.MeasurementSource)
+		assert.Equal(t, ptr(authtest.DefaultSub), m.MeasurementSubmittedBy)
+		assert.Equal(t, ds.ID, m.DatastreamID)
+		assert.Equal(t, "level", m.SensorCode)
+		assert.Equal(t, int(authtest.DefaultTenantID), m.OrganisationID)
+	}
+	assert.Equal(t, 1.25, stored[0].MeasurementValue)
+	assert.Equal(t, ptr(51.5), stored[0].MeasurementLatitude, "device location should be used by default")
+	assert.Equal(t, ptr(51.6), stored[1].MeasurementLatitude)
+}
+
+func TestAddMeasurementsShouldResolveDatastreams(t *testing.T) {
+	store := &StoreMock{
+		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: uuid.New(), SensorID: sensorID, ObservedProperty: observedProperty, UnitOfMeasurement: UnitOfMeasurement}, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return nil
+		},
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore)
+
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, err := svc.AddMeasurements(authtest.GodContext(), []measurements.NewSensorMeasurement{
+		{DeviceCode: "well-1", SensorCode: "pressure", ObservedProperty: "pressure", UnitOfMeasurement: "Pa", NewMeasurement: measurements.NewMeasurement{Timestamp: timestamp, Value: 1}},
+		{DeviceCode: "well-1", SensorCode: "level", ObservedProperty: "water_level", UnitOfMeasurement: "m", NewMeasurement: measurements.NewMeasurement{Timestamp: timestamp, Value: 2}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, deviceStore.ListCalls(), 1, "devices should be looked up once per code")
+	assert.Equal(t, []string{"well-1"}, deviceStore.ListCalls()[0].DeviceFilter.Code)
+	require.Len(t, store.FindOrCreateDatastreamCalls(), 2)
+	assert.Equal(t, int64(11), store.FindOrCreateDatastreamCalls()[0].SensorID)
+	assert.Equal(t, int64(12), store.FindOrCreateDatastreamCalls()[1].SensorID)
+	require.Len(t, store.StoreMeasurementsCalls(), 1)
+	assert.Len(t, store.StoreMeasurementsCalls()[0].MeasurementsMoqParam, 2)
+}
+
+func TestAddMeasurementsShouldRejectInvalidSubmissions(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	valid := measurements.NewSensorMeasurement{
+		DeviceCode: "well-1", SensorCode: "level", ObservedProperty: "water_level", UnitOfMeasurement: "m",
+		NewMeasurement: measurements.NewMeasurement{Timestamp: timestamp, Value: 2},
+	}
+	testCases := []struct {
+		desc string
+		ctx  context.Context
+		list func() []measurements.NewSensorMeasurement
+		err  error
+	}{
+		{
+			desc: "missing permission",
+			ctx:  auth.CreateAuthenticatedContextForTESTING(context.Background(), "user", authtest.DefaultTenantID, auth.Permissions{auth.READ_MEASUREMENTS}),
+			list: func() []measurements.NewSensorMeasurement { return []measurements.NewSensorMeasurement{valid} },
+			err:  auth.ErrForbidden,
+		},
+		{
+			desc: "no measurements",
+			list: func() []measurements.NewSensorMeasurement { return nil },
+			err:  measurements.ErrMeasurementInvalid,
+		},
+		{
+			desc: "missing timestamp",
+			list: func() []measurements.NewSensorMeasurement {
+				m := valid
+				m.Timestamp = time.Time{}
+				return []measurements.NewSensorMeasurement{m}
+			},
+			err: measurements.ErrMeasurementInvalid,
+		},
+		{
+			desc: "unknown device",
+			list: func() []measurements.NewSensorMeasurement {
+				m := valid
+				m.DeviceCode = "unknown"
+				return []measurements.NewSensorMeasurement{m}
+			},
+			err: measurements.ErrMeasurementInvalid,
+		},
+		{
+			desc: "unknown sensor",
+			list: func() []measurements.NewSensorMeasurement {
+				m := valid
+				m.SensorCode = "unknown"
+				return []measurements.NewSensorMeasurement{m}
+			},
+			err: measurements.ErrMeasurementInvalid,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := &StoreMock{}
+			deviceStore := &DeviceStoreMock{
+				ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+					if filter.Code[0] != "well-1" {
+						return &pagination.Page[devices.Device]{}, nil
+					}
+					return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+				},
+			}
+			svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore)
+			ctx := tC.ctx
+			if ctx == nil {
+				ctx = authtest.GodContext()
+			}
+
+			_, err := svc.AddMeasurements(ctx, tC.list())
+
+			assert.ErrorIs(t, err, tC.err)
+			assert.Empty(t, store.StoreMeasurementsCalls())
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package measurements
+
+import (
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+// ReportedLocations returns the device locations reported by the measurements, once per device and timestamp.
+// Measurements that fall back to the location of their device report no location, and locations with invalid
+// coordinates are skipped as the measurements they were reported with are stored regardless.
+func ReportedLocations(list []Measurement) []devices.DeviceLocation {
+	type key struct {
+		deviceID  int64
+		timestamp int64
+	}
+	locations := []devices.DeviceLocation{}
+	for _, m := range list {
+		if !m.LocationReported || m.MeasurementLatitude == nil || m.MeasurementLongitude == nil {
+			continue
+		}
+		location := reportedLocation(m)
+		if err := location.Validate(); err != nil {
+			continue
+		}
+		locations = append(locations, location)
+	}
+	return lo.UniqBy(locations, func(l devices.DeviceLocation) key {
+		return key{l.DeviceID, l.Timestamp.UnixNano()}
+	})
+}
+
+// reportedLocation is the location a pipeline measurement reported for its device
+func reportedLocation(m Measurement) devices.DeviceLocation {
+	return devices.DeviceLocation{
+		DeviceID:  m.DeviceID,
+		TenantID:  int64(m.OrganisationID),
+		Timestamp: m.MeasurementTimestamp,
+		Latitude:  *m.MeasurementLatitude,
+		Longitude: *m.MeasurementLongitude,
+		Altitude:  m.MeasurementAltitude,
+		Source:    devices.LocationSourcePipeline,
+	}
+}
@@ -0,0 +1,49 @@
+package measurements_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestShouldReportLocationsOfPipelineMeasurements(t *testing.T) {
+	var stored []measurements.Measurement
+	store := newBatchTestStore(func(list []measurements.Measurement) error {
+		stored = list
+		return nil
+	})
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	msg := newStorableMessage(t)
+	msg.Device.Latitude = ptr(10.0)
+	msg.Device.Longitude = ptr(20.0)
+	ts := time.Now().Add(-time.Minute).UnixMilli()
+	// Two measurements of the same fix, one with invalid coordinates and one that falls back to the location of
+	// the device
+	require.NoError(t, msg.NewMeasurement().SetValue(1, "obs", "1").SetSensor("sensor").
+		SetTimestamp(ts).SetLocation(51.5, 3.6, 2).Add())
+	require.NoError(t, msg.NewMeasurement().SetValue(2, "other", "1").SetSensor("sensor").
+		SetTimestamp(ts).SetLocation(51.5, 3.6, 2).Add())
+	require.NoError(t, msg.NewMeasurement().SetValue(3, "obs", "1").SetSensor("sensor").
+		SetTimestamp(ts+1000).SetLocation(91, 3.6, 2).Add())
+	require.NoError(t, msg.NewMeasurement().SetValue(4, "obs", "1").SetSensor("sensor").Add())
+
+	require.NoError(t, svc.ProcessPipelineMessage(msg))
+	require.Len(t, stored, 4)
+	assert.False(t, stored[3].LocationReported)
+
+	assert.Equal(t, []devices.DeviceLocation{{
+		DeviceID:  msg.Device.ID,
+		TenantID:  authtest.DefaultTenantID,
+		Timestamp: time.UnixMilli(ts),
+		Latitude:  51.5,
+		Longitude: 3.6,
+		Altitude:  ptr(2.0),
+		Source:    devices.LocationSourcePipeline,
+	}}, measurements.ReportedLocations(stored))
+}
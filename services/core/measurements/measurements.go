@@ -3,6 +3,8 @@ package measurements
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,8 +16,49 @@ import (
 var (
 	ErrMissingDeviceInMeasurement    = errors.New("received measurement where device was not set, can't store")
 	ErrMissingTimestampInMeasurement = errors.New("received measurement where timestamp was not set, can't store")
+	ErrConflictPolicyInvalid         = errors.New("measurement conflict policy is invalid, use one of: ignore, overwrite, keep")
 )
 
+// DiscriminatorProperty is the measurement property that distinguishes measurements of the same
+// datastream with the same timestamp, such as readings of multiple sensor channels or sequence numbers
+const DiscriminatorProperty = "discriminator"
+
+// ConflictPolicy determines what happens when a measurement is stored for a datastream, timestamp
+// and discriminator which already has a measurement. This happens when a pipeline message is
+// redelivered or a trace is replayed.
+type ConflictPolicy string
+
+const (
+	// ConflictIgnore keeps the existing measurement and drops the new one
+	ConflictIgnore ConflictPolicy = "ignore"
+	// ConflictOverwrite replaces the existing measurement with the new one
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictKeepBoth stores the new measurement next to the existing one
+	ConflictKeepBoth ConflictPolicy = "keep"
+)
+
+// discriminatorValue formats the discriminator property, numbers decoded from JSON are formatted
+// without exponent so that they are stored the same regardless of their size
+func discriminatorValue(v any) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(policy); p {
+	case ConflictIgnore, ConflictOverwrite, ConflictKeepBoth:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrConflictPolicyInvalid, policy)
+}
+
 type Measurement struct {
 	ID                              int                          `json:"measurement_id"`
 	UplinkMessageID                 string                       `json:"uplink_message_id"`
@@ -55,6 +98,11 @@ type Measurement struct {
 	MeasurementLongitude            *float64                     `json:"measurement_longitude"`
 	MeasurementAltitude             *float64                     `json:"measurement_altitude"`
 	MeasurementProperties           map[string]any               `json:"measurement_properties"`
+	MeasurementQuality              QualityFlag                  `json:"measurement_quality"`
+	MeasurementDiscriminator        string                       `json:"measurement_discriminator"`
+	MeasurementSource               string                       `json:"measurement_source"`
+	MeasurementSubmittedBy          *string                      `json:"measurement_submitted_by"`
+	MeasurementCorrectionID         *int64                       `json:"measurement_correction_id"`
 	MeasurementExpiration           time.Time                    `json:"measurement_expiration"`
 	FeatureOfInterestID             *int64                       `json:"feature_of_interest_id"`
 	FeatureOfInterestName           *string                      `json:"feature_of_interest_name"`
@@ -63,4 +111,8 @@ type Measurement struct {
 	FeatureOfInterestFeature        *featuresofinterest.Geometry `json:"feature_of_interest_feature"`
 	FeatureOfInterestProperties     *json.RawMessage             `json:"feature_of_interest_properties"`
 	CreatedAt                       time.Time                    `json:"created_at"`
+
+	// LocationReported is set if the pipeline reported the location of the measurement instead of falling back to
+	// the location of the device, it is not stored
+	LocationReported bool `json:"-"`
 }
@@ -7,8 +7,10 @@ import (
 	"context"
 	"github.com/google/uuid"
 	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
 	"sensorbucket.nl/sensorbucket/services/core/measurements"
 	"sync"
+	"time"
 )
 
 // Ensure, that StoreMock does implement measurements.Store.
@@ -21,24 +23,81 @@ var _ measurements.Store = &StoreMock{}
 //
 //		// make and configure a mocked measurements.Store
 //		mockedStore := &StoreMock{
+//			AggregateMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+//				panic("mock out the AggregateMeasurements method")
+//			},
+//			ApplyCorrectionFunc: func(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+//				panic("mock out the ApplyCorrection method")
+//			},
+//			CountHistogramFunc: func(ctx context.Context, ranges []measurements.HistogramRange, start time.Time, end time.Time, resolution measurements.Resolution) ([]measurements.HistogramCount, error) {
+//				panic("mock out the CountHistogram method")
+//			},
+//			CreateDerivedDatastreamFunc: func(ctx context.Context, derived *measurements.DerivedDatastream) error {
+//				panic("mock out the CreateDerivedDatastream method")
+//			},
+//			ExportMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+//				panic("mock out the ExportMeasurements method")
+//			},
 //			FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID int64, sensorID int64, observedProperty string, UnitOfMeasurement string) (*measurements.Datastream, error) {
 //				panic("mock out the FindOrCreateDatastream method")
 //			},
 //			GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
 //				panic("mock out the GetDatastream method")
 //			},
+//			GetDerivedDatastreamFunc: func(ctx context.Context, id uuid.UUID, tenantID int64) (*measurements.DerivedDatastream, error) {
+//				panic("mock out the GetDerivedDatastream method")
+//			},
+//			GetRollupRetentionFunc: func(ctx context.Context, tenantID int64) (*measurements.RollupRetention, error) {
+//				panic("mock out the GetRollupRetention method")
+//			},
+//			ListCorrectionsFunc: func(ctx context.Context, datastreamID uuid.UUID, r pagination.Request) (*pagination.Page[measurements.Correction], error) {
+//				panic("mock out the ListCorrections method")
+//			},
+//			ListDailyCountsFunc: func(ctx context.Context, datastreamID uuid.UUID, start time.Time, end time.Time) ([]measurements.DailyCount, error) {
+//				panic("mock out the ListDailyCounts method")
+//			},
 //			ListDatastreamsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
 //				panic("mock out the ListDatastreams method")
 //			},
+//			ListDerivedDatastreamsFunc: func(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+//				panic("mock out the ListDerivedDatastreams method")
+//			},
+//			ListGapsFunc: func(ctx context.Context, datastreamID uuid.UUID, start time.Time, end time.Time, threshold time.Duration, limit int) ([]measurements.Gap, error) {
+//				panic("mock out the ListGaps method")
+//			},
+//			ListLatestMeasurementsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+//				panic("mock out the ListLatestMeasurements method")
+//			},
+//			ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+//				panic("mock out the ListRecentSamples method")
+//			},
+//			ListReportingStatsFunc: func(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start time.Time, end time.Time) ([]measurements.ReportingStats, error) {
+//				panic("mock out the ListReportingStats method")
+//			},
+//			ListSamplesAtFunc: func(ctx context.Context, datastreamIDs []uuid.UUID, timestamps []time.Time) ([]*measurements.Sample, error) {
+//				panic("mock out the ListSamplesAt method")
+//			},
+//			ListSensorGroupSensorsFunc: func(ctx context.Context, tenantID int64, groupIDs []int64) ([]int64, error) {
+//				panic("mock out the ListSensorGroupSensors method")
+//			},
 //			QueryFunc: func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
 //				panic("mock out the Query method")
 //			},
-//			StoreMeasurementFunc: func(contextMoqParam context.Context, measurement measurements.Measurement) error {
-//				panic("mock out the StoreMeasurement method")
+//			SetDatastreamArchiveTimeFunc: func(ctx context.Context, datastreamID uuid.UUID, days *int) error {
+//				panic("mock out the SetDatastreamArchiveTime method")
+//			},
+//			SetDatastreamQualityRulesFunc: func(ctx context.Context, datastreamID uuid.UUID, rules measurements.QualityRules) error {
+//				panic("mock out the SetDatastreamQualityRules method")
+//			},
+//			SetRollupRetentionFunc: func(ctx context.Context, tenantID int64, retention measurements.RollupRetention) error {
+//				panic("mock out the SetRollupRetention method")
 //			},
 //			StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
 //				panic("mock out the StoreMeasurements method")
 //			},
+//			SummarizeValuesFunc: func(ctx context.Context, datastreamIDs []uuid.UUID, start time.Time, end time.Time, resolution measurements.Resolution) ([]measurements.ValueSummary, error) {
+//				panic("mock out the SummarizeValues method")
+//			},
 //		}
 //
 //		// use mockedStore in code that requires measurements.Store
@@ -46,26 +105,130 @@ var _ measurements.Store = &StoreMock{}
 //
 //	}
 type StoreMock struct {
+	// AggregateMeasurementsFunc mocks the AggregateMeasurements method.
+	AggregateMeasurementsFunc func(contextMoqParam context.Context, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error)
+
+	// ApplyCorrectionFunc mocks the ApplyCorrection method.
+	ApplyCorrectionFunc func(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error
+
+	// CountHistogramFunc mocks the CountHistogram method.
+	CountHistogramFunc func(ctx context.Context, ranges []measurements.HistogramRange, start time.Time, end time.Time, resolution measurements.Resolution) ([]measurements.HistogramCount, error)
+
+	// CreateDerivedDatastreamFunc mocks the CreateDerivedDatastream method.
+	CreateDerivedDatastreamFunc func(ctx context.Context, derived *measurements.DerivedDatastream) error
+
+	// ExportMeasurementsFunc mocks the ExportMeasurements method.
+	ExportMeasurementsFunc func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error
+
 	// FindOrCreateDatastreamFunc mocks the FindOrCreateDatastream method.
 	FindOrCreateDatastreamFunc func(ctx context.Context, tenantID int64, sensorID int64, observedProperty string, UnitOfMeasurement string) (*measurements.Datastream, error)
 
 	// GetDatastreamFunc mocks the GetDatastream method.
 	GetDatastreamFunc func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error)
 
+	// GetDerivedDatastreamFunc mocks the GetDerivedDatastream method.
+	GetDerivedDatastreamFunc func(ctx context.Context, id uuid.UUID, tenantID int64) (*measurements.DerivedDatastream, error)
+
+	// GetRollupRetentionFunc mocks the GetRollupRetention method.
+	GetRollupRetentionFunc func(ctx context.Context, tenantID int64) (*measurements.RollupRetention, error)
+
+	// ListCorrectionsFunc mocks the ListCorrections method.
+	ListCorrectionsFunc func(ctx context.Context, datastreamID uuid.UUID, r pagination.Request) (*pagination.Page[measurements.Correction], error)
+
+	// ListDailyCountsFunc mocks the ListDailyCounts method.
+	ListDailyCountsFunc func(ctx context.Context, datastreamID uuid.UUID, start time.Time, end time.Time) ([]measurements.DailyCount, error)
+
 	// ListDatastreamsFunc mocks the ListDatastreams method.
 	ListDatastreamsFunc func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error)
 
+	// ListDerivedDatastreamsFunc mocks the ListDerivedDatastreams method.
+	ListDerivedDatastreamsFunc func(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error)
+
+	// ListGapsFunc mocks the ListGaps method.
+	ListGapsFunc func(ctx context.Context, datastreamID uuid.UUID, start time.Time, end time.Time, threshold time.Duration, limit int) ([]measurements.Gap, error)
+
+	// ListLatestMeasurementsFunc mocks the ListLatestMeasurements method.
+	ListLatestMeasurementsFunc func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Measurement], error)
+
+	// ListRecentSamplesFunc mocks the ListRecentSamples method.
+	ListRecentSamplesFunc func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error)
+
+	// ListReportingStatsFunc mocks the ListReportingStats method.
+	ListReportingStatsFunc func(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start time.Time, end time.Time) ([]measurements.ReportingStats, error)
+
+	// ListSamplesAtFunc mocks the ListSamplesAt method.
+	ListSamplesAtFunc func(ctx context.Context, datastreamIDs []uuid.UUID, timestamps []time.Time) ([]*measurements.Sample, error)
+
+	// ListSensorGroupSensorsFunc mocks the ListSensorGroupSensors method.
+	ListSensorGroupSensorsFunc func(ctx context.Context, tenantID int64, groupIDs []int64) ([]int64, error)
+
 	// QueryFunc mocks the Query method.
 	QueryFunc func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error)
 
-	// StoreMeasurementFunc mocks the StoreMeasurement method.
-	StoreMeasurementFunc func(contextMoqParam context.Context, measurement measurements.Measurement) error
+	// SetDatastreamArchiveTimeFunc mocks the SetDatastreamArchiveTime method.
+	SetDatastreamArchiveTimeFunc func(ctx context.Context, datastreamID uuid.UUID, days *int) error
+
+	// SetDatastreamQualityRulesFunc mocks the SetDatastreamQualityRules method.
+	SetDatastreamQualityRulesFunc func(ctx context.Context, datastreamID uuid.UUID, rules measurements.QualityRules) error
+
+	// SetRollupRetentionFunc mocks the SetRollupRetention method.
+	SetRollupRetentionFunc func(ctx context.Context, tenantID int64, retention measurements.RollupRetention) error
 
 	// StoreMeasurementsFunc mocks the StoreMeasurements method.
 	StoreMeasurementsFunc func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error
 
+	// SummarizeValuesFunc mocks the SummarizeValues method.
+	SummarizeValuesFunc func(ctx context.Context, datastreamIDs []uuid.UUID, start time.Time, end time.Time, resolution measurements.Resolution) ([]measurements.ValueSummary, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// AggregateMeasurements holds details about calls to the AggregateMeasurements method.
+		AggregateMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// Filter is the filter argument value.
+			Filter measurements.Filter
+			// AggregationOptions is the aggregationOptions argument value.
+			AggregationOptions measurements.AggregationOptions
+		}
+		// ApplyCorrection holds details about calls to the ApplyCorrection method.
+		ApplyCorrection []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Correction is the correction argument value.
+			Correction *measurements.Correction
+			// Recalculations is the recalculations argument value.
+			Recalculations []measurements.Recalculation
+		}
+		// CountHistogram holds details about calls to the CountHistogram method.
+		CountHistogram []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Ranges is the ranges argument value.
+			Ranges []measurements.HistogramRange
+			// Start is the start argument value.
+			Start time.Time
+			// End is the end argument value.
+			End time.Time
+			// Resolution is the resolution argument value.
+			Resolution measurements.Resolution
+		}
+		// CreateDerivedDatastream holds details about calls to the CreateDerivedDatastream method.
+		CreateDerivedDatastream []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Derived is the derived argument value.
+			Derived *measurements.DerivedDatastream
+		}
+		// ExportMeasurements holds details about calls to the ExportMeasurements method.
+		ExportMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// Filter is the filter argument value.
+			Filter measurements.Filter
+			// Fn is the fn argument value.
+			Fn func(measurements.Measurement) error
+		}
 		// FindOrCreateDatastream holds details about calls to the FindOrCreateDatastream method.
 		FindOrCreateDatastream []struct {
 			// Ctx is the ctx argument value.
@@ -88,6 +251,42 @@ type StoreMock struct {
 			// Filter is the filter argument value.
 			Filter measurements.DatastreamFilter
 		}
+		// GetDerivedDatastream holds details about calls to the GetDerivedDatastream method.
+		GetDerivedDatastream []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID uuid.UUID
+			// TenantID is the tenantID argument value.
+			TenantID int64
+		}
+		// GetRollupRetention holds details about calls to the GetRollupRetention method.
+		GetRollupRetention []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// TenantID is the tenantID argument value.
+			TenantID int64
+		}
+		// ListCorrections holds details about calls to the ListCorrections method.
+		ListCorrections []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamID is the datastreamID argument value.
+			DatastreamID uuid.UUID
+			// R is the r argument value.
+			R pagination.Request
+		}
+		// ListDailyCounts holds details about calls to the ListDailyCounts method.
+		ListDailyCounts []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamID is the datastreamID argument value.
+			DatastreamID uuid.UUID
+			// Start is the start argument value.
+			Start time.Time
+			// End is the end argument value.
+			End time.Time
+		}
 		// ListDatastreams holds details about calls to the ListDatastreams method.
 		ListDatastreams []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -97,6 +296,79 @@ type StoreMock struct {
 			// Request is the request argument value.
 			Request pagination.Request
 		}
+		// ListDerivedDatastreams holds details about calls to the ListDerivedDatastreams method.
+		ListDerivedDatastreams []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// SourceIDs is the sourceIDs argument value.
+			SourceIDs []uuid.UUID
+		}
+		// ListGaps holds details about calls to the ListGaps method.
+		ListGaps []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamID is the datastreamID argument value.
+			DatastreamID uuid.UUID
+			// Start is the start argument value.
+			Start time.Time
+			// End is the end argument value.
+			End time.Time
+			// Threshold is the threshold argument value.
+			Threshold time.Duration
+			// Limit is the limit argument value.
+			Limit int
+		}
+		// ListLatestMeasurements holds details about calls to the ListLatestMeasurements method.
+		ListLatestMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DatastreamFilter is the datastreamFilter argument value.
+			DatastreamFilter measurements.DatastreamFilter
+			// Request is the request argument value.
+			Request pagination.Request
+		}
+		// ListRecentSamples holds details about calls to the ListRecentSamples method.
+		ListRecentSamples []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamID is the datastreamID argument value.
+			DatastreamID uuid.UUID
+			// Before is the before argument value.
+			Before time.Time
+			// Limit is the limit argument value.
+			Limit int
+		}
+		// ListReportingStats holds details about calls to the ListReportingStats method.
+		ListReportingStats []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// TenantID is the tenantID argument value.
+			TenantID int64
+			// DatastreamIDs is the datastreamIDs argument value.
+			DatastreamIDs []uuid.UUID
+			// Start is the start argument value.
+			Start time.Time
+			// End is the end argument value.
+			End time.Time
+		}
+		// ListSamplesAt holds details about calls to the ListSamplesAt method.
+		ListSamplesAt []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamIDs is the datastreamIDs argument value.
+			DatastreamIDs []uuid.UUID
+			// Timestamps is the timestamps argument value.
+			Timestamps []time.Time
+		}
+		// ListSensorGroupSensors holds details about calls to the ListSensorGroupSensors method.
+		ListSensorGroupSensors []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// TenantID is the tenantID argument value.
+			TenantID int64
+			// GroupIDs is the groupIDs argument value.
+			GroupIDs []int64
+		}
 		// Query holds details about calls to the Query method.
 		Query []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -106,12 +378,32 @@ type StoreMock struct {
 			// Request is the request argument value.
 			Request pagination.Request
 		}
-		// StoreMeasurement holds details about calls to the StoreMeasurement method.
-		StoreMeasurement []struct {
-			// ContextMoqParam is the contextMoqParam argument value.
-			ContextMoqParam context.Context
-			// Measurement is the measurement argument value.
-			Measurement measurements.Measurement
+		// SetDatastreamArchiveTime holds details about calls to the SetDatastreamArchiveTime method.
+		SetDatastreamArchiveTime []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamID is the datastreamID argument value.
+			DatastreamID uuid.UUID
+			// Days is the days argument value.
+			Days *int
+		}
+		// SetDatastreamQualityRules holds details about calls to the SetDatastreamQualityRules method.
+		SetDatastreamQualityRules []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamID is the datastreamID argument value.
+			DatastreamID uuid.UUID
+			// Rules is the rules argument value.
+			Rules measurements.QualityRules
+		}
+		// SetRollupRetention holds details about calls to the SetRollupRetention method.
+		SetRollupRetention []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// TenantID is the tenantID argument value.
+			TenantID int64
+			// Retention is the retention argument value.
+			Retention measurements.RollupRetention
 		}
 		// StoreMeasurements holds details about calls to the StoreMeasurements method.
 		StoreMeasurements []struct {
@@ -120,13 +412,249 @@ type StoreMock struct {
 			// MeasurementsMoqParam is the measurementsMoqParam argument value.
 			MeasurementsMoqParam []measurements.Measurement
 		}
+		// SummarizeValues holds details about calls to the SummarizeValues method.
+		SummarizeValues []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// DatastreamIDs is the datastreamIDs argument value.
+			DatastreamIDs []uuid.UUID
+			// Start is the start argument value.
+			Start time.Time
+			// End is the end argument value.
+			End time.Time
+			// Resolution is the resolution argument value.
+			Resolution measurements.Resolution
+		}
+	}
+	lockAggregateMeasurements     sync.RWMutex
+	lockApplyCorrection           sync.RWMutex
+	lockCountHistogram            sync.RWMutex
+	lockCreateDerivedDatastream   sync.RWMutex
+	lockExportMeasurements        sync.RWMutex
+	lockFindOrCreateDatastream    sync.RWMutex
+	lockGetDatastream             sync.RWMutex
+	lockGetDerivedDatastream      sync.RWMutex
+	lockGetRollupRetention        sync.RWMutex
+	lockListCorrections           sync.RWMutex
+	lockListDailyCounts           sync.RWMutex
+	lockListDatastreams           sync.RWMutex
+	lockListDerivedDatastreams    sync.RWMutex
+	lockListGaps                  sync.RWMutex
+	lockListLatestMeasurements    sync.RWMutex
+	lockListRecentSamples         sync.RWMutex
+	lockListReportingStats        sync.RWMutex
+	lockListSamplesAt             sync.RWMutex
+	lockListSensorGroupSensors    sync.RWMutex
+	lockQuery                     sync.RWMutex
+	lockSetDatastreamArchiveTime  sync.RWMutex
+	lockSetDatastreamQualityRules sync.RWMutex
+	lockSetRollupRetention        sync.RWMutex
+	lockStoreMeasurements         sync.RWMutex
+	lockSummarizeValues           sync.RWMutex
+}
+
+// AggregateMeasurements calls AggregateMeasurementsFunc.
+func (mock *StoreMock) AggregateMeasurements(contextMoqParam context.Context, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+	if mock.AggregateMeasurementsFunc == nil {
+		panic("StoreMock.AggregateMeasurementsFunc: method is nil but Store.AggregateMeasurements was just called")
 	}
-	lockFindOrCreateDatastream sync.RWMutex
-	lockGetDatastream          sync.RWMutex
-	lockListDatastreams        sync.RWMutex
-	lockQuery                  sync.RWMutex
-	lockStoreMeasurement       sync.RWMutex
-	lockStoreMeasurements      sync.RWMutex
+	callInfo := struct {
+		ContextMoqParam    context.Context
+		Filter             measurements.Filter
+		AggregationOptions measurements.AggregationOptions
+	}{
+		ContextMoqParam:    contextMoqParam,
+		Filter:             filter,
+		AggregationOptions: aggregationOptions,
+	}
+	mock.lockAggregateMeasurements.Lock()
+	mock.calls.AggregateMeasurements = append(mock.calls.AggregateMeasurements, callInfo)
+	mock.lockAggregateMeasurements.Unlock()
+	return mock.AggregateMeasurementsFunc(contextMoqParam, filter, aggregationOptions)
+}
+
+// AggregateMeasurementsCalls gets all the calls that were made to AggregateMeasurements.
+// Check the length with:
+//
+//	len(mockedStore.AggregateMeasurementsCalls())
+func (mock *StoreMock) AggregateMeasurementsCalls() []struct {
+	ContextMoqParam    context.Context
+	Filter             measurements.Filter
+	AggregationOptions measurements.AggregationOptions
+} {
+	var calls []struct {
+		ContextMoqParam    context.Context
+		Filter             measurements.Filter
+		AggregationOptions measurements.AggregationOptions
+	}
+	mock.lockAggregateMeasurements.RLock()
+	calls = mock.calls.AggregateMeasurements
+	mock.lockAggregateMeasurements.RUnlock()
+	return calls
+}
+
+// ApplyCorrection calls ApplyCorrectionFunc.
+func (mock *StoreMock) ApplyCorrection(ctx context.Context, correction *measurements.Correction, recalculations []measurements.Recalculation) error {
+	if mock.ApplyCorrectionFunc == nil {
+		panic("StoreMock.ApplyCorrectionFunc: method is nil but Store.ApplyCorrection was just called")
+	}
+	callInfo := struct {
+		Ctx            context.Context
+		Correction     *measurements.Correction
+		Recalculations []measurements.Recalculation
+	}{
+		Ctx:            ctx,
+		Correction:     correction,
+		Recalculations: recalculations,
+	}
+	mock.lockApplyCorrection.Lock()
+	mock.calls.ApplyCorrection = append(mock.calls.ApplyCorrection, callInfo)
+	mock.lockApplyCorrection.Unlock()
+	return mock.ApplyCorrectionFunc(ctx, correction, recalculations)
+}
+
+// ApplyCorrectionCalls gets all the calls that were made to ApplyCorrection.
+// Check the length with:
+//
+//	len(mockedStore.ApplyCorrectionCalls())
+func (mock *StoreMock) ApplyCorrectionCalls() []struct {
+	Ctx            context.Context
+	Correction     *measurements.Correction
+	Recalculations []measurements.Recalculation
+} {
+	var calls []struct {
+		Ctx            context.Context
+		Correction     *measurements.Correction
+		Recalculations []measurements.Recalculation
+	}
+	mock.lockApplyCorrection.RLock()
+	calls = mock.calls.ApplyCorrection
+	mock.lockApplyCorrection.RUnlock()
+	return calls
+}
+
+// CountHistogram calls CountHistogramFunc.
+func (mock *StoreMock) CountHistogram(ctx context.Context, ranges []measurements.HistogramRange, start time.Time, end time.Time, resolution measurements.Resolution) ([]measurements.HistogramCount, error) {
+	if mock.CountHistogramFunc == nil {
+		panic("StoreMock.CountHistogramFunc: method is nil but Store.CountHistogram was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		Ranges     []measurements.HistogramRange
+		Start      time.Time
+		End        time.Time
+		Resolution measurements.Resolution
+	}{
+		Ctx:        ctx,
+		Ranges:     ranges,
+		Start:      start,
+		End:        end,
+		Resolution: resolution,
+	}
+	mock.lockCountHistogram.Lock()
+	mock.calls.CountHistogram = append(mock.calls.CountHistogram, callInfo)
+	mock.lockCountHistogram.Unlock()
+	return mock.CountHistogramFunc(ctx, ranges, start, end, resolution)
+}
+
+// CountHistogramCalls gets all the calls that were made to CountHistogram.
+// Check the length with:
+//
+//	len(mockedStore.CountHistogramCalls())
+func (mock *StoreMock) CountHistogramCalls() []struct {
+	Ctx        context.Context
+	Ranges     []measurements.HistogramRange
+	Start      time.Time
+	End        time.Time
+	Resolution measurements.Resolution
+} {
+	var calls []struct {
+		Ctx        context.Context
+		Ranges     []measurements.HistogramRange
+		Start      time.Time
+		End        time.Time
+		Resolution measurements.Resolution
+	}
+	mock.lockCountHistogram.RLock()
+	calls = mock.calls.CountHistogram
+	mock.lockCountHistogram.RUnlock()
+	return calls
+}
+
+// CreateDerivedDatastream calls CreateDerivedDatastreamFunc.
+func (mock *StoreMock) CreateDerivedDatastream(ctx context.Context, derived *measurements.DerivedDatastream) error {
+	if mock.CreateDerivedDatastreamFunc == nil {
+		panic("StoreMock.CreateDerivedDatastreamFunc: method is nil but Store.CreateDerivedDatastream was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		Derived *measurements.DerivedDatastream
+	}{
+		Ctx:     ctx,
+		Derived: derived,
+	}
+	mock.lockCreateDerivedDatastream.Lock()
+	mock.calls.CreateDerivedDatastream = append(mock.calls.CreateDerivedDatastream, callInfo)
+	mock.lockCreateDerivedDatastream.Unlock()
+	return mock.CreateDerivedDatastreamFunc(ctx, derived)
+}
+
+// CreateDerivedDatastreamCalls gets all the calls that were made to CreateDerivedDatastream.
+// Check the length with:
+//
+//	len(mockedStore.CreateDerivedDatastreamCalls())
+func (mock *StoreMock) CreateDerivedDatastreamCalls() []struct {
+	Ctx     context.Context
+	Derived *measurements.DerivedDatastream
+} {
+	var calls []struct {
+		Ctx     context.Context
+		Derived *measurements.DerivedDatastream
+	}
+	mock.lockCreateDerivedDatastream.RLock()
+	calls = mock.calls.CreateDerivedDatastream
+	mock.lockCreateDerivedDatastream.RUnlock()
+	return calls
+}
+
+// ExportMeasurements calls ExportMeasurementsFunc.
+func (mock *StoreMock) ExportMeasurements(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+	if mock.ExportMeasurementsFunc == nil {
+		panic("StoreMock.ExportMeasurementsFunc: method is nil but Store.ExportMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		Filter          measurements.Filter
+		Fn              func(measurements.Measurement) error
+	}{
+		ContextMoqParam: contextMoqParam,
+		Filter:          filter,
+		Fn:              fn,
+	}
+	mock.lockExportMeasurements.Lock()
+	mock.calls.ExportMeasurements = append(mock.calls.ExportMeasurements, callInfo)
+	mock.lockExportMeasurements.Unlock()
+	return mock.ExportMeasurementsFunc(contextMoqParam, filter, fn)
+}
+
+// ExportMeasurementsCalls gets all the calls that were made to ExportMeasurements.
+// Check the length with:
+//
+//	len(mockedStore.ExportMeasurementsCalls())
+func (mock *StoreMock) ExportMeasurementsCalls() []struct {
+	ContextMoqParam context.Context
+	Filter          measurements.Filter
+	Fn              func(measurements.Measurement) error
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		Filter          measurements.Filter
+		Fn              func(measurements.Measurement) error
+	}
+	mock.lockExportMeasurements.RLock()
+	calls = mock.calls.ExportMeasurements
+	mock.lockExportMeasurements.RUnlock()
+	return calls
 }
 
 // FindOrCreateDatastream calls FindOrCreateDatastreamFunc.
@@ -217,6 +745,166 @@ func (mock *StoreMock) GetDatastreamCalls() []struct {
 	return calls
 }
 
+// GetDerivedDatastream calls GetDerivedDatastreamFunc.
+func (mock *StoreMock) GetDerivedDatastream(ctx context.Context, id uuid.UUID, tenantID int64) (*measurements.DerivedDatastream, error) {
+	if mock.GetDerivedDatastreamFunc == nil {
+		panic("StoreMock.GetDerivedDatastreamFunc: method is nil but Store.GetDerivedDatastream was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		ID       uuid.UUID
+		TenantID int64
+	}{
+		Ctx:      ctx,
+		ID:       id,
+		TenantID: tenantID,
+	}
+	mock.lockGetDerivedDatastream.Lock()
+	mock.calls.GetDerivedDatastream = append(mock.calls.GetDerivedDatastream, callInfo)
+	mock.lockGetDerivedDatastream.Unlock()
+	return mock.GetDerivedDatastreamFunc(ctx, id, tenantID)
+}
+
+// GetDerivedDatastreamCalls gets all the calls that were made to GetDerivedDatastream.
+// Check the length with:
+//
+//	len(mockedStore.GetDerivedDatastreamCalls())
+func (mock *StoreMock) GetDerivedDatastreamCalls() []struct {
+	Ctx      context.Context
+	ID       uuid.UUID
+	TenantID int64
+} {
+	var calls []struct {
+		Ctx      context.Context
+		ID       uuid.UUID
+		TenantID int64
+	}
+	mock.lockGetDerivedDatastream.RLock()
+	calls = mock.calls.GetDerivedDatastream
+	mock.lockGetDerivedDatastream.RUnlock()
+	return calls
+}
+
+// GetRollupRetention calls GetRollupRetentionFunc.
+func (mock *StoreMock) GetRollupRetention(ctx context.Context, tenantID int64) (*measurements.RollupRetention, error) {
+	if mock.GetRollupRetentionFunc == nil {
+		panic("StoreMock.GetRollupRetentionFunc: method is nil but Store.GetRollupRetention was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		TenantID int64
+	}{
+		Ctx:      ctx,
+		TenantID: tenantID,
+	}
+	mock.lockGetRollupRetention.Lock()
+	mock.calls.GetRollupRetention = append(mock.calls.GetRollupRetention, callInfo)
+	mock.lockGetRollupRetention.Unlock()
+	return mock.GetRollupRetentionFunc(ctx, tenantID)
+}
+
+// GetRollupRetentionCalls gets all the calls that were made to GetRollupRetention.
+// Check the length with:
+//
+//	len(mockedStore.GetRollupRetentionCalls())
+func (mock *StoreMock) GetRollupRetentionCalls() []struct {
+	Ctx      context.Context
+	TenantID int64
+} {
+	var calls []struct {
+		Ctx      context.Context
+		TenantID int64
+	}
+	mock.lockGetRollupRetention.RLock()
+	calls = mock.calls.GetRollupRetention
+	mock.lockGetRollupRetention.RUnlock()
+	return calls
+}
+
+// ListCorrections calls ListCorrectionsFunc.
+func (mock *StoreMock) ListCorrections(ctx context.Context, datastreamID uuid.UUID, r pagination.Request) (*pagination.Page[measurements.Correction], error) {
+	if mock.ListCorrectionsFunc == nil {
+		panic("StoreMock.ListCorrectionsFunc: method is nil but Store.ListCorrections was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		R            pagination.Request
+	}{
+		Ctx:          ctx,
+		DatastreamID: datastreamID,
+		R:            r,
+	}
+	mock.lockListCorrections.Lock()
+	mock.calls.ListCorrections = append(mock.calls.ListCorrections, callInfo)
+	mock.lockListCorrections.Unlock()
+	return mock.ListCorrectionsFunc(ctx, datastreamID, r)
+}
+
+// ListCorrectionsCalls gets all the calls that were made to ListCorrections.
+// Check the length with:
+//
+//	len(mockedStore.ListCorrectionsCalls())
+func (mock *StoreMock) ListCorrectionsCalls() []struct {
+	Ctx          context.Context
+	DatastreamID uuid.UUID
+	R            pagination.Request
+} {
+	var calls []struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		R            pagination.Request
+	}
+	mock.lockListCorrections.RLock()
+	calls = mock.calls.ListCorrections
+	mock.lockListCorrections.RUnlock()
+	return calls
+}
+
+// ListDailyCounts calls ListDailyCountsFunc.
+func (mock *StoreMock) ListDailyCounts(ctx context.Context, datastreamID uuid.UUID, start time.Time, end time.Time) ([]measurements.DailyCount, error) {
+	if mock.ListDailyCountsFunc == nil {
+		panic("StoreMock.ListDailyCountsFunc: method is nil but Store.ListDailyCounts was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Start        time.Time
+		End          time.Time
+	}{
+		Ctx:          ctx,
+		DatastreamID: datastreamID,
+		Start:        start,
+		End:          end,
+	}
+	mock.lockListDailyCounts.Lock()
+	mock.calls.ListDailyCounts = append(mock.calls.ListDailyCounts, callInfo)
+	mock.lockListDailyCounts.Unlock()
+	return mock.ListDailyCountsFunc(ctx, datastreamID, start, end)
+}
+
+// ListDailyCountsCalls gets all the calls that were made to ListDailyCounts.
+// Check the length with:
+//
+//	len(mockedStore.ListDailyCountsCalls())
+func (mock *StoreMock) ListDailyCountsCalls() []struct {
+	Ctx          context.Context
+	DatastreamID uuid.UUID
+	Start        time.Time
+	End          time.Time
+} {
+	var calls []struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Start        time.Time
+		End          time.Time
+	}
+	mock.lockListDailyCounts.RLock()
+	calls = mock.calls.ListDailyCounts
+	mock.lockListDailyCounts.RUnlock()
+	return calls
+}
+
 // ListDatastreams calls ListDatastreamsFunc.
 func (mock *StoreMock) ListDatastreams(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
 	if mock.ListDatastreamsFunc == nil {
@@ -257,6 +945,306 @@ func (mock *StoreMock) ListDatastreamsCalls() []struct {
 	return calls
 }
 
+// ListDerivedDatastreams calls ListDerivedDatastreamsFunc.
+func (mock *StoreMock) ListDerivedDatastreams(ctx context.Context, sourceIDs []uuid.UUID) ([]measurements.DerivedDatastream, error) {
+	if mock.ListDerivedDatastreamsFunc == nil {
+		panic("StoreMock.ListDerivedDatastreamsFunc: method is nil but Store.ListDerivedDatastreams was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		SourceIDs []uuid.UUID
+	}{
+		Ctx:       ctx,
+		SourceIDs: sourceIDs,
+	}
+	mock.lockListDerivedDatastreams.Lock()
+	mock.calls.ListDerivedDatastreams = append(mock.calls.ListDerivedDatastreams, callInfo)
+	mock.lockListDerivedDatastreams.Unlock()
+	return mock.ListDerivedDatastreamsFunc(ctx, sourceIDs)
+}
+
+// ListDerivedDatastreamsCalls gets all the calls that were made to ListDerivedDatastreams.
+// Check the length with:
+//
+//	len(mockedStore.ListDerivedDatastreamsCalls())
+func (mock *StoreMock) ListDerivedDatastreamsCalls() []struct {
+	Ctx       context.Context
+	SourceIDs []uuid.UUID
+} {
+	var calls []struct {
+		Ctx       context.Context
+		SourceIDs []uuid.UUID
+	}
+	mock.lockListDerivedDatastreams.RLock()
+	calls = mock.calls.ListDerivedDatastreams
+	mock.lockListDerivedDatastreams.RUnlock()
+	return calls
+}
+
+// ListGaps calls ListGapsFunc.
+func (mock *StoreMock) ListGaps(ctx context.Context, datastreamID uuid.UUID, start time.Time, end time.Time, threshold time.Duration, limit int) ([]measurements.Gap, error) {
+	if mock.ListGapsFunc == nil {
+		panic("StoreMock.ListGapsFunc: method is nil but Store.ListGaps was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Start        time.Time
+		End          time.Time
+		Threshold    time.Duration
+		Limit        int
+	}{
+		Ctx:          ctx,
+		DatastreamID: datastreamID,
+		Start:        start,
+		End:          end,
+		Threshold:    threshold,
+		Limit:        limit,
+	}
+	mock.lockListGaps.Lock()
+	mock.calls.ListGaps = append(mock.calls.ListGaps, callInfo)
+	mock.lockListGaps.Unlock()
+	return mock.ListGapsFunc(ctx, datastreamID, start, end, threshold, limit)
+}
+
+// ListGapsCalls gets all the calls that were made to ListGaps.
+// Check the length with:
+//
+//	len(mockedStore.ListGapsCalls())
+func (mock *StoreMock) ListGapsCalls() []struct {
+	Ctx          context.Context
+	DatastreamID uuid.UUID
+	Start        time.Time
+	End          time.Time
+	Threshold    time.Duration
+	Limit        int
+} {
+	var calls []struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Start        time.Time
+		End          time.Time
+		Threshold    time.Duration
+		Limit        int
+	}
+	mock.lockListGaps.RLock()
+	calls = mock.calls.ListGaps
+	mock.lockListGaps.RUnlock()
+	return calls
+}
+
+// ListLatestMeasurements calls ListLatestMeasurementsFunc.
+func (mock *StoreMock) ListLatestMeasurements(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+	if mock.ListLatestMeasurementsFunc == nil {
+		panic("StoreMock.ListLatestMeasurementsFunc: method is nil but Store.ListLatestMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		Request          pagination.Request
+	}{
+		ContextMoqParam:  contextMoqParam,
+		DatastreamFilter: datastreamFilter,
+		Request:          request,
+	}
+	mock.lockListLatestMeasurements.Lock()
+	mock.calls.ListLatestMeasurements = append(mock.calls.ListLatestMeasurements, callInfo)
+	mock.lockListLatestMeasurements.Unlock()
+	return mock.ListLatestMeasurementsFunc(contextMoqParam, datastreamFilter, request)
+}
+
+// ListLatestMeasurementsCalls gets all the calls that were made to ListLatestMeasurements.
+// Check the length with:
+//
+//	len(mockedStore.ListLatestMeasurementsCalls())
+func (mock *StoreMock) ListLatestMeasurementsCalls() []struct {
+	ContextMoqParam  context.Context
+	DatastreamFilter measurements.DatastreamFilter
+	Request          pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		Request          pagination.Request
+	}
+	mock.lockListLatestMeasurements.RLock()
+	calls = mock.calls.ListLatestMeasurements
+	mock.lockListLatestMeasurements.RUnlock()
+	return calls
+}
+
+// ListRecentSamples calls ListRecentSamplesFunc.
+func (mock *StoreMock) ListRecentSamples(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+	if mock.ListRecentSamplesFunc == nil {
+		panic("StoreMock.ListRecentSamplesFunc: method is nil but Store.ListRecentSamples was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Before       time.Time
+		Limit        int
+	}{
+		Ctx:          ctx,
+		DatastreamID: datastreamID,
+		Before:       before,
+		Limit:        limit,
+	}
+	mock.lockListRecentSamples.Lock()
+	mock.calls.ListRecentSamples = append(mock.calls.ListRecentSamples, callInfo)
+	mock.lockListRecentSamples.Unlock()
+	return mock.ListRecentSamplesFunc(ctx, datastreamID, before, limit)
+}
+
+// ListRecentSamplesCalls gets all the calls that were made to ListRecentSamples.
+// Check the length with:
+//
+//	len(mockedStore.ListRecentSamplesCalls())
+func (mock *StoreMock) ListRecentSamplesCalls() []struct {
+	Ctx          context.Context
+	DatastreamID uuid.UUID
+	Before       time.Time
+	Limit        int
+} {
+	var calls []struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Before       time.Time
+		Limit        int
+	}
+	mock.lockListRecentSamples.RLock()
+	calls = mock.calls.ListRecentSamples
+	mock.lockListRecentSamples.RUnlock()
+	return calls
+}
+
+// ListReportingStats calls ListReportingStatsFunc.
+func (mock *StoreMock) ListReportingStats(ctx context.Context, tenantID int64, datastreamIDs []uuid.UUID, start time.Time, end time.Time) ([]measurements.ReportingStats, error) {
+	if mock.ListReportingStatsFunc == nil {
+		panic("StoreMock.ListReportingStatsFunc: method is nil but Store.ListReportingStats was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		TenantID      int64
+		DatastreamIDs []uuid.UUID
+		Start         time.Time
+		End           time.Time
+	}{
+		Ctx:           ctx,
+		TenantID:      tenantID,
+		DatastreamIDs: datastreamIDs,
+		Start:         start,
+		End:           end,
+	}
+	mock.lockListReportingStats.Lock()
+	mock.calls.ListReportingStats = append(mock.calls.ListReportingStats, callInfo)
+	mock.lockListReportingStats.Unlock()
+	return mock.ListReportingStatsFunc(ctx, tenantID, datastreamIDs, start, end)
+}
+
+// ListReportingStatsCalls gets all the calls that were made to ListReportingStats.
+// Check the length with:
+//
+//	len(mockedStore.ListReportingStatsCalls())
+func (mock *StoreMock) ListReportingStatsCalls() []struct {
+	Ctx           context.Context
+	TenantID      int64
+	DatastreamIDs []uuid.UUID
+	Start         time.Time
+	End           time.Time
+} {
+	var calls []struct {
+		Ctx           context.Context
+		TenantID      int64
+		DatastreamIDs []uuid.UUID
+		Start         time.Time
+		End           time.Time
+	}
+	mock.lockListReportingStats.RLock()
+	calls = mock.calls.ListReportingStats
+	mock.lockListReportingStats.RUnlock()
+	return calls
+}
+
+// ListSamplesAt calls ListSamplesAtFunc.
+func (mock *StoreMock) ListSamplesAt(ctx context.Context, datastreamIDs []uuid.UUID, timestamps []time.Time) ([]*measurements.Sample, error) {
+	if mock.ListSamplesAtFunc == nil {
+		panic("StoreMock.ListSamplesAtFunc: method is nil but Store.ListSamplesAt was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		DatastreamIDs []uuid.UUID
+		Timestamps    []time.Time
+	}{
+		Ctx:           ctx,
+		DatastreamIDs: datastreamIDs,
+		Timestamps:    timestamps,
+	}
+	mock.lockListSamplesAt.Lock()
+	mock.calls.ListSamplesAt = append(mock.calls.ListSamplesAt, callInfo)
+	mock.lockListSamplesAt.Unlock()
+	return mock.ListSamplesAtFunc(ctx, datastreamIDs, timestamps)
+}
+
+// ListSamplesAtCalls gets all the calls that were made to ListSamplesAt.
+// Check the length with:
+//
+//	len(mockedStore.ListSamplesAtCalls())
+func (mock *StoreMock) ListSamplesAtCalls() []struct {
+	Ctx           context.Context
+	DatastreamIDs []uuid.UUID
+	Timestamps    []time.Time
+} {
+	var calls []struct {
+		Ctx           context.Context
+		DatastreamIDs []uuid.UUID
+		Timestamps    []time.Time
+	}
+	mock.lockListSamplesAt.RLock()
+	calls = mock.calls.ListSamplesAt
+	mock.lockListSamplesAt.RUnlock()
+	return calls
+}
+
+// ListSensorGroupSensors calls ListSensorGroupSensorsFunc.
+func (mock *StoreMock) ListSensorGroupSensors(ctx context.Context, tenantID int64, groupIDs []int64) ([]int64, error) {
+	if mock.ListSensorGroupSensorsFunc == nil {
+		panic("StoreMock.ListSensorGroupSensorsFunc: method is nil but Store.ListSensorGroupSensors was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		TenantID int64
+		GroupIDs []int64
+	}{
+		Ctx:      ctx,
+		TenantID: tenantID,
+		GroupIDs: groupIDs,
+	}
+	mock.lockListSensorGroupSensors.Lock()
+	mock.calls.ListSensorGroupSensors = append(mock.calls.ListSensorGroupSensors, callInfo)
+	mock.lockListSensorGroupSensors.Unlock()
+	return mock.ListSensorGroupSensorsFunc(ctx, tenantID, groupIDs)
+}
+
+// ListSensorGroupSensorsCalls gets all the calls that were made to ListSensorGroupSensors.
+// Check the length with:
+//
+//	len(mockedStore.ListSensorGroupSensorsCalls())
+func (mock *StoreMock) ListSensorGroupSensorsCalls() []struct {
+	Ctx      context.Context
+	TenantID int64
+	GroupIDs []int64
+} {
+	var calls []struct {
+		Ctx      context.Context
+		TenantID int64
+		GroupIDs []int64
+	}
+	mock.lockListSensorGroupSensors.RLock()
+	calls = mock.calls.ListSensorGroupSensors
+	mock.lockListSensorGroupSensors.RUnlock()
+	return calls
+}
+
 // Query calls QueryFunc.
 func (mock *StoreMock) Query(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
 	if mock.QueryFunc == nil {
@@ -297,39 +1285,123 @@ func (mock *StoreMock) QueryCalls() []struct {
 	return calls
 }
 
-// StoreMeasurement calls StoreMeasurementFunc.
-func (mock *StoreMock) StoreMeasurement(contextMoqParam context.Context, measurement measurements.Measurement) error {
-	if mock.StoreMeasurementFunc == nil {
-		panic("StoreMock.StoreMeasurementFunc: method is nil but Store.StoreMeasurement was just called")
+// SetDatastreamArchiveTime calls SetDatastreamArchiveTimeFunc.
+func (mock *StoreMock) SetDatastreamArchiveTime(ctx context.Context, datastreamID uuid.UUID, days *int) error {
+	if mock.SetDatastreamArchiveTimeFunc == nil {
+		panic("StoreMock.SetDatastreamArchiveTimeFunc: method is nil but Store.SetDatastreamArchiveTime was just called")
 	}
 	callInfo := struct {
-		ContextMoqParam context.Context
-		Measurement     measurements.Measurement
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Days         *int
 	}{
-		ContextMoqParam: contextMoqParam,
-		Measurement:     measurement,
+		Ctx:          ctx,
+		DatastreamID: datastreamID,
+		Days:         days,
 	}
-	mock.lockStoreMeasurement.Lock()
-	mock.calls.StoreMeasurement = append(mock.calls.StoreMeasurement, callInfo)
-	mock.lockStoreMeasurement.Unlock()
-	return mock.StoreMeasurementFunc(contextMoqParam, measurement)
+	mock.lockSetDatastreamArchiveTime.Lock()
+	mock.calls.SetDatastreamArchiveTime = append(mock.calls.SetDatastreamArchiveTime, callInfo)
+	mock.lockSetDatastreamArchiveTime.Unlock()
+	return mock.SetDatastreamArchiveTimeFunc(ctx, datastreamID, days)
 }
 
-// StoreMeasurementCalls gets all the calls that were made to StoreMeasurement.
+// SetDatastreamArchiveTimeCalls gets all the calls that were made to SetDatastreamArchiveTime.
 // Check the length with:
 //
-//	len(mockedStore.StoreMeasurementCalls())
-func (mock *StoreMock) StoreMeasurementCalls() []struct {
-	ContextMoqParam context.Context
-	Measurement     measurements.Measurement
+//	len(mockedStore.SetDatastreamArchiveTimeCalls())
+func (mock *StoreMock) SetDatastreamArchiveTimeCalls() []struct {
+	Ctx          context.Context
+	DatastreamID uuid.UUID
+	Days         *int
 } {
 	var calls []struct {
-		ContextMoqParam context.Context
-		Measurement     measurements.Measurement
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Days         *int
+	}
+	mock.lockSetDatastreamArchiveTime.RLock()
+	calls = mock.calls.SetDatastreamArchiveTime
+	mock.lockSetDatastreamArchiveTime.RUnlock()
+	return calls
+}
+
+// SetDatastreamQualityRules calls SetDatastreamQualityRulesFunc.
+func (mock *StoreMock) SetDatastreamQualityRules(ctx context.Context, datastreamID uuid.UUID, rules measurements.QualityRules) error {
+	if mock.SetDatastreamQualityRulesFunc == nil {
+		panic("StoreMock.SetDatastreamQualityRulesFunc: method is nil but Store.SetDatastreamQualityRules was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Rules        measurements.QualityRules
+	}{
+		Ctx:          ctx,
+		DatastreamID: datastreamID,
+		Rules:        rules,
 	}
-	mock.lockStoreMeasurement.RLock()
-	calls = mock.calls.StoreMeasurement
-	mock.lockStoreMeasurement.RUnlock()
+	mock.lockSetDatastreamQualityRules.Lock()
+	mock.calls.SetDatastreamQualityRules = append(mock.calls.SetDatastreamQualityRules, callInfo)
+	mock.lockSetDatastreamQualityRules.Unlock()
+	return mock.SetDatastreamQualityRulesFunc(ctx, datastreamID, rules)
+}
+
+// SetDatastreamQualityRulesCalls gets all the calls that were made to SetDatastreamQualityRules.
+// Check the length with:
+//
+//	len(mockedStore.SetDatastreamQualityRulesCalls())
+func (mock *StoreMock) SetDatastreamQualityRulesCalls() []struct {
+	Ctx          context.Context
+	DatastreamID uuid.UUID
+	Rules        measurements.QualityRules
+} {
+	var calls []struct {
+		Ctx          context.Context
+		DatastreamID uuid.UUID
+		Rules        measurements.QualityRules
+	}
+	mock.lockSetDatastreamQualityRules.RLock()
+	calls = mock.calls.SetDatastreamQualityRules
+	mock.lockSetDatastreamQualityRules.RUnlock()
+	return calls
+}
+
+// SetRollupRetention calls SetRollupRetentionFunc.
+func (mock *StoreMock) SetRollupRetention(ctx context.Context, tenantID int64, retention measurements.RollupRetention) error {
+	if mock.SetRollupRetentionFunc == nil {
+		panic("StoreMock.SetRollupRetentionFunc: method is nil but Store.SetRollupRetention was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		TenantID  int64
+		Retention measurements.RollupRetention
+	}{
+		Ctx:       ctx,
+		TenantID:  tenantID,
+		Retention: retention,
+	}
+	mock.lockSetRollupRetention.Lock()
+	mock.calls.SetRollupRetention = append(mock.calls.SetRollupRetention, callInfo)
+	mock.lockSetRollupRetention.Unlock()
+	return mock.SetRollupRetentionFunc(ctx, tenantID, retention)
+}
+
+// SetRollupRetentionCalls gets all the calls that were made to SetRollupRetention.
+// Check the length with:
+//
+//	len(mockedStore.SetRollupRetentionCalls())
+func (mock *StoreMock) SetRollupRetentionCalls() []struct {
+	Ctx       context.Context
+	TenantID  int64
+	Retention measurements.RollupRetention
+} {
+	var calls []struct {
+		Ctx       context.Context
+		TenantID  int64
+		Retention measurements.RollupRetention
+	}
+	mock.lockSetRollupRetention.RLock()
+	calls = mock.calls.SetRollupRetention
+	mock.lockSetRollupRetention.RUnlock()
 	return calls
 }
 
@@ -368,3 +1440,201 @@ func (mock *StoreMock) StoreMeasurementsCalls() []struct {
 	mock.lockStoreMeasurements.RUnlock()
 	return calls
 }
+
+// SummarizeValues calls SummarizeValuesFunc.
+func (mock *StoreMock) SummarizeValues(ctx context.Context, datastreamIDs []uuid.UUID, start time.Time, end time.Time, resolution measurements.Resolution) ([]measurements.ValueSummary, error) {
+	if mock.SummarizeValuesFunc == nil {
+		panic("StoreMock.SummarizeValuesFunc: method is nil but Store.SummarizeValues was just called")
+	}
+	callInfo := struct {
+		Ctx           context.Context
+		DatastreamIDs []uuid.UUID
+		Start         time.Time
+		End           time.Time
+		Resolution    measurements.Resolution
+	}{
+		Ctx:           ctx,
+		DatastreamIDs: datastreamIDs,
+		Start:         start,
+		End:           end,
+		Resolution:    resolution,
+	}
+	mock.lockSummarizeValues.Lock()
+	mock.calls.SummarizeValues = append(mock.calls.SummarizeValues, callInfo)
+	mock.lockSummarizeValues.Unlock()
+	return mock.SummarizeValuesFunc(ctx, datastreamIDs, start, end, resolution)
+}
+
+// SummarizeValuesCalls gets all the calls that were made to SummarizeValues.
+// Check the length with:
+//
+//	len(mockedStore.SummarizeValuesCalls())
+func (mock *StoreMock) SummarizeValuesCalls() []struct {
+	Ctx           context.Context
+	DatastreamIDs []uuid.UUID
+	Start         time.Time
+	End           time.Time
+	Resolution    measurements.Resolution
+} {
+	var calls []struct {
+		Ctx           context.Context
+		DatastreamIDs []uuid.UUID
+		Start         time.Time
+		End           time.Time
+		Resolution    measurements.Resolution
+	}
+	mock.lockSummarizeValues.RLock()
+	calls = mock.calls.SummarizeValues
+	mock.lockSummarizeValues.RUnlock()
+	return calls
+}
+
+// Ensure, that DeviceStoreMock does implement measurements.DeviceStore.
+// If this is not the case, regenerate this file with moq.
+var _ measurements.DeviceStore = &DeviceStoreMock{}
+
+// DeviceStoreMock is a mock implementation of measurements.DeviceStore.
+//
+//	func TestSomethingThatUsesDeviceStore(t *testing.T) {
+//
+//		// make and configure a mocked measurements.DeviceStore
+//		mockedDeviceStore := &DeviceStoreMock{
+//			ListFunc: func(contextMoqParam context.Context, deviceFilter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+//				panic("mock out the List method")
+//			},
+//		}
+//
+//		// use mockedDeviceStore in code that requires measurements.DeviceStore
+//		// and then make assertions.
+//
+//	}
+type DeviceStoreMock struct {
+	// ListFunc mocks the List method.
+	ListFunc func(contextMoqParam context.Context, deviceFilter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// List holds details about calls to the List method.
+		List []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeviceFilter is the deviceFilter argument value.
+			DeviceFilter devices.DeviceFilter
+			// Request is the request argument value.
+			Request pagination.Request
+		}
+	}
+	lockList sync.RWMutex
+}
+
+// List calls ListFunc.
+func (mock *DeviceStoreMock) List(contextMoqParam context.Context, deviceFilter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+	if mock.ListFunc == nil {
+		panic("DeviceStoreMock.ListFunc: method is nil but DeviceStore.List was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		DeviceFilter    devices.DeviceFilter
+		Request         pagination.Request
+	}{
+		ContextMoqParam: contextMoqParam,
+		DeviceFilter:    deviceFilter,
+		Request:         request,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(contextMoqParam, deviceFilter, request)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedDeviceStore.ListCalls())
+func (mock *DeviceStoreMock) ListCalls() []struct {
+	ContextMoqParam context.Context
+	DeviceFilter    devices.DeviceFilter
+	Request         pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		DeviceFilter    devices.DeviceFilter
+		Request         pagination.Request
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
+
+// Ensure, that TenantArchiveTimeProviderMock does implement measurements.TenantArchiveTimeProvider.
+// If this is not the case, regenerate this file with moq.
+var _ measurements.TenantArchiveTimeProvider = &TenantArchiveTimeProviderMock{}
+
+// TenantArchiveTimeProviderMock is a mock implementation of measurements.TenantArchiveTimeProvider.
+//
+//	func TestSomethingThatUsesTenantArchiveTimeProvider(t *testing.T) {
+//
+//		// make and configure a mocked measurements.TenantArchiveTimeProvider
+//		mockedTenantArchiveTimeProvider := &TenantArchiveTimeProviderMock{
+//			GetTenantArchiveTimeFunc: func(ctx context.Context, tenantID int64) (*int, error) {
+//				panic("mock out the GetTenantArchiveTime method")
+//			},
+//		}
+//
+//		// use mockedTenantArchiveTimeProvider in code that requires measurements.TenantArchiveTimeProvider
+//		// and then make assertions.
+//
+//	}
+type TenantArchiveTimeProviderMock struct {
+	// GetTenantArchiveTimeFunc mocks the GetTenantArchiveTime method.
+	GetTenantArchiveTimeFunc func(ctx context.Context, tenantID int64) (*int, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// GetTenantArchiveTime holds details about calls to the GetTenantArchiveTime method.
+		GetTenantArchiveTime []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// TenantID is the tenantID argument value.
+			TenantID int64
+		}
+	}
+	lockGetTenantArchiveTime sync.RWMutex
+}
+
+// GetTenantArchiveTime calls GetTenantArchiveTimeFunc.
+func (mock *TenantArchiveTimeProviderMock) GetTenantArchiveTime(ctx context.Context, tenantID int64) (*int, error) {
+	if mock.GetTenantArchiveTimeFunc == nil {
+		panic("TenantArchiveTimeProviderMock.GetTenantArchiveTimeFunc: method is nil but TenantArchiveTimeProvider.GetTenantArchiveTime was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		TenantID int64
+	}{
+		Ctx:      ctx,
+		TenantID: tenantID,
+	}
+	mock.lockGetTenantArchiveTime.Lock()
+	mock.calls.GetTenantArchiveTime = append(mock.calls.GetTenantArchiveTime, callInfo)
+	mock.lockGetTenantArchiveTime.Unlock()
+	return mock.GetTenantArchiveTimeFunc(ctx, tenantID)
+}
+
+// GetTenantArchiveTimeCalls gets all the calls that were made to GetTenantArchiveTime.
+// Check the length with:
+//
+//	len(mockedTenantArchiveTimeProvider.GetTenantArchiveTimeCalls())
+func (mock *TenantArchiveTimeProviderMock) GetTenantArchiveTimeCalls() []struct {
+	Ctx      context.Context
+	TenantID int64
+} {
+	var calls []struct {
+		Ctx      context.Context
+		TenantID int64
+	}
+	mock.lockGetTenantArchiveTime.RLock()
+	calls = mock.calls.GetTenantArchiveTime
+	mock.lockGetTenantArchiveTime.RUnlock()
+	return calls
+}
@@ -0,0 +1,116 @@
+package measurements
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+var ErrPropertyFilterInvalid = web.NewError(http.StatusBadRequest, "Measurement property filter is invalid", "ERR_PROPERTY_FILTER_INVALID")
+
+type PropertyOperator string
+
+const (
+	PropertyEqual          PropertyOperator = "="
+	PropertyNotEqual       PropertyOperator = "!="
+	PropertyGreater        PropertyOperator = ">"
+	PropertyGreaterOrEqual PropertyOperator = ">="
+	PropertyLess           PropertyOperator = "<"
+	PropertyLessOrEqual    PropertyOperator = "<="
+)
+
+// propertyOperators are ordered such that operators are matched before their prefixes
+var propertyOperators = []PropertyOperator{
+	PropertyNotEqual, PropertyGreaterOrEqual, PropertyLessOrEqual, PropertyEqual, PropertyGreater, PropertyLess,
+}
+
+// IsOrdering is true for operators that compare numerically
+func (op PropertyOperator) IsOrdering() bool {
+	return op != PropertyEqual && op != PropertyNotEqual
+}
+
+// PropertyCondition compares the measurement property at the path with a value. Equality compares the value as
+// JSON if it is valid JSON and as string otherwise, such that gateway_eui=0011 and rssi=-90 both match.
+// Ordering operators only match numeric properties.
+type PropertyCondition struct {
+	Path     []string
+	Operator PropertyOperator
+	Value    string
+}
+
+// ParsePropertyCondition parses a condition formatted as <key><operator><value>, where nested keys are separated
+// by dots. For example: gateway_eui=0011, rssi>=-90 or metadata.network!=ttn
+func ParsePropertyCondition(str string) (PropertyCondition, error) {
+	ix := strings.IndexAny(str, "!=<>")
+	if ix <= 0 {
+		return PropertyCondition{}, fmt.Errorf("%w: %s, use <key><operator><value>", ErrPropertyFilterInvalid, str)
+	}
+	key, rest := str[:ix], str[ix:]
+	condition := PropertyCondition{Path: strings.Split(key, ".")}
+	for _, op := range propertyOperators {
+		if strings.HasPrefix(rest, string(op)) {
+			condition.Operator = op
+			condition.Value = rest[len(op):]
+			break
+		}
+	}
+	if condition.Operator == "" {
+		return PropertyCondition{}, fmt.Errorf("%w: %s, operator must be one of =, !=, >, >=, <, <=", ErrPropertyFilterInvalid, str)
+	}
+	for _, part := range condition.Path {
+		if strings.TrimSpace(part) == "" {
+			return PropertyCondition{}, fmt.Errorf("%w: %s has an empty key", ErrPropertyFilterInvalid, str)
+		}
+	}
+	if condition.Operator.IsOrdering() {
+		if _, err := strconv.ParseFloat(condition.Value, 64); err != nil {
+			return PropertyCondition{}, fmt.Errorf("%w: %s compares with a value that is not a number", ErrPropertyFilterInvalid, str)
+		}
+	}
+	return condition, nil
+}
+
+// ContainmentDocuments returns the JSON documents of which the properties contain one for the condition to be
+// equal. The document with the string value always matches, the value as JSON is added if it is not a string.
+func (c PropertyCondition) ContainmentDocuments() ([]string, error) {
+	values := []any{c.Value}
+	if json.Valid([]byte(c.Value)) && !strings.HasPrefix(strings.TrimSpace(c.Value), `"`) {
+		values = append(values, json.RawMessage(c.Value))
+	}
+	documents := make([]string, 0, len(values))
+	for _, value := range values {
+		for ix := len(c.Path) - 1; ix >= 0; ix-- {
+			value = map[string]any{c.Path[ix]: value}
+		}
+		doc, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, string(doc))
+	}
+	return documents, nil
+}
+
+// hasPropertyFilter is true if measurements are selected by their properties
+func (f Filter) hasPropertyFilter() bool {
+	return len(f.Properties) > 0 || len(f.Property) > 0
+}
+
+func (f Filter) validatePropertyFilter() error {
+	if len(f.Properties) > 0 {
+		var object map[string]any
+		if err := json.Unmarshal(f.Properties, &object); err != nil || object == nil {
+			return fmt.Errorf("%w: properties must be a JSON object", ErrPropertyFilterInvalid)
+		}
+	}
+	for _, str := range f.Property {
+		if _, err := ParsePropertyCondition(str); err != nil {
+			return err
+		}
+	}
+	return nil
+}
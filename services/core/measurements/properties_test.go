@@ -0,0 +1,79 @@
+package measurements_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestParsePropertyCondition(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected measurements.PropertyCondition
+		err      bool
+	}{
+		{input: "gateway_eui=0011", expected: measurements.PropertyCondition{Path: []string{"gateway_eui"}, Operator: measurements.PropertyEqual, Value: "0011"}},
+		{input: "rssi>=-90", expected: measurements.PropertyCondition{Path: []string{"rssi"}, Operator: measurements.PropertyGreaterOrEqual, Value: "-90"}},
+		{input: "snr<5.5", expected: measurements.PropertyCondition{Path: []string{"snr"}, Operator: measurements.PropertyLess, Value: "5.5"}},
+		{input: "meta.network!=", expected: measurements.PropertyCondition{Path: []string{"meta", "network"}, Operator: measurements.PropertyNotEqual, Value: ""}},
+		{input: "gateway_eui", err: true},
+		{input: "=0011", err: true},
+		{input: "meta..network=ttn", err: true},
+		{input: "rssi>high", err: true},
+		{input: "rssi!-90", err: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			condition, err := measurements.ParsePropertyCondition(tC.input)
+			if tC.err {
+				assert.ErrorIs(t, err, measurements.ErrPropertyFilterInvalid)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, condition)
+		})
+	}
+}
+
+func TestPropertyConditionShouldMatchStringAndJSONValues(t *testing.T) {
+	condition, err := measurements.ParsePropertyCondition("meta.channel=3")
+	require.NoError(t, err)
+	documents, err := condition.ContainmentDocuments()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"meta":{"channel":"3"}}`, `{"meta":{"channel":3}}`}, documents)
+
+	condition, err = measurements.ParsePropertyCondition("gateway_eui=0011")
+	require.NoError(t, err)
+	documents, err = condition.ContainmentDocuments()
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"gateway_eui":"0011"}`}, documents)
+}
+
+func TestQueryMeasurementsShouldValidatePropertyFilters(t *testing.T) {
+	store := &StoreMock{
+		QueryFunc: func(ctx context.Context, filter measurements.Filter, r pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+			return &pagination.Page[measurements.Measurement]{}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	_, err := svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{Properties: json.RawMessage(`["gateway"]`)}, pagination.Request{})
+	assert.ErrorIs(t, err, measurements.ErrPropertyFilterInvalid)
+	_, err = svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{Property: []string{"rssi>x"}}, pagination.Request{})
+	assert.ErrorIs(t, err, measurements.ErrPropertyFilterInvalid)
+	assert.Empty(t, store.QueryCalls())
+
+	_, err = svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{
+		Properties: json.RawMessage(`{"gateway_eui":"0011"}`),
+		Property:   []string{"rssi>=-90"},
+	}, pagination.Request{})
+	require.NoError(t, err)
+	assert.Len(t, store.QueryCalls(), 1)
+}
@@ -0,0 +1,296 @@
+package measurements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+var (
+	ErrQualityRulesInvalid = web.NewError(http.StatusBadRequest, "Quality rules are invalid", "ERR_QUALITY_RULES_INVALID")
+	ErrQualityInvalid      = web.NewError(http.StatusBadRequest, "Quality filter is invalid, use good, suspect or a quality flag", "ERR_QUALITY_INVALID")
+)
+
+// QualityFlag marks a measurement as suspect. A measurement without flags is of good quality,
+// multiple flags are combined as bitmask.
+type QualityFlag int
+
+const (
+	QualityGood            QualityFlag = 0
+	QualityRange           QualityFlag = 1 << 0
+	QualityRateOfChange    QualityFlag = 1 << 1
+	QualityFlatline        QualityFlag = 1 << 2
+	QualityFutureTimestamp QualityFlag = 1 << 3
+)
+
+type qualityFlagName struct {
+	flag QualityFlag
+	name string
+}
+
+var qualityFlagNames = []qualityFlagName{
+	{QualityRange, "range"},
+	{QualityRateOfChange, "rate_of_change"},
+	{QualityFlatline, "flatline"},
+	{QualityFutureTimestamp, "future_timestamp"},
+}
+
+// Names returns the name of every flag that is set
+func (f QualityFlag) Names() []string {
+	names := []string{}
+	for _, q := range qualityFlagNames {
+		if f&q.flag != 0 {
+			names = append(names, q.name)
+		}
+	}
+	return names
+}
+
+func (f QualityFlag) String() string {
+	if f == QualityGood {
+		return "good"
+	}
+	return strings.Join(f.Names(), ",")
+}
+
+func (f QualityFlag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Names())
+}
+
+func (f *QualityFlag) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	flag, err := ParseQualityFlag(names)
+	if err != nil {
+		return err
+	}
+	*f = flag
+	return nil
+}
+
+// ParseQualityFlag combines the named quality flags into one
+func ParseQualityFlag(names []string) (QualityFlag, error) {
+	var flag QualityFlag
+	for _, name := range names {
+		ix := slices.IndexFunc(qualityFlagNames, func(q qualityFlagName) bool { return q.name == name })
+		if ix < 0 {
+			return 0, fmt.Errorf("%w: %s", ErrQualityInvalid, name)
+		}
+		flag |= qualityFlagNames[ix].flag
+	}
+	return flag, nil
+}
+
+// QualityFilter selects measurements by quality. Good and Suspect select measurements without
+// or with any flag, Flags selects measurements with at least one of the given flags.
+type QualityFilter struct {
+	Good    bool
+	Suspect bool
+	Flags   QualityFlag
+}
+
+// ParseQualityFilter parses the values of the quality query parameter, which are "good", "suspect"
+// or the name of a quality flag. Values may be comma separated.
+func ParseQualityFilter(values []string) (QualityFilter, error) {
+	var filter QualityFilter
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			switch part = strings.TrimSpace(part); part {
+			case "":
+			case "good":
+				filter.Good = true
+			case "suspect":
+				filter.Suspect = true
+			default:
+				flag, err := ParseQualityFlag([]string{part})
+				if err != nil {
+					return QualityFilter{}, err
+				}
+				filter.Flags |= flag
+			}
+		}
+	}
+	return filter, nil
+}
+
+// IsEmpty is true if the filter matches any measurement
+func (f QualityFilter) IsEmpty() bool {
+	return !f.Good && !f.Suspect && f.Flags == 0
+}
+
+// QualityRules are evaluated for every measurement stored in a datastream. Measurements violating
+// a rule are stored with the corresponding quality flag, they are never dropped.
+type QualityRules struct {
+	Range           *RangeRule           `json:"range,omitempty"`
+	RateOfChange    *RateOfChangeRule    `json:"rate_of_change,omitempty"`
+	Flatline        *FlatlineRule        `json:"flatline,omitempty"`
+	FutureTimestamp *FutureTimestampRule `json:"future_timestamp,omitempty"`
+}
+
+// RangeRule flags values outside the inclusive minimum and maximum, either bound is optional
+type RangeRule struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// RateOfChangeRule flags values that changed faster than allowed compared to the previous value
+type RateOfChangeRule struct {
+	MaxChangePerSecond float64 `json:"max_change_per_second"`
+}
+
+// FlatlineRule flags values when the last Count values, including the new value, are all within
+// Tolerance of each other. This indicates a sensor that is stuck.
+type FlatlineRule struct {
+	Count     int     `json:"count"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+// FutureTimestampRule flags measurements with a timestamp later than the time they were processed
+type FutureTimestampRule struct {
+	ToleranceSeconds int `json:"tolerance_seconds"`
+}
+
+func (r QualityRules) Validate() error {
+	if r.Range != nil && r.Range.Min != nil && r.Range.Max != nil && *r.Range.Min > *r.Range.Max {
+		return fmt.Errorf("%w: range minimum is larger than the maximum", ErrQualityRulesInvalid)
+	}
+	if r.RateOfChange != nil && r.RateOfChange.MaxChangePerSecond <= 0 {
+		return fmt.Errorf("%w: rate of change must be positive", ErrQualityRulesInvalid)
+	}
+	if r.Flatline != nil && (r.Flatline.Count < 2 || r.Flatline.Tolerance < 0) {
+		return fmt.Errorf("%w: flatline count must be at least 2 and tolerance must not be negative", ErrQualityRulesInvalid)
+	}
+	if r.FutureTimestamp != nil && r.FutureTimestamp.ToleranceSeconds < 0 {
+		return fmt.Errorf("%w: future timestamp tolerance must not be negative", ErrQualityRulesInvalid)
+	}
+	return nil
+}
+
+// Sample is a single value of a datastream
+type Sample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// HistoryRequired is the amount of previous samples needed to evaluate the rules
+func (r QualityRules) HistoryRequired() int {
+	required := 0
+	if r.RateOfChange != nil {
+		required = 1
+	}
+	if r.Flatline != nil {
+		required = max(required, r.Flatline.Count-1)
+	}
+	return required
+}
+
+// Evaluate returns the quality flags for a sample. History contains the previous samples of the
+// datastream ordered from newest to oldest.
+func (r QualityRules) Evaluate(sample Sample, history []Sample, now time.Time) QualityFlag {
+	flag := QualityGood
+	if r.Range != nil {
+		if (r.Range.Min != nil && sample.Value < *r.Range.Min) || (r.Range.Max != nil && sample.Value > *r.Range.Max) {
+			flag |= QualityRange
+		}
+	}
+	if r.RateOfChange != nil && len(history) > 0 {
+		elapsed := sample.Timestamp.Sub(history[0].Timestamp).Seconds()
+		if elapsed > 0 && math.Abs(sample.Value-history[0].Value)/elapsed > r.RateOfChange.MaxChangePerSecond {
+			flag |= QualityRateOfChange
+		}
+	}
+	if r.Flatline != nil && len(history) >= r.Flatline.Count-1 {
+		low, high := sample.Value, sample.Value
+		for _, previous := range history[:r.Flatline.Count-1] {
+			low, high = min(low, previous.Value), max(high, previous.Value)
+		}
+		if high-low <= r.Flatline.Tolerance {
+			flag |= QualityFlatline
+		}
+	}
+	if r.FutureTimestamp != nil {
+		tolerance := time.Duration(r.FutureTimestamp.ToleranceSeconds) * time.Second
+		if sample.Timestamp.After(now.Add(tolerance)) {
+			flag |= QualityFutureTimestamp
+		}
+	}
+	return flag
+}
+
+// qualityEvaluator evaluates quality rules for the measurements of a single pipeline message.
+// The history of a datastream is fetched once and extended with the measurements of the message,
+// measurements of other pipeline messages in the same uncommitted batch are not taken into account.
+type qualityEvaluator struct {
+	store   Store
+	now     time.Time
+	history map[uuid.UUID][]Sample
+}
+
+func newQualityEvaluator(store Store, now time.Time) *qualityEvaluator {
+	return &qualityEvaluator{
+		store:   store,
+		now:     now,
+		history: map[uuid.UUID][]Sample{},
+	}
+}
+
+func (e *qualityEvaluator) evaluate(ctx context.Context, ds *Datastream, sample Sample) (QualityFlag, error) {
+	required := ds.QualityRules.HistoryRequired()
+	if required == 0 {
+		return ds.QualityRules.Evaluate(sample, nil, e.now), nil
+	}
+
+	history, ok := e.history[ds.ID]
+	if !ok {
+		var err error
+		history, err = e.store.ListRecentSamples(ctx, ds.ID, sample.Timestamp, required)
+		if err != nil {
+			return QualityGood, fmt.Errorf("could not get datastream history for quality rules: %w", err)
+		}
+	}
+
+	previous := make([]Sample, 0, required)
+	for _, s := range history {
+		if s.Timestamp.Before(sample.Timestamp) {
+			previous = append(previous, s)
+		}
+	}
+	slices.SortStableFunc(previous, func(a, b Sample) int { return b.Timestamp.Compare(a.Timestamp) })
+	previous = previous[:min(len(previous), required)]
+
+	e.history[ds.ID] = append(history, sample)
+	return ds.QualityRules.Evaluate(sample, previous, e.now), nil
+}
+
+// SetDatastreamQualityRules replaces the quality rules of a datastream. Only measurements stored
+// after this change are evaluated with the new rules.
+func (s *Service) SetDatastreamQualityRules(ctx context.Context, id uuid.UUID, rules QualityRules) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	// Ensures the datastream exists and belongs to this tenant
+	if _, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}}); err != nil {
+		return err
+	}
+	return s.store.SetDatastreamQualityRules(ctx, id, rules)
+}
@@ -0,0 +1,178 @@
+package measurements_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestQualityRulesEvaluate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+	rules := measurements.QualityRules{
+		Range:           &measurements.RangeRule{Min: ptr(0.0), Max: ptr(100.0)},
+		RateOfChange:    &measurements.RateOfChangeRule{MaxChangePerSecond: 0.1},
+		Flatline:        &measurements.FlatlineRule{Count: 3, Tolerance: 0.01},
+		FutureTimestamp: &measurements.FutureTimestampRule{ToleranceSeconds: 60},
+	}
+	history := []measurements.Sample{
+		{Timestamp: at(-10), Value: 20},
+		{Timestamp: at(-20), Value: 21},
+	}
+	flatHistory := []measurements.Sample{
+		{Timestamp: at(-10), Value: 20},
+		{Timestamp: at(-20), Value: 20.005},
+	}
+
+	testCases := []struct {
+		desc     string
+		sample   measurements.Sample
+		history  []measurements.Sample
+		expected measurements.QualityFlag
+	}{
+		{desc: "good", sample: measurements.Sample{Timestamp: now, Value: 22}, history: history, expected: measurements.QualityGood},
+		{desc: "negative", sample: measurements.Sample{Timestamp: now, Value: -1}, expected: measurements.QualityRange},
+		{desc: "above max", sample: measurements.Sample{Timestamp: now, Value: 900}, expected: measurements.QualityRange},
+		{
+			desc:     "jump",
+			sample:   measurements.Sample{Timestamp: now, Value: 90},
+			history:  history,
+			expected: measurements.QualityRateOfChange,
+		},
+		{desc: "flatline", sample: measurements.Sample{Timestamp: now, Value: 20}, history: flatHistory, expected: measurements.QualityFlatline},
+		{desc: "not enough history for flatline", sample: measurements.Sample{Timestamp: now, Value: 20}, history: flatHistory[:1], expected: measurements.QualityGood},
+		{desc: "within future tolerance", sample: measurements.Sample{Timestamp: at(1), Value: 22}, expected: measurements.QualityGood},
+		{
+			desc:     "future",
+			sample:   measurements.Sample{Timestamp: at(60), Value: 200},
+			expected: measurements.QualityFutureTimestamp | measurements.QualityRange,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, rules.Evaluate(tC.sample, tC.history, now))
+		})
+	}
+}
+
+func TestQualityRulesValidate(t *testing.T) {
+	assert.NoError(t, measurements.QualityRules{}.Validate())
+	assert.NoError(t, measurements.QualityRules{Range: &measurements.RangeRule{Min: ptr(0.0)}}.Validate())
+	assert.ErrorIs(t, measurements.QualityRules{
+		Range: &measurements.RangeRule{Min: ptr(10.0), Max: ptr(0.0)},
+	}.Validate(), measurements.ErrQualityRulesInvalid)
+	assert.ErrorIs(t, measurements.QualityRules{
+		Flatline: &measurements.FlatlineRule{Count: 1},
+	}.Validate(), measurements.ErrQualityRulesInvalid)
+	assert.ErrorIs(t, measurements.QualityRules{
+		RateOfChange: &measurements.RateOfChangeRule{},
+	}.Validate(), measurements.ErrQualityRulesInvalid)
+}
+
+func TestQualityFlagJSON(t *testing.T) {
+	data, err := json.Marshal(measurements.QualityRange | measurements.QualityFlatline)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["range","flatline"]`, string(data))
+
+	data, err = json.Marshal(measurements.QualityGood)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(data))
+}
+
+func TestParseQualityFilter(t *testing.T) {
+	filter, err := measurements.ParseQualityFilter([]string{"good,range", "flatline"})
+	require.NoError(t, err)
+	assert.Equal(t, measurements.QualityFilter{
+		Good:  true,
+		Flags: measurements.QualityRange | measurements.QualityFlatline,
+	}, filter)
+
+	_, err = measurements.ParseQualityFilter([]string{"bad"})
+	assert.ErrorIs(t, err, measurements.ErrQualityInvalid)
+}
+
+func TestShouldFlagSuspectMeasurementsOnIngestion(t *testing.T) {
+	ds := measurements.Datastream{
+		ID: uuid.New(),
+		QualityRules: measurements.QualityRules{
+			Range:    &measurements.RangeRule{Min: ptr(0.0)},
+			Flatline: &measurements.FlatlineRule{Count: 3},
+		},
+	}
+	store := &StoreMock{
+		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
+			return &ds, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return []measurements.Sample{{Timestamp: before.Add(-time.Hour), Value: 5}}, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	msg := newStorableMessage(t, 5, 5, -1)
+	for ix := range msg.Measurements {
+		msg.Measurements[ix].Timestamp += int64(ix) * time.Minute.Milliseconds()
+	}
+
+	// The first value together with the stored history and the next value form a flatline
+	err := svc.ProcessPipelineMessage(msg)
+	require.NoError(t, err)
+
+	require.Len(t, store.calls.ListRecentSamples, 1, "history should be fetched once per datastream")
+	assert.Equal(t, 2, store.calls.ListRecentSamples[0].Limit)
+	require.Len(t, store.calls.StoreMeasurements, 1)
+	stored := store.calls.StoreMeasurements[0].MeasurementsMoqParam
+	require.Len(t, stored, 3)
+	assert.Equal(t, measurements.QualityGood, stored[0].MeasurementQuality)
+	assert.Equal(t, measurements.QualityFlatline, stored[1].MeasurementQuality)
+	assert.Equal(t, measurements.QualityRange, stored[2].MeasurementQuality, "suspect data should be stored, not dropped")
+}
+
+func TestShouldNotCommitMeasurementsWhenQualityHistoryFails(t *testing.T) {
+	ds := measurements.Datastream{
+		ID:           uuid.New(),
+		QualityRules: measurements.QualityRules{RateOfChange: &measurements.RateOfChangeRule{MaxChangePerSecond: 1}},
+	}
+	store := &StoreMock{
+		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
+			return &ds, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, errors.New("connection reset")
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	msg := newStorableMessage(t)
+	require.NoError(t, msg.NewMeasurement().SetValue(5, "obs", "foo").SetSensor("sensor").Add())
+	require.NoError(t, msg.NewMeasurement().SetValue(5, "obs", "1").SetSensor("sensor").Add())
+
+	err := svc.ProcessPipelineMessage(msg)
+	assert.ErrorIs(t, err, measurements.ErrMeasurementsNotCommitted, "the message should be requeued")
+	assert.ErrorIs(t, err, measurements.ErrUoMInvalid, "earlier errors should be kept")
+	assert.Empty(t, store.calls.StoreMeasurements)
+}
+
+func TestSetDatastreamQualityRulesShouldValidate(t *testing.T) {
+	store := &StoreMock{}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	err := svc.SetDatastreamQualityRules(authtest.GodContext(), uuid.New(), measurements.QualityRules{
+		Flatline: &measurements.FlatlineRule{Count: 0},
+	})
+
+	assert.ErrorIs(t, err, measurements.ErrQualityRulesInvalid)
+	assert.Empty(t, store.calls.SetDatastreamQualityRules)
+}
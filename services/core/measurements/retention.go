@@ -0,0 +1,180 @@
+package measurements
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+var ErrArchiveTimeInvalid = web.NewError(http.StatusBadRequest, "Archive time must be at least 1 day", "ERR_ARCHIVE_TIME_INVALID")
+
+// TenantArchiveTimeProvider provides the archive time of tenants, which is managed by the tenants service
+type TenantArchiveTimeProvider interface {
+	// GetTenantArchiveTime returns the amount of days measurements of the tenant are kept or nil if the
+	// tenant has no archive time
+	GetTenantArchiveTime(ctx context.Context, tenantID int64) (*int, error)
+}
+
+// WithTenantArchiveTime sets the provider of tenant archive times. Without a provider, the system archive
+// time applies to every sensor and datastream that has no archive time of its own.
+func (s *Service) WithTenantArchiveTime(provider TenantArchiveTimeProvider) *Service {
+	s.tenantArchiveTime = provider
+	return s
+}
+
+type RetentionSource string
+
+const (
+	RetentionSourceSensor     RetentionSource = "sensor"
+	RetentionSourceDatastream RetentionSource = "datastream"
+	RetentionSourceTenant     RetentionSource = "tenant"
+	RetentionSourceSystem     RetentionSource = "system"
+)
+
+// Retention is the effective archive time of measurements and the archive time at every level. The first
+// level with an archive time applies in the order: sensor, datastream, tenant and system.
+type Retention struct {
+	DatastreamID          uuid.UUID       `json:"datastream_id"`
+	ArchiveTimeDays       int             `json:"archive_time_days"`
+	Source                RetentionSource `json:"source"`
+	SensorArchiveTime     *int            `json:"sensor_archive_time"`
+	DatastreamArchiveTime *int            `json:"datastream_archive_time"`
+	TenantArchiveTime     *int            `json:"tenant_archive_time"`
+	SystemArchiveTime     int             `json:"system_archive_time"`
+}
+
+// Expiration returns when a measurement received at the given time expires
+func (r Retention) Expiration(receivedAt time.Time) time.Time {
+	return receivedAt.Add(time.Duration(r.ArchiveTimeDays) * 24 * time.Hour)
+}
+
+// retention resolves the archive time of measurements of the sensor in the datastream
+func (s *Service) retention(ctx context.Context, tenantID int64, sensor *devices.Sensor, ds *Datastream) (Retention, error) {
+	r := Retention{
+		DatastreamID:          ds.ID,
+		SensorArchiveTime:     sensor.ArchiveTime,
+		DatastreamArchiveTime: ds.ArchiveTime,
+		SystemArchiveTime:     s.systemArchiveTime,
+	}
+	if s.tenantArchiveTime != nil {
+		days, err := s.tenantArchiveTime.GetTenantArchiveTime(ctx, tenantID)
+		if err != nil {
+			return Retention{}, fmt.Errorf("could not get tenant archive time: %w", err)
+		}
+		r.TenantArchiveTime = days
+	}
+
+	switch {
+	case r.SensorArchiveTime != nil:
+		r.ArchiveTimeDays, r.Source = *r.SensorArchiveTime, RetentionSourceSensor
+	case r.DatastreamArchiveTime != nil:
+		r.ArchiveTimeDays, r.Source = *r.DatastreamArchiveTime, RetentionSourceDatastream
+	case r.TenantArchiveTime != nil:
+		r.ArchiveTimeDays, r.Source = *r.TenantArchiveTime, RetentionSourceTenant
+	default:
+		r.ArchiveTimeDays, r.Source = r.SystemArchiveTime, RetentionSourceSystem
+	}
+	return r, nil
+}
+
+// GetDatastreamRetention returns the effective archive time of new measurements in the datastream
+func (s *Service) GetDatastreamRetention(ctx context.Context, id uuid.UUID) (*Retention, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}})
+	if err != nil {
+		return nil, err
+	}
+	_, sensor, err := s.findSensorDevice(ctx, ds.SensorID)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.retention(ctx, tenantID, sensor, ds)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// SetDatastreamArchiveTime sets the amount of days new measurements in the datastream are kept. A nil archive
+// time removes it, such that the tenant or system archive time applies. The archive time of the sensor
+// takes precedence over that of the datastream.
+func (s *Service) SetDatastreamArchiveTime(ctx context.Context, id uuid.UUID, days *int) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if days != nil && *days < 1 {
+		return ErrArchiveTimeInvalid
+	}
+
+	// Ensures the datastream exists and belongs to this tenant
+	if _, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}}); err != nil {
+		return err
+	}
+	return s.store.SetDatastreamArchiveTime(ctx, id, days)
+}
+
+// TenantArchiveTimeCache caches the archive times of another provider. When refreshing an entry fails, the
+// previous archive time is used until the provider is available again.
+type TenantArchiveTimeCache struct {
+	provider TenantArchiveTimeProvider
+	ttl      time.Duration
+
+	lock    sync.Mutex
+	entries map[int64]tenantArchiveTimeEntry
+}
+
+type tenantArchiveTimeEntry struct {
+	days      *int
+	fetchedAt time.Time
+}
+
+var _ TenantArchiveTimeProvider = (*TenantArchiveTimeCache)(nil)
+
+func NewTenantArchiveTimeCache(provider TenantArchiveTimeProvider, ttl time.Duration) *TenantArchiveTimeCache {
+	return &TenantArchiveTimeCache{
+		provider: provider,
+		ttl:      ttl,
+		entries:  map[int64]tenantArchiveTimeEntry{},
+	}
+}
+
+func (c *TenantArchiveTimeCache) GetTenantArchiveTime(ctx context.Context, tenantID int64) (*int, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[tenantID]
+	c.lock.Unlock()
+	if ok && time.Since(entry.fetchedAt) < c.ttl {
+		return entry.days, nil
+	}
+
+	days, err := c.provider.GetTenantArchiveTime(ctx, tenantID)
+	if err != nil {
+		if ok {
+			return entry.days, nil
+		}
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.entries[tenantID] = tenantArchiveTimeEntry{days: days, fetchedAt: time.Now()}
+	c.lock.Unlock()
+	return days, nil
+}
@@ -0,0 +1,175 @@
+package measurements_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestGetDatastreamRetentionShouldResolveArchiveTime(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		sensor     *int
+		datastream *int
+		tenant     *int
+		days       int
+		source     measurements.RetentionSource
+	}{
+		{desc: "sensor", sensor: ptr(7), datastream: ptr(14), tenant: ptr(60), days: 7, source: measurements.RetentionSourceSensor},
+		{desc: "datastream", datastream: ptr(14), tenant: ptr(60), days: 14, source: measurements.RetentionSourceDatastream},
+		{desc: "tenant", tenant: ptr(60), days: 60, source: measurements.RetentionSourceTenant},
+		{desc: "system", days: 30, source: measurements.RetentionSourceSystem},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			ds := measurements.Datastream{ID: uuid.New(), SensorID: 12, ArchiveTime: tC.datastream}
+			dev := newIngestionDevice()
+			dev.Sensors[1].ArchiveTime = tC.sensor
+			store := &StoreMock{
+				GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+					return &ds, nil
+				},
+			}
+			deviceStore := &DeviceStoreMock{
+				ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+					return &pagination.Page[devices.Device]{Data: []devices.Device{dev}}, nil
+				},
+			}
+			tenants := &TenantArchiveTimeProviderMock{
+				GetTenantArchiveTimeFunc: func(ctx context.Context, tenantID int64) (*int, error) {
+					return tC.tenant, nil
+				},
+			}
+			svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore).WithTenantArchiveTime(tenants)
+
+			retention, err := svc.GetDatastreamRetention(authtest.GodContext(), ds.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tC.days, retention.ArchiveTimeDays)
+			assert.Equal(t, tC.source, retention.Source)
+			assert.Equal(t, 30, retention.SystemArchiveTime)
+			require.Len(t, tenants.GetTenantArchiveTimeCalls(), 1)
+			assert.Equal(t, authtest.DefaultTenantID, tenants.GetTenantArchiveTimeCalls()[0].TenantID)
+		})
+	}
+}
+
+func TestAddDatastreamMeasurementsShouldExpireWithTenantArchiveTime(t *testing.T) {
+	ds := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "water_level", UnitOfMeasurement: "m"}
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &ds, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return nil
+		},
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	tenants := &TenantArchiveTimeProviderMock{
+		GetTenantArchiveTimeFunc: func(ctx context.Context, tenantID int64) (*int, error) {
+			return ptr(90), nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), deviceStore).WithTenantArchiveTime(tenants)
+
+	_, err := svc.AddDatastreamMeasurements(authtest.GodContext(), ds.ID, []measurements.NewMeasurement{
+		{Timestamp: time.Now(), Value: 1},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, store.StoreMeasurementsCalls(), 1)
+	m := store.StoreMeasurementsCalls()[0].MeasurementsMoqParam[0]
+	assert.Equal(t, 90, m.OrganisationArchiveTime)
+	assert.Equal(t, 90*24*time.Hour, m.MeasurementExpiration.Sub(m.CreatedAt))
+}
+
+func TestShouldNotCommitMeasurementsWhenTenantArchiveTimeFails(t *testing.T) {
+	store := &StoreMock{
+		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: uuid.New()}, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+	}
+	tenants := &TenantArchiveTimeProviderMock{
+		GetTenantArchiveTimeFunc: func(ctx context.Context, tenantID int64) (*int, error) {
+			return nil, errors.New("tenants service unavailable")
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil).WithTenantArchiveTime(tenants)
+
+	err := svc.ProcessPipelineMessage(newStorableMessage(t, 5))
+	assert.ErrorIs(t, err, measurements.ErrMeasurementsNotCommitted, "the message should be requeued")
+	assert.Empty(t, store.calls.StoreMeasurements)
+}
+
+func TestSetDatastreamArchiveTimeShouldValidate(t *testing.T) {
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: id}, nil
+		},
+		SetDatastreamArchiveTimeFunc: func(ctx context.Context, datastreamID uuid.UUID, days *int) error {
+			return nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil)
+
+	err := svc.SetDatastreamArchiveTime(authtest.GodContext(), uuid.New(), ptr(0))
+	assert.ErrorIs(t, err, measurements.ErrArchiveTimeInvalid)
+	assert.Empty(t, store.SetDatastreamArchiveTimeCalls())
+
+	require.NoError(t, svc.SetDatastreamArchiveTime(authtest.GodContext(), uuid.New(), nil))
+	require.NoError(t, svc.SetDatastreamArchiveTime(authtest.GodContext(), uuid.New(), ptr(365)))
+	require.Len(t, store.SetDatastreamArchiveTimeCalls(), 2)
+	assert.Nil(t, store.SetDatastreamArchiveTimeCalls()[0].Days)
+	assert.Equal(t, ptr(365), store.SetDatastreamArchiveTimeCalls()[1].Days)
+}
+
+func TestTenantArchiveTimeCacheShouldReuseArchiveTimes(t *testing.T) {
+	failing := false
+	provider := &TenantArchiveTimeProviderMock{
+		GetTenantArchiveTimeFunc: func(ctx context.Context, tenantID int64) (*int, error) {
+			if failing {
+				return nil, errors.New("tenants service unavailable")
+			}
+			return ptr(int(tenantID)), nil
+		},
+	}
+
+	cache := measurements.NewTenantArchiveTimeCache(provider, time.Hour)
+	for range 2 {
+		days, err := cache.GetTenantArchiveTime(context.Background(), 5)
+		require.NoError(t, err)
+		assert.Equal(t, ptr(5), days)
+	}
+	assert.Len(t, provider.GetTenantArchiveTimeCalls(), 1, "second lookup should be cached")
+
+	// Expired entries are refreshed, but kept when refreshing fails
+	cache = measurements.NewTenantArchiveTimeCache(provider, 0)
+	_, err := cache.GetTenantArchiveTime(context.Background(), 5)
+	require.NoError(t, err)
+	failing = true
+	days, err := cache.GetTenantArchiveTime(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, ptr(5), days)
+	_, err = cache.GetTenantArchiveTime(context.Background(), 6)
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package measurements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+var (
+	ErrAggregateResolutionInvalid = web.NewError(http.StatusBadRequest, "Aggregation resolution is invalid for the interval and functions", "ERR_AGGREGATE_RESOLUTION_INVALID")
+	ErrRollupRetentionInvalid     = web.NewError(http.StatusBadRequest, "Rollup retention is invalid", "ERR_ROLLUP_RETENTION_INVALID")
+)
+
+// Resolution is the source of aggregated measurements. Besides the raw measurements, hourly and daily rollups
+// with the min, max, sum and count per datastream are maintained. Rollups have their own retention which is
+// usually longer than that of the raw measurements, so they keep the history after raw data is cleaned up.
+type Resolution string
+
+const (
+	// ResolutionAuto uses the coarsest resolution that can answer the aggregation
+	ResolutionAuto   Resolution = ""
+	ResolutionRaw    Resolution = "raw"
+	ResolutionHourly Resolution = "hour"
+	ResolutionDaily  Resolution = "day"
+)
+
+// Interval is the bucket size of the resolution, raw measurements have no buckets
+func (r Resolution) Interval() time.Duration {
+	switch r {
+	case ResolutionHourly:
+		return time.Hour
+	case ResolutionDaily:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+func ParseResolution(str string) (Resolution, error) {
+	switch res := Resolution(strings.ToLower(str)); res {
+	case ResolutionAuto, ResolutionRaw, ResolutionHourly, ResolutionDaily:
+		return res, nil
+	case "auto":
+		return ResolutionAuto, nil
+	}
+	return ResolutionAuto, fmt.Errorf("%w: %s", ErrAggregateResolutionInvalid, str)
+}
+
+// rollupFunctions are the aggregate functions that can be calculated from rollups
+var rollupFunctions = []AggregateFunction{AggregateAverage, AggregateMinimum, AggregateMaximum, AggregateSum, AggregateCount}
+
+// canAggregate returns whether the aggregation can be calculated at this resolution. Rollups can only be
+// combined into buckets that are a multiple of the rollup interval and do not retain the measurement quality,
+// location or properties.
+func (r Resolution) canAggregate(filter Filter, opts AggregationOptions) bool {
+	if r == ResolutionRaw {
+		return true
+	}
+	if len(filter.Quality) > 0 || filter.hasSpatialFilter() || filter.hasPropertyFilter() ||
+		opts.Interval%r.Interval() != 0 {
+		return false
+	}
+	for _, fn := range opts.Functions {
+		if !slices.Contains(rollupFunctions, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// autoIntervals are the intervals chosen from when an aggregation has no interval
+var autoIntervals = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// AutoIntervalBuckets is the maximum amount of buckets for an aggregation where the interval is chosen automatically
+const AutoIntervalBuckets = 1000
+
+// resolveAggregation chooses the interval if none is given and the resolution if it is automatic
+func resolveAggregation(filter Filter, opts AggregationOptions) (AggregationOptions, error) {
+	if opts.Interval == 0 {
+		opts.Interval = autoIntervals[len(autoIntervals)-1]
+		for _, interval := range autoIntervals {
+			if filter.End.Sub(filter.Start)/interval <= AutoIntervalBuckets {
+				opts.Interval = interval
+				break
+			}
+		}
+	}
+	if opts.Resolution != ResolutionAuto {
+		if !opts.Resolution.canAggregate(filter, opts) {
+			return opts, fmt.Errorf("%w: %s", ErrAggregateResolutionInvalid, opts.Resolution)
+		}
+		return opts, nil
+	}
+	for _, res := range []Resolution{ResolutionDaily, ResolutionHourly, ResolutionRaw} {
+		if res.canAggregate(filter, opts) {
+			opts.Resolution = res
+			break
+		}
+	}
+	return opts, nil
+}
+
+// RollupRetention is the amount of days rollups are kept, counted from the start of their bucket
+type RollupRetention struct {
+	HourlyDays int `json:"hourly_days"`
+	DailyDays  int `json:"daily_days"`
+}
+
+// DefaultRollupRetention is used for tenants without a rollup retention of their own
+var DefaultRollupRetention = RollupRetention{HourlyDays: 365, DailyDays: 3650}
+
+func (r RollupRetention) Validate() error {
+	if r.HourlyDays < 1 || r.DailyDays < 1 {
+		return errors.New("hourly_days and daily_days must be at least 1")
+	}
+	return nil
+}
+
+// GetRollupRetention returns the rollup retention of the tenant
+func (s *Service) GetRollupRetention(ctx context.Context) (*RollupRetention, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.GetRollupRetention(ctx, tenantID)
+}
+
+// SetRollupRetention changes the rollup retention of the tenant, this also applies to existing rollups
+func (s *Service) SetRollupRetention(ctx context.Context, retention RollupRetention) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if err := retention.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrRollupRetentionInvalid, err)
+	}
+	return s.store.SetRollupRetention(ctx, tenantID, retention)
+}
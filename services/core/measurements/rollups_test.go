@@ -0,0 +1,126 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestAggregateDatastreamShouldChooseResolution(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		desc               string
+		end                time.Time
+		quality            []string
+		opts               measurements.AggregationOptions
+		expectedInterval   time.Duration
+		expectedResolution measurements.Resolution
+		err                error
+	}{
+		{
+			desc:               "daily interval uses daily rollups",
+			opts:               measurements.AggregationOptions{Interval: 24 * time.Hour, Functions: []measurements.AggregateFunction{measurements.AggregateMinimum, measurements.AggregateMaximum}},
+			expectedInterval:   24 * time.Hour,
+			expectedResolution: measurements.ResolutionDaily,
+		},
+		{
+			desc:               "multiple of an hour uses hourly rollups",
+			opts:               measurements.AggregationOptions{Interval: 6 * time.Hour},
+			expectedInterval:   6 * time.Hour,
+			expectedResolution: measurements.ResolutionHourly,
+		},
+		{
+			desc:               "sub hour interval uses raw measurements",
+			opts:               measurements.AggregationOptions{Interval: 15 * time.Minute},
+			expectedInterval:   15 * time.Minute,
+			expectedResolution: measurements.ResolutionRaw,
+		},
+		{
+			desc:               "functions not in rollups use raw measurements",
+			opts:               measurements.AggregationOptions{Interval: 24 * time.Hour, Functions: []measurements.AggregateFunction{measurements.AggregateLast}},
+			expectedInterval:   24 * time.Hour,
+			expectedResolution: measurements.ResolutionRaw,
+		},
+		{
+			desc:               "quality filter uses raw measurements",
+			quality:            []string{"good"},
+			opts:               measurements.AggregationOptions{Interval: 24 * time.Hour},
+			expectedInterval:   24 * time.Hour,
+			expectedResolution: measurements.ResolutionRaw,
+		},
+		{
+			desc:               "interval is chosen from the range",
+			end:                start.AddDate(0, 0, 30),
+			expectedInterval:   time.Hour,
+			expectedResolution: measurements.ResolutionHourly,
+		},
+		{
+			desc:               "raw resolution can be forced",
+			opts:               measurements.AggregationOptions{Interval: 24 * time.Hour, Resolution: measurements.ResolutionRaw},
+			expectedInterval:   24 * time.Hour,
+			expectedResolution: measurements.ResolutionRaw,
+		},
+		{
+			desc: "forced resolution must fit the interval",
+			opts: measurements.AggregationOptions{Interval: time.Hour, Resolution: measurements.ResolutionDaily},
+			err:  measurements.ErrAggregateResolutionInvalid,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := &StoreMock{
+				GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+					return &measurements.Datastream{ID: id}, nil
+				},
+				AggregateMeasurementsFunc: func(ctx context.Context, filter measurements.Filter, opts measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+					return []measurements.Aggregate{}, nil
+				},
+			}
+			svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+			end := tC.end
+			if end.IsZero() {
+				end = start.AddDate(0, 0, 7)
+			}
+
+			_, err := svc.AggregateDatastream(authtest.GodContext(), uuid.New(), measurements.Filter{
+				Start: start, End: end, Quality: tC.quality,
+			}, tC.opts)
+
+			if tC.err != nil {
+				assert.ErrorIs(t, err, tC.err)
+				assert.Empty(t, store.AggregateMeasurementsCalls())
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, store.AggregateMeasurementsCalls(), 1)
+			opts := store.AggregateMeasurementsCalls()[0].AggregationOptions
+			assert.Equal(t, tC.expectedInterval, opts.Interval)
+			assert.Equal(t, tC.expectedResolution, opts.Resolution)
+		})
+	}
+}
+
+func TestSetRollupRetentionShouldValidate(t *testing.T) {
+	store := &StoreMock{
+		SetRollupRetentionFunc: func(ctx context.Context, tenantID int64, retention measurements.RollupRetention) error {
+			return nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	err := svc.SetRollupRetention(authtest.GodContext(), measurements.RollupRetention{HourlyDays: 0, DailyDays: 365})
+	assert.ErrorIs(t, err, measurements.ErrRollupRetentionInvalid)
+	assert.Empty(t, store.SetRollupRetentionCalls())
+
+	err = svc.SetRollupRetention(authtest.GodContext(), measurements.RollupRetention{HourlyDays: 730, DailyDays: 7300})
+	require.NoError(t, err)
+	require.Len(t, store.SetRollupRetentionCalls(), 1)
+	assert.Equal(t, authtest.DefaultTenantID, store.SetRollupRetentionCalls()[0].TenantID)
+}
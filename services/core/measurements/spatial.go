@@ -0,0 +1,103 @@
+package measurements
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/wkt"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+var ErrSpatialFilterInvalid = web.NewError(http.StatusBadRequest, "Spatial filter is invalid", "ERR_SPATIAL_FILTER_INVALID")
+
+// BoundingBox is an area in WGS84 degrees
+type BoundingBox struct {
+	West  float64
+	South float64
+	East  float64
+	North float64
+}
+
+// ParseBoundingBox parses a bounding box formatted as west,south,east,north
+func ParseBoundingBox(str string) (BoundingBox, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, fmt.Errorf("%w: bbox must be formatted as west,south,east,north", ErrSpatialFilterInvalid)
+	}
+	values := make([]float64, len(parts))
+	for ix, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, fmt.Errorf("%w: bbox must be formatted as west,south,east,north", ErrSpatialFilterInvalid)
+		}
+		values[ix] = v
+	}
+	bbox := BoundingBox{West: values[0], South: values[1], East: values[2], North: values[3]}
+	if err := bbox.validate(); err != nil {
+		return BoundingBox{}, fmt.Errorf("%w: bbox %w", ErrSpatialFilterInvalid, err)
+	}
+	return bbox, nil
+}
+
+func (b BoundingBox) validate() error {
+	for _, lon := range []float64{b.West, b.East} {
+		if lon < -180 || lon > 180 {
+			return errors.New("longitude must be between -180 and 180")
+		}
+	}
+	for _, lat := range []float64{b.South, b.North} {
+		if lat < -90 || lat > 90 {
+			return errors.New("latitude must be between -90 and 90")
+		}
+	}
+	if b.West > b.East || b.South > b.North {
+		return errors.New("west and south must not be greater than east and north")
+	}
+	return nil
+}
+
+// ValidatePolygon checks that the WKT is a polygon or multipolygon with WGS84 coordinates
+func ValidatePolygon(str string) error {
+	g, err := wkt.Unmarshal(str)
+	if err != nil {
+		return fmt.Errorf("%w: polygon must be WKT: %w", ErrSpatialFilterInvalid, err)
+	}
+	switch g.(type) {
+	case *geom.Polygon, *geom.MultiPolygon:
+	default:
+		return fmt.Errorf("%w: polygon must be a POLYGON or MULTIPOLYGON", ErrSpatialFilterInvalid)
+	}
+	if g.Empty() {
+		return fmt.Errorf("%w: polygon must not be empty", ErrSpatialFilterInvalid)
+	}
+	bounds := g.Bounds()
+	err = BoundingBox{West: bounds.Min(0), South: bounds.Min(1), East: bounds.Max(0), North: bounds.Max(1)}.validate()
+	if err != nil {
+		return fmt.Errorf("%w: polygon %w", ErrSpatialFilterInvalid, err)
+	}
+	return nil
+}
+
+// hasSpatialFilter is true if measurements are selected by their location
+func (f Filter) hasSpatialFilter() bool {
+	return f.BoundingBox != "" || f.Polygon != "" || len(f.WithinFeatureOfInterest) > 0
+}
+
+func (f Filter) validateSpatialFilter() error {
+	if f.BoundingBox != "" {
+		if _, err := ParseBoundingBox(f.BoundingBox); err != nil {
+			return err
+		}
+	}
+	if f.Polygon != "" {
+		if err := ValidatePolygon(f.Polygon); err != nil {
+			return err
+		}
+	}
+	return nil
+}
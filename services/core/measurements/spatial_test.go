@@ -0,0 +1,81 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestParseBoundingBox(t *testing.T) {
+	bbox, err := measurements.ParseBoundingBox("3.5, 51.4,3.9,51.6")
+	require.NoError(t, err)
+	assert.Equal(t, measurements.BoundingBox{West: 3.5, South: 51.4, East: 3.9, North: 51.6}, bbox)
+
+	for _, str := range []string{"", "3.5,51.4,3.9", "a,51.4,3.9,51.6", "3.9,51.4,3.5,51.6", "3.5,51.4,3.9,91"} {
+		_, err := measurements.ParseBoundingBox(str)
+		assert.ErrorIs(t, err, measurements.ErrSpatialFilterInvalid, str)
+	}
+}
+
+func TestValidatePolygon(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		polygon string
+		ok      bool
+	}{
+		{desc: "polygon", polygon: "POLYGON((3.5 51.4, 3.9 51.4, 3.9 51.6, 3.5 51.4))", ok: true},
+		{desc: "multipolygon", polygon: "MULTIPOLYGON(((3.5 51.4, 3.9 51.4, 3.9 51.6, 3.5 51.4)))", ok: true},
+		{desc: "point", polygon: "POINT(3.5 51.4)"},
+		{desc: "not wkt", polygon: "3.5,51.4,3.9,51.6"},
+		{desc: "out of bounds", polygon: "POLYGON((3.5 51.4, 190 51.4, 3.9 51.6, 3.5 51.4))"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := measurements.ValidatePolygon(tC.polygon)
+			if tC.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, measurements.ErrSpatialFilterInvalid)
+			}
+		})
+	}
+}
+
+func TestQueryMeasurementsShouldValidateSpatialFilter(t *testing.T) {
+	store := &StoreMock{}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	_, err := svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{Polygon: "POINT(3.5 51.4)"}, pagination.Request{})
+	assert.ErrorIs(t, err, measurements.ErrSpatialFilterInvalid)
+	assert.Empty(t, store.QueryCalls())
+}
+
+func TestAggregateDatastreamWithSpatialFilterShouldUseRawMeasurements(t *testing.T) {
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: id}, nil
+		},
+		AggregateMeasurementsFunc: func(ctx context.Context, filter measurements.Filter, opts measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+			return []measurements.Aggregate{}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := svc.AggregateDatastream(authtest.GodContext(), uuid.New(), measurements.Filter{
+		Start:                   start,
+		End:                     start.AddDate(0, 0, 7),
+		WithinFeatureOfInterest: []int64{1},
+	}, measurements.AggregationOptions{Interval: 24 * time.Hour})
+	require.NoError(t, err)
+	require.Len(t, store.AggregateMeasurementsCalls(), 1)
+	assert.Equal(t, measurements.ResolutionRaw, store.AggregateMeasurementsCalls()[0].AggregationOptions.Resolution)
+}
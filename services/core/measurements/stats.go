@@ -0,0 +1,329 @@
+package measurements
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+const (
+	// DefaultStatsRange is the time range of datastream statistics without start time
+	DefaultStatsRange = 7 * 24 * time.Hour
+	// DefaultHistogramBuckets is the amount of histogram buckets if none are given
+	DefaultHistogramBuckets = 10
+	// MaxHistogramBuckets limits the amount of histogram buckets
+	MaxHistogramBuckets = 100
+	// StatsHourlyRange and StatsDailyRange are the minimum time ranges for which statistics with automatic
+	// resolution are calculated from the hourly and daily rollups
+	StatsHourlyRange = 2 * 24 * time.Hour
+	StatsDailyRange  = 31 * 24 * time.Hour
+)
+
+var (
+	ErrStatsRangeInvalid       = web.NewError(http.StatusBadRequest, "Statistics require a start before the end", "ERR_STATS_RANGE_INVALID")
+	ErrHistogramBucketsInvalid = web.NewError(http.StatusBadRequest, fmt.Sprintf("Histogram buckets must be between 1 and %d", MaxHistogramBuckets), "ERR_HISTOGRAM_BUCKETS_INVALID")
+)
+
+// ValueSummary summarises the measurement values of a datastream in a time range, summaries of adjacent
+// time ranges can be merged
+type ValueSummary struct {
+	DatastreamID uuid.UUID
+	Count        int64
+	Sum          float64
+	// SumSquares is nil if it is unknown for any of the rollups in the time range
+	SumSquares *float64
+	Min        float64
+	Max        float64
+	First      time.Time
+	Last       time.Time
+}
+
+func (a ValueSummary) merge(b ValueSummary) ValueSummary {
+	if a.Count == 0 {
+		return b
+	}
+	if b.Count == 0 {
+		return a
+	}
+	merged := ValueSummary{
+		DatastreamID: a.DatastreamID,
+		Count:        a.Count + b.Count,
+		Sum:          a.Sum + b.Sum,
+		Min:          math.Min(a.Min, b.Min),
+		Max:          math.Max(a.Max, b.Max),
+		First:        minTime(a.First, b.First),
+		Last:         maxTime(a.Last, b.Last),
+	}
+	if a.SumSquares != nil && b.SumSquares != nil {
+		merged.SumSquares = lo.ToPtr(*a.SumSquares + *b.SumSquares)
+	}
+	return merged
+}
+
+// HistogramRange divides the values between min and max of a datastream in equal width histogram buckets
+type HistogramRange struct {
+	DatastreamID uuid.UUID
+	Min          float64
+	Max          float64
+	Buckets      int
+}
+
+// HistogramCount is the amount of measurements in the histogram bucket with the zero based index. The
+// maximum value belongs to the last bucket.
+type HistogramCount struct {
+	DatastreamID uuid.UUID
+	Bucket       int
+	Count        int64
+}
+
+type HistogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int64   `json:"count"`
+}
+
+// DatastreamStats summarises the measurements of a datastream in a time range
+type DatastreamStats struct {
+	DatastreamID uuid.UUID `json:"datastream_id"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	// Resolution is the source of the part of the time range that is aligned to its interval, the remainder at
+	// the start and end of the time range is always calculated from the raw measurements
+	Resolution Resolution `json:"resolution"`
+	Count      int64      `json:"count"`
+	Min        *float64   `json:"min"`
+	Max        *float64   `json:"max"`
+	Mean       *float64   `json:"mean"`
+	// StdDev is the sample standard deviation. It is unknown for less than two measurements, or if rollups of which
+	// the raw measurements were cleaned up before the sum of squares was kept are used.
+	StdDev *float64 `json:"stddev"`
+	// FirstTimestamp and LastTimestamp fall back to the start of the first and last rollup bucket if the raw
+	// measurements are cleaned up
+	FirstTimestamp *time.Time `json:"first_timestamp"`
+	LastTimestamp  *time.Time `json:"last_timestamp"`
+	// Histogram divides the values between min and max in equal width buckets. With rollups every rollup bucket
+	// counts its measurements at their average value, making the histogram an approximation.
+	Histogram []HistogramBucket `json:"histogram"`
+}
+
+type StatsOptions struct {
+	Start time.Time
+	End   time.Time
+	// Buckets is the amount of histogram buckets, if zero the default is used
+	Buckets    int
+	Resolution Resolution
+}
+
+// resolve defaults the time range to the last week and chooses the resolution if it is automatic
+func (opts *StatsOptions) resolve(now time.Time) error {
+	if opts.End.IsZero() {
+		opts.End = now
+	}
+	if opts.Start.IsZero() {
+		opts.Start = opts.End.Add(-DefaultStatsRange)
+	}
+	if !opts.Start.Before(opts.End) {
+		return ErrStatsRangeInvalid
+	}
+	if opts.Buckets == 0 {
+		opts.Buckets = DefaultHistogramBuckets
+	}
+	if opts.Buckets < 1 || opts.Buckets > MaxHistogramBuckets {
+		return ErrHistogramBucketsInvalid
+	}
+	if opts.Resolution == ResolutionAuto {
+		switch d := opts.End.Sub(opts.Start); {
+		case d >= StatsDailyRange:
+			opts.Resolution = ResolutionDaily
+		case d >= StatsHourlyRange:
+			opts.Resolution = ResolutionHourly
+		default:
+			opts.Resolution = ResolutionRaw
+		}
+	}
+	return nil
+}
+
+// statsPart is a time range read at a single resolution
+type statsPart struct {
+	start      time.Time
+	end        time.Time
+	resolution Resolution
+}
+
+// statsParts splits the time range in the part aligned to the rollup interval, which is read from the rollups, and
+// the remainder at the start and end, which is read from the raw measurements
+func statsParts(start, end time.Time, resolution Resolution) []statsPart {
+	interval := resolution.Interval()
+	if interval == 0 {
+		return []statsPart{{start, end, ResolutionRaw}}
+	}
+	alignedStart := BucketStart(start.Add(interval-time.Nanosecond), interval)
+	alignedEnd := BucketStart(end, interval)
+	if !alignedStart.Before(alignedEnd) {
+		return []statsPart{{start, end, ResolutionRaw}}
+	}
+	parts := []statsPart{}
+	if start.Before(alignedStart) {
+		parts = append(parts, statsPart{start, alignedStart, ResolutionRaw})
+	}
+	parts = append(parts, statsPart{alignedStart, alignedEnd, resolution})
+	if alignedEnd.Before(end) {
+		parts = append(parts, statsPart{alignedEnd, end, ResolutionRaw})
+	}
+	return parts
+}
+
+// GetDatastreamStats summarises the measurements of a datastream in a time range without returning them
+func (s *Service) GetDatastreamStats(ctx context.Context, id uuid.UUID, opts StatsOptions) (*DatastreamStats, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.resolve(time.Now()); err != nil {
+		return nil, err
+	}
+	// Ensures the datastream exists and belongs to this tenant
+	if _, err := s.store.GetDatastream(ctx, id, DatastreamFilter{TenantID: []int64{tenantID}}); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.datastreamStats(ctx, []uuid.UUID{id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &stats[0], nil
+}
+
+// ListDatastreamsWithStats lists datastreams like ListDatastreams, including the statistics of every datastream
+func (s *Service) ListDatastreamsWithStats(
+	ctx context.Context,
+	filter DatastreamFilter,
+	opts StatsOptions,
+	r pagination.Request,
+) (*pagination.Page[Datastream], error) {
+	if err := opts.resolve(time.Now()); err != nil {
+		return nil, err
+	}
+	page, err := s.ListDatastreams(ctx, filter, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Data) == 0 {
+		return page, nil
+	}
+
+	stats, err := s.datastreamStats(ctx, lo.Map(page.Data, func(ds Datastream, _ int) uuid.UUID { return ds.ID }), opts)
+	if err != nil {
+		return nil, err
+	}
+	for ix := range page.Data {
+		page.Data[ix].Stats = &stats[ix]
+	}
+	return page, nil
+}
+
+// datastreamStats calculates the statistics of the datastreams in the same order. First the value summaries of
+// every part of the time range are merged, after which the histogram range is known and the histogram buckets
+// can be counted.
+func (s *Service) datastreamStats(ctx context.Context, ids []uuid.UUID, opts StatsOptions) ([]DatastreamStats, error) {
+	parts := statsParts(opts.Start, opts.End, opts.Resolution)
+	summaries := make(map[uuid.UUID]ValueSummary, len(ids))
+	for _, part := range parts {
+		list, err := s.store.SummarizeValues(ctx, ids, part.start, part.end, part.resolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, summary := range list {
+			summaries[summary.DatastreamID] = summaries[summary.DatastreamID].merge(summary)
+		}
+	}
+
+	stats := make([]DatastreamStats, len(ids))
+	histogramRanges := []HistogramRange{}
+	for ix, id := range ids {
+		summary := summaries[id]
+		stats[ix] = newDatastreamStats(id, opts, summary)
+		// A histogram of identical values has a single bucket containing all of them
+		if summary.Count > 0 && summary.Min == summary.Max {
+			stats[ix].Histogram = []HistogramBucket{{Lower: summary.Min, Upper: summary.Max, Count: summary.Count}}
+		}
+		if summary.Count > 0 && summary.Min < summary.Max {
+			histogramRanges = append(histogramRanges, HistogramRange{
+				DatastreamID: id, Min: summary.Min, Max: summary.Max, Buckets: opts.Buckets,
+			})
+		}
+	}
+	if len(histogramRanges) == 0 {
+		return stats, nil
+	}
+
+	counts := make(map[uuid.UUID][]int64, len(histogramRanges))
+	for _, hr := range histogramRanges {
+		counts[hr.DatastreamID] = make([]int64, hr.Buckets)
+	}
+	for _, part := range parts {
+		list, err := s.store.CountHistogram(ctx, histogramRanges, part.start, part.end, part.resolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, count := range list {
+			if buckets, ok := counts[count.DatastreamID]; ok && count.Bucket >= 0 && count.Bucket < len(buckets) {
+				buckets[count.Bucket] += count.Count
+			}
+		}
+	}
+	for ix := range stats {
+		buckets, ok := counts[stats[ix].DatastreamID]
+		if !ok {
+			continue
+		}
+		width := (*stats[ix].Max - *stats[ix].Min) / float64(len(buckets))
+		for bucket, count := range buckets {
+			stats[ix].Histogram = append(stats[ix].Histogram, HistogramBucket{
+				Lower: *stats[ix].Min + float64(bucket)*width,
+				Upper: *stats[ix].Min + float64(bucket+1)*width,
+				Count: count,
+			})
+		}
+	}
+	return stats, nil
+}
+
+func newDatastreamStats(id uuid.UUID, opts StatsOptions, summary ValueSummary) DatastreamStats {
+	stats := DatastreamStats{
+		DatastreamID: id,
+		Start:        opts.Start,
+		End:          opts.End,
+		Resolution:   opts.Resolution,
+		Count:        summary.Count,
+		Histogram:    []HistogramBucket{},
+	}
+	if summary.Count == 0 {
+		return stats
+	}
+	n := float64(summary.Count)
+	stats.Min = &summary.Min
+	stats.Max = &summary.Max
+	stats.Mean = lo.ToPtr(summary.Sum / n)
+	stats.FirstTimestamp = &summary.First
+	stats.LastTimestamp = &summary.Last
+	if summary.SumSquares != nil && summary.Count > 1 {
+		// Rounding can make the variance of nearly identical values slightly negative
+		variance := math.Max(0, (*summary.SumSquares-summary.Sum*summary.Sum/n)/(n-1))
+		stats.StdDev = lo.ToPtr(math.Sqrt(variance))
+	}
+	return stats
+}
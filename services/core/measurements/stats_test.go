@@ -0,0 +1,129 @@
+package measurements_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestGetDatastreamStatsShouldCombineRollupsWithRawEdges(t *testing.T) {
+	id := uuid.New()
+	start := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	end := time.Date(2024, 1, 4, 8, 15, 0, 0, time.UTC)
+	alignedStart := time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+	alignedEnd := time.Date(2024, 1, 4, 8, 0, 0, 0, time.UTC)
+
+	// Values 1 and 2 before the rollups, 3 and 4 in the rollups and 6 after the rollups
+	summaries := map[measurements.Resolution][]measurements.ValueSummary{
+		measurements.ResolutionRaw: {{
+			DatastreamID: id, Count: 2, Sum: 3, SumSquares: ptr(5.0), Min: 1, Max: 2,
+			First: start.Add(time.Minute), Last: start.Add(2 * time.Minute),
+		}},
+		measurements.ResolutionHourly: {{
+			DatastreamID: id, Count: 2, Sum: 7, SumSquares: ptr(25.0), Min: 3, Max: 4,
+			First: alignedStart, Last: alignedEnd.Add(-time.Hour),
+		}},
+	}
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, datastreamID uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: datastreamID}, nil
+		},
+		SummarizeValuesFunc: func(ctx context.Context, datastreamIDs []uuid.UUID, from, to time.Time, resolution measurements.Resolution) ([]measurements.ValueSummary, error) {
+			if from.Equal(alignedEnd) {
+				return []measurements.ValueSummary{{
+					DatastreamID: id, Count: 1, Sum: 6, SumSquares: ptr(36.0), Min: 6, Max: 6,
+					First: end.Add(-time.Minute), Last: end.Add(-time.Minute),
+				}}, nil
+			}
+			return summaries[resolution], nil
+		},
+		CountHistogramFunc: func(ctx context.Context, ranges []measurements.HistogramRange, from, to time.Time, resolution measurements.Resolution) ([]measurements.HistogramCount, error) {
+			switch {
+			case resolution == measurements.ResolutionHourly:
+				return []measurements.HistogramCount{{DatastreamID: id, Bucket: 2, Count: 1}, {DatastreamID: id, Bucket: 3, Count: 1}}, nil
+			case from.Equal(start):
+				return []measurements.HistogramCount{{DatastreamID: id, Bucket: 0, Count: 2}}, nil
+			}
+			return []measurements.HistogramCount{{DatastreamID: id, Bucket: 4, Count: 1}}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil)
+
+	stats, err := svc.GetDatastreamStats(authtest.GodContext(), id, measurements.StatsOptions{Start: start, End: end, Buckets: 5})
+	require.NoError(t, err)
+
+	require.Len(t, store.SummarizeValuesCalls(), 3)
+	assert.Equal(t, measurements.ResolutionRaw, store.SummarizeValuesCalls()[0].Resolution)
+	assert.Equal(t, alignedStart, store.SummarizeValuesCalls()[0].End)
+	assert.Equal(t, measurements.ResolutionHourly, store.SummarizeValuesCalls()[1].Resolution)
+	assert.Equal(t, alignedStart, store.SummarizeValuesCalls()[1].Start)
+	assert.Equal(t, alignedEnd, store.SummarizeValuesCalls()[1].End)
+	assert.Equal(t, measurements.ResolutionRaw, store.SummarizeValuesCalls()[2].Resolution)
+
+	assert.Equal(t, measurements.ResolutionHourly, stats.Resolution)
+	assert.Equal(t, int64(5), stats.Count)
+	assert.Equal(t, 1.0, *stats.Min)
+	assert.Equal(t, 6.0, *stats.Max)
+	assert.Equal(t, 3.2, *stats.Mean)
+	assert.InDelta(t, math.Sqrt(3.7), *stats.StdDev, 1e-9)
+	assert.Equal(t, start.Add(time.Minute), *stats.FirstTimestamp)
+	assert.Equal(t, end.Add(-time.Minute), *stats.LastTimestamp)
+
+	require.Len(t, store.CountHistogramCalls(), 3)
+	assert.Equal(t, []measurements.HistogramRange{{DatastreamID: id, Min: 1, Max: 6, Buckets: 5}}, store.CountHistogramCalls()[0].Ranges)
+	assert.Equal(t, []measurements.HistogramBucket{
+		{Lower: 1, Upper: 2, Count: 2},
+		{Lower: 2, Upper: 3, Count: 0},
+		{Lower: 3, Upper: 4, Count: 1},
+		{Lower: 4, Upper: 5, Count: 1},
+		{Lower: 5, Upper: 6, Count: 1},
+	}, stats.Histogram)
+}
+
+func TestGetDatastreamStatsShouldHandleMissingAndIdenticalValues(t *testing.T) {
+	id := uuid.New()
+	end := time.Now()
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, datastreamID uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &measurements.Datastream{ID: datastreamID}, nil
+		},
+		SummarizeValuesFunc: func(ctx context.Context, datastreamIDs []uuid.UUID, from, to time.Time, resolution measurements.Resolution) ([]measurements.ValueSummary, error) {
+			return []measurements.ValueSummary{}, nil
+		},
+	}
+	svc := measurements.New(store, 30, 1, authtest.JWKS(), nil)
+
+	stats, err := svc.GetDatastreamStats(authtest.GodContext(), id, measurements.StatsOptions{End: end})
+	require.NoError(t, err)
+	assert.Equal(t, measurements.ResolutionHourly, stats.Resolution, "a week uses the hourly rollups")
+	assert.Equal(t, end.Add(-measurements.DefaultStatsRange), stats.Start)
+	assert.Equal(t, int64(0), stats.Count)
+	assert.Nil(t, stats.Mean)
+	assert.Empty(t, stats.Histogram)
+	assert.Empty(t, store.CountHistogramCalls())
+
+	// Rollups without sum of squares leave the standard deviation unknown
+	store.SummarizeValuesFunc = func(ctx context.Context, datastreamIDs []uuid.UUID, from, to time.Time, resolution measurements.Resolution) ([]measurements.ValueSummary, error) {
+		return []measurements.ValueSummary{{DatastreamID: id, Count: 4, Sum: 8, Min: 2, Max: 2, First: from, Last: from}}, nil
+	}
+	stats, err = svc.GetDatastreamStats(authtest.GodContext(), id, measurements.StatsOptions{
+		End: end, Resolution: measurements.ResolutionRaw,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, stats.StdDev)
+	assert.Equal(t, []measurements.HistogramBucket{{Lower: 2, Upper: 2, Count: 4}}, stats.Histogram)
+	assert.Empty(t, store.CountHistogramCalls())
+
+	_, err = svc.GetDatastreamStats(authtest.GodContext(), id, measurements.StatsOptions{End: end, Buckets: 1000})
+	assert.ErrorIs(t, err, measurements.ErrHistogramBucketsInvalid)
+	_, err = svc.GetDatastreamStats(authtest.GodContext(), id, measurements.StatsOptions{Start: end, End: end})
+	assert.ErrorIs(t, err, measurements.ErrStatsRangeInvalid)
+}
@@ -0,0 +1,165 @@
+package measurements
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+// SubscriptionBufferSize is the amount of measurements buffered for a subscriber. A subscriber that falls
+// further behind is ended, such that a slow consumer never delays storing measurements.
+const SubscriptionBufferSize = 1000
+
+// SubscriptionFilter selects the measurements of a subscription, a measurement must match every given filter
+type SubscriptionFilter struct {
+	Datastream       []uuid.UUID `url:"datastream"`
+	DeviceID         []int64     `url:"device_id"`
+	SensorGroup      []int64     `url:"sensor_group"`
+	ObservedProperty []string    `url:"observed_property"`
+}
+
+// SubscribeMeasurements returns a channel receiving the measurements matching the filter as they are stored.
+// Sensor groups are resolved when subscribing, changes to a group apply to new subscriptions. The channel is
+// closed when the context is done or when the subscriber falls behind more than SubscriptionBufferSize measurements.
+//
+// Only measurements committed by this instance are received.
+func (s *Service) SubscribeMeasurements(ctx context.Context, filter SubscriptionFilter) (<-chan Measurement, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscriber{
+		tenantID:         tenantID,
+		datastreams:      toSet(filter.Datastream),
+		devices:          toSet(filter.DeviceID),
+		observedProperty: toSet(filter.ObservedProperty),
+		ch:               make(chan Measurement, SubscriptionBufferSize),
+	}
+	if len(filter.SensorGroup) > 0 {
+		sensors, err := s.store.ListSensorGroupSensors(ctx, tenantID, filter.SensorGroup)
+		if err != nil {
+			return nil, err
+		}
+		// Groups without sensors match nothing instead of everything
+		sub.sensors = toSet(sensors)
+		if sub.sensors == nil {
+			sub.sensors = map[int64]struct{}{}
+		}
+	}
+
+	s.broker.subscribe(sub)
+	go func() {
+		<-ctx.Done()
+		s.broker.unsubscribe(sub)
+	}()
+	return sub.ch, nil
+}
+
+// MeasurementListener is informed of every committed batch of measurements of all tenants. Unlike a
+// subscription it is called while storing measurements, so MeasurementsCommitted must not block.
+type MeasurementListener interface {
+	MeasurementsCommitted([]Measurement)
+}
+
+// WithMeasurementListener adds a listener for committed measurements
+func (s *Service) WithMeasurementListener(listener MeasurementListener) *Service {
+	s.listeners = append(s.listeners, listener)
+	return s
+}
+
+type subscriber struct {
+	tenantID int64
+	// A nil set matches any value
+	datastreams      map[uuid.UUID]struct{}
+	devices          map[int64]struct{}
+	sensors          map[int64]struct{}
+	observedProperty map[string]struct{}
+	ch               chan Measurement
+}
+
+func toSet[T comparable](values []T) map[T]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[T]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
+func inSet[T comparable](set map[T]struct{}, v T) bool {
+	if set == nil {
+		return true
+	}
+	_, ok := set[v]
+	return ok
+}
+
+func (sub *subscriber) matches(m Measurement) bool {
+	return m.OrganisationID == int(sub.tenantID) &&
+		inSet(sub.datastreams, m.DatastreamID) &&
+		inSet(sub.devices, m.DeviceID) &&
+		inSet(sub.sensors, m.SensorID) &&
+		inSet(sub.observedProperty, m.DatastreamObservedProperty)
+}
+
+func (sub *subscriber) send(m Measurement) bool {
+	select {
+	case sub.ch <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// measurementBroker delivers committed measurements to the subscribers
+type measurementBroker struct {
+	lock        sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+func newMeasurementBroker() *measurementBroker {
+	return &measurementBroker{subscribers: map[*subscriber]struct{}{}}
+}
+
+func (b *measurementBroker) subscribe(sub *subscriber) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.subscribers[sub] = struct{}{}
+}
+
+func (b *measurementBroker) unsubscribe(sub *subscriber) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.remove(sub)
+}
+
+func (b *measurementBroker) remove(sub *subscriber) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+// publish never blocks, subscribers without room in their buffer are removed
+func (b *measurementBroker) publish(list []Measurement) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for sub := range b.subscribers {
+		for _, m := range list {
+			if sub.matches(m) && !sub.send(m) {
+				b.remove(sub)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package measurements_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func newSubscriptionService(ds measurements.Datastream, groupSensors []int64) (*measurements.Service, *StoreMock) {
+	store := &StoreMock{
+		GetDatastreamFunc: func(ctx context.Context, id uuid.UUID, filter measurements.DatastreamFilter) (*measurements.Datastream, error) {
+			return &ds, nil
+		},
+		ListRecentSamplesFunc: func(ctx context.Context, datastreamID uuid.UUID, before time.Time, limit int) ([]measurements.Sample, error) {
+			return nil, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc:      storeAll,
+		ListSensorGroupSensorsFunc: func(ctx context.Context, tenantID int64, groupIDs []int64) ([]int64, error) {
+			return groupSensors, nil
+		},
+	}
+	deviceStore := &DeviceStoreMock{
+		ListFunc: func(ctx context.Context, filter devices.DeviceFilter, request pagination.Request) (*pagination.Page[devices.Device], error) {
+			return &pagination.Page[devices.Device]{Data: []devices.Device{newIngestionDevice()}}, nil
+		},
+	}
+	return measurements.New(store, 30, 1, authtest.JWKS(), deviceStore), store
+}
+
+func TestSubscribeMeasurementsShouldReceiveMatchingMeasurements(t *testing.T) {
+	ds := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "water_level", UnitOfMeasurement: "m"}
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		desc     string
+		ctx      context.Context
+		filter   measurements.SubscriptionFilter
+		groups   []int64
+		received bool
+	}{
+		{
+			desc:     "no filter",
+			ctx:      authtest.GodContext(),
+			received: true,
+		},
+		{
+			desc:     "matching datastream and device",
+			ctx:      authtest.GodContext(),
+			filter:   measurements.SubscriptionFilter{Datastream: []uuid.UUID{ds.ID}, DeviceID: []int64{1, 2}},
+			received: true,
+		},
+		{
+			desc:   "other datastream",
+			ctx:    authtest.GodContext(),
+			filter: measurements.SubscriptionFilter{Datastream: []uuid.UUID{uuid.New()}},
+		},
+		{
+			desc:   "other observed property",
+			ctx:    authtest.GodContext(),
+			filter: measurements.SubscriptionFilter{ObservedProperty: []string{"temperature"}},
+		},
+		{
+			desc:     "sensor group with sensor",
+			ctx:      authtest.GodContext(),
+			filter:   measurements.SubscriptionFilter{SensorGroup: []int64{3}},
+			groups:   []int64{11, 12},
+			received: true,
+		},
+		{
+			desc:   "empty sensor group",
+			ctx:    authtest.GodContext(),
+			filter: measurements.SubscriptionFilter{SensorGroup: []int64{3}},
+		},
+		{
+			desc: "other tenant",
+			ctx: auth.CreateAuthenticatedContextForTESTING(
+				context.Background(), authtest.DefaultSub, authtest.DefaultTenantID+1, auth.AllPermissions(),
+			),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			svc, _ := newSubscriptionService(ds, tC.groups)
+			ctx, cancel := context.WithCancel(tC.ctx)
+			defer cancel()
+			stream, err := svc.SubscribeMeasurements(ctx, tC.filter)
+			require.NoError(t, err)
+
+			_, err = svc.AddDatastreamMeasurements(authtest.GodContext(), ds.ID, []measurements.NewMeasurement{
+				{Timestamp: timestamp, Value: 1.25},
+			})
+			require.NoError(t, err)
+
+			if !tC.received {
+				assert.Empty(t, stream)
+				return
+			}
+			require.Len(t, stream, 1)
+			m := <-stream
+			assert.Equal(t, ds.ID, m.DatastreamID)
+			assert.Equal(t, 1.25, m.MeasurementValue)
+		})
+	}
+}
+
+func TestSubscribeMeasurementsShouldCloseWhenContextIsDone(t *testing.T) {
+	svc, _ := newSubscriptionService(measurements.Datastream{ID: uuid.New()}, nil)
+	ctx, cancel := context.WithCancel(authtest.GodContext())
+	stream, err := svc.SubscribeMeasurements(ctx, measurements.SubscriptionFilter{})
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case _, ok := <-stream:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("stream was not closed")
+	}
+}
+
+type listenerFunc func([]measurements.Measurement)
+
+func (fn listenerFunc) MeasurementsCommitted(batch []measurements.Measurement) { fn(batch) }
+
+func TestMeasurementListenerShouldReceiveCommittedMeasurements(t *testing.T) {
+	ds := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "water_level", UnitOfMeasurement: "m"}
+	svc, _ := newSubscriptionService(ds, nil)
+	var received []measurements.Measurement
+	svc.WithMeasurementListener(listenerFunc(func(batch []measurements.Measurement) {
+		received = append(received, batch...)
+	}))
+
+	_, err := svc.AddDatastreamMeasurements(authtest.GodContext(), ds.ID, []measurements.NewMeasurement{
+		{Timestamp: time.Now(), Value: 1},
+		{Timestamp: time.Now(), Value: 2},
+	})
+	require.NoError(t, err)
+	require.Len(t, received, 2)
+	assert.Equal(t, ds.ID, received[0].DatastreamID)
+}
+
+func TestMeasurementListenerShouldNotReceiveIgnoredMeasurements(t *testing.T) {
+	ds := measurements.Datastream{ID: uuid.New(), SensorID: 12, ObservedProperty: "water_level", UnitOfMeasurement: "m"}
+	svc, store := newSubscriptionService(ds, nil)
+	// Only the second measurement is new, the first one was stored before
+	store.StoreMeasurementsFunc = func(ctx context.Context, list []measurements.Measurement) error {
+		list[1].ID = 2
+		return nil
+	}
+	var received []measurements.Measurement
+	svc.WithMeasurementListener(listenerFunc(func(batch []measurements.Measurement) {
+		received = append(received, batch...)
+	}))
+
+	_, err := svc.AddDatastreamMeasurements(authtest.GodContext(), ds.ID, []measurements.NewMeasurement{
+		{Timestamp: time.Now(), Value: 1},
+		{Timestamp: time.Now(), Value: 2},
+	})
+	require.NoError(t, err)
+	require.Len(t, received, 1)
+	assert.Equal(t, 2.0, received[0].MeasurementValue)
+}
@@ -2,6 +2,7 @@ package measurements
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/rabbitmq/amqp091-go"
@@ -18,30 +19,39 @@ type StorageError struct {
 	Error     string `json:"error"`
 }
 
+// MQMessageProcessor processes pipeline messages from the message queue. A delivery is only acknowledged
+// after its measurements are committed. If committing failed, the delivery is requeued once before
+// being reported as a storage error. Other errors will not resolve by retrying and are reported immediately.
 func MQMessageProcessor(svc *Service, publisher StorageErrorPublisher) mq.ProcessorFuncBuilder {
 	return func() mq.ProcessorFunc {
-		var msg pipeline.Message
 		return func(delivery amqp091.Delivery) error {
-			go func(msg pipeline.Message) {
-				if err := json.Unmarshal(delivery.Body, &msg); err != nil {
-					err = fmt.Errorf("%w: could not unmarshal delivery body as Pipeline Message: %w", mq.ErrMalformed, err)
-					publisher <- &StorageError{
-						TracingID: delivery.MessageId,
-						Body:      delivery.Body,
-						Error:     err.Error(),
-					}
-					return
-				}
-				if err := svc.ProcessPipelineMessage(msg); err != nil {
-					publisher <- &StorageError{
-						TracingID: delivery.MessageId,
-						Body:      delivery.Body,
-						Error:     err.Error(),
-					}
-					return
+			var msg pipeline.Message
+			if err := json.Unmarshal(delivery.Body, &msg); err != nil {
+				err = fmt.Errorf("%w: could not unmarshal delivery body as Pipeline Message: %w", mq.ErrMalformed, err)
+				publishStorageError(publisher, delivery, err)
+				return err
+			}
+
+			err := svc.ProcessPipelineMessage(msg)
+			if err == nil {
+				return nil
+			}
+			if errors.Is(err, ErrMeasurementsNotCommitted) {
+				if delivery.Redelivered {
+					publishStorageError(publisher, delivery, err)
 				}
-			}(msg)
+				return err
+			}
+			publishStorageError(publisher, delivery, err)
 			return nil
 		}
 	}
 }
+
+func publishStorageError(publisher StorageErrorPublisher, delivery amqp091.Delivery, err error) {
+	publisher <- &StorageError{
+		TracingID: delivery.MessageId,
+		Body:      delivery.Body,
+		Error:     err.Error(),
+	}
+}
@@ -0,0 +1,81 @@
+package measurements_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/pkg/mq"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestMQMessageProcessor(t *testing.T) {
+	validBody, err := json.Marshal(newStorableMessage(t, 1))
+	require.NoError(t, err)
+	noDeviceMessage := newStorableMessage(t)
+	noDeviceMessage.Device = nil
+	noDeviceBody, err := json.Marshal(noDeviceMessage)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		desc          string
+		body          []byte
+		redelivered   bool
+		storeErr      error
+		expectedErr   error
+		expectPublish bool
+	}{
+		{
+			desc: "stored message is acked",
+			body: validBody,
+		},
+		{
+			desc:          "malformed message is rejected and reported",
+			body:          []byte("{not json"),
+			expectedErr:   mq.ErrMalformed,
+			expectPublish: true,
+		},
+		{
+			desc:          "invalid message is acked and reported",
+			body:          noDeviceBody,
+			expectPublish: true,
+		},
+		{
+			desc:        "uncommitted message is requeued",
+			body:        validBody,
+			storeErr:    errors.New("database error"),
+			expectedErr: measurements.ErrMeasurementsNotCommitted,
+		},
+		{
+			desc:          "uncommitted redelivered message is reported",
+			body:          validBody,
+			redelivered:   true,
+			storeErr:      errors.New("database error"),
+			expectedErr:   measurements.ErrMeasurementsNotCommitted,
+			expectPublish: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store := newBatchTestStore(func([]measurements.Measurement) error { return tC.storeErr })
+			svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+			publisher := make(chan *measurements.StorageError, 1)
+			process := measurements.MQMessageProcessor(svc, publisher)()
+
+			err := process(amqp091.Delivery{Body: tC.body, Redelivered: tC.redelivered})
+
+			if tC.expectedErr != nil {
+				assert.ErrorIs(t, err, tC.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tC.expectPublish, len(publisher) == 1, "storage error published")
+		})
+	}
+}
+
@@ -0,0 +1,560 @@
+package measurements
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+var ErrUnitIncompatible = web.NewError(http.StatusBadRequest, "Units of measurement can not be converted into each other", "ERR_UNIT_INCOMPATIBLE")
+
+// unitAliases maps commonly used, but non UCUM, notations to their UCUM code.
+// Note that "C" and "F" are the UCUM codes for coulomb and farad, but sensors report those units so rarely that
+// both are taken to mean degrees Celsius and Fahrenheit. Farad must be written with a prefix, such as "uF".
+// Existing datastreams are canonicalised with the same aliases by migration 20250410090000, a test verifies both match.
+var unitAliases = map[string]string{
+	"":           "1",
+	"C":          "Cel",
+	"°C":         "Cel",
+	"degC":       "Cel",
+	"deg C":      "Cel",
+	"celsius":    "Cel",
+	"Celsius":    "Cel",
+	"F":          "[degF]",
+	"°F":         "[degF]",
+	"degF":       "[degF]",
+	"deg F":      "[degF]",
+	"fahrenheit": "[degF]",
+	"Fahrenheit": "[degF]",
+	"°":          "deg",
+	"percent":    "%",
+	"ppm":        "[ppm]",
+	"ppb":        "[ppb]",
+	"dBm":        "dB[mW]",
+	"lux":        "lx",
+	"Wh":         "W.h",
+	"kWh":        "kW.h",
+	"knots":      "[kn_i]",
+	"kn":         "[kn_i]",
+	"kt":         "[kn_i]",
+	"psi":        "[psi]",
+	"in":         "[in_i]",
+	"inch":       "[in_i]",
+	"ft":         "[ft_i]",
+	"mi":         "[mi_i]",
+	"mph":        "[mi_i]/h",
+	"kph":        "km/h",
+	"rpm":        "{rev}/min",
+	"#":          "{count}",
+	"count":      "{count}",
+}
+
+// unitCharacterReplacer replaces characters that are often used in units but are not valid UCUM
+var unitCharacterReplacer = strings.NewReplacer(
+	"µ", "u", // micro sign
+	"μ", "u", // greek small letter mu
+	"²", "2",
+	"³", "3",
+	"·", ".",
+)
+
+// CanonicalUnit validates the unit of measurement against UCUM and returns its canonical notation.
+// Common alternative notations, such as "°C" or "degC", are converted to their UCUM code, "Cel".
+func CanonicalUnit(uom string) (string, error) {
+	uom = unitCharacterReplacer.Replace(strings.TrimSpace(uom))
+	if alias, ok := unitAliases[uom]; ok {
+		uom = alias
+	}
+	if _, err := parseUnit(uom); err != nil {
+		return "", err
+	}
+	return uom, nil
+}
+
+// UnitConverter converts values from one unit to another. Conversions between UCUM units are
+// always linear, optionally with an offset for temperature scales such as Cel and [degF].
+type UnitConverter struct {
+	Scale  float64
+	Offset float64
+}
+
+func (c UnitConverter) Convert(value float64) float64 {
+	return value*c.Scale + c.Offset
+}
+
+// NewUnitConverter creates a converter from one unit to another, the units must measure the same dimension.
+func NewUnitConverter(from, to string) (UnitConverter, error) {
+	from, err := CanonicalUnit(from)
+	if err != nil {
+		return UnitConverter{}, err
+	}
+	to, err = CanonicalUnit(to)
+	if err != nil {
+		return UnitConverter{}, err
+	}
+	fromUnit, _ := parseUnit(from)
+	toUnit, _ := parseUnit(to)
+	if fromUnit.dimension != toUnit.dimension || fromUnit.kind != toUnit.kind {
+		return UnitConverter{}, fmt.Errorf("%w: %s to %s", ErrUnitIncompatible, from, to)
+	}
+	return UnitConverter{
+		Scale:  fromUnit.factor / toUnit.factor,
+		Offset: (fromUnit.offset - toUnit.offset) / toUnit.factor,
+	}, nil
+}
+
+// measurementConverter converts measurement values to a single unit, regardless of the unit of
+// their datastream. Converters are cached per datastream unit.
+type measurementConverter struct {
+	unit       string
+	converters map[string]UnitConverter
+}
+
+// newMeasurementConverter returns nil if no unit is given, in which case measurements are not converted
+func newMeasurementConverter(unit string) (*measurementConverter, error) {
+	if unit == "" {
+		return nil, nil
+	}
+	unit, err := CanonicalUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+	return &measurementConverter{
+		unit:       unit,
+		converters: map[string]UnitConverter{},
+	}, nil
+}
+
+func (c *measurementConverter) convert(m *Measurement) error {
+	if c == nil {
+		return nil
+	}
+	converter, ok := c.converters[m.DatastreamUnitOfMeasurement]
+	if !ok {
+		var err error
+		converter, err = NewUnitConverter(m.DatastreamUnitOfMeasurement, c.unit)
+		if err != nil {
+			return err
+		}
+		c.converters[m.DatastreamUnitOfMeasurement] = converter
+	}
+	m.MeasurementValue = converter.Convert(m.MeasurementValue)
+	m.DatastreamUnitOfMeasurement = c.unit
+	return nil
+}
+
+// dimension holds the exponents of the UCUM base units: m, g, s, rad, K, C, cd
+type dimension [7]int
+
+const (
+	dimLength = iota
+	dimMass
+	dimTime
+	dimAngle
+	dimTemperature
+	dimCharge
+	dimLuminosity
+)
+
+// unit is a parsed unit expressed in base units, such that: base = value * factor + offset
+type unit struct {
+	factor    float64
+	offset    float64
+	dimension dimension
+	// kind distinguishes special units that are dimensionless but can not be converted
+	// to other dimensionless units, such as the logarithmic B[mW]
+	kind string
+}
+
+func (u unit) multiply(o unit, exponent int) unit {
+	u.factor *= math.Pow(o.factor, float64(exponent))
+	for ix := range u.dimension {
+		u.dimension[ix] += o.dimension[ix] * exponent
+	}
+	return u
+}
+
+var unity = unit{factor: 1}
+
+type atomDefinition struct {
+	metric bool
+	value  float64
+	// definition is the UCUM term this atom is defined in, empty for base units
+	definition string
+	base       int
+	// special units are not ratio scaled and may not be combined with other units
+	special bool
+	// offset in base units, such that: base = value * factor + offset
+	offset float64
+	kind   string
+}
+
+var unitAtoms = map[string]atomDefinition{
+	// Base units
+	"m":   {metric: true, base: dimLength},
+	"g":   {metric: true, base: dimMass},
+	"s":   {metric: true, base: dimTime},
+	"rad": {metric: true, base: dimAngle},
+	"K":   {metric: true, base: dimTemperature},
+	"C":   {metric: true, base: dimCharge},
+	"cd":  {metric: true, base: dimLuminosity},
+	// Dimensionless
+	"%":      {value: 1e-2, definition: "1"},
+	"[ppth]": {value: 1e-3, definition: "1"},
+	"[ppm]":  {value: 1e-6, definition: "1"},
+	"[ppb]":  {value: 1e-9, definition: "1"},
+	"[pptr]": {value: 1e-12, definition: "1"},
+	"mol":    {metric: true, value: 6.02214076e23, definition: "1"},
+	// SI derived units
+	"sr":  {metric: true, value: 1, definition: "rad2"},
+	"Hz":  {metric: true, value: 1, definition: "s-1"},
+	"N":   {metric: true, value: 1, definition: "kg.m/s2"},
+	"Pa":  {metric: true, value: 1, definition: "N/m2"},
+	"J":   {metric: true, value: 1, definition: "N.m"},
+	"W":   {metric: true, value: 1, definition: "J/s"},
+	"A":   {metric: true, value: 1, definition: "C/s"},
+	"V":   {metric: true, value: 1, definition: "J/C"},
+	"F":   {metric: true, value: 1, definition: "C/V"},
+	"Ohm": {metric: true, value: 1, definition: "V/A"},
+	"S":   {metric: true, value: 1, definition: "Ohm-1"},
+	"Wb":  {metric: true, value: 1, definition: "V.s"},
+	"T":   {metric: true, value: 1, definition: "Wb/m2"},
+	"H":   {metric: true, value: 1, definition: "Wb/A"},
+	"lm":  {metric: true, value: 1, definition: "cd.sr"},
+	"lx":  {metric: true, value: 1, definition: "lm/m2"},
+	"Bq":  {metric: true, value: 1, definition: "s-1"},
+	"Gy":  {metric: true, value: 1, definition: "J/kg"},
+	"Sv":  {metric: true, value: 1, definition: "J/kg"},
+	"Cel": {metric: true, value: 1, definition: "K", special: true, offset: 273.15},
+	// Other metric units
+	"l":      {metric: true, value: 1, definition: "dm3"},
+	"L":      {metric: true, value: 1, definition: "l"},
+	"t":      {metric: true, value: 1e3, definition: "kg"},
+	"bar":    {metric: true, value: 1e5, definition: "Pa"},
+	"eV":     {metric: true, value: 1.602176634e-19, definition: "J"},
+	"m[Hg]":  {metric: true, value: 133.3220, definition: "kPa"},
+	"m[H2O]": {metric: true, value: 9.80665, definition: "kPa"},
+	// Time and angle
+	"min": {value: 60, definition: "s"},
+	"h":   {value: 60, definition: "min"},
+	"d":   {value: 24, definition: "h"},
+	"wk":  {value: 7, definition: "d"},
+	"a":   {value: 365.25, definition: "d"},
+	"mo":  {value: 1.0 / 12, definition: "a"},
+	"deg": {value: math.Pi / 180, definition: "rad"},
+	"'":   {value: 1.0 / 60, definition: "deg"},
+	"''":  {value: 1.0 / 60, definition: "'"},
+	// Other non-metric units
+	"atm":      {value: 101325, definition: "Pa"},
+	"[g]":      {value: 9.80665, definition: "m/s2"},
+	"[in_i]":   {value: 2.54, definition: "cm"},
+	"[ft_i]":   {value: 12, definition: "[in_i]"},
+	"[yd_i]":   {value: 3, definition: "[ft_i]"},
+	"[mi_i]":   {value: 5280, definition: "[ft_i]"},
+	"[nmi_i]":  {value: 1852, definition: "m"},
+	"[kn_i]":   {value: 1, definition: "[nmi_i]/h"},
+	"[lb_av]":  {value: 453.59237, definition: "g"},
+	"[oz_av]":  {value: 1.0 / 16, definition: "[lb_av]"},
+	"[lbf_av]": {value: 1, definition: "[lb_av].[g]"},
+	"[psi]":    {value: 1, definition: "[lbf_av]/[in_i]2"},
+	"[gal_us]": {value: 231, definition: "[in_i]3"},
+	"[degF]":   {value: 5.0 / 9, definition: "K", special: true, offset: 459.67 * 5.0 / 9},
+	// Logarithmic units, these can only be converted between prefixes of the same unit
+	"B":      {metric: true, value: 1, definition: "1", special: true, kind: "B"},
+	"B[W]":   {metric: true, value: 1, definition: "1", special: true, kind: "B[W]"},
+	"B[mW]":  {metric: true, value: 1, definition: "1", special: true, kind: "B[mW]"},
+	"B[kW]":  {metric: true, value: 1, definition: "1", special: true, kind: "B[kW]"},
+	"B[V]":   {metric: true, value: 1, definition: "1", special: true, kind: "B[V]"},
+	"B[mV]":  {metric: true, value: 1, definition: "1", special: true, kind: "B[mV]"},
+	"B[uV]":  {metric: true, value: 1, definition: "1", special: true, kind: "B[uV]"},
+	"B[SPL]": {metric: true, value: 1, definition: "1", special: true, kind: "B[SPL]"},
+	"[pH]":   {value: 1, definition: "1", special: true, kind: "[pH]"},
+}
+
+// unitPrefixes are sorted such that the two letter prefix "da" is tried before "d"
+var unitPrefixes = []struct {
+	symbol string
+	factor float64
+}{
+	{"da", 1e1}, {"Y", 1e24}, {"Z", 1e21}, {"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9}, {"M", 1e6},
+	{"k", 1e3}, {"h", 1e2}, {"d", 1e-1}, {"c", 1e-2}, {"m", 1e-3}, {"u", 1e-6}, {"n", 1e-9}, {"p", 1e-12},
+	{"f", 1e-15}, {"a", 1e-18}, {"z", 1e-21}, {"y", 1e-24},
+}
+
+// resolvedAtoms caches atoms expressed in base units, it is populated on init
+var resolvedAtoms = map[string]unit{}
+
+func init() {
+	for symbol := range unitAtoms {
+		if _, err := resolveAtom(symbol); err != nil {
+			panic(fmt.Sprintf("invalid UCUM atom definition for %q: %s", symbol, err))
+		}
+	}
+}
+
+func resolveAtom(symbol string) (unit, error) {
+	if u, ok := resolvedAtoms[symbol]; ok {
+		return u, nil
+	}
+	atom := unitAtoms[symbol]
+	var u unit
+	if atom.definition == "" {
+		u = unity
+		u.dimension[atom.base] = 1
+	} else {
+		def, err := parseUnit(atom.definition)
+		if err != nil {
+			return unit{}, err
+		}
+		u = def
+		u.factor *= atom.value
+	}
+	if atom.special {
+		u.offset = atom.offset
+		u.kind = atom.kind
+	}
+	resolvedAtoms[symbol] = u
+	return u, nil
+}
+
+func invalidUnit(uom, reason string) error {
+	return fmt.Errorf("%w: %q %s", ErrUoMInvalid, uom, reason)
+}
+
+// parseUnit parses a UCUM term into base units.
+// Terms are evaluated from left to right, so that "m/s.kg" equals "(m/s).kg"
+func parseUnit(uom string) (unit, error) {
+	p := unitParser{input: uom}
+	if uom == "" {
+		return unit{}, invalidUnit(uom, "is empty")
+	}
+	u, special, err := p.parseTerm(true)
+	if err != nil {
+		return unit{}, err
+	}
+	if p.pos != len(p.input) {
+		return unit{}, invalidUnit(uom, fmt.Sprintf("has unexpected character at position %d", p.pos))
+	}
+	if special && p.components > 1 {
+		return unit{}, invalidUnit(uom, "combines a special unit with other units")
+	}
+	return u, nil
+}
+
+type unitParser struct {
+	input      string
+	pos        int
+	components int
+}
+
+func (p *unitParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// parseTerm parses components separated by '.' or '/' and returns whether a special unit was found
+func (p *unitParser) parseTerm(allowLeadingDivision bool) (unit, bool, error) {
+	result := unity
+	special := false
+	operator := byte('.')
+	if allowLeadingDivision && p.peek() == '/' {
+		operator = '/'
+		p.pos++
+	}
+	for {
+		component, componentSpecial, err := p.parseComponent()
+		if err != nil {
+			return unit{}, false, err
+		}
+		p.components++
+		if componentSpecial {
+			special = true
+			if operator == '/' {
+				return unit{}, false, invalidUnit(p.input, "divides by a special unit")
+			}
+			result.factor *= component.factor
+			result.offset = component.offset
+			result.kind = component.kind
+			for ix := range result.dimension {
+				result.dimension[ix] += component.dimension[ix]
+			}
+		} else if operator == '/' {
+			result = result.multiply(component, -1)
+		} else {
+			result = result.multiply(component, 1)
+		}
+
+		switch p.peek() {
+		case '.', '/':
+			operator = p.peek()
+			p.pos++
+		default:
+			return result, special, nil
+		}
+	}
+}
+
+func (p *unitParser) parseComponent() (unit, bool, error) {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		u, special, err := p.parseTerm(false)
+		if err != nil {
+			return unit{}, false, err
+		}
+		if p.peek() != ')' {
+			return unit{}, false, invalidUnit(p.input, "has an unclosed parenthesis")
+		}
+		p.pos++
+		p.skipAnnotation()
+		return u, special, nil
+	case c == '{':
+		if err := p.parseAnnotation(); err != nil {
+			return unit{}, false, err
+		}
+		return unity, false, nil
+	case c >= '0' && c <= '9':
+		return p.parseFactor()
+	case c == 0, c == '.', c == '/', c == ')':
+		return unit{}, false, invalidUnit(p.input, fmt.Sprintf("is missing a unit at position %d", p.pos))
+	}
+
+	symbolStart := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c == '[' {
+			end := strings.IndexByte(p.input[p.pos:], ']')
+			if end < 0 {
+				return unit{}, false, invalidUnit(p.input, "has an unclosed bracket")
+			}
+			p.pos += end + 1
+			continue
+		}
+		if strings.IndexByte(".(){}/+-0123456789", c) >= 0 {
+			break
+		}
+		p.pos++
+	}
+	symbol := p.input[symbolStart:p.pos]
+	u, atom, err := lookupSymbol(symbol)
+	if err != nil {
+		return unit{}, false, invalidUnit(p.input, err.Error())
+	}
+	exponent, err := p.parseExponent()
+	if err != nil {
+		return unit{}, false, err
+	}
+	if atom.special && exponent != 1 {
+		return unit{}, false, invalidUnit(p.input, "raises a special unit to a power")
+	}
+	p.skipAnnotation()
+	if atom.special {
+		return u, true, nil
+	}
+	return unity.multiply(u, exponent), false, nil
+}
+
+// parseFactor parses a positive integer factor or the UCUM 10* and 10^ powers of ten
+func (p *unitParser) parseFactor() (unit, bool, error) {
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	digits := p.input[start:p.pos]
+	if c := p.peek(); c == '*' || c == '^' {
+		if digits != "10" {
+			return unit{}, false, invalidUnit(p.input, "has a power with a base other than 10")
+		}
+		p.pos++
+		exponent, err := p.parseExponent()
+		if err != nil {
+			return unit{}, false, err
+		}
+		p.skipAnnotation()
+		return unit{factor: math.Pow(10, float64(exponent))}, false, nil
+	}
+	value, err := strconv.ParseFloat(digits, 64)
+	if err != nil || value == 0 {
+		return unit{}, false, invalidUnit(p.input, "has an invalid factor")
+	}
+	p.skipAnnotation()
+	return unit{factor: value}, false, nil
+}
+
+// parseExponent parses an optional signed integer exponent, defaulting to 1
+func (p *unitParser) parseExponent() (int, error) {
+	start := p.pos
+	if c := p.peek(); c == '+' || c == '-' {
+		p.pos++
+	}
+	digitStart := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 1, nil
+	}
+	if p.pos == digitStart {
+		return 0, invalidUnit(p.input, "has a sign without exponent")
+	}
+	exponent, err := strconv.Atoi(p.input[start:p.pos])
+	if err != nil {
+		return 0, invalidUnit(p.input, "has an invalid exponent")
+	}
+	return exponent, nil
+}
+
+func (p *unitParser) parseAnnotation() error {
+	end := strings.IndexByte(p.input[p.pos:], '}')
+	if end < 0 {
+		return invalidUnit(p.input, "has an unclosed annotation")
+	}
+	annotation := p.input[p.pos+1 : p.pos+end]
+	if strings.ContainsAny(annotation, "{") {
+		return invalidUnit(p.input, "has a nested annotation")
+	}
+	p.pos += end + 1
+	return nil
+}
+
+func (p *unitParser) skipAnnotation() {
+	if p.peek() == '{' {
+		// An unclosed annotation is reported as unexpected character by the caller
+		_ = p.parseAnnotation()
+	}
+}
+
+// lookupSymbol finds the unit for an atom symbol, optionally preceded by a prefix
+func lookupSymbol(symbol string) (unit, atomDefinition, error) {
+	if atom, ok := unitAtoms[symbol]; ok {
+		u, err := resolveAtom(symbol)
+		return u, atom, err
+	}
+	for _, prefix := range unitPrefixes {
+		rest, ok := strings.CutPrefix(symbol, prefix.symbol)
+		if !ok {
+			continue
+		}
+		atom, ok := unitAtoms[rest]
+		if !ok || !atom.metric {
+			continue
+		}
+		u, err := resolveAtom(rest)
+		if err != nil {
+			return unit{}, atom, err
+		}
+		if atom.special && atom.offset != 0 {
+			return unit{}, atom, fmt.Errorf("has a prefix on unit %s which does not allow prefixes", rest)
+		}
+		u.factor *= prefix.factor
+		u.offset *= prefix.factor
+		return u, atom, nil
+	}
+	return unit{}, atomDefinition{}, fmt.Errorf("has unknown unit %q", symbol)
+}
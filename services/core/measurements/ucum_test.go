@@ -0,0 +1,210 @@
+package measurements_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/pkg/pipeline"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+func TestCanonicalUnit(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "Cel", expected: "Cel"},
+		{input: "C", expected: "Cel"},
+		{input: "degC", expected: "Cel"},
+		{input: "°C", expected: "Cel"},
+		{input: "°F", expected: "[degF]"},
+		{input: "F", expected: "[degF]"},
+		{input: "uF", expected: "uF"},
+		{input: "K", expected: "K"},
+		{input: "", expected: "1"},
+		{input: "1", expected: "1"},
+		{input: "%", expected: "%"},
+		{input: "ppm", expected: "[ppm]"},
+		{input: "µg/m³", expected: "ug/m3"},
+		{input: "ug/m3{PM2.5}", expected: "ug/m3{PM2.5}"},
+		{input: "kWh", expected: "kW.h"},
+		{input: "m/s2", expected: "m/s2"},
+		{input: "kg.m-2", expected: "kg.m-2"},
+		{input: "/min", expected: "/min"},
+		{input: "hPa", expected: "hPa"},
+		{input: "mm[Hg]", expected: "mm[Hg]"},
+		{input: "dBm", expected: "dB[mW]"},
+		{input: "10*3/uL", expected: "10*3/uL"},
+		{input: "{count}", expected: "{count}"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.input, func(t *testing.T) {
+			uom, err := measurements.CanonicalUnit(tC.input)
+			require.NoError(t, err)
+			assert.Equal(t, tC.expected, uom)
+		})
+	}
+}
+
+func TestCanonicalUnitShouldRejectInvalidUnits(t *testing.T) {
+	invalid := []string{
+		"Celsius degrees", "foo", "m//s", "m/", "kg.", "(m/s", "m{", "[in_i", "k[in_i]", "kmin",
+		"Cel.m", "Cel2", "mCel", "m^2", "m+", "(m/s)2",
+	}
+	for _, uom := range invalid {
+		t.Run(uom, func(t *testing.T) {
+			_, err := measurements.CanonicalUnit(uom)
+			assert.ErrorIs(t, err, measurements.ErrUoMInvalid)
+		})
+	}
+}
+
+func TestCanonicaliseUnitsMigrationShouldMatchUnitAliases(t *testing.T) {
+	migration, err := os.ReadFile("../migrations/20250410090000_canonicalise_datastream_units.up.sql")
+	require.NoError(t, err)
+
+	aliases := map[string]string{}
+	for _, match := range regexp.MustCompile(`(?m)^\s*\('([^']*)', '([^']*)'\)`).FindAllStringSubmatch(string(migration), -1) {
+		aliases[match[1]] = match[2]
+	}
+	assert.Equal(t, measurements.UnitAliases, aliases)
+
+	var replacements []string
+	for _, match := range regexp.MustCompile(`, '([^']+)', '([^']+)'\s*\)`).FindAllStringSubmatch(string(migration), -1) {
+		replacements = append(replacements, match[1], match[2])
+	}
+	require.NotEmpty(t, replacements)
+	replacer := strings.NewReplacer(replacements...)
+	for _, uom := range []string{"µm", "μm", "m²", "m³", "W·h", " uV "} {
+		canonical, err := measurements.CanonicalUnit(uom)
+		require.NoError(t, err)
+		assert.Equal(t, canonical, replacer.Replace(strings.TrimSpace(uom)), "unit %q", uom)
+	}
+}
+
+func TestUnitConverter(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		value    float64
+		expected float64
+	}{
+		{from: "Cel", to: "[degF]", value: 100, expected: 212},
+		{from: "Cel", to: "[degF]", value: -40, expected: -40},
+		{from: "[degF]", to: "Cel", value: 32, expected: 0},
+		{from: "Cel", to: "K", value: 0, expected: 273.15},
+		{from: "mm", to: "m", value: 1500, expected: 1.5},
+		{from: "km/h", to: "m/s", value: 36, expected: 10},
+		{from: "hPa", to: "bar", value: 1000, expected: 1},
+		{from: "kW.h", to: "J", value: 1, expected: 3.6e6},
+		{from: "%", to: "1", value: 50, expected: 0.5},
+		{from: "[ppm]", to: "[ppb]", value: 1, expected: 1000},
+		{from: "[in_i]", to: "cm", value: 1, expected: 2.54},
+		{from: "L", to: "m3", value: 1000, expected: 1},
+		{from: "dB[mW]", to: "B[mW]", value: 10, expected: 1},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.from+" to "+tC.to, func(t *testing.T) {
+			converter, err := measurements.NewUnitConverter(tC.from, tC.to)
+			require.NoError(t, err)
+			assert.InDelta(t, tC.expected, converter.Convert(tC.value), 1e-9)
+		})
+	}
+}
+
+func TestUnitConverterShouldRejectIncompatibleUnits(t *testing.T) {
+	testCases := []struct{ from, to string }{
+		{from: "Cel", to: "m"},
+		{from: "m", to: "m2"},
+		{from: "dB[mW]", to: "1"},
+		{from: "B[mW]", to: "B[V]"},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.from+" to "+tC.to, func(t *testing.T) {
+			_, err := measurements.NewUnitConverter(tC.from, tC.to)
+			assert.ErrorIs(t, err, measurements.ErrUnitIncompatible)
+		})
+	}
+}
+
+func TestShouldCanonicaliseUnitOnIngestion(t *testing.T) {
+	var units []string
+	store := &StoreMock{
+		FindOrCreateDatastreamFunc: func(ctx context.Context, tenantID, sensorID int64, observedProperty, UnitOfMeasurement string) (*measurements.Datastream, error) {
+			units = append(units, UnitOfMeasurement)
+			return &measurements.Datastream{ID: uuid.New(), UnitOfMeasurement: UnitOfMeasurement}, nil
+		},
+		ListDerivedDatastreamsFunc: noDerivedDatastreams,
+		StoreMeasurementsFunc: func(contextMoqParam context.Context, measurementsMoqParam []measurements.Measurement) error {
+			return nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+	msg := newPipelineMessage(uuid.NewString(), []string{})
+	msg.AccessToken = authtest.CreateToken()
+	msg.Device = &pipeline.Device{
+		ID:       1,
+		TenantID: authtest.DefaultTenantID,
+		Sensors: []devices.Sensor{
+			{ID: 1, Code: "sensor", ExternalID: "sensor", Properties: json.RawMessage("{}")},
+		},
+		Properties: json.RawMessage("{}"),
+	}
+	for _, uom := range []string{"C", "Cel", "degC", "not a unit"} {
+		require.NoError(t, msg.NewMeasurement().SetValue(1, "temperature", uom).SetSensor("sensor").Add())
+	}
+
+	err := svc.ProcessPipelineMessage(msg)
+
+	assert.ErrorIs(t, err, measurements.ErrUoMInvalid)
+	assert.Equal(t, []string{"Cel", "Cel", "Cel"}, units)
+	require.Len(t, store.calls.StoreMeasurements, 1)
+	assert.Len(t, store.calls.StoreMeasurements[0].MeasurementsMoqParam, 3, "valid measurements should still be stored")
+}
+
+func TestQueryMeasurementsShouldConvertUnit(t *testing.T) {
+	store := &StoreMock{
+		QueryFunc: func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+			return &pagination.Page[measurements.Measurement]{Data: []measurements.Measurement{
+				{MeasurementValue: 100, DatastreamUnitOfMeasurement: "Cel"},
+				{MeasurementValue: 32, DatastreamUnitOfMeasurement: "[degF]"},
+			}}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	page, err := svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{Unit: "degF"}, pagination.Request{})
+	require.NoError(t, err)
+
+	require.Len(t, page.Data, 2)
+	assert.InDelta(t, 212, page.Data[0].MeasurementValue, 1e-9)
+	assert.InDelta(t, 32, page.Data[1].MeasurementValue, 1e-9)
+	assert.Equal(t, "[degF]", page.Data[0].DatastreamUnitOfMeasurement)
+}
+
+func TestQueryMeasurementsShouldRejectIncompatibleUnit(t *testing.T) {
+	store := &StoreMock{
+		QueryFunc: func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+			return &pagination.Page[measurements.Measurement]{Data: []measurements.Measurement{
+				{MeasurementValue: 100, DatastreamUnitOfMeasurement: "Cel"},
+			}}, nil
+		},
+	}
+	svc := measurements.New(store, 0, 1, authtest.JWKS(), nil)
+
+	_, err := svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{Unit: "m"}, pagination.Request{})
+	assert.ErrorIs(t, err, measurements.ErrUnitIncompatible)
+
+	_, err = svc.QueryMeasurements(authtest.GodContext(), measurements.Filter{Unit: "foo"}, pagination.Request{})
+	assert.ErrorIs(t, err, measurements.ErrUoMInvalid)
+}
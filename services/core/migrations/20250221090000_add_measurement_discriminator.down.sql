@@ -0,0 +1 @@
+ALTER TABLE measurements DROP COLUMN measurement_discriminator;
@@ -0,0 +1 @@
+ALTER TABLE measurements ADD COLUMN measurement_discriminator TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE measurements
+  DROP COLUMN measurement_source,
+  DROP COLUMN measurement_submitted_by;
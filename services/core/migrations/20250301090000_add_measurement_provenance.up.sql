@@ -0,0 +1,5 @@
+-- Measurements can be added through the API next to pipelines, the source records how a
+-- measurement was ingested and submitted_by the user that added it through the API
+ALTER TABLE measurements
+  ADD COLUMN measurement_source TEXT NOT NULL DEFAULT 'pipeline',
+  ADD COLUMN measurement_submitted_by TEXT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE measurements DROP COLUMN measurement_correction_id;
+DROP TABLE measurement_corrections;
@@ -0,0 +1,22 @@
+-- Measurements that are deleted or overwritten after ingestion are recorded with the original values
+CREATE TABLE measurement_corrections (
+  id BIGINT NOT NULL GENERATED ALWAYS AS IDENTITY,
+  tenant_id BIGINT NOT NULL,
+  datastream_id UUID NOT NULL,
+  action TEXT NOT NULL,
+  range_start TIMESTAMPTZ NOT NULL,
+  range_end TIMESTAMPTZ NOT NULL,
+  reason TEXT NOT NULL,
+  value FLOAT8 NULL,
+  factor FLOAT8 NULL,
+  offset_value FLOAT8 NULL,
+  performed_by TEXT NOT NULL,
+  performed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  original_measurements JSONB NOT NULL DEFAULT '[]'::jsonb,
+
+  PRIMARY KEY(id)
+);
+CREATE INDEX measurement_corrections_datastream_idx ON measurement_corrections(datastream_id, performed_at DESC, id DESC);
+
+-- Overwritten measurements refer to the correction that changed them
+ALTER TABLE measurements ADD COLUMN measurement_correction_id BIGINT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE rollup_retention;
+DROP TABLE measurement_rollups_daily;
+DROP TABLE measurement_rollups_hourly;
@@ -0,0 +1,63 @@
+-- Hourly and daily rollups of the measurements per datastream. TimescaleDB continuous aggregates are not
+-- available in the Apache licensed edition, therefore core refreshes the rollups in the same transaction
+-- in which measurements are stored or corrected.
+CREATE TABLE measurement_rollups_hourly (
+  datastream_id UUID NOT NULL,
+  bucket TIMESTAMPTZ NOT NULL,
+  tenant_id BIGINT NOT NULL,
+  value_min FLOAT8 NOT NULL,
+  value_max FLOAT8 NOT NULL,
+  value_sum FLOAT8 NOT NULL,
+  value_count BIGINT NOT NULL,
+  rollup_expiration DATE NOT NULL,
+
+  PRIMARY KEY (datastream_id, bucket)
+);
+SELECT create_hypertable('measurement_rollups_hourly', 'bucket', chunk_time_interval => INTERVAL '30 days');
+CREATE INDEX measurement_rollups_hourly_tenant_idx ON measurement_rollups_hourly(tenant_id);
+
+CREATE TABLE measurement_rollups_daily (
+  datastream_id UUID NOT NULL,
+  bucket TIMESTAMPTZ NOT NULL,
+  tenant_id BIGINT NOT NULL,
+  value_min FLOAT8 NOT NULL,
+  value_max FLOAT8 NOT NULL,
+  value_sum FLOAT8 NOT NULL,
+  value_count BIGINT NOT NULL,
+  rollup_expiration DATE NOT NULL,
+
+  PRIMARY KEY (datastream_id, bucket)
+);
+SELECT create_hypertable('measurement_rollups_daily', 'bucket', chunk_time_interval => INTERVAL '365 days');
+CREATE INDEX measurement_rollups_daily_tenant_idx ON measurement_rollups_daily(tenant_id);
+
+-- Rollups are kept for the system default retention, unless the tenant has its own
+CREATE TABLE rollup_retention (
+  tenant_id BIGINT NOT NULL,
+  hourly_days INTEGER NOT NULL,
+  daily_days INTEGER NOT NULL,
+
+  PRIMARY KEY (tenant_id)
+);
+
+-- Backfill the rollups from the existing measurements using the default retention
+INSERT INTO measurement_rollups_hourly (
+  datastream_id, bucket, tenant_id, value_min, value_max, value_sum, value_count, rollup_expiration
+)
+SELECT
+  m.datastream_id, time_bucket(INTERVAL '1 hour', m.measurement_timestamp) AS bucket, ds.tenant_id,
+  min(m.measurement_value), max(m.measurement_value), sum(m.measurement_value), count(*),
+  (time_bucket(INTERVAL '1 hour', m.measurement_timestamp) + INTERVAL '365 days')::date
+FROM measurements m
+JOIN datastreams ds ON ds.id = m.datastream_id
+GROUP BY m.datastream_id, bucket, ds.tenant_id;
+
+INSERT INTO measurement_rollups_daily (
+  datastream_id, bucket, tenant_id, value_min, value_max, value_sum, value_count, rollup_expiration
+)
+SELECT
+  datastream_id, time_bucket(INTERVAL '1 day', bucket) AS day, tenant_id,
+  min(value_min), max(value_max), sum(value_sum), sum(value_count),
+  (time_bucket(INTERVAL '1 day', bucket) + INTERVAL '3650 days')::date
+FROM measurement_rollups_hourly
+GROUP BY datastream_id, day, tenant_id;
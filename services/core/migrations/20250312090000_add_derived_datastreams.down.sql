@@ -0,0 +1,2 @@
+DROP TABLE datastream_derivation_sources;
+DROP TABLE datastream_derivations;
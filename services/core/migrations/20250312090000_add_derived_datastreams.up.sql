@@ -0,0 +1,19 @@
+-- Derived datastreams are regular datastreams of which the measurements are calculated from the
+-- measurements of their source datastreams
+CREATE TABLE datastream_derivations (
+  datastream_id UUID NOT NULL REFERENCES datastreams(id) ON DELETE CASCADE,
+  tenant_id BIGINT NOT NULL,
+  expression TEXT NOT NULL,
+  tolerance_seconds INTEGER NOT NULL DEFAULT 0,
+
+  PRIMARY KEY(datastream_id)
+);
+
+CREATE TABLE datastream_derivation_sources (
+  datastream_id UUID NOT NULL REFERENCES datastream_derivations(datastream_id) ON DELETE CASCADE,
+  variable TEXT NOT NULL,
+  source_datastream_id UUID NOT NULL REFERENCES datastreams(id) ON DELETE CASCADE,
+
+  PRIMARY KEY(datastream_id, variable)
+);
+CREATE INDEX datastream_derivation_sources_source_idx ON datastream_derivation_sources(source_datastream_id);
@@ -0,0 +1 @@
+ALTER TABLE datastreams DROP COLUMN archive_time;
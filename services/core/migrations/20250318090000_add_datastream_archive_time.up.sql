@@ -0,0 +1,2 @@
+-- Days measurements of the datastream are kept, overrides the tenant and system archive time
+ALTER TABLE datastreams ADD COLUMN archive_time INTEGER;
@@ -0,0 +1,38 @@
+-- Alert rules watch a single datastream or every datastream of the sensors in a sensor group
+CREATE TABLE alert_rules (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL,
+  datastream_id UUID REFERENCES datastreams(id) ON DELETE CASCADE,
+  sensor_group_id BIGINT REFERENCES sensor_groups(id) ON DELETE CASCADE,
+  observed_property TEXT NOT NULL DEFAULT '',
+  operator TEXT NOT NULL DEFAULT '',
+  threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+  hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0,
+  no_data_minutes INTEGER NOT NULL DEFAULT 0,
+  notifications JSONB NOT NULL DEFAULT '[]',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CHECK ((datastream_id IS NULL) <> (sensor_group_id IS NULL))
+);
+CREATE INDEX alert_rules_tenant_idx ON alert_rules(tenant_id);
+CREATE INDEX alert_rules_datastream_idx ON alert_rules(datastream_id);
+CREATE INDEX alert_rules_sensor_group_idx ON alert_rules(sensor_group_id);
+
+-- The alert of a rule for one of its datastreams, including the latest evaluated measurement
+CREATE TABLE alerts (
+  rule_id BIGINT NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+  datastream_id UUID NOT NULL REFERENCES datastreams(id) ON DELETE CASCADE,
+  tenant_id BIGINT NOT NULL,
+  state TEXT NOT NULL,
+  value DOUBLE PRECISION,
+  fired_at TIMESTAMPTZ,
+  resolved_at TIMESTAMPTZ,
+  last_value DOUBLE PRECISION,
+  last_timestamp TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(rule_id, datastream_id)
+);
+CREATE INDEX alerts_tenant_state_idx ON alerts(tenant_id, state);
@@ -0,0 +1,31 @@
+-- Webhooks receive the stored measurements of their tenant that match their filters
+CREATE TABLE webhooks (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  device_ids BIGINT[] NOT NULL DEFAULT '{}',
+  datastream_ids UUID[] NOT NULL DEFAULT '{}',
+  observed_properties TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX webhooks_tenant_idx ON webhooks(tenant_id);
+
+-- Every delivery is a batch of measurements posted to a webhook, deliveries that exhausted their attempts
+-- are dead and kept until they are retried or the webhook is deleted
+CREATE TABLE webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  tenant_id BIGINT NOT NULL,
+  status TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  measurement_count INTEGER NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_status_code INTEGER,
+  last_error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  next_attempt_at TIMESTAMPTZ NOT NULL,
+  delivered_at TIMESTAMPTZ
+);
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries(webhook_id, status);
@@ -0,0 +1,2 @@
+ALTER TABLE measurement_rollups_daily DROP COLUMN value_sum_squares;
+ALTER TABLE measurement_rollups_hourly DROP COLUMN value_sum_squares;
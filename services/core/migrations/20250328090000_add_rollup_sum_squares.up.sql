@@ -0,0 +1,25 @@
+-- The sum of squared values allows the standard deviation to be calculated from the rollups. Rollups of which
+-- the raw measurements are already cleaned up can not be backfilled and keep a NULL sum of squares.
+ALTER TABLE measurement_rollups_hourly ADD COLUMN value_sum_squares FLOAT8;
+ALTER TABLE measurement_rollups_daily ADD COLUMN value_sum_squares FLOAT8;
+
+UPDATE measurement_rollups_hourly h SET value_sum_squares = m.sum_squares
+FROM (
+  SELECT
+    datastream_id, time_bucket(INTERVAL '1 hour', measurement_timestamp) AS bucket,
+    sum(measurement_value * measurement_value) AS sum_squares, count(*) AS count
+  FROM measurements
+  GROUP BY datastream_id, bucket
+) m
+WHERE h.datastream_id = m.datastream_id AND h.bucket = m.bucket AND h.value_count = m.count;
+
+UPDATE measurement_rollups_daily d SET value_sum_squares = h.sum_squares
+FROM (
+  SELECT
+    datastream_id, time_bucket(INTERVAL '1 day', bucket) AS day,
+    sum(value_sum_squares) AS sum_squares, sum(value_count) AS count
+  FROM measurement_rollups_hourly
+  WHERE value_sum_squares IS NOT NULL
+  GROUP BY datastream_id, day
+) h
+WHERE d.datastream_id = h.datastream_id AND d.bucket = h.day AND d.value_count = h.count;
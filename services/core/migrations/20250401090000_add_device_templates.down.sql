@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN template_id;
+DROP TABLE device_templates;
@@ -0,0 +1,14 @@
+-- Device templates describe a device model, the sensors of the template are created for every device created from it
+CREATE TABLE device_templates (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  properties JSONB NOT NULL DEFAULT '{}',
+  sensors JSONB NOT NULL DEFAULT '[]',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX device_templates_tenant_idx ON device_templates(tenant_id);
+
+ALTER TABLE devices ADD COLUMN template_id BIGINT NULL REFERENCES device_templates(id) ON DELETE SET NULL;
+CREATE INDEX devices_template_idx ON devices(template_id);
@@ -0,0 +1,17 @@
+-- Device locations keep the history of the location of a device, a location holds until the next location of the device
+CREATE TABLE device_locations (
+  device_id BIGINT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  tenant_id BIGINT NOT NULL,
+  timestamp TIMESTAMPTZ NOT NULL,
+  latitude FLOAT8 NOT NULL,
+  longitude FLOAT8 NOT NULL,
+  altitude FLOAT8 NULL,
+  source TEXT NOT NULL,
+  PRIMARY KEY (device_id, timestamp)
+);
+CREATE INDEX device_locations_tenant_idx ON device_locations(tenant_id);
+
+-- The current location of existing devices is the start of their history
+INSERT INTO device_locations (device_id, tenant_id, timestamp, latitude, longitude, altitude, source)
+SELECT id, tenant_id, created_at, ST_Y(location::geometry), ST_X(location::geometry), altitude, 'api'
+FROM devices WHERE location IS NOT NULL;
@@ -0,0 +1 @@
+-- The original notation of the units is not kept, canonical units are valid for every version of core
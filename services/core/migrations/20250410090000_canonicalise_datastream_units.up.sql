@@ -0,0 +1,66 @@
+-- Ingestion converts units to their canonical UCUM notation, datastreams created before that still have the unit
+-- as the worker sent it, such as "#" or "Celsius". A sensor has one datastream per observed property, so
+-- canonicalising the unit in place keeps its measurements, rollups, corrections and rules together instead of
+-- ingestion failing to create a second datastream for the canonical unit.
+-- The aliases must match unitAliases and unitCharacterReplacer in measurements/ucum.go, which is verified by
+-- TestCanonicaliseUnitsMigrationShouldMatchUnitAliases
+CREATE TEMPORARY TABLE unit_aliases (alias TEXT PRIMARY KEY, unit TEXT NOT NULL);
+INSERT INTO unit_aliases (alias, unit) VALUES
+  ('', '1'),
+  ('C', 'Cel'),
+  ('°C', 'Cel'),
+  ('degC', 'Cel'),
+  ('deg C', 'Cel'),
+  ('celsius', 'Cel'),
+  ('Celsius', 'Cel'),
+  ('F', '[degF]'),
+  ('°F', '[degF]'),
+  ('degF', '[degF]'),
+  ('deg F', '[degF]'),
+  ('fahrenheit', '[degF]'),
+  ('Fahrenheit', '[degF]'),
+  ('°', 'deg'),
+  ('percent', '%'),
+  ('ppm', '[ppm]'),
+  ('ppb', '[ppb]'),
+  ('dBm', 'dB[mW]'),
+  ('lux', 'lx'),
+  ('Wh', 'W.h'),
+  ('kWh', 'kW.h'),
+  ('knots', '[kn_i]'),
+  ('kn', '[kn_i]'),
+  ('kt', '[kn_i]'),
+  ('psi', '[psi]'),
+  ('in', '[in_i]'),
+  ('inch', '[in_i]'),
+  ('ft', '[ft_i]'),
+  ('mi', '[mi_i]'),
+  ('mph', '[mi_i]/h'),
+  ('kph', 'km/h'),
+  ('rpm', '{rev}/min'),
+  ('#', '{count}'),
+  ('count', '{count}');
+
+CREATE TEMPORARY TABLE canonical_units AS
+SELECT original, coalesce(a.unit, replaced) AS unit
+FROM (
+  SELECT DISTINCT
+    unit_of_measurement AS original,
+    replace(replace(replace(replace(replace(
+      btrim(unit_of_measurement), 'µ', 'u'), 'μ', 'u'), '²', '2'), '³', '3'), '·', '.'
+    ) AS replaced
+  FROM datastreams
+) units
+LEFT JOIN unit_aliases a ON a.alias = units.replaced;
+DELETE FROM canonical_units WHERE original = unit;
+
+UPDATE datastreams ds SET unit_of_measurement = cu.unit
+FROM canonical_units cu
+WHERE ds.unit_of_measurement = cu.original;
+
+UPDATE measurements m SET datastream_unit_of_measurement = cu.unit
+FROM canonical_units cu
+WHERE m.datastream_unit_of_measurement = cu.original;
+
+DROP TABLE canonical_units;
+DROP TABLE unit_aliases;
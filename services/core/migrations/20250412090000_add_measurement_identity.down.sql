@@ -0,0 +1,2 @@
+DROP INDEX measurements_identity_idx;
+ALTER TABLE measurements DROP COLUMN measurement_duplicate;
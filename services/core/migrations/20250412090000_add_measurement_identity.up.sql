@@ -0,0 +1,19 @@
+-- A measurement is identified by its datastream, timestamp and discriminator. Only the conflict policy keeping both
+-- measurements stores an identity more than once, the duplicate column numbers those in the order they were stored.
+ALTER TABLE measurements ADD COLUMN measurement_duplicate INTEGER NOT NULL DEFAULT 0;
+
+UPDATE measurements m SET measurement_duplicate = d.duplicate
+FROM (
+  SELECT
+    id, datastream_id, measurement_timestamp,
+    row_number() OVER (
+      PARTITION BY datastream_id, measurement_timestamp, measurement_discriminator ORDER BY id
+    ) - 1 AS duplicate
+  FROM measurements
+) d
+WHERE d.duplicate > 0
+  AND m.datastream_id = d.datastream_id AND m.measurement_timestamp = d.measurement_timestamp AND m.id = d.id;
+
+CREATE UNIQUE INDEX measurements_identity_idx ON measurements(
+  datastream_id, measurement_timestamp, measurement_discriminator, measurement_duplicate
+);
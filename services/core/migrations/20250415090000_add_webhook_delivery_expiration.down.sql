@@ -0,0 +1,2 @@
+DROP INDEX webhook_deliveries_expiration_idx;
+ALTER TABLE webhook_deliveries DROP COLUMN expires_at;
@@ -0,0 +1,8 @@
+-- Deliveries contain measurements, so they are deleted with their latest measurement whatever their status
+ALTER TABLE webhook_deliveries ADD COLUMN expires_at TIMESTAMPTZ;
+UPDATE webhook_deliveries SET expires_at = COALESCE(
+  (SELECT MAX((m->>'measurement_expiration')::TIMESTAMPTZ) FROM jsonb_array_elements(payload->'measurements') m),
+  created_at + INTERVAL '30 days'
+);
+ALTER TABLE webhook_deliveries ALTER COLUMN expires_at SET NOT NULL;
+CREATE INDEX webhook_deliveries_expiration_idx ON webhook_deliveries(expires_at);
@@ -0,0 +1 @@
+DROP INDEX devices_tenant_code_idx;
@@ -0,0 +1,10 @@
+-- Device codes identify devices within a tenant. Devices that share their code with an earlier device of the tenant
+-- are renamed to their code suffixed with their id, such that the index can be created.
+UPDATE devices d SET code = d.code || '-' || d.id
+FROM (
+  SELECT id, row_number() OVER (PARTITION BY tenant_id, code ORDER BY id) AS n
+  FROM devices
+) ranked
+WHERE ranked.n > 1 AND d.id = ranked.id;
+
+CREATE UNIQUE INDEX devices_tenant_code_idx ON devices(tenant_id, code);
@@ -0,0 +1,20 @@
+ALTER TABLE measurement_corrections ADD COLUMN original_measurements JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+UPDATE measurement_corrections c SET original_measurements = originals.list
+FROM (
+  SELECT o.correction_id, jsonb_agg(jsonb_build_object(
+    'measurement_id', o.measurement_id,
+    'measurement_timestamp', o.measurement_timestamp,
+    'measurement_value', o.measurement_value,
+    'measurement_quality', (
+      SELECT COALESCE(jsonb_agg(f.name ORDER BY f.bit), '[]'::jsonb)
+      FROM (VALUES (1, 'range'), (2, 'rate_of_change'), (4, 'flatline'), (8, 'future_timestamp')) f(bit, name)
+      WHERE o.measurement_quality & f.bit <> 0
+    )
+  ) ORDER BY o.measurement_timestamp, o.measurement_id) AS list
+  FROM measurement_correction_originals o
+  GROUP BY o.correction_id
+) originals
+WHERE c.id = originals.correction_id;
+
+DROP TABLE measurement_correction_originals;
@@ -0,0 +1,34 @@
+-- The measurements as they were before a correction are stored per measurement instead of in a single document
+CREATE TABLE measurement_correction_originals (
+  correction_id BIGINT NOT NULL REFERENCES measurement_corrections(id) ON DELETE CASCADE,
+  measurement_id BIGINT NOT NULL,
+  measurement_timestamp TIMESTAMPTZ NOT NULL,
+  measurement_value FLOAT8 NOT NULL,
+  measurement_quality INTEGER NOT NULL DEFAULT 0,
+
+  PRIMARY KEY(correction_id, measurement_id)
+);
+
+-- The quality was recorded by the names of its flags
+INSERT INTO measurement_correction_originals (
+  correction_id, measurement_id, measurement_timestamp, measurement_value, measurement_quality
+)
+SELECT
+  c.id,
+  (o->>'measurement_id')::bigint,
+  (o->>'measurement_timestamp')::timestamptz,
+  (o->>'measurement_value')::float8,
+  (
+    SELECT COALESCE(SUM(CASE flag
+      WHEN 'range' THEN 1
+      WHEN 'rate_of_change' THEN 2
+      WHEN 'flatline' THEN 4
+      WHEN 'future_timestamp' THEN 8
+      ELSE 0
+    END), 0)::integer
+    FROM jsonb_array_elements_text(COALESCE(o->'measurement_quality', '[]'::jsonb)) flag
+  )
+FROM measurement_corrections c, jsonb_array_elements(c.original_measurements) o
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE measurement_corrections DROP COLUMN original_measurements;
@@ -15,24 +15,42 @@ import (
 var fs embed.FS
 
 func MigratePostgres(db *sql.DB) error {
-	psql, err := postgres.WithInstance(db, &postgres.Config{})
+	m, err := newMigrator(db)
 	if err != nil {
-		return fmt.Errorf("could not create postgres instance for migrations: %w", err)
+		return err
 	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("could not migrate: %w", err)
+	}
+	return nil
+}
 
-	src, err := iofs.New(fs, ".")
+// MigratePostgresTo migrates up or down to the given version, which is the timestamp of a migration
+func MigratePostgresTo(db *sql.DB, version uint) error {
+	m, err := newMigrator(db)
 	if err != nil {
-		return fmt.Errorf("could not create source for migrations: %w", err)
+		return err
+	}
+	if err := m.Migrate(version); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("could not migrate to %d: %w", version, err)
 	}
+	return nil
+}
 
-	m, err := migrate.NewWithInstance("iofs", src, "postgres", psql)
+func newMigrator(db *sql.DB) (*migrate.Migrate, error) {
+	psql, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
-		return fmt.Errorf("could not create migrator instance: %w", err)
+		return nil, fmt.Errorf("could not create postgres instance for migrations: %w", err)
 	}
 
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return fmt.Errorf("could not migrate: %w", err)
+	src, err := iofs.New(fs, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not create source for migrations: %w", err)
 	}
 
-	return nil
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", psql)
+	if err != nil {
+		return nil, fmt.Errorf("could not create migrator instance: %w", err)
+	}
+	return m, nil
 }
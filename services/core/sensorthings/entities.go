@@ -0,0 +1,290 @@
+package sensorthings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+// The SensorThings entity types are mapped onto the core tables. A device is a Thing and its location is the
+// Location of that Thing, a sensor is a Sensor, the observed properties of the datastreams are ObservedProperties,
+// datastreams are Datastreams and measurements are Observations of their FeatureOfInterest.
+
+type idKind int
+
+const (
+	idInteger idKind = iota
+	idUUID
+	idString
+)
+
+type entityType struct {
+	name string
+	set  string
+	from string
+	// where restricts the rows of the table that are entities of this type
+	where        string
+	idColumn     string
+	idKind       idKind
+	tenantColumn string
+	permission   auth.Permission
+	properties   []property
+	navigations  []navigation
+	// defaultOrder is used when no $orderby is given, the id is always appended to get a stable order
+	defaultOrder []string
+}
+
+type property struct {
+	name string
+	sql  string
+	json bool
+}
+
+type navigation struct {
+	name   string
+	target string
+	many   bool
+	// key is the column of the parent entity that relates it to the target entities, defaults to the id
+	key string
+	// condition selects the related target entities, {parent} is replaced with the parent keys
+	condition string
+}
+
+const observationTypeMeasurement = "http://www.opengis.net/def/observationType/OGC-OM/2.0/OM_Measurement"
+
+var entityTypes = []*entityType{
+	{
+		name:         "Thing",
+		set:          "Things",
+		from:         "devices",
+		idColumn:     "devices.id",
+		tenantColumn: "devices.tenant_id",
+		permission:   auth.READ_DEVICES,
+		properties: []property{
+			{name: "name", sql: "devices.code"},
+			{name: "description", sql: "devices.description"},
+			{name: "properties", sql: "devices.properties", json: true},
+		},
+		navigations: []navigation{
+			{name: "Locations", target: "Locations", many: true, condition: "devices.id IN ({parent})"},
+			{
+				name: "Datastreams", target: "Datastreams", many: true,
+				condition: "datastreams.sensor_id IN (SELECT sensors.id FROM sensors WHERE sensors.device_id IN ({parent}))",
+			},
+		},
+	},
+	{
+		name:         "Location",
+		set:          "Locations",
+		from:         "devices",
+		where:        "devices.location IS NOT NULL",
+		idColumn:     "devices.id",
+		tenantColumn: "devices.tenant_id",
+		permission:   auth.READ_DEVICES,
+		properties: []property{
+			{name: "name", sql: "COALESCE(NULLIF(devices.location_description, ''), devices.code)"},
+			{name: "description", sql: "COALESCE(devices.location_description, '')"},
+			{name: "encodingType", sql: "'application/geo+json'"},
+			{name: "location", sql: "ST_AsGeoJSON(devices.location)::json", json: true},
+		},
+		navigations: []navigation{
+			{name: "Things", target: "Things", many: true, condition: "devices.id IN ({parent})"},
+		},
+	},
+	{
+		name:         "Sensor",
+		set:          "Sensors",
+		from:         "sensors",
+		idColumn:     "sensors.id",
+		tenantColumn: "sensors.tenant_id",
+		permission:   auth.READ_DEVICES,
+		properties: []property{
+			{name: "name", sql: "sensors.code"},
+			{name: "description", sql: "sensors.description"},
+			{name: "encodingType", sql: "'text/plain'"},
+			{name: "metadata", sql: "COALESCE(sensors.brand, '')"},
+			{name: "properties", sql: "sensors.properties", json: true},
+		},
+		navigations: []navigation{
+			{name: "Datastreams", target: "Datastreams", many: true, condition: "datastreams.sensor_id IN ({parent})"},
+		},
+	},
+	{
+		name:         "ObservedProperty",
+		set:          "ObservedProperties",
+		from:         "(SELECT DISTINCT tenant_id, observed_property FROM datastreams) AS observed_properties",
+		idColumn:     "observed_properties.observed_property",
+		idKind:       idString,
+		tenantColumn: "observed_properties.tenant_id",
+		permission:   auth.READ_MEASUREMENTS,
+		properties: []property{
+			{name: "name", sql: "observed_properties.observed_property"},
+			{name: "definition", sql: "observed_properties.observed_property"},
+			{name: "description", sql: "''"},
+		},
+		navigations: []navigation{
+			{
+				name: "Datastreams", target: "Datastreams", many: true,
+				condition: "datastreams.observed_property IN ({parent})",
+			},
+		},
+	},
+	{
+		name:         "Datastream",
+		set:          "Datastreams",
+		from:         "datastreams",
+		idColumn:     "datastreams.id",
+		idKind:       idUUID,
+		tenantColumn: "datastreams.tenant_id",
+		permission:   auth.READ_MEASUREMENTS,
+		properties: []property{
+			{name: "name", sql: "datastreams.observed_property"},
+			{name: "description", sql: "datastreams.description"},
+			{
+				name: "unitOfMeasurement", json: true,
+				sql: "json_build_object('name', datastreams.unit_of_measurement, 'symbol', datastreams.unit_of_measurement, " +
+					"'definition', 'https://ucum.org/ucum#' || datastreams.unit_of_measurement)",
+			},
+			{name: "observationType", sql: "'" + observationTypeMeasurement + "'"},
+			{name: "properties", sql: "json_build_object('quality_rules', datastreams.quality_rules)", json: true},
+		},
+		navigations: []navigation{
+			{
+				name: "Thing", target: "Things", key: "datastreams.sensor_id",
+				condition: "devices.id IN (SELECT sensors.device_id FROM sensors WHERE sensors.id IN ({parent}))",
+			},
+			{name: "Sensor", target: "Sensors", key: "datastreams.sensor_id", condition: "sensors.id IN ({parent})"},
+			{
+				name: "ObservedProperty", target: "ObservedProperties", key: "datastreams.observed_property",
+				condition: "observed_properties.observed_property IN ({parent})",
+			},
+			{
+				name: "Observations", target: "Observations", many: true,
+				condition: "measurements.datastream_id IN ({parent})",
+			},
+		},
+	},
+	{
+		name:         "Observation",
+		set:          "Observations",
+		from:         "measurements",
+		idColumn:     "measurements.id",
+		tenantColumn: "measurements.organisation_id",
+		permission:   auth.READ_MEASUREMENTS,
+		properties: []property{
+			{name: "phenomenonTime", sql: "measurements.measurement_timestamp"},
+			{name: "resultTime", sql: "measurements.measurement_timestamp"},
+			{name: "result", sql: "measurements.measurement_value"},
+			{name: "parameters", sql: "measurements.measurement_properties", json: true},
+		},
+		navigations: []navigation{
+			{
+				name: "Datastream", target: "Datastreams", key: "measurements.datastream_id",
+				condition: "datastreams.id IN ({parent})",
+			},
+			{
+				name: "FeatureOfInterest", target: "FeaturesOfInterest", key: "measurements.feature_of_interest_id",
+				condition: "features_of_interest.id IN ({parent})",
+			},
+		},
+		defaultOrder: []string{"measurements.measurement_timestamp DESC"},
+	},
+	{
+		name:         "FeatureOfInterest",
+		set:          "FeaturesOfInterest",
+		from:         "features_of_interest",
+		idColumn:     "features_of_interest.id",
+		tenantColumn: "features_of_interest.tenant_id",
+		permission:   auth.READ_MEASUREMENTS,
+		properties: []property{
+			{name: "name", sql: "features_of_interest.name"},
+			{name: "description", sql: "COALESCE(features_of_interest.description, '')"},
+			{name: "encodingType", sql: "'application/geo+json'"},
+			{name: "feature", sql: "ST_AsGeoJSON(features_of_interest.feature)::json", json: true},
+			{name: "properties", sql: "features_of_interest.properties", json: true},
+		},
+		navigations: []navigation{
+			{
+				name: "Observations", target: "Observations", many: true,
+				condition: "measurements.feature_of_interest_id IN ({parent})",
+			},
+		},
+	},
+}
+
+func entityBySet(set string) (*entityType, bool) {
+	for _, entity := range entityTypes {
+		if entity.set == set {
+			return entity, true
+		}
+	}
+	return nil, false
+}
+
+func (e *entityType) property(name string) (property, bool) {
+	for _, prop := range e.properties {
+		if prop.name == name {
+			return prop, true
+		}
+	}
+	return property{}, false
+}
+
+func (e *entityType) navigation(name string) (navigation, bool) {
+	for _, nav := range e.navigations {
+		if nav.name == name {
+			return nav, true
+		}
+	}
+	return navigation{}, false
+}
+
+// idFilterColumn is the id as compared in $filter, uuids are compared as text
+func (e *entityType) idFilterColumn() string {
+	if e.idKind == idUUID {
+		return e.idColumn + "::text"
+	}
+	return e.idColumn
+}
+
+// parseID parses the key of an entity in a resource path, such as 1 in Things(1)
+func (e *entityType) parseID(key string) (any, error) {
+	if e.idKind == idInteger {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s id must be a number", ErrPathInvalid, e.name)
+		}
+		return id, nil
+	}
+	if len(key) < 2 || key[0] != '\'' || key[len(key)-1] != '\'' {
+		return nil, fmt.Errorf("%w: %s id must be a quoted string", ErrPathInvalid, e.name)
+	}
+	key = strings.ReplaceAll(key[1:len(key)-1], "''", "'")
+	if e.idKind == idUUID {
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s id must be a uuid", ErrPathInvalid, e.name)
+		}
+		return id, nil
+	}
+	return key, nil
+}
+
+// formatID formats an id as key in a resource path
+func formatID(id any) string {
+	switch id := id.(type) {
+	case int64:
+		return strconv.FormatInt(id, 10)
+	case int32:
+		return strconv.FormatInt(int64(id), 10)
+	case fmt.Stringer:
+		return "'" + strings.ReplaceAll(id.String(), "'", "''") + "'"
+	case string:
+		return "'" + strings.ReplaceAll(id, "'", "''") + "'"
+	}
+	return fmt.Sprint(id)
+}
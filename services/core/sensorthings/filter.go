@@ -0,0 +1,517 @@
+package sensorthings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The $filter option is parsed into an expression tree which is then rendered as SQL condition for an
+// entity type. The supported subset of OData consists of the logical and comparison operators, literals,
+// property paths (including paths into JSON properties) and the string, date and math functions.
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenDateTime
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+func tokenize(input string) ([]token, error) {
+	tokens := []token{}
+	pos := 0
+	for pos < len(input) {
+		c := rune(input[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: pos})
+			pos++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: pos})
+			pos++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: pos})
+			pos++
+		case c == '\'':
+			start := pos
+			var sb strings.Builder
+			pos++
+			for {
+				if pos >= len(input) {
+					return nil, fmt.Errorf("%w: unterminated string at position %d", ErrFilterInvalid, start)
+				}
+				if input[pos] == '\'' {
+					// Quotes are escaped by doubling them
+					if pos+1 < len(input) && input[pos+1] == '\'' {
+						sb.WriteByte('\'')
+						pos += 2
+						continue
+					}
+					pos++
+					break
+				}
+				sb.WriteByte(input[pos])
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: input[start:pos], value: sb.String(), pos: start})
+		case unicode.IsDigit(c) || (c == '-' && pos+1 < len(input) && unicode.IsDigit(rune(input[pos+1]))):
+			start := pos
+			pos++
+			for pos < len(input) && strings.ContainsRune("0123456789.eE+-:TZ", rune(input[pos])) {
+				pos++
+			}
+			text := input[start:pos]
+			if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+				tokens = append(tokens, token{kind: tokenDateTime, text: text, value: t, pos: start})
+				continue
+			}
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid number or datetime %q", ErrFilterInvalid, text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: number, pos: start})
+		case unicode.IsLetter(c) || c == '@' || c == '_':
+			start := pos
+			for pos < len(input) {
+				r := rune(input[pos])
+				if !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("@_./", r)) {
+					break
+				}
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: input[start:pos], pos: start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at position %d", ErrFilterInvalid, c, pos)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+// expression is a node in the filter expression tree
+type expression interface {
+	// render returns the SQL for the expression on the given entity type
+	render(entity *entityType) (operand, error)
+}
+
+// operand is a rendered expression. JSON operands are kept as jsonb, so that they can be compared to
+// literals of any type.
+type operand struct {
+	sql     string
+	args    []any
+	json    bool
+	literal *literalExpression
+}
+
+type logicalExpression struct {
+	operator    string
+	left, right expression
+}
+
+type notExpression struct {
+	expression expression
+}
+
+type comparisonExpression struct {
+	operator    string
+	left, right expression
+}
+
+type literalExpression struct {
+	value any
+}
+
+type propertyExpression struct {
+	path []string
+}
+
+type functionExpression struct {
+	name      string
+	arguments []expression
+}
+
+var comparisonOperators = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+// parseFilter parses the value of a $filter query option
+func parseFilter(input string) (expression, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrFilterInvalid, t.text, t.pos)
+	}
+	return expr, nil
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdentifier && t.text == keyword
+}
+
+func (p *filterParser) parseOr() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalExpression{operator: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalExpression{operator: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (expression, error) {
+	if p.isKeyword("not") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpression{expression: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (expression, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenIdentifier {
+		return left, nil
+	}
+	if _, ok := comparisonOperators[t.text]; ok {
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return comparisonExpression{operator: t.text, left: left, right: right}, nil
+	}
+	switch t.text {
+	case "add", "sub", "mul", "div", "mod":
+		return nil, fmt.Errorf("%w: arithmetic operator %q", ErrFilterUnsupported, t.text)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseOperand() (expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenClose {
+			return nil, fmt.Errorf("%w: missing closing parenthesis for position %d", ErrFilterInvalid, t.pos)
+		}
+		return expr, nil
+	case tokenString, tokenNumber, tokenDateTime:
+		return literalExpression{value: t.value}, nil
+	case tokenIdentifier:
+		switch t.text {
+		case "true":
+			return literalExpression{value: true}, nil
+		case "false":
+			return literalExpression{value: false}, nil
+		case "null":
+			return literalExpression{value: nil}, nil
+		}
+		if p.peek().kind == tokenOpen {
+			return p.parseFunction(t)
+		}
+		return propertyExpression{path: strings.Split(t.text, "/")}, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrFilterInvalid, t.text, t.pos)
+}
+
+func (p *filterParser) parseFunction(name token) (expression, error) {
+	p.next()
+	fn := functionExpression{name: name.text}
+	if p.peek().kind == tokenClose {
+		p.next()
+		return fn, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		fn.arguments = append(fn.arguments, arg)
+		switch t := p.next(); t.kind {
+		case tokenComma:
+			continue
+		case tokenClose:
+			return fn, nil
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in arguments of %s", ErrFilterInvalid, t.text, name.text)
+		}
+	}
+}
+
+func (e logicalExpression) render(entity *entityType) (operand, error) {
+	left, err := e.left.render(entity)
+	if err != nil {
+		return operand{}, err
+	}
+	right, err := e.right.render(entity)
+	if err != nil {
+		return operand{}, err
+	}
+	return operand{
+		sql:  "(" + left.sql + " " + e.operator + " " + right.sql + ")",
+		args: append(left.args, right.args...),
+	}, nil
+}
+
+func (e notExpression) render(entity *entityType) (operand, error) {
+	inner, err := e.expression.render(entity)
+	if err != nil {
+		return operand{}, err
+	}
+	return operand{sql: "NOT (" + inner.sql + ")", args: inner.args}, nil
+}
+
+func (e comparisonExpression) render(entity *entityType) (operand, error) {
+	left, err := e.left.render(entity)
+	if err != nil {
+		return operand{}, err
+	}
+	right, err := e.right.render(entity)
+	if err != nil {
+		return operand{}, err
+	}
+
+	// Comparing to null is done with IS NULL
+	if right.literal != nil && right.literal.value == nil {
+		left, right = right, left
+	}
+	if left.literal != nil && left.literal.value == nil {
+		switch e.operator {
+		case "eq":
+			return operand{sql: "(" + right.sql + " IS NULL)", args: right.args}, nil
+		case "ne":
+			return operand{sql: "(" + right.sql + " IS NOT NULL)", args: right.args}, nil
+		}
+		return operand{}, fmt.Errorf("%w: null can only be compared with eq or ne", ErrFilterInvalid)
+	}
+
+	left, right = alignJSONOperands(left, right)
+	return operand{
+		sql:  "(" + left.sql + " " + comparisonOperators[e.operator] + " " + right.sql + ")",
+		args: append(left.args, right.args...),
+	}, nil
+}
+
+// alignJSONOperands makes sure that both sides of a comparison have a comparable type. Literals compared
+// to a JSON value are converted to JSON, other expressions compared to a JSON value use its text.
+func alignJSONOperands(left, right operand) (operand, operand) {
+	if left.json == right.json {
+		return left, right
+	}
+	toJSON := func(json, other operand) (operand, operand) {
+		if other.literal != nil {
+			other.sql = "to_jsonb(" + other.sql + ")"
+			return json, other
+		}
+		json.sql = "(" + json.sql + " #>> '{}')"
+		return json, other
+	}
+	if left.json {
+		return toJSON(left, right)
+	}
+	right, left = toJSON(right, left)
+	return left, right
+}
+
+func (e literalExpression) render(_ *entityType) (operand, error) {
+	var sql string
+	switch e.value.(type) {
+	case nil:
+		sql = "NULL"
+	case string:
+		sql = "?::text"
+	case float64:
+		sql = "?::float8"
+	case bool:
+		sql = "?::boolean"
+	case time.Time:
+		sql = "?::timestamptz"
+	}
+	if e.value == nil {
+		return operand{sql: sql, literal: &e}, nil
+	}
+	return operand{sql: sql, args: []any{e.value}, literal: &e}, nil
+}
+
+func (e propertyExpression) render(entity *entityType) (operand, error) {
+	name := e.path[0]
+	if name == "id" || name == "@iot.id" {
+		if len(e.path) > 1 {
+			return operand{}, fmt.Errorf("%w: %s has no properties", ErrFilterInvalid, name)
+		}
+		return operand{sql: entity.idFilterColumn()}, nil
+	}
+	prop, ok := entity.property(name)
+	if !ok {
+		if _, isNavigation := entity.navigation(name); isNavigation {
+			return operand{}, fmt.Errorf("%w: filtering on related entity %s", ErrFilterUnsupported, name)
+		}
+		return operand{}, fmt.Errorf("%w: %s has no property %s", ErrFilterInvalid, entity.name, name)
+	}
+	if len(e.path) == 1 && !prop.json {
+		return operand{sql: prop.sql}, nil
+	}
+	if len(e.path) == 1 {
+		return operand{sql: "(" + prop.sql + ")::jsonb", json: true}, nil
+	}
+	if !prop.json {
+		return operand{}, fmt.Errorf("%w: property %s has no properties", ErrFilterInvalid, name)
+	}
+	return operand{
+		sql:  "((" + prop.sql + ")::jsonb #> ?::text[])",
+		args: []any{e.path[1:]},
+		json: true,
+	}, nil
+}
+
+// filterFunctions maps the supported OData functions to their SQL, arguments are formatted in the order given
+var filterFunctions = map[string]struct {
+	arguments int
+	sql       string
+}{
+	"substringof": {2, "(strpos(%[2]s, %[1]s) > 0)"},
+	"contains":    {2, "(strpos(%[1]s, %[2]s) > 0)"},
+	"startswith":  {2, "starts_with(%s, %s)"},
+	"endswith":    {2, "(right(%[1]s, length(%[2]s)) = %[2]s)"},
+	"length":      {1, "length(%s)"},
+	"indexof":     {2, "(strpos(%s, %s) - 1)"},
+	"tolower":     {1, "lower(%s)"},
+	"toupper":     {1, "upper(%s)"},
+	"trim":        {1, "trim(%s)"},
+	"concat":      {2, "(%s || %s)"},
+	"year":        {1, "extract(year FROM %s)"},
+	"month":       {1, "extract(month FROM %s)"},
+	"day":         {1, "extract(day FROM %s)"},
+	"hour":        {1, "extract(hour FROM %s)"},
+	"minute":      {1, "extract(minute FROM %s)"},
+	"second":      {1, "extract(second FROM %s)"},
+	"round":       {1, "round(%s)"},
+	"floor":       {1, "floor(%s)"},
+	"ceiling":     {1, "ceiling(%s)"},
+}
+
+func (e functionExpression) render(entity *entityType) (operand, error) {
+	fn, ok := filterFunctions[e.name]
+	if !ok {
+		return operand{}, fmt.Errorf("%w: function %s", ErrFilterUnsupported, e.name)
+	}
+	if len(e.arguments) != fn.arguments {
+		return operand{}, fmt.Errorf("%w: %s requires %d arguments", ErrFilterInvalid, e.name, fn.arguments)
+	}
+
+	// Arguments can be used multiple times in the SQL, so the rendered arguments are
+	// numbered and their values are repeated for every use
+	sqls := make([]any, len(e.arguments))
+	rendered := make([]operand, len(e.arguments))
+	for ix, arg := range e.arguments {
+		op, err := arg.render(entity)
+		if err != nil {
+			return operand{}, err
+		}
+		if op.json {
+			op.sql = "(" + op.sql + " #>> '{}')"
+		}
+		rendered[ix] = op
+		sqls[ix] = op.sql
+	}
+	sql := fmt.Sprintf(fn.sql, sqls...)
+	return operand{sql: sql, args: functionArguments(fn.sql, rendered)}, nil
+}
+
+// functionArguments returns the arguments of the rendered operands in the order they appear in the format
+func functionArguments(format string, rendered []operand) []any {
+	args := []any{}
+	implicit := 0
+	for ix := 0; ix < len(format); ix++ {
+		if format[ix] != '%' {
+			continue
+		}
+		argument := implicit
+		if ix+3 < len(format) && format[ix+1] == '[' {
+			argument = int(format[ix+2]-'0') - 1
+			implicit = argument
+		}
+		args = append(args, rendered[argument].args...)
+		implicit++
+	}
+	return args
+}
@@ -0,0 +1,154 @@
+package sensorthings
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// resourcePath is a parsed resource path such as Things(1)/Datastreams or Datastreams('...')/Observations.
+// Every segment addresses an entity type, either as entity set or as navigation of the previous segment.
+type resourcePath struct {
+	segments []pathSegment
+	// property is set if the path addresses a single property of an entity, such as Things(1)/name
+	property string
+}
+
+type pathSegment struct {
+	entity *entityType
+	// navigation is how this segment is reached from the previous segment, unset for the first segment
+	navigation *navigation
+	id         any
+}
+
+func parseResourcePath(path string) (resourcePath, error) {
+	var result resourcePath
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for ix, part := range parts {
+		name, key, hasKey := strings.Cut(part, "(")
+		if hasKey {
+			if !strings.HasSuffix(key, ")") {
+				return result, fmt.Errorf("%w: missing closing parenthesis in %q", ErrPathInvalid, part)
+			}
+			key = strings.TrimSuffix(key, ")")
+		}
+
+		var segment pathSegment
+		if ix == 0 {
+			entity, ok := entityBySet(name)
+			if !ok {
+				return result, fmt.Errorf("%w: unknown entity set %s", ErrPathNotFound, name)
+			}
+			segment.entity = entity
+		} else {
+			previous := result.segments[len(result.segments)-1]
+			nav, ok := previous.entity.navigation(name)
+			if !ok {
+				// The last segment of a path to a single entity can be one of its properties
+				_, isProperty := previous.entity.property(name)
+				if isProperty && !hasKey && ix == len(parts)-1 && result.isSingle() {
+					result.property = name
+					return result, nil
+				}
+				return result, fmt.Errorf("%w: %s has no navigation or property %s", ErrPathNotFound, previous.entity.name, name)
+			}
+			if !previous.isSingle() {
+				return result, fmt.Errorf("%w: navigation %s requires a single %s", ErrPathInvalid, name, previous.entity.name)
+			}
+			if hasKey && !nav.many {
+				return result, fmt.Errorf("%w: %s is not a collection", ErrPathInvalid, name)
+			}
+			target, _ := entityBySet(nav.target)
+			segment.entity = target
+			segment.navigation = &nav
+		}
+
+		if hasKey {
+			id, err := segment.entity.parseID(key)
+			if err != nil {
+				return result, err
+			}
+			segment.id = id
+		}
+		result.segments = append(result.segments, segment)
+	}
+	return result, nil
+}
+
+func (s pathSegment) isSingle() bool {
+	return s.id != nil || (s.navigation != nil && !s.navigation.many)
+}
+
+func (p resourcePath) isSingle() bool {
+	return p.segments[len(p.segments)-1].isSingle()
+}
+
+func (p resourcePath) entity() *entityType {
+	return p.segments[len(p.segments)-1].entity
+}
+
+// conditions returns the conditions selecting the entities addressed by the path for a tenant
+func (p resourcePath) conditions(tenantID int64) []sq.Sqlizer {
+	var conditions []sq.Sqlizer
+	for ix, segment := range p.segments {
+		next := segment.entity.scope(tenantID)
+		if segment.id != nil {
+			next = append(next, sq.Expr(segment.entity.idColumn+" = ?", segment.id))
+		}
+		if ix > 0 {
+			parent := p.segments[ix-1].entity
+			next = append(next, segment.navigation.relatedTo(parent, sq.Select().From(parent.from).Where(sq.And(conditions))))
+		}
+		conditions = next
+	}
+	return conditions
+}
+
+// scope returns the conditions that limit the entities to those of the tenant
+func (e *entityType) scope(tenantID int64) []sq.Sqlizer {
+	conditions := []sq.Sqlizer{sq.Eq{e.tenantColumn: tenantID}}
+	if e.where != "" {
+		conditions = append(conditions, sq.Expr(e.where))
+	}
+	return conditions
+}
+
+// relatedTo returns the condition selecting the targets of this navigation related to the parents of the query
+func (n navigation) relatedTo(parent *entityType, parents sq.SelectBuilder) sq.Sqlizer {
+	query, args, err := parents.Columns(n.keyColumn(parent)).ToSql()
+	if err != nil {
+		return errorSqlizer{err}
+	}
+	return sq.Expr(strings.Replace(n.condition, "{parent}", query, 1), args...)
+}
+
+// relatedToParentKey returns the condition selecting the targets of this navigation related to the key of the
+// laterally joined parent, which is passed as text and cast to the type of the given key
+func (n navigation) relatedToParentKey(key any) sq.Sqlizer {
+	cast := "text"
+	switch key.(type) {
+	case int64, int32:
+		cast = "bigint"
+	case uuid.UUID:
+		cast = "uuid"
+	}
+	return sq.Expr(strings.Replace(n.condition, "{parent}", "parent.key::"+cast, 1))
+}
+
+// keyColumn is the column of the parent entity that relates it to the targets of this navigation
+func (n navigation) keyColumn(parent *entityType) string {
+	if n.key == "" {
+		return parent.idColumn
+	}
+	return n.key
+}
+
+type errorSqlizer struct {
+	err error
+}
+
+func (e errorSqlizer) ToSql() (string, []any, error) {
+	return "", nil, e.err
+}
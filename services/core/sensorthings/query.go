@@ -0,0 +1,227 @@
+package sensorthings
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultTop is the page size used when $top is not given
+	DefaultTop = 100
+	// MaxTop is the largest page size, larger values of $top are reduced to this
+	MaxTop = 1000
+)
+
+// queryOptions are the parsed system query options of a request or of an expanded navigation
+type queryOptions struct {
+	top     int
+	skip    int
+	count   bool
+	orderBy []orderBy
+	filter  expression
+	expand  []expandOption
+	selects []string
+}
+
+type orderBy struct {
+	property   propertyExpression
+	descending bool
+}
+
+type expandOption struct {
+	navigation string
+	options    queryOptions
+}
+
+// parseQuery parses a raw url query. Unlike url.ParseQuery only & separates parameters, as semicolons
+// separate the options of an expanded navigation.
+func parseQuery(rawQuery string) (url.Values, error) {
+	values := url.Values{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrQueryInvalid, err)
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrQueryInvalid, err)
+		}
+		values.Add(key, value)
+	}
+	return values, nil
+}
+
+// parseQueryOptions parses the system query options from the url query, other parameters are ignored
+func parseQueryOptions(values url.Values) (queryOptions, error) {
+	options := map[string]string{}
+	for key, value := range values {
+		if !strings.HasPrefix(key, "$") || len(value) == 0 {
+			continue
+		}
+		options[key] = value[0]
+	}
+	return parseOptions(options)
+}
+
+// parseNestedOptions parses the options of an expanded navigation, such as $top=1;$orderby=id
+func parseNestedOptions(input string) (queryOptions, error) {
+	options := map[string]string{}
+	for _, part := range splitTopLevel(input, ';') {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return queryOptions{}, fmt.Errorf("%w: expected option=value in %q", ErrQueryInvalid, part)
+		}
+		options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return parseOptions(options)
+}
+
+func parseOptions(options map[string]string) (queryOptions, error) {
+	var err error
+	q := queryOptions{top: DefaultTop}
+	for key, value := range options {
+		switch key {
+		case "$top":
+			q.top, err = strconv.Atoi(value)
+			if err != nil || q.top < 0 {
+				return q, fmt.Errorf("%w: $top must be a non-negative number", ErrQueryInvalid)
+			}
+			q.top = min(q.top, MaxTop)
+		case "$skip":
+			q.skip, err = strconv.Atoi(value)
+			if err != nil || q.skip < 0 {
+				return q, fmt.Errorf("%w: $skip must be a non-negative number", ErrQueryInvalid)
+			}
+		case "$count":
+			q.count, err = strconv.ParseBool(value)
+			if err != nil {
+				return q, fmt.Errorf("%w: $count must be true or false", ErrQueryInvalid)
+			}
+		case "$orderby":
+			q.orderBy, err = parseOrderBy(value)
+		case "$filter":
+			q.filter, err = parseFilter(value)
+		case "$expand":
+			q.expand, err = parseExpand(value)
+		case "$select":
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					q.selects = append(q.selects, name)
+				}
+			}
+		default:
+			return q, fmt.Errorf("%w: unknown query option %s", ErrQueryInvalid, key)
+		}
+		if err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+func parseOrderBy(value string) ([]orderBy, error) {
+	orders := []orderBy{}
+	for _, part := range splitTopLevel(value, ',') {
+		fields := strings.Fields(part)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("%w: invalid $orderby %q", ErrQueryInvalid, part)
+		}
+		order := orderBy{property: propertyExpression{path: strings.Split(fields[0], "/")}}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				order.descending = true
+			default:
+				return nil, fmt.Errorf("%w: $orderby direction must be asc or desc", ErrQueryInvalid)
+			}
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// parseExpand parses the $expand option. A path such as Datastreams/Observations is equivalent to
+// Datastreams($expand=Observations), expansions of the same navigation are merged.
+func parseExpand(value string) ([]expandOption, error) {
+	expands := []expandOption{}
+	for _, part := range splitTopLevel(value, ',') {
+		path, nested, hasOptions := strings.Cut(part, "(")
+		options := queryOptions{top: DefaultTop}
+		if hasOptions {
+			if !strings.HasSuffix(nested, ")") {
+				return nil, fmt.Errorf("%w: missing closing parenthesis in $expand %q", ErrQueryInvalid, part)
+			}
+			var err error
+			options, err = parseNestedOptions(strings.TrimSuffix(nested, ")"))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		segments := strings.Split(strings.TrimSpace(path), "/")
+		expand := expandOption{navigation: segments[len(segments)-1], options: options}
+		for ix := len(segments) - 2; ix >= 0; ix-- {
+			expand = expandOption{
+				navigation: segments[ix],
+				options:    queryOptions{top: DefaultTop, expand: []expandOption{expand}},
+			}
+		}
+		expands = mergeExpand(expands, expand)
+	}
+	return expands, nil
+}
+
+func mergeExpand(expands []expandOption, expand expandOption) []expandOption {
+	for ix := range expands {
+		if expands[ix].navigation != expand.navigation {
+			continue
+		}
+		for _, nested := range expand.options.expand {
+			expands[ix].options.expand = mergeExpand(expands[ix].options.expand, nested)
+		}
+		return expands
+	}
+	return append(expands, expand)
+}
+
+// splitTopLevel splits the value on sep, ignoring separators within parentheses or quoted strings
+func splitTopLevel(value string, sep byte) []string {
+	parts := []string{}
+	depth, start, quoted := 0, 0, false
+	for ix := 0; ix < len(value); ix++ {
+		switch c := value[ix]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, strings.TrimSpace(value[start:ix]))
+			start = ix + 1
+		}
+	}
+	if last := strings.TrimSpace(value[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// nextLinkQuery returns the query of the link to the next page
+func nextLinkQuery(values url.Values, top, skip int) string {
+	next := url.Values{}
+	for key, value := range values {
+		next[key] = value
+	}
+	next.Set("$top", strconv.Itoa(top))
+	next.Set("$skip", strconv.Itoa(skip))
+	return next.Encode()
+}
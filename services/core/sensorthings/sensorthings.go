@@ -0,0 +1,441 @@
+// Package sensorthings implements the read part of the OGC SensorThings API v1.1 on top of the core data.
+package sensorthings
+
+//go:generate moq -pkg sensorthings_test -out mock_test.go . Store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+var (
+	ErrPathInvalid       = web.NewError(http.StatusBadRequest, "The resource path is invalid", "ERR_STA_PATH_INVALID")
+	ErrPathNotFound      = web.NewError(http.StatusNotFound, "The resource path does not exist", "ERR_STA_PATH_NOT_FOUND")
+	ErrEntityNotFound    = web.NewError(http.StatusNotFound, "The requested entity was not found", "ERR_STA_ENTITY_NOT_FOUND")
+	ErrQueryInvalid      = web.NewError(http.StatusBadRequest, "The query options are invalid", "ERR_STA_QUERY_INVALID")
+	ErrFilterInvalid     = web.NewError(http.StatusBadRequest, "The $filter query option is invalid", "ERR_STA_FILTER_INVALID")
+	ErrFilterUnsupported = web.NewError(http.StatusBadRequest, "The $filter query option uses an unsupported feature", "ERR_STA_FILTER_UNSUPPORTED")
+)
+
+type Store interface {
+	// Query returns the rows of a query as maps of column name to value
+	Query(ctx context.Context, query string, args ...any) ([]map[string]any, error)
+}
+
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store}
+}
+
+// Read answers a SensorThings request for the resource path relative to the service root. Links in the
+// response are absolute using the given base url, which is the url of the service root.
+func (s *Service) Read(ctx context.Context, baseURL, path, rawQuery string) (any, error) {
+	if path == "" || path == "/" {
+		return rootDocument(baseURL), nil
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := parseResourcePath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range resource.segments {
+		if err := auth.MustHavePermissions(ctx, auth.Permissions{segment.entity.permission}); err != nil {
+			return nil, err
+		}
+	}
+	query, err := parseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	options, err := parseQueryOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeExpand(ctx, resource.entity(), options.expand); err != nil {
+		return nil, err
+	}
+
+	r := &reader{store: s.store, ctx: ctx, tenantID: tenantID, baseURL: baseURL}
+	entity := resource.entity()
+	conditions := resource.conditions(tenantID)
+
+	if resource.property != "" {
+		options = queryOptions{top: 1, selects: []string{resource.property}}
+	}
+	if !resource.isSingle() {
+		return r.collection(entity, conditions, options, baseURL+"/"+path, query)
+	}
+
+	options.top, options.skip = 1, 0
+	entities, _, err := r.list(entity, conditions, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, ErrEntityNotFound
+	}
+	if resource.property != "" {
+		return map[string]any{resource.property: entities[0][resource.property]}, nil
+	}
+	return entities[0], nil
+}
+
+// authorizeExpand verifies that the expanded navigations exist and may be read
+func authorizeExpand(ctx context.Context, entity *entityType, expands []expandOption) error {
+	for _, expand := range expands {
+		nav, ok := entity.navigation(expand.navigation)
+		if !ok {
+			return fmt.Errorf("%w: %s has no navigation %s", ErrQueryInvalid, entity.name, expand.navigation)
+		}
+		target, _ := entityBySet(nav.target)
+		if err := auth.MustHavePermissions(ctx, auth.Permissions{target.permission}); err != nil {
+			return err
+		}
+		if err := authorizeExpand(ctx, target, expand.options.expand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rootDocument(baseURL string) map[string]any {
+	sets := []map[string]string{}
+	for _, entity := range entityTypes {
+		sets = append(sets, map[string]string{"name": entity.set, "url": baseURL + "/" + entity.set})
+	}
+	return map[string]any{
+		"value": sets,
+		"serverSettings": map[string]any{
+			"conformance": []string{
+				"http://www.opengis.net/spec/iot_sensing/1.1/req/datamodel",
+				"http://www.opengis.net/spec/iot_sensing/1.1/req/resource-path/resource-path-to-entities",
+				"http://www.opengis.net/spec/iot_sensing/1.1/req/request-data",
+			},
+		},
+	}
+}
+
+// reader reads entities for a single request
+type reader struct {
+	store    Store
+	ctx      context.Context
+	tenantID int64
+	baseURL  string
+}
+
+// collection returns a page of the entities matching the conditions with a link to the next page
+func (r *reader) collection(entity *entityType, conditions []sq.Sqlizer, options queryOptions, link string, query url.Values) (map[string]any, error) {
+	entities, more, err := r.list(entity, conditions, options)
+	if err != nil {
+		return nil, err
+	}
+	response := map[string]any{"value": entities}
+	if options.count {
+		count, err := r.count(entity, conditions, options)
+		if err != nil {
+			return nil, err
+		}
+		response["@iot.count"] = count
+	}
+	if more {
+		response["@iot.nextLink"] = link + "?" + nextLinkQuery(query, options.top, options.skip+options.top)
+	}
+	return response, nil
+}
+
+// list returns the entities matching the conditions and query options. The returned bool is true if there are
+// more entities than returned.
+func (r *reader) list(entity *entityType, conditions []sq.Sqlizer, options queryOptions) ([]map[string]any, bool, error) {
+	selected, err := selectedProperties(entity, options.selects)
+	if err != nil {
+		return nil, false, err
+	}
+	expands := expandedNavigations(entity, options)
+	q, err := selectQuery(entity, conditions, selected, expands, options)
+	if err != nil {
+		return nil, false, err
+	}
+	query, args, err := q.Limit(uint64(options.top) + 1).Offset(uint64(options.skip)).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, false, err
+	}
+	rows, err := r.store.Query(r.ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(rows) > options.top
+	rows = rows[:min(len(rows), options.top)]
+
+	entities, err := r.entities(entity, rows, selected, options, expands)
+	if err != nil {
+		return nil, false, err
+	}
+	return entities, more, nil
+}
+
+// expandedNavigations returns the navigations in $expand, these are verified by authorizeExpand
+func expandedNavigations(entity *entityType, options queryOptions) []navigation {
+	expands := make([]navigation, len(options.expand))
+	for ix, expand := range options.expand {
+		expands[ix], _ = entity.navigation(expand.navigation)
+	}
+	return expands
+}
+
+// selectQuery selects the entities matching the conditions and query options, together with the keys of the
+// expanded navigations. Placeholders are left as question marks so the query can be nested.
+func selectQuery(entity *entityType, conditions []sq.Sqlizer, selected []property, expands []navigation, options queryOptions) (sq.SelectBuilder, error) {
+	q := sq.Select(entity.idColumn + ` AS "@iot.id"`).From(entity.from).Where(sq.And(conditions))
+	for _, prop := range selected {
+		q = q.Column(fmt.Sprintf(`%s AS "%s"`, prop.sql, prop.name))
+	}
+	for ix, nav := range expands {
+		q = q.Column(fmt.Sprintf(`%s AS "@key.%d"`, nav.keyColumn(entity), ix))
+	}
+	q, err := applyFilter(q, entity, options.filter)
+	if err != nil {
+		return q, err
+	}
+	for _, order := range options.orderBy {
+		rendered, err := order.property.render(entity)
+		if err != nil {
+			return q, err
+		}
+		direction := " ASC"
+		if order.descending {
+			direction = " DESC"
+		}
+		q = q.OrderByClause(rendered.sql+direction, rendered.args...)
+	}
+	if len(options.orderBy) == 0 {
+		q = q.OrderBy(entity.defaultOrder...)
+	}
+	return q.OrderBy(entity.idColumn), nil
+}
+
+// entities creates the entities from their rows. Every expanded navigation is read with a single query for all
+// rows, instead of one query per row.
+func (r *reader) entities(entity *entityType, rows []map[string]any, selected []property, options queryOptions, expands []navigation) ([]map[string]any, error) {
+	entities := make([]map[string]any, len(rows))
+	for ix, row := range rows {
+		entities[ix] = r.entity(entity, row, selected, options)
+	}
+
+	for ix, nav := range expands {
+		column := fmt.Sprintf("@key.%d", ix)
+		keys := []any{}
+		seen := map[string]bool{}
+		for _, row := range rows {
+			key := normalizeValue(row[column])
+			if key == nil || seen[fmt.Sprint(key)] {
+				continue
+			}
+			seen[fmt.Sprint(key)] = true
+			keys = append(keys, key)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		expandOptions := options.expand[ix].options
+		if !nav.many {
+			expandOptions.top, expandOptions.skip = 1, 0
+		}
+		related, err := r.expand(nav, keys, expandOptions)
+		if err != nil {
+			return nil, err
+		}
+		var counts map[string]int64
+		if nav.many && expandOptions.count {
+			if counts, err = r.expandCounts(nav, keys, expandOptions); err != nil {
+				return nil, err
+			}
+		}
+
+		for rowIx, row := range rows {
+			key := normalizeValue(row[column])
+			if key == nil {
+				continue
+			}
+			targets := related[fmt.Sprint(key)]
+			if nav.many {
+				entities[rowIx][nav.name] = append([]map[string]any{}, targets...)
+				if counts != nil {
+					entities[rowIx][nav.name+"@iot.count"] = counts[fmt.Sprint(key)]
+				}
+			} else if len(targets) > 0 {
+				entities[rowIx][nav.name] = targets[0]
+			}
+		}
+	}
+	return entities, nil
+}
+
+// entity creates the entity from a row with its links, expanded navigations are added by entities
+func (r *reader) entity(entity *entityType, row map[string]any, selected []property, options queryOptions) map[string]any {
+	id := normalizeValue(row["@iot.id"])
+	selfLink := fmt.Sprintf("%s/%s(%s)", r.baseURL, entity.set, formatID(id))
+	result := map[string]any{
+		"@iot.id":       id,
+		"@iot.selfLink": selfLink,
+	}
+	for _, prop := range selected {
+		result[prop.name] = normalizeValue(row[prop.name])
+	}
+	for _, nav := range entity.navigations {
+		if len(options.selects) == 0 || slices.Contains(options.selects, nav.name) {
+			result[nav.name+"@iot.navigationLink"] = selfLink + "/" + nav.name
+		}
+	}
+	return result
+}
+
+// expandQuery runs the query for every parent key, joined laterally so that $top and $skip apply per parent.
+// The key of the parent is returned as text in the @parent column of every row.
+func (r *reader) expandQuery(nested sq.SelectBuilder, keys []any) ([]map[string]any, error) {
+	query, args, err := nested.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	query, err = sq.Dollar.ReplacePlaceholders(
+		`SELECT parent.key AS "@parent", related.* FROM unnest(?::text[]) AS parent(key) CROSS JOIN LATERAL (` +
+			query + `) AS related`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(keys))
+	for ix, key := range keys {
+		texts[ix] = fmt.Sprint(key)
+	}
+	return r.store.Query(r.ctx, query, append([]any{texts}, args...)...)
+}
+
+// expand returns the targets of the navigation for each of the parent keys
+func (r *reader) expand(nav navigation, keys []any, options queryOptions) (map[string][]map[string]any, error) {
+	target, _ := entityBySet(nav.target)
+	selected, err := selectedProperties(target, options.selects)
+	if err != nil {
+		return nil, err
+	}
+	expands := expandedNavigations(target, options)
+	conditions := append(target.scope(r.tenantID), nav.relatedToParentKey(keys[0]))
+	q, err := selectQuery(target, conditions, selected, expands, options)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.expandQuery(q.Limit(uint64(options.top)).Offset(uint64(options.skip)), keys)
+	if err != nil {
+		return nil, err
+	}
+	// Nested navigations are expanded for the targets of all parents at once
+	entities, err := r.entities(target, rows, selected, options, expands)
+	if err != nil {
+		return nil, err
+	}
+	related := map[string][]map[string]any{}
+	for ix, row := range rows {
+		parent := fmt.Sprint(row["@parent"])
+		related[parent] = append(related[parent], entities[ix])
+	}
+	return related, nil
+}
+
+// expandCounts returns the amount of targets of the navigation for each of the parent keys
+func (r *reader) expandCounts(nav navigation, keys []any, options queryOptions) (map[string]int64, error) {
+	target, _ := entityBySet(nav.target)
+	q, err := countQuery(target, append(target.scope(r.tenantID), nav.relatedToParentKey(keys[0])), options)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.expandQuery(q, keys)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[fmt.Sprint(row["@parent"])], _ = row["count"].(int64)
+	}
+	return counts, nil
+}
+
+func countQuery(entity *entityType, conditions []sq.Sqlizer, options queryOptions) (sq.SelectBuilder, error) {
+	return applyFilter(sq.Select("count(*)").From(entity.from).Where(sq.And(conditions)), entity, options.filter)
+}
+
+func (r *reader) count(entity *entityType, conditions []sq.Sqlizer, options queryOptions) (int64, error) {
+	q, err := countQuery(entity, conditions, options)
+	if err != nil {
+		return 0, err
+	}
+	query, args, err := q.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := r.store.Query(r.ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, errors.New("count query returned no rows")
+	}
+	count, _ := rows[0]["count"].(int64)
+	return count, nil
+}
+
+func applyFilter(q sq.SelectBuilder, entity *entityType, filter expression) (sq.SelectBuilder, error) {
+	if filter == nil {
+		return q, nil
+	}
+	rendered, err := filter.render(entity)
+	if err != nil {
+		return q, err
+	}
+	return q.Where(rendered.sql, rendered.args...), nil
+}
+
+// selectedProperties returns the properties in $select, or all properties if $select is empty
+func selectedProperties(entity *entityType, selects []string) ([]property, error) {
+	if len(selects) == 0 {
+		return entity.properties, nil
+	}
+	selected := []property{}
+	for _, name := range selects {
+		if name == "id" || name == "@iot.id" {
+			continue
+		}
+		if _, isNavigation := entity.navigation(name); isNavigation {
+			continue
+		}
+		prop, ok := entity.property(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has no property %s", ErrQueryInvalid, entity.name, name)
+		}
+		selected = append(selected, prop)
+	}
+	return selected, nil
+}
+
+// normalizeValue converts database values that do not marshal to their JSON representation
+func normalizeValue(value any) any {
+	if id, ok := value.([16]byte); ok {
+		return uuid.UUID(id)
+	}
+	return value
+}
@@ -0,0 +1,258 @@
+package sensorthings_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/sensorthings"
+)
+
+const baseURL = "http://localhost/api/sta/v1.1"
+
+func TestReadCollectionShouldScopeToTenantAndPaginate(t *testing.T) {
+	store := &StoreMock{
+		QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{
+				{"@iot.id": int64(1), "name": "device-1"},
+				{"@iot.id": int64(2), "name": "device-2"},
+				{"@iot.id": int64(3), "name": "device-3"},
+			}, nil
+		},
+	}
+	svc := sensorthings.NewService(store)
+
+	result, err := svc.Read(authtest.GodContext(), baseURL, "Things", "$top=2&$skip=4&$select=name")
+	require.NoError(t, err)
+
+	require.Len(t, store.QueryCalls(), 1)
+	call := store.QueryCalls()[0]
+	assert.Contains(t, call.Query, "FROM devices WHERE (devices.tenant_id = $1)")
+	assert.Contains(t, call.Query, "LIMIT 3 OFFSET 4")
+	assert.Equal(t, []any{authtest.DefaultTenantID}, call.Args)
+
+	response := result.(map[string]any)
+	things := response["value"].([]map[string]any)
+	require.Len(t, things, 2)
+	assert.Equal(t, map[string]any{
+		"@iot.id":       int64(1),
+		"@iot.selfLink": baseURL + "/Things(1)",
+		"name":          "device-1",
+	}, things[0])
+	nextLink, err := url.Parse(response["@iot.nextLink"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "/api/sta/v1.1/Things", nextLink.Path)
+	assert.Equal(t, "2", nextLink.Query().Get("$top"))
+	assert.Equal(t, "6", nextLink.Query().Get("$skip"))
+}
+
+func TestReadEntityShouldIncludeNavigationLinks(t *testing.T) {
+	id := uuid.New()
+	store := &StoreMock{
+		QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{{"@iot.id": [16]byte(id), "name": "temperature"}}, nil
+		},
+	}
+	svc := sensorthings.NewService(store)
+
+	result, err := svc.Read(authtest.GodContext(), baseURL, "Datastreams('"+id.String()+"')", "")
+	require.NoError(t, err)
+
+	call := store.QueryCalls()[0]
+	assert.Contains(t, call.Query, "datastreams.id = $2")
+	assert.Equal(t, []any{authtest.DefaultTenantID, id}, call.Args)
+
+	datastream := result.(map[string]any)
+	selfLink := baseURL + "/Datastreams('" + id.String() + "')"
+	assert.Equal(t, id, datastream["@iot.id"])
+	assert.Equal(t, selfLink, datastream["@iot.selfLink"])
+	assert.Equal(t, selfLink+"/Thing", datastream["Thing@iot.navigationLink"])
+	assert.Equal(t, selfLink+"/Observations", datastream["Observations@iot.navigationLink"])
+}
+
+func TestReadEntityShouldReturnNotFound(t *testing.T) {
+	store := &StoreMock{
+		QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{}, nil
+		},
+	}
+	svc := sensorthings.NewService(store)
+
+	_, err := svc.Read(authtest.GodContext(), baseURL, "Things(5)", "")
+	assert.ErrorIs(t, err, sensorthings.ErrEntityNotFound)
+}
+
+func TestReadShouldFollowNavigationPath(t *testing.T) {
+	store := &StoreMock{
+		QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{}, nil
+		},
+	}
+	svc := sensorthings.NewService(store)
+
+	_, err := svc.Read(authtest.GodContext(), baseURL, "Things(1)/Datastreams", "")
+	require.NoError(t, err)
+
+	call := store.QueryCalls()[0]
+	assert.Contains(t, call.Query, "FROM datastreams WHERE (datastreams.tenant_id = $1 AND "+
+		"datastreams.sensor_id IN (SELECT sensors.id FROM sensors WHERE sensors.device_id IN ("+
+		"SELECT devices.id FROM devices WHERE (devices.tenant_id = $2 AND devices.id = $3))))")
+	assert.Equal(t, []any{authtest.DefaultTenantID, authtest.DefaultTenantID, int64(1)}, call.Args)
+}
+
+func TestReadShouldExpandNavigations(t *testing.T) {
+	datastreamIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &StoreMock{
+		QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(query, "FROM measurements") {
+				return []map[string]any{
+					{"@parent": datastreamIDs[1].String(), "@iot.id": int64(7), "result": 1.5, "phenomenonTime": timestamp},
+				}, nil
+			}
+			return []map[string]any{
+				{"@iot.id": [16]byte(datastreamIDs[0]), "@key.0": [16]byte(datastreamIDs[0])},
+				{"@iot.id": [16]byte(datastreamIDs[1]), "@key.0": [16]byte(datastreamIDs[1])},
+			}, nil
+		},
+	}
+	svc := sensorthings.NewService(store)
+
+	result, err := svc.Read(authtest.GodContext(), baseURL, "Datastreams",
+		"$select=id&$expand=Observations($top=1;$select=result,phenomenonTime;$orderby=phenomenonTime%20desc)",
+	)
+	require.NoError(t, err)
+
+	calls := store.QueryCalls()
+	require.Len(t, calls, 2, "observations of all datastreams should be read at once")
+	assert.Contains(t, calls[1].Query, "FROM unnest($1::text[]) AS parent(key) CROSS JOIN LATERAL")
+	assert.Contains(t, calls[1].Query, "measurements.datastream_id IN (parent.key::uuid)")
+	assert.Contains(t, calls[1].Query, "ORDER BY measurements.measurement_timestamp DESC, measurements.id LIMIT 1 OFFSET 0")
+	assert.Equal(t, []any{
+		[]string{datastreamIDs[0].String(), datastreamIDs[1].String()}, authtest.DefaultTenantID,
+	}, calls[1].Args)
+
+	datastreams := result.(map[string]any)["value"].([]map[string]any)
+	require.Len(t, datastreams, 2)
+	assert.Empty(t, datastreams[0]["Observations"])
+	observations := datastreams[1]["Observations"].([]map[string]any)
+	require.Len(t, observations, 1)
+	assert.Equal(t, 1.5, observations[0]["result"])
+	assert.Equal(t, baseURL+"/Observations(7)", observations[0]["@iot.selfLink"])
+}
+
+func TestReadShouldTranslateFilter(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		path   string
+		filter string
+		sql    string
+		args   []any
+	}{
+		{
+			path:   "Things",
+			filter: "name eq 'it''s' and not (description ne 'x')",
+			sql:    "((devices.code = $2::text) AND NOT ((devices.description <> $3::text)))",
+			args:   []any{"it's", "x"},
+		},
+		{
+			path:   "Observations",
+			filter: "result gt 10 or phenomenonTime ge 2024-01-01T00:00:00Z",
+			sql:    "((measurements.measurement_value > $2::float8) OR (measurements.measurement_timestamp >= $3::timestamptz))",
+			args:   []any{10.0, timestamp},
+		},
+		{
+			path:   "Things",
+			filter: "properties/room/floor eq 2",
+			sql:    "(((devices.properties)::jsonb #> $2::text[]) = to_jsonb($3::float8))",
+			args:   []any{[]string{"room", "floor"}, 2.0},
+		},
+		{
+			path:   "Things",
+			filter: "endswith(tolower(name), 'x')",
+			sql:    "(right(lower(devices.code), length($2::text)) = $3::text)",
+			args:   []any{"x", "x"},
+		},
+		{
+			path:   "Observations",
+			filter: "year(phenomenonTime) eq 2024 and parameters/unit eq null",
+			sql: "((extract(year FROM measurements.measurement_timestamp) = $2::float8) AND " +
+				"(((measurements.measurement_properties)::jsonb #> $3::text[]) IS NULL))",
+			args: []any{2024.0, []string{"unit"}},
+		},
+		{
+			path:   "Datastreams",
+			filter: "id eq 'abc'",
+			sql:    "(datastreams.id::text = $2::text)",
+			args:   []any{"abc"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.filter, func(t *testing.T) {
+			store := &StoreMock{
+				QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+					return []map[string]any{}, nil
+				},
+			}
+			svc := sensorthings.NewService(store)
+
+			_, err := svc.Read(authtest.GodContext(), baseURL, tC.path, "$filter="+url.QueryEscape(tC.filter))
+			require.NoError(t, err)
+
+			call := store.QueryCalls()[0]
+			assert.Contains(t, call.Query, " AND "+tC.sql)
+			assert.Equal(t, append([]any{authtest.DefaultTenantID}, tC.args...), call.Args)
+		})
+	}
+}
+
+func TestReadShouldRejectInvalidRequests(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		path  string
+		query string
+		err   error
+	}{
+		{desc: "unknown entity set", path: "Devices", err: sensorthings.ErrPathNotFound},
+		{desc: "unknown navigation", path: "Things(1)/Observations", err: sensorthings.ErrPathNotFound},
+		{desc: "navigation from collection", path: "Things/Datastreams", err: sensorthings.ErrPathInvalid},
+		{desc: "invalid id", path: "Datastreams(1)", err: sensorthings.ErrPathInvalid},
+		{desc: "negative top", path: "Things", query: "$top=-1", err: sensorthings.ErrQueryInvalid},
+		{desc: "unknown option", path: "Things", query: "$search=x", err: sensorthings.ErrQueryInvalid},
+		{desc: "unknown expand", path: "Things", query: "$expand=Observations", err: sensorthings.ErrQueryInvalid},
+		{desc: "invalid orderby", path: "Things", query: "$orderby=name up", err: sensorthings.ErrQueryInvalid},
+		{desc: "unknown property", path: "Things", query: "$filter=color eq 'red'", err: sensorthings.ErrFilterInvalid},
+		{desc: "unterminated string", path: "Things", query: "$filter=name eq 'red", err: sensorthings.ErrFilterInvalid},
+		{desc: "arithmetic", path: "Observations", query: "$filter=result add 1 eq 2", err: sensorthings.ErrFilterUnsupported},
+		{desc: "navigation filter", path: "Datastreams", query: "$filter=Thing/name eq 'x'", err: sensorthings.ErrFilterUnsupported},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			svc := sensorthings.NewService(&StoreMock{
+				QueryFunc: func(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+					return []map[string]any{}, nil
+				},
+			})
+			_, err := svc.Read(authtest.GodContext(), baseURL, tC.path, tC.query)
+			assert.ErrorIs(t, err, tC.err)
+		})
+	}
+}
+
+func TestReadShouldRequirePermissions(t *testing.T) {
+	svc := sensorthings.NewService(&StoreMock{})
+	ctx := auth.CreateAuthenticatedContextForTESTING(context.Background(), "user", 10, auth.Permissions{auth.READ_MEASUREMENTS})
+
+	_, err := svc.Read(ctx, baseURL, "Datastreams('"+uuid.NewString()+"')/Thing", "")
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = svc.Read(ctx, baseURL, "Observations", "$expand=Datastream/Thing")
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+}
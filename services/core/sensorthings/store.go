@@ -0,0 +1,33 @@
+package sensorthings
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var _ Store = (*StorePSQL)(nil)
+
+type StorePSQL struct {
+	databasePool *pgxpool.Pool
+}
+
+func NewStorePSQL(pool *pgxpool.Pool) *StorePSQL {
+	return &StorePSQL{
+		databasePool: pool,
+	}
+}
+
+func (store *StorePSQL) Query(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+	rows, err := store.databasePool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("while querying database: %w", err)
+	}
+	result, err := pgx.CollectRows(rows, pgx.RowToMap)
+	if err != nil {
+		return nil, fmt.Errorf("while scanning rows: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package coretransport
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"sensorbucket.nl/sensorbucket/internal/httpfilter"
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
+)
+
+func (transport *CoreTransport) httpListAlertRules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[pagination.Request](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		page, err := transport.alertingService.ListRules(r.Context(), params)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
+
+func (transport *CoreTransport) httpCreateAlertRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto alerting.CreateRuleOpts
+		if err := web.DecodeJSON(r, &dto); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		rule, err := transport.alertingService.CreateRule(r.Context(), dto)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: "Created alert rule",
+			Data:    rule,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetAlertRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Alert rule ID must be a number",
+			})
+			return
+		}
+		rule, err := transport.alertingService.GetRule(r.Context(), id)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched alert rule",
+			Data:    rule,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpDeleteAlertRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Alert rule ID must be a number",
+			})
+			return
+		}
+		if err := transport.alertingService.DeleteRule(r.Context(), id); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Deleted alert rule",
+		})
+	}
+}
+
+func (transport *CoreTransport) httpListAlerts() http.HandlerFunc {
+	type Params struct {
+		alerting.AlertFilter
+		pagination.Request
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[Params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		page, err := transport.alertingService.ListAlerts(r.Context(), params.AlertFilter, params.Request)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
@@ -1,7 +1,13 @@
 package coretransport
 
 import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -77,6 +83,12 @@ func (transport *CoreTransport) httpListDatastream() http.HandlerFunc {
 	type params struct {
 		measurements.DatastreamFilter
 		pagination.Request
+		// Stats includes the statistics of every datastream in the time range of the stats parameters
+		Stats           bool      `url:"stats"`
+		StatsStart      time.Time `url:"stats_start"`
+		StatsEnd        time.Time `url:"stats_end"`
+		StatsBuckets    int       `url:"stats_buckets"`
+		StatsResolution string    `url:"stats_resolution"`
 	}
 	return func(rw http.ResponseWriter, r *http.Request) {
 		params, err := httpfilter.Parse[params](r)
@@ -85,7 +97,44 @@ func (transport *CoreTransport) httpListDatastream() http.HandlerFunc {
 			return
 		}
 
-		page, err := transport.measurementService.ListDatastreams(r.Context(), params.DatastreamFilter, params.Request)
+		var page *pagination.Page[measurements.Datastream]
+		if params.Stats {
+			resolution, err := measurements.ParseResolution(params.StatsResolution)
+			if err != nil {
+				web.HTTPError(rw, err)
+				return
+			}
+			page, err = transport.measurementService.ListDatastreamsWithStats(r.Context(), params.DatastreamFilter,
+				measurements.StatsOptions{
+					Start: params.StatsStart, End: params.StatsEnd, Buckets: params.StatsBuckets, Resolution: resolution,
+				},
+				params.Request,
+			)
+		} else {
+			page, err = transport.measurementService.ListDatastreams(r.Context(), params.DatastreamFilter, params.Request)
+		}
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		web.HTTPResponse(rw, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
+
+func (transport *CoreTransport) httpListLatestMeasurements() http.HandlerFunc {
+	type params struct {
+		measurements.DatastreamFilter
+		pagination.Request
+		Unit string `url:"unit"`
+	}
+	return func(rw http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		page, err := transport.measurementService.ListLatestMeasurements(r.Context(), params.DatastreamFilter, params.Unit, params.Request)
 		if err != nil {
 			web.HTTPError(rw, err)
 			return
@@ -93,3 +142,519 @@ func (transport *CoreTransport) httpListDatastream() http.HandlerFunc {
 		web.HTTPResponse(rw, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
 	}
 }
+
+func (transport *CoreTransport) httpAggregateDatastream() http.HandlerFunc {
+	type params struct {
+		Start      time.Time `url:"start"`
+		End        time.Time `url:"end"`
+		Interval   string    `url:"interval"`
+		Functions  []string  `url:"fn"`
+		Fill       string    `url:"fill"`
+		Unit       string    `url:"unit"`
+		Resolution string    `url:"resolution"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		// Without an interval, the service chooses one based on the time range
+		var interval time.Duration
+		if params.Interval != "" {
+			interval, err = measurements.ParseInterval(params.Interval)
+			if err != nil {
+				web.HTTPError(w, err)
+				return
+			}
+		}
+		resolution, err := measurements.ParseResolution(params.Resolution)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		functions, err := measurements.ParseAggregateFunctions(params.Functions)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		fill, fillValue, err := measurements.ParseFill(params.Fill)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		aggregates, err := transport.measurementService.AggregateDatastream(r.Context(), id,
+			measurements.Filter{Start: params.Start, End: params.End, Unit: params.Unit},
+			measurements.AggregationOptions{
+				Interval: interval, Functions: functions, Fill: fill, FillValue: fillValue, Resolution: resolution,
+			},
+		)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Aggregated datastream measurements",
+			Data:    aggregates,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpAlignDatastreams() http.HandlerFunc {
+	type params struct {
+		Start      time.Time `url:"start"`
+		End        time.Time `url:"end"`
+		Interval   string    `url:"interval"`
+		Columns    []string  `url:"column"`
+		Resolution string    `url:"resolution"`
+		Format     string    `url:"format"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		var interval time.Duration
+		if params.Interval != "" {
+			interval, err = measurements.ParseInterval(params.Interval)
+			if err != nil {
+				web.HTTPError(w, err)
+				return
+			}
+		}
+		resolution, err := measurements.ParseResolution(params.Resolution)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		columns := make([]measurements.AlignedColumn, 0, len(params.Columns))
+		for _, str := range params.Columns {
+			column, err := measurements.ParseAlignedColumn(str)
+			if err != nil {
+				web.HTTPError(w, err)
+				return
+			}
+			columns = append(columns, column)
+		}
+		format := strings.ToLower(params.Format)
+		if format != "" && format != "json" && format != "csv" {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Format is invalid, use one of: json, csv", "ERR_FORMAT_INVALID"))
+			return
+		}
+
+		table, err := transport.measurementService.AlignDatastreams(r.Context(),
+			measurements.Filter{Start: params.Start, End: params.End},
+			measurements.AlignOptions{Interval: interval, Columns: columns, Resolution: resolution},
+		)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		if format == "csv" {
+			writeExportHeaders(w, "aligned", "text/csv", "csv")
+			if err := writeAlignedCSV(w, table); err != nil {
+				log.Printf("align datastreams, error writing csv: %s\n", err)
+			}
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Aligned datastream measurements",
+			Data:    table,
+		})
+	}
+}
+
+// writeAlignedCSV writes a header with the timestamp and column names followed by a record per row, null values
+// are empty cells
+func writeAlignedCSV(w io.Writer, table *measurements.AlignedTable) error {
+	cw := csv.NewWriter(w)
+	record := make([]string, len(table.Columns)+1)
+	record[0] = "timestamp"
+	for ix, column := range table.Columns {
+		record[ix+1] = column.Name()
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		record[0] = row.Timestamp.Format(time.RFC3339Nano)
+		for ix, value := range row.Values {
+			record[ix+1] = ""
+			if value != nil {
+				record[ix+1] = strconv.FormatFloat(*value, 'f', -1, 64)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (transport *CoreTransport) httpSetDatastreamQualityRules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		var rules measurements.QualityRules
+		if err := web.DecodeJSON(r, &rules); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		if err := transport.measurementService.SetDatastreamQualityRules(r.Context(), id, rules); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Updated datastream quality rules",
+			Data:    rules,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetDatastreamCompleteness() http.HandlerFunc {
+	type params struct {
+		Start    time.Time `url:"start"`
+		End      time.Time `url:"end"`
+		Interval string    `url:"interval"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		opts := measurements.CompletenessOptions{Start: params.Start, End: params.End}
+		if params.Interval != "" {
+			opts.ExpectedInterval, err = measurements.ParseInterval(params.Interval)
+			if err != nil {
+				web.HTTPError(w, fmt.Errorf("%w: %s", measurements.ErrCompletenessIntervalInvalid, params.Interval))
+				return
+			}
+		}
+
+		report, err := transport.measurementService.GetDatastreamCompleteness(r.Context(), id, opts)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched datastream completeness",
+			Data:    report,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetDatastreamStats() http.HandlerFunc {
+	type params struct {
+		Start      time.Time `url:"start"`
+		End        time.Time `url:"end"`
+		Buckets    int       `url:"buckets"`
+		Resolution string    `url:"resolution"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		resolution, err := measurements.ParseResolution(params.Resolution)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		stats, err := transport.measurementService.GetDatastreamStats(r.Context(), id, measurements.StatsOptions{
+			Start:      params.Start,
+			End:        params.End,
+			Buckets:    params.Buckets,
+			Resolution: resolution,
+		})
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched datastream statistics",
+			Data:    stats,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpListWorstDatastreams() http.HandlerFunc {
+	type params struct {
+		Start time.Time `url:"start"`
+		End   time.Time `url:"end"`
+		Limit int       `url:"limit"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		summaries, err := transport.measurementService.ListWorstDatastreams(r.Context(), measurements.CompletenessOptions{
+			Start: params.Start,
+			End:   params.End,
+			Limit: params.Limit,
+		})
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Listed least complete datastreams",
+			Data:    summaries,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetDatastreamRetention() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		retention, err := transport.measurementService.GetDatastreamRetention(r.Context(), id)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched effective datastream retention",
+			Data:    retention,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpSetDatastreamArchiveTime() http.HandlerFunc {
+	type Body struct {
+		ArchiveTime *int `json:"archive_time"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		var body Body
+		if err := web.DecodeJSON(r, &body); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		if err := transport.measurementService.SetDatastreamArchiveTime(r.Context(), id, body.ArchiveTime); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Updated datastream archive time",
+			Data:    body,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpAddDatastreamMeasurements() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		list, err := decodeOneOrMany[measurements.NewMeasurement](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		submission, err := transport.measurementService.AddDatastreamMeasurements(r.Context(), id, list)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: "Added measurements to datastream",
+			Data:    submission,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpDeleteDatastreamMeasurements() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+		params, err := httpfilter.Parse[measurements.CorrectionRange](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		correction, err := transport.measurementService.DeleteMeasurements(r.Context(), id, params)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Deleted datastream measurements",
+			Data:    correction,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpOverwriteDatastreamMeasurements() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		var opts measurements.OverwriteMeasurementsOpts
+		if err := web.DecodeJSON(r, &opts); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		correction, err := transport.measurementService.OverwriteMeasurements(r.Context(), id, opts)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Overwrote datastream measurements",
+			Data:    correction,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpListDatastreamCorrections() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+		params, err := httpfilter.Parse[pagination.Request](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		page, err := transport.measurementService.ListCorrections(r.Context(), id, params)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
+
+func (transport *CoreTransport) httpCreateDerivedDatastream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var opts measurements.CreateDerivedDatastreamOpts
+		if err := web.DecodeJSON(r, &opts); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		derived, err := transport.measurementService.CreateDerivedDatastream(r.Context(), opts)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: "Created derived datastream",
+			Data:    derived,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetDatastreamDerivation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		derivation, err := transport.measurementService.GetDerivation(r.Context(), id)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched datastream derivation",
+			Data:    derivation,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpBackfillDerivedDatastream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			web.HTTPError(w, web.NewError(http.StatusBadRequest, "Invalid datastream ID", ""))
+			return
+		}
+
+		var params measurements.BackfillRange
+		if err := web.DecodeJSON(r, &params); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		backfill, err := transport.measurementService.BackfillDerivedDatastream(r.Context(), id, params)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Backfilled derived datastream",
+			Data:    backfill,
+		})
+	}
+}
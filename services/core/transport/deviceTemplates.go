@@ -0,0 +1,182 @@
+package coretransport
+
+import (
+	"fmt"
+	"net/http"
+
+	"sensorbucket.nl/sensorbucket/internal/httpfilter"
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/devices"
+)
+
+//
+// Device Templates
+//
+
+func (transport *CoreTransport) httpCreateDeviceTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req devices.NewDeviceTemplateOpts
+		if err := web.DecodeJSON(r, &req); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		template, err := transport.deviceService.CreateDeviceTemplate(r.Context(), req)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: fmt.Sprintf("Created device template '%s'", template.Name),
+			Data:    template,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpListDeviceTemplates() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := httpfilter.Parse[pagination.Request](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		page, err := transport.deviceService.ListDeviceTemplates(r.Context(), p)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
+
+// getDeviceTemplate fetches the device template with the id in the URL
+func (transport *CoreTransport) getDeviceTemplate(r *http.Request) (*devices.DeviceTemplate, error) {
+	id, err := urlParamInt64(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	return transport.deviceService.GetDeviceTemplate(r.Context(), id)
+}
+
+func (transport *CoreTransport) httpGetDeviceTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		template, err := transport.getDeviceTemplate(r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched device template",
+			Data:    template,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpDeleteDeviceTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		template, err := transport.getDeviceTemplate(r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		if err := transport.deviceService.DeleteDeviceTemplate(r.Context(), template); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{Message: "Deleted device template"})
+	}
+}
+
+func (transport *CoreTransport) httpUpdateDeviceTemplate() http.HandlerFunc {
+	type params struct {
+		Propagate bool `url:"propagate"`
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		var dto devices.UpdateDeviceTemplateOpts
+		if err := web.DecodeJSON(r, &dto); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		template, err := transport.getDeviceTemplate(r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		update, err := transport.deviceService.UpdateDeviceTemplate(r.Context(), template, dto, params.Propagate)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		message := "Updated device template"
+		if update.Propagated {
+			message = "Updated device template and its devices"
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: message,
+			Data:    update,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpPreviewDeviceTemplateUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto devices.UpdateDeviceTemplateOpts
+		if err := web.DecodeJSON(r, &dto); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		template, err := transport.getDeviceTemplate(r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		update, err := transport.deviceService.PreviewDeviceTemplateUpdate(r.Context(), template, dto)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Previewed device template update, nothing was changed",
+			Data:    update,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpCreateDeviceFromTemplate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req devices.NewDeviceOpts
+		if err := web.DecodeJSON(r, &req); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		template, err := transport.getDeviceTemplate(r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		dev, err := transport.deviceService.CreateDeviceFromTemplate(r.Context(), template, req)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: fmt.Sprintf("Created new device from template '%s'", template.Name),
+			Data:    dev,
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package coretransport
 
 import (
+	"encoding/json"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"sensorbucket.nl/sensorbucket/internal/httpfilter"
 	"sensorbucket.nl/sensorbucket/internal/pagination"
@@ -118,3 +123,171 @@ func (transport *CoreTransport) httpUpdateDevice() http.HandlerFunc {
 		})
 	}
 }
+
+func (transport *CoreTransport) httpImportDevices() http.HandlerFunc {
+	type params struct {
+		DryRun bool   `url:"dry_run"`
+		Mode   string `url:"mode"`
+	}
+	return func(rw http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		mode, err := devices.ParseImportMode(params.Mode)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		var imports []devices.ImportDevice
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("content-type"))
+		if mediaType == "text/csv" {
+			imports, err = devices.ParseImportCSV(r.Body)
+		} else {
+			err = web.DecodeJSON(r, &imports)
+		}
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		result, err := transport.deviceService.ImportDevices(r.Context(), imports, devices.ImportOptions{
+			DryRun: params.DryRun,
+			Mode:   mode,
+		})
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		status, message := http.StatusCreated, "Imported devices"
+		switch {
+		case result.DryRun:
+			status, message = http.StatusOK, "Validated devices, nothing was imported"
+		case result.Created == 0:
+			status, message = http.StatusUnprocessableEntity, "Devices are invalid, nothing was imported"
+		case result.Failed > 0:
+			message = "Imported valid devices, some devices are invalid"
+		}
+		web.HTTPResponse(rw, status, &web.APIResponseAny{
+			Message: message,
+			Data:    result,
+		})
+	}
+}
+
+type HTTPDeviceExportFilters struct {
+	devices.DeviceFilter
+	Format string `url:"format"`
+}
+
+func (transport *CoreTransport) httpExportDevices() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		filter, err := httpfilter.Parse[HTTPDeviceExportFilters](r)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		format := strings.ToLower(filter.Format)
+		if format != "" && format != "json" && format != "csv" {
+			web.HTTPError(rw, web.NewError(http.StatusBadRequest, "Format is invalid, use one of: json, csv", "ERR_FORMAT_INVALID"))
+			return
+		}
+
+		exports, err := transport.deviceService.ExportDevices(r.Context(), filter.DeviceFilter)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		if format == "csv" {
+			writeExportHeaders(rw, "devices", "text/csv", "csv")
+			err = devices.WriteImportCSV(rw, exports)
+		} else {
+			writeExportHeaders(rw, "devices", "application/json", "json")
+			err = json.NewEncoder(rw).Encode(exports)
+		}
+		if err != nil {
+			log.Printf("export devices, error writing response: %s\n", err)
+		}
+	}
+}
+
+type HTTPDeviceLocationFilters struct {
+	devices.DeviceLocationFilter
+	Format string `url:"format"`
+}
+
+// deviceLocationsResponse links to the rest of the track if the track has more locations than the limit
+type deviceLocationsResponse struct {
+	Message string           `json:"message"`
+	Links   pagination.Links `json:"links"`
+	Data    any              `json:"data"`
+}
+
+func (transport *CoreTransport) httpListDeviceLocations() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		dev := r.Context().Value(ctxDeviceKey).(*devices.Device)
+		filter, err := httpfilter.Parse[HTTPDeviceLocationFilters](r)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		format := strings.ToLower(filter.Format)
+		if format != "" && format != "linestring" && format != "points" {
+			web.HTTPError(rw, web.NewError(http.StatusBadRequest, "Format is invalid, use one of: linestring, points", "ERR_FORMAT_INVALID"))
+			return
+		}
+
+		track, err := transport.deviceService.ListDeviceLocations(r.Context(), dev, filter.DeviceLocationFilter)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		var data any = devices.LocationTrack(dev, track.Locations)
+		if format == "points" {
+			data = devices.LocationPoints(track.Locations)
+		}
+		var links pagination.Links
+		if track.Next != nil {
+			q := r.URL.Query()
+			q.Set("start", track.Next.Format(time.RFC3339Nano))
+			links.Next = transport.baseURL + r.URL.Path + "?" + q.Encode()
+		}
+		web.HTTPResponse(rw, http.StatusOK, &deviceLocationsResponse{
+			Message: "Fetched device locations",
+			Links:   links,
+			Data:    data,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetDeviceLocation() http.HandlerFunc {
+	type params struct {
+		At time.Time `url:"at"`
+	}
+	return func(rw http.ResponseWriter, r *http.Request) {
+		dev := r.Context().Value(ctxDeviceKey).(*devices.Device)
+		params, err := httpfilter.Parse[params](r)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		if params.At.IsZero() {
+			params.At = time.Now()
+		}
+
+		location, err := transport.deviceService.GetDeviceLocationAt(r.Context(), dev, params.At)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		web.HTTPResponse(rw, http.StatusOK, &web.APIResponseAny{
+			Message: "Fetched device location",
+			Data:    location,
+		})
+	}
+}
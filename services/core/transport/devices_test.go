@@ -112,18 +112,22 @@ func (s *IntegrationTestSuite) SetupSuite() {
 	// Create devices services
 	deviceStore := deviceinfra.NewPSQLStore(db)
 	sensorGroupStore := deviceinfra.NewPSQLSensorGroupStore(db)
-	s.devices = devices.New(deviceStore, sensorGroupStore, nil)
+	s.devices = devices.New(deviceStore, sensorGroupStore, nil, nil)
 
 	// Create measurements service
 	measurementStore := measurementsinfra.NewPSQL(pool)
-	s.measurements = measurements.New(measurementStore, 10, 1, authtest.JWKS())
+	s.measurements = measurements.New(measurementStore, 10, 1, authtest.JWKS(), nil)
 
 	// Create processing service
 	processingStore := processinginfra.NewPSQLStore(db)
 	s.processing = processing.New(processingStore, nil, nil)
 
 	// Create transport
-	s.transport = coretransport.New(baseURL, authtest.JWKS(), s.devices, s.measurements, s.processing, nil, nil)
+	s.transport = coretransport.New(baseURL, authtest.JWKS(), coretransport.Services{
+		Devices:      s.devices,
+		Measurements: s.measurements,
+		Processing:   s.processing,
+	})
 
 	// Create three groups
 	ctx := authtest.GodContext()
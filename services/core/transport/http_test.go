@@ -3,8 +3,10 @@ package coretransport_test
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,7 +27,7 @@ func TestShouldCheckAuthentication(t *testing.T) {
 	res := httptest.NewRecorder()
 
 	// Services can be nil since it shouldn't even reach them!
-	transport := coretransport.New("", nil, nil, nil, nil, nil, nil)
+	transport := coretransport.New("", nil, coretransport.Services{})
 
 	transport.ServeHTTP(res, req)
 
@@ -90,7 +92,7 @@ func TestMeasurementResponseShouldIncludeMeasurementID(t *testing.T) {
 			}, nil
 		},
 	}
-	transport := coretransport.New("", authtest.JWKS(), nil, measurementService, nil, nil, nil)
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
 
 	req, _ := http.NewRequest("GET", "/measurements", nil)
 	authtest.AuthenticateRequest(req)
@@ -105,6 +107,261 @@ func TestMeasurementResponseShouldIncludeMeasurementID(t *testing.T) {
 	assert.EqualValues(t, measurement, responseMeasurement)
 }
 
+func TestMeasurementExportShouldStreamSelectedColumns(t *testing.T) {
+	datastreamID := uuid.MustParse("cbf909c4-6a56-40e1-b7ce-cfd6e7bff573")
+	rows := []measurements.Measurement{
+		{ID: 1, DatastreamID: datastreamID, MeasurementTimestamp: mustParseTime("2024-10-07T09:00:00Z"), MeasurementValue: 1.5},
+		{ID: 2, DatastreamID: datastreamID, MeasurementTimestamp: mustParseTime("2024-10-07T10:00:00Z"), MeasurementValue: 2, MeasurementLatitude: lo.ToPtr(51.5)},
+	}
+	measurementService := &MeasurementServiceMock{
+		ExportMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+			for _, m := range rows {
+				if err := fn(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+
+	testCases := []struct {
+		desc        string
+		query       string
+		contentType string
+		expected    string
+	}{
+		{
+			desc:        "csv",
+			query:       "format=csv&columns=measurement_id,datastream_id&columns=measurement_value,measurement_latitude",
+			contentType: "text/csv",
+			expected: "measurement_id,datastream_id,measurement_value,measurement_latitude\n" +
+				"1,cbf909c4-6a56-40e1-b7ce-cfd6e7bff573,1.5,\n" +
+				"2,cbf909c4-6a56-40e1-b7ce-cfd6e7bff573,2,51.5\n",
+		},
+		{
+			desc:        "ndjson",
+			query:       "format=ndjson&columns=measurement_id,measurement_timestamp",
+			contentType: "application/x-ndjson",
+			expected: `{"measurement_id":1,"measurement_timestamp":"2024-10-07T09:00:00Z"}` + "\n" +
+				`{"measurement_id":2,"measurement_timestamp":"2024-10-07T10:00:00Z"}` + "\n",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/measurements/export?"+tC.query, nil)
+			authtest.AuthenticateRequest(req)
+			res := httptest.NewRecorder()
+
+			transport.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusOK, res.Result().StatusCode)
+			assert.Equal(t, tC.contentType, res.Header().Get("Content-Type"))
+			assert.Contains(t, res.Header().Get("Content-Disposition"), "attachment; filename=")
+			assert.Equal(t, tC.expected, res.Body.String())
+		})
+	}
+}
+
+func TestMeasurementExportShouldWriteParquet(t *testing.T) {
+	measurementService := &MeasurementServiceMock{
+		ExportMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+			return fn(measurements.Measurement{ID: 1, MeasurementValue: 1.5, MeasurementLatitude: lo.ToPtr(51.5)})
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+
+	req, _ := http.NewRequest("GET", "/measurements/export?format=parquet&columns=measurement_id,measurement_value,measurement_timestamp,device_properties", nil)
+	authtest.AuthenticateRequest(req)
+	res := httptest.NewRecorder()
+
+	transport.ServeHTTP(res, req)
+
+	require.Equal(t, http.StatusOK, res.Result().StatusCode)
+	assert.Equal(t, "application/vnd.apache.parquet", res.Header().Get("Content-Type"))
+	body := res.Body.Bytes()
+	require.Greater(t, len(body), 12)
+	assert.Equal(t, "PAR1", string(body[:4]))
+	assert.Equal(t, "PAR1", string(body[len(body)-4:]))
+	assert.Contains(t, string(body), "measurement_timestamp", "the footer describes the selected columns")
+}
+
+func TestMeasurementExportShouldOutlastTheServerWriteTimeout(t *testing.T) {
+	measurementService := &MeasurementServiceMock{
+		ExportMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+			for ix := 1; ix <= 3; ix++ {
+				time.Sleep(100 * time.Millisecond)
+				if err := fn(measurements.Measurement{ID: ix}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+	server := httptest.NewUnstartedServer(transport)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/measurements/export?format=csv&columns=measurement_id", nil)
+	authtest.AuthenticateRequest(req)
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err, "the export is not cut off by the write timeout")
+	assert.Equal(t, "measurement_id\n1\n2\n3\n", string(body))
+}
+
+func TestMeasurementExportShouldRejectUnknownColumns(t *testing.T) {
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: &MeasurementServiceMock{}})
+
+	req, _ := http.NewRequest("GET", "/measurements/export?columns=measurement_id,password", nil)
+	authtest.AuthenticateRequest(req)
+	res := httptest.NewRecorder()
+
+	transport.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusBadRequest, res.Result().StatusCode)
+}
+
+func TestMeasurementStreamShouldSendEvents(t *testing.T) {
+	datastreamID := uuid.New()
+	measurementService := &MeasurementServiceMock{
+		SubscribeMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.SubscriptionFilter) (<-chan measurements.Measurement, error) {
+			ch := make(chan measurements.Measurement, 2)
+			ch <- measurements.Measurement{ID: 1, DatastreamID: datastreamID, MeasurementValue: 1.5}
+			ch <- measurements.Measurement{ID: 2, DatastreamID: datastreamID, MeasurementValue: 2}
+			close(ch)
+			return ch, nil
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+
+	req, _ := http.NewRequest("GET", "/measurements/stream?datastream="+datastreamID.String()+"&device_id=5", nil)
+	authtest.AuthenticateRequest(req)
+	res := httptest.NewRecorder()
+
+	transport.ServeHTTP(res, req)
+
+	require.Equal(t, http.StatusOK, res.Result().StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header().Get("Content-Type"))
+	require.Len(t, measurementService.SubscribeMeasurementsCalls(), 1)
+	filter := measurementService.SubscribeMeasurementsCalls()[0].SubscriptionFilter
+	assert.Equal(t, []uuid.UUID{datastreamID}, filter.Datastream)
+	assert.Equal(t, []int64{5}, filter.DeviceID)
+
+	events := strings.Split(strings.TrimSpace(res.Body.String()), "\n\n")
+	require.Len(t, events, 2)
+	for ix, event := range events {
+		lines := strings.Split(event, "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, "event: measurement", lines[0])
+		var m measurements.Measurement
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &m))
+		assert.Equal(t, ix+1, m.ID)
+	}
+}
+
+func TestShouldParseSensorGroupAndProjectFilters(t *testing.T) {
+	measurementService := &MeasurementServiceMock{
+		QueryMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+			return &pagination.Page[measurements.Measurement]{Data: []measurements.Measurement{}}, nil
+		},
+		ListDatastreamsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
+			return &pagination.Page[measurements.Datastream]{Data: []measurements.Datastream{}}, nil
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+
+	for _, path := range []string{"/measurements", "/datastreams"} {
+		req, _ := http.NewRequest("GET", path+"?sensor_group=1&sensor_group=2&project=3", nil)
+		authtest.AuthenticateRequest(req)
+		res := httptest.NewRecorder()
+		transport.ServeHTTP(res, req)
+		require.Equal(t, http.StatusOK, res.Result().StatusCode, path)
+	}
+
+	require.Len(t, measurementService.QueryMeasurementsCalls(), 1)
+	filter := measurementService.QueryMeasurementsCalls()[0].Filter
+	assert.Equal(t, []int64{1, 2}, filter.SensorGroup)
+	assert.Equal(t, []int64{3}, filter.Project)
+	require.Len(t, measurementService.ListDatastreamsCalls(), 1)
+	dsFilter := measurementService.ListDatastreamsCalls()[0].DatastreamFilter
+	assert.Equal(t, []int64{1, 2}, dsFilter.SensorGroup)
+	assert.Equal(t, []int64{3}, dsFilter.Project)
+}
+
+func TestListDatastreamsShouldIncludeStatsWhenRequested(t *testing.T) {
+	measurementService := &MeasurementServiceMock{
+		ListDatastreamsWithStatsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, statsOptions measurements.StatsOptions, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
+			return &pagination.Page[measurements.Datastream]{Data: []measurements.Datastream{
+				{ID: uuid.New(), Stats: &measurements.DatastreamStats{Count: 3}},
+			}}, nil
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+
+	req, _ := http.NewRequest("GET", "/datastreams?stats=true&stats_start=2024-01-01T00:00:00Z&stats_buckets=5&stats_resolution=hour", nil)
+	authtest.AuthenticateRequest(req)
+	res := httptest.NewRecorder()
+	transport.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Result().StatusCode)
+
+	require.Len(t, measurementService.ListDatastreamsWithStatsCalls(), 1)
+	opts := measurementService.ListDatastreamsWithStatsCalls()[0].StatsOptions
+	assert.Equal(t, mustParseTime("2024-01-01T00:00:00Z"), opts.Start)
+	assert.True(t, opts.End.IsZero())
+	assert.Equal(t, 5, opts.Buckets)
+	assert.Equal(t, measurements.ResolutionHourly, opts.Resolution)
+
+	var body struct {
+		Data []measurements.Datastream `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, int64(3), body.Data[0].Stats.Count)
+}
+
+func TestAlignDatastreamsShouldWriteCSV(t *testing.T) {
+	id := uuid.New()
+	start := mustParseTime("2024-01-01T00:00:00Z")
+	measurementService := &MeasurementServiceMock{
+		AlignDatastreamsFunc: func(contextMoqParam context.Context, filter measurements.Filter, opts measurements.AlignOptions) (*measurements.AlignedTable, error) {
+			return &measurements.AlignedTable{
+				Columns: opts.Columns,
+				Rows: []measurements.AlignedRow{
+					{Timestamp: start, Values: []*float64{lo.ToPtr(1.5), nil}},
+					{Timestamp: start.Add(time.Hour), Values: []*float64{lo.ToPtr(2.0), lo.ToPtr(0.0)}},
+				},
+			}, nil
+		},
+	}
+	transport := coretransport.New("", authtest.JWKS(), coretransport.Services{Measurements: measurementService})
+
+	req, _ := http.NewRequest("GET", "/datastreams/aligned?start=2024-01-01T00:00:00Z&end=2024-01-01T01:00:00Z&interval=1h&column="+
+		id.String()+"&column="+id.String()+":count:previous&format=csv", nil)
+	authtest.AuthenticateRequest(req)
+	res := httptest.NewRecorder()
+	transport.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Result().StatusCode)
+	assert.Equal(t, "text/csv", res.Header().Get("Content-Type"))
+
+	require.Len(t, measurementService.AlignDatastreamsCalls(), 1)
+	call := measurementService.AlignDatastreamsCalls()[0]
+	assert.Equal(t, start, call.Filter.Start)
+	assert.Equal(t, time.Hour, call.AlignOptions.Interval)
+	assert.Equal(t, []measurements.AlignedColumn{
+		{Datastream: id, Function: measurements.AggregateAverage},
+		{Datastream: id, Function: measurements.AggregateCount, Fill: measurements.FillPrevious},
+	}, call.AlignOptions.Columns)
+
+	assert.Equal(t, "timestamp,"+id.String()+":avg,"+id.String()+":count\n"+
+		"2024-01-01T00:00:00Z,1.5,\n"+
+		"2024-01-01T01:00:00Z,2,0\n", res.Body.String())
+}
+
 func mustParseTime(s string) time.Time {
 	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
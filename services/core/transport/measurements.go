@@ -1,6 +1,8 @@
 package coretransport
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 
 	"sensorbucket.nl/sensorbucket/internal/httpfilter"
@@ -35,3 +37,76 @@ func (transport *CoreTransport) httpGetMeasurements() http.HandlerFunc {
 		web.HTTPResponse(rw, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
 	}
 }
+
+func (transport *CoreTransport) httpAddMeasurements() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := decodeOneOrMany[measurements.NewSensorMeasurement](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		submission, err := transport.measurementService.AddMeasurements(r.Context(), list)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: "Added measurements",
+			Data:    submission,
+		})
+	}
+}
+
+// decodeOneOrMany decodes a request body that is either a single JSON object or an array of objects
+func decodeOneOrMany[T any](r *http.Request) ([]T, error) {
+	var body json.RawMessage
+	if err := web.DecodeJSON(r, &body); err != nil {
+		return nil, err
+	}
+	var list []T
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, web.InvalidJSONError
+		}
+		return list, nil
+	}
+	var single T
+	if err := json.Unmarshal(body, &single); err != nil {
+		return nil, web.InvalidJSONError
+	}
+	return append(list, single), nil
+}
+
+func (transport *CoreTransport) httpGetRollupRetention() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		retention, err := transport.measurementService.GetRollupRetention(r.Context())
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched rollup retention",
+			Data:    retention,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpSetRollupRetention() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var retention measurements.RollupRetention
+		if err := web.DecodeJSON(r, &retention); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		if err := transport.measurementService.SetRollupRetention(r.Context(), retention); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Updated rollup retention",
+			Data:    retention,
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package coretransport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/httpfilter"
+	"sensorbucket.nl/sensorbucket/internal/parquet"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+var (
+	ErrExportFormatInvalid = web.NewError(http.StatusBadRequest, "Export format is invalid, use one of: csv, ndjson, parquet", "ERR_EXPORT_FORMAT_INVALID")
+	ErrExportColumnInvalid = web.NewError(http.StatusBadRequest, "Export column is invalid", "ERR_EXPORT_COLUMN_INVALID")
+)
+
+// exportFlushInterval is the amount of rows after which the response is flushed to the client
+const exportFlushInterval = 1000
+
+// exportColumn is a field of measurements.Measurement that can be exported, named after its JSON tag
+type exportColumn struct {
+	name  string
+	index int
+}
+
+var measurementExportColumns = func() []exportColumn {
+	t := reflect.TypeOf(measurements.Measurement{})
+	columns := make([]exportColumn, 0, t.NumField())
+	for ix := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(ix).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		columns = append(columns, exportColumn{name: name, index: ix})
+	}
+	return columns
+}()
+
+// selectExportColumns returns the columns by name in the given order, or all columns if no names are given.
+// Names may be comma separated.
+func selectExportColumns(names []string) ([]exportColumn, error) {
+	selected := []exportColumn{}
+	for _, name := range names {
+		for _, part := range strings.Split(name, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			column, ok := lookupExportColumn(part)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrExportColumnInvalid, part)
+			}
+			selected = append(selected, column)
+		}
+	}
+	if len(selected) == 0 {
+		return measurementExportColumns, nil
+	}
+	return selected, nil
+}
+
+func lookupExportColumn(name string) (exportColumn, bool) {
+	for _, column := range measurementExportColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return exportColumn{}, false
+}
+
+// measurementEncoder writes measurements in a specific export format
+type measurementEncoder interface {
+	Encode(measurements.Measurement) error
+	// Flush sends the encoded measurements to the client as far as the format allows
+	Flush() error
+	// Close finishes the export after the last measurement
+	Close() error
+}
+
+type csvMeasurementEncoder struct {
+	w       *csv.Writer
+	columns []exportColumn
+	record  []string
+	header  bool
+}
+
+func newCSVMeasurementEncoder(w http.ResponseWriter, columns []exportColumn) *csvMeasurementEncoder {
+	return &csvMeasurementEncoder{
+		w:       csv.NewWriter(w),
+		columns: columns,
+		record:  make([]string, len(columns)),
+	}
+}
+
+func (enc *csvMeasurementEncoder) writeHeader() error {
+	if enc.header {
+		return nil
+	}
+	enc.header = true
+	for ix, column := range enc.columns {
+		enc.record[ix] = column.name
+	}
+	return enc.w.Write(enc.record)
+}
+
+func (enc *csvMeasurementEncoder) Encode(m measurements.Measurement) error {
+	if err := enc.writeHeader(); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(m)
+	for ix, column := range enc.columns {
+		value, err := csvValue(v.Field(column.index))
+		if err != nil {
+			return err
+		}
+		enc.record[ix] = value
+	}
+	return enc.w.Write(enc.record)
+}
+
+func (enc *csvMeasurementEncoder) Flush() error {
+	if err := enc.writeHeader(); err != nil {
+		return err
+	}
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+func (enc *csvMeasurementEncoder) Close() error {
+	return enc.Flush()
+}
+
+// csvValue formats a field value as CSV cell, nil values result in an empty cell
+// and composite values are formatted as JSON
+func csvValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case time.Time:
+		return value.Format(time.RFC3339Nano), nil
+	case json.RawMessage:
+		return string(value), nil
+	case fmt.Stringer:
+		return value.String(), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Bool:
+		return fmt.Sprint(v.Interface()), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return "", nil
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	return string(data), err
+}
+
+type ndjsonMeasurementEncoder struct {
+	enc     *json.Encoder
+	columns []exportColumn
+	all     bool
+}
+
+func newNDJSONMeasurementEncoder(w http.ResponseWriter, columns []exportColumn) *ndjsonMeasurementEncoder {
+	return &ndjsonMeasurementEncoder{
+		enc:     json.NewEncoder(w),
+		columns: columns,
+		all:     len(columns) == len(measurementExportColumns),
+	}
+}
+
+func (enc *ndjsonMeasurementEncoder) Encode(m measurements.Measurement) error {
+	if enc.all {
+		return enc.enc.Encode(m)
+	}
+	v := reflect.ValueOf(m)
+	row := make(map[string]any, len(enc.columns))
+	for _, column := range enc.columns {
+		row[column.name] = v.Field(column.index).Interface()
+	}
+	return enc.enc.Encode(row)
+}
+
+func (enc *ndjsonMeasurementEncoder) Flush() error {
+	return nil
+}
+
+func (enc *ndjsonMeasurementEncoder) Close() error {
+	return nil
+}
+
+// parquetMeasurementEncoder writes measurements as Parquet file, a row group is sent to the client once it is full
+type parquetMeasurementEncoder struct {
+	w       *parquet.Writer
+	columns []exportColumn
+	types   []parquet.Type
+}
+
+func newParquetMeasurementEncoder(w http.ResponseWriter, columns []exportColumn) *parquetMeasurementEncoder {
+	t := reflect.TypeOf(measurements.Measurement{})
+	types := make([]parquet.Type, len(columns))
+	parquetColumns := make([]parquet.Column, len(columns))
+	for ix, column := range columns {
+		types[ix] = parquetType(t.Field(column.index).Type)
+		parquetColumns[ix] = parquet.Column{Name: column.name, Type: types[ix]}
+	}
+	return &parquetMeasurementEncoder{
+		w:       parquet.NewWriter(w, parquetColumns),
+		columns: columns,
+		types:   types,
+	}
+}
+
+func (enc *parquetMeasurementEncoder) Encode(m measurements.Measurement) error {
+	v := reflect.ValueOf(m)
+	row := make([]any, len(enc.columns))
+	for ix, column := range enc.columns {
+		value, err := parquetValue(v.Field(column.index), enc.types[ix])
+		if err != nil {
+			return err
+		}
+		row[ix] = value
+	}
+	return enc.w.Write(row)
+}
+
+func (enc *parquetMeasurementEncoder) Flush() error {
+	return nil
+}
+
+func (enc *parquetMeasurementEncoder) Close() error {
+	return enc.w.Close()
+}
+
+// parquetType is the Parquet column type of a measurement field, values without a matching type are exported
+// as they are formatted in CSV
+func parquetType(t reflect.Type) parquet.Type {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return parquet.Timestamp
+	case t == reflect.TypeOf(json.RawMessage{}) || t.Kind() == reflect.Map:
+		return parquet.JSON
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return parquet.Boolean
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint8, reflect.Uint32:
+		return parquet.Int64
+	case reflect.Float64:
+		return parquet.Double
+	}
+	return parquet.String
+}
+
+func parquetValue(v reflect.Value, typ parquet.Type) (any, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch typ {
+	case parquet.Timestamp:
+		return v.Interface().(time.Time), nil
+	case parquet.Boolean:
+		return v.Bool(), nil
+	case parquet.Double:
+		return v.Float(), nil
+	case parquet.Int64:
+		if v.CanUint() {
+			return int64(v.Uint()), nil
+		}
+		return v.Int(), nil
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil, nil
+	}
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	return csvValue(v)
+}
+
+func (transport *CoreTransport) httpExportMeasurements() http.HandlerFunc {
+	type Params struct {
+		measurements.Filter
+		Format  string   `url:"format"`
+		Columns []string `url:"columns"`
+	}
+	return func(rw http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[Params](r)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+		if !params.Start.IsZero() && !params.End.IsZero() && params.Start.After(params.End) {
+			web.HTTPError(rw, web.NewError(http.StatusBadRequest, "Start time cannot be after end time", "ERR_BAD_REQUEST"))
+			return
+		}
+		columns, err := selectExportColumns(params.Columns)
+		if err != nil {
+			web.HTTPError(rw, err)
+			return
+		}
+
+		var encoder measurementEncoder
+		var contentType, extension string
+		switch strings.ToLower(params.Format) {
+		case "", "csv":
+			encoder = newCSVMeasurementEncoder(rw, columns)
+			contentType, extension = "text/csv", "csv"
+		case "ndjson":
+			encoder = newNDJSONMeasurementEncoder(rw, columns)
+			contentType, extension = "application/x-ndjson", "ndjson"
+		case "parquet":
+			encoder = newParquetMeasurementEncoder(rw, columns)
+			contentType, extension = "application/vnd.apache.parquet", "parquet"
+		default:
+			web.HTTPError(rw, ErrExportFormatInvalid)
+			return
+		}
+
+		// An export takes as long as it takes to stream the measurements, unlike other responses
+		rc := http.NewResponseController(rw)
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		// Headers are written when the first measurement arrives, so that errors occuring
+		// before that point can still be reported with a proper status code
+		flusher, _ := rw.(http.Flusher)
+		count, started := 0, false
+		err = transport.measurementService.ExportMeasurements(r.Context(), params.Filter, func(m measurements.Measurement) error {
+			if !started {
+				writeExportHeaders(rw, "measurements", contentType, extension)
+				started = true
+			}
+			if err := encoder.Encode(m); err != nil {
+				return err
+			}
+			count++
+			if count%exportFlushInterval == 0 {
+				if err := encoder.Flush(); err != nil {
+					return err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			return nil
+		})
+		if err != nil && !started {
+			web.HTTPError(rw, err)
+			return
+		}
+		if err != nil {
+			// The response is already partially written, the best we can do is abort it
+			log.Printf("export measurements failed after %d rows: %s\n", count, err)
+			panic(http.ErrAbortHandler)
+		}
+		if !started {
+			writeExportHeaders(rw, "measurements", contentType, extension)
+		}
+		if err := encoder.Close(); err != nil {
+			log.Printf("export measurements, error finishing response: %s\n", err)
+		}
+	}
+}
+
+func writeExportHeaders(rw http.ResponseWriter, name, contentType, extension string) {
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(
+		`attachment; filename="%s-%s.%s"`, name, time.Now().UTC().Format("20060102T150405Z"), extension,
+	))
+	rw.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,74 @@
+package coretransport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/httpfilter"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+// streamKeepAliveInterval is the interval at which a comment is sent to keep idle streams open through proxies
+const streamKeepAliveInterval = 15 * time.Second
+
+// httpStreamMeasurements streams newly stored measurements as Server-Sent Events. Every measurement is sent
+// as a "measurement" event with the measurement as JSON data. The stream ends when the client disconnects or
+// falls too far behind, in which case the client should reconnect.
+func (transport *CoreTransport) httpStreamMeasurements() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := httpfilter.Parse[measurements.SubscriptionFilter](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		stream, err := transport.measurementService.SubscribeMeasurements(r.Context(), filter)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+
+		// The stream is open for as long as the client wants, unlike other responses
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(streamKeepAliveInterval)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case m, ok := <-stream:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(m)
+				if err != nil {
+					return
+				}
+				if _, err := fmt.Fprintf(w, "event: measurement\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -22,15 +22,81 @@ var _ coretransport.MeasurementService = &MeasurementServiceMock{}
 //
 //		// make and configure a mocked coretransport.MeasurementService
 //		mockedMeasurementService := &MeasurementServiceMock{
+//			AddDatastreamMeasurementsFunc: func(contextMoqParam context.Context, uUID uuid.UUID, newMeasurements []measurements.NewMeasurement) (*measurements.Submission, error) {
+//				panic("mock out the AddDatastreamMeasurements method")
+//			},
+//			AddMeasurementsFunc: func(contextMoqParam context.Context, newSensorMeasurements []measurements.NewSensorMeasurement) (*measurements.Submission, error) {
+//				panic("mock out the AddMeasurements method")
+//			},
+//			AggregateDatastreamFunc: func(contextMoqParam context.Context, uUID uuid.UUID, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+//				panic("mock out the AggregateDatastream method")
+//			},
+//			AlignDatastreamsFunc: func(contextMoqParam context.Context, filter measurements.Filter, alignOptions measurements.AlignOptions) (*measurements.AlignedTable, error) {
+//				panic("mock out the AlignDatastreams method")
+//			},
+//			BackfillDerivedDatastreamFunc: func(contextMoqParam context.Context, uUID uuid.UUID, backfillRange measurements.BackfillRange) (*measurements.Backfill, error) {
+//				panic("mock out the BackfillDerivedDatastream method")
+//			},
+//			CreateDerivedDatastreamFunc: func(contextMoqParam context.Context, createDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts) (*measurements.DerivedDatastream, error) {
+//				panic("mock out the CreateDerivedDatastream method")
+//			},
+//			DeleteMeasurementsFunc: func(contextMoqParam context.Context, uUID uuid.UUID, correctionRange measurements.CorrectionRange) (*measurements.Correction, error) {
+//				panic("mock out the DeleteMeasurements method")
+//			},
+//			ExportMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+//				panic("mock out the ExportMeasurements method")
+//			},
 //			GetDatastreamFunc: func(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Datastream, error) {
 //				panic("mock out the GetDatastream method")
 //			},
+//			GetDatastreamCompletenessFunc: func(contextMoqParam context.Context, uUID uuid.UUID, completenessOptions measurements.CompletenessOptions) (*measurements.Completeness, error) {
+//				panic("mock out the GetDatastreamCompleteness method")
+//			},
+//			GetDatastreamRetentionFunc: func(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Retention, error) {
+//				panic("mock out the GetDatastreamRetention method")
+//			},
+//			GetDatastreamStatsFunc: func(contextMoqParam context.Context, uUID uuid.UUID, statsOptions measurements.StatsOptions) (*measurements.DatastreamStats, error) {
+//				panic("mock out the GetDatastreamStats method")
+//			},
+//			GetDerivationFunc: func(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Derivation, error) {
+//				panic("mock out the GetDerivation method")
+//			},
+//			GetRollupRetentionFunc: func(contextMoqParam context.Context) (*measurements.RollupRetention, error) {
+//				panic("mock out the GetRollupRetention method")
+//			},
+//			ListCorrectionsFunc: func(contextMoqParam context.Context, uUID uuid.UUID, request pagination.Request) (*pagination.Page[measurements.Correction], error) {
+//				panic("mock out the ListCorrections method")
+//			},
 //			ListDatastreamsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
 //				panic("mock out the ListDatastreams method")
 //			},
+//			ListDatastreamsWithStatsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, statsOptions measurements.StatsOptions, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
+//				panic("mock out the ListDatastreamsWithStats method")
+//			},
+//			ListLatestMeasurementsFunc: func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, s string, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+//				panic("mock out the ListLatestMeasurements method")
+//			},
+//			ListWorstDatastreamsFunc: func(contextMoqParam context.Context, completenessOptions measurements.CompletenessOptions) ([]measurements.CompletenessSummary, error) {
+//				panic("mock out the ListWorstDatastreams method")
+//			},
+//			OverwriteMeasurementsFunc: func(contextMoqParam context.Context, uUID uuid.UUID, overwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts) (*measurements.Correction, error) {
+//				panic("mock out the OverwriteMeasurements method")
+//			},
 //			QueryMeasurementsFunc: func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
 //				panic("mock out the QueryMeasurements method")
 //			},
+//			SetDatastreamArchiveTimeFunc: func(contextMoqParam context.Context, uUID uuid.UUID, n *int) error {
+//				panic("mock out the SetDatastreamArchiveTime method")
+//			},
+//			SetDatastreamQualityRulesFunc: func(contextMoqParam context.Context, uUID uuid.UUID, qualityRules measurements.QualityRules) error {
+//				panic("mock out the SetDatastreamQualityRules method")
+//			},
+//			SetRollupRetentionFunc: func(contextMoqParam context.Context, rollupRetention measurements.RollupRetention) error {
+//				panic("mock out the SetRollupRetention method")
+//			},
+//			SubscribeMeasurementsFunc: func(contextMoqParam context.Context, subscriptionFilter measurements.SubscriptionFilter) (<-chan measurements.Measurement, error) {
+//				panic("mock out the SubscribeMeasurements method")
+//			},
 //		}
 //
 //		// use mockedMeasurementService in code that requires coretransport.MeasurementService
@@ -38,17 +104,153 @@ var _ coretransport.MeasurementService = &MeasurementServiceMock{}
 //
 //	}
 type MeasurementServiceMock struct {
+	// AddDatastreamMeasurementsFunc mocks the AddDatastreamMeasurements method.
+	AddDatastreamMeasurementsFunc func(contextMoqParam context.Context, uUID uuid.UUID, newMeasurements []measurements.NewMeasurement) (*measurements.Submission, error)
+
+	// AddMeasurementsFunc mocks the AddMeasurements method.
+	AddMeasurementsFunc func(contextMoqParam context.Context, newSensorMeasurements []measurements.NewSensorMeasurement) (*measurements.Submission, error)
+
+	// AggregateDatastreamFunc mocks the AggregateDatastream method.
+	AggregateDatastreamFunc func(contextMoqParam context.Context, uUID uuid.UUID, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error)
+
+	// AlignDatastreamsFunc mocks the AlignDatastreams method.
+	AlignDatastreamsFunc func(contextMoqParam context.Context, filter measurements.Filter, alignOptions measurements.AlignOptions) (*measurements.AlignedTable, error)
+
+	// BackfillDerivedDatastreamFunc mocks the BackfillDerivedDatastream method.
+	BackfillDerivedDatastreamFunc func(contextMoqParam context.Context, uUID uuid.UUID, backfillRange measurements.BackfillRange) (*measurements.Backfill, error)
+
+	// CreateDerivedDatastreamFunc mocks the CreateDerivedDatastream method.
+	CreateDerivedDatastreamFunc func(contextMoqParam context.Context, createDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts) (*measurements.DerivedDatastream, error)
+
+	// DeleteMeasurementsFunc mocks the DeleteMeasurements method.
+	DeleteMeasurementsFunc func(contextMoqParam context.Context, uUID uuid.UUID, correctionRange measurements.CorrectionRange) (*measurements.Correction, error)
+
+	// ExportMeasurementsFunc mocks the ExportMeasurements method.
+	ExportMeasurementsFunc func(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error
+
 	// GetDatastreamFunc mocks the GetDatastream method.
 	GetDatastreamFunc func(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Datastream, error)
 
+	// GetDatastreamCompletenessFunc mocks the GetDatastreamCompleteness method.
+	GetDatastreamCompletenessFunc func(contextMoqParam context.Context, uUID uuid.UUID, completenessOptions measurements.CompletenessOptions) (*measurements.Completeness, error)
+
+	// GetDatastreamRetentionFunc mocks the GetDatastreamRetention method.
+	GetDatastreamRetentionFunc func(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Retention, error)
+
+	// GetDatastreamStatsFunc mocks the GetDatastreamStats method.
+	GetDatastreamStatsFunc func(contextMoqParam context.Context, uUID uuid.UUID, statsOptions measurements.StatsOptions) (*measurements.DatastreamStats, error)
+
+	// GetDerivationFunc mocks the GetDerivation method.
+	GetDerivationFunc func(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Derivation, error)
+
+	// GetRollupRetentionFunc mocks the GetRollupRetention method.
+	GetRollupRetentionFunc func(contextMoqParam context.Context) (*measurements.RollupRetention, error)
+
+	// ListCorrectionsFunc mocks the ListCorrections method.
+	ListCorrectionsFunc func(contextMoqParam context.Context, uUID uuid.UUID, request pagination.Request) (*pagination.Page[measurements.Correction], error)
+
 	// ListDatastreamsFunc mocks the ListDatastreams method.
 	ListDatastreamsFunc func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error)
 
+	// ListDatastreamsWithStatsFunc mocks the ListDatastreamsWithStats method.
+	ListDatastreamsWithStatsFunc func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, statsOptions measurements.StatsOptions, request pagination.Request) (*pagination.Page[measurements.Datastream], error)
+
+	// ListLatestMeasurementsFunc mocks the ListLatestMeasurements method.
+	ListLatestMeasurementsFunc func(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, s string, request pagination.Request) (*pagination.Page[measurements.Measurement], error)
+
+	// ListWorstDatastreamsFunc mocks the ListWorstDatastreams method.
+	ListWorstDatastreamsFunc func(contextMoqParam context.Context, completenessOptions measurements.CompletenessOptions) ([]measurements.CompletenessSummary, error)
+
+	// OverwriteMeasurementsFunc mocks the OverwriteMeasurements method.
+	OverwriteMeasurementsFunc func(contextMoqParam context.Context, uUID uuid.UUID, overwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts) (*measurements.Correction, error)
+
 	// QueryMeasurementsFunc mocks the QueryMeasurements method.
 	QueryMeasurementsFunc func(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error)
 
+	// SetDatastreamArchiveTimeFunc mocks the SetDatastreamArchiveTime method.
+	SetDatastreamArchiveTimeFunc func(contextMoqParam context.Context, uUID uuid.UUID, n *int) error
+
+	// SetDatastreamQualityRulesFunc mocks the SetDatastreamQualityRules method.
+	SetDatastreamQualityRulesFunc func(contextMoqParam context.Context, uUID uuid.UUID, qualityRules measurements.QualityRules) error
+
+	// SetRollupRetentionFunc mocks the SetRollupRetention method.
+	SetRollupRetentionFunc func(contextMoqParam context.Context, rollupRetention measurements.RollupRetention) error
+
+	// SubscribeMeasurementsFunc mocks the SubscribeMeasurements method.
+	SubscribeMeasurementsFunc func(contextMoqParam context.Context, subscriptionFilter measurements.SubscriptionFilter) (<-chan measurements.Measurement, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
+		// AddDatastreamMeasurements holds details about calls to the AddDatastreamMeasurements method.
+		AddDatastreamMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// NewMeasurements is the newMeasurements argument value.
+			NewMeasurements []measurements.NewMeasurement
+		}
+		// AddMeasurements holds details about calls to the AddMeasurements method.
+		AddMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// NewSensorMeasurements is the newSensorMeasurements argument value.
+			NewSensorMeasurements []measurements.NewSensorMeasurement
+		}
+		// AggregateDatastream holds details about calls to the AggregateDatastream method.
+		AggregateDatastream []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// Filter is the filter argument value.
+			Filter measurements.Filter
+			// AggregationOptions is the aggregationOptions argument value.
+			AggregationOptions measurements.AggregationOptions
+		}
+		// AlignDatastreams holds details about calls to the AlignDatastreams method.
+		AlignDatastreams []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// Filter is the filter argument value.
+			Filter measurements.Filter
+			// AlignOptions is the alignOptions argument value.
+			AlignOptions measurements.AlignOptions
+		}
+		// BackfillDerivedDatastream holds details about calls to the BackfillDerivedDatastream method.
+		BackfillDerivedDatastream []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// BackfillRange is the backfillRange argument value.
+			BackfillRange measurements.BackfillRange
+		}
+		// CreateDerivedDatastream holds details about calls to the CreateDerivedDatastream method.
+		CreateDerivedDatastream []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// CreateDerivedDatastreamOpts is the createDerivedDatastreamOpts argument value.
+			CreateDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts
+		}
+		// DeleteMeasurements holds details about calls to the DeleteMeasurements method.
+		DeleteMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// CorrectionRange is the correctionRange argument value.
+			CorrectionRange measurements.CorrectionRange
+		}
+		// ExportMeasurements holds details about calls to the ExportMeasurements method.
+		ExportMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// Filter is the filter argument value.
+			Filter measurements.Filter
+			// Fn is the fn argument value.
+			Fn func(measurements.Measurement) error
+		}
 		// GetDatastream holds details about calls to the GetDatastream method.
 		GetDatastream []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -56,6 +258,52 @@ type MeasurementServiceMock struct {
 			// UUID is the uUID argument value.
 			UUID uuid.UUID
 		}
+		// GetDatastreamCompleteness holds details about calls to the GetDatastreamCompleteness method.
+		GetDatastreamCompleteness []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// CompletenessOptions is the completenessOptions argument value.
+			CompletenessOptions measurements.CompletenessOptions
+		}
+		// GetDatastreamRetention holds details about calls to the GetDatastreamRetention method.
+		GetDatastreamRetention []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+		}
+		// GetDatastreamStats holds details about calls to the GetDatastreamStats method.
+		GetDatastreamStats []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// StatsOptions is the statsOptions argument value.
+			StatsOptions measurements.StatsOptions
+		}
+		// GetDerivation holds details about calls to the GetDerivation method.
+		GetDerivation []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+		}
+		// GetRollupRetention holds details about calls to the GetRollupRetention method.
+		GetRollupRetention []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+		}
+		// ListCorrections holds details about calls to the ListCorrections method.
+		ListCorrections []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// Request is the request argument value.
+			Request pagination.Request
+		}
 		// ListDatastreams holds details about calls to the ListDatastreams method.
 		ListDatastreams []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -65,6 +313,44 @@ type MeasurementServiceMock struct {
 			// Request is the request argument value.
 			Request pagination.Request
 		}
+		// ListDatastreamsWithStats holds details about calls to the ListDatastreamsWithStats method.
+		ListDatastreamsWithStats []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DatastreamFilter is the datastreamFilter argument value.
+			DatastreamFilter measurements.DatastreamFilter
+			// StatsOptions is the statsOptions argument value.
+			StatsOptions measurements.StatsOptions
+			// Request is the request argument value.
+			Request pagination.Request
+		}
+		// ListLatestMeasurements holds details about calls to the ListLatestMeasurements method.
+		ListLatestMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DatastreamFilter is the datastreamFilter argument value.
+			DatastreamFilter measurements.DatastreamFilter
+			// S is the s argument value.
+			S string
+			// Request is the request argument value.
+			Request pagination.Request
+		}
+		// ListWorstDatastreams holds details about calls to the ListWorstDatastreams method.
+		ListWorstDatastreams []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// CompletenessOptions is the completenessOptions argument value.
+			CompletenessOptions measurements.CompletenessOptions
+		}
+		// OverwriteMeasurements holds details about calls to the OverwriteMeasurements method.
+		OverwriteMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// OverwriteMeasurementsOpts is the overwriteMeasurementsOpts argument value.
+			OverwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts
+		}
 		// QueryMeasurements holds details about calls to the QueryMeasurements method.
 		QueryMeasurements []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -74,124 +360,1034 @@ type MeasurementServiceMock struct {
 			// Request is the request argument value.
 			Request pagination.Request
 		}
+		// SetDatastreamArchiveTime holds details about calls to the SetDatastreamArchiveTime method.
+		SetDatastreamArchiveTime []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// N is the n argument value.
+			N *int
+		}
+		// SetDatastreamQualityRules holds details about calls to the SetDatastreamQualityRules method.
+		SetDatastreamQualityRules []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// UUID is the uUID argument value.
+			UUID uuid.UUID
+			// QualityRules is the qualityRules argument value.
+			QualityRules measurements.QualityRules
+		}
+		// SetRollupRetention holds details about calls to the SetRollupRetention method.
+		SetRollupRetention []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// RollupRetention is the rollupRetention argument value.
+			RollupRetention measurements.RollupRetention
+		}
+		// SubscribeMeasurements holds details about calls to the SubscribeMeasurements method.
+		SubscribeMeasurements []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// SubscriptionFilter is the subscriptionFilter argument value.
+			SubscriptionFilter measurements.SubscriptionFilter
+		}
 	}
-	lockGetDatastream     sync.RWMutex
-	lockListDatastreams   sync.RWMutex
-	lockQueryMeasurements sync.RWMutex
+	lockAddDatastreamMeasurements sync.RWMutex
+	lockAddMeasurements           sync.RWMutex
+	lockAggregateDatastream       sync.RWMutex
+	lockAlignDatastreams          sync.RWMutex
+	lockBackfillDerivedDatastream sync.RWMutex
+	lockCreateDerivedDatastream   sync.RWMutex
+	lockDeleteMeasurements        sync.RWMutex
+	lockExportMeasurements        sync.RWMutex
+	lockGetDatastream             sync.RWMutex
+	lockGetDatastreamCompleteness sync.RWMutex
+	lockGetDatastreamRetention    sync.RWMutex
+	lockGetDatastreamStats        sync.RWMutex
+	lockGetDerivation             sync.RWMutex
+	lockGetRollupRetention        sync.RWMutex
+	lockListCorrections           sync.RWMutex
+	lockListDatastreams           sync.RWMutex
+	lockListDatastreamsWithStats  sync.RWMutex
+	lockListLatestMeasurements    sync.RWMutex
+	lockListWorstDatastreams      sync.RWMutex
+	lockOverwriteMeasurements     sync.RWMutex
+	lockQueryMeasurements         sync.RWMutex
+	lockSetDatastreamArchiveTime  sync.RWMutex
+	lockSetDatastreamQualityRules sync.RWMutex
+	lockSetRollupRetention        sync.RWMutex
+	lockSubscribeMeasurements     sync.RWMutex
 }
 
-// GetDatastream calls GetDatastreamFunc.
-func (mock *MeasurementServiceMock) GetDatastream(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Datastream, error) {
-	if mock.GetDatastreamFunc == nil {
-		panic("MeasurementServiceMock.GetDatastreamFunc: method is nil but MeasurementService.GetDatastream was just called")
+// AddDatastreamMeasurements calls AddDatastreamMeasurementsFunc.
+func (mock *MeasurementServiceMock) AddDatastreamMeasurements(contextMoqParam context.Context, uUID uuid.UUID, newMeasurements []measurements.NewMeasurement) (*measurements.Submission, error) {
+	if mock.AddDatastreamMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.AddDatastreamMeasurementsFunc: method is nil but MeasurementService.AddDatastreamMeasurements was just called")
 	}
 	callInfo := struct {
 		ContextMoqParam context.Context
 		UUID            uuid.UUID
+		NewMeasurements []measurements.NewMeasurement
 	}{
 		ContextMoqParam: contextMoqParam,
 		UUID:            uUID,
+		NewMeasurements: newMeasurements,
 	}
-	mock.lockGetDatastream.Lock()
-	mock.calls.GetDatastream = append(mock.calls.GetDatastream, callInfo)
-	mock.lockGetDatastream.Unlock()
-	return mock.GetDatastreamFunc(contextMoqParam, uUID)
+	mock.lockAddDatastreamMeasurements.Lock()
+	mock.calls.AddDatastreamMeasurements = append(mock.calls.AddDatastreamMeasurements, callInfo)
+	mock.lockAddDatastreamMeasurements.Unlock()
+	return mock.AddDatastreamMeasurementsFunc(contextMoqParam, uUID, newMeasurements)
 }
 
-// GetDatastreamCalls gets all the calls that were made to GetDatastream.
+// AddDatastreamMeasurementsCalls gets all the calls that were made to AddDatastreamMeasurements.
 // Check the length with:
 //
-//	len(mockedMeasurementService.GetDatastreamCalls())
-func (mock *MeasurementServiceMock) GetDatastreamCalls() []struct {
+//	len(mockedMeasurementService.AddDatastreamMeasurementsCalls())
+func (mock *MeasurementServiceMock) AddDatastreamMeasurementsCalls() []struct {
 	ContextMoqParam context.Context
 	UUID            uuid.UUID
+	NewMeasurements []measurements.NewMeasurement
 } {
 	var calls []struct {
 		ContextMoqParam context.Context
 		UUID            uuid.UUID
+		NewMeasurements []measurements.NewMeasurement
 	}
-	mock.lockGetDatastream.RLock()
-	calls = mock.calls.GetDatastream
-	mock.lockGetDatastream.RUnlock()
+	mock.lockAddDatastreamMeasurements.RLock()
+	calls = mock.calls.AddDatastreamMeasurements
+	mock.lockAddDatastreamMeasurements.RUnlock()
 	return calls
 }
 
-// ListDatastreams calls ListDatastreamsFunc.
-func (mock *MeasurementServiceMock) ListDatastreams(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
-	if mock.ListDatastreamsFunc == nil {
-		panic("MeasurementServiceMock.ListDatastreamsFunc: method is nil but MeasurementService.ListDatastreams was just called")
+// AddMeasurements calls AddMeasurementsFunc.
+func (mock *MeasurementServiceMock) AddMeasurements(contextMoqParam context.Context, newSensorMeasurements []measurements.NewSensorMeasurement) (*measurements.Submission, error) {
+	if mock.AddMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.AddMeasurementsFunc: method is nil but MeasurementService.AddMeasurements was just called")
 	}
 	callInfo := struct {
-		ContextMoqParam  context.Context
-		DatastreamFilter measurements.DatastreamFilter
-		Request          pagination.Request
+		ContextMoqParam       context.Context
+		NewSensorMeasurements []measurements.NewSensorMeasurement
 	}{
-		ContextMoqParam:  contextMoqParam,
-		DatastreamFilter: datastreamFilter,
-		Request:          request,
+		ContextMoqParam:       contextMoqParam,
+		NewSensorMeasurements: newSensorMeasurements,
 	}
-	mock.lockListDatastreams.Lock()
-	mock.calls.ListDatastreams = append(mock.calls.ListDatastreams, callInfo)
-	mock.lockListDatastreams.Unlock()
-	return mock.ListDatastreamsFunc(contextMoqParam, datastreamFilter, request)
+	mock.lockAddMeasurements.Lock()
+	mock.calls.AddMeasurements = append(mock.calls.AddMeasurements, callInfo)
+	mock.lockAddMeasurements.Unlock()
+	return mock.AddMeasurementsFunc(contextMoqParam, newSensorMeasurements)
 }
 
-// ListDatastreamsCalls gets all the calls that were made to ListDatastreams.
+// AddMeasurementsCalls gets all the calls that were made to AddMeasurements.
 // Check the length with:
 //
-//	len(mockedMeasurementService.ListDatastreamsCalls())
-func (mock *MeasurementServiceMock) ListDatastreamsCalls() []struct {
-	ContextMoqParam  context.Context
-	DatastreamFilter measurements.DatastreamFilter
-	Request          pagination.Request
+//	len(mockedMeasurementService.AddMeasurementsCalls())
+func (mock *MeasurementServiceMock) AddMeasurementsCalls() []struct {
+	ContextMoqParam       context.Context
+	NewSensorMeasurements []measurements.NewSensorMeasurement
 } {
 	var calls []struct {
-		ContextMoqParam  context.Context
-		DatastreamFilter measurements.DatastreamFilter
-		Request          pagination.Request
+		ContextMoqParam       context.Context
+		NewSensorMeasurements []measurements.NewSensorMeasurement
 	}
-	mock.lockListDatastreams.RLock()
-	calls = mock.calls.ListDatastreams
-	mock.lockListDatastreams.RUnlock()
+	mock.lockAddMeasurements.RLock()
+	calls = mock.calls.AddMeasurements
+	mock.lockAddMeasurements.RUnlock()
 	return calls
 }
 
-// QueryMeasurements calls QueryMeasurementsFunc.
-func (mock *MeasurementServiceMock) QueryMeasurements(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
-	if mock.QueryMeasurementsFunc == nil {
-		panic("MeasurementServiceMock.QueryMeasurementsFunc: method is nil but MeasurementService.QueryMeasurements was just called")
+// AggregateDatastream calls AggregateDatastreamFunc.
+func (mock *MeasurementServiceMock) AggregateDatastream(contextMoqParam context.Context, uUID uuid.UUID, filter measurements.Filter, aggregationOptions measurements.AggregationOptions) ([]measurements.Aggregate, error) {
+	if mock.AggregateDatastreamFunc == nil {
+		panic("MeasurementServiceMock.AggregateDatastreamFunc: method is nil but MeasurementService.AggregateDatastream was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam    context.Context
+		UUID               uuid.UUID
+		Filter             measurements.Filter
+		AggregationOptions measurements.AggregationOptions
+	}{
+		ContextMoqParam:    contextMoqParam,
+		UUID:               uUID,
+		Filter:             filter,
+		AggregationOptions: aggregationOptions,
+	}
+	mock.lockAggregateDatastream.Lock()
+	mock.calls.AggregateDatastream = append(mock.calls.AggregateDatastream, callInfo)
+	mock.lockAggregateDatastream.Unlock()
+	return mock.AggregateDatastreamFunc(contextMoqParam, uUID, filter, aggregationOptions)
+}
+
+// AggregateDatastreamCalls gets all the calls that were made to AggregateDatastream.
+// Check the length with:
+//
+//	len(mockedMeasurementService.AggregateDatastreamCalls())
+func (mock *MeasurementServiceMock) AggregateDatastreamCalls() []struct {
+	ContextMoqParam    context.Context
+	UUID               uuid.UUID
+	Filter             measurements.Filter
+	AggregationOptions measurements.AggregationOptions
+} {
+	var calls []struct {
+		ContextMoqParam    context.Context
+		UUID               uuid.UUID
+		Filter             measurements.Filter
+		AggregationOptions measurements.AggregationOptions
+	}
+	mock.lockAggregateDatastream.RLock()
+	calls = mock.calls.AggregateDatastream
+	mock.lockAggregateDatastream.RUnlock()
+	return calls
+}
+
+// AlignDatastreams calls AlignDatastreamsFunc.
+func (mock *MeasurementServiceMock) AlignDatastreams(contextMoqParam context.Context, filter measurements.Filter, alignOptions measurements.AlignOptions) (*measurements.AlignedTable, error) {
+	if mock.AlignDatastreamsFunc == nil {
+		panic("MeasurementServiceMock.AlignDatastreamsFunc: method is nil but MeasurementService.AlignDatastreams was just called")
 	}
 	callInfo := struct {
 		ContextMoqParam context.Context
 		Filter          measurements.Filter
-		Request         pagination.Request
+		AlignOptions    measurements.AlignOptions
 	}{
 		ContextMoqParam: contextMoqParam,
 		Filter:          filter,
-		Request:         request,
+		AlignOptions:    alignOptions,
 	}
-	mock.lockQueryMeasurements.Lock()
-	mock.calls.QueryMeasurements = append(mock.calls.QueryMeasurements, callInfo)
-	mock.lockQueryMeasurements.Unlock()
-	return mock.QueryMeasurementsFunc(contextMoqParam, filter, request)
+	mock.lockAlignDatastreams.Lock()
+	mock.calls.AlignDatastreams = append(mock.calls.AlignDatastreams, callInfo)
+	mock.lockAlignDatastreams.Unlock()
+	return mock.AlignDatastreamsFunc(contextMoqParam, filter, alignOptions)
 }
 
-// QueryMeasurementsCalls gets all the calls that were made to QueryMeasurements.
+// AlignDatastreamsCalls gets all the calls that were made to AlignDatastreams.
 // Check the length with:
 //
-//	len(mockedMeasurementService.QueryMeasurementsCalls())
-func (mock *MeasurementServiceMock) QueryMeasurementsCalls() []struct {
+//	len(mockedMeasurementService.AlignDatastreamsCalls())
+func (mock *MeasurementServiceMock) AlignDatastreamsCalls() []struct {
 	ContextMoqParam context.Context
 	Filter          measurements.Filter
-	Request         pagination.Request
+	AlignOptions    measurements.AlignOptions
 } {
 	var calls []struct {
 		ContextMoqParam context.Context
 		Filter          measurements.Filter
-		Request         pagination.Request
+		AlignOptions    measurements.AlignOptions
 	}
-	mock.lockQueryMeasurements.RLock()
-	calls = mock.calls.QueryMeasurements
-	mock.lockQueryMeasurements.RUnlock()
+	mock.lockAlignDatastreams.RLock()
+	calls = mock.calls.AlignDatastreams
+	mock.lockAlignDatastreams.RUnlock()
+	return calls
+}
+
+// BackfillDerivedDatastream calls BackfillDerivedDatastreamFunc.
+func (mock *MeasurementServiceMock) BackfillDerivedDatastream(contextMoqParam context.Context, uUID uuid.UUID, backfillRange measurements.BackfillRange) (*measurements.Backfill, error) {
+	if mock.BackfillDerivedDatastreamFunc == nil {
+		panic("MeasurementServiceMock.BackfillDerivedDatastreamFunc: method is nil but MeasurementService.BackfillDerivedDatastream was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		BackfillRange   measurements.BackfillRange
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+		BackfillRange:   backfillRange,
+	}
+	mock.lockBackfillDerivedDatastream.Lock()
+	mock.calls.BackfillDerivedDatastream = append(mock.calls.BackfillDerivedDatastream, callInfo)
+	mock.lockBackfillDerivedDatastream.Unlock()
+	return mock.BackfillDerivedDatastreamFunc(contextMoqParam, uUID, backfillRange)
+}
+
+// BackfillDerivedDatastreamCalls gets all the calls that were made to BackfillDerivedDatastream.
+// Check the length with:
+//
+//	len(mockedMeasurementService.BackfillDerivedDatastreamCalls())
+func (mock *MeasurementServiceMock) BackfillDerivedDatastreamCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+	BackfillRange   measurements.BackfillRange
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		BackfillRange   measurements.BackfillRange
+	}
+	mock.lockBackfillDerivedDatastream.RLock()
+	calls = mock.calls.BackfillDerivedDatastream
+	mock.lockBackfillDerivedDatastream.RUnlock()
+	return calls
+}
+
+// CreateDerivedDatastream calls CreateDerivedDatastreamFunc.
+func (mock *MeasurementServiceMock) CreateDerivedDatastream(contextMoqParam context.Context, createDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts) (*measurements.DerivedDatastream, error) {
+	if mock.CreateDerivedDatastreamFunc == nil {
+		panic("MeasurementServiceMock.CreateDerivedDatastreamFunc: method is nil but MeasurementService.CreateDerivedDatastream was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam             context.Context
+		CreateDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts
+	}{
+		ContextMoqParam:             contextMoqParam,
+		CreateDerivedDatastreamOpts: createDerivedDatastreamOpts,
+	}
+	mock.lockCreateDerivedDatastream.Lock()
+	mock.calls.CreateDerivedDatastream = append(mock.calls.CreateDerivedDatastream, callInfo)
+	mock.lockCreateDerivedDatastream.Unlock()
+	return mock.CreateDerivedDatastreamFunc(contextMoqParam, createDerivedDatastreamOpts)
+}
+
+// CreateDerivedDatastreamCalls gets all the calls that were made to CreateDerivedDatastream.
+// Check the length with:
+//
+//	len(mockedMeasurementService.CreateDerivedDatastreamCalls())
+func (mock *MeasurementServiceMock) CreateDerivedDatastreamCalls() []struct {
+	ContextMoqParam             context.Context
+	CreateDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts
+} {
+	var calls []struct {
+		ContextMoqParam             context.Context
+		CreateDerivedDatastreamOpts measurements.CreateDerivedDatastreamOpts
+	}
+	mock.lockCreateDerivedDatastream.RLock()
+	calls = mock.calls.CreateDerivedDatastream
+	mock.lockCreateDerivedDatastream.RUnlock()
+	return calls
+}
+
+// DeleteMeasurements calls DeleteMeasurementsFunc.
+func (mock *MeasurementServiceMock) DeleteMeasurements(contextMoqParam context.Context, uUID uuid.UUID, correctionRange measurements.CorrectionRange) (*measurements.Correction, error) {
+	if mock.DeleteMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.DeleteMeasurementsFunc: method is nil but MeasurementService.DeleteMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		CorrectionRange measurements.CorrectionRange
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+		CorrectionRange: correctionRange,
+	}
+	mock.lockDeleteMeasurements.Lock()
+	mock.calls.DeleteMeasurements = append(mock.calls.DeleteMeasurements, callInfo)
+	mock.lockDeleteMeasurements.Unlock()
+	return mock.DeleteMeasurementsFunc(contextMoqParam, uUID, correctionRange)
+}
+
+// DeleteMeasurementsCalls gets all the calls that were made to DeleteMeasurements.
+// Check the length with:
+//
+//	len(mockedMeasurementService.DeleteMeasurementsCalls())
+func (mock *MeasurementServiceMock) DeleteMeasurementsCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+	CorrectionRange measurements.CorrectionRange
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		CorrectionRange measurements.CorrectionRange
+	}
+	mock.lockDeleteMeasurements.RLock()
+	calls = mock.calls.DeleteMeasurements
+	mock.lockDeleteMeasurements.RUnlock()
+	return calls
+}
+
+// ExportMeasurements calls ExportMeasurementsFunc.
+func (mock *MeasurementServiceMock) ExportMeasurements(contextMoqParam context.Context, filter measurements.Filter, fn func(measurements.Measurement) error) error {
+	if mock.ExportMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.ExportMeasurementsFunc: method is nil but MeasurementService.ExportMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		Filter          measurements.Filter
+		Fn              func(measurements.Measurement) error
+	}{
+		ContextMoqParam: contextMoqParam,
+		Filter:          filter,
+		Fn:              fn,
+	}
+	mock.lockExportMeasurements.Lock()
+	mock.calls.ExportMeasurements = append(mock.calls.ExportMeasurements, callInfo)
+	mock.lockExportMeasurements.Unlock()
+	return mock.ExportMeasurementsFunc(contextMoqParam, filter, fn)
+}
+
+// ExportMeasurementsCalls gets all the calls that were made to ExportMeasurements.
+// Check the length with:
+//
+//	len(mockedMeasurementService.ExportMeasurementsCalls())
+func (mock *MeasurementServiceMock) ExportMeasurementsCalls() []struct {
+	ContextMoqParam context.Context
+	Filter          measurements.Filter
+	Fn              func(measurements.Measurement) error
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		Filter          measurements.Filter
+		Fn              func(measurements.Measurement) error
+	}
+	mock.lockExportMeasurements.RLock()
+	calls = mock.calls.ExportMeasurements
+	mock.lockExportMeasurements.RUnlock()
+	return calls
+}
+
+// GetDatastream calls GetDatastreamFunc.
+func (mock *MeasurementServiceMock) GetDatastream(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Datastream, error) {
+	if mock.GetDatastreamFunc == nil {
+		panic("MeasurementServiceMock.GetDatastreamFunc: method is nil but MeasurementService.GetDatastream was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+	}
+	mock.lockGetDatastream.Lock()
+	mock.calls.GetDatastream = append(mock.calls.GetDatastream, callInfo)
+	mock.lockGetDatastream.Unlock()
+	return mock.GetDatastreamFunc(contextMoqParam, uUID)
+}
+
+// GetDatastreamCalls gets all the calls that were made to GetDatastream.
+// Check the length with:
+//
+//	len(mockedMeasurementService.GetDatastreamCalls())
+func (mock *MeasurementServiceMock) GetDatastreamCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+	}
+	mock.lockGetDatastream.RLock()
+	calls = mock.calls.GetDatastream
+	mock.lockGetDatastream.RUnlock()
+	return calls
+}
+
+// GetDatastreamCompleteness calls GetDatastreamCompletenessFunc.
+func (mock *MeasurementServiceMock) GetDatastreamCompleteness(contextMoqParam context.Context, uUID uuid.UUID, completenessOptions measurements.CompletenessOptions) (*measurements.Completeness, error) {
+	if mock.GetDatastreamCompletenessFunc == nil {
+		panic("MeasurementServiceMock.GetDatastreamCompletenessFunc: method is nil but MeasurementService.GetDatastreamCompleteness was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam     context.Context
+		UUID                uuid.UUID
+		CompletenessOptions measurements.CompletenessOptions
+	}{
+		ContextMoqParam:     contextMoqParam,
+		UUID:                uUID,
+		CompletenessOptions: completenessOptions,
+	}
+	mock.lockGetDatastreamCompleteness.Lock()
+	mock.calls.GetDatastreamCompleteness = append(mock.calls.GetDatastreamCompleteness, callInfo)
+	mock.lockGetDatastreamCompleteness.Unlock()
+	return mock.GetDatastreamCompletenessFunc(contextMoqParam, uUID, completenessOptions)
+}
+
+// GetDatastreamCompletenessCalls gets all the calls that were made to GetDatastreamCompleteness.
+// Check the length with:
+//
+//	len(mockedMeasurementService.GetDatastreamCompletenessCalls())
+func (mock *MeasurementServiceMock) GetDatastreamCompletenessCalls() []struct {
+	ContextMoqParam     context.Context
+	UUID                uuid.UUID
+	CompletenessOptions measurements.CompletenessOptions
+} {
+	var calls []struct {
+		ContextMoqParam     context.Context
+		UUID                uuid.UUID
+		CompletenessOptions measurements.CompletenessOptions
+	}
+	mock.lockGetDatastreamCompleteness.RLock()
+	calls = mock.calls.GetDatastreamCompleteness
+	mock.lockGetDatastreamCompleteness.RUnlock()
+	return calls
+}
+
+// GetDatastreamRetention calls GetDatastreamRetentionFunc.
+func (mock *MeasurementServiceMock) GetDatastreamRetention(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Retention, error) {
+	if mock.GetDatastreamRetentionFunc == nil {
+		panic("MeasurementServiceMock.GetDatastreamRetentionFunc: method is nil but MeasurementService.GetDatastreamRetention was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+	}
+	mock.lockGetDatastreamRetention.Lock()
+	mock.calls.GetDatastreamRetention = append(mock.calls.GetDatastreamRetention, callInfo)
+	mock.lockGetDatastreamRetention.Unlock()
+	return mock.GetDatastreamRetentionFunc(contextMoqParam, uUID)
+}
+
+// GetDatastreamRetentionCalls gets all the calls that were made to GetDatastreamRetention.
+// Check the length with:
+//
+//	len(mockedMeasurementService.GetDatastreamRetentionCalls())
+func (mock *MeasurementServiceMock) GetDatastreamRetentionCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+	}
+	mock.lockGetDatastreamRetention.RLock()
+	calls = mock.calls.GetDatastreamRetention
+	mock.lockGetDatastreamRetention.RUnlock()
+	return calls
+}
+
+// GetDatastreamStats calls GetDatastreamStatsFunc.
+func (mock *MeasurementServiceMock) GetDatastreamStats(contextMoqParam context.Context, uUID uuid.UUID, statsOptions measurements.StatsOptions) (*measurements.DatastreamStats, error) {
+	if mock.GetDatastreamStatsFunc == nil {
+		panic("MeasurementServiceMock.GetDatastreamStatsFunc: method is nil but MeasurementService.GetDatastreamStats was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		StatsOptions    measurements.StatsOptions
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+		StatsOptions:    statsOptions,
+	}
+	mock.lockGetDatastreamStats.Lock()
+	mock.calls.GetDatastreamStats = append(mock.calls.GetDatastreamStats, callInfo)
+	mock.lockGetDatastreamStats.Unlock()
+	return mock.GetDatastreamStatsFunc(contextMoqParam, uUID, statsOptions)
+}
+
+// GetDatastreamStatsCalls gets all the calls that were made to GetDatastreamStats.
+// Check the length with:
+//
+//	len(mockedMeasurementService.GetDatastreamStatsCalls())
+func (mock *MeasurementServiceMock) GetDatastreamStatsCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+	StatsOptions    measurements.StatsOptions
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		StatsOptions    measurements.StatsOptions
+	}
+	mock.lockGetDatastreamStats.RLock()
+	calls = mock.calls.GetDatastreamStats
+	mock.lockGetDatastreamStats.RUnlock()
+	return calls
+}
+
+// GetDerivation calls GetDerivationFunc.
+func (mock *MeasurementServiceMock) GetDerivation(contextMoqParam context.Context, uUID uuid.UUID) (*measurements.Derivation, error) {
+	if mock.GetDerivationFunc == nil {
+		panic("MeasurementServiceMock.GetDerivationFunc: method is nil but MeasurementService.GetDerivation was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+	}
+	mock.lockGetDerivation.Lock()
+	mock.calls.GetDerivation = append(mock.calls.GetDerivation, callInfo)
+	mock.lockGetDerivation.Unlock()
+	return mock.GetDerivationFunc(contextMoqParam, uUID)
+}
+
+// GetDerivationCalls gets all the calls that were made to GetDerivation.
+// Check the length with:
+//
+//	len(mockedMeasurementService.GetDerivationCalls())
+func (mock *MeasurementServiceMock) GetDerivationCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+	}
+	mock.lockGetDerivation.RLock()
+	calls = mock.calls.GetDerivation
+	mock.lockGetDerivation.RUnlock()
+	return calls
+}
+
+// GetRollupRetention calls GetRollupRetentionFunc.
+func (mock *MeasurementServiceMock) GetRollupRetention(contextMoqParam context.Context) (*measurements.RollupRetention, error) {
+	if mock.GetRollupRetentionFunc == nil {
+		panic("MeasurementServiceMock.GetRollupRetentionFunc: method is nil but MeasurementService.GetRollupRetention was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+	}{
+		ContextMoqParam: contextMoqParam,
+	}
+	mock.lockGetRollupRetention.Lock()
+	mock.calls.GetRollupRetention = append(mock.calls.GetRollupRetention, callInfo)
+	mock.lockGetRollupRetention.Unlock()
+	return mock.GetRollupRetentionFunc(contextMoqParam)
+}
+
+// GetRollupRetentionCalls gets all the calls that were made to GetRollupRetention.
+// Check the length with:
+//
+//	len(mockedMeasurementService.GetRollupRetentionCalls())
+func (mock *MeasurementServiceMock) GetRollupRetentionCalls() []struct {
+	ContextMoqParam context.Context
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+	}
+	mock.lockGetRollupRetention.RLock()
+	calls = mock.calls.GetRollupRetention
+	mock.lockGetRollupRetention.RUnlock()
+	return calls
+}
+
+// ListCorrections calls ListCorrectionsFunc.
+func (mock *MeasurementServiceMock) ListCorrections(contextMoqParam context.Context, uUID uuid.UUID, request pagination.Request) (*pagination.Page[measurements.Correction], error) {
+	if mock.ListCorrectionsFunc == nil {
+		panic("MeasurementServiceMock.ListCorrectionsFunc: method is nil but MeasurementService.ListCorrections was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		Request         pagination.Request
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+		Request:         request,
+	}
+	mock.lockListCorrections.Lock()
+	mock.calls.ListCorrections = append(mock.calls.ListCorrections, callInfo)
+	mock.lockListCorrections.Unlock()
+	return mock.ListCorrectionsFunc(contextMoqParam, uUID, request)
+}
+
+// ListCorrectionsCalls gets all the calls that were made to ListCorrections.
+// Check the length with:
+//
+//	len(mockedMeasurementService.ListCorrectionsCalls())
+func (mock *MeasurementServiceMock) ListCorrectionsCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+	Request         pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		Request         pagination.Request
+	}
+	mock.lockListCorrections.RLock()
+	calls = mock.calls.ListCorrections
+	mock.lockListCorrections.RUnlock()
+	return calls
+}
+
+// ListDatastreams calls ListDatastreamsFunc.
+func (mock *MeasurementServiceMock) ListDatastreams(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
+	if mock.ListDatastreamsFunc == nil {
+		panic("MeasurementServiceMock.ListDatastreamsFunc: method is nil but MeasurementService.ListDatastreams was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		Request          pagination.Request
+	}{
+		ContextMoqParam:  contextMoqParam,
+		DatastreamFilter: datastreamFilter,
+		Request:          request,
+	}
+	mock.lockListDatastreams.Lock()
+	mock.calls.ListDatastreams = append(mock.calls.ListDatastreams, callInfo)
+	mock.lockListDatastreams.Unlock()
+	return mock.ListDatastreamsFunc(contextMoqParam, datastreamFilter, request)
+}
+
+// ListDatastreamsCalls gets all the calls that were made to ListDatastreams.
+// Check the length with:
+//
+//	len(mockedMeasurementService.ListDatastreamsCalls())
+func (mock *MeasurementServiceMock) ListDatastreamsCalls() []struct {
+	ContextMoqParam  context.Context
+	DatastreamFilter measurements.DatastreamFilter
+	Request          pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		Request          pagination.Request
+	}
+	mock.lockListDatastreams.RLock()
+	calls = mock.calls.ListDatastreams
+	mock.lockListDatastreams.RUnlock()
+	return calls
+}
+
+// ListDatastreamsWithStats calls ListDatastreamsWithStatsFunc.
+func (mock *MeasurementServiceMock) ListDatastreamsWithStats(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, statsOptions measurements.StatsOptions, request pagination.Request) (*pagination.Page[measurements.Datastream], error) {
+	if mock.ListDatastreamsWithStatsFunc == nil {
+		panic("MeasurementServiceMock.ListDatastreamsWithStatsFunc: method is nil but MeasurementService.ListDatastreamsWithStats was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		StatsOptions     measurements.StatsOptions
+		Request          pagination.Request
+	}{
+		ContextMoqParam:  contextMoqParam,
+		DatastreamFilter: datastreamFilter,
+		StatsOptions:     statsOptions,
+		Request:          request,
+	}
+	mock.lockListDatastreamsWithStats.Lock()
+	mock.calls.ListDatastreamsWithStats = append(mock.calls.ListDatastreamsWithStats, callInfo)
+	mock.lockListDatastreamsWithStats.Unlock()
+	return mock.ListDatastreamsWithStatsFunc(contextMoqParam, datastreamFilter, statsOptions, request)
+}
+
+// ListDatastreamsWithStatsCalls gets all the calls that were made to ListDatastreamsWithStats.
+// Check the length with:
+//
+//	len(mockedMeasurementService.ListDatastreamsWithStatsCalls())
+func (mock *MeasurementServiceMock) ListDatastreamsWithStatsCalls() []struct {
+	ContextMoqParam  context.Context
+	DatastreamFilter measurements.DatastreamFilter
+	StatsOptions     measurements.StatsOptions
+	Request          pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		StatsOptions     measurements.StatsOptions
+		Request          pagination.Request
+	}
+	mock.lockListDatastreamsWithStats.RLock()
+	calls = mock.calls.ListDatastreamsWithStats
+	mock.lockListDatastreamsWithStats.RUnlock()
+	return calls
+}
+
+// ListLatestMeasurements calls ListLatestMeasurementsFunc.
+func (mock *MeasurementServiceMock) ListLatestMeasurements(contextMoqParam context.Context, datastreamFilter measurements.DatastreamFilter, s string, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+	if mock.ListLatestMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.ListLatestMeasurementsFunc: method is nil but MeasurementService.ListLatestMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		S                string
+		Request          pagination.Request
+	}{
+		ContextMoqParam:  contextMoqParam,
+		DatastreamFilter: datastreamFilter,
+		S:                s,
+		Request:          request,
+	}
+	mock.lockListLatestMeasurements.Lock()
+	mock.calls.ListLatestMeasurements = append(mock.calls.ListLatestMeasurements, callInfo)
+	mock.lockListLatestMeasurements.Unlock()
+	return mock.ListLatestMeasurementsFunc(contextMoqParam, datastreamFilter, s, request)
+}
+
+// ListLatestMeasurementsCalls gets all the calls that were made to ListLatestMeasurements.
+// Check the length with:
+//
+//	len(mockedMeasurementService.ListLatestMeasurementsCalls())
+func (mock *MeasurementServiceMock) ListLatestMeasurementsCalls() []struct {
+	ContextMoqParam  context.Context
+	DatastreamFilter measurements.DatastreamFilter
+	S                string
+	Request          pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam  context.Context
+		DatastreamFilter measurements.DatastreamFilter
+		S                string
+		Request          pagination.Request
+	}
+	mock.lockListLatestMeasurements.RLock()
+	calls = mock.calls.ListLatestMeasurements
+	mock.lockListLatestMeasurements.RUnlock()
+	return calls
+}
+
+// ListWorstDatastreams calls ListWorstDatastreamsFunc.
+func (mock *MeasurementServiceMock) ListWorstDatastreams(contextMoqParam context.Context, completenessOptions measurements.CompletenessOptions) ([]measurements.CompletenessSummary, error) {
+	if mock.ListWorstDatastreamsFunc == nil {
+		panic("MeasurementServiceMock.ListWorstDatastreamsFunc: method is nil but MeasurementService.ListWorstDatastreams was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam     context.Context
+		CompletenessOptions measurements.CompletenessOptions
+	}{
+		ContextMoqParam:     contextMoqParam,
+		CompletenessOptions: completenessOptions,
+	}
+	mock.lockListWorstDatastreams.Lock()
+	mock.calls.ListWorstDatastreams = append(mock.calls.ListWorstDatastreams, callInfo)
+	mock.lockListWorstDatastreams.Unlock()
+	return mock.ListWorstDatastreamsFunc(contextMoqParam, completenessOptions)
+}
+
+// ListWorstDatastreamsCalls gets all the calls that were made to ListWorstDatastreams.
+// Check the length with:
+//
+//	len(mockedMeasurementService.ListWorstDatastreamsCalls())
+func (mock *MeasurementServiceMock) ListWorstDatastreamsCalls() []struct {
+	ContextMoqParam     context.Context
+	CompletenessOptions measurements.CompletenessOptions
+} {
+	var calls []struct {
+		ContextMoqParam     context.Context
+		CompletenessOptions measurements.CompletenessOptions
+	}
+	mock.lockListWorstDatastreams.RLock()
+	calls = mock.calls.ListWorstDatastreams
+	mock.lockListWorstDatastreams.RUnlock()
+	return calls
+}
+
+// OverwriteMeasurements calls OverwriteMeasurementsFunc.
+func (mock *MeasurementServiceMock) OverwriteMeasurements(contextMoqParam context.Context, uUID uuid.UUID, overwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts) (*measurements.Correction, error) {
+	if mock.OverwriteMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.OverwriteMeasurementsFunc: method is nil but MeasurementService.OverwriteMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam           context.Context
+		UUID                      uuid.UUID
+		OverwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts
+	}{
+		ContextMoqParam:           contextMoqParam,
+		UUID:                      uUID,
+		OverwriteMeasurementsOpts: overwriteMeasurementsOpts,
+	}
+	mock.lockOverwriteMeasurements.Lock()
+	mock.calls.OverwriteMeasurements = append(mock.calls.OverwriteMeasurements, callInfo)
+	mock.lockOverwriteMeasurements.Unlock()
+	return mock.OverwriteMeasurementsFunc(contextMoqParam, uUID, overwriteMeasurementsOpts)
+}
+
+// OverwriteMeasurementsCalls gets all the calls that were made to OverwriteMeasurements.
+// Check the length with:
+//
+//	len(mockedMeasurementService.OverwriteMeasurementsCalls())
+func (mock *MeasurementServiceMock) OverwriteMeasurementsCalls() []struct {
+	ContextMoqParam           context.Context
+	UUID                      uuid.UUID
+	OverwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts
+} {
+	var calls []struct {
+		ContextMoqParam           context.Context
+		UUID                      uuid.UUID
+		OverwriteMeasurementsOpts measurements.OverwriteMeasurementsOpts
+	}
+	mock.lockOverwriteMeasurements.RLock()
+	calls = mock.calls.OverwriteMeasurements
+	mock.lockOverwriteMeasurements.RUnlock()
+	return calls
+}
+
+// QueryMeasurements calls QueryMeasurementsFunc.
+func (mock *MeasurementServiceMock) QueryMeasurements(contextMoqParam context.Context, filter measurements.Filter, request pagination.Request) (*pagination.Page[measurements.Measurement], error) {
+	if mock.QueryMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.QueryMeasurementsFunc: method is nil but MeasurementService.QueryMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		Filter          measurements.Filter
+		Request         pagination.Request
+	}{
+		ContextMoqParam: contextMoqParam,
+		Filter:          filter,
+		Request:         request,
+	}
+	mock.lockQueryMeasurements.Lock()
+	mock.calls.QueryMeasurements = append(mock.calls.QueryMeasurements, callInfo)
+	mock.lockQueryMeasurements.Unlock()
+	return mock.QueryMeasurementsFunc(contextMoqParam, filter, request)
+}
+
+// QueryMeasurementsCalls gets all the calls that were made to QueryMeasurements.
+// Check the length with:
+//
+//	len(mockedMeasurementService.QueryMeasurementsCalls())
+func (mock *MeasurementServiceMock) QueryMeasurementsCalls() []struct {
+	ContextMoqParam context.Context
+	Filter          measurements.Filter
+	Request         pagination.Request
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		Filter          measurements.Filter
+		Request         pagination.Request
+	}
+	mock.lockQueryMeasurements.RLock()
+	calls = mock.calls.QueryMeasurements
+	mock.lockQueryMeasurements.RUnlock()
+	return calls
+}
+
+// SetDatastreamArchiveTime calls SetDatastreamArchiveTimeFunc.
+func (mock *MeasurementServiceMock) SetDatastreamArchiveTime(contextMoqParam context.Context, uUID uuid.UUID, n *int) error {
+	if mock.SetDatastreamArchiveTimeFunc == nil {
+		panic("MeasurementServiceMock.SetDatastreamArchiveTimeFunc: method is nil but MeasurementService.SetDatastreamArchiveTime was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		N               *int
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+		N:               n,
+	}
+	mock.lockSetDatastreamArchiveTime.Lock()
+	mock.calls.SetDatastreamArchiveTime = append(mock.calls.SetDatastreamArchiveTime, callInfo)
+	mock.lockSetDatastreamArchiveTime.Unlock()
+	return mock.SetDatastreamArchiveTimeFunc(contextMoqParam, uUID, n)
+}
+
+// SetDatastreamArchiveTimeCalls gets all the calls that were made to SetDatastreamArchiveTime.
+// Check the length with:
+//
+//	len(mockedMeasurementService.SetDatastreamArchiveTimeCalls())
+func (mock *MeasurementServiceMock) SetDatastreamArchiveTimeCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+	N               *int
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		N               *int
+	}
+	mock.lockSetDatastreamArchiveTime.RLock()
+	calls = mock.calls.SetDatastreamArchiveTime
+	mock.lockSetDatastreamArchiveTime.RUnlock()
+	return calls
+}
+
+// SetDatastreamQualityRules calls SetDatastreamQualityRulesFunc.
+func (mock *MeasurementServiceMock) SetDatastreamQualityRules(contextMoqParam context.Context, uUID uuid.UUID, qualityRules measurements.QualityRules) error {
+	if mock.SetDatastreamQualityRulesFunc == nil {
+		panic("MeasurementServiceMock.SetDatastreamQualityRulesFunc: method is nil but MeasurementService.SetDatastreamQualityRules was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		QualityRules    measurements.QualityRules
+	}{
+		ContextMoqParam: contextMoqParam,
+		UUID:            uUID,
+		QualityRules:    qualityRules,
+	}
+	mock.lockSetDatastreamQualityRules.Lock()
+	mock.calls.SetDatastreamQualityRules = append(mock.calls.SetDatastreamQualityRules, callInfo)
+	mock.lockSetDatastreamQualityRules.Unlock()
+	return mock.SetDatastreamQualityRulesFunc(contextMoqParam, uUID, qualityRules)
+}
+
+// SetDatastreamQualityRulesCalls gets all the calls that were made to SetDatastreamQualityRules.
+// Check the length with:
+//
+//	len(mockedMeasurementService.SetDatastreamQualityRulesCalls())
+func (mock *MeasurementServiceMock) SetDatastreamQualityRulesCalls() []struct {
+	ContextMoqParam context.Context
+	UUID            uuid.UUID
+	QualityRules    measurements.QualityRules
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		UUID            uuid.UUID
+		QualityRules    measurements.QualityRules
+	}
+	mock.lockSetDatastreamQualityRules.RLock()
+	calls = mock.calls.SetDatastreamQualityRules
+	mock.lockSetDatastreamQualityRules.RUnlock()
+	return calls
+}
+
+// SetRollupRetention calls SetRollupRetentionFunc.
+func (mock *MeasurementServiceMock) SetRollupRetention(contextMoqParam context.Context, rollupRetention measurements.RollupRetention) error {
+	if mock.SetRollupRetentionFunc == nil {
+		panic("MeasurementServiceMock.SetRollupRetentionFunc: method is nil but MeasurementService.SetRollupRetention was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam context.Context
+		RollupRetention measurements.RollupRetention
+	}{
+		ContextMoqParam: contextMoqParam,
+		RollupRetention: rollupRetention,
+	}
+	mock.lockSetRollupRetention.Lock()
+	mock.calls.SetRollupRetention = append(mock.calls.SetRollupRetention, callInfo)
+	mock.lockSetRollupRetention.Unlock()
+	return mock.SetRollupRetentionFunc(contextMoqParam, rollupRetention)
+}
+
+// SetRollupRetentionCalls gets all the calls that were made to SetRollupRetention.
+// Check the length with:
+//
+//	len(mockedMeasurementService.SetRollupRetentionCalls())
+func (mock *MeasurementServiceMock) SetRollupRetentionCalls() []struct {
+	ContextMoqParam context.Context
+	RollupRetention measurements.RollupRetention
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		RollupRetention measurements.RollupRetention
+	}
+	mock.lockSetRollupRetention.RLock()
+	calls = mock.calls.SetRollupRetention
+	mock.lockSetRollupRetention.RUnlock()
+	return calls
+}
+
+// SubscribeMeasurements calls SubscribeMeasurementsFunc.
+func (mock *MeasurementServiceMock) SubscribeMeasurements(contextMoqParam context.Context, subscriptionFilter measurements.SubscriptionFilter) (<-chan measurements.Measurement, error) {
+	if mock.SubscribeMeasurementsFunc == nil {
+		panic("MeasurementServiceMock.SubscribeMeasurementsFunc: method is nil but MeasurementService.SubscribeMeasurements was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam    context.Context
+		SubscriptionFilter measurements.SubscriptionFilter
+	}{
+		ContextMoqParam:    contextMoqParam,
+		SubscriptionFilter: subscriptionFilter,
+	}
+	mock.lockSubscribeMeasurements.Lock()
+	mock.calls.SubscribeMeasurements = append(mock.calls.SubscribeMeasurements, callInfo)
+	mock.lockSubscribeMeasurements.Unlock()
+	return mock.SubscribeMeasurementsFunc(contextMoqParam, subscriptionFilter)
+}
+
+// SubscribeMeasurementsCalls gets all the calls that were made to SubscribeMeasurements.
+// Check the length with:
+//
+//	len(mockedMeasurementService.SubscribeMeasurementsCalls())
+func (mock *MeasurementServiceMock) SubscribeMeasurementsCalls() []struct {
+	ContextMoqParam    context.Context
+	SubscriptionFilter measurements.SubscriptionFilter
+} {
+	var calls []struct {
+		ContextMoqParam    context.Context
+		SubscriptionFilter measurements.SubscriptionFilter
+	}
+	mock.lockSubscribeMeasurements.RLock()
+	calls = mock.calls.SubscribeMeasurements
+	mock.lockSubscribeMeasurements.RUnlock()
 	return calls
 }
@@ -12,11 +12,14 @@ import (
 
 	"sensorbucket.nl/sensorbucket/internal/pagination"
 	"sensorbucket.nl/sensorbucket/pkg/auth"
+	"sensorbucket.nl/sensorbucket/services/core/alerting"
 	"sensorbucket.nl/sensorbucket/services/core/devices"
 	"sensorbucket.nl/sensorbucket/services/core/featuresofinterest"
 	"sensorbucket.nl/sensorbucket/services/core/measurements"
 	"sensorbucket.nl/sensorbucket/services/core/processing"
 	"sensorbucket.nl/sensorbucket/services/core/projects"
+	"sensorbucket.nl/sensorbucket/services/core/sensorthings"
+	"sensorbucket.nl/sensorbucket/services/core/webhooks"
 )
 
 // var logger = slog.Default().With("component", "services/core/transport")
@@ -33,6 +36,43 @@ type MeasurementService interface {
 		measurements.DatastreamFilter,
 		pagination.Request,
 	) (*pagination.Page[measurements.Datastream], error)
+	ListDatastreamsWithStats(
+		context.Context,
+		measurements.DatastreamFilter,
+		measurements.StatsOptions,
+		pagination.Request,
+	) (*pagination.Page[measurements.Datastream], error)
+	GetDatastreamStats(context.Context, uuid.UUID, measurements.StatsOptions) (*measurements.DatastreamStats, error)
+	AlignDatastreams(context.Context, measurements.Filter, measurements.AlignOptions) (*measurements.AlignedTable, error)
+	AggregateDatastream(
+		context.Context,
+		uuid.UUID,
+		measurements.Filter,
+		measurements.AggregationOptions,
+	) ([]measurements.Aggregate, error)
+	ExportMeasurements(context.Context, measurements.Filter, func(measurements.Measurement) error) error
+	ListLatestMeasurements(
+		context.Context,
+		measurements.DatastreamFilter,
+		string,
+		pagination.Request,
+	) (*pagination.Page[measurements.Measurement], error)
+	SetDatastreamQualityRules(context.Context, uuid.UUID, measurements.QualityRules) error
+	SetDatastreamArchiveTime(context.Context, uuid.UUID, *int) error
+	GetDatastreamRetention(context.Context, uuid.UUID) (*measurements.Retention, error)
+	GetDatastreamCompleteness(context.Context, uuid.UUID, measurements.CompletenessOptions) (*measurements.Completeness, error)
+	ListWorstDatastreams(context.Context, measurements.CompletenessOptions) ([]measurements.CompletenessSummary, error)
+	AddDatastreamMeasurements(context.Context, uuid.UUID, []measurements.NewMeasurement) (*measurements.Submission, error)
+	AddMeasurements(context.Context, []measurements.NewSensorMeasurement) (*measurements.Submission, error)
+	DeleteMeasurements(context.Context, uuid.UUID, measurements.CorrectionRange) (*measurements.Correction, error)
+	OverwriteMeasurements(context.Context, uuid.UUID, measurements.OverwriteMeasurementsOpts) (*measurements.Correction, error)
+	ListCorrections(context.Context, uuid.UUID, pagination.Request) (*pagination.Page[measurements.Correction], error)
+	GetRollupRetention(context.Context) (*measurements.RollupRetention, error)
+	SetRollupRetention(context.Context, measurements.RollupRetention) error
+	CreateDerivedDatastream(context.Context, measurements.CreateDerivedDatastreamOpts) (*measurements.DerivedDatastream, error)
+	GetDerivation(context.Context, uuid.UUID) (*measurements.Derivation, error)
+	BackfillDerivedDatastream(context.Context, uuid.UUID, measurements.BackfillRange) (*measurements.Backfill, error)
+	SubscribeMeasurements(context.Context, measurements.SubscriptionFilter) (<-chan measurements.Measurement, error)
 }
 
 type CoreTransport struct {
@@ -44,25 +84,35 @@ type CoreTransport struct {
 	processingService        *processing.Service
 	projectsService          *projects.Application
 	featureOfInterestService *featuresofinterest.Service
+	sensorThingsService      *sensorthings.Service
+	alertingService          *alerting.Service
+	webhooksService          *webhooks.Service
 }
 
-func New(
-	baseURL string,
-	keySource auth.JWKSClient,
-	deviceService *devices.Service,
-	measurementService MeasurementService,
-	processingService *processing.Service,
-	projectsService *projects.Application,
-	featureOfInterestService *featuresofinterest.Service,
-) *CoreTransport {
+// Services are the services served by the transport, the routes of a service that is not set can not be used
+type Services struct {
+	Devices            *devices.Service
+	Measurements       MeasurementService
+	Processing         *processing.Service
+	Projects           *projects.Application
+	FeaturesOfInterest *featuresofinterest.Service
+	SensorThings       *sensorthings.Service
+	Alerting           *alerting.Service
+	Webhooks           *webhooks.Service
+}
+
+func New(baseURL string, keySource auth.JWKSClient, services Services) *CoreTransport {
 	t := &CoreTransport{
 		baseURL:                  baseURL,
 		keySource:                keySource,
-		deviceService:            deviceService,
-		measurementService:       measurementService,
-		processingService:        processingService,
-		projectsService:          projectsService,
-		featureOfInterestService: featureOfInterestService,
+		deviceService:            services.Devices,
+		measurementService:       services.Measurements,
+		processingService:        services.Processing,
+		projectsService:          services.Projects,
+		featureOfInterestService: services.FeaturesOfInterest,
+		sensorThingsService:      services.SensorThings,
+		alertingService:          services.Alerting,
+		webhooksService:          services.Webhooks,
 	}
 	t.routes()
 	return t
@@ -84,11 +134,15 @@ func (transport *CoreTransport) routes() {
 
 	r.Get("/devices", transport.httpListDevices())
 	r.Post("/devices", transport.httpCreateDevice())
+	r.Post("/devices/import", transport.httpImportDevices())
+	r.Get("/devices/export", transport.httpExportDevices())
 	r.Route("/devices/{device_id}", func(r chi.Router) {
 		r.Use(transport.useDeviceResolver())
 		r.Get("/", transport.httpGetDevice())
 		r.Patch("/", transport.httpUpdateDevice())
 		r.Delete("/", transport.httpDeleteDevice())
+		r.Get("/locations", transport.httpListDeviceLocations())
+		r.Get("/location", transport.httpGetDeviceLocation())
 
 		r.Route("/sensors", func(r chi.Router) {
 			r.Get("/", transport.httpListDeviceSensors())
@@ -118,9 +172,37 @@ func (transport *CoreTransport) routes() {
 		})
 	})
 
+	r.Route("/device-templates", func(r chi.Router) {
+		r.Post("/", transport.httpCreateDeviceTemplate())
+		r.Get("/", transport.httpListDeviceTemplates())
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", transport.httpGetDeviceTemplate())
+			r.Delete("/", transport.httpDeleteDeviceTemplate())
+			r.Patch("/", transport.httpUpdateDeviceTemplate())
+			r.Post("/preview", transport.httpPreviewDeviceTemplateUpdate())
+			r.Post("/devices", transport.httpCreateDeviceFromTemplate())
+		})
+	})
+
 	r.Route("/datastreams", func(r chi.Router) {
 		r.Get("/", transport.httpListDatastream())
+		r.Get("/latest", transport.httpListLatestMeasurements())
+		r.Post("/derived", transport.httpCreateDerivedDatastream())
+		r.Get("/completeness", transport.httpListWorstDatastreams())
+		r.Get("/aligned", transport.httpAlignDatastreams())
 		r.Get("/{id}", transport.httpGetDatastream())
+		r.Get("/{id}/aggregate", transport.httpAggregateDatastream())
+		r.Put("/{id}/quality-rules", transport.httpSetDatastreamQualityRules())
+		r.Put("/{id}/archive-time", transport.httpSetDatastreamArchiveTime())
+		r.Get("/{id}/retention", transport.httpGetDatastreamRetention())
+		r.Get("/{id}/completeness", transport.httpGetDatastreamCompleteness())
+		r.Get("/{id}/stats", transport.httpGetDatastreamStats())
+		r.Post("/{id}/measurements", transport.httpAddDatastreamMeasurements())
+		r.Patch("/{id}/measurements", transport.httpOverwriteDatastreamMeasurements())
+		r.Delete("/{id}/measurements", transport.httpDeleteDatastreamMeasurements())
+		r.Get("/{id}/corrections", transport.httpListDatastreamCorrections())
+		r.Get("/{id}/derivation", transport.httpGetDatastreamDerivation())
+		r.Post("/{id}/backfill", transport.httpBackfillDerivedDatastream())
 	})
 
 	r.Route("/pipelines", func(r chi.Router) {
@@ -143,5 +225,30 @@ func (transport *CoreTransport) routes() {
 		r.Patch("/{id}", transport.httpUpdateFeatureOfInterest())
 	})
 
+	r.Route("/alert-rules", func(r chi.Router) {
+		r.Get("/", transport.httpListAlertRules())
+		r.Post("/", transport.httpCreateAlertRule())
+		r.Get("/{id}", transport.httpGetAlertRule())
+		r.Delete("/{id}", transport.httpDeleteAlertRule())
+	})
+	r.Get("/alerts", transport.httpListAlerts())
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Get("/", transport.httpListWebhooks())
+		r.Post("/", transport.httpCreateWebhook())
+		r.Get("/{id}", transport.httpGetWebhook())
+		r.Delete("/{id}", transport.httpDeleteWebhook())
+		r.Get("/{id}/deliveries", transport.httpListWebhookDeliveries())
+		r.Post("/{id}/deliveries/{delivery_id}/retry", transport.httpRetryWebhookDelivery())
+	})
+
 	r.Get("/measurements", transport.httpGetMeasurements())
+	r.Post("/measurements", transport.httpAddMeasurements())
+	r.Get("/measurements/export", transport.httpExportMeasurements())
+	r.Get("/measurements/stream", transport.httpStreamMeasurements())
+	r.Get("/measurements/rollup-retention", transport.httpGetRollupRetention())
+	r.Put("/measurements/rollup-retention", transport.httpSetRollupRetention())
+
+	r.Get("/sta/v1.1", transport.httpSensorThings())
+	r.Get("/sta/v1.1/*", transport.httpSensorThings())
 }
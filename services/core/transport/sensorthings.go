@@ -0,0 +1,27 @@
+package coretransport
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/sensorthings"
+)
+
+func (transport *CoreTransport) httpSensorThings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path, err := url.PathUnescape(chi.URLParam(r, "*"))
+		if err != nil {
+			web.HTTPError(w, sensorthings.ErrPathInvalid)
+			return
+		}
+		result, err := transport.sensorThingsService.Read(r.Context(), transport.baseURL+"/sta/v1.1", path, r.URL.RawQuery)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, result)
+	}
+}
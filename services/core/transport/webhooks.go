@@ -0,0 +1,143 @@
+package coretransport
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"sensorbucket.nl/sensorbucket/internal/httpfilter"
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/webhooks"
+)
+
+func (transport *CoreTransport) httpListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := httpfilter.Parse[pagination.Request](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		page, err := transport.webhooksService.ListWebhooks(r.Context(), params)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
+
+func (transport *CoreTransport) httpCreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto webhooks.CreateWebhookOpts
+		if err := web.DecodeJSON(r, &dto); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		webhook, err := transport.webhooksService.CreateWebhook(r.Context(), dto)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusCreated, web.APIResponseAny{
+			Message: "Created webhook, store the secret to verify signatures as it is not shown again",
+			Data:    webhook,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpGetWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Webhook ID must be a number",
+			})
+			return
+		}
+		webhook, err := transport.webhooksService.GetWebhook(r.Context(), id)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched webhook",
+			Data:    webhook,
+		})
+	}
+}
+
+func (transport *CoreTransport) httpDeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Webhook ID must be a number",
+			})
+			return
+		}
+		if err := transport.webhooksService.DeleteWebhook(r.Context(), id); err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Deleted webhook",
+		})
+	}
+}
+
+func (transport *CoreTransport) httpListWebhookDeliveries() http.HandlerFunc {
+	type Params struct {
+		webhooks.DeliveryFilter
+		pagination.Request
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Webhook ID must be a number",
+			})
+			return
+		}
+		params, err := httpfilter.Parse[Params](r)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		page, err := transport.webhooksService.ListDeliveries(r.Context(), id, params.DeliveryFilter, params.Request)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, pagination.CreateResponse(r, transport.baseURL, *page))
+	}
+}
+
+func (transport *CoreTransport) httpRetryWebhookDelivery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Webhook ID must be a number",
+			})
+			return
+		}
+		deliveryID, err := strconv.ParseInt(chi.URLParam(r, "delivery_id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "Delivery ID must be a number",
+			})
+			return
+		}
+		delivery, err := transport.webhooksService.RetryDelivery(r.Context(), id, deliveryID)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Scheduled webhook delivery for retry",
+			Data:    delivery,
+		})
+	}
+}
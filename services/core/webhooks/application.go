@@ -0,0 +1,293 @@
+package webhooks
+
+//go:generate moq -pkg webhooks_test -out mock_test.go . Store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"sensorbucket.nl/sensorbucket/internal/cleanupper"
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/pkg/auth"
+)
+
+const (
+	// MaxDeliveryMeasurements limits the amount of measurements in a single delivery
+	MaxDeliveryMeasurements = 1000
+	// DeliveryBatchSize is the amount of due deliveries claimed at once
+	DeliveryBatchSize = 100
+	// MaxWebhookConcurrency is the amount of deliveries of a single webhook an instance attempts at once, such
+	// that a slow webhook can not occupy every delivery worker
+	MaxWebhookConcurrency = 4
+	// DefaultDeliveryWorkers is the amount of deliveries attempted at the same time
+	DefaultDeliveryWorkers = 16
+	// DeliveryTimeout limits a single delivery attempt
+	DeliveryTimeout = 30 * time.Second
+)
+
+type Store interface {
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+	ListWebhooks(ctx context.Context, tenantID int64, r pagination.Request) (*pagination.Page[Webhook], error)
+	GetWebhook(ctx context.Context, id, tenantID int64) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, id, tenantID int64) error
+	// ClaimDueDeliveries returns pending deliveries of which the next attempt is due together with their
+	// webhook, at most perWebhook for every webhook, and postpones their next attempt by the lease such that
+	// they are claimed only once
+	ClaimDueDeliveries(ctx context.Context, now time.Time, limit, perWebhook int, lease time.Duration) ([]DueDelivery, error)
+	SaveDelivery(ctx context.Context, delivery *Delivery) error
+	ListDeliveries(ctx context.Context, filter DeliveryFilter, r pagination.Request) (*pagination.Page[Delivery], error)
+	GetDelivery(ctx context.Context, id, webhookID, tenantID int64) (*Delivery, error)
+}
+
+// DueDelivery is a delivery together with the webhook it is posted to
+type DueDelivery struct {
+	Delivery Delivery
+	Webhook  Webhook
+}
+
+type DeliveryFilter struct {
+	TenantID  int64            `url:"-"`
+	WebhookID int64            `url:"-"`
+	Status    []DeliveryStatus `url:"status"`
+}
+
+// Service manages webhooks and attempts their deliveries. Deliveries are created while storing measurements,
+// see webhooksinfra.StorePSQL.CreateMeasurementDeliveries.
+type Service struct {
+	store       Store
+	httpClient  *http.Client
+	retryPolicy RetryPolicy
+	workers     int
+}
+
+func New(store Store) *Service {
+	return &Service{
+		store:       store,
+		httpClient:  web.NewOutboundClient(DeliveryTimeout),
+		retryPolicy: DefaultRetryPolicy,
+		workers:     DefaultDeliveryWorkers,
+	}
+}
+
+// WithDeliveryWorkers sets the amount of deliveries attempted at the same time
+func (s *Service) WithDeliveryWorkers(workers int) *Service {
+	s.workers = max(workers, 1)
+	return s
+}
+
+// WithRetryPolicy sets when failed deliveries are attempted again
+func (s *Service) WithRetryPolicy(policy RetryPolicy) *Service {
+	s.retryPolicy = policy
+	return s
+}
+
+// WithHTTPClient sets the client deliveries are posted with
+func (s *Service) WithHTTPClient(client *http.Client) *Service {
+	s.httpClient = client
+	return s
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, opts CreateWebhookOpts) (*Webhook, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts.TenantID = tenantID
+	webhook, err := NewWebhook(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *Service) ListWebhooks(ctx context.Context, r pagination.Request) (*pagination.Page[Webhook], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.ListWebhooks(ctx, tenantID, r)
+}
+
+func (s *Service) GetWebhook(ctx context.Context, id int64) (*Webhook, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.GetWebhook(ctx, id, tenantID)
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, id int64) error {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.store.DeleteWebhook(ctx, id, tenantID)
+}
+
+// ListDeliveries returns the delivery log of a webhook, filtering on the dead status gives the dead letters
+func (s *Service) ListDeliveries(ctx context.Context, webhookID int64, filter DeliveryFilter, r pagination.Request) (*pagination.Page[Delivery], error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.READ_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range filter.Status {
+		if status != DeliveryPending && status != DeliveryDelivered && status != DeliveryDead {
+			return nil, ErrDeliveryStatusInvalid
+		}
+	}
+	filter.TenantID = tenantID
+	filter.WebhookID = webhookID
+	return s.store.ListDeliveries(ctx, filter, r)
+}
+
+// RetryDelivery attempts a dead delivery again with a fresh set of attempts
+func (s *Service) RetryDelivery(ctx context.Context, webhookID, deliveryID int64) (*Delivery, error) {
+	if err := auth.MustHavePermissions(ctx, auth.Permissions{auth.WRITE_MEASUREMENTS}); err != nil {
+		return nil, err
+	}
+	tenantID, err := auth.GetTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := s.store.GetDelivery(ctx, deliveryID, webhookID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != DeliveryDead {
+		return nil, ErrDeliveryNotDead
+	}
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := s.store.SaveDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// StartDeliverer attempts the due deliveries at every interval
+func (s *Service) StartDeliverer(interval time.Duration) cleanupper.Shutdown {
+	return cleanupper.Background(func(stop <-chan struct{}) {
+		log.Println("Webhook deliverer started")
+		defer log.Println("Webhook deliverer stopped!")
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-t.C:
+				if err := s.DeliverDue(context.Background(), now); err != nil {
+					log.Printf("Delivering webhooks failed: %s\n", err.Error())
+				}
+			}
+		}
+	})
+}
+
+// deliveryLease is how long claimed deliveries are not claimed again, it covers attempting every delivery of
+// a claimed batch with the delivery workers and saving the outcomes
+func (s *Service) deliveryLease() time.Duration {
+	rounds := (DeliveryBatchSize + s.workers - 1) / s.workers
+	return time.Duration(rounds+1) * DeliveryTimeout
+}
+
+// DeliverDue attempts the deliveries that are due until none are left
+func (s *Service) DeliverDue(ctx context.Context, now time.Time) error {
+	for {
+		due, err := s.store.ClaimDueDeliveries(ctx, now, DeliveryBatchSize, MaxWebhookConcurrency, s.deliveryLease())
+		if err != nil {
+			return fmt.Errorf("claiming due webhook deliveries: %w", err)
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		if err := s.deliverAll(ctx, due, now); err != nil {
+			return err
+		}
+	}
+}
+
+// deliverAll attempts the deliveries with the delivery workers and saves their outcome
+func (s *Service) deliverAll(ctx context.Context, due []DueDelivery, now time.Time) error {
+	errs := make([]error, len(due))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(s.workers, len(due)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ix := range jobs {
+				d := &due[ix]
+				s.attempt(ctx, &d.Delivery, d.Webhook, now)
+				if err := s.store.SaveDelivery(ctx, &d.Delivery); err != nil {
+					errs[ix] = fmt.Errorf("saving webhook delivery %d: %w", d.Delivery.ID, err)
+				}
+			}
+		}()
+	}
+	for ix := range due {
+		jobs <- ix
+	}
+	close(jobs)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// attempt posts the delivery to the webhook and records the outcome, any 2xx response counts as delivered
+func (s *Service) attempt(ctx context.Context, delivery *Delivery, webhook Webhook, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, DeliveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		delivery.failed(s.retryPolicy, nil, err.Error(), now)
+		return
+	}
+	signedAt := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(signedAt.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, signedAt, delivery.Payload))
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		delivery.failed(s.retryPolicy, nil, err.Error(), now)
+		return
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		delivery.failed(s.retryPolicy, &res.StatusCode, fmt.Sprintf("unexpected status %d", res.StatusCode), now)
+		return
+	}
+	delivery.delivered(res.StatusCode, now)
+}
@@ -0,0 +1,199 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sensorbucket.nl/sensorbucket/pkg/authtest"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+	"sensorbucket.nl/sensorbucket/services/core/webhooks"
+)
+
+func TestNewDeliveriesShouldBatchMatchingMeasurementsPerWebhook(t *testing.T) {
+	datastream := uuid.New()
+	list := []webhooks.Webhook{
+		{ID: 1, TenantID: 10},
+		{ID: 2, TenantID: 10, DeviceID: []int64{5}, ObservedProperty: []string{"water_level"}},
+		{ID: 3, TenantID: 10, Datastream: []uuid.UUID{uuid.New()}},
+		{ID: 4, TenantID: 11},
+	}
+	expiration := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	batch := []measurements.Measurement{
+		{ID: 1, OrganisationID: 10, DeviceID: 5, DatastreamID: datastream, DatastreamObservedProperty: "water_level", MeasurementExpiration: expiration},
+		{ID: 2, OrganisationID: 10, DeviceID: 5, DatastreamID: datastream, DatastreamObservedProperty: "temperature", MeasurementExpiration: expiration.AddDate(0, 1, 0)},
+		{ID: 3, OrganisationID: 10, DeviceID: 6, DatastreamID: datastream, DatastreamObservedProperty: "water_level", MeasurementExpiration: expiration},
+	}
+	deliveries, err := webhooks.NewDeliveries(list, batch, time.Now())
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+
+	assert.Equal(t, int64(1), deliveries[0].WebhookID)
+	assert.Equal(t, 3, deliveries[0].MeasurementCount)
+	assert.Equal(t, webhooks.DeliveryPending, deliveries[0].Status)
+
+	assert.Equal(t, expiration.AddDate(0, 1, 0), deliveries[0].ExpiresAt, "deliveries expire with their latest measurement")
+	assert.Equal(t, int64(2), deliveries[1].WebhookID)
+	assert.Equal(t, expiration, deliveries[1].ExpiresAt)
+	var payload webhooks.Payload
+	require.NoError(t, json.Unmarshal(deliveries[1].Payload, &payload))
+	assert.Equal(t, int64(2), payload.WebhookID)
+	require.Len(t, payload.Measurements, 1)
+	assert.Equal(t, 1, payload.Measurements[0].ID)
+}
+
+func TestDeliverDueShouldSignAndRetryWithBackoff(t *testing.T) {
+	status := http.StatusInternalServerError
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	delivery := webhooks.Delivery{ID: 7, WebhookID: 1, TenantID: 10, Status: webhooks.DeliveryPending, Payload: []byte(`{"webhook_id":1}`)}
+	store := &StoreMock{
+		ClaimDueDeliveriesFunc: func(ctx context.Context, now time.Time, limit, perWebhook int, lease time.Duration) ([]webhooks.DueDelivery, error) {
+			if delivery.Status != webhooks.DeliveryPending || delivery.NextAttemptAt.After(now) {
+				return nil, nil
+			}
+			return []webhooks.DueDelivery{{Delivery: delivery, Webhook: webhooks.Webhook{ID: 1, URL: server.URL, Secret: "secret"}}}, nil
+		},
+		SaveDeliveryFunc: func(ctx context.Context, d *webhooks.Delivery) error {
+			delivery = *d
+			return nil
+		},
+	}
+	svc := webhooks.New(store).
+		WithRetryPolicy(webhooks.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}).
+		WithHTTPClient(server.Client())
+
+	now := time.Now()
+	require.NoError(t, svc.DeliverDue(context.Background(), now))
+	require.Len(t, requests, 1)
+	signedAt, err := strconv.ParseInt(requests[0].Header.Get(webhooks.TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, webhooks.Sign("secret", time.Unix(signedAt, 0), bodies[0]), requests[0].Header.Get(webhooks.SignatureHeader))
+	assert.Equal(t, "7", requests[0].Header.Get(webhooks.DeliveryHeader))
+	assert.Equal(t, webhooks.DeliveryPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, *delivery.LastStatusCode)
+	assert.Equal(t, now.Add(time.Minute), delivery.NextAttemptAt)
+
+	// Not yet due
+	require.NoError(t, svc.DeliverDue(context.Background(), now.Add(30*time.Second)))
+	assert.Len(t, requests, 1)
+
+	// Delay doubles after every attempt
+	now = now.Add(time.Minute)
+	require.NoError(t, svc.DeliverDue(context.Background(), now))
+	assert.Equal(t, now.Add(2*time.Minute), delivery.NextAttemptAt)
+
+	// The last attempt moves the delivery to the dead letters
+	require.NoError(t, svc.DeliverDue(context.Background(), now.Add(2*time.Minute)))
+	assert.Len(t, requests, 3)
+	assert.Equal(t, webhooks.DeliveryDead, delivery.Status)
+
+	// Retried dead letters are delivered
+	store.GetDeliveryFunc = func(ctx context.Context, id, webhookID, tenantID int64) (*webhooks.Delivery, error) {
+		d := delivery
+		return &d, nil
+	}
+	_, err = svc.RetryDelivery(authtest.GodContext(), 1, 7)
+	require.NoError(t, err)
+	assert.Equal(t, webhooks.DeliveryPending, delivery.Status)
+	assert.Equal(t, 0, delivery.Attempts)
+
+	status = http.StatusNoContent
+	require.NoError(t, svc.DeliverDue(context.Background(), time.Now()))
+	assert.Equal(t, webhooks.DeliveryDelivered, delivery.Status)
+	assert.NotNil(t, delivery.DeliveredAt)
+	assert.Empty(t, delivery.LastError)
+
+	_, err = svc.RetryDelivery(authtest.GodContext(), 1, 7)
+	assert.ErrorIs(t, err, webhooks.ErrDeliveryNotDead)
+}
+
+func TestDeliverDueShouldLeaseTheWholeBatchAndLimitDeliveriesPerWebhook(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	claimed := false
+	store := &StoreMock{
+		ClaimDueDeliveriesFunc: func(ctx context.Context, now time.Time, limit, perWebhook int, lease time.Duration) ([]webhooks.DueDelivery, error) {
+			if claimed {
+				return nil, nil
+			}
+			claimed = true
+			due := []webhooks.DueDelivery{}
+			for ix := 0; ix < min(limit, perWebhook); ix++ {
+				due = append(due, webhooks.DueDelivery{
+					Delivery: webhooks.Delivery{ID: int64(ix), WebhookID: 1, Status: webhooks.DeliveryPending},
+					Webhook:  webhooks.Webhook{ID: 1, URL: server.URL},
+				})
+			}
+			return due, nil
+		},
+		SaveDeliveryFunc: func(ctx context.Context, d *webhooks.Delivery) error {
+			return nil
+		},
+	}
+	svc := webhooks.New(store).WithHTTPClient(server.Client()).WithDeliveryWorkers(10)
+
+	require.NoError(t, svc.DeliverDue(context.Background(), time.Now()))
+	require.Len(t, store.ClaimDueDeliveriesCalls(), 2)
+	call := store.ClaimDueDeliveriesCalls()[0]
+	assert.Equal(t, webhooks.MaxWebhookConcurrency, call.PerWebhook)
+	assert.GreaterOrEqual(t, call.Lease, webhooks.DeliveryTimeout*time.Duration(webhooks.DeliveryBatchSize/10),
+		"the lease covers attempting every claimed delivery with the workers")
+	assert.Len(t, store.SaveDeliveryCalls(), webhooks.MaxWebhookConcurrency)
+	assert.Greater(t, maxInFlight.Load(), int32(1), "deliveries are attempted at the same time")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(webhooks.MaxWebhookConcurrency))
+}
+
+func TestCreateWebhookShouldGenerateSecret(t *testing.T) {
+	store := &StoreMock{
+		CreateWebhookFunc: func(ctx context.Context, webhook *webhooks.Webhook) error {
+			webhook.ID = 1
+			return nil
+		},
+	}
+	svc := webhooks.New(store)
+
+	_, err := svc.CreateWebhook(authtest.GodContext(), webhooks.CreateWebhookOpts{URL: "ftp://example.com"})
+	assert.ErrorIs(t, err, webhooks.ErrWebhookURLInvalid)
+	_, err = svc.CreateWebhook(authtest.GodContext(), webhooks.CreateWebhookOpts{URL: "http://10.0.0.5/hook"})
+	assert.ErrorIs(t, err, webhooks.ErrWebhookURLInvalid)
+	assert.Empty(t, store.CreateWebhookCalls())
+
+	webhook, err := svc.CreateWebhook(authtest.GodContext(), webhooks.CreateWebhookOpts{URL: "https://example.com/hook"})
+	require.NoError(t, err)
+	assert.Equal(t, authtest.DefaultTenantID, webhook.TenantID)
+	assert.Len(t, webhook.Secret, 64)
+	assert.Equal(t, []int64{}, webhook.DeviceID)
+}
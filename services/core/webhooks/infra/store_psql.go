@@ -0,0 +1,322 @@
+package webhooksinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/pagination"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+	"sensorbucket.nl/sensorbucket/services/core/webhooks"
+)
+
+var pq = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+var _ webhooks.Store = (*StorePSQL)(nil)
+
+type StorePSQL struct {
+	databasePool *pgxpool.Pool
+}
+
+func NewStorePSQL(pool *pgxpool.Pool) *StorePSQL {
+	return &StorePSQL{databasePool: pool}
+}
+
+// webhookColumns are the columns selected for a webhook, in the order of webhookScanTargets. The secret
+// is only selected where it is required for signing.
+var webhookColumns = []string{
+	"w.id", "w.tenant_id", "w.url", "w.device_ids", "w.datastream_ids", "w.observed_properties", "w.created_at",
+}
+
+func webhookScanTargets(webhook *webhooks.Webhook) []any {
+	return []any{
+		&webhook.ID, &webhook.TenantID, &webhook.URL, &webhook.DeviceID, &webhook.Datastream, &webhook.ObservedProperty,
+		&webhook.CreatedAt,
+	}
+}
+
+func (s *StorePSQL) CreateWebhook(ctx context.Context, webhook *webhooks.Webhook) error {
+	err := s.databasePool.QueryRow(ctx, `
+		INSERT INTO webhooks (tenant_id, url, secret, device_ids, datastream_ids, observed_properties, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		webhook.TenantID, webhook.URL, webhook.Secret, webhook.DeviceID, webhook.Datastream, webhook.ObservedProperty,
+		webhook.CreatedAt,
+	).Scan(&webhook.ID)
+	if err != nil {
+		return fmt.Errorf("error inserting webhook: %w", err)
+	}
+	return nil
+}
+
+type webhookPageQuery struct {
+	ID int64 `pagination:"w.id,ASC"`
+}
+
+func (s *StorePSQL) ListWebhooks(ctx context.Context, tenantID int64, r pagination.Request) (*pagination.Page[webhooks.Webhook], error) {
+	q := pq.Select(webhookColumns...).From("webhooks w").Where(sq.Eq{"w.tenant_id": tenantID})
+
+	cursor, err := pagination.GetCursor[webhookPageQuery](r)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks, error getting pagination cursor: %w", err)
+	}
+	q, err = pagination.Apply(q, cursor)
+	if err != nil {
+		return nil, err
+	}
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting webhooks from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]webhooks.Webhook, 0, cursor.Limit)
+	for rows.Next() {
+		var webhook webhooks.Webhook
+		if err := rows.Scan(append(webhookScanTargets(&webhook), &cursor.Columns.ID)...); err != nil {
+			return nil, err
+		}
+		list = append(list, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page := pagination.CreatePageT(list, cursor)
+	return &page, nil
+}
+
+func (s *StorePSQL) GetWebhook(ctx context.Context, id, tenantID int64) (*webhooks.Webhook, error) {
+	query, params, err := pq.Select(webhookColumns...).From("webhooks w").
+		Where(sq.Eq{"w.id": id, "w.tenant_id": tenantID}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var webhook webhooks.Webhook
+	err = s.databasePool.QueryRow(ctx, query, params...).Scan(webhookScanTargets(&webhook)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, webhooks.ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error selecting webhook from db: %w", err)
+	}
+	return &webhook, nil
+}
+
+func (s *StorePSQL) DeleteWebhook(ctx context.Context, id, tenantID int64) error {
+	res, err := s.databasePool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return webhooks.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// CreateMeasurementDeliveries creates the deliveries of the stored measurements for the webhooks of their
+// tenants. It is a measurementsinfra.CommitHook, such that deliveries are created if and only if the
+// measurements are stored.
+func (s *StorePSQL) CreateMeasurementDeliveries(ctx context.Context, tx pgx.Tx, stored []measurements.Measurement) error {
+	tenantIDs := lo.Uniq(lo.Map(stored, func(m measurements.Measurement, _ int) int64 { return int64(m.OrganisationID) }))
+	list, err := listTenantWebhooks(ctx, tx, tenantIDs)
+	if err != nil {
+		return err
+	}
+	deliveries, err := webhooks.NewDeliveries(list, stored, time.Now())
+	if err != nil {
+		return err
+	}
+	return createDeliveries(ctx, tx, deliveries)
+}
+
+// listTenantWebhooks returns the webhooks of any of the tenants including their secret
+func listTenantWebhooks(ctx context.Context, tx pgx.Tx, tenantIDs []int64) ([]webhooks.Webhook, error) {
+	query, params, err := pq.Select(webhookColumns...).Column("w.secret").From("webhooks w").
+		Where(sq.Eq{"w.tenant_id": tenantIDs}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting tenant webhooks from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := []webhooks.Webhook{}
+	for rows.Next() {
+		var webhook webhooks.Webhook
+		if err := rows.Scan(append(webhookScanTargets(&webhook), &webhook.Secret)...); err != nil {
+			return nil, err
+		}
+		list = append(list, webhook)
+	}
+	return list, rows.Err()
+}
+
+func createDeliveries(ctx context.Context, tx pgx.Tx, deliveries []webhooks.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	q := pq.Insert("webhook_deliveries").Columns(
+		"webhook_id", "tenant_id", "status", "payload", "measurement_count", "created_at", "next_attempt_at",
+		"expires_at",
+	)
+	for _, d := range deliveries {
+		q = q.Values(
+			d.WebhookID, d.TenantID, d.Status, d.Payload, d.MeasurementCount, d.CreatedAt, d.NextAttemptAt, d.ExpiresAt,
+		)
+	}
+	query, params, err := q.ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, query, params...); err != nil {
+		return fmt.Errorf("error inserting webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// deliveryColumns are the columns selected for a delivery, in the order of deliveryScanTargets
+var deliveryColumns = []string{
+	"d.id", "d.webhook_id", "d.tenant_id", "d.status", "d.payload", "d.measurement_count", "d.attempts",
+	"d.last_status_code", "d.last_error", "d.created_at", "d.next_attempt_at", "d.delivered_at", "d.expires_at",
+}
+
+func deliveryScanTargets(d *webhooks.Delivery) []any {
+	return []any{
+		&d.ID, &d.WebhookID, &d.TenantID, &d.Status, &d.Payload, &d.MeasurementCount, &d.Attempts,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.NextAttemptAt, &d.DeliveredAt, &d.ExpiresAt,
+	}
+}
+
+// ClaimDueDeliveries skips deliveries locked by other instances, the claimed deliveries are returned with
+// the end of their lease as next attempt time
+func (s *StorePSQL) ClaimDueDeliveries(
+	ctx context.Context,
+	now time.Time,
+	limit, perWebhook int,
+	lease time.Duration,
+) ([]webhooks.DueDelivery, error) {
+	rows, err := s.databasePool.Query(ctx, fmt.Sprintf(`
+		WITH ranked AS (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY webhook_id ORDER BY next_attempt_at, id) AS nth
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+		), due AS (
+			SELECT d.id, d.next_attempt_at FROM webhook_deliveries d
+			JOIN ranked ON ranked.id = d.id AND ranked.nth <= $4
+			WHERE d.status = 'pending' AND d.next_attempt_at <= $1
+			ORDER BY d.next_attempt_at LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d SET next_attempt_at = $3
+			FROM due WHERE d.id = due.id
+			RETURNING d.*, due.next_attempt_at AS due_at
+		)
+		SELECT %s, w.url, w.secret FROM claimed d
+		JOIN webhooks w ON w.id = d.webhook_id
+		ORDER BY d.due_at`,
+		strings.Join(deliveryColumns, ", "),
+	), now, limit, now.Add(lease), perWebhook)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	list := []webhooks.DueDelivery{}
+	for rows.Next() {
+		var due webhooks.DueDelivery
+		if err := rows.Scan(append(deliveryScanTargets(&due.Delivery), &due.Webhook.URL, &due.Webhook.Secret)...); err != nil {
+			return nil, err
+		}
+		due.Webhook.ID = due.Delivery.WebhookID
+		due.Webhook.TenantID = due.Delivery.TenantID
+		list = append(list, due)
+	}
+	return list, rows.Err()
+}
+
+func (s *StorePSQL) SaveDelivery(ctx context.Context, d *webhooks.Delivery) error {
+	_, err := s.databasePool.Exec(ctx, `
+		UPDATE webhook_deliveries SET
+			status = $2, attempts = $3, last_status_code = $4, last_error = $5, next_attempt_at = $6, delivered_at = $7
+		WHERE id = $1`,
+		d.ID, d.Status, d.Attempts, d.LastStatusCode, d.LastError, d.NextAttemptAt, d.DeliveredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving webhook delivery: %w", err)
+	}
+	return nil
+}
+
+type deliveryPageQuery struct {
+	ID int64 `pagination:"d.id,DESC"`
+}
+
+func (s *StorePSQL) ListDeliveries(ctx context.Context, filter webhooks.DeliveryFilter, r pagination.Request) (*pagination.Page[webhooks.Delivery], error) {
+	q := pq.Select(deliveryColumns...).From("webhook_deliveries d").
+		Where(sq.Eq{"d.tenant_id": filter.TenantID, "d.webhook_id": filter.WebhookID})
+	if len(filter.Status) > 0 {
+		q = q.Where(sq.Eq{"d.status": filter.Status})
+	}
+
+	cursor, err := pagination.GetCursor[deliveryPageQuery](r)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries, error getting pagination cursor: %w", err)
+	}
+	q, err = pagination.Apply(q, cursor)
+	if err != nil {
+		return nil, err
+	}
+	query, params, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.databasePool.Query(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting webhook deliveries from db: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]webhooks.Delivery, 0, cursor.Limit)
+	for rows.Next() {
+		var d webhooks.Delivery
+		if err := rows.Scan(append(deliveryScanTargets(&d), &cursor.Columns.ID)...); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page := pagination.CreatePageT(list, cursor)
+	return &page, nil
+}
+
+func (s *StorePSQL) GetDelivery(ctx context.Context, id, webhookID, tenantID int64) (*webhooks.Delivery, error) {
+	query, params, err := pq.Select(deliveryColumns...).From("webhook_deliveries d").
+		Where(sq.Eq{"d.id": id, "d.webhook_id": webhookID, "d.tenant_id": tenantID}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var d webhooks.Delivery
+	err = s.databasePool.QueryRow(ctx, query, params...).Scan(deliveryScanTargets(&d)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, webhooks.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error selecting webhook delivery from db: %w", err)
+	}
+	return &d, nil
+}
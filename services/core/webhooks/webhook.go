@@ -0,0 +1,223 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+	"sensorbucket.nl/sensorbucket/services/core/measurements"
+)
+
+var (
+	ErrWebhookNotFound       = web.NewError(http.StatusNotFound, "Webhook not found", "ERR_WEBHOOK_NOT_FOUND")
+	ErrWebhookURLInvalid     = web.NewError(http.StatusBadRequest, "Webhook requires an http(s) URL of a public host", "ERR_WEBHOOK_URL_INVALID")
+	ErrDeliveryNotFound      = web.NewError(http.StatusNotFound, "Webhook delivery not found", "ERR_WEBHOOK_DELIVERY_NOT_FOUND")
+	ErrDeliveryNotDead       = web.NewError(http.StatusBadRequest, "Only dead webhook deliveries can be retried", "ERR_WEBHOOK_DELIVERY_NOT_DEAD")
+	ErrDeliveryStatusInvalid = web.NewError(http.StatusBadRequest, "Delivery status must be one of pending, delivered or dead", "ERR_WEBHOOK_DELIVERY_STATUS_INVALID")
+)
+
+const (
+	// SignatureHeader contains the hex encoded HMAC-SHA256 of the timestamp, a dot and the body, signed
+	// with the secret of the webhook
+	SignatureHeader = "X-SensorBucket-Signature"
+	// TimestampHeader contains the unix time at which the request was signed
+	TimestampHeader = "X-SensorBucket-Timestamp"
+	// DeliveryHeader contains the id of the delivery, which is the same for every attempt
+	DeliveryHeader = "X-SensorBucket-Delivery"
+)
+
+// Webhook receives the stored measurements of its tenant that match every given filter
+type Webhook struct {
+	ID       int64  `json:"id"`
+	TenantID int64  `json:"tenant_id"`
+	URL      string `json:"url"`
+	// Secret is only returned when the webhook is created
+	Secret           string      `json:"secret,omitempty"`
+	DeviceID         []int64     `json:"device_id"`
+	Datastream       []uuid.UUID `json:"datastream"`
+	ObservedProperty []string    `json:"observed_property"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+type CreateWebhookOpts struct {
+	TenantID         int64       `json:"-"`
+	URL              string      `json:"url"`
+	DeviceID         []int64     `json:"device_id"`
+	Datastream       []uuid.UUID `json:"datastream"`
+	ObservedProperty []string    `json:"observed_property"`
+}
+
+func NewWebhook(opts CreateWebhookOpts) (*Webhook, error) {
+	if err := web.ValidateOutboundURL(opts.URL); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebhookURLInvalid, err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	webhook := &Webhook{
+		TenantID:         opts.TenantID,
+		URL:              opts.URL,
+		Secret:           hex.EncodeToString(secret),
+		DeviceID:         opts.DeviceID,
+		Datastream:       opts.Datastream,
+		ObservedProperty: opts.ObservedProperty,
+		CreatedAt:        time.Now(),
+	}
+	if webhook.DeviceID == nil {
+		webhook.DeviceID = []int64{}
+	}
+	if webhook.Datastream == nil {
+		webhook.Datastream = []uuid.UUID{}
+	}
+	if webhook.ObservedProperty == nil {
+		webhook.ObservedProperty = []string{}
+	}
+	return webhook, nil
+}
+
+// Matches reports whether the measurement belongs to the tenant of the webhook and matches its filters,
+// an empty filter matches any value
+func (webhook *Webhook) Matches(m measurements.Measurement) bool {
+	return int64(m.OrganisationID) == webhook.TenantID &&
+		matchesAny(webhook.DeviceID, m.DeviceID) &&
+		matchesAny(webhook.Datastream, m.DatastreamID) &&
+		matchesAny(webhook.ObservedProperty, m.DatastreamObservedProperty)
+}
+
+func matchesAny[T comparable](values []T, v T) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature of the body at the timestamp for the signature header
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead is a delivery that failed its last attempt, it is only attempted again when retried
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Payload is the body posted to a webhook
+type Payload struct {
+	WebhookID    int64                      `json:"webhook_id"`
+	Measurements []measurements.Measurement `json:"measurements"`
+}
+
+// Delivery is a batch of measurements posted to a webhook
+type Delivery struct {
+	ID               int64           `json:"id"`
+	WebhookID        int64           `json:"webhook_id"`
+	TenantID         int64           `json:"tenant_id"`
+	Status           DeliveryStatus  `json:"status"`
+	Payload          json.RawMessage `json:"payload"`
+	MeasurementCount int             `json:"measurement_count"`
+	Attempts         int             `json:"attempts"`
+	LastStatusCode   *int            `json:"last_status_code"`
+	LastError        string          `json:"last_error"`
+	CreatedAt        time.Time       `json:"created_at"`
+	NextAttemptAt    time.Time       `json:"next_attempt_at"`
+	DeliveredAt      *time.Time      `json:"delivered_at"`
+	// ExpiresAt is the latest expiration of its measurements, after which the delivery is deleted whatever
+	// its status
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewDeliveries creates a delivery of at most MaxDeliveryMeasurements measurements for every webhook with
+// matching measurements
+func NewDeliveries(webhooks []Webhook, batch []measurements.Measurement, now time.Time) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	for _, webhook := range webhooks {
+		matching := lo.Filter(batch, func(m measurements.Measurement, _ int) bool { return webhook.Matches(m) })
+		for _, chunk := range lo.Chunk(matching, MaxDeliveryMeasurements) {
+			payload, err := json.Marshal(Payload{WebhookID: webhook.ID, Measurements: chunk})
+			if err != nil {
+				return nil, err
+			}
+			expiresAt := lo.MaxBy(chunk, func(a, b measurements.Measurement) bool {
+				return a.MeasurementExpiration.After(b.MeasurementExpiration)
+			}).MeasurementExpiration
+			deliveries = append(deliveries, Delivery{
+				WebhookID:        webhook.ID,
+				TenantID:         webhook.TenantID,
+				Status:           DeliveryPending,
+				Payload:          payload,
+				MeasurementCount: len(chunk),
+				CreatedAt:        now,
+				NextAttemptAt:    now,
+				ExpiresAt:        expiresAt,
+			})
+		}
+	}
+	return deliveries, nil
+}
+
+// RetryPolicy determines when a failed delivery is attempted again. The delay doubles after every failed
+// attempt, starting at the base delay up to the maximum delay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 8,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// backoff returns the delay after the given amount of failed attempts
+func (policy RetryPolicy) backoff(attempts int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < attempts && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, policy.MaxDelay)
+}
+
+// failed records a failed attempt, the delivery is dead once it exhausted its attempts
+func (delivery *Delivery) failed(policy RetryPolicy, statusCode *int, reason string, now time.Time) {
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = reason
+	if delivery.Attempts >= policy.MaxAttempts {
+		delivery.Status = DeliveryDead
+		return
+	}
+	delivery.NextAttemptAt = now.Add(policy.backoff(delivery.Attempts))
+}
+
+func (delivery *Delivery) delivered(statusCode int, now time.Time) {
+	delivery.Attempts++
+	delivery.Status = DeliveryDelivered
+	delivery.LastStatusCode = &statusCode
+	delivery.LastError = ""
+	delivery.DeliveredAt = &now
+}
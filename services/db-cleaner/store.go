@@ -39,6 +39,22 @@ func (s *dbStore) DeleteExpiredData() error {
 		return fmt.Errorf("delete measurements: %w", err)
 	}
 	log.Printf("Deleted %d measurements from sensorbucket database", measurementsDeleted)
+
+	// Webhook deliveries contain measurements, they expire with their latest measurement
+	deliveriesDeleted, err := exec(s.sensorbucketDb, `DELETE FROM webhook_deliveries WHERE expires_at <= now()`)
+	if err != nil {
+		return fmt.Errorf("delete webhook deliveries: %w", err)
+	}
+	log.Printf("Deleted %d webhook deliveries from sensorbucket database", deliveriesDeleted)
+
+	// Rollups have their own, usually longer, retention
+	for _, table := range []string{"measurement_rollups_hourly", "measurement_rollups_daily"} {
+		rollupsDeleted, err := exec(s.sensorbucketDb, `DELETE FROM `+table+` WHERE rollup_expiration <= now()`)
+		if err != nil {
+			return fmt.Errorf("delete %s: %w", table, err)
+		}
+		log.Printf("Deleted %d rollups from %s in sensorbucket database", rollupsDeleted, table)
+	}
 	return nil
 }
 
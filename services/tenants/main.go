@@ -31,13 +31,14 @@ import (
 )
 
 var (
-	HTTP_API_ADDR    = env.Could("HTTP_ADDR", ":3000")
-	HTTP_API_BASE    = env.Could("HTTP_BASE", "http://localhost:3000/api")
-	HTTP_WEBUI_ADDR  = env.Could("HTTP_WEBUI_ADDR", ":3001")
-	HTTP_WEBUI_BASE  = env.Could("HTTP_WEBUI_BASE", "http://localhost:3000/auth")
-	KRATOS_ADMIN_API = env.Could("KRATOS_ADMIN_API", "http://kratos:4434/")
-	AUTH_JWKS_URL    = env.Could("AUTH_JWKS_URL", "http://oathkeeper:4456/.well-known/jwks.json")
-	DB_DSN           = env.Must("DB_DSN")
+	HTTP_API_ADDR      = env.Could("HTTP_ADDR", ":3000")
+	HTTP_API_BASE      = env.Could("HTTP_BASE", "http://localhost:3000/api")
+	HTTP_WEBUI_ADDR    = env.Could("HTTP_WEBUI_ADDR", ":3001")
+	HTTP_INTERNAL_ADDR = env.Could("HTTP_INTERNAL_ADDR", ":3002")
+	HTTP_WEBUI_BASE    = env.Could("HTTP_WEBUI_BASE", "http://localhost:3000/auth")
+	KRATOS_ADMIN_API   = env.Could("KRATOS_ADMIN_API", "http://kratos:4434/")
+	AUTH_JWKS_URL      = env.Could("AUTH_JWKS_URL", "http://oathkeeper:4456/.well-known/jwks.json")
+	DB_DSN             = env.Must("DB_DSN")
 )
 
 func main() {
@@ -79,6 +80,11 @@ func Run(cleanup cleanupper.Cleanupper) error {
 		return fmt.Errorf("could not setup WebUI server: %w", err)
 	}
 	cleanup.Add(stopWebUI)
+	stopInternalAPI, err := runInternalAPI(errC, db)
+	if err != nil {
+		return fmt.Errorf("could not setup internal API server: %w", err)
+	}
+	cleanup.Add(stopInternalAPI)
 
 	shutdownHealth := healthchecker.Create().WithEnv().Start(ctx)
 	cleanup.Add(shutdownHealth)
@@ -131,6 +137,34 @@ func runAPI(errC chan<- error, db *sqlx.DB) (func(context.Context) error, error)
 	return srv.Shutdown, nil
 }
 
+// runInternalAPI serves the endpoints for other services on their own listener, such that they are never reachable
+// through the public API
+func runInternalAPI(errC chan<- error, db *sqlx.DB) (func(context.Context) error, error) {
+	tenantStore := tenantsinfra.NewTenantsStorePSQL(db)
+	kratosAdmin := tenantsinfra.NewKratosUserValidator(KRATOS_ADMIN_API)
+	tenantSVC := tenants.NewTenantService(tenantStore, kratosAdmin)
+
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	r.Mount("/internal", tenantstransports.NewInternalHTTP(tenantSVC))
+
+	srv := &http.Server{
+		Addr:         HTTP_INTERNAL_ADDR,
+		WriteTimeout: 5 * time.Second,
+		ReadTimeout:  5 * time.Second,
+		Handler:      r,
+	}
+
+	go func() {
+		log.Printf("[Info] Running Tenants internal API on %s\n", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil {
+			errC <- err
+		}
+	}()
+
+	return srv.Shutdown, nil
+}
+
 func runWebUI(errC chan<- error, db *sqlx.DB) (func(context.Context) error, error) {
 	// Setup Tenants service
 	tenantStore := tenantsinfra.NewTenantsStorePSQL(db)
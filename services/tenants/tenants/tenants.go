@@ -2,6 +2,7 @@ package tenants
 
 import (
 	"errors"
+	"math"
 	"net/http"
 	"time"
 
@@ -39,6 +40,15 @@ type Tenant struct {
 	ParentID            *int64
 }
 
+// ArchiveTimeDays returns the archive time rounded up to whole days or nil if the tenant has no archive time
+func (t Tenant) ArchiveTimeDays() *int {
+	if t.ArchiveTime == nil {
+		return nil
+	}
+	days := int(math.Ceil(t.ArchiveTime.Hours() / 24))
+	return &days
+}
+
 func NewTenant(dto CreateTenantDTO) Tenant {
 	return Tenant{
 		Name:                dto.Name,
@@ -0,0 +1,59 @@
+package tenantstransports
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"sensorbucket.nl/sensorbucket/internal/web"
+)
+
+// InternalHTTPTransport serves endpoints used by other SensorBucket services. These endpoints are not
+// authenticated, they are served on the internal listener of the service and must not be routed publicly.
+type InternalHTTPTransport struct {
+	router    chi.Router
+	tenantSvc TenantService
+}
+
+func NewInternalHTTP(tenantSvc TenantService) *InternalHTTPTransport {
+	t := &InternalHTTPTransport{
+		router:    chi.NewRouter(),
+		tenantSvc: tenantSvc,
+	}
+	t.router.Get("/tenants/{tenant_id}/archive-time", t.httpGetTenantArchiveTime())
+	return t
+}
+
+func (t *InternalHTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.router.ServeHTTP(w, r)
+}
+
+type TenantArchiveTime struct {
+	TenantID        int64 `json:"tenant_id"`
+	ArchiveTimeDays *int  `json:"archive_time_days"`
+}
+
+func (t *InternalHTTPTransport) httpGetTenantArchiveTime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID, err := strconv.ParseInt(chi.URLParam(r, "tenant_id"), 10, 64)
+		if err != nil {
+			web.HTTPResponse(w, http.StatusBadRequest, web.APIResponseAny{
+				Message: "tenant_id must be a number",
+			})
+			return
+		}
+		tenant, err := t.tenantSvc.GetTenantByID(r.Context(), tenantID)
+		if err != nil {
+			web.HTTPError(w, err)
+			return
+		}
+		web.HTTPResponse(w, http.StatusOK, web.APIResponseAny{
+			Message: "Fetched tenant archive time",
+			Data: TenantArchiveTime{
+				TenantID:        tenant.ID,
+				ArchiveTimeDays: tenant.ArchiveTimeDays(),
+			},
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package tenantstransports_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"sensorbucket.nl/sensorbucket/services/tenants/tenants"
+	tenantstransports "sensorbucket.nl/sensorbucket/services/tenants/transports"
+)
+
+func TestGetTenantArchiveTime(t *testing.T) {
+	archiveTime := 36 * time.Hour
+	scenarios := map[string]struct {
+		tenant   *tenants.Tenant
+		err      error
+		status   int
+		expected string
+	}{
+		"archive time is rounded up to days": {
+			tenant:   &tenants.Tenant{ID: 12345, ArchiveTime: &archiveTime},
+			status:   http.StatusOK,
+			expected: `{"message":"Fetched tenant archive time","data":{"tenant_id":12345,"archive_time_days":2}}` + "\n",
+		},
+		"tenant without archive time": {
+			tenant:   &tenants.Tenant{ID: 12345},
+			status:   http.StatusOK,
+			expected: `{"message":"Fetched tenant archive time","data":{"tenant_id":12345,"archive_time_days":null}}` + "\n",
+		},
+		"tenant does not exist": {
+			err:      tenants.ErrTenantNotFound,
+			status:   http.StatusNotFound,
+			expected: `{"message":"Tenant could not be found","code":"TENANT_NOT_FOUND"}` + "\n",
+		},
+	}
+
+	for name, scene := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			svc := TenantServiceMock{
+				GetTenantByIDFunc: func(ctx context.Context, id int64) (*tenants.Tenant, error) {
+					assert.Equal(t, int64(12345), id)
+					return scene.tenant, scene.err
+				},
+			}
+			transport := tenantstransports.NewInternalHTTP(&svc)
+			req, _ := http.NewRequest("GET", "/tenants/12345/archive-time", nil)
+
+			// Act
+			rr := httptest.NewRecorder()
+			transport.ServeHTTP(rr, req)
+
+			// Assert
+			assert.Equal(t, scene.status, rr.Code)
+			assert.Equal(t, scene.expected, rr.Body.String())
+		})
+	}
+}
@@ -329,6 +329,9 @@ var _ tenantstransports.TenantService = &TenantServiceMock{}
 //			CreateNewTenantFunc: func(ctx context.Context, tenant tenants.CreateTenantDTO) (tenants.CreateTenantDTO, error) {
 //				panic("mock out the CreateNewTenant method")
 //			},
+//			GetTenantByIDFunc: func(ctx context.Context, id int64) (*tenants.Tenant, error) {
+//				panic("mock out the GetTenantByID method")
+//			},
 //			ListTenantsFunc: func(ctx context.Context, filter tenants.Filter, p pagination.Request) (*pagination.Page[tenants.CreateTenantDTO], error) {
 //				panic("mock out the ListTenants method")
 //			},
@@ -354,6 +357,9 @@ type TenantServiceMock struct {
 	// CreateNewTenantFunc mocks the CreateNewTenant method.
 	CreateNewTenantFunc func(ctx context.Context, tenant tenants.CreateTenantDTO) (tenants.CreateTenantDTO, error)
 
+	// GetTenantByIDFunc mocks the GetTenantByID method.
+	GetTenantByIDFunc func(ctx context.Context, id int64) (*tenants.Tenant, error)
+
 	// ListTenantsFunc mocks the ListTenants method.
 	ListTenantsFunc func(ctx context.Context, filter tenants.Filter, p pagination.Request) (*pagination.Page[tenants.CreateTenantDTO], error)
 
@@ -390,6 +396,13 @@ type TenantServiceMock struct {
 			// Tenant is the tenant argument value.
 			Tenant tenants.CreateTenantDTO
 		}
+		// GetTenantByID holds details about calls to the GetTenantByID method.
+		GetTenantByID []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ID is the id argument value.
+			ID int64
+		}
 		// ListTenants holds details about calls to the ListTenants method.
 		ListTenants []struct {
 			// Ctx is the ctx argument value.
@@ -423,6 +436,7 @@ type TenantServiceMock struct {
 	lockAddTenantMember    sync.RWMutex
 	lockArchiveTenant      sync.RWMutex
 	lockCreateNewTenant    sync.RWMutex
+	lockGetTenantByID      sync.RWMutex
 	lockListTenants        sync.RWMutex
 	lockRemoveTenantMember sync.RWMutex
 	lockUpdateTenantMember sync.RWMutex
@@ -544,6 +558,42 @@ func (mock *TenantServiceMock) CreateNewTenantCalls() []struct {
 	return calls
 }
 
+// GetTenantByID calls GetTenantByIDFunc.
+func (mock *TenantServiceMock) GetTenantByID(ctx context.Context, id int64) (*tenants.Tenant, error) {
+	if mock.GetTenantByIDFunc == nil {
+		panic("TenantServiceMock.GetTenantByIDFunc: method is nil but TenantService.GetTenantByID was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		ID  int64
+	}{
+		Ctx: ctx,
+		ID:  id,
+	}
+	mock.lockGetTenantByID.Lock()
+	mock.calls.GetTenantByID = append(mock.calls.GetTenantByID, callInfo)
+	mock.lockGetTenantByID.Unlock()
+	return mock.GetTenantByIDFunc(ctx, id)
+}
+
+// GetTenantByIDCalls gets all the calls that were made to GetTenantByID.
+// Check the length with:
+//
+//	len(mockedTenantService.GetTenantByIDCalls())
+func (mock *TenantServiceMock) GetTenantByIDCalls() []struct {
+	Ctx context.Context
+	ID  int64
+} {
+	var calls []struct {
+		Ctx context.Context
+		ID  int64
+	}
+	mock.lockGetTenantByID.RLock()
+	calls = mock.calls.GetTenantByID
+	mock.lockGetTenantByID.RUnlock()
+	return calls
+}
+
 // ListTenants calls ListTenantsFunc.
 func (mock *TenantServiceMock) ListTenants(ctx context.Context, filter tenants.Filter, p pagination.Request) (*pagination.Page[tenants.CreateTenantDTO], error) {
 	if mock.ListTenantsFunc == nil {
@@ -224,6 +224,7 @@ func ensureValuesNotEmpty[T comparable](values map[string]T) []string {
 type TenantService interface {
 	CreateNewTenant(ctx context.Context, tenant tenants.CreateTenantDTO) (tenants.CreateTenantDTO, error)
 	ArchiveTenant(ctx context.Context, tenantID int64) error
+	GetTenantByID(ctx context.Context, id int64) (*tenants.Tenant, error)
 	ListTenants(ctx context.Context, filter tenants.Filter, p pagination.Request) (*pagination.Page[tenants.CreateTenantDTO], error)
 	AddTenantMember(ctx context.Context, tenantID int64, userID string, permissions auth.Permissions) error
 	RemoveTenantMember(ctx context.Context, tenantID int64, userID string) error